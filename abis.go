@@ -0,0 +1,131 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/abi"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/schema"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// abiFetchTimeout bounds fetching a program's source from the endpoint.
+const abiFetchTimeout = 5 * time.Second
+
+// programABI returns the ABI of program as deployed on network, from this container's
+// cache or the network's endpoint.
+func programABI(ctx context.Context, cfgEnv *EnvConfig, network, program string) (*abi.ABI, error) {
+	if a, ok, err := bundledABI(cfgEnv, program); ok || err != nil {
+		return a, err
+	}
+	preset, _ := cfgEnv.networks.Lookup(network)
+	endpoint := cmp.Or(preset.Endpoint, strings.TrimSpace(cfgEnv.EndPoint))
+	if endpoint == "" {
+		return nil, errors.New("no endpoint configured for " + network)
+	}
+	key := endpoint + "\x00" + network + "\x00" + program
+	if a, ok := programABIs.Get(key); ok {
+		return a, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, abiFetchTimeout)
+	defer cancel()
+	src, err := abi.Fetch(ctx, nil, endpoint, network, program)
+	if err != nil {
+		return nil, err
+	}
+	a, err := abi.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	programABIs.Set(key, a)
+	return a, nil
+}
+
+// abiAction describes params.program as deployed on params.network: its transitions with
+// their inputs and outputs, mappings, records and structs. It is available to every
+// caller; programs outside the contract allowlists are not described.
+func abiAction(ctx context.Context, cfgEnv *EnvConfig, caller string, params map[string]any) events.LambdaFunctionURLResponse {
+	program, _ := params["program"].(string)
+	net, _ := params["network"].(string)
+	program, net = strings.ToLower(program), strings.ToLower(net)
+	if !strings.HasSuffix(program, ".aleo") || net == "" {
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, "params.program (e.g. token.aleo) and params.network are required", nil))
+	}
+	_, ok, _, err := allowContract(ctx, cfgEnv, program)
+	if err != nil {
+		return jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, err.Error(), nil))
+	}
+	if !ok {
+		return jsonResp(http.StatusForbidden, codedError(i18n.ContractNotAllowed, fmt.Sprintf("contract %q not allowed", program), map[string]string{"contract": program}))
+	}
+	release, err := quotas.Acquire(caller)
+	if err != nil {
+		return quotaExceeded(caller, err)
+	}
+	defer release()
+	a, err := programABI(ctx, cfgEnv, net, program)
+	switch {
+	case errors.Is(err, abi.ErrNotFound):
+		return jsonResp(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		return jsonResp(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return jsonResp(http.StatusOK, a)
+}
+
+// bundledABI returns the ABI of program from ABI_DIR, which holds program sources named
+// by program ID, e.g. token.aleo. ok is false when the program is not bundled.
+func bundledABI(cfgEnv *EnvConfig, program string) (a *abi.ABI, ok bool, err error) {
+	if cfgEnv.ABIDir == "" || !strings.HasSuffix(program, ".aleo") || strings.ContainsAny(program, `/\`) {
+		return nil, false, nil
+	}
+	key := "bundled\x00" + program
+	if a, ok := programABIs.Get(key); ok {
+		return a, true, nil
+	}
+	src, err := os.ReadFile(filepath.Join(cfgEnv.ABIDir, program))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	if a, err = abi.Parse(string(src)); err != nil {
+		return nil, true, fmt.Errorf("%s: %w", program, err)
+	}
+	programABIs.Set(key, a)
+	return a, true, nil
+}
+
+// validateInputs checks an execute's inputs against the transition's signature when
+// its program's ABI is bundled in ABI_DIR or, with ABI_VALIDATION, can be fetched.
+// Without an ABI the request goes ahead and leo reports any mismatch itself.
+func validateInputs(ctx context.Context, cfgEnv *EnvConfig, args []string) *schema.ValidationError {
+	contract, method := utils.ExtractExecuteContract(args)
+	if contract == "" || (cfgEnv.ABIDir == "" && !cfgEnv.ABIValidation) {
+		return nil
+	}
+	net := strings.ToLower(utils.GetFlagValue(args, "--network"))
+	a, ok, err := bundledABI(cfgEnv, contract)
+	if !ok && err == nil && cfgEnv.ABIValidation && net != "" {
+		a, err = programABI(ctx, cfgEnv, net, contract)
+	}
+	if a == nil || err != nil {
+		return nil
+	}
+	f, ok := a.Function(method)
+	if !ok {
+		return &schema.ValidationError{Errors: []schema.FieldError{{Field: "function", Message: fmt.Sprintf("%s has no function %q", contract, method)}}}
+	}
+	return f.Validate(utils.Tokenize(args).Positionals()[2:])
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/invite"
+	"github.com/debendraoli/leo-lambda/pkg/metrics"
+	"github.com/debendraoli/leo-lambda/pkg/request"
+	"github.com/debendraoli/leo-lambda/pkg/signedurl"
+	"github.com/debendraoli/leo-lambda/pkg/usage"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// adminActions may only be invoked by principals listed in ADMIN_PRINCIPALS.
+var adminActions = []string{"journal", "invalidate", "metrics", "allowlist", "usage", "export", "invite", "signUrl", "schedules", "migrate", "diff", "purge", "diagnose", "keys"}
+
+// handleAction dispatches requests that carry an "action" instead of leo args.
+func handleAction(ctx context.Context, req events.LambdaFunctionURLRequest, cfgEnv *EnvConfig, who principal, body request.InvokeRequest) events.LambdaFunctionURLResponse {
+	if slices.Contains(adminActions, body.Action) && !isAdmin(req, cfgEnv) {
+		return jsonResp(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("action %q requires an admin principal", body.Action)})
+	}
+	switch body.Action {
+	case "journal":
+		return journalAction(cfgEnv, body.Params)
+	case "invalidate":
+		return invalidateAction(body.Params)
+	case "metrics":
+		return metricsAction(body.Params)
+	case "allowlist":
+		return allowlistAction(ctx, cfgEnv, body.Params)
+	case "usage":
+		return usageAction(cfgEnv, body.Params)
+	case "export":
+		return exportAction(ctx, cfgEnv, body.Params)
+	case "invite":
+		return inviteAction(ctx, req, cfgEnv, body.Params)
+	case "signUrl":
+		return signURLAction(req, cfgEnv, body.Params)
+	case "estimateFee":
+		return estimateFeeAction(ctx, cfgEnv, who.id, body.Params)
+	case "schedules":
+		return schedulesAction(cfgEnv)
+	case "abi":
+		return abiAction(ctx, cfgEnv, who.id, body.Params)
+	case "scaffold":
+		return scaffoldAction(ctx, cfgEnv, who.id, body.Params)
+	case "migrate":
+		return migrateAction(ctx, body.Params)
+	case "diff":
+		return diffAction(ctx, req, cfgEnv, body.Params)
+	case "purge":
+		return purgeAction(ctx, cfgEnv, body.Params)
+	case "diagnose":
+		return diagnoseAction(ctx, cfgEnv)
+	case "keys":
+		return keysAction(cfgEnv)
+	case "saga":
+		return sagaAction(ctx, cfgEnv, who, body)
+	}
+	return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown action %q", body.Action)})
+}
+
+// isAdmin reports whether the caller's IAM principal is listed in ADMIN_PRINCIPALS.
+// Admin actions are therefore only reachable with AWS_IAM auth on the Function URL.
+func isAdmin(req events.LambdaFunctionURLRequest, cfgEnv *EnvConfig) bool {
+	a := req.RequestContext.Authorizer
+	if a == nil || a.IAM == nil || a.IAM.UserARN == "" {
+		return false
+	}
+	return slices.Contains(cfgEnv.AdminPrincipals, a.IAM.UserARN)
+}
+
+// journalAction returns one journal entry when params.id is set, otherwise the most
+// recent entries (params.limit, default 20) without their output, optionally only
+// those carrying all of params.tags.
+func journalAction(cfgEnv *EnvConfig, params map[string]any) events.LambdaFunctionURLResponse {
+	j := cfgEnv.journal()
+	if !j.Enabled() {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "journal is not enabled (set JOURNAL_DIR)"})
+	}
+	if id, _ := params["id"].(string); id != "" {
+		e, err := j.Read(id)
+		if errors.Is(err, os.ErrNotExist) {
+			return jsonResp(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("journal %q not found", id)})
+		}
+		if err != nil {
+			return jsonResp(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return jsonResp(http.StatusOK, e)
+	}
+	limit := 20
+	if l, ok := params["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+	want := map[string]string{}
+	if t, ok := params["tags"].(map[string]any); ok {
+		for k, v := range t {
+			s, ok := v.(string)
+			if !ok {
+				return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("params.tags.%s must be a string", k)})
+			}
+			want[k] = s
+		}
+	}
+	entries, err := j.List(limit, want)
+	if err != nil {
+		return jsonResp(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return jsonResp(http.StatusOK, map[string]any{"entries": entries})
+}
+
+// invalidateAction drops the named warm state (params.name), or all of it when no name
+// is given, so e.g. config changes apply without waiting for a new container.
+func invalidateAction(params map[string]any) events.LambdaFunctionURLResponse {
+	name, _ := params["name"].(string)
+	if name == "" {
+		warm.Reset()
+		return jsonResp(http.StatusOK, map[string]any{"invalidated": warm.Names()})
+	}
+	if !warm.Invalidate(name) {
+		return jsonResp(http.StatusNotFound, map[string]any{"error": fmt.Sprintf("unknown state %q", name), "names": warm.Names()})
+	}
+	return jsonResp(http.StatusOK, map[string]any{"invalidated": []string{name}})
+}
+
+// metricsAction reports size percentiles recorded by this container, optionally
+// filtered by params.command and params.contract, and the state of its bulkheads.
+func metricsAction(params map[string]any) events.LambdaFunctionURLResponse {
+	command, _ := params["command"].(string)
+	contract, _ := params["contract"].(string)
+	summaries := slices.DeleteFunc(sizeMetrics.Summaries(), func(s metrics.Summary) bool {
+		return (command != "" && s.Command != command) || (contract != "" && s.Contract != contract)
+	})
+	return jsonResp(http.StatusOK, map[string]any{"series": summaries, "bulkheads": bulkheads.Stats()})
+}
+
+// usageAction reports per-caller usage for the UTC days params.from through params.to
+// (YYYY-MM-DD, default the last 30 days), optionally only for params.caller.
+func usageAction(cfgEnv *EnvConfig, params map[string]any) events.LambdaFunctionURLResponse {
+	s := cfgEnv.usage()
+	if !s.Enabled() {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "usage reports are not enabled (set USAGE_DIR)"})
+	}
+	to := time.Now().UTC()
+	if v, _ := params["to"].(string); v != "" {
+		t, err := time.Parse(usage.DayLayout, v)
+		if err != nil {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.to must be a YYYY-MM-DD date"})
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -29)
+	if v, _ := params["from"].(string); v != "" {
+		t, err := time.Parse(usage.DayLayout, v)
+		if err != nil {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.from must be a YYYY-MM-DD date"})
+		}
+		from = t
+	}
+	if from.After(to) {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.from is after params.to"})
+	}
+	caller, _ := params["caller"].(string)
+	reports, err := s.Report(from, to, caller)
+	if err != nil {
+		return jsonResp(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return jsonResp(http.StatusOK, map[string]any{
+		"from":    from.Format(usage.DayLayout),
+		"to":      to.Format(usage.DayLayout),
+		"callers": reports,
+	})
+}
+
+// exportAction runs the Parquet export for the UTC day params.date (YYYY-MM-DD,
+// default yesterday), e.g. to backfill a day the schedule missed.
+func exportAction(ctx context.Context, cfgEnv *EnvConfig, params map[string]any) events.LambdaFunctionURLResponse {
+	day := time.Now().UTC().AddDate(0, 0, -1)
+	if v, _ := params["date"].(string); v != "" {
+		t, err := time.Parse(usage.DayLayout, v)
+		if err != nil {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.date must be a YYYY-MM-DD date"})
+		}
+		day = t
+	}
+	if cfgEnv.ExportBucket == "" {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "export is not enabled (set EXPORT_BUCKET)"})
+	}
+	out, err := export(ctx, cfgEnv, day)
+	if err != nil {
+		return jsonResp(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return jsonResp(http.StatusOK, out)
+}
+
+// maxInviteTTL caps how long an invitation token or signed URL may stay valid.
+const maxInviteTTL = 7 * 24 * time.Hour
+
+// inviteAction manages invitation tokens: params.op is "mint" (default) with
+// params.contract, params.method, params.maxUses (default 1), params.ttlSeconds
+// (default 3600) and an optional params.label, or "revoke" with params.id.
+// The token is returned only once; the table keeps just its hash.
+func inviteAction(ctx context.Context, req events.LambdaFunctionURLRequest, cfgEnv *EnvConfig, params map[string]any) events.LambdaFunctionURLResponse {
+	if cfgEnv.invites == nil {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "invitations are not enabled (set INVITE_TABLE)"})
+	}
+	op, _ := params["op"].(string)
+	switch op {
+	case "", "mint":
+	case "revoke":
+		id, _ := params["id"].(string)
+		if id == "" {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.id is required"})
+		}
+		if err := cfgEnv.invites.Revoke(ctx, id); err != nil {
+			return jsonResp(http.StatusBadGateway, map[string]string{"error": err.Error()})
+		}
+		return jsonResp(http.StatusOK, map[string]string{"id": id, "status": "revoked"})
+	default:
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown op %q", op)})
+	}
+	contract, _ := params["contract"].(string)
+	method, _ := params["method"].(string)
+	if contract == "" || method == "" {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.contract and params.method are required"})
+	}
+	maxUses, ttl := 1, time.Hour
+	if v, ok := params["maxUses"].(float64); ok {
+		if v < 1 || v != float64(int(v)) {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.maxUses must be a positive integer"})
+		}
+		maxUses = int(v)
+	}
+	if v, ok := params["ttlSeconds"].(float64); ok {
+		ttl = time.Duration(v) * time.Second
+		if ttl <= 0 || ttl > maxInviteTTL {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("params.ttlSeconds must be between 1 and %d", int(maxInviteTTL.Seconds()))})
+		}
+	}
+	label, _ := params["label"].(string)
+	token, inv, err := cfgEnv.invites.Mint(ctx, invite.Invitation{
+		Contract:  strings.ToLower(contract),
+		Method:    strings.ToLower(method),
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl).UTC().Truncate(time.Second),
+		Label:     label,
+		CreatedBy: utils.CallerIdentity(req),
+	})
+	if err != nil {
+		return jsonResp(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return jsonResp(http.StatusOK, map[string]any{"token": token, "invitation": inv})
+}
+
+// signURLAction returns a URL that runs the INVOKE_PRESETS entry params.preset without
+// other credentials, at most params.maxUses times (default 1) within params.ttlSeconds
+// (default 3600), with params.method (GET, the default, or POST). Callers append the
+// preset's parameters to the query string. There is no revocation: rotate
+// SIGNED_URL_SECRET to invalidate every outstanding URL.
+func signURLAction(req events.LambdaFunctionURLRequest, cfgEnv *EnvConfig, params map[string]any) events.LambdaFunctionURLResponse {
+	if cfgEnv.signedURLs == nil {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "signed URLs are not enabled (set SIGNED_URL_SECRET and SIGNED_URL_TABLE)"})
+	}
+	preset, _ := params["preset"].(string)
+	if _, ok := cfgEnv.invokePresets[preset]; !ok {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("params.preset must name an INVOKE_PRESETS entry, got %q", preset)})
+	}
+	method := http.MethodGet
+	if v, ok := params["method"].(string); ok {
+		method = strings.ToUpper(v)
+		if method != http.MethodGet && method != http.MethodPost {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.method must be GET or POST"})
+		}
+	}
+	maxUses, ttl := 1, time.Hour
+	if v, ok := params["maxUses"].(float64); ok {
+		if v < 1 || v != float64(int(v)) {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.maxUses must be a positive integer"})
+		}
+		maxUses = int(v)
+	}
+	if v, ok := params["ttlSeconds"].(float64); ok {
+		ttl = time.Duration(v) * time.Second
+		if ttl <= 0 || ttl > maxInviteTTL {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("params.ttlSeconds must be between 1 and %d", int(maxInviteTTL.Seconds()))})
+		}
+	}
+	c := signedurl.Claims{
+		ID:        signedurl.NewID(rng),
+		Method:    method,
+		Path:      "/",
+		Preset:    preset,
+		ExpiresAt: clk.Now().Add(ttl).UTC().Truncate(time.Second),
+		MaxUses:   maxUses,
+	}
+	u := c.Path + "?" + signedurl.Query(cfgEnv.SignedURLSecret, c)
+	if d := req.RequestContext.DomainName; d != "" {
+		u = "https://" + d + u
+	}
+	return jsonResp(http.StatusOK, map[string]any{"url": u, "claims": c})
+}
+
+// allowlistAction manages contracts allowed in addition to ALLOWED_CONTRACTS:
+// params.op is "show" (default), "add-contract" or "remove", with params.contract.
+// Changes are saved to ALLOWLIST_PARAMETER and apply to this container immediately.
+func allowlistAction(ctx context.Context, cfgEnv *EnvConfig, params map[string]any) events.LambdaFunctionURLResponse {
+	if cfgEnv.allowlist == nil {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "runtime allowlist is not enabled (set ALLOWLIST_PARAMETER)"})
+	}
+	op, _ := params["op"].(string)
+	contract, _ := params["contract"].(string)
+	if op != "" && op != "show" && contract == "" {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.contract is required"})
+	}
+	l, err := cfgEnv.allowlist.Load(ctx)
+	if err != nil {
+		return jsonResp(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	changed := false
+	switch op {
+	case "", "show":
+	case "add-contract":
+		changed = l.Add(contract)
+	case "remove":
+		if r, ok := cfgEnv.allowedRules.Match(contract); ok {
+			return jsonResp(http.StatusConflict, map[string]string{"error": fmt.Sprintf("contract %q is allowed by %q in ALLOWED_CONTRACTS and needs a redeploy to remove", contract, r.Source)})
+		}
+		if changed = l.Remove(contract); !changed {
+			return jsonResp(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("contract %q is not in the runtime allowlist", contract)})
+		}
+	default:
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown allowlist op %q", op)})
+	}
+	if changed {
+		if err := cfgEnv.allowlist.Save(ctx, l); err != nil {
+			return jsonResp(http.StatusBadGateway, map[string]string{"error": err.Error()})
+		}
+	}
+	runtimeAllowlist.Set(cfgEnv.allowlist.Name(), l.Contracts)
+	return jsonResp(http.StatusOK, map[string]any{
+		"configured": cfgEnv.AllowedContracts,
+		"runtime":    l.Contracts,
+		"changed":    changed,
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/metrics"
+)
+
+// Bulkheads (BULKHEADS) a run can take its place in.
+const (
+	bulkheadRead  = "read"
+	bulkheadWrite = "write"
+)
+
+// bulkheadClass returns the bulkhead of subcmd: READ_COMMANDS are reads, anything else,
+// such as execute and deploy, writes.
+func bulkheadClass(cfgEnv *EnvConfig, subcmd string) string {
+	if slices.Contains(cfgEnv.ReadCommands, subcmd) {
+		return bulkheadRead
+	}
+	return bulkheadWrite
+}
+
+// bulkheadRejected is the 503 for a run whose bulkhead had no room, or whose wait for a
+// slot ended first.
+func bulkheadRejected(cfgEnv *EnvConfig, class string, err error) events.LambdaFunctionURLResponse {
+	countBulkheadRejected(cfgEnv, class)
+	body := codedError(i18n.BulkheadFull, fmt.Sprintf("%s bulkhead: %v", class, err), map[string]string{"bulkhead": class})
+	body["bulkhead"] = class
+	resp := jsonResp(http.StatusServiceUnavailable, body)
+	resp.Headers["Retry-After"] = "1"
+	return resp
+}
+
+// bulkheadFailure is the result of a job that could not get a slot in its bulkhead.
+func bulkheadFailure(cfgEnv *EnvConfig, class string, err error) Response {
+	countBulkheadRejected(cfgEnv, class)
+	return Response{ExitCode: 1, Stderr: fmt.Sprintf("%s bulkhead: %v", class, err), Meta: map[string]string{"bulkhead": class}}
+}
+
+func countBulkheadRejected(cfgEnv *EnvConfig, class string) {
+	if cfgEnv.MetricsNamespace != "" {
+		_ = metrics.WriteCountWith(metricsOut, cfgEnv.MetricsNamespace, metrics.BulkheadRejected, map[string]string{"Bulkhead": class}, time.Now())
+	}
+}
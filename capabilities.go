@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/rollup"
+)
+
+// capabilities is the GET /capabilities document: the limits every request is checked
+// against, for clients to reject a request before sending it.
+type capabilities struct {
+	// Commands are the allowed leo subcommands, lower-cased; empty allows any.
+	Commands []string `json:"commands"`
+	// Contracts are the ALLOWED_CONTRACTS entries, patterns included, and the contracts
+	// added at runtime; empty allows any.
+	Contracts []string `json:"contracts"`
+	// MaxFee is MAX_FEE, the largest --priority-fee in microcredits; 0 is no cap.
+	MaxFee uint64 `json:"maxFee,omitempty"`
+	// Transforms reports that TRANSFORM_RULES may rewrite or reject requests before
+	// they are checked, so a request cannot be judged from the rest of the document.
+	Transforms bool `json:"transforms,omitempty"`
+	// Stats are each contract's totals over the last 7 days, with ROLLUP_TABLE.
+	Stats map[string]rollup.Totals `json:"stats,omitempty"`
+}
+
+// capabilitiesResp answers GET /capabilities. A runtime allowlist that cannot be read
+// is a 503, as it would be for an execute; stats that cannot be read are left out.
+func capabilitiesResp(ctx context.Context, cfgEnv *EnvConfig) events.LambdaFunctionURLResponse {
+	c := capabilities{Commands: []string{}, Contracts: []string{}, MaxFee: cfgEnv.MaxFee, Transforms: len(cfgEnv.transformRules) > 0}
+	for _, s := range cfgEnv.AllowedCommands {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" && !slices.Contains(c.Commands, s) {
+			c.Commands = append(c.Commands, s)
+		}
+	}
+	for _, r := range cfgEnv.allowedRules {
+		c.Contracts = append(c.Contracts, r.Source)
+	}
+	if cfgEnv.allowlist != nil {
+		extra, _, err := revalidate(cfgEnv, runtimeAllowlist, cfgEnv.allowlist.Name(), func() ([]string, error) {
+			l, err := cfgEnv.allowlist.Load(ctx)
+			return l.Contracts, err
+		})
+		if err != nil {
+			return jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, err.Error(), nil))
+		}
+		c.Contracts = append(c.Contracts, extra...)
+	}
+	if cfgEnv.rollups != nil {
+		// Stats are informational; the limits are still worth answering without them.
+		if days, err := contractStats(ctx, cfgEnv); err != nil {
+			logWarn("contract stats unavailable", map[string]string{"error": err.Error()})
+		} else {
+			c.Stats = rollup.ByContract(days)
+		}
+	}
+	return jsonResp(http.StatusOK, c)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/chainvars"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+)
+
+// chainVarTimeout bounds reading the chain state a preset's variables refer to.
+const chainVarTimeout = 5 * time.Second
+
+// chainSource reads chain state from an endpoint's REST API.
+type chainSource struct {
+	endpoint, network string
+}
+
+func (s chainSource) Height(ctx context.Context) (uint64, error) {
+	return network.LatestHeight(ctx, nil, s.endpoint, s.network)
+}
+
+func (s chainSource) Mapping(ctx context.Context, program, mapping, key string) (string, bool, error) {
+	return network.MappingValue(ctx, nil, s.endpoint, s.network, program, mapping, key)
+}
+
+// resolveChainVars fills the {{height}} and {{mapping:...}} variables of a preset's
+// args from the endpoint and network the run uses. stale reports whether a cached value
+// stood in for one that could not be read. A failed read is a 503, as for an endpoint
+// whose circuit is open; a mapping key that is not set and has no default is a 422.
+func resolveChainVars(ctx context.Context, cfgEnv *EnvConfig, args []string, endpoint, net string) ([]string, bool, *events.LambdaFunctionURLResponse) {
+	if net == "" {
+		resp := jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, "chain variables need --network", nil))
+		return nil, false, &resp
+	}
+	ctx, cancel := context.WithTimeout(ctx, chainVarTimeout)
+	defer cancel()
+	out, stale, err := chainVars.Resolve(ctx, chainSource{endpoint, net}, endpoint+" "+net, args)
+	switch {
+	case err == nil:
+		return out, stale, nil
+	case errors.Is(err, chainvars.ErrUnavailable):
+		logWarn("chain variable unavailable", map[string]string{"endpoint": endpoint, "error": err.Error()})
+		resp := jsonResp(http.StatusServiceUnavailable, codedError(i18n.EndpointUnavailable, err.Error(), nil))
+		resp.Headers["Retry-After"] = "1"
+		return nil, false, &resp
+	case errors.Is(err, chainvars.ErrNotFound):
+		resp := jsonResp(http.StatusUnprocessableEntity, codedError(i18n.ChainValueUnset, err.Error(), nil))
+		return nil, false, &resp
+	}
+	resp := jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, err.Error(), nil))
+	return nil, false, &resp
+}
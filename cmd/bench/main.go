@@ -0,0 +1,165 @@
+// Command bench runs the repository's Go benchmarks, records the results as JSON and,
+// given a baseline, fails when any benchmark regressed beyond a threshold.
+//
+//	go run ./cmd/bench -out bench.json
+//	go run ./cmd/bench -baseline bench.json -threshold 0.15
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Result holds the metrics reported for one benchmark.
+type Result struct {
+	NsPerOp     float64 `json:"nsPerOp"`
+	MBPerSec    float64 `json:"mbPerSec,omitempty"`
+	BytesPerOp  float64 `json:"bytesPerOp,omitempty"`
+	AllocsPerOp float64 `json:"allocsPerOp,omitempty"`
+}
+
+// Regression describes a metric that got worse than allowed.
+type Regression struct {
+	Name     string  `json:"name"`
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+}
+
+func main() {
+	pkgs := flag.String("pkg", "./...", "packages to benchmark")
+	bench := flag.String("bench", ".", "benchmark regexp passed to go test -bench")
+	benchtime := flag.String("benchtime", "", "go test -benchtime value")
+	count := flag.Int("count", 1, "go test -count value; results are averaged")
+	out := flag.String("out", "", "write results as JSON to this file (default stdout)")
+	baseline := flag.String("baseline", "", "compare against a previous -out file")
+	threshold := flag.Float64("threshold", 0.2, "allowed relative slowdown before a benchmark counts as regressed")
+	flag.Parse()
+
+	args := []string{"test", "-run", "^$", "-bench", *bench, "-benchmem", "-count", strconv.Itoa(*count)}
+	if *benchtime != "" {
+		args = append(args, "-benchtime", *benchtime)
+	}
+	args = append(args, strings.Fields(*pkgs)...)
+	var buf bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stdout = io.MultiWriter(&buf, os.Stderr)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "go test failed: %v\n", err)
+		os.Exit(2)
+	}
+
+	results := parse(&buf)
+	b, _ := json.MarshalIndent(results, "", "  ")
+	if *out == "" {
+		fmt.Println(string(b))
+	} else if err := os.WriteFile(*out, append(b, '\n'), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "write results: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *baseline == "" {
+		return
+	}
+	raw, err := os.ReadFile(*baseline)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read baseline: %v\n", err)
+		os.Exit(2)
+	}
+	var base map[string]Result
+	if err := json.Unmarshal(raw, &base); err != nil {
+		fmt.Fprintf(os.Stderr, "decode baseline: %v\n", err)
+		os.Exit(2)
+	}
+	regs := compare(base, results, *threshold)
+	for _, r := range regs {
+		fmt.Fprintf(os.Stderr, "REGRESSION %s %s: %.0f -> %.0f (%+.1f%%)\n", r.Name, r.Metric, r.Baseline, r.Current, (r.Current/r.Baseline-1)*100)
+	}
+	if len(regs) > 0 {
+		os.Exit(1)
+	}
+}
+
+var benchLine = regexp.MustCompile(`^(Benchmark\S+?)(?:-\d+)?\s+\d+\s+(.*)$`)
+
+// parse reads `go test -bench` output, keying results by "<package>.<benchmark>" and
+// averaging repeated runs.
+func parse(r io.Reader) map[string]Result {
+	sums := map[string]Result{}
+	counts := map[string]int{}
+	pkg := ""
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = strings.TrimSpace(p)
+			continue
+		}
+		m := benchLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		name := m[1]
+		if pkg != "" {
+			name = pkg + "." + name
+		}
+		fields := strings.Fields(m[2])
+		res := sums[name]
+		for i := 0; i+1 < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				res.NsPerOp += v
+			case "MB/s":
+				res.MBPerSec += v
+			case "B/op":
+				res.BytesPerOp += v
+			case "allocs/op":
+				res.AllocsPerOp += v
+			}
+		}
+		sums[name] = res
+		counts[name]++
+	}
+	for name, res := range sums {
+		n := float64(counts[name])
+		sums[name] = Result{NsPerOp: res.NsPerOp / n, MBPerSec: res.MBPerSec / n, BytesPerOp: res.BytesPerOp / n, AllocsPerOp: res.AllocsPerOp / n}
+	}
+	return sums
+}
+
+// compare reports benchmarks present in both sets whose time, memory or allocations
+// grew by more than threshold.
+func compare(base, cur map[string]Result, threshold float64) []Regression {
+	var regs []Regression
+	for name, c := range cur {
+		b, ok := base[name]
+		if !ok {
+			continue
+		}
+		check := func(metric string, was, now float64) {
+			if was > 0 && now > was*(1+threshold) {
+				regs = append(regs, Regression{Name: name, Metric: metric, Baseline: was, Current: now})
+			}
+		}
+		check("ns/op", b.NsPerOp, c.NsPerOp)
+		check("B/op", b.BytesPerOp, c.BytesPerOp)
+		check("allocs/op", b.AllocsPerOp, c.AllocsPerOp)
+	}
+	slices.SortFunc(regs, func(a, b Regression) int { return strings.Compare(a.Name+a.Metric, b.Name+b.Metric) })
+	return regs
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const sample = `goos: linux
+pkg: github.com/debendraoli/leo-lambda/pkg/executor
+BenchmarkLimitedBufferWrite/limit=65536-8   	      20	    172908 ns/op	1516.09 MB/s	  606208 B/op	       8 allocs/op
+BenchmarkLimitedBufferWrite/limit=65536-8   	      20	    180000 ns/op	1500.00 MB/s	  606208 B/op	       8 allocs/op
+BenchmarkRunEcho                            	      20	    486548 ns/op	   81541 B/op	     112 allocs/op
+PASS
+`
+
+func TestParse(t *testing.T) {
+	res := parse(strings.NewReader(sample))
+	buf, ok := res["github.com/debendraoli/leo-lambda/pkg/executor.BenchmarkLimitedBufferWrite/limit=65536"]
+	if !ok {
+		t.Fatalf("missing buffer benchmark: %+v", res)
+	}
+	if buf.NsPerOp != 176454 || buf.AllocsPerOp != 8 {
+		t.Fatalf("expected averaged metrics, got %+v", buf)
+	}
+	if echo := res["github.com/debendraoli/leo-lambda/pkg/executor.BenchmarkRunEcho"]; echo.BytesPerOp != 81541 {
+		t.Fatalf("unexpected echo metrics: %+v", echo)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	base := map[string]Result{"a": {NsPerOp: 100, BytesPerOp: 10}, "b": {NsPerOp: 100}}
+	cur := map[string]Result{"a": {NsPerOp: 115, BytesPerOp: 20}, "b": {NsPerOp: 130}, "c": {NsPerOp: 1}}
+	regs := compare(base, cur, 0.2)
+	if len(regs) != 2 || regs[0].Name != "a" || regs[0].Metric != "B/op" || regs[1].Name != "b" {
+		t.Fatalf("unexpected regressions: %+v", regs)
+	}
+}
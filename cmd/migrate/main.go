@@ -0,0 +1,90 @@
+// Command migrate brings the DynamoDB tables of a leo-lambda deployment to the schema
+// of this version. Tables are taken from the same environment variables the function
+// reads (STORE, INVITE_TABLE, SIGNED_URL_TABLE, CONTRACT_QUOTA_TABLE, ROLLUP_TABLE), or
+// from -table flags, and AWS credentials from the usual AWS_* variables.
+//
+//	go run ./cmd/migrate -dry-run
+//	go run ./cmd/migrate -table invites=leo-invites -table store=leo-store
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/migrate"
+)
+
+// tableFlags collects repeated -table kind=name flags.
+type tableFlags []migrate.Target
+
+func (f *tableFlags) String() string { return fmt.Sprint(*f) }
+
+func (f *tableFlags) Set(v string) error {
+	t, err := parseTarget(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, t)
+	return nil
+}
+
+func main() {
+	var tables tableFlags
+	flag.Var(&tables, "table", "kind=name of a table to migrate (repeatable; default: from the environment)")
+	dryRun := flag.Bool("dry-run", false, "only list the migrations that would run")
+	timeout := flag.Duration("timeout", 30*time.Minute, "give up after this long")
+	flag.Parse()
+
+	if len(tables) == 0 {
+		tables = migrate.Targets(os.Getenv)
+	}
+	if len(tables) == 0 {
+		fmt.Fprintln(os.Stderr, "no DynamoDB tables configured; set -table or the function's table variables")
+		os.Exit(2)
+	}
+	client, err := awsapi.NewFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aws: %v\n", err)
+		os.Exit(2)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	db := migrate.NewDB(client)
+	var results []migrate.Result
+	failed := false
+	for _, t := range tables {
+		res, err := migrate.Run(ctx, db, t.Kind, t.Table, *dryRun)
+		results = append(results, res)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", t.Table, err)
+			failed = true
+		}
+	}
+	b, _ := json.MarshalIndent(results, "", "  ")
+	fmt.Println(string(b))
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseTarget reads a kind=name -table value.
+func parseTarget(v string) (migrate.Target, error) {
+	kind, table, ok := strings.Cut(v, "=")
+	kind, table = strings.TrimSpace(kind), strings.TrimSpace(table)
+	if !ok || table == "" {
+		return migrate.Target{}, fmt.Errorf("want kind=name, got %q", v)
+	}
+	if _, ok := migrate.Schemas[kind]; !ok {
+		kinds := slices.Sorted(maps.Keys(migrate.Schemas))
+		return migrate.Target{}, fmt.Errorf("unknown table kind %q (want one of %s)", kind, strings.Join(kinds, ", "))
+	}
+	return migrate.Target{Kind: kind, Table: table}, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/debendraoli/leo-lambda/pkg/migrate"
+)
+
+func TestParseTarget(t *testing.T) {
+	got, err := parseTarget("invites=leo-invites")
+	if err != nil || got != (migrate.Target{Kind: migrate.Invites, Table: "leo-invites"}) {
+		t.Fatalf("got %+v (%v)", got, err)
+	}
+	for _, v := range []string{"leo-invites", "invites=", "jobs=leo-jobs"} {
+		if _, err := parseTarget(v); err == nil {
+			t.Errorf("expected %q to be rejected", v)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/contractquota"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/metrics"
+)
+
+// takeContractQuota counts one execute of contract against its CONTRACT_DAILY_LIMITS
+// entry. Counts go to CONTRACT_QUOTA_TABLE when set; should the table fail, the
+// container's own counter decides, as shared per-caller quotas do without Redis. The
+// returned release uncounts the execute in the counter that took it, for a run refused
+// before it starts.
+func takeContractQuota(ctx context.Context, cfgEnv *EnvConfig, contract string, limit int) (int, func(), error) {
+	day := contractquota.Day(clk.Now())
+	if cfgEnv.contractCounter != nil {
+		n, err := cfgEnv.contractCounter.Take(ctx, contract, day, limit)
+		if err == nil || errors.Is(err, contractquota.ErrExhausted) {
+			return n, contractRelease(ctx, cfgEnv.contractCounter, contract, day), err
+		}
+		logWarn("contract quota table unavailable, using local counters", map[string]string{"error": err.Error()})
+		if cfgEnv.MetricsNamespace != "" {
+			_ = metrics.WriteCount(metricsOut, cfgEnv.MetricsNamespace, metrics.QuotaFallback, time.Now())
+		}
+	}
+	n, err := contractCounts.Take(ctx, contract, day, limit)
+	return n, contractRelease(ctx, contractCounts, contract, day), err
+}
+
+// contractRelease returns a function releasing one execute of contract on day in c.
+// A failed release is logged; the execute then stays counted.
+func contractRelease(ctx context.Context, c contractquota.Counter, contract, day string) func() {
+	return func() {
+		if err := c.Release(context.WithoutCancel(ctx), contract, day); err != nil {
+			logWarn("contract quota release failed", map[string]string{"contract": contract, "error": err.Error()})
+		}
+	}
+}
+
+// contractQuotaExceeded is the 429 for an execute of contract once its daily quota is
+// used up. resetAt and Retry-After tell clients when the next UTC day starts.
+func contractQuotaExceeded(contract string, limit int, now time.Time) events.LambdaFunctionURLResponse {
+	resetAt := contractquota.ResetAt(now)
+	stamp := resetAt.Format(time.RFC3339)
+	body := codedError(i18n.ContractQuota, fmt.Sprintf("daily invocation quota of contract %q exhausted until %s", contract, stamp),
+		map[string]string{"contract": contract, "resetAt": stamp})
+	body["limit"] = limit
+	body["resetAt"] = stamp
+	resp := jsonResp(http.StatusTooManyRequests, body)
+	resp.Headers["Retry-After"] = strconv.Itoa(int(math.Ceil(resetAt.Sub(now).Seconds())))
+	return resp
+}
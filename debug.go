@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// debugHeader asks for an executor debug bundle. It is honored only with
+// DEBUG_EXECUTOR=true and only for ADMIN_PRINCIPALS.
+const debugHeader = "X-Leo-Debug"
+
+// Limits of a debug bundle: workdir listings stop at debugMaxFiles entries, and output
+// returned inline, without OUTPUT_BUCKET, keeps the last debugInlineBytes of each stream.
+const (
+	debugMaxFiles    = 1000
+	debugInlineBytes = 1 << 20
+)
+
+// sensitiveEnv marks environment variables whose values a debug bundle hides: any name
+// containing one of these.
+var sensitiveEnv = []string{"KEY", "SECRET", "TOKEN", "PASSWORD", "CREDENTIAL", "SESSION", "WEBHOOK", "HMAC", "FEE_PAYERS", "REDIS_URL", "SEALED_CONFIG"}
+
+// debugBundle records how leo was run, for failures that only reproduce in Lambda.
+type debugBundle struct {
+	// Env is the environment leo inherits, with sensitive values replaced by "***".
+	Env map[string]string `json:"env"`
+	// Argv is the command line, with secret flag values redacted.
+	Argv          []string    `json:"argv"`
+	WorkDir       string      `json:"workdir"`
+	WorkDirBefore []debugFile `json:"workdirBefore"`
+	WorkDirAfter  []debugFile `json:"workdirAfter"`
+	// Processes has the resource usage of every leo process, retries and hedged
+	// attempts included.
+	Processes []debugProcess `json:"processes"`
+	// Stdout and Stderr are the complete output, before MAX_OUTPUT_BYTES.
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	OutputTruncated bool   `json:"outputTruncated,omitempty"`
+
+	mu     sync.Mutex
+	output fullOutput
+}
+
+// debugFile is one workdir entry; Path is relative to the workdir.
+type debugFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// debugProcess is the rusage of one leo process.
+type debugProcess struct {
+	PID           int     `json:"pid"`
+	ExitCode      int     `json:"exitCode"`
+	UserSeconds   float64 `json:"userSeconds"`
+	SystemSeconds float64 `json:"systemSeconds"`
+	MaxRSSKB      int64   `json:"maxRssKb"`
+	MinorFaults   int64   `json:"minorFaults"`
+	MajorFaults   int64   `json:"majorFaults"`
+	BlocksIn      int64   `json:"blocksIn"`
+	BlocksOut     int64   `json:"blocksOut"`
+	VolCtxSwitch  int64   `json:"voluntaryContextSwitches"`
+	InvCtxSwitch  int64   `json:"involuntaryContextSwitches"`
+}
+
+// wantsDebug reports whether req asks for a debug bundle and may have one.
+func wantsDebug(req events.LambdaFunctionURLRequest, cfgEnv *EnvConfig) bool {
+	return cfgEnv.DebugExecutor && utils.HeaderValue(req.Headers, debugHeader) != "" && isAdmin(req, cfgEnv)
+}
+
+// newDebugBundle starts a bundle for running bin with args in workdir, listing the
+// workdir as it is before the run.
+func newDebugBundle(bin string, args []string, workdir string) *debugBundle {
+	return &debugBundle{
+		Env:           sanitizeEnv(os.Environ()),
+		Argv:          append([]string{bin}, utils.RedactFlagValues(args, utils.SecretFlags...)...),
+		WorkDir:       workdir,
+		WorkDirBefore: listWorkdir(workdir),
+		Processes:     []debugProcess{},
+	}
+}
+
+// exited records the resource usage of one leo process; it is an executor OnExit hook.
+func (d *debugBundle) exited(ps *os.ProcessState) {
+	p := debugProcess{
+		PID:           ps.Pid(),
+		ExitCode:      ps.ExitCode(),
+		UserSeconds:   ps.UserTime().Seconds(),
+		SystemSeconds: ps.SystemTime().Seconds(),
+	}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		p.MaxRSSKB, p.MinorFaults, p.MajorFaults = int64(ru.Maxrss), int64(ru.Minflt), int64(ru.Majflt)
+		p.BlocksIn, p.BlocksOut = int64(ru.Inblock), int64(ru.Oublock)
+		p.VolCtxSwitch, p.InvCtxSwitch = int64(ru.Nvcsw), int64(ru.Nivcsw)
+	}
+	d.mu.Lock()
+	d.Processes = append(d.Processes, p)
+	d.mu.Unlock()
+}
+
+// finish lists the workdir after the run and delivers the bundle: uploaded next to the
+// full output under prefix when OUTPUT_BUCKET is set, otherwise returned in payload.
+func (d *debugBundle) finish(ctx context.Context, cfgEnv *EnvConfig, prefix string, payload *Response) {
+	d.WorkDirAfter = listWorkdir(d.WorkDir)
+	d.Stdout, d.Stderr = string(d.output.stdout.b), string(d.output.stderr.b)
+	d.OutputTruncated = d.output.stdout.truncated || d.output.stderr.truncated
+	if cfgEnv.OutputBucket != "" {
+		b, err := json.Marshal(d)
+		if err == nil {
+			key := prefix + "/debug.json"
+			if err = cfgEnv.s3.PutObject(ctx, cfgEnv.OutputBucket, key, b, "application/json"); err == nil {
+				payload.Meta["debugObject"] = "s3://" + cfgEnv.OutputBucket + "/" + key
+				return
+			}
+		}
+		payload.Meta["debugError"] = fmt.Sprintf("upload debug bundle: %v", err)
+	}
+	var cut bool
+	if d.Stdout, cut = tailBytes(d.Stdout, debugInlineBytes); cut {
+		d.OutputTruncated = true
+	}
+	if d.Stderr, cut = tailBytes(d.Stderr, debugInlineBytes); cut {
+		d.OutputTruncated = true
+	}
+	payload.Debug = d
+}
+
+// sanitizeEnv turns environ into a map, hiding the values of sensitiveEnv variables and
+// any value holding an Aleo private key.
+func sanitizeEnv(environ []string) map[string]string {
+	out := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		name := strings.ToUpper(k)
+		if strings.Contains(v, "APrivateKey1") || slices.ContainsFunc(sensitiveEnv, func(s string) bool { return strings.Contains(name, s) }) {
+			v = "***"
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// listWorkdir lists up to debugMaxFiles entries under dir; a missing dir lists nothing.
+func listWorkdir(dir string) []debugFile {
+	files := []debugFile{}
+	if dir == "" {
+		return files
+	}
+	_ = filepath.WalkDir(dir, func(path string, e fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return nil
+		}
+		if len(files) >= debugMaxFiles {
+			return filepath.SkipAll
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, debugFile{Path: rel, Size: info.Size(), Mode: info.Mode().String(), ModTime: info.ModTime().UTC()})
+		return nil
+	})
+	return files
+}
+
+// tailBytes returns the last n bytes of s, starting on a rune boundary, and whether
+// anything was cut.
+func tailBytes(s string, n int) (string, bool) {
+	if len(s) <= n {
+		return s, false
+	}
+	i := len(s) - n
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return s[i:], true
+}
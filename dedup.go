@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+)
+
+// DEDUP_MODE values.
+const (
+	dedupWarn  = "warn"
+	dedupBlock = "block"
+)
+
+// broadcastRecord is a successful execute broadcast, remembered for DEDUP_WINDOW.
+type broadcastRecord struct {
+	TransactionID string    `json:"transactionId"`
+	At            time.Time `json:"at"`
+}
+
+// recentBroadcast returns the broadcast of an execute with fingerprint sum made within
+// DEDUP_WINDOW, by this container or, through STORE, any other.
+func recentBroadcast(ctx context.Context, cfgEnv *EnvConfig, sum string) (broadcastRecord, bool) {
+	if cfgEnv.DedupWindow <= 0 {
+		return broadcastRecord{}, false
+	}
+	rec, ok := broadcasts.Get(sum)
+	if !ok && cfgEnv.store != nil {
+		ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+		defer cancel()
+		if b, err := cfgEnv.store.Get(ctx, "broadcasts/"+sum); err == nil && json.Unmarshal(b, &rec) == nil {
+			ok = true
+		}
+	}
+	return rec, ok && clk.Now().Sub(rec.At) < cfgEnv.DedupWindow
+}
+
+// recordBroadcast remembers that the execute with fingerprint sum broadcast txID.
+func recordBroadcast(ctx context.Context, cfgEnv *EnvConfig, sum, txID string) {
+	if cfgEnv.DedupWindow <= 0 || sum == "" {
+		return
+	}
+	rec := broadcastRecord{TransactionID: txID, At: clk.Now().UTC()}
+	broadcasts.Set(sum, rec)
+	if cfgEnv.store == nil {
+		return
+	}
+	b, _ := json.Marshal(rec)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+	if err := cfgEnv.store.Put(ctx, "broadcasts/"+sum, b, cfgEnv.DedupWindow); err != nil {
+		logWarn("store write failed", map[string]string{"key": "broadcasts/" + sum, "error": err.Error()})
+	}
+}
+
+// duplicateBroadcast is the 409 returned in block mode.
+func duplicateBroadcast(rec broadcastRecord) events.LambdaFunctionURLResponse {
+	body := codedError(i18n.DuplicateExecute, "an identical execute was broadcast "+clk.Now().Sub(rec.At).Round(time.Second).String()+" ago",
+		map[string]string{"transactionId": rec.TransactionID})
+	body["transactionId"] = rec.TransactionID
+	body["broadcastAt"] = rec.At.Format(time.RFC3339)
+	return jsonResp(http.StatusConflict, body)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	env "github.com/caarlos0/env/v11"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/journal"
+	"github.com/debendraoli/leo-lambda/pkg/migrate"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+	"github.com/debendraoli/leo-lambda/pkg/sealed"
+	"github.com/debendraoli/leo-lambda/pkg/selftest"
+	"github.com/debendraoli/leo-lambda/pkg/store"
+)
+
+var (
+	// containerStart is when this container was cold-started.
+	containerStart = time.Now()
+	// invocations counts handler calls since containerStart.
+	invocations atomic.Int64
+)
+
+// containerDiagnostics describes the warm container serving a request, for DEBUG_META.
+// It is taken when the request arrives, so remaining time reflects the full budget.
+func containerDiagnostics(ctx context.Context, count int64) map[string]string {
+	d := map[string]string{
+		"container":            journal.Container(),
+		"containerStartedAt":   containerStart.UTC().Format(time.RFC3339),
+		"containerInvocations": strconv.FormatInt(count, 10),
+	}
+	if lambdacontext.MemoryLimitInMB > 0 {
+		d["memoryLimitMB"] = strconv.Itoa(lambdacontext.MemoryLimitInMB)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		d["remainingMsAtStart"] = strconv.FormatInt(time.Until(deadline).Milliseconds(), 10)
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(os.TempDir(), &fs); err == nil {
+		d["tmpFreeBytes"] = strconv.FormatUint(uint64(fs.Bavail)*uint64(fs.Bsize), 10)
+	}
+	return d
+}
+
+// Thresholds of the diagnose checks.
+const (
+	// diagLowDisk and diagNoDisk are the free bytes below which a scratch directory
+	// warns and fails; leo builds and proving keys take hundreds of MB.
+	diagLowDisk = 512 << 20
+	diagNoDisk  = 64 << 20
+	// diagMinMemoryMB is the function memory below which proving most programs is slow
+	// or runs out of memory.
+	diagMinMemoryMB = 4096
+	// diagSlowEndpoint is the latency above which an endpoint warns.
+	diagSlowEndpoint = 2 * time.Second
+)
+
+// diagnoseAction runs the image self-test plus checks of the running function: free
+// disk, memory, endpoint latency, access to secrets and to the DynamoDB tables and
+// STORE, and configured keys left unused. Every check is pass, warn, fail or skip, and
+// those that do not pass carry a remedy. The report is returned with 200 whatever it
+// finds.
+func diagnoseAction(ctx context.Context, cfgEnv *EnvConfig) events.LambdaFunctionURLResponse {
+	o := selftestOptions(cfgEnv, "diagnose")
+	o.Extra = []selftest.Step{
+		{Name: "disk", Run: func(context.Context) (string, string, string) { return diagDisk(cfgEnv) }},
+		{Name: "memory", Run: func(context.Context) (string, string, string) { return diagMemory() }},
+		{Name: "endpoint_latency", Run: func(ctx context.Context) (string, string, string) { return diagEndpoints(ctx, cfgEnv) }},
+		{Name: "secrets", Run: func(ctx context.Context) (string, string, string) { return diagSecrets(ctx, cfgEnv) }},
+		{Name: "dynamodb", Run: diagTables},
+		{Name: "store", Run: func(ctx context.Context) (string, string, string) { return diagStore(ctx, cfgEnv) }},
+		{Name: "keys", Run: func(context.Context) (string, string, string) { return diagKeys(cfgEnv) }},
+	}
+	return jsonResp(http.StatusOK, selftest.Run(ctx, o))
+}
+
+// diagDisk checks the free space of the temp directory and of WORKDIR_ROOT.
+func diagDisk(cfgEnv *EnvConfig) (string, string, string) {
+	status, details := selftest.StatusPass, []string{}
+	for _, dir := range slices.Compact([]string{os.TempDir(), cfgEnv.WorkdirRoot}) {
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(dir, &fs); err != nil {
+			return selftest.StatusFail, err.Error(), "check that WORKDIR_ROOT exists and is mounted"
+		}
+		free := uint64(fs.Bavail) * uint64(fs.Bsize)
+		details = append(details, fmt.Sprintf("%s: %d MB free", dir, free>>20))
+		switch {
+		case free < diagNoDisk:
+			status = selftest.StatusFail
+		case free < diagLowDisk && status == selftest.StatusPass:
+			status = selftest.StatusWarn
+		}
+	}
+	return status, strings.Join(details, ", "), "raise the function's ephemeral storage, or set JOB_RETENTION_DAYS and purge old outputs on EFS"
+}
+
+// diagMemory checks the function's memory size and how much of it is available.
+func diagMemory() (string, string, string) {
+	limit := lambdacontext.MemoryLimitInMB
+	if limit == 0 {
+		return selftest.StatusSkip, "not running on Lambda", ""
+	}
+	detail := fmt.Sprintf("%d MB configured", limit)
+	if avail, ok := memAvailableMB(); ok {
+		detail += fmt.Sprintf(", %d MB available", avail)
+		if avail < limit/4 {
+			return selftest.StatusWarn, detail, "another run may be holding memory; lower MAX_CONCURRENT_EXECUTIONS or raise the function's memory"
+		}
+	}
+	if limit < diagMinMemoryMB {
+		return selftest.StatusWarn, detail, fmt.Sprintf("raise the function's memory to at least %d MB; it also buys CPU for proving", diagMinMemoryMB)
+	}
+	return selftest.StatusPass, detail, ""
+}
+
+// memAvailableMB reads MemAvailable from /proc/meminfo.
+func memAvailableMB() (int, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "MemAvailable:"); ok {
+			kb, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "kB")))
+			return kb >> 10, err == nil
+		}
+	}
+	return 0, false
+}
+
+// diagEndpoints times a latest-height query against each network's endpoint, as the
+// status page does.
+func diagEndpoints(ctx context.Context, cfgEnv *EnvConfig) (string, string, string) {
+	targets := map[string]string{}
+	for name, p := range cfgEnv.networks {
+		targets[name] = p.Endpoint
+	}
+	if len(targets) == 0 {
+		targets["mainnet"] = cfgEnv.EndPoint
+	}
+	status, details := selftest.StatusPass, []string{}
+	for _, name := range slices.Sorted(maps.Keys(targets)) {
+		start := time.Now()
+		height, err := network.LatestHeight(ctx, nil, targets[name], name)
+		took := time.Since(start)
+		switch {
+		case err != nil:
+			status = selftest.StatusFail
+			details = append(details, fmt.Sprintf("%s: %v", name, err))
+		case took > diagSlowEndpoint && status == selftest.StatusPass:
+			status = selftest.StatusWarn
+			fallthrough
+		default:
+			details = append(details, fmt.Sprintf("%s: height %d in %d ms", name, height, took.Milliseconds()))
+		}
+	}
+	return status, strings.Join(details, ", "), "check ENDPOINT and NETWORKS, the node's health, and the function's outbound access; HEDGE_ENDPOINTS can mask a slow node"
+}
+
+// diagSecrets decrypts SEALED_CONFIG afresh and reads ALLOWLIST_PARAMETER.
+func diagSecrets(ctx context.Context, cfgEnv *EnvConfig) (string, string, string) {
+	if os.Getenv(sealed.Var) == "" && cfgEnv.allowlist == nil {
+		return selftest.StatusSkip, "neither SEALED_CONFIG nor ALLOWLIST_PARAMETER is set", ""
+	}
+	details := []string{}
+	if os.Getenv(sealed.Var) != "" {
+		vars, err := openSealedConfig()
+		if err != nil {
+			return selftest.StatusFail, err.Error(), "grant the function kms:Decrypt on the key SEALED_CONFIG was encrypted with"
+		}
+		details = append(details, fmt.Sprintf("SEALED_CONFIG: %d variables", len(vars)))
+	}
+	if cfgEnv.allowlist != nil {
+		l, err := cfgEnv.allowlist.Load(ctx)
+		if err != nil {
+			return selftest.StatusFail, err.Error(), "grant the function ssm:GetParameter on ALLOWLIST_PARAMETER, and kms:Decrypt if it is a SecureString"
+		}
+		details = append(details, fmt.Sprintf("ALLOWLIST_PARAMETER: %d contracts", len(l.Contracts)))
+	}
+	return selftest.StatusPass, strings.Join(details, ", "), ""
+}
+
+// diagTables reads a missing item from each DynamoDB table the configuration names
+// other than STORE's, which diagStore covers.
+func diagTables(ctx context.Context) (string, string, string) {
+	environ, err := configEnviron()
+	if err != nil {
+		return selftest.StatusFail, err.Error(), "fix the configuration error first"
+	}
+	vars := env.ToMap(environ)
+	targets := slices.DeleteFunc(migrate.Targets(func(k string) string { return vars[k] }), func(t migrate.Target) bool { return t.Kind == migrate.Store })
+	if len(targets) == 0 {
+		return selftest.StatusSkip, "no tables configured", ""
+	}
+	client, err := awsapi.NewFromEnv()
+	if err != nil {
+		return selftest.StatusFail, err.Error(), "check the function's execution role"
+	}
+	details := []string{}
+	for _, t := range targets {
+		in := map[string]any{"TableName": t.Table, "Key": map[string]map[string]string{"id": {"S": "diagnose"}}}
+		if err := client.JSON(ctx, "dynamodb", "DynamoDB_20120810.GetItem", in, nil); err != nil {
+			remedy := "grant the function dynamodb:GetItem, PutItem, UpdateItem and DeleteItem on the table"
+			var apiErr *awsapi.APIError
+			if errors.As(err, &apiErr) && apiErr.Code == "ResourceNotFoundException" {
+				remedy = "create the table with the migrate action or MIGRATE_ON_START"
+			}
+			return selftest.StatusFail, fmt.Sprintf("%s %s: %v", t.Kind, t.Table, err), remedy
+		}
+		details = append(details, t.Kind+" "+t.Table)
+	}
+	return selftest.StatusPass, strings.Join(details, ", "), ""
+}
+
+// diagStore reads a missing key from STORE, whatever its backend.
+func diagStore(ctx context.Context, cfgEnv *EnvConfig) (string, string, string) {
+	if cfgEnv.store == nil {
+		return selftest.StatusSkip, "STORE is not set", ""
+	}
+	if _, err := cfgEnv.store.Get(ctx, "diagnose/probe"); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return selftest.StatusFail, err.Error(), "check that STORE's bucket, table, directory or Redis server exists and that the function may read and write it"
+	}
+	return selftest.StatusPass, cmp.Or(cfgEnv.Store, "memory"), ""
+}
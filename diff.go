@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/jobs"
+	"github.com/debendraoli/leo-lambda/pkg/jsondiff"
+	"github.com/debendraoli/leo-lambda/pkg/request"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// diffIgnored are the result fields that differ between any two runs, such as timings,
+// per-run IDs and counters; the diff action skips them.
+var diffIgnored = []string{
+	"duration", "debug",
+	"meta.journal", "meta.fingerprint", "meta.authKey", "meta.transactionId", "meta.explorerUrl",
+	"meta.container", "meta.containerStartedAt", "meta.containerInvocations", "meta.memoryLimitMB",
+	"meta.remainingMsAtStart", "meta.tmpFreeBytes", "meta.localSeconds", "meta.proverSeconds",
+	"meta.stdoutObject", "meta.debugObject",
+	"meta.contractUses", "meta.signedUrlUses", "meta.invitationUses", "meta.heldUntil", "meta.jobId", "meta.resumedFrom",
+}
+
+// diffAction compares the results of job params.a with job params.b, or without
+// params.b with a fresh run of the same command, field by field. The fresh run takes
+// the job's arguments from the journal without --broadcast, so nothing is sent to the
+// network, and without --home, --endpoint and private keys, which are injected as for
+// any request; params.endpoint sets the endpoint instead. params.ignore lists more
+// fields to skip.
+func diffAction(ctx context.Context, req events.LambdaFunctionURLRequest, cfgEnv *EnvConfig, params map[string]any) events.LambdaFunctionURLResponse {
+	a, _ := params["a"].(string)
+	b, _ := params["b"].(string)
+	if a == "" {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.a must be a job ID"})
+	}
+	ignore := slices.Clone(diffIgnored)
+	if raw, ok := params["ignore"].([]any); ok {
+		for _, v := range raw {
+			s, ok := v.(string)
+			if !ok {
+				return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.ignore must list field paths"})
+			}
+			ignore = append(ignore, s)
+		}
+	}
+
+	left, status, err := finishedJobResult(ctx, cfgEnv, a)
+	if err != nil {
+		return jsonResp(status, map[string]string{"error": err.Error()})
+	}
+	out := map[string]any{"a": a}
+	var right any
+	if b != "" {
+		if right, status, err = finishedJobResult(ctx, cfgEnv, b); err != nil {
+			return jsonResp(status, map[string]string{"error": err.Error()})
+		}
+		out["b"] = b
+	} else {
+		endpoint, _ := params["endpoint"].(string)
+		args, err := rerunArgs(cfgEnv, left, endpoint)
+		if err != nil {
+			return jsonResp(http.StatusUnprocessableEntity, map[string]string{"error": fmt.Sprintf("job %q: %v", a, err)})
+		}
+		body, _ := json.Marshal(request.InvokeRequest{Args: args, Tags: map[string]string{"diff": a}})
+		r := events.LambdaFunctionURLRequest{RawPath: "/", Body: string(body)}
+		r.RequestContext.HTTP.Method = http.MethodPost
+		r.RequestContext.HTTP.Path = "/"
+		resp, err := handler(context.WithValue(ctx, internalCaller{}, "diff:"+req.RequestContext.Authorizer.IAM.UserARN), r)
+		if err != nil {
+			return jsonResp(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		if err := json.Unmarshal([]byte(resp.Body), &right); err != nil {
+			return jsonResp(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("fresh run: %v", err)})
+		}
+		out["b"], out["args"], out["status"] = "fresh", utils.RedactFlagValues(args, utils.SecretFlags...), resp.StatusCode
+	}
+
+	changes := jsondiff.Compare(left, right, ignore)
+	out["equal"] = len(changes) == 0
+	out["changes"] = append([]jsondiff.Change{}, changes...)
+	out["text"] = jsondiff.Text(changes)
+	return jsonResp(http.StatusOK, out)
+}
+
+// finishedJobResult returns the result of job id, whoever owns it, as generic JSON, with
+// the status to answer when it cannot.
+func finishedJobResult(ctx context.Context, cfgEnv *EnvConfig, id string) (any, int, error) {
+	job, ok := jobRegistry.Lookup(id)
+	if !ok {
+		var rec storedJobRecord
+		rec, ok = loadJobRecord(ctx, cfgEnv, id)
+		job = rec.Job
+	}
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("job %q not found", id)
+	}
+	if job.Status != jobs.StatusDone {
+		return nil, http.StatusConflict, fmt.Errorf("job %q is %s", id, job.Status)
+	}
+	v, err := jsondiff.Normalize(job.Result)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return v, 0, nil
+}
+
+// rerunArgs recovers the arguments of the run that produced result from its journal
+// entry and prepares them for a run that does not broadcast.
+func rerunArgs(cfgEnv *EnvConfig, result any, endpoint string) ([]string, error) {
+	id := ""
+	if r, ok := result.(map[string]any); ok {
+		if meta, ok := r["meta"].(map[string]any); ok {
+			id, _ = meta["journal"].(string)
+		}
+	}
+	j := cfgEnv.journal()
+	if id == "" || !j.Enabled() {
+		return nil, errors.New("no journal entry to take the arguments from (set JOURNAL_DIR)")
+	}
+	e, err := j.Read(id)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("journal entry %q is gone", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	args := utils.RemoveFlags(e.Args, append([]string{"--broadcast", "--home", "--endpoint"}, utils.SecretFlags...)...)
+	if endpoint != "" {
+		sub, _ := utils.FirstSubcommand(args)
+		args = utils.InjectFlagValueAfterSubcommand(args, sub, "--endpoint", endpoint)
+	}
+	return args, nil
+}
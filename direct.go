@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// isDirect reports whether raw is a payload sent with lambda:InvokeFunction: a bare
+// InvokeRequest, which carries args, cmd or an action at the top level rather than in
+// an event envelope.
+func isDirect(raw json.RawMessage) bool {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return false
+	}
+	if _, ok := fields["requestContext"]; ok {
+		return false
+	}
+	for _, k := range []string{"args", "cmd", "action"} {
+		if _, ok := fields[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// handleDirect runs raw, an InvokeRequest invoked directly, as caller "invoke" and
+// returns the response body in place of the Function URL response around it. The
+// permission to invoke the function is the caller's authentication. Errors come back
+// as the usual error body, with its error and code.
+func handleDirect(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
+	resp, err := runEventBody(ctx, "invoke", string(raw))
+	if err != nil {
+		return nil, err
+	}
+	return responseBody(resp), nil
+}
+
+// responseBody returns resp's body as JSON, quoting it when it is not.
+func responseBody(resp events.LambdaFunctionURLResponse) json.RawMessage {
+	if !json.Valid([]byte(resp.Body)) {
+		b, _ := json.Marshal(resp.Body)
+		return b
+	}
+	return json.RawMessage(resp.Body)
+}
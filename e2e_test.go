@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/migrate"
+	"github.com/debendraoli/leo-lambda/pkg/store"
+	"github.com/debendraoli/leo-lambda/sdk"
+)
+
+// e2eAdminHeader carries the IAM principal functionURLServer reports to the handler,
+// standing in for AWS_IAM auth on a real Function URL.
+const e2eAdminHeader = "X-E2e-Iam-Arn"
+
+// functionURLServer serves handler over HTTP the way a Function URL does, so the SDK
+// and plain HTTP clients exercise the same request path as in production.
+func functionURLServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		headers := map[string]string{}
+		for k, v := range r.Header {
+			headers[strings.ToLower(k)] = strings.Join(v, ",")
+		}
+		req := events.LambdaFunctionURLRequest{
+			RawPath:        r.URL.Path,
+			RawQueryString: r.URL.RawQuery,
+			Headers:        headers,
+			Body:           string(body),
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				DomainName: r.Host,
+				HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: r.Method, Path: r.URL.Path, SourceIP: "127.0.0.1"},
+			},
+		}
+		if arn := r.Header.Get(e2eAdminHeader); arn != "" {
+			req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: arn}}
+		}
+		resp, err := handler(r.Context(), req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		for k, v := range resp.Headers {
+			w.Header().Set(k, v)
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.WriteString(w, resp.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// mockAleo answers the node API calls the Lambda makes with a fixed chain at height 42.
+func mockAleo(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/block/height/latest") {
+			_, _ = io.WriteString(w, "42")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestE2E runs full flows through the HTTP front of the handler against LocalStack
+// (S3, DynamoDB, SSM and KMS) and a mock Aleo node, or the node at LEO_E2E_ENDPOINT.
+// Run it with `make e2e`, which starts LocalStack, or set LEO_E2E=1 with LocalStack
+// listening on LOCALSTACK_URL (default http://localhost:4566).
+func TestE2E(t *testing.T) {
+	if os.Getenv("LEO_E2E") != "1" {
+		t.Skip("LEO_E2E != 1; skipping end-to-end tests")
+	}
+	localstack := cmp.Or(os.Getenv("LOCALSTACK_URL"), "http://localhost:4566")
+	if resp, err := http.Get(localstack + "/_localstack/health"); err != nil {
+		t.Fatalf("LocalStack is not reachable at %s: %v", localstack, err)
+	} else {
+		resp.Body.Close()
+	}
+	endpoint := os.Getenv("LEO_E2E_ENDPOINT")
+	if endpoint == "" {
+		endpoint = mockAleo(t).URL
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// Unique names keep reruns against a long-lived LocalStack apart.
+	run := fmt.Sprintf("e2e-%d", time.Now().UnixNano())
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_ENDPOINT_URL", localstack)
+	aws, err := awsapi.NewFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket := run
+	mkBucket, _ := http.NewRequestWithContext(ctx, http.MethodPut, localstack+"/"+bucket, nil)
+	if _, err := aws.Do(mkBucket, "s3", nil); err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+
+	// Secrets reach the function only through a sealed config encrypted with a KMS key.
+	var key struct{ KeyMetadata struct{ KeyId string } }
+	if err := aws.JSON(ctx, "kms", "TrentService.CreateKey", map[string]any{}, &key); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	var sealedOut struct{ CiphertextBlob []byte }
+	plain := []byte(`{"ALLOWED_CONTRACTS": "@tokens", "GROUP_tokens": "token.aleo", "HMAC_CLIENTS": {"e2e": {"primary": "e2e-secret"}}}`)
+	if err := aws.JSON(ctx, "kms", "TrentService.Encrypt", map[string]any{"KeyId": key.KeyMetadata.KeyId, "Plaintext": plain}, &sealedOut); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	// The fake leo prints its arguments, slowly enough for the async flow.
+	bin := filepath.Join(t.TempDir(), "leo")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\nif [ -n \"$E2E_SLOW\" ]; then sleep 2; fi\necho \"$@\"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	for k, v := range map[string]string{
+		"LEO_BIN":               bin,
+		"ENDPOINT":              endpoint,
+		"SEALED_CONFIG":         base64.StdEncoding.EncodeToString(sealedOut.CiphertextBlob),
+		"ADMIN_PRINCIPALS":      "arn:aws:iam::000000000000:role/e2e-admin",
+		"STORE":                 "dynamodb://" + run + "-store",
+		"INVITE_TABLE":          run + "-invites",
+		"CONTRACT_QUOTA_TABLE":  run + "-quotas",
+		"CONTRACT_DAILY_LIMITS": `{"token.aleo": 3}`,
+		"ALLOWLIST_PARAMETER":   "/" + run + "/allowlist",
+		"JOURNAL_DIR":           filepath.Join(dir, "journal"),
+		"USAGE_DIR":             filepath.Join(dir, "usage"),
+		"EXPORT_BUCKET":         bucket,
+		"STATUS_BUCKET":         bucket,
+	} {
+		t.Setenv(k, v)
+	}
+	srv := functionURLServer(t)
+	client, err := sdk.New(srv.URL, sdk.WithHMAC("e2e", "e2e-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := func(action string, params map[string]any) (int, map[string]any) {
+		b, _ := json.Marshal(map[string]any{"action": action, "params": params})
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(e2eAdminHeader, "arn:aws:iam::000000000000:role/e2e-admin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", action, err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	t.Run("migrate", func(t *testing.T) {
+		if status, out := admin("migrate", nil); status != http.StatusOK {
+			t.Fatalf("migrate: %d %v", status, out)
+		}
+		_, out := admin("migrate", map[string]any{"dryRun": true})
+		var res struct{ Results []migrate.Result }
+		b, _ := json.Marshal(out)
+		_ = json.Unmarshal(b, &res)
+		if len(res.Results) != 3 {
+			t.Fatalf("expected three tables, got %s", b)
+		}
+		for _, r := range res.Results {
+			if r.From != 1 || len(r.Pending) != 0 {
+				t.Fatalf("expected %s to be up to date, got %+v", r.Table, r)
+			}
+		}
+	})
+
+	t.Run("execute", func(t *testing.T) {
+		resp, err := client.Invoke(ctx, sdk.Request{Args: []string{"execute", "token.aleo/mint", "1u64"}, Tags: map[string]string{"flow": "execute"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ExitCode != 0 || !strings.Contains(resp.Stdout, "--endpoint "+endpoint) || resp.Meta["contractUses"] != "1/3" || resp.Meta["journal"] == "" {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+		// The sealed allowlist applies.
+		var ierr *sdk.InvokeError
+		if _, err := client.Invoke(ctx, sdk.Request{Args: []string{"execute", "nft.aleo/mint", "1u64"}}); !errors.As(err, &ierr) || ierr.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected 403 for nft.aleo, got %v", err)
+		}
+	})
+
+	t.Run("allowlist", func(t *testing.T) {
+		if status, out := admin("allowlist", map[string]any{"op": "add-contract", "contract": "nft.aleo"}); status != http.StatusOK {
+			t.Fatalf("add-contract: %d %v", status, out)
+		}
+		if _, err := client.Invoke(ctx, sdk.Request{Args: []string{"execute", "nft.aleo/mint", "1u64"}}); err != nil {
+			t.Fatalf("expected the runtime allowlist to admit nft.aleo: %v", err)
+		}
+	})
+
+	t.Run("async", func(t *testing.T) {
+		t.Setenv("E2E_SLOW", "1")
+		resp, err := client.Invoke(ctx, sdk.Request{Args: []string{"execute", "token.aleo/mint", "2u64"}, MaxWaitSeconds: 1})
+		if err != nil || resp.JobID == "" {
+			t.Fatalf("expected a job, got %+v (%v)", resp, err)
+		}
+		var job *sdk.Job
+		for deadline := time.Now().Add(20 * time.Second); time.Now().Before(deadline); time.Sleep(250 * time.Millisecond) {
+			if job, err = client.Job(ctx, resp.JobID); err != nil || job.Done() {
+				break
+			}
+		}
+		if err != nil || !job.Done() || job.Result == nil || job.Result.ExitCode != 0 {
+			t.Fatalf("job did not finish: %+v (%v)", job, err)
+		}
+		// Finished jobs are kept in the DynamoDB store for other containers.
+		s, err := store.Open(os.Getenv("STORE"), awsapi.NewFromEnv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stored []byte
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && stored == nil; time.Sleep(100 * time.Millisecond) {
+			stored, _ = s.Get(ctx, "jobs/"+resp.JobID)
+		}
+		if !bytes.Contains(stored, []byte(resp.JobID)) {
+			t.Fatalf("job %s was not stored: %s", resp.JobID, stored)
+		}
+	})
+
+	t.Run("quota", func(t *testing.T) {
+		// The DynamoDB counter already holds the two token.aleo executes above.
+		if resp, err := client.Invoke(ctx, sdk.Request{Args: []string{"execute", "token.aleo/mint", "3u64"}}); err != nil || resp.Meta["contractUses"] != "3/3" {
+			t.Fatalf("expected the last execute of the day, got %+v (%v)", resp, err)
+		}
+		_, err := client.Invoke(ctx, sdk.Request{Args: []string{"execute", "token.aleo/mint", "4u64"}})
+		var ierr *sdk.InvokeError
+		if !errors.As(err, &ierr) || ierr.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected the fourth token.aleo execute of the day to get 429, got %v", err)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		status, out := admin("journal", map[string]any{"tags": map[string]any{"flow": "execute"}})
+		if entries, _ := out["entries"].([]any); status != http.StatusOK || len(entries) != 1 {
+			t.Fatalf("journal: %d %v", status, out)
+		}
+		today := time.Now().UTC().Format("2006-01-02")
+		status, out = admin("export", map[string]any{"date": today})
+		journal, _ := out["journal"].(map[string]any)
+		object, _ := journal["object"].(string)
+		if status != http.StatusOK || object == "" {
+			t.Fatalf("export: %d %v", status, out)
+		}
+		if b, err := aws.GetObject(ctx, bucket, object); err != nil || !bytes.HasPrefix(b, []byte("PAR1")) {
+			t.Fatalf("expected a Parquet object at %s: %v", object, err)
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		cfgEnv, err := currentConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := publishStatus(ctx, cfgEnv); err != nil {
+			t.Fatal(err)
+		}
+		b, err := aws.GetObject(ctx, bucket, "status.json")
+		if err != nil || !bytes.Contains(b, []byte(`"reachable": true`)) {
+			t.Fatalf("unexpected status page: %s (%v)", b, err)
+		}
+	})
+}
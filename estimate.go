@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/executor"
+	"github.com/debendraoli/leo-lambda/pkg/fee"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+)
+
+// estimateFeeAction quotes the fee of executing params.contract/params.method with
+// params.inputs on params.network without broadcasting: leo builds the transaction and
+// reports its cost. The recommended priority fee is the network preset's. The same
+// command and contract allowlists and rate limits as execute apply.
+func estimateFeeAction(ctx context.Context, cfgEnv *EnvConfig, caller string, params map[string]any) events.LambdaFunctionURLResponse {
+	contract, _ := params["contract"].(string)
+	method, _ := params["method"].(string)
+	if contract == "" || method == "" {
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, "params.contract and params.method are required", nil))
+	}
+	contract = strings.ToLower(contract)
+	var inputs []string
+	if raw, ok := params["inputs"].([]any); ok {
+		for _, v := range raw {
+			s, ok := v.(string)
+			if !ok || strings.HasPrefix(s, "-") {
+				return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, "params.inputs must be strings that are not flags", nil))
+			}
+			inputs = append(inputs, s)
+		}
+	}
+	if len(cfgEnv.AllowedCommands) > 0 && !slices.ContainsFunc(cfgEnv.AllowedCommands, func(s string) bool {
+		return strings.EqualFold(strings.TrimSpace(s), "execute")
+	}) {
+		return jsonResp(http.StatusForbidden, codedError(i18n.CommandNotAllowed, `command "execute" not allowed`, map[string]string{"command": "execute"}))
+	}
+	_, ok, _, err := allowContract(ctx, cfgEnv, contract)
+	if err != nil {
+		return jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, err.Error(), nil))
+	}
+	if !ok {
+		return jsonResp(http.StatusForbidden, codedError(i18n.ContractNotAllowed, fmt.Sprintf("contract %q not allowed", contract), map[string]string{"contract": contract}))
+	}
+
+	args := append([]string{"execute", contract + "/" + method}, inputs...)
+	net, _ := params["network"].(string)
+	preset, _ := cfgEnv.networks.Lookup(net)
+	if net != "" {
+		args = append(args, "--network", net)
+	}
+	if endpoint := cmp.Or(preset.Endpoint, strings.TrimSpace(cfgEnv.EndPoint)); endpoint != "" {
+		args = append(args, "--endpoint", endpoint)
+	}
+	workdir := workdirFor(cfgEnv.DefaultWorkdir, cmp.Or(invocationID(ctx), randomID()), caller)
+	args = append(args, "--home", workdir)
+	if err := checkNetwork(ctx, cfgEnv, "execute", args); err != nil {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	release, err := quotas.Acquire(caller)
+	if err != nil {
+		return quotaExceeded(caller, err)
+	}
+	defer release()
+	if strings.Contains(cfgEnv.DefaultWorkdir, "{requestId}") {
+		defer os.RemoveAll(workdir)
+	}
+	bin := cfgEnv.LeoBin
+	if cfgEnv.DryRun {
+		bin = "echo"
+	}
+	res := runCommand(ctx, executor.Config{
+		BinPath:        bin,
+		Args:           args,
+		WorkDir:        workdir,
+		WorkRoot:       cfgEnv.WorkdirRoot,
+		MaxOutputBytes: cfgEnv.outputCap(false),
+		Retry:          cfgEnv.retry,
+		Clock:          clk,
+	})
+	if res.ExitCode != 0 {
+		return jsonResp(http.StatusUnprocessableEntity, map[string]any{"error": "leo could not build the execution", "exitCode": res.ExitCode, "stderr": res.Stderr})
+	}
+	est, err := fee.Parse(res.Stdout)
+	if err != nil {
+		return jsonResp(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	priority := preset.PriorityFee
+	total := est.Base + priority
+	return jsonResp(http.StatusOK, map[string]any{
+		"contract":    contract,
+		"method":      method,
+		"network":     net,
+		"estimate":    est,
+		"priorityFee": priority,
+		"totalFee":    total,
+		"maxFee":      cfgEnv.MaxFee,
+		"fitsMaxFee":  cfgEnv.MaxFee == 0 || total <= cfgEnv.MaxFee,
+	})
+}
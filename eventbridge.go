@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// eventRequest reports whether raw is an EventBridge event whose detail is an
+// InvokeRequest, i.e. carries args, cmd or an action, rather than a scheduled task.
+func eventRequest(raw json.RawMessage) (events.CloudWatchEvent, bool) {
+	var ev events.CloudWatchEvent
+	if json.Unmarshal(raw, &ev) != nil || ev.DetailType == "" || ev.Source == "" {
+		return ev, false
+	}
+	var detail map[string]json.RawMessage
+	if json.Unmarshal(ev.Detail, &detail) != nil {
+		return ev, false
+	}
+	for _, k := range []string{"args", "cmd", "action"} {
+		if _, ok := detail[k]; ok {
+			return ev, true
+		}
+	}
+	return ev, false
+}
+
+// eventRule names the rule that matched ev: the last part of its first resource, a rule
+// ARN such as arn:aws:events:<region>:<account>:rule/[<bus>/]<name>. Events sent with
+// PutEvents to a rule without resources are named after their source.
+func eventRule(ev events.CloudWatchEvent) string {
+	for _, r := range ev.Resources {
+		if _, name, ok := strings.Cut(r, ":rule/"); ok {
+			return name[strings.LastIndex(name, "/")+1:]
+		}
+	}
+	return ev.Source
+}
+
+// handleEvent runs the InvokeRequest in ev's detail as caller "rule:<rule name>" and
+// returns the response body, which an on-success destination receives. A failed run is
+// logged with the rule name rather than returned: Lambda would retry the invocation and
+// run it again.
+func handleEvent(ctx context.Context, ev events.CloudWatchEvent) json.RawMessage {
+	rule := eventRule(ev)
+	resp, err := runEventBody(ctx, "rule:"+rule, string(ev.Detail))
+	if err != nil {
+		logWarn("event request failed", map[string]string{"rule": rule, "eventId": ev.ID, "error": err.Error()})
+		return nil
+	}
+	if fields := runFailure(resp); fields != nil {
+		fields["rule"], fields["eventId"] = rule, ev.ID
+		logWarn("event request failed", fields)
+	}
+	return responseBody(resp)
+}
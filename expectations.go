@@ -0,0 +1,164 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/expect"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+	"github.com/debendraoli/leo-lambda/pkg/schema"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// expectReadTimeout bounds reading the mapping entries of a request's expectations.
+const expectReadTimeout = 5 * time.Second
+
+// preconditionTimeout bounds reading the mapping entries of a request's onlyIf
+// conditions.
+const preconditionTimeout = 5 * time.Second
+
+// mappingEntry is an entry read for an expectation: its value, nil when the key is
+// unset, or why it could not be read.
+type mappingEntry struct {
+	value *string
+	err   error
+}
+
+// checkExpectations validates a request's expectations. They apply to executes run by
+// this function under a profile that waits for confirmation.
+func checkExpectations(exps []expect.Expectation, subcmd string, waits, queued bool) *schema.ValidationError {
+	var errs []schema.FieldError
+	switch {
+	case subcmd != "execute":
+		errs = append(errs, schema.FieldError{Field: "expect", Message: "only applies to execute"})
+	case !waits:
+		errs = append(errs, schema.FieldError{Field: "expect", Message: "needs a profile that waits for confirmation, such as thorough"})
+	case queued:
+		errs = append(errs, schema.FieldError{Field: "expect", Message: "is not supported for executes proved by the worker fleet"})
+	}
+	for i, e := range exps {
+		if err := e.Validate(); err != nil {
+			errs = append(errs, schema.FieldError{Field: fmt.Sprintf("expect[%d]", i), Message: err.Error()})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &schema.ValidationError{Errors: errs}
+}
+
+// checkPreconditions validates a request's onlyIf conditions. They apply to executes,
+// whose --network says where to read the entries.
+func checkPreconditions(conds []expect.Condition, subcmd string, args []string) *schema.ValidationError {
+	var errs []schema.FieldError
+	switch {
+	case subcmd != "execute":
+		errs = append(errs, schema.FieldError{Field: "onlyIf", Message: "only applies to execute"})
+	case utils.GetFlagValue(args, "--network") == "":
+		errs = append(errs, schema.FieldError{Field: "onlyIf", Message: "needs --network to read mappings"})
+	}
+	for i, c := range conds {
+		if err := c.Validate(); err != nil {
+			errs = append(errs, schema.FieldError{Field: fmt.Sprintf("onlyIf[%d]", i), Message: err.Error()})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &schema.ValidationError{Errors: errs}
+}
+
+// evaluatePreconditions reads the entries conds name and refuses the request unless
+// every condition holds: with a 412 listing each condition's outcome, or a 503 when an
+// entry cannot be read. Either way leo is not run and nothing is charged.
+func evaluatePreconditions(ctx context.Context, cfgEnv *EnvConfig, args []string, contract string, conds []expect.Condition) *events.LambdaFunctionURLResponse {
+	ctx, cancel := context.WithTimeout(ctx, preconditionTimeout)
+	defer cancel()
+	refs := make([]expect.Expectation, len(conds))
+	for i, c := range conds {
+		refs[i] = expect.Expectation{Program: cmp.Or(c.Program, contract), Mapping: c.Mapping, Key: c.Key}
+	}
+	entries := readExpectations(ctx, cfgEnv, args, contract, refs)
+	outcomes := make([]expect.Outcome, len(conds))
+	held := true
+	for i, c := range conds {
+		if err := entries[i].err; err != nil {
+			resp := jsonResp(http.StatusServiceUnavailable, codedError(i18n.EndpointUnavailable, fmt.Sprintf("read %s/%s[%s]: %v", refs[i].Program, c.Mapping, c.Key, err), nil))
+			return &resp
+		}
+		c.Program = refs[i].Program
+		outcomes[i] = c.Check(entries[i].value)
+		held = held && outcomes[i].OK
+	}
+	if held {
+		return nil
+	}
+	body := codedError(i18n.PreconditionFailed, "a precondition does not hold; leo was not run", nil)
+	body["preconditionFailed"] = outcomes
+	resp := jsonResp(http.StatusPreconditionFailed, body)
+	return &resp
+}
+
+// readExpectations reads the entries exps name, in order, from the endpoint the run
+// uses. Entries of expectations without a program are read from contract.
+func readExpectations(ctx context.Context, cfgEnv *EnvConfig, args []string, contract string, exps []expect.Expectation) []mappingEntry {
+	endpoint := cmp.Or(utils.GetFlagValue(args, "--endpoint"), cfgEnv.EndPoint)
+	net := utils.GetFlagValue(args, "--network")
+	ctx, cancel := context.WithTimeout(ctx, expectReadTimeout)
+	defer cancel()
+	entries := make([]mappingEntry, len(exps))
+	for i, e := range exps {
+		if net == "" {
+			entries[i].err = errors.New("reading mappings needs --network")
+			continue
+		}
+		v, found, err := network.MappingValue(ctx, nil, endpoint, net, cmp.Or(e.Program, contract), e.Mapping, e.Key)
+		switch {
+		case err != nil:
+			entries[i].err = err
+		case found:
+			entries[i].value = &v
+		}
+	}
+	return entries
+}
+
+// verifyExpectations reads the entries exps name again once payload's transaction is
+// confirmed, compares them with before and marks payload verified when every
+// expectation holds. A run that was not confirmed is not verified.
+func verifyExpectations(ctx context.Context, cfgEnv *EnvConfig, args []string, contract string, exps []expect.Expectation, before []mappingEntry, payload *Response) {
+	verified := false
+	payload.Verified = &verified
+	switch {
+	case payload.ExitCode != 0:
+		payload.Meta["expectError"] = "execution failed"
+		return
+	case payload.Meta["confirmed"] != "true":
+		payload.Meta["expectError"] = "transaction not confirmed"
+		return
+	}
+	after := readExpectations(ctx, cfgEnv, args, contract, exps)
+	verified = true
+	payload.Diffs = make([]expect.Diff, len(exps))
+	for i, e := range exps {
+		e.Program = cmp.Or(e.Program, contract)
+		var d expect.Diff
+		switch {
+		case before[i].err != nil:
+			d = expect.Diff{Program: e.Program, Mapping: e.Mapping, Key: e.Key, Error: "before: " + before[i].err.Error()}
+		case after[i].err != nil:
+			d = expect.Diff{Program: e.Program, Mapping: e.Mapping, Key: e.Key, Before: before[i].value, Error: "after: " + after[i].err.Error()}
+		default:
+			d = e.Check(before[i].value, after[i].value)
+		}
+		payload.Diffs[i] = d
+		verified = verified && d.OK
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/journal"
+	"github.com/debendraoli/leo-lambda/pkg/parquet"
+	"github.com/debendraoli/leo-lambda/pkg/usage"
+)
+
+// exportSchemaVersion is written to every exported row. Athena maps Parquet columns by
+// name, so columns may only be appended (bumping the version); never rename or retype
+// one, or older partitions stop matching the table.
+const exportSchemaVersion = 3
+
+var journalColumns = []parquet.Column{
+	{Name: "schema_version", Type: parquet.Int64},
+	{Name: "id", Type: parquet.String},
+	{Name: "container", Type: parquet.String},
+	{Name: "caller", Type: parquet.String},
+	{Name: "args", Type: parquet.String},
+	{Name: "tags", Type: parquet.String},
+	{Name: "status", Type: parquet.String},
+	{Name: "exit_code", Type: parquet.Int64},
+	{Name: "received_at", Type: parquet.Timestamp},
+	{Name: "started_at", Type: parquet.Timestamp},
+	{Name: "finished_at", Type: parquet.Timestamp},
+	{Name: "duration_seconds", Type: parquet.Double},
+	// Since schema version 2.
+	{Name: "auth_key", Type: parquet.String},
+	// Since schema version 3.
+	{Name: "fingerprint", Type: parquet.String},
+}
+
+var usageColumns = []parquet.Column{
+	{Name: "schema_version", Type: parquet.Int64},
+	{Name: "caller", Type: parquet.String},
+	{Name: "invocations", Type: parquet.Int64},
+	{Name: "succeeded", Type: parquet.Int64},
+	{Name: "fees_microcredits", Type: parquet.Int64},
+	{Name: "compute_seconds", Type: parquet.Double},
+}
+
+// export writes the journal entries received on day and that day's usage rollups to
+// EXPORT_BUCKET as Parquet, partitioned by dt=YYYY-MM-DD. Objects have fixed names, so
+// re-running an export replaces the day's files instead of duplicating rows.
+func export(ctx context.Context, cfgEnv *EnvConfig, day time.Time) (map[string]any, error) {
+	if cfgEnv.ExportBucket == "" {
+		return nil, errors.New("export is not enabled (set EXPORT_BUCKET)")
+	}
+	date := day.UTC().Format(usage.DayLayout)
+	out := map[string]any{"date": date}
+	if j := cfgEnv.journal(); j.Enabled() {
+		entries, err := j.List(0, nil)
+		if err != nil {
+			return nil, fmt.Errorf("journal: %w", err)
+		}
+		var rows []parquet.Row
+		for _, e := range entries {
+			if row, ok := journalRow(e, date); ok {
+				rows = append(rows, row)
+			}
+		}
+		key, err := putParquet(ctx, cfgEnv, "journal", date, "entries.parquet", journalColumns, rows)
+		if err != nil {
+			return nil, err
+		}
+		out["journal"] = map[string]any{"rows": len(rows), "object": key}
+	}
+	if u := cfgEnv.usage(); u.Enabled() {
+		reports, err := u.Report(day, day, "")
+		if err != nil {
+			return nil, fmt.Errorf("usage: %w", err)
+		}
+		rows := make([]parquet.Row, 0, len(reports))
+		for _, r := range reports {
+			rows = append(rows, parquet.Row{int64(exportSchemaVersion), r.Caller, int64(r.Invocations), int64(r.Succeeded), int64(r.Fees), r.Compute})
+		}
+		key, err := putParquet(ctx, cfgEnv, "usage", date, "rollups.parquet", usageColumns, rows)
+		if err != nil {
+			return nil, err
+		}
+		out["usage"] = map[string]any{"rows": len(rows), "object": key}
+	}
+	return out, nil
+}
+
+// journalRow converts e when it was received on date; purged entries are left out.
+func journalRow(e journal.Entry, date string) (parquet.Row, bool) {
+	if !e.DeletedAt.IsZero() {
+		return nil, false
+	}
+	phases := map[string]time.Time{}
+	for _, p := range e.Phases {
+		phases[p.Name] = p.At
+	}
+	received, ok := phases["received"]
+	if !ok || received.UTC().Format(usage.DayLayout) != date {
+		return nil, false
+	}
+	args, _ := json.Marshal(e.Args)
+	row := parquet.Row{int64(exportSchemaVersion), e.ID, e.Container, e.Caller, string(args), nil, e.Status, nil, received, nil, nil, nil, nil, nil}
+	if len(e.Tags) > 0 {
+		tags, _ := json.Marshal(e.Tags)
+		row[5] = string(tags)
+	}
+	if e.ExitCode != nil {
+		row[7] = int64(*e.ExitCode)
+	}
+	if e.AuthKey != "" {
+		row[12] = e.AuthKey
+	}
+	if e.Fingerprint != "" {
+		row[13] = e.Fingerprint
+	}
+	if t, ok := phases["started"]; ok {
+		row[9] = t
+	}
+	if t, ok := phases["finished"]; ok {
+		row[10] = t
+		row[11] = t.Sub(received).Seconds()
+	}
+	return row, true
+}
+
+func putParquet(ctx context.Context, cfgEnv *EnvConfig, table, date, name string, cols []parquet.Column, rows []parquet.Row) (string, error) {
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, cols, rows); err != nil {
+		return "", fmt.Errorf("%s: %w", table, err)
+	}
+	key := cfgEnv.ExportPrefix + table + "/dt=" + date + "/" + name
+	if err := cfgEnv.s3.PutObject(ctx, cfgEnv.ExportBucket, key, buf.Bytes(), "application/vnd.apache.parquet"); err != nil {
+		return "", fmt.Errorf("%s: %w", table, err)
+	}
+	return "s3://" + cfgEnv.ExportBucket + "/" + key, nil
+}
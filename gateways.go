@@ -0,0 +1,383 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// gatewayCaller is the context key carrying the principal an API Gateway authorizer
+// established; authenticate trusts it as is.
+type gatewayCaller struct{}
+
+// stageVariables is the context key carrying the variables of the API Gateway stage
+// that received the request; TRANSFORM_RULES read them as stage.
+type stageVariables struct{}
+
+// stageVars returns the stage variables in ctx, if any.
+func stageVars(ctx context.Context) map[string]string {
+	v, _ := ctx.Value(stageVariables{}).(map[string]string)
+	return v
+}
+
+// isAPIGatewayV1 reports whether raw is an API Gateway REST API proxy event, or an HTTP
+// API event in payload format 1.0, which has the same shape.
+func isAPIGatewayV1(raw json.RawMessage) bool {
+	var ev struct {
+		Version        string `json:"version"`
+		HTTPMethod     string `json:"httpMethod"`
+		RequestContext struct {
+			APIID string `json:"apiId"`
+		} `json:"requestContext"`
+	}
+	return json.Unmarshal(raw, &ev) == nil && (ev.Version == "" || ev.Version == "1.0") &&
+		ev.HTTPMethod != "" && ev.RequestContext.APIID != ""
+}
+
+// isAPIGatewayV2 reports whether raw is an API Gateway HTTP API event. Function URL
+// events have the same payload format 2.0 but come from a lambda-url domain.
+func isAPIGatewayV2(raw json.RawMessage) bool {
+	var ev struct {
+		Version        string `json:"version"`
+		RequestContext struct {
+			APIID      string `json:"apiId"`
+			DomainName string `json:"domainName"`
+		} `json:"requestContext"`
+	}
+	return json.Unmarshal(raw, &ev) == nil && ev.Version == "2.0" && ev.RequestContext.APIID != "" &&
+		!strings.Contains(ev.RequestContext.DomainName, ".lambda-url.")
+}
+
+// fromAPIGatewayV2 converts an HTTP API event to the Function URL request the handler
+// serves. The stage is cut from the path, so routes are the same behind any stage. An
+// IAM authorizer's principal becomes the request's, as with AWS_IAM auth on the Function
+// URL; a JWT or Lambda authorizer's is returned in ctx.
+func fromAPIGatewayV2(ctx context.Context, cfgEnv *EnvConfig, ev events.APIGatewayV2HTTPRequest) (context.Context, events.LambdaFunctionURLRequest) {
+	rc := ev.RequestContext
+	req := events.LambdaFunctionURLRequest{
+		Version:               ev.Version,
+		RawPath:               stripStage(ev.RawPath, rc.Stage),
+		RawQueryString:        ev.RawQueryString,
+		Cookies:               ev.Cookies,
+		Headers:               ev.Headers,
+		QueryStringParameters: ev.QueryStringParameters,
+		Body:                  ev.Body,
+		IsBase64Encoded:       ev.IsBase64Encoded,
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			AccountID:  rc.AccountID,
+			RequestID:  rc.RequestID,
+			APIID:      rc.APIID,
+			DomainName: rc.DomainName,
+			Time:       rc.Time,
+			TimeEpoch:  rc.TimeEpoch,
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{
+				Method:    rc.HTTP.Method,
+				Path:      stripStage(rc.HTTP.Path, rc.Stage),
+				Protocol:  rc.HTTP.Protocol,
+				SourceIP:  rc.HTTP.SourceIP,
+				UserAgent: rc.HTTP.UserAgent,
+			},
+		},
+	}
+	if len(ev.StageVariables) > 0 {
+		ctx = context.WithValue(ctx, stageVariables{}, ev.StageVariables)
+	}
+	a := rc.Authorizer
+	switch {
+	case a == nil:
+	case a.IAM != nil:
+		req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+			IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{
+				AccessKey: a.IAM.AccessKey,
+				AccountID: a.IAM.AccountID,
+				CallerID:  a.IAM.CallerID,
+				UserARN:   a.IAM.UserARN,
+				UserID:    a.IAM.UserID,
+			},
+		}
+	case a.JWT != nil && a.JWT.Claims["sub"] != "":
+		groups := ""
+		if cfgEnv != nil {
+			groups = a.JWT.Claims[cfgEnv.OIDCGroupsClaim]
+		}
+		ctx = context.WithValue(ctx, gatewayCaller{}, principal{id: "jwt:" + a.JWT.Claims["sub"], groups: splitGroups(groups)})
+	case a.Lambda != nil:
+		if p, ok := authorizerPrincipal(cfgEnv, a.Lambda); ok {
+			ctx = context.WithValue(ctx, gatewayCaller{}, p)
+		}
+	}
+	return ctx, req
+}
+
+// fromAPIGatewayV1 converts a REST API proxy event to the Function URL request the
+// handler serves. Headers are lower-cased and repeated headers and query parameters
+// joined, as Function URLs pass them; the query string is rebuilt with its parameters
+// sorted. The path is the resource path, without the stage. Callers are identified as
+// on HTTP APIs: an IAM caller becomes the request's, a Cognito user pool authorizer's
+// sub and a Lambda authorizer's principal are returned in ctx. Without any of these,
+// the API key a usage plan checked identifies the caller as apikey:<id>.
+func fromAPIGatewayV1(ctx context.Context, cfgEnv *EnvConfig, ev events.APIGatewayProxyRequest) (context.Context, events.LambdaFunctionURLRequest) {
+	rc := ev.RequestContext
+	headers := flattenHeaders(ev.Headers, ev.MultiValueHeaders)
+	query := url.Values{}
+	for k, v := range ev.QueryStringParameters {
+		query.Set(k, v)
+	}
+	maps.Copy(query, ev.MultiValueQueryStringParameters)
+	var params map[string]string
+	if len(query) > 0 {
+		params = make(map[string]string, len(query))
+		for k, vs := range query {
+			params[k] = strings.Join(vs, ",")
+		}
+	}
+	req := events.LambdaFunctionURLRequest{
+		Version:               "1.0",
+		RawPath:               cmp.Or(ev.Path, "/"),
+		RawQueryString:        query.Encode(),
+		Headers:               headers,
+		QueryStringParameters: params,
+		Body:                  ev.Body,
+		IsBase64Encoded:       ev.IsBase64Encoded,
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			AccountID:  rc.AccountID,
+			RequestID:  rc.RequestID,
+			APIID:      rc.APIID,
+			DomainName: rc.DomainName,
+			Time:       rc.RequestTime,
+			TimeEpoch:  rc.RequestTimeEpoch,
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{
+				Method:    ev.HTTPMethod,
+				Path:      cmp.Or(ev.Path, "/"),
+				Protocol:  rc.Protocol,
+				SourceIP:  rc.Identity.SourceIP,
+				UserAgent: rc.Identity.UserAgent,
+			},
+		},
+	}
+	if len(ev.StageVariables) > 0 {
+		ctx = context.WithValue(ctx, stageVariables{}, ev.StageVariables)
+	}
+	id := rc.Identity
+	claims, _ := rc.Authorizer["claims"].(map[string]any)
+	sub, _ := claims["sub"].(string)
+	switch {
+	case id.UserArn != "":
+		req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+			IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{
+				AccessKey: id.AccessKey,
+				AccountID: id.AccountID,
+				CallerID:  id.Caller,
+				UserARN:   id.UserArn,
+				UserID:    id.User,
+			},
+		}
+	case sub != "":
+		groups := ""
+		if cfgEnv != nil {
+			groups, _ = claims[cfgEnv.OIDCGroupsClaim].(string)
+		}
+		ctx = context.WithValue(ctx, gatewayCaller{}, principal{id: "jwt:" + sub, groups: splitGroups(groups)})
+	default:
+		if p, ok := authorizerPrincipal(cfgEnv, rc.Authorizer); ok {
+			ctx = context.WithValue(ctx, gatewayCaller{}, p)
+		} else if id.APIKeyID != "" {
+			ctx = context.WithValue(ctx, gatewayCaller{}, principal{id: "apikey:" + id.APIKeyID})
+		}
+	}
+	return ctx, req
+}
+
+// isALB reports whether raw is an Application Load Balancer target group event.
+func isALB(raw json.RawMessage) bool {
+	var ev struct {
+		RequestContext struct {
+			ELB struct {
+				TargetGroupArn string `json:"targetGroupArn"`
+			} `json:"elb"`
+		} `json:"requestContext"`
+	}
+	return json.Unmarshal(raw, &ev) == nil && ev.RequestContext.ELB.TargetGroupArn != ""
+}
+
+// fromALB converts an ALB target group event to the Function URL request the handler
+// serves. Headers and query parameters are flattened as for REST APIs. ALB passes the
+// query as the client sent it, still percent-encoded, so it is the raw query string as
+// is. The source IP is the address the load balancer appended to X-Forwarded-For. ALB
+// has no authorizers: the handler authenticates every request itself.
+func fromALB(ev events.ALBTargetGroupRequest) events.LambdaFunctionURLRequest {
+	headers := flattenHeaders(ev.Headers, ev.MultiValueHeaders)
+	var pairs []string
+	params := map[string]string{}
+	addParam := func(k, v string) {
+		pairs = append(pairs, k+"="+v)
+		k, _ = url.QueryUnescape(k)
+		v, _ = url.QueryUnescape(v)
+		if prev, ok := params[k]; ok {
+			v = prev + "," + v
+		}
+		params[k] = v
+	}
+	if len(ev.MultiValueQueryStringParameters) > 0 {
+		for _, k := range slices.Sorted(maps.Keys(ev.MultiValueQueryStringParameters)) {
+			for _, v := range ev.MultiValueQueryStringParameters[k] {
+				addParam(k, v)
+			}
+		}
+	} else {
+		for _, k := range slices.Sorted(maps.Keys(ev.QueryStringParameters)) {
+			addParam(k, ev.QueryStringParameters[k])
+		}
+	}
+	if len(params) == 0 {
+		params = nil
+	}
+	var sourceIP string
+	if xff := headers["x-forwarded-for"]; xff != "" {
+		sourceIP = strings.TrimSpace(xff[strings.LastIndex(xff, ",")+1:])
+	}
+	path := cmp.Or(ev.Path, "/")
+	return events.LambdaFunctionURLRequest{
+		Version:               "1.0",
+		RawPath:               path,
+		RawQueryString:        strings.Join(pairs, "&"),
+		Headers:               headers,
+		QueryStringParameters: params,
+		Body:                  ev.Body,
+		IsBase64Encoded:       ev.IsBase64Encoded,
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{
+				Method:    ev.HTTPMethod,
+				Path:      path,
+				SourceIP:  sourceIP,
+				UserAgent: headers["user-agent"],
+			},
+		},
+	}
+}
+
+// toALB converts the handler's response to an ALB target group response. A target
+// group with multi-value headers enabled ignores Headers, so multi is set from the
+// request's shape; cookies become Set-Cookie headers either way.
+func toALB(resp events.LambdaFunctionURLResponse, multi bool) events.ALBTargetGroupResponse {
+	status := cmp.Or(resp.StatusCode, http.StatusOK)
+	out := events.ALBTargetGroupResponse{
+		StatusCode:        status,
+		StatusDescription: fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Body:              resp.Body,
+		IsBase64Encoded:   resp.IsBase64Encoded,
+	}
+	if !multi {
+		out.Headers = resp.Headers
+		// Without multi-value headers only one cookie can be set.
+		if len(resp.Cookies) > 0 {
+			out.Headers = maps.Clone(resp.Headers)
+			if out.Headers == nil {
+				out.Headers = map[string]string{}
+			}
+			out.Headers["Set-Cookie"] = resp.Cookies[0]
+		}
+		return out
+	}
+	out.MultiValueHeaders = make(map[string][]string, len(resp.Headers)+1)
+	for k, v := range resp.Headers {
+		out.MultiValueHeaders[k] = []string{v}
+	}
+	if len(resp.Cookies) > 0 {
+		out.MultiValueHeaders["Set-Cookie"] = slices.Clone(resp.Cookies)
+	}
+	return out
+}
+
+// flattenHeaders lower-cases header names and joins repeated headers with commas, as
+// Function URLs pass them. multi, when given, holds every header.
+func flattenHeaders(single map[string]string, multi map[string][]string) map[string]string {
+	headers := make(map[string]string, max(len(single), len(multi)))
+	for k, v := range single {
+		headers[strings.ToLower(k)] = v
+	}
+	for k, vs := range multi {
+		headers[strings.ToLower(k)] = strings.Join(vs, ",")
+	}
+	return headers
+}
+
+// authorizerPrincipal returns the principal in a Lambda authorizer's context: its
+// AUTHORIZER_PRINCIPAL_KEY entry, with the groups in AUTHORIZER_GROUPS_KEY, a list or a
+// string.
+func authorizerPrincipal(cfgEnv *EnvConfig, lambda map[string]any) (principal, bool) {
+	if cfgEnv == nil {
+		return principal{}, false
+	}
+	id, _ := lambda[cfgEnv.AuthorizerID].(string)
+	if id == "" {
+		return principal{}, false
+	}
+	p := principal{id: "authorizer:" + id}
+	switch g := lambda[cfgEnv.AuthorizerGroups].(type) {
+	case string:
+		p.groups = splitGroups(g)
+	case []any:
+		for _, v := range g {
+			if s, ok := v.(string); ok && s != "" {
+				p.groups = append(p.groups, s)
+			}
+		}
+	}
+	return p, true
+}
+
+// toAPIGatewayV2 converts the handler's response to an HTTP API response.
+func toAPIGatewayV2(resp events.LambdaFunctionURLResponse) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:      resp.StatusCode,
+		Headers:         resp.Headers,
+		Body:            resp.Body,
+		IsBase64Encoded: resp.IsBase64Encoded,
+		Cookies:         resp.Cookies,
+	}
+}
+
+// toAPIGatewayV1 converts the handler's response to a REST API proxy response. Cookies
+// become Set-Cookie headers.
+func toAPIGatewayV1(resp events.LambdaFunctionURLResponse) events.APIGatewayProxyResponse {
+	out := events.APIGatewayProxyResponse{
+		StatusCode:      cmp.Or(resp.StatusCode, http.StatusOK),
+		Headers:         resp.Headers,
+		Body:            resp.Body,
+		IsBase64Encoded: resp.IsBase64Encoded,
+	}
+	if len(resp.Cookies) > 0 {
+		out.MultiValueHeaders = map[string][]string{"Set-Cookie": slices.Clone(resp.Cookies)}
+	}
+	return out
+}
+
+// stripStage removes a named stage from the start of path; the $default stage has none.
+func stripStage(path, stage string) string {
+	if stage == "" || stage == "$default" {
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, "/"+stage); ok && (rest == "" || rest[0] == '/') {
+		if rest == "" {
+			return "/"
+		}
+		return rest
+	}
+	return path
+}
+
+// splitGroups splits a list of groups as authorizers pass them in strings:
+// "a,b", "a b" or API Gateway's rendering of a JSON array, "[a b]".
+func splitGroups(s string) []string {
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "["), "]")
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/keyuse"
+	"github.com/debendraoli/leo-lambda/pkg/selftest"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// keyUse records the use of configured keys below USAGE_DIR/keys; it is disabled
+// without USAGE_DIR.
+func (c *EnvConfig) keyUse() *keyuse.Store {
+	if c.UsageDir == "" {
+		return &keyuse.Store{}
+	}
+	return &keyuse.Store{Dir: filepath.Join(c.UsageDir, "keys")}
+}
+
+// feePayerAlias names the FEE_PAYERS entry of contract.
+func feePayerAlias(contract string) string {
+	return "FEE_PAYERS[" + contract + "]"
+}
+
+// keyAliases names the configured private keys: PRIVATE_KEY, FEE_PRIVATE_KEY and one
+// per FEE_PAYERS contract.
+func (c *EnvConfig) keyAliases() []string {
+	var aliases []string
+	if c.PrivateKey != "" {
+		aliases = append(aliases, "PRIVATE_KEY")
+	}
+	if c.FeePrivateKey != "" {
+		aliases = append(aliases, "FEE_PRIVATE_KEY")
+	}
+	for _, contract := range slices.Sorted(maps.Keys(c.feePayers)) {
+		aliases = append(aliases, feePayerAlias(contract))
+	}
+	return aliases
+}
+
+// usedKeys returns the aliases of the configured keys args sign or pay with. A fee key
+// is attributed to the contract's FEE_PAYERS entry first, as it is injected; keys the
+// caller brought are not tracked.
+func usedKeys(cfgEnv *EnvConfig, args []string, contract string) []string {
+	var used []string
+	if k := utils.GetFlagValue(args, "--private-key"); k != "" && k == cfgEnv.PrivateKey {
+		used = append(used, "PRIVATE_KEY")
+	}
+	switch k := utils.GetFlagValue(args, "--fee-private-key"); {
+	case k == "":
+	case k == cfgEnv.feePayers[contract]:
+		used = append(used, feePayerAlias(contract))
+	case k == cfgEnv.FeePrivateKey:
+		used = append(used, "FEE_PRIVATE_KEY")
+	}
+	return used
+}
+
+// recordKeyUse notes a run's use of configured keys. It returns the first error, as
+// a failed record must not fail the run.
+func recordKeyUse(cfgEnv *EnvConfig, args []string, contract string, at time.Time) error {
+	s := cfgEnv.keyUse()
+	if !s.Enabled() {
+		return nil
+	}
+	for _, alias := range usedKeys(cfgEnv, args, contract) {
+		if err := s.Record(alias, contract, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keysReport reports the use of the configured keys, flagging those unused for
+// KEY_UNUSED_DAYS, and a warning per flagged key.
+func keysReport(cfgEnv *EnvConfig) ([]keyuse.Key, []string, error) {
+	keys, err := cfgEnv.keyUse().Report(cfgEnv.keyAliases(), clk.Now(), days(cfgEnv.KeyUnusedDays))
+	if err != nil {
+		return nil, nil, err
+	}
+	var warns []string
+	for _, k := range keys {
+		if k.Unused {
+			warns = append(warns, fmt.Sprintf("%s has not been used in %d days; consider removing it", k.Alias, cfgEnv.KeyUnusedDays))
+		}
+	}
+	return keys, warns, nil
+}
+
+// keysAction reports, per configured key alias, when the key was last used, for which
+// contract, and how many times today.
+func keysAction(cfgEnv *EnvConfig) events.LambdaFunctionURLResponse {
+	if !cfgEnv.keyUse().Enabled() {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "key usage is not recorded (set USAGE_DIR)"})
+	}
+	keys, warns, err := keysReport(cfgEnv)
+	if err != nil {
+		return jsonResp(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	for _, w := range warns {
+		logWarn("private key unused", map[string]string{"detail": w})
+	}
+	return jsonResp(http.StatusOK, map[string]any{"keys": keys, "unusedDays": cfgEnv.KeyUnusedDays, "warnings": warns})
+}
+
+// diagKeys warns about configured keys unused for KEY_UNUSED_DAYS.
+func diagKeys(cfgEnv *EnvConfig) (string, string, string) {
+	if !cfgEnv.keyUse().Enabled() || len(cfgEnv.keyAliases()) == 0 {
+		return selftest.StatusSkip, "no keys configured, or USAGE_DIR is not set", ""
+	}
+	keys, warns, err := keysReport(cfgEnv)
+	if err != nil {
+		return selftest.StatusFail, err.Error(), "check that USAGE_DIR exists and is mounted"
+	}
+	if len(warns) > 0 {
+		return selftest.StatusWarn, strings.Join(warns, "; "), "remove the unused keys from the configuration, or raise KEY_UNUSED_DAYS"
+	}
+	return selftest.StatusPass, fmt.Sprintf("%d keys in use", len(keys)), ""
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// isKinesis reports whether raw is a batch of records from a Kinesis event source mapping.
+func isKinesis(raw json.RawMessage) bool {
+	var ev struct {
+		Records []struct {
+			EventSource string `json:"eventSource"`
+		} `json:"Records"`
+	}
+	return json.Unmarshal(raw, &ev) == nil && len(ev.Records) > 0 && ev.Records[0].EventSource == "aws:kinesis"
+}
+
+// handleKinesis runs the records of a batch, all from one shard, in order, each record's
+// data an InvokeRequest sent by the stream as caller "kinesis:<stream name>". At the
+// first record that fails, the batch stops and that record is reported, so the shard is
+// checkpointed just before it and retried from there. Records not started before the
+// invocation's TIME_RESERVE are left for the retry the same way. A request rejected
+// with a 4xx other than 429 would be rejected again, so it is logged and skipped
+// rather than holding up the shard. An execute in a queueing maintenance window is
+// refused with a 503 rather than held, so the shard waits at it until the window closes.
+func handleKinesis(ctx context.Context, ev events.KinesisEvent) events.KinesisEventResponse {
+	resp := events.KinesisEventResponse{BatchItemFailures: []events.KinesisBatchItemFailure{}}
+	var reserve time.Duration
+	if cfgEnv, err := currentConfig(); err == nil {
+		reserve = cfgEnv.TimeReserve
+	}
+	for _, r := range ev.Records {
+		if deadline, ok := ctx.Deadline(); (ok && time.Until(deadline) < reserve) || ctx.Err() != nil || !runKinesisRecord(ctx, r) {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.KinesisBatchItemFailure{ItemIdentifier: r.Kinesis.SequenceNumber})
+			break
+		}
+	}
+	return resp
+}
+
+// runKinesisRecord runs one record and reports whether the shard may move past it.
+func runKinesisRecord(ctx context.Context, r events.KinesisEventRecord) bool {
+	stream := r.EventSourceArn[strings.LastIndex(r.EventSourceArn, "/")+1:]
+	resp, err := runEventBody(ctx, "kinesis:"+stream, string(r.Kinesis.Data))
+	if err != nil {
+		logWarn("kinesis record failed", map[string]string{"sequenceNumber": r.Kinesis.SequenceNumber, "error": err.Error()})
+		return false
+	}
+	fields := runFailure(resp)
+	if fields == nil {
+		return true
+	}
+	fields["sequenceNumber"], fields["partitionKey"] = r.Kinesis.SequenceNumber, r.Kinesis.PartitionKey
+	permanent := resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests
+	if permanent {
+		logWarn("kinesis record rejected, skipped", fields)
+		return true
+	}
+	logWarn("kinesis record failed", fields)
+	return false
+}
@@ -1,21 +1,85 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"maps"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	env "github.com/caarlos0/env/v11"
 
+	"github.com/debendraoli/leo-lambda/pkg/abi"
+	"github.com/debendraoli/leo-lambda/pkg/alert"
+	"github.com/debendraoli/leo-lambda/pkg/alias"
+	"github.com/debendraoli/leo-lambda/pkg/allowlist"
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/budget"
+	"github.com/debendraoli/leo-lambda/pkg/bulkhead"
+	"github.com/debendraoli/leo-lambda/pkg/chainvars"
+	"github.com/debendraoli/leo-lambda/pkg/classify"
+	"github.com/debendraoli/leo-lambda/pkg/clock"
+	"github.com/debendraoli/leo-lambda/pkg/contractquota"
+	"github.com/debendraoli/leo-lambda/pkg/cors"
 	"github.com/debendraoli/leo-lambda/pkg/executor"
+	"github.com/debendraoli/leo-lambda/pkg/expect"
+	"github.com/debendraoli/leo-lambda/pkg/fingerprint"
+	"github.com/debendraoli/leo-lambda/pkg/hmacauth"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/invite"
+	"github.com/debendraoli/leo-lambda/pkg/jobs"
+	"github.com/debendraoli/leo-lambda/pkg/journal"
+	"github.com/debendraoli/leo-lambda/pkg/jsonstream"
+	"github.com/debendraoli/leo-lambda/pkg/jwtauth"
+	"github.com/debendraoli/leo-lambda/pkg/maintenance"
+	"github.com/debendraoli/leo-lambda/pkg/metrics"
+	"github.com/debendraoli/leo-lambda/pkg/mixed"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+	"github.com/debendraoli/leo-lambda/pkg/notify"
+	"github.com/debendraoli/leo-lambda/pkg/policy"
+	"github.com/debendraoli/leo-lambda/pkg/profile"
+	"github.com/debendraoli/leo-lambda/pkg/prover"
+	"github.com/debendraoli/leo-lambda/pkg/quota"
+	"github.com/debendraoli/leo-lambda/pkg/receipt"
+	"github.com/debendraoli/leo-lambda/pkg/redis"
+	"github.com/debendraoli/leo-lambda/pkg/reqlog"
+	"github.com/debendraoli/leo-lambda/pkg/request"
+	"github.com/debendraoli/leo-lambda/pkg/rollup"
+	"github.com/debendraoli/leo-lambda/pkg/schedule"
+	"github.com/debendraoli/leo-lambda/pkg/schema"
+	"github.com/debendraoli/leo-lambda/pkg/sealed"
+	"github.com/debendraoli/leo-lambda/pkg/selftest"
+	"github.com/debendraoli/leo-lambda/pkg/signedurl"
+	"github.com/debendraoli/leo-lambda/pkg/signing"
+	"github.com/debendraoli/leo-lambda/pkg/state"
+	"github.com/debendraoli/leo-lambda/pkg/store"
+	"github.com/debendraoli/leo-lambda/pkg/tags"
+	"github.com/debendraoli/leo-lambda/pkg/transform"
+	"github.com/debendraoli/leo-lambda/pkg/usage"
 	"github.com/debendraoli/leo-lambda/pkg/utils"
+	"github.com/debendraoli/leo-lambda/pkg/warnings"
+	"github.com/debendraoli/leo-lambda/pkg/worker"
 )
 
 type Response struct {
@@ -25,39 +89,600 @@ type Response struct {
 	Stderr    string            `json:"stderr,omitempty"`
 	Truncated bool              `json:"truncated,omitempty"`
 	Meta      map[string]string `json:"meta,omitempty"`
+	// Events lists the outputs and finalize operations of a confirmed execution.
+	Events []network.Event `json:"events,omitempty"`
+	// Verified reports whether the request's expectations held; Diffs has one entry
+	// per expectation.
+	Verified *bool         `json:"verified,omitempty"`
+	Diffs    []expect.Diff `json:"diffs,omitempty"`
+	// Warnings are caveats of a request that still succeeded, e.g. truncated output.
+	Warnings []warnings.Warning `json:"warnings,omitempty"`
+	// Debug is the executor debug bundle an admin asked for, when it is not uploaded.
+	Debug *debugBundle `json:"debug,omitempty"`
+	// Code is the category a failed run's stderr was filed under (see STDERR_RULES).
+	Code string `json:"code,omitempty"`
+}
+
+// warn adds a warning to r.
+func (r *Response) warn(code, msg string) {
+	r.Warnings = append(r.Warnings, warnings.Warning{Code: code, Message: msg})
 }
 
 // EnvConfig is loaded at invocation time from environment variables.
 type EnvConfig struct {
-	AllowedCommands  []string `env:"ALLOWED_COMMANDS" envSeparator:"," envDefault:"execute"`
-	AllowedContracts []string `env:"ALLOWED_CONTRACTS" envSeparator:","`
-	PrivateKey       string   `env:"PRIVATE_KEY"`
-	LeoBin           string   `env:"LEO_BIN" envDefault:"leo"`
-	DryRun           bool     `env:"DRY_RUN" envDefault:"false"`
-	MaxOutputBytes   int      `env:"MAX_OUTPUT_BYTES" envDefault:"5500000"`
-	DefaultWorkdir   string   `env:"WORKDIR" envDefault:"/tmp/leo"`
-	EndPoint         string   `env:"ENDPOINT" envDefault:"https://api.explorer.provable.com/v1"`
+	AllowedCommands  []string      `env:"ALLOWED_COMMANDS" envSeparator:"," envDefault:"execute"`
+	AllowedContracts []string      `env:"ALLOWED_CONTRACTS" envSeparator:","`
+	PrivateKey       string        `env:"PRIVATE_KEY"`
+	FeePrivateKey    string        `env:"FEE_PRIVATE_KEY"`
+	FeePayers        string        `env:"FEE_PAYERS"`
+	MaxFee           uint64        `env:"MAX_FEE"`
+	LeoBin           string        `env:"LEO_BIN" envDefault:"leo"`
+	DryRun           bool          `env:"DRY_RUN" envDefault:"false"`
+	DebugMeta        bool          `env:"DEBUG_META"`
+	DebugExecutor    bool          `env:"DEBUG_EXECUTOR"`
+	PTYCommands      []string      `env:"PTY_COMMANDS" envSeparator:","`
+	RetryAttempts    int           `env:"RETRY_MAX_ATTEMPTS" envDefault:"1"`
+	RetryExitCodes   []int         `env:"RETRY_EXIT_CODES" envSeparator:","`
+	RetryStderr      string        `env:"RETRY_STDERR_PATTERN"`
+	RetryCategories  []string      `env:"RETRY_CATEGORIES" envSeparator:","`
+	StderrRules      string        `env:"STDERR_RULES"`
+	RetryBackoff     time.Duration `env:"RETRY_BACKOFF" envDefault:"1s"`
+	RetryMaxBackoff  time.Duration `env:"RETRY_MAX_BACKOFF" envDefault:"10s"`
+	DeadlineFlags    string        `env:"DEADLINE_FLAGS"`
+	Bulkheads        string        `env:"BULKHEADS"`
+	MaxOutputBytes   int           `env:"MAX_OUTPUT_BYTES"`
+	DefaultWorkdir   string        `env:"WORKDIR" envDefault:"/tmp/leo"`
+	WorkdirRoot      string        `env:"WORKDIR_ROOT" envDefault:"/tmp"`
+	EndPoint         string        `env:"ENDPOINT" envDefault:"https://api.explorer.provable.com/v1"`
+	TransformRules   string        `env:"TRANSFORM_RULES"`
+	InvokePresets    string        `env:"INVOKE_PRESETS"`
+	ChainVarTTL      time.Duration `env:"CHAIN_VAR_TTL" envDefault:"5s"`
+	ChainVarStale    time.Duration `env:"CHAIN_VAR_STALE"`
+	Schedules        string        `env:"SCHEDULES"`
+	Maintenance      string        `env:"MAINTENANCE_WINDOWS"`
+	ErrorMessages    string        `env:"ERROR_MESSAGES"`
+	ReadCommands     []string      `env:"READ_COMMANDS" envSeparator:"," envDefault:"query"`
+	HedgeEndpoints   []string      `env:"HEDGE_ENDPOINTS" envSeparator:","`
+	NetworkCheck     bool          `env:"NETWORK_CHECK"`
+	SigningKeyID     string        `env:"RESPONSE_SIGNING_KEY_ID"`
+	SigningAlgorithm string        `env:"RESPONSE_SIGNING_ALGORITHM" envDefault:"ECDSA_SHA_256"`
+	ReceiptProgram   string        `env:"RECEIPT_PROGRAM"`
+	ReceiptFunction  string        `env:"RECEIPT_FUNCTION" envDefault:"record"`
+	ReceiptContracts []string      `env:"RECEIPT_CONTRACTS" envSeparator:","`
+	RateLimit        int           `env:"RATE_LIMIT_PER_MINUTE"`
+	DailySpendLimit  uint64        `env:"DAILY_SPEND_LIMIT"`
+	ContractLimits   string        `env:"CONTRACT_DAILY_LIMITS"`
+	ContractTable    string        `env:"CONTRACT_QUOTA_TABLE"`
+	RollupTable      string        `env:"ROLLUP_TABLE"`
+	RollupDays       int           `env:"ROLLUP_RETENTION_DAYS" envDefault:"90"`
+	MigrateOnStart   bool          `env:"MIGRATE_ON_START"`
+	MaxConcurrent    int           `env:"MAX_CONCURRENT_EXECUTIONS"`
+	JobTimeout       time.Duration `env:"JOB_TIMEOUT" envDefault:"15m"`
+	JobConcurrency   int           `env:"JOB_CONCURRENCY"`
+	ResumableJobs    bool          `env:"RESUMABLE_JOBS"`
+	AdminPrincipals  []string      `env:"ADMIN_PRINCIPALS" envSeparator:","`
+	JournalDir       string        `env:"JOURNAL_DIR"`
+	JournalOutput    int           `env:"JOURNAL_OUTPUT_BYTES" envDefault:"16384"`
+	JournalSync      time.Duration `env:"JOURNAL_SYNC_INTERVAL" envDefault:"2s"`
+	JournalDays      int           `env:"JOURNAL_RETENTION_DAYS"`
+	JobDays          int           `env:"JOB_RETENTION_DAYS"`
+	OutputDays       int           `env:"OUTPUT_RETENTION_DAYS"`
+	UsageDir         string        `env:"USAGE_DIR"`
+	Streaming        bool          `env:"RESPONSE_STREAMING"`
+	KeyUnusedDays    int           `env:"KEY_UNUSED_DAYS" envDefault:"30"`
+	Networks         string        `env:"NETWORKS"`
+	HMACClients      string        `env:"HMAC_CLIENTS"`
+	OIDCIssuer       string        `env:"OIDC_ISSUER"`
+	OIDCAudience     string        `env:"OIDC_AUDIENCE"`
+	OIDCJWKSURL      string        `env:"OIDC_JWKS_URL"`
+	OIDCGroupsClaim  string        `env:"OIDC_GROUPS_CLAIM" envDefault:"groups"`
+	AuthorizerID     string        `env:"AUTHORIZER_PRINCIPAL_KEY" envDefault:"principalId"`
+	AuthorizerGroups string        `env:"AUTHORIZER_GROUPS_KEY" envDefault:"groups"`
+	GroupContracts   string        `env:"GROUP_CONTRACTS"`
+	ShadowContracts  []string      `env:"SHADOW_ALLOWED_CONTRACTS" envSeparator:","`
+	ShadowGroups     string        `env:"SHADOW_GROUP_CONTRACTS"`
+	InviteTable      string        `env:"INVITE_TABLE"`
+	SignedURLSecret  string        `env:"SIGNED_URL_SECRET"`
+	SignedURLTable   string        `env:"SIGNED_URL_TABLE"`
+	LogSampleRate    float64       `env:"LOG_SAMPLE_RATE" envDefault:"1"`
+	LogCaptureBody   string        `env:"LOG_CAPTURE_BODY" envDefault:"on-error"`
+	CORSOrigins      []string      `env:"CORS_ALLOWED_ORIGINS" envSeparator:","`
+	CORSMethods      []string      `env:"CORS_ALLOWED_METHODS" envSeparator:"," envDefault:"GET,POST,OPTIONS"`
+	CORSHeaders      []string      `env:"CORS_ALLOWED_HEADERS" envSeparator:"," envDefault:"Content-Type,Authorization,X-Leo-Client,X-Leo-Timestamp,X-Leo-Request-Signature,X-Leo-Invitation"`
+	CORSCredentials  bool          `env:"CORS_ALLOW_CREDENTIALS"`
+	CORSMaxAge       time.Duration `env:"CORS_MAX_AGE" envDefault:"10m"`
+	SlackWebhook     string        `env:"NOTIFY_SLACK_WEBHOOK"`
+	DiscordWebhook   string        `env:"NOTIFY_DISCORD_WEBHOOK"`
+	NotifyOn         string        `env:"NOTIFY_ON" envDefault:"failure"`
+	NotifyCommands   []string      `env:"NOTIFY_COMMANDS" envSeparator:","`
+	NotifyContracts  []string      `env:"NOTIFY_CONTRACTS" envSeparator:","`
+	NotifyPerMinute  int           `env:"NOTIFY_MAX_PER_MINUTE" envDefault:"10"`
+	AlertStreak      int           `env:"ALERT_FAILURE_STREAK" envDefault:"5"`
+	AlertCategories  []string      `env:"ALERT_CATEGORIES" envSeparator:","`
+	AlertTopicARN    string        `env:"ALERT_SNS_TOPIC_ARN"`
+	ResultsTopicARN  string        `env:"RESULTS_TOPIC_ARN"`
+	PagerDutyKey     string        `env:"PAGERDUTY_ROUTING_KEY"`
+	PagerDutyURL     string        `env:"PAGERDUTY_EVENTS_URL"`
+	MetricsNamespace string        `env:"METRICS_NAMESPACE"`
+	AllowlistParam   string        `env:"ALLOWLIST_PARAMETER"`
+	ConfigHardStale  time.Duration `env:"CONFIG_HARD_STALE" envDefault:"1h"`
+	Store            string        `env:"STORE"`
+	RedisURL         string        `env:"REDIS_URL"`
+	ProverURL        string        `env:"PROVER_URL"`
+	ProverToken      string        `env:"PROVER_TOKEN"`
+	ProverContracts  []string      `env:"PROVER_CONTRACTS" envSeparator:","`
+	WorkerQueueURL   string        `env:"WORKER_QUEUE_URL"`
+	WorkerSecret     string        `env:"WORKER_CALLBACK_SECRET"`
+	WorkerContracts  []string      `env:"WORKER_CONTRACTS" envSeparator:","`
+	ABIValidation    bool          `env:"ABI_VALIDATION"`
+	ABIDir           string        `env:"ABI_DIR"`
+	DedupWindow      time.Duration `env:"DEDUP_WINDOW"`
+	DedupMode        string        `env:"DEDUP_MODE" envDefault:"warn"`
+	TimeReserve      time.Duration `env:"TIME_RESERVE" envDefault:"2s"`
+	ReceiptReserve   time.Duration `env:"RECEIPT_TIME_RESERVE" envDefault:"20s"`
+	Profiles         string        `env:"PROFILES"`
+	DefaultProfile   string        `env:"DEFAULT_PROFILE"`
+	OutputBucket     string        `env:"OUTPUT_BUCKET"`
+	ExportBucket     string        `env:"EXPORT_BUCKET"`
+	ExportPrefix     string        `env:"EXPORT_PREFIX" envDefault:"leo-lambda/"`
+	StatusBucket     string        `env:"STATUS_BUCKET"`
+	StatusPrefix     string        `env:"STATUS_PREFIX"`
+	StatusRecent     int           `env:"STATUS_RECENT" envDefault:"20"`
+	ManifestResults  string        `env:"MANIFEST_RESULTS_PREFIX"`
+	BreakerThreshold int           `env:"BREAKER_FAILURE_THRESHOLD"`
+	BreakerCooldown  time.Duration `env:"BREAKER_COOLDOWN" envDefault:"30s"`
+
+	transformRules []transform.Rule
+	networks       network.Presets
+	invokePresets  request.Presets
+	schedules      []schedule.Schedule
+	maintenance    []maintenance.Window
+	messages       i18n.Catalog
+	feePayers      map[string]string
+	retry          executor.RetryPolicy
+	stderrRules    classify.Rules
+	deadlineFlags  executor.DeadlineFlags
+	bulkheadLimits map[string]bulkhead.Limits
+	hmacClients    hmacauth.Clients
+	jwt            *jwtauth.Verifier
+	policy         *policy.Policy
+	allowedRules   allowlist.Rules
+	shadowPolicy   *policy.Policy
+	shadowRules    allowlist.Rules
+	invites        invite.Store
+	signedURLs     signedurl.Counter
+	store          store.Store
+	sharedQuota    quota.Shared
+	prover         *prover.Client
+	workers        *worker.Queue
+	signer         signing.Signer
+	alertSinks     []alert.Sink
+	allowlist      allowlist.Store
+	profiles       profile.Set
+	s3             *awsapi.Client
+	sns            *awsapi.Client
+	// contractCounter shares CONTRACT_DAILY_LIMITS counts; nil counts per container.
+	contractCounter contractquota.Counter
+	contractLimits  contractquota.Limits
+	// rollups keeps ROLLUP_TABLE per-contract daily rollups; nil keeps none.
+	rollups *rollup.Store
 }
 
 func loadEnvConfig() (*EnvConfig, error) {
 	c := new(EnvConfig)
-	return c, env.Parse(c)
+	environ, err := configEnviron()
+	if err != nil {
+		return c, err
+	}
+	if err := env.ParseWithOptions(c, env.Options{Environment: env.ToMap(environ)}); err != nil {
+		return c, err
+	}
+	rules, err := transform.ParseRules(c.TransformRules)
+	if err != nil {
+		return c, err
+	}
+	c.transformRules = rules
+	if c.networks, err = network.ParsePresets(c.Networks); err != nil {
+		return c, err
+	}
+	if c.invokePresets, err = request.ParsePresets(c.InvokePresets); err != nil {
+		return c, err
+	}
+	if c.FeePayers != "" {
+		var payers map[string]string
+		if err := json.Unmarshal([]byte(c.FeePayers), &payers); err != nil {
+			return c, fmt.Errorf("invalid FEE_PAYERS: %w", err)
+		}
+		c.feePayers = make(map[string]string, len(payers))
+		for contract, key := range payers {
+			c.feePayers[strings.ToLower(contract)] = key
+		}
+	}
+	if c.messages, err = i18n.Parse(c.ErrorMessages); err != nil {
+		return c, err
+	}
+	if c.maintenance, err = maintenance.Parse(c.Maintenance); err != nil {
+		return c, err
+	}
+	if c.policy, err = policy.Parse("GROUP_CONTRACTS", c.GroupContracts); err != nil {
+		return c, err
+	}
+	if c.shadowPolicy, err = policy.Parse("SHADOW_GROUP_CONTRACTS", c.ShadowGroups); err != nil {
+		return c, err
+	}
+	if err := expandAliases(c, environ); err != nil {
+		return c, err
+	}
+	if c.allowedRules, err = allowlist.ParseRules(c.AllowedContracts); err != nil {
+		return c, fmt.Errorf("invalid ALLOWED_CONTRACTS: %w", err)
+	}
+	if c.shadowRules, err = allowlist.ParseRules(c.ShadowContracts); err != nil {
+		return c, fmt.Errorf("invalid SHADOW_ALLOWED_CONTRACTS: %w", err)
+	}
+	if c.schedules, err = schedule.Parse(c.Schedules); err != nil {
+		return c, err
+	}
+	for _, s := range c.schedules {
+		if _, ok := c.invokePresets[s.Preset]; !ok {
+			return c, fmt.Errorf("invalid SCHEDULES: %s: unknown preset %q", s.Name, s.Preset)
+		}
+	}
+	if probe := workdirFor(c.DefaultWorkdir, "x", "x"); !filepath.IsAbs(probe) || !filepath.IsAbs(c.WorkdirRoot) {
+		return c, fmt.Errorf("WORKDIR %q and WORKDIR_ROOT %q must be absolute", c.DefaultWorkdir, c.WorkdirRoot)
+	} else if rel, err := filepath.Rel(c.WorkdirRoot, probe); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return c, fmt.Errorf("WORKDIR %q is outside WORKDIR_ROOT %q", c.DefaultWorkdir, c.WorkdirRoot)
+	}
+	if c.stderrRules, err = classify.Parse(c.StderrRules); err != nil {
+		return c, err
+	}
+	c.retry = executor.RetryPolicy{
+		MaxAttempts: c.RetryAttempts,
+		ExitCodes:   c.RetryExitCodes,
+		Categories:  c.RetryCategories,
+		Classify:    c.stderrRules.Classify,
+		Backoff:     c.RetryBackoff,
+		MaxBackoff:  c.RetryMaxBackoff,
+	}
+	if c.RetryStderr != "" {
+		if c.retry.StderrPattern, err = regexp.Compile(c.RetryStderr); err != nil {
+			return c, fmt.Errorf("invalid RETRY_STDERR_PATTERN: %w", err)
+		}
+	}
+	if c.deadlineFlags, err = executor.ParseDeadlineFlags(c.DeadlineFlags); err != nil {
+		return c, err
+	}
+	if c.bulkheadLimits, err = bulkhead.Parse(c.Bulkheads); err != nil {
+		return c, err
+	}
+	for name := range c.bulkheadLimits {
+		if name != bulkheadRead && name != bulkheadWrite {
+			return c, fmt.Errorf("invalid BULKHEADS: unknown bulkhead %q (want %q or %q)", name, bulkheadRead, bulkheadWrite)
+		}
+	}
+	if c.hmacClients, err = hmacauth.ParseClients(c.HMACClients); err != nil {
+		return c, err
+	}
+	if c.OIDCIssuer != "" {
+		if c.OIDCAudience == "" {
+			return c, errors.New("OIDC_AUDIENCE is required with OIDC_ISSUER")
+		}
+		c.jwt = &jwtauth.Verifier{Issuer: c.OIDCIssuer, Audience: c.OIDCAudience, JWKSURL: c.OIDCJWKSURL, GroupsClaim: c.OIDCGroupsClaim, Keys: jwks}
+	}
+	if c.LogSampleRate < 0 || c.LogSampleRate > 1 {
+		return c, fmt.Errorf("invalid LOG_SAMPLE_RATE %v (want 0 to 1)", c.LogSampleRate)
+	}
+	if !reqlog.ValidCapture(c.LogCaptureBody) {
+		return c, fmt.Errorf("invalid LOG_CAPTURE_BODY %q (want never, on-error or always)", c.LogCaptureBody)
+	}
+	if c.DedupMode != dedupWarn && c.DedupMode != dedupBlock {
+		return c, fmt.Errorf("invalid DEDUP_MODE %q (want warn or block)", c.DedupMode)
+	}
+	if !slices.Contains([]string{notify.OnAll, notify.OnFailure, notify.OnSuccess}, c.NotifyOn) {
+		return c, fmt.Errorf("invalid NOTIFY_ON %q (want all, failure or success)", c.NotifyOn)
+	}
+	if c.SigningKeyID != "" {
+		aws, err := awsapi.NewFromEnv()
+		if err != nil {
+			return c, fmt.Errorf("response signing: %w", err)
+		}
+		if c.signer, err = signing.NewKMSSigner(aws, c.SigningKeyID, c.SigningAlgorithm); err != nil {
+			return c, fmt.Errorf("response signing: %w", err)
+		}
+	}
+	if c.AlertTopicARN != "" {
+		aws, err := awsapi.NewFromEnv()
+		if err != nil {
+			return c, fmt.Errorf("sns alerts: %w", err)
+		}
+		c.alertSinks = append(c.alertSinks, &alert.SNS{Client: aws, TopicARN: c.AlertTopicARN})
+	}
+	if c.profiles, err = profile.Parse(c.Profiles); err != nil {
+		return c, err
+	}
+	if _, ok := c.profiles[c.DefaultProfile]; c.DefaultProfile != "" && !ok {
+		return c, fmt.Errorf("invalid DEFAULT_PROFILE %q (want %s or %s)", c.DefaultProfile, profile.Fast, profile.Thorough)
+	}
+	if c.OutputBucket != "" || c.ExportBucket != "" || c.StatusBucket != "" {
+		if c.s3, err = awsapi.NewFromEnv(); err != nil {
+			return c, fmt.Errorf("s3: %w", err)
+		}
+	}
+	if c.ResultsTopicARN != "" {
+		if c.sns, err = awsapi.NewFromEnv(); err != nil {
+			return c, fmt.Errorf("sns results: %w", err)
+		}
+	}
+	if c.AllowlistParam != "" {
+		aws, err := awsapi.NewFromEnv()
+		if err != nil {
+			return c, fmt.Errorf("allowlist: %w", err)
+		}
+		if c.allowlist, err = allowlist.NewSSMStore(aws, c.AllowlistParam); err != nil {
+			return c, fmt.Errorf("allowlist: %w", err)
+		}
+	}
+	if c.contractLimits, err = contractquota.Parse(c.ContractLimits); err != nil {
+		return c, err
+	}
+	if c.ContractTable != "" {
+		aws, err := awsapi.NewFromEnv()
+		if err != nil {
+			return c, fmt.Errorf("contract quotas: %w", err)
+		}
+		if c.contractCounter, err = contractquota.NewDynamoCounter(aws, c.ContractTable); err != nil {
+			return c, fmt.Errorf("contract quotas: %w", err)
+		}
+	}
+	if c.RollupTable != "" {
+		aws, err := awsapi.NewFromEnv()
+		if err != nil {
+			return c, fmt.Errorf("rollups: %w", err)
+		}
+		if c.rollups, err = rollup.NewStore(aws, c.RollupTable, days(c.RollupDays)); err != nil {
+			return c, fmt.Errorf("rollups: %w", err)
+		}
+	}
+	if c.InviteTable != "" {
+		aws, err := awsapi.NewFromEnv()
+		if err != nil {
+			return c, fmt.Errorf("invitations: %w", err)
+		}
+		if c.invites, err = invite.NewDynamoStore(aws, c.InviteTable); err != nil {
+			return c, fmt.Errorf("invitations: %w", err)
+		}
+	}
+	if c.SignedURLSecret != "" || c.SignedURLTable != "" {
+		if c.SignedURLSecret == "" || c.SignedURLTable == "" {
+			return c, errors.New("SIGNED_URL_SECRET and SIGNED_URL_TABLE must be set together")
+		}
+		aws, err := awsapi.NewFromEnv()
+		if err != nil {
+			return c, fmt.Errorf("signed URLs: %w", err)
+		}
+		if c.signedURLs, err = signedurl.NewDynamoCounter(aws, c.SignedURLTable); err != nil {
+			return c, fmt.Errorf("signed URLs: %w", err)
+		}
+	}
+	if c.RedisURL != "" {
+		client, err := redis.New(c.RedisURL)
+		if err != nil {
+			return c, err
+		}
+		c.sharedQuota = quota.NewRedis(client, "leo:quota:")
+	}
+	if c.ProverURL != "" {
+		if c.prover, err = prover.New(c.ProverURL, c.ProverToken, c.ProverContracts); err != nil {
+			return c, err
+		}
+	}
+	if c.Store != "" {
+		if c.store, err = store.Open(c.Store, awsapi.NewFromEnv); err != nil {
+			return c, err
+		}
+	}
+	if c.WorkerQueueURL != "" {
+		if c.WorkerSecret == "" || c.store == nil {
+			return c, errors.New("WORKER_QUEUE_URL needs WORKER_CALLBACK_SECRET and STORE")
+		}
+		aws, err := awsapi.NewFromEnv()
+		if err != nil {
+			return c, fmt.Errorf("worker queue: %w", err)
+		}
+		c.workers = worker.NewQueue(aws, c.WorkerQueueURL, c.WorkerSecret, c.WorkerContracts)
+	}
+	if c.PagerDutyKey != "" {
+		c.alertSinks = append(c.alertSinks, &alert.PagerDuty{RoutingKey: c.PagerDutyKey, URL: c.PagerDutyURL, Source: cmp.Or(os.Getenv("AWS_LAMBDA_FUNCTION_NAME"), "leo-lambda")})
+	}
+	return c, nil
 }
 
+// expandAliases replaces @name entries of the contract lists in c with the contracts
+// of the GROUP_<name> variable in environ.
+func expandAliases(c *EnvConfig, environ []string) error {
+	groups, err := alias.FromEnv(environ)
+	if err != nil {
+		return err
+	}
+	lists := []struct {
+		name string
+		list *[]string
+	}{
+		{"ALLOWED_CONTRACTS", &c.AllowedContracts},
+		{"SHADOW_ALLOWED_CONTRACTS", &c.ShadowContracts},
+		{"RECEIPT_CONTRACTS", &c.ReceiptContracts},
+		{"NOTIFY_CONTRACTS", &c.NotifyContracts},
+		{"PROVER_CONTRACTS", &c.ProverContracts},
+		{"WORKER_CONTRACTS", &c.WorkerContracts},
+	}
+	for _, l := range lists {
+		if *l.list, err = groups.Expand(*l.list); err != nil {
+			return fmt.Errorf("invalid %s: %w", l.name, err)
+		}
+	}
+	for name, p := range map[string]*policy.Policy{"GROUP_CONTRACTS": c.policy, "SHADOW_GROUP_CONTRACTS": c.shadowPolicy} {
+		if p == nil {
+			continue
+		}
+		for g, contracts := range p.Groups {
+			if p.Groups[g], err = groups.Expand(contracts); err != nil {
+				return fmt.Errorf("invalid %s: %s: %w", name, g, err)
+			}
+		}
+	}
+	for i, w := range c.maintenance {
+		if c.maintenance[i].Contracts, err = groups.Expand(w.Contracts); err != nil {
+			return fmt.Errorf("invalid MAINTENANCE_WINDOWS: %s: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *EnvConfig) journal() *journal.Journal {
+	return &journal.Journal{Dir: c.JournalDir, OutputBytes: c.JournalOutput, SyncInterval: c.JournalSync, Retention: days(c.JournalDays)}
+}
+
+// beginRecord starts the journal record of a run of args for who. Journal failures must
+// never fail the run itself; Begin returns a no-op record.
+func beginRecord(ctx context.Context, cfgEnv *EnvConfig, who principal, args []string, sum string, tags map[string]string, allowedBy string) *journal.Record {
+	rec, _ := cfgEnv.journal().Begin(invocationID(ctx), who.id, who.authKey, utils.RedactFlagValues(args, utils.SecretFlags...), sum, tags)
+	rec.InJob(jobs.ID(ctx))
+	if allowedBy != "" {
+		rec.Allowed(allowedBy)
+	}
+	return rec
+}
+
+// retryFor is the RETRY_* policy for subcmd. Only read commands get it: a failed
+// execute may already have broadcast its transaction, so it never runs twice.
+func (c *EnvConfig) retryFor(subcmd string) executor.RetryPolicy {
+	if slices.Contains(c.ReadCommands, subcmd) {
+		return c.retry
+	}
+	return executor.RetryPolicy{}
+}
+
+// jobTTL is how long finished job records are kept in STORE.
+func (c *EnvConfig) jobTTL() time.Duration {
+	if c.JobDays > 0 {
+		return days(c.JobDays)
+	}
+	return jobRetention
+}
+
+func (c *EnvConfig) cors() cors.Config {
+	return cors.Config{
+		Origins:     c.CORSOrigins,
+		Methods:     c.CORSMethods,
+		Headers:     c.CORSHeaders,
+		Expose:      []string{signing.HeaderSignature, signing.HeaderKeyID, signing.HeaderAlgorithm, "Retry-After", "Location"},
+		Credentials: c.CORSCredentials,
+		MaxAge:      c.CORSMaxAge,
+	}
+}
+
+func (c *EnvConfig) requestLog() *reqlog.Logger {
+	return &reqlog.Logger{Out: logOutput, SampleRate: c.LogSampleRate, Capture: c.LogCaptureBody}
+}
+
+func (c *EnvConfig) usage() *usage.Store {
+	return &usage.Store{Dir: c.UsageDir}
+}
+
+func (c *EnvConfig) notifier() *notify.Notifier {
+	notifyLimiter.SetLimits(quota.Limits{RatePerMinute: c.NotifyPerMinute})
+	return &notify.Notifier{
+		SlackWebhook:   c.SlackWebhook,
+		DiscordWebhook: c.DiscordWebhook,
+		Filter:         notify.Filter{On: c.NotifyOn, Commands: c.NotifyCommands, Contracts: c.NotifyContracts},
+		Limiter:        notifyLimiter,
+	}
+}
+
+func (c *EnvConfig) quotaLimits() quota.Limits {
+	return quota.Limits{RatePerMinute: c.RateLimit, DailySpend: c.DailySpendLimit, MaxConcurrent: c.MaxConcurrent}
+}
+
+// warm is the container-scoped state shared across invocations; warm.Reset()
+// invalidates all of it.
+var warm = state.New()
+
 var (
-	cachedCfg  *EnvConfig
-	leoVersion string
+	configState = state.Register(warm, "config", state.NewValue(loadEnvConfig))
+	leoVersion  = state.Register(warm, "leoVersion", state.NewValue(utils.GetLeoVersion))
+	quotas      = state.Register(warm, "quotas", quota.New(quota.Limits{}))
+	health      = state.Register(warm, "endpointHealth", state.NewHealth())
+	// bulkheads keeps read and write runs from taking each other's capacity.
+	bulkheads = state.Register(warm, "bulkheads", bulkhead.New())
+	// notifyLimiter caps webhook messages per container.
+	notifyLimiter = state.Register(warm, "notifyLimiter", quota.New(quota.Limits{}))
+	// failureStreaks counts consecutive failed executions per contract for alerting.
+	failureStreaks = state.Register(warm, "failureStreaks", alert.NewDetector(0))
+	// contractCounts counts CONTRACT_DAILY_LIMITS executes without CONTRACT_QUOTA_TABLE,
+	// or while it fails.
+	contractCounts = state.Register(warm, "contractCounts", contractquota.NewMemory())
+	// sizeMetrics keeps the last 500 input/output sizes per command and contract.
+	sizeMetrics = state.Register(warm, "sizeMetrics", metrics.NewRecorder(500))
+	// runtimeAllowlist caches contracts added through the allowlist action so other
+	// containers pick up changes within a minute.
+	runtimeAllowlist = state.Register(warm, "allowlist", state.NewCache[[]string](time.Minute))
+	// secrets and responses are shared TTL caches for secret lookups and reusable results.
+	secrets   = state.Register(warm, "secrets", state.NewCache[string](15*time.Minute))
+	responses = state.Register(warm, "responses", state.NewCache[[]byte](responseTTL))
+	// chainIDs caches the network ID each endpoint reports, keyed by endpoint and network.
+	chainIDs = state.Register(warm, "chainIDs", state.NewCache[uint16](time.Hour))
+	// chainVars caches the chain state preset variables read, for CHAIN_VAR_TTL.
+	chainVars = state.Register(warm, "chainVars", chainvars.New())
+	// programABIs caches parsed program ABIs, keyed by endpoint, network and program.
+	programABIs = state.Register(warm, "abis", state.NewCache[*abi.ABI](time.Hour))
+	// broadcasts remembers successful execute broadcasts by fingerprint for DEDUP_WINDOW,
+	// which is checked against their time.
+	broadcasts = state.Register(warm, "broadcasts", state.NewCache[broadcastRecord](0))
+	// scheduleRuns prevents overlapping SCHEDULES runs and keeps the last 20 per schedule.
+	scheduleRuns = state.Register(warm, "scheduleRuns", schedule.NewTracker(20))
+	// jwks caches the OIDC issuer's signing keys.
+	jwks = state.Register(warm, "jwks", jwtauth.NewKeyCache(time.Hour))
+	// sealedConfig holds the decrypted SEALED_CONFIG, so KMS is called once per container
+	// even with CONFIG_RELOAD_EACH_INVOCATION.
+	sealedConfig = state.Register(warm, "sealedConfig", state.NewValue(openSealedConfig))
+	// metricsOut receives EMF lines; Lambda forwards stdout to CloudWatch Logs.
+	metricsOut io.Writer = os.Stdout
+	// logOutput receives request log lines and panic reports.
+	logOutput io.Writer = os.Stdout
+	// defaultMessages localizes errors when the configuration itself is invalid.
+	defaultMessages = i18n.Default()
+	// runCommand executes leo; benchmarks and tests replace it with a fake runner.
+	runCommand = executor.Run
+	// clk and rng drive schedules, retry backoff, DEDUP_WINDOW, signed URL expiry and
+	// generated IDs; tests replace them with a clock.Fake and a clock.Seeded.
+	clk clock.Clock = clock.System
+	rng clock.RNG   = clock.Crypto
+	// jobRegistry holds runs that outlived their request's maxWaitSeconds.
+	jobRegistry = jobs.New(jobRetention)
 )
 
-func init() {
-	// Parse env once on cold start for performance in Lambda
-	if c, err := loadEnvConfig(); err == nil {
-		cachedCfg = c
-		leoVersion, err = utils.GetLeoVersion()
-		if err != nil {
-			panic(fmt.Sprintf("failed to get leo version: %v", err))
-		}
+// configEnviron returns the process environment with the variables of SEALED_CONFIG
+// that it does not set itself.
+func configEnviron() ([]string, error) {
+	vars, err := sealedConfig.Get()
+	if err != nil {
+		return nil, err
 	}
+	return sealed.Merge(os.Environ(), vars), nil
+}
+
+// openSealedConfig decrypts SEALED_CONFIG; without it there is nothing to add.
+func openSealedConfig() (map[string]string, error) {
+	blob := os.Getenv(sealed.Var)
+	if blob == "" {
+		return nil, nil
+	}
+	aws, err := awsapi.NewFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("sealed config: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return sealed.Open(ctx, aws, blob)
 }
 
 // currentConfig returns either the cached config (default) or a freshly parsed
@@ -66,58 +691,484 @@ func currentConfig() (*EnvConfig, error) {
 	if os.Getenv("CONFIG_RELOAD_EACH_INVOCATION") == "1" {
 		return loadEnvConfig()
 	}
-	if cachedCfg != nil {
-		return cachedCfg, nil
+	return configState.Get()
+}
+
+func handler(ctx context.Context, req events.LambdaFunctionURLRequest) (resp events.LambdaFunctionURLResponse, err error) {
+	start := time.Now()
+	cfgEnv, cfgErr := currentConfig()
+	if cfgErr == nil {
+		defer func() { logRequest(ctx, cfgEnv, req, resp, time.Since(start)) }()
+	}
+	origin := utils.HeaderValue(req.Headers, "Origin")
+	// Browsers send preflights without credentials, so answer them before authenticating.
+	if cfgErr == nil && cfgEnv.cors().Enabled() && req.RequestContext.HTTP.Method == http.MethodOptions {
+		headers, ok := cfgEnv.cors().Preflight(origin, utils.HeaderValue(req.Headers, "Access-Control-Request-Method"))
+		status := http.StatusNoContent
+		if !ok {
+			status = http.StatusForbidden
+		}
+		return events.LambdaFunctionURLResponse{StatusCode: status, Headers: headers}, nil
+	}
+	resp, err = handleRecovered(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	catalog := defaultMessages
+	if cfgErr == nil {
+		catalog = cfgEnv.messages
+	}
+	resp = localize(resp, catalog, utils.HeaderValue(req.Headers, "Accept-Language"))
+	if mixed.Accepts(utils.HeaderValue(req.Headers, "Accept")) {
+		resp = mixedResp(resp)
+	}
+	if cfgErr == nil && cfgEnv.signer != nil {
+		resp = signResponse(ctx, cfgEnv.signer, resp)
+	}
+	if cfgErr == nil && cfgEnv.cors().Enabled() {
+		if resp.Headers == nil {
+			resp.Headers = map[string]string{}
+		}
+		cfgEnv.cors().Apply(resp.Headers, origin)
+	}
+	return resp, nil
+}
+
+// handleRecovered runs handle, turning a panic into a structured 500 that carries an
+// incident ID. The stack trace is logged under the same ID and a Panics metric is
+// emitted when METRICS_NAMESPACE is set.
+func handleRecovered(ctx context.Context, req events.LambdaFunctionURLRequest) (resp events.LambdaFunctionURLResponse, err error) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		incident := randomID()
+		report, _ := json.Marshal(map[string]string{
+			"level":      "panic",
+			"incidentId": incident,
+			"requestId":  invocationID(ctx),
+			"panic":      fmt.Sprint(v),
+			"stack":      string(debug.Stack()),
+		})
+		_, _ = logOutput.Write(append(report, '\n'))
+		if cfgEnv, cfgErr := currentConfig(); cfgErr == nil && cfgEnv.MetricsNamespace != "" {
+			_ = metrics.WriteCount(metricsOut, cfgEnv.MetricsNamespace, metrics.Panics, time.Now())
+		}
+		body := codedError(i18n.InternalError, "internal error", nil)
+		body["incidentId"] = incident
+		resp, err = jsonResp(http.StatusInternalServerError, body), nil
+	}()
+	return handle(ctx, req)
+}
+
+// randomID returns 16 random hex characters.
+func randomID() string {
+	return clock.Hex(rng, 8)
+}
+
+// days converts a *_RETENTION_DAYS setting; zero and below mean no retention limit.
+func days(n int) time.Duration {
+	return time.Duration(max(n, 0)) * 24 * time.Hour
+}
+
+// workdirFor expands the WORKDIR template for one request. {requestId} and {tenant},
+// the caller identity, are reduced to letters, digits, '.', '_' and '-' so neither can
+// add path elements.
+func workdirFor(tmpl, requestID, tenant string) string {
+	clean := func(v string) string {
+		v = strings.Map(func(r rune) rune {
+			if r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-", r)) {
+				return r
+			}
+			return '_'
+		}, v)
+		if v == "" || v == "." || v == ".." {
+			return "_"
+		}
+		return v
+	}
+	return filepath.Clean(strings.NewReplacer("{requestId}", clean(requestID), "{tenant}", clean(tenant)).Replace(tmpl))
+}
+
+// logRequest writes the request log line. Captured payloads hold the request with
+// secret flag values redacted and, for the response, only the error or stderr, since
+// stdout may carry records.
+func logRequest(ctx context.Context, cfgEnv *EnvConfig, req events.LambdaFunctionURLRequest, resp events.LambdaFunctionURLResponse, d time.Duration) {
+	var out struct {
+		Error    string `json:"error"`
+		ExitCode *int   `json:"exitCode"`
+		Stderr   string `json:"stderr"`
+	}
+	switch ct := resp.Headers["Content-Type"]; {
+	case strings.HasPrefix(ct, "application/json"):
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+	case strings.HasPrefix(ct, mixed.MediaType):
+		if p, err := mixed.Decode(ct, []byte(resp.Body)); err == nil {
+			_ = json.Unmarshal(p.Meta, &out)
+			out.Stderr = string(p.Stderr)
+		}
+	}
+	e := reqlog.Entry{
+		Time:       time.Now().UTC(),
+		RequestID:  invocationID(ctx),
+		Caller:     utils.CallerIdentity(req),
+		Method:     req.RequestContext.HTTP.Method,
+		Path:       utils.RequestPath(req),
+		Status:     resp.StatusCode,
+		ExitCode:   out.ExitCode,
+		DurationMs: d.Milliseconds(),
+		Failed:     resp.StatusCode >= 400 || (out.ExitCode != nil && *out.ExitCode != 0),
+	}
+	cfgEnv.requestLog().Log(e, func() (any, string) {
+		var captured any
+		if body, args, err := request.Parse(req, cfgEnv.invokePresets); err != nil {
+			captured = map[string]any{"invalid": err.Error(), "bytes": len(req.Body)}
+		} else if body.Action != "" {
+			captured = map[string]any{"action": body.Action}
+		} else {
+			captured = map[string]any{"args": utils.RedactFlagValues(args, utils.SecretFlags...), "tags": body.Tags}
+		}
+		msg := cmp.Or(out.Error, out.Stderr)
+		if len(msg) > logCaptureBytes {
+			msg = msg[len(msg)-logCaptureBytes:]
+		}
+		return captured, msg
+	})
+}
+
+// logCaptureBytes is how much trailing error output a captured log line keeps.
+const logCaptureBytes = 2048
+
+// logWarn writes a "level": "warn" line for a degraded but still served request.
+func logWarn(msg string, fields map[string]string) {
+	e := map[string]string{"level": "warn", "msg": msg}
+	maps.Copy(e, fields)
+	line, _ := json.Marshal(e)
+	_, _ = logOutput.Write(append(line, '\n'))
+}
+
+// principal is the authenticated caller.
+type principal struct {
+	// id identifies the caller for quotas, jobs and the journal.
+	id string
+	// authKey is the HMAC secret ("primary" or "secondary") that matched, if any.
+	authKey string
+	// groups are the OIDC group claims of a bearer-token caller.
+	groups []string
+	// invitation is the invitation token presented, consumed once the transition is known.
+	invitation string
+	// signedURL holds the claims of a signed URL, whose use is counted before the run.
+	signedURL *signedurl.Claims
+}
+
+// authenticate identifies the caller. Callers authenticated with AWS_IAM are trusted
+// as is. Otherwise, once OIDC_ISSUER or HMAC_CLIENTS is set, a valid bearer token or
+// HMAC signature is required. An invitation token is accepted in its place when
+// INVITE_TABLE is set; it is checked against the table later, in handle. So is a signed
+// URL once SIGNED_URL_SECRET is set, which is verified here and counted in handle.
+// Requests the function makes to itself, such as scheduled runs, carry their caller in
+// ctx.
+func authenticate(ctx context.Context, cfgEnv *EnvConfig, req events.LambdaFunctionURLRequest) (principal, error) {
+	if id, ok := ctx.Value(internalCaller{}).(string); ok {
+		return principal{id: id}, nil
+	}
+	if p, ok := ctx.Value(gatewayCaller{}).(principal); ok {
+		return p, nil
+	}
+	p := principal{id: utils.CallerIdentity(req)}
+	if strings.HasPrefix(p.id, "iam:") {
+		return p, nil
+	}
+	if q, _ := url.ParseQuery(req.RawQueryString); q.Has(signedurl.Param) && cfgEnv.signedURLs != nil {
+		c, err := signedurl.Verify(cfgEnv.SignedURLSecret, q.Get(signedurl.Param), req.RequestContext.HTTP.Method, utils.RequestPath(req), q.Get("preset"), time.Now())
+		if err != nil {
+			return p, err
+		}
+		p.id, p.signedURL = "url:"+c.ID, &c
+		return p, nil
+	}
+	if token := utils.HeaderValue(req.Headers, invite.Header); token != "" && cfgEnv.invites != nil {
+		p.id, p.invitation = "invite:"+invite.ID(token)[:16], token
+		return p, nil
+	}
+	if cfgEnv.jwt == nil && len(cfgEnv.hmacClients) == 0 {
+		return p, nil
+	}
+	if token, ok := strings.CutPrefix(utils.HeaderValue(req.Headers, "Authorization"), "Bearer "); ok && cfgEnv.jwt != nil {
+		claims, err := cfgEnv.jwt.Verify(ctx, strings.TrimSpace(token))
+		if err != nil {
+			return p, err
+		}
+		p.id, p.groups = "jwt:"+claims.Subject, claims.Groups
+		return p, nil
+	}
+	if len(cfgEnv.hmacClients) == 0 {
+		return p, errors.New("missing bearer token")
+	}
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		dec, err := utils.DecodeBase64(req.Body)
+		if err != nil {
+			return p, fmt.Errorf("invalid base64 body: %w", err)
+		}
+		body = dec
+	}
+	client, key, err := cfgEnv.hmacClients.Verify(req.Headers, req.RequestContext.HTTP.Method, utils.RequestPath(req), req.RawQueryString, body, time.Now())
+	if err != nil {
+		return p, err
+	}
+	p.id, p.authKey = "hmac:"+client, key
+	return p, nil
+}
+
+// signResponse attaches a detached signature over the body. Signing failures fail closed
+// so consumers relying on signatures never receive an unsigned result.
+func signResponse(ctx context.Context, s signing.Signer, resp events.LambdaFunctionURLResponse) events.LambdaFunctionURLResponse {
+	sig, err := s.Sign(ctx, []byte(resp.Body))
+	if err != nil {
+		return jsonResp(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to sign response: %v", err)})
 	}
-	return loadEnvConfig()
+	resp.Headers[signing.HeaderSignature] = base64.StdEncoding.EncodeToString(sig)
+	resp.Headers[signing.HeaderKeyID] = s.KeyID()
+	resp.Headers[signing.HeaderAlgorithm] = s.Algorithm()
+	return resp
 }
 
-func handler(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+func handle(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
 	cfgEnv, cfgErr := currentConfig()
 	if cfgErr != nil {
-		return jsonResp(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("invalid env config: %v", cfgErr)}), nil
+		return jsonResp(http.StatusInternalServerError, codedError(i18n.InternalError, fmt.Sprintf("invalid env config: %v", cfgErr), nil)), nil
+	}
+
+	count := invocations.Add(1)
+	var diag map[string]string
+	if cfgEnv.DebugMeta {
+		diag = containerDiagnostics(ctx, count)
+	}
+
+	// Workers authenticate their callback with the job's token rather than as a caller.
+	if id, ok := workerResultPath(req); ok && cfgEnv.workers != nil {
+		return workerCallback(ctx, cfgEnv, req, id), nil
+	}
+
+	who, authErr := authenticate(ctx, cfgEnv, req)
+	if authErr != nil {
+		return jsonResp(http.StatusUnauthorized, codedError(i18n.Unauthorized, authErr.Error(), nil)), nil
+	}
+	caller := who.id
+	if who.signedURL != nil {
+		// The signature is not part of the invocation; leaving it would make it a preset parameter.
+		req.RawQueryString = signedurl.Strip(req.RawQueryString)
+	}
+	quotas.SetLimits(cfgEnv.quotaLimits())
+	bulkheads.SetLimits(cfgEnv.bulkheadLimits)
+	chainVars.Configure(cfgEnv.ChainVarTTL, cfgEnv.ChainVarStale, clk)
+	quotas.SetShared(cfgEnv.sharedQuota, func(err error) {
+		logWarn("shared quota unavailable, using local counters", map[string]string{"error": err.Error()})
+		if cfgEnv.MetricsNamespace != "" {
+			_ = metrics.WriteCount(metricsOut, cfgEnv.MetricsNamespace, metrics.QuotaFallback, time.Now())
+		}
+	})
+	jobRegistry.SetConcurrency(cfgEnv.JobConcurrency)
+	if req.RequestContext.HTTP.Method == http.MethodGet && utils.RequestPath(req) == "/quota" {
+		return jsonResp(http.StatusOK, quotas.Snapshot(caller)), nil
+	}
+	if req.RequestContext.HTTP.Method == http.MethodGet && utils.RequestPath(req) == "/capabilities" {
+		return capabilitiesResp(ctx, cfgEnv), nil
+	}
+	if req.RequestContext.HTTP.Method == http.MethodGet && utils.RequestPath(req) == "/stats" {
+		return statsResp(ctx, cfgEnv, req.RawQueryString), nil
+	}
+	if req.RequestContext.HTTP.Method == http.MethodGet && utils.RequestPath(req) == "/jobs" {
+		q, _ := url.ParseQuery(req.RawQueryString)
+		want, err := tags.Parse(q["tag"])
+		if err != nil {
+			return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, err.Error(), nil)), nil
+		}
+		return jsonResp(http.StatusOK, map[string]any{"jobs": jobRegistry.List(caller, want)}), nil
+	}
+	if id, ok := strings.CutPrefix(utils.RequestPath(req), "/jobs/"); ok && req.RequestContext.HTTP.Method == http.MethodGet {
+		job, found := jobRegistry.Get(id, caller)
+		if !found {
+			job, found = storedJob(ctx, cfgEnv, id, caller)
+		}
+		if !found {
+			return jsonResp(http.StatusNotFound, codedError(i18n.JobNotFound, fmt.Sprintf("job %q not found", id), map[string]string{"job": id})), nil
+		}
+		return jsonResp(http.StatusOK, job), nil
+	}
+	if id, ok := resumeJobPath(req); ok && cfgEnv.store != nil {
+		return resumeJob(ctx, cfgEnv, caller, id), nil
 	}
 
-	args, err := utils.ParseArgs(req)
+	body, args, err := request.Parse(req, cfgEnv.invokePresets)
 	if err != nil {
-		return jsonResp(http.StatusBadRequest, map[string]string{"error": err.Error()}), nil
+		var verr *schema.ValidationError
+		if errors.As(err, &verr) {
+			return jsonResp(http.StatusBadRequest, withFields(codedError(i18n.InvalidRequest, "invalid request body", nil), verr)), nil
+		}
+		if errors.Is(err, request.ErrUnsupportedMediaType) {
+			return jsonResp(http.StatusUnsupportedMediaType, codedError(i18n.UnsupportedMedia, err.Error(), nil)), nil
+		}
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, err.Error(), nil)), nil
+	}
+	if body.Action != "" {
+		if who.invitation != "" || who.signedURL != nil {
+			return jsonResp(http.StatusForbidden, codedError(i18n.ActionNotAllowed, "invitation tokens and signed URLs cannot invoke actions", nil)), nil
+		}
+		return handleAction(ctx, req, cfgEnv, who, body), nil
 	}
 
 	subcmd, subErr := utils.FirstSubcommand(args)
 	if subErr != nil {
-		return jsonResp(http.StatusBadRequest, map[string]string{"error": subErr.Error()}), nil
+		return jsonResp(http.StatusBadRequest, codedError(i18n.MissingCommand, subErr.Error(), nil)), nil
+	}
+	if who.invitation != "" && subcmd != "execute" {
+		return jsonResp(http.StatusForbidden, codedError(i18n.CommandNotAllowed, "invitation tokens only cover execute", map[string]string{"command": subcmd})), nil
+	}
+
+	// Operator-defined rules may rewrite or reject the request before any policy is applied.
+	if len(cfgEnv.transformRules) > 0 {
+		args, err = transform.Apply(cfgEnv.transformRules, transform.Input{Args: args, Subcommand: subcmd, Headers: req.Headers, Stage: stageVars(ctx)})
+		if err != nil {
+			if transform.IsReject(err) {
+				return jsonResp(http.StatusForbidden, codedError(i18n.RequestRejected, err.Error(), nil)), nil
+			}
+			return jsonResp(http.StatusInternalServerError, codedError(i18n.InternalError, err.Error(), nil)), nil
+		}
 	}
 	// Only enforce allowlist when a subcommand token exists; allow global flag-only invocations (e.g., --version)
 	if subcmd != "" && len(cfgEnv.AllowedCommands) > 0 {
 		if !slices.ContainsFunc(cfgEnv.AllowedCommands, func(s string) bool {
 			return strings.EqualFold(strings.TrimSpace(s), subcmd)
 		}) {
-			return jsonResp(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("command %q not allowed", subcmd)}), nil
+			return jsonResp(http.StatusForbidden, codedError(i18n.CommandNotAllowed, fmt.Sprintf("command %q not allowed", subcmd), map[string]string{"command": subcmd})), nil
 		}
 	}
 
-	switch subcmd {
-	case "execute":
-		// Enforce contracts allowlist when provided (empty => allow all)
-		// Inject RPC endpoint if provided via config and not present in args yet.
-		if strings.TrimSpace(cfgEnv.EndPoint) != "" && !utils.HasAnyFlag(args, "--endpoint") {
-			args = utils.InjectFlagValueAfterSubcommand(args, subcmd, "--endpoint", cfgEnv.EndPoint)
+	// A known --network selects its preset endpoint unless the caller pinned one.
+	preset, hasPreset := cfgEnv.networks.Lookup(utils.GetFlagValue(args, "--network"))
+	if hasPreset && !utils.HasAnyFlag(args, "--endpoint") {
+		args = utils.InjectFlagValueAfterSubcommand(args, subcmd, "--endpoint", preset.Endpoint)
+	}
+	// Chain variables in a preset are read before the execute policies run, so the
+	// contract allowlist, input validation and deduplication see the values sent.
+	var staleChainState bool
+	if q, _ := url.ParseQuery(req.RawQueryString); q.Has("preset") && chainvars.Has(args) {
+		endpoint := cmp.Or(utils.GetFlagValue(args, "--endpoint"), cfgEnv.EndPoint)
+		resolved, stale, failed := resolveChainVars(ctx, cfgEnv, args, endpoint, utils.GetFlagValue(args, "--network"))
+		if failed != nil {
+			return *failed, nil
 		}
-		if len(cfgEnv.AllowedContracts) > 0 {
-			if contract, _ := utils.ExtractExecuteContract(args); contract != "" {
-				if !slices.Contains(cfgEnv.AllowedContracts, contract) {
-					return jsonResp(http.StatusForbidden, map[string]string{"error": fmt.Sprintf("contract %q not allowed", contract)}), nil
-				}
-			} else {
-				return jsonResp(http.StatusBadRequest, map[string]string{"error": "missing execute contract/method argument"}), nil
-			}
+		args, staleChainState = resolved, stale
+	}
+
+	if len(body.OnlyIf) > 0 {
+		if verr := checkPreconditions(body.OnlyIf, subcmd, args); verr != nil {
+			return jsonResp(http.StatusBadRequest, withFields(codedError(i18n.InvalidRequest, "invalid onlyIf", nil), verr)), nil
 		}
 	}
 
+	var adm admission
+	if subcmd == "execute" {
+		var refused *events.LambdaFunctionURLResponse
+		if args, adm, refused = admitExecute(ctx, cfgEnv, who, body, args, preset); refused != nil {
+			return *refused, nil
+		}
+	}
+
+	// Read-only commands may be hedged across endpoints; the caller pinning --endpoint opts out.
+	hedge := len(cfgEnv.HedgeEndpoints) > 0 && strings.TrimSpace(cfgEnv.EndPoint) != "" &&
+		slices.Contains(cfgEnv.ReadCommands, subcmd) && !utils.HasAnyFlag(args, "--endpoint")
+
 	// Ensure leo uses this workdir as its home directory unless overridden.
 	// Only inject for execute; global flag-only invocations like --version should remain unchanged.
-	if !utils.HasAnyFlag(args, "--home") {
-		args = utils.InjectFlagValueAfterSubcommand(args, subcmd, "--home", cfgEnv.DefaultWorkdir)
+	workdir := workdirFor(cfgEnv.DefaultWorkdir, cmp.Or(invocationID(ctx), randomID()), caller)
+	if args, err = withHome(cfgEnv, subcmd, args, workdir); err != nil {
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, err.Error(), nil)), nil
+	}
+
+	// Fail fast while the endpoint's circuit is open; hedged runs route around it instead.
+	if ep := utils.GetFlagValue(args, "--endpoint"); !hedge && ep != "" && health.Open(ep, cfgEnv.BreakerThreshold, cfgEnv.BreakerCooldown) {
+		resp := jsonResp(http.StatusServiceUnavailable, codedError(i18n.EndpointUnavailable, fmt.Sprintf("endpoint %s is unavailable (circuit open)", ep), nil))
+		resp.Headers["Retry-After"] = strconv.Itoa(int(cfgEnv.BreakerCooldown.Seconds()))
+		return resp, nil
+	}
+
+	if err := checkNetwork(ctx, cfgEnv, subcmd, args); err != nil {
+		return jsonResp(http.StatusBadRequest, codedError(i18n.NetworkMismatch, err.Error(), map[string]string{"network": utils.GetFlagValue(args, "--network")})), nil
+	}
+
+	// Like an invitation, a signed URL use is spent only once every check has passed.
+	var signedURLUses string
+	if c := who.signedURL; c != nil {
+		var refused *events.LambdaFunctionURLResponse
+		if signedURLUses, refused = useSignedURL(ctx, cfgEnv, *c); refused != nil {
+			return *refused, nil
+		}
+	}
+
+	// Enforce per-caller quotas only once the request is known to be allowed.
+	release, qErr := quotas.Acquire(caller)
+	if qErr != nil {
+		return quotaExceeded(caller, qErr), nil
+	}
+	defer func() {
+		if release != nil {
+			release()
+		}
+	}()
+	// Contract quotas count every execute that gets this far, failed or not, since each
+	// one reaches the upstream node.
+	// Both are given back by refund to a run refused before leo starts, such as by a
+	// full bulkhead, so a client retrying after Retry-After is not charged twice.
+	var contractUses string
+	releaseContract, refundSpend := func() {}, func() {}
+	if subcmd == "execute" && len(cfgEnv.contractLimits) > 0 {
+		contract, _ := utils.ExtractExecuteContract(args)
+		if limit := cfgEnv.contractLimits[contract]; limit > 0 {
+			n, release, err := takeContractQuota(ctx, cfgEnv, contract, limit)
+			if err != nil {
+				return contractQuotaExceeded(contract, limit, clk.Now()), nil
+			}
+			contractUses, releaseContract = fmt.Sprintf("%d/%d", n, limit), release
+		}
+	}
+	fee := priorityFee(args)
+	if fee > 0 {
+		day := quotas.SpendDay()
+		if qErr := quotas.ChargeSpend(caller, fee); qErr != nil {
+			releaseContract()
+			return quotaExceeded(caller, qErr), nil
+		}
+		refundSpend = func() { quotas.RefundSpend(caller, day, fee) }
+	}
+	refund := func() {
+		releaseContract()
+		refundSpend()
+	}
+
+	// The request's profile, else DEFAULT_PROFILE; the zero Profile changes nothing.
+	var prof profile.Profile
+	if name := cmp.Or(body.Profile, cfgEnv.DefaultProfile); name != "" {
+		prof = cfgEnv.profiles[name]
+	}
+	if len(body.Expect) > 0 {
+		c, _ := utils.ExtractExecuteContract(args)
+		queued := cfgEnv.workers != nil && !cfgEnv.DryRun && cfgEnv.workers.Applies(c)
+		if verr := checkExpectations(body.Expect, subcmd, prof.WaitConfirmation, queued); verr != nil {
+			refund()
+			return jsonResp(http.StatusBadRequest, withFields(codedError(i18n.InvalidExpect, "invalid expect", nil), verr)), nil
+		}
+	}
+	cacheKey := ""
+	if prof.Cache && slices.Contains(cfgEnv.ReadCommands, subcmd) {
+		cacheKey = fingerprint.Of(args)
+		if cached, ok := cachedResponse(ctx, cfgEnv, cacheKey); ok {
+			resp := events.LambdaFunctionURLResponse{StatusCode: http.StatusOK, Headers: map[string]string{"Content-Type": "application/json", "X-Leo-Cache": "hit"}, Body: string(cached)}
+			return resp, nil
+		}
 	}
 
 	// Determine binary path
@@ -128,18 +1179,464 @@ func handler(ctx context.Context, req events.LambdaFunctionURLRequest) (events.L
 		bin = "echo"
 	}
 
-	cfg := executor.Config{
-		BinPath:        bin,
-		Args:           args,
-		WorkDir:        cfgEnv.DefaultWorkdir,
-		MaxOutputBytes: cfgEnv.MaxOutputBytes,
+	// sum identifies the request independent of flag order and spelling.
+	sum := fingerprint.Of(args)
+
+	// statsKey groups runs for job duration estimates: the contract, else the command.
+	contract, _ := utils.ExtractExecuteContract(args)
+	statsKey := cmp.Or(contract, subcmd)
+	debug := wantsDebug(req, cfgEnv)
+
+	// run executes the command and builds the response; it is shared by the synchronous
+	// path and by jobs that outlive maxWaitSeconds.
+	run := func(ctx context.Context, stdout, stderr io.Writer) Response {
+		// Stages below draw on one budget: leo is stopped early enough to leave
+		// TIME_RESERVE for post-processing and encoding the response.
+		offload := prof.Output == profile.OutputFull && cfgEnv.OutputBucket != ""
+		b := budget.Budget{Reserve: cfgEnv.TimeReserve, OutputBytes: cfgEnv.outputCap(offload)}
+		if sq := quotas.Snapshot(caller).Spend; sq != nil {
+			b.Spend, b.SpendLimited = sq.Remaining, true
+		}
+		ctx = budget.With(ctx, b)
+		// Per-request workdirs would otherwise fill the container's ephemeral storage.
+		if strings.Contains(cfgEnv.DefaultWorkdir, "{requestId}") {
+			defer os.RemoveAll(workdir)
+		}
+		rec := beginRecord(ctx, cfgEnv, who, args, sum, body.Tags, adm.allowedBy)
+		cfg := executor.Config{
+			BinPath:        bin,
+			Args:           args,
+			WorkDir:        workdir,
+			WorkRoot:       cfgEnv.WorkdirRoot,
+			MaxOutputBytes: cfgEnv.outputCap(offload),
+			OnStart:        rec.Started,
+			PTY:            slices.Contains(cfgEnv.PTYCommands, subcmd),
+			Retry:          cfgEnv.retryFor(subcmd),
+			Clock:          clk,
+			DeadlineFlags:  cfgEnv.deadlineFlags[subcmd],
+		}
+		capture, stdout, stderr := captureRun(&cfg, offload, debug, stdout, stderr)
+		// Expected mapping changes are measured from the entries as they were before the run.
+		var before []mappingEntry
+		if len(body.Expect) > 0 {
+			before = readExpectations(ctx, cfgEnv, args, contract, body.Expect)
+		}
+		payload := execute(ctx, cfgEnv, cfg, subcmd, hedge, prof, executor.LinesTo(teeWriter(stdout, rec.Stdout()), teeWriter(stderr, rec.Stderr())))
+		if len(body.Expect) > 0 {
+			verifyExpectations(ctx, cfgEnv, args, contract, body.Expect, before, &payload)
+		}
+		rec.Finish(payload.ExitCode)
+		accountRun(ctx, cfgEnv, caller, statsKey, contract, args, fee, refundSpend, &payload)
+		rec.Uploaded(capture.deliver(ctx, cfgEnv, &payload)...)
+		observeRun(ctx, cfgEnv, subcmd, args, len(req.Body), &payload)
+		if id := rec.ID(); id != "" {
+			payload.Meta["journal"] = id
+		}
+		payload.Meta["fingerprint"] = sum
+		if who.authKey != "" {
+			payload.Meta["authKey"] = who.authKey
+		}
+		if adm.invitationUses != "" {
+			payload.Meta["invitationUses"] = adm.invitationUses
+		}
+		if adm.duplicateOf != "" {
+			payload.Meta["duplicateOf"] = adm.duplicateOf
+			payload.warn(warnings.DuplicateExecute, "an identical execute was broadcast recently as "+adm.duplicateOf)
+		}
+		if adm.staleAllowlist {
+			payload.warn(warnings.StaleConfig, "the contract allowlist could not be refreshed; a cached copy was used")
+		}
+		if staleChainState {
+			payload.warn(warnings.StaleChainState, "chain state could not be read; cached values past CHAIN_VAR_TTL were used")
+		}
+		if tx := payload.Meta["transactionId"]; subcmd == "execute" && payload.ExitCode == 0 && tx != "" {
+			recordBroadcast(ctx, cfgEnv, sum, tx)
+		}
+		if signedURLUses != "" {
+			payload.Meta["signedUrlUses"] = signedURLUses
+		}
+		if contractUses != "" {
+			payload.Meta["contractUses"] = contractUses
+		}
+		for k, v := range diag {
+			payload.Meta[k] = v
+		}
+		if prof.Output == profile.OutputMinimal {
+			minimize(&payload)
+		}
+		// Whatever the caps allowed, the response must fit Lambda's payload limit, or the
+		// transport's if lower.
+		fitResponse(&payload, responseLimitFor(ctx))
+		if payload.Truncated {
+			payload.warn(warnings.OutputTruncated, "output was truncated to fit the response")
+		}
+		return payload
+	}
+
+	// Heavy programs are proved by the worker fleet; this request only enqueues them.
+	if cfgEnv.workers != nil && subcmd == "execute" && !cfgEnv.DryRun && cfgEnv.workers.Applies(contract) {
+		return enqueueWork(ctx, cfgEnv, req, caller, args, body.Tags, fee), nil
+	}
+
+	// A run takes a place in its bulkhead now, so a full one is refused before anything
+	// is queued; an execute held by a maintenance window takes its place after the hold.
+	class := bulkheadClass(cfgEnv, subcmd)
+	var ticket *bulkhead.Ticket
+	if adm.heldUntil.IsZero() {
+		t, err := bulkheads.Admit(class)
+		if err != nil {
+			refund()
+			return bulkheadRejected(cfgEnv, class, err), nil
+		}
+		ticket = t
+	}
+	defer func() {
+		if ticket != nil {
+			ticket.Release()
+		}
+	}()
+
+	// An execute held by a maintenance window waits for its end in a job.
+	var hold time.Duration
+	if !adm.heldUntil.IsZero() {
+		hold = max(time.Until(adm.heldUntil), 0)
+	}
+	if body.MaxWaitSeconds > 0 || !adm.heldUntil.IsZero() {
+		// The job must survive this request, so detach it from the invocation's
+		// cancellation and bound it by JOB_TIMEOUT, after any maintenance hold, instead.
+		jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), hold+cfgEnv.JobTimeout)
+		jobRelease := release
+		release = nil
+		jobTicket := ticket
+		ticket = nil
+		spec := jobs.Spec{Owner: caller, Key: statsKey, Tags: body.Tags}
+		if cfgEnv.store != nil {
+			spec.OnFinish = func(j jobs.Job) { storeJob(ctx, cfgEnv, caller, j) }
+		}
+		// Executes broadcast from a job run in phases checkpointed in STORE, so an
+		// interrupted job can be resumed from the last phase it completed.
+		var rj *resumable
+		if resumableRun(cfgEnv, subcmd, args) {
+			spec.ID = randomID()
+			rj = newResumable(cfgEnv, spec.ID, caller, args, prof, fee, sum, body.Tags)
+			spec.OnFinish = func(j jobs.Job) { rj.finish(ctx, j) }
+		}
+		id := jobRegistry.Start(jobCtx, spec, func(ctx context.Context, stdout, stderr io.Writer) any {
+			defer cancel()
+			defer jobRelease()
+			if hold > 0 {
+				timer := time.NewTimer(hold)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+				}
+			}
+			if jobTicket == nil {
+				t, err := bulkheads.Admit(class)
+				if err != nil {
+					refund()
+					return bulkheadFailure(cfgEnv, class, err)
+				}
+				jobTicket = t
+			}
+			defer jobTicket.Release()
+			if err := jobTicket.Wait(ctx); err != nil {
+				refund()
+				return bulkheadFailure(cfgEnv, class, err)
+			}
+			if rj != nil {
+				ctx = context.WithValue(ctx, resumableJob{}, rj)
+			}
+			payload := run(ctx, stdout, stderr)
+			if !adm.heldUntil.IsZero() {
+				payload.Meta["heldUntil"] = adm.heldUntil.Format(time.RFC3339)
+			}
+			return payload
+		})
+		wait := time.Duration(body.MaxWaitSeconds) * time.Second
+		if hold > 0 {
+			wait = 0
+		}
+		job, _ := jobRegistry.Wait(ctx, id, wait)
+		if job.Status == jobs.StatusDone {
+			jobRegistry.Forget(id)
+			return jsonResp(http.StatusOK, job.Result), nil
+		}
+		resp := jsonResp(http.StatusAccepted, job)
+		resp.Headers["Location"] = "/jobs/" + id
+		return resp, nil
+	}
+
+	if err := ticket.Wait(ctx); err != nil {
+		refund()
+		return bulkheadRejected(cfgEnv, class, err), nil
+	}
+	stdout, stderr := streamedOutput(ctx)
+	payload := run(ctx, stdout, stderr)
+	resp := jsonResp(http.StatusOK, payload)
+	if cacheKey != "" && payload.ExitCode == 0 {
+		cacheResponse(ctx, cfgEnv, cacheKey, []byte(resp.Body))
+	}
+	return resp, nil
+}
+
+// admission is what the execute policies decided about a request.
+type admission struct {
+	// invitationUses and duplicateOf are reported in the response's meta.
+	invitationUses, duplicateOf string
+	// staleAllowlist is set when the runtime allowlist was served from a stale cache;
+	// allowedBy is the allowlist entry that admitted the executed contract.
+	staleAllowlist bool
+	allowedBy      string
+	// heldUntil is when the maintenance window holding this execute ends.
+	heldUntil time.Time
+}
+
+// admitExecute applies the execute policies to args for who: the fee, key and endpoint
+// defaults of preset and the config, the contract allowlists, maintenance windows,
+// input validation, deduplication, preconditions and invitations. It returns args as
+// they will run, or the response refusing the request.
+func admitExecute(ctx context.Context, cfgEnv *EnvConfig, who principal, body request.InvokeRequest, args []string, preset network.Preset) ([]string, admission, *events.LambdaFunctionURLResponse) {
+	var a admission
+	fail := func(resp events.LambdaFunctionURLResponse) ([]string, admission, *events.LambdaFunctionURLResponse) {
+		return args, a, &resp
+	}
+	if preset.PriorityFee > 0 && !utils.HasAnyFlag(args, "--priority-fee") {
+		args = utils.InjectFlagValueAfterSubcommand(args, "execute", "--priority-fee", strconv.FormatUint(preset.PriorityFee, 10))
+	}
+	if fee := priorityFee(args); cfgEnv.MaxFee > 0 && fee > cfgEnv.MaxFee {
+		return fail(jsonResp(http.StatusForbidden, codedError(i18n.FeeTooHigh, fmt.Sprintf("priority fee %d exceeds MAX_FEE %d", fee, cfgEnv.MaxFee),
+			map[string]string{"fee": strconv.FormatUint(fee, 10), "max": strconv.FormatUint(cfgEnv.MaxFee, 10)})))
+	}
+	// Inject RPC endpoint if provided via config and not present in args yet.
+	if strings.TrimSpace(cfgEnv.EndPoint) != "" && !utils.HasAnyFlag(args, "--endpoint") {
+		args = utils.InjectFlagValueAfterSubcommand(args, "execute", "--endpoint", cfgEnv.EndPoint)
+	}
+	// The fee may be paid by a different key than the one signing the transition, so
+	// operational keys need not hold credits. A caller's own key wins, then the
+	// contract's FEE_PAYERS entry, then FEE_PRIVATE_KEY.
+	if !utils.HasAnyFlag(args, "--fee-private-key") {
+		contract, _ := utils.ExtractExecuteContract(args)
+		if key := cmp.Or(cfgEnv.feePayers[contract], cfgEnv.FeePrivateKey); key != "" {
+			args = utils.InjectFlagValueAfterSubcommand(args, "execute", "--fee-private-key", key)
+		}
+	}
+	if cfgEnv.PrivateKey != "" && !utils.HasAnyFlag(args, "--private-key", "-k") {
+		args = utils.InjectFlagValueAfterSubcommand(args, "execute", "--private-key", cfgEnv.PrivateKey)
+	}
+	// Enforce contracts allowlist when provided (empty => allow all)
+	contract, _ := utils.ExtractExecuteContract(args)
+	by, ok, stale, err := allowContract(ctx, cfgEnv, contract)
+	if err != nil {
+		return fail(jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, err.Error(), nil)))
+	}
+	a.staleAllowlist, a.allowedBy = stale, by
+	if cfgEnv.shadowRules != nil {
+		if _, shadow, _, err := allowContractBy(ctx, cfgEnv, cfgEnv.shadowRules, contract); err == nil {
+			shadowCompare(cfgEnv, "SHADOW_ALLOWED_CONTRACTS", who.id, contract, ok, shadow)
+		}
+	}
+	switch {
+	case !ok && contract == "":
+		return fail(jsonResp(http.StatusBadRequest, codedError(i18n.MissingContract, "missing execute contract/method argument", nil)))
+	case !ok:
+		return fail(jsonResp(http.StatusForbidden, codedError(i18n.ContractNotAllowed, fmt.Sprintf("contract %q not allowed", contract), map[string]string{"contract": contract})))
+	}
+	// GROUP_CONTRACTS narrows what bearer-token and authorizer callers may execute by
+	// their groups.
+	if strings.HasPrefix(who.id, "jwt:") || strings.HasPrefix(who.id, "authorizer:") {
+		allows := cfgEnv.policy.Allows(who.groups, contract)
+		if cfgEnv.shadowPolicy != nil {
+			shadowCompare(cfgEnv, "SHADOW_GROUP_CONTRACTS", who.id, contract, allows, cfgEnv.shadowPolicy.Allows(who.groups, contract))
+		}
+		if !allows {
+			return fail(jsonResp(http.StatusForbidden, codedError(i18n.GroupNotAllowed, fmt.Sprintf("contract %q not allowed for your groups", contract), map[string]string{"contract": contract})))
+		}
+	}
+	if contract, _ := utils.ExtractExecuteContract(args); len(cfgEnv.maintenance) > 0 {
+		var refused *events.LambdaFunctionURLResponse
+		if a.heldUntil, refused = maintenanceHold(ctx, cfgEnv, contract, time.Now()); refused != nil {
+			return args, a, refused
+		}
+	}
+	if verr := validateInputs(ctx, cfgEnv, args); verr != nil {
+		return fail(jsonResp(http.StatusBadRequest, withFields(codedError(i18n.InvalidInputs, "invalid execute inputs", nil), verr)))
+	}
+	// Upstream retry storms must not mint twice: an identical execute broadcast
+	// within DEDUP_WINDOW is flagged or, with DEDUP_MODE=block, refused.
+	if rec, ok := recentBroadcast(ctx, cfgEnv, fingerprint.Of(args)); ok {
+		if cfgEnv.DedupMode == dedupBlock {
+			return fail(duplicateBroadcast(rec))
+		}
+		a.duplicateOf = rec.TransactionID
+		logWarn("duplicate execute", map[string]string{"caller": who.id, "duplicateOf": a.duplicateOf})
+	}
+	// Preconditions are read last, once the request is otherwise known to run, so
+	// the entries are as fresh as they can be without holding up leo.
+	if len(body.OnlyIf) > 0 {
+		if refused := evaluatePreconditions(ctx, cfgEnv, args, contract, body.OnlyIf); refused != nil {
+			return args, a, refused
+		}
+	}
+	// An invitation is spent only once every other check has passed.
+	if who.invitation != "" {
+		var refused *events.LambdaFunctionURLResponse
+		if a.invitationUses, refused = consumeInvitation(ctx, cfgEnv, who.invitation, args); refused != nil {
+			return args, a, refused
+		}
+	}
+	return args, a, nil
+}
+
+// withHome points leo's home at workdir, unless args already name one. A caller's own
+// --home is held to WORKDIR_ROOT like WORKDIR itself, and canonicalized.
+func withHome(cfgEnv *EnvConfig, subcmd string, args []string, workdir string) ([]string, error) {
+	if !utils.HasAnyFlag(args, "--home") {
+		return utils.InjectFlagValueAfterSubcommand(args, subcmd, "--home", workdir), nil
+	}
+	home, err := executor.ResolveWorkDir(cfgEnv.WorkdirRoot, utils.GetFlagValue(args, "--home"))
+	if err != nil {
+		return args, fmt.Errorf("invalid --home: %w", err)
+	}
+	return utils.SetFlagValue(args, subcmd, "--home", home), nil
+}
+
+// consumeInvitation spends one use of invitation token on the execute in args. It
+// returns the uses so far as "uses/max", or the response refusing the request.
+func consumeInvitation(ctx context.Context, cfgEnv *EnvConfig, token string, args []string) (string, *events.LambdaFunctionURLResponse) {
+	contract, method := utils.ExtractExecuteContract(args)
+	inv, err := cfgEnv.invites.Consume(ctx, token, contract, method)
+	var resp events.LambdaFunctionURLResponse
+	switch {
+	case err == nil:
+		return fmt.Sprintf("%d/%d", inv.Uses, inv.MaxUses), nil
+	case errors.Is(err, invite.ErrInvalid):
+		resp = jsonResp(http.StatusForbidden, codedError(i18n.InvitationInvalid, err.Error(), nil))
+	case errors.Is(err, invite.ErrExpired):
+		resp = jsonResp(http.StatusForbidden, codedError(i18n.InvitationExpired, err.Error(), nil))
+	case errors.Is(err, invite.ErrExhausted):
+		resp = jsonResp(http.StatusForbidden, codedError(i18n.InvitationExhausted, err.Error(), nil))
+	case errors.Is(err, invite.ErrScope):
+		resp = jsonResp(http.StatusForbidden, codedError(i18n.InvitationScope, err.Error(), nil))
+	default:
+		resp = jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, err.Error(), nil))
+	}
+	return "", &resp
+}
+
+// useSignedURL counts one use of the signed URL c. It returns the uses so far as
+// "uses/max", or the response refusing the request.
+func useSignedURL(ctx context.Context, cfgEnv *EnvConfig, c signedurl.Claims) (string, *events.LambdaFunctionURLResponse) {
+	n, err := cfgEnv.signedURLs.Use(ctx, c)
+	var resp events.LambdaFunctionURLResponse
+	switch {
+	case err == nil:
+		return fmt.Sprintf("%d/%d", n, c.MaxUses), nil
+	case errors.Is(err, signedurl.ErrExhausted):
+		resp = jsonResp(http.StatusForbidden, codedError(i18n.SignedURLExhausted, err.Error(), nil))
+	default:
+		resp = jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, err.Error(), nil))
+	}
+	return "", &resp
+}
+
+// execute runs cfg (hedged across endpoints when requested, retried and confirmed as the
+// profile asks) and assembles the response, anchoring a receipt for qualifying
+// executions. stdout and stderr may be nil.
+func execute(ctx context.Context, cfgEnv *EnvConfig, cfg executor.Config, subcmd string, hedge bool, prof profile.Profile, onOutput executor.OutputFunc) Response {
+	args := cfg.Args
+	// Only the primary run reports progress so hedged attempts don't interleave.
+	cfg.OnOutput = onOutput
+
+	rc := receipt.Config{Program: cfgEnv.ReceiptProgram, Function: cfgEnv.ReceiptFunction, Contracts: cfgEnv.ReceiptContracts}
+	contract, _ := utils.ExtractExecuteContract(args)
+	withReceipt := subcmd == "execute" && rc.Applies(contract)
+	// Leave time for the receipt transaction after the main run.
+	runCtx := ctx
+	if withReceipt {
+		runCtx = budget.Reserve(ctx, cfgEnv.ReceiptReserve)
+	}
+
+	// A resumable job has leo save the transaction instead of broadcasting it, and sends
+	// it itself once it is checkpointed.
+	rj, _ := ctx.Value(resumableJob{}).(*resumable)
+	var saveDir string
+	if rj != nil {
+		dir, err := os.MkdirTemp(cfgEnv.WorkdirRoot, "transaction-")
+		if err != nil {
+			return Response{ExitCode: 1, Stderr: err.Error(), Meta: map[string]string{}}
+		}
+		defer os.RemoveAll(dir)
+		saveDir, cfg.Args = dir, proveArgs(args, subcmd, dir)
+		rj.save(ctx, phaseProving)
+	}
+
+	endpoint := utils.GetFlagValue(args, "--endpoint")
+	runOnce := func() executor.Result {
+		if !hedge {
+			return runCommand(runCtx, cfg)
+		}
+		endpoints := append([]string{cfgEnv.EndPoint}, cfgEnv.HedgeEndpoints...)
+		if live := slices.DeleteFunc(slices.Clone(endpoints), func(ep string) bool {
+			return health.Open(ep, cfgEnv.BreakerThreshold, cfgEnv.BreakerCooldown)
+		}); len(live) > 0 {
+			endpoints = live
+		}
+		cfgs := make([]executor.Config, len(endpoints))
+		for i, ep := range endpoints {
+			cfgs[i] = cfg
+			if i > 0 {
+				cfgs[i].OnOutput, cfgs[i].OnStart = nil, nil
+			}
+			cfgs[i].Args = utils.InjectFlagValueAfterSubcommand(args, subcmd, "--endpoint", ep)
+		}
+		res, winner := executor.RunFirstSuccess(runCtx, cfgs)
+		endpoint = endpoints[winner]
+		return res
 	}
 
 	start := time.Now()
-	res := executor.Run(ctx, cfg)
+	var (
+		res      executor.Result
+		proved   bool
+		provMeta map[string]string
+	)
+	if p := cfgEnv.prover; p != nil && subcmd == "execute" && !cfgEnv.DryRun {
+		if p.Applies(contract) {
+			res, proved, provMeta = delegateProving(runCtx, p, cfg)
+		} else {
+			provMeta = map[string]string{"proving": provingLocal}
+		}
+	}
+	if !proved {
+		localStart := time.Now()
+		res = runOnce()
+		if provMeta != nil {
+			provMeta["localSeconds"] = strconv.FormatFloat(time.Since(localStart).Seconds(), 'f', 3, 64)
+		}
+	}
+	// Only read commands are retried: a transport error during execute may still have
+	// broadcast the transaction.
+	attempts := 1
+	for ; attempts <= prof.Retries && res.ExitCode != 0 && slices.Contains(cfgEnv.ReadCommands, subcmd) && cfgEnv.stderrRules.Match(classify.Network, res.Stderr); attempts++ {
+		if endpoint != "" {
+			recordEndpoint(cfgEnv, endpoint, res)
+		}
+		res = runOnce()
+	}
+	var broadcastTx, broadcastErr string
+	if rj != nil && res.ExitCode == 0 {
+		if tx, err := rj.broadcast(runCtx, saveDir); err != nil {
+			res.ExitCode, broadcastErr = 1, err.Error()
+		} else {
+			broadcastTx = tx
+		}
+	}
 	dur := time.Since(start)
-	status := http.StatusOK
+	opened := endpoint != "" && recordEndpoint(cfgEnv, endpoint, res)
 
+	version, _ := leoVersion.Get()
 	payload := Response{
 		ExitCode:  res.ExitCode,
 		Duration:  dur.Seconds(),
@@ -147,24 +1644,596 @@ func handler(ctx context.Context, req events.LambdaFunctionURLRequest) (events.L
 		Stderr:    res.Stderr,
 		Truncated: res.Truncated,
 		Meta: map[string]string{
-			"version": leoVersion,
+			"version": version,
 			"home":    utils.GetFlagValue(args, "--home"),
 		},
 	}
+	if endpoint != "" {
+		payload.Meta["endpoint"] = endpoint
+	}
+	maps.Copy(payload.Meta, provMeta)
+	if broadcastErr != "" {
+		payload.Meta["broadcastError"] = broadcastErr
+	}
+	if res.ExitCode != 0 {
+		payload.Code = cfgEnv.stderrRules.Classify(cmp.Or(broadcastErr, res.Stderr))
+	}
+	if attempts > 1 {
+		payload.Meta["attempts"] = strconv.Itoa(attempts)
+	}
+	if res.Attempts > 1 {
+		payload.Meta["execAttempts"] = strconv.Itoa(res.Attempts)
+	}
+	if (subcmd == "execute" || subcmd == "deploy") && res.ExitCode == 0 {
+		if tx := cmp.Or(broadcastTx, network.TransactionID(res.Stdout)); tx != "" {
+			payload.Meta["transactionId"] = tx
+			link := network.Link{TxID: tx, Network: utils.GetFlagValue(args, "--network"), Program: contract}
+			if subcmd == "deploy" {
+				link.Program = network.ProgramID(res.Stdout)
+			}
+			if u := link.Render(cfgEnv.networks.Explorer(link.Network)); u != "" {
+				payload.Meta["explorerUrl"] = u
+			}
+			if prof.WaitConfirmation {
+				confirmed, err := confirmTransaction(runCtx, prof.ConfirmTimeout(), endpoint, link.Network, tx)
+				payload.Meta["confirmed"] = strconv.FormatBool(err == nil)
+				if err != nil {
+					payload.Meta["confirmError"] = err.Error()
+					payload.warn(warnings.NotConfirmed, "transaction "+tx+" was broadcast but not confirmed: "+err.Error())
+				} else if subcmd == "execute" {
+					// The confirmed transaction carries the outputs and finalize operations,
+					// sparing callers a second round trip to the explorer.
+					status, events, err := network.ParseEvents(confirmed)
+					if err != nil {
+						payload.Meta["eventsError"] = err.Error()
+					} else {
+						payload.Meta["transactionStatus"] = status
+						payload.Events = events
+					}
+				}
+			}
+		}
+	}
 
-	return jsonResp(status, payload), nil
+	if rj != nil {
+		if broadcastTx != "" && payload.Meta["confirmed"] != "false" {
+			rj.save(ctx, phaseDone)
+		}
+		payload.Meta["jobId"], payload.Meta["phase"] = rj.rec.Job.ID, rj.rec.Checkpoint.Phase
+	}
+
+	if opened {
+		raiseAlert(ctx, cfgEnv, alert.Alert{
+			Kind:    alert.KindCircuitOpen,
+			Key:     endpoint,
+			Count:   cfgEnv.BreakerThreshold,
+			Summary: fmt.Sprintf("circuit opened for %s after %d consecutive failures", endpoint, cfgEnv.BreakerThreshold),
+			Samples: []string{alert.Sample(res.Stderr)},
+			At:      time.Now().UTC(),
+		}, payload.Meta)
+	}
+
+	// Anchor a receipt for significant successful executions. A failed receipt is reported
+	// in Meta but never turns the (already broadcast) execution into an error.
+	if withReceipt && res.ExitCode == 0 {
+		hash := receipt.Hash(args, res.ExitCode, res.Stdout)
+		payload.Meta["receipt"] = hash
+		if b, ok := budget.From(ctx); ok && b.SpendLimited && b.Spend == 0 {
+			payload.Meta["receiptError"] = quota.ErrSpendLimited.Error()
+			payload.warn(warnings.ReceiptFailed, "receipt not anchored: "+quota.ErrSpendLimited.Error())
+		} else {
+			rcfg := cfg
+			rcfg.Args = receipt.Args(rc, args, hash)
+			rcfg.OnOutput, rcfg.OnStart = nil, nil
+			if rres := runCommand(ctx, rcfg); rres.ExitCode != 0 {
+				payload.Meta["receiptError"] = rres.Stderr
+				payload.warn(warnings.ReceiptFailed, fmt.Sprintf("receipt not anchored: leo exited %d", rres.ExitCode))
+			}
+		}
+	}
+
+	return payload
+}
+
+// confirmInterval is the delay between confirmation polls.
+var confirmInterval = 2 * time.Second
+
+// confirmTransaction waits for tx to be confirmed on network, within timeout and the
+// current stage of the invocation's budget, and returns the confirmed transaction.
+func confirmTransaction(ctx context.Context, timeout time.Duration, endpoint, net, tx string) ([]byte, error) {
+	if endpoint == "" || net == "" {
+		return nil, errors.New("confirmation needs --endpoint and --network")
+	}
+	ctx, cancel, err := budget.Stage(ctx)
+	defer cancel()
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		defer cancelTimeout()
+	}
+	return network.WaitConfirmed(ctx, nil, endpoint, net, tx, confirmInterval)
+}
+
+// allowedByRuntime is the provenance of contracts added with the allowlist action.
+const allowedByRuntime = "runtime"
+
+// allowContract reports whether the allowlist admits contract and by which entry: the
+// matching ALLOWED_CONTRACTS entry, or allowedByRuntime. An empty allowlist admits
+// every contract, with by empty. stale reports that the runtime contracts were served
+// from an expired cache entry.
+func allowContract(ctx context.Context, cfgEnv *EnvConfig, contract string) (by string, ok, stale bool, err error) {
+	return allowContractBy(ctx, cfgEnv, cfgEnv.allowedRules, contract)
+}
+
+// allowContractBy is allowContract with rules in place of ALLOWED_CONTRACTS.
+func allowContractBy(ctx context.Context, cfgEnv *EnvConfig, rules allowlist.Rules, contract string) (by string, ok, stale bool, err error) {
+	if contract != "" {
+		if r, ok := rules.Match(contract); ok {
+			return r.Source, true, false, nil
+		}
+	}
+	var extra []string
+	if cfgEnv.allowlist != nil {
+		extra, stale, err = revalidate(cfgEnv, runtimeAllowlist, cfgEnv.allowlist.Name(), func() ([]string, error) {
+			l, err := cfgEnv.allowlist.Load(ctx)
+			return l.Contracts, err
+		})
+		if err != nil {
+			return "", false, false, err
+		}
+	}
+	switch {
+	case len(rules) == 0 && len(extra) == 0:
+		return "", true, stale, nil
+	case contract != "" && slices.Contains(extra, contract):
+		return allowedByRuntime, true, stale, nil
+	}
+	return "", false, stale, nil
+}
+
+// revalidate reads key from a config or secret cache, refetching it once expired. While
+// the backing service fails, the expired value is served for up to CONFIG_HARD_STALE,
+// each time logged and counted as a StaleConfig metric, and reported as stale; after that
+// the lookup fails.
+func revalidate[V any](cfgEnv *EnvConfig, cache *state.Cache[V], key string, fetch func() (V, error)) (V, bool, error) {
+	var fetchErr error
+	v, stale, err := cache.Revalidate(key, cfgEnv.ConfigHardStale, func() (V, error) {
+		v, err := fetch()
+		fetchErr = err
+		return v, err
+	})
+	if stale {
+		logWarn("serving stale config", map[string]string{"key": key, "error": fetchErr.Error()})
+		if cfgEnv.MetricsNamespace != "" {
+			_ = metrics.WriteCount(metricsOut, cfgEnv.MetricsNamespace, metrics.StaleConfig, time.Now())
+		}
+	}
+	return v, stale, err
+}
+
+// recordEndpoint updates endpoint health and reports whether this outcome just opened
+// its circuit. Only transport failures count; a rejected transaction says nothing about
+// the endpoint.
+func recordEndpoint(cfgEnv *EnvConfig, endpoint string, res executor.Result) bool {
+	if res.ExitCode == 0 {
+		health.Success(endpoint)
+		return false
+	}
+	if !cfgEnv.stderrRules.Match(classify.Network, res.Stderr) {
+		return false
+	}
+	return health.Failure(endpoint) == cfgEnv.BreakerThreshold && cfgEnv.BreakerThreshold > 0
+}
+
+// accountRun records a finished run: its duration for statsKey's job estimates, the
+// caller's usage, the contract's daily rollup and the keys it was signed with. Failures
+// are noted in payload and never fail the run. refundSpend gives back the fee charged
+// against DAILY_SPEND_LIMIT.
+func accountRun(ctx context.Context, cfgEnv *EnvConfig, caller, statsKey, contract string, args []string, fee uint64, refundSpend func(), payload *Response) {
+	elapsed := time.Duration(payload.Duration * float64(time.Second))
+	jobRegistry.Observe(statsKey, elapsed)
+	// Only successful runs are billed the fee; a failed execute is not broadcast, so
+	// its charge is refunded and GET /quota agrees with the usage report.
+	used := usage.Run{OK: payload.ExitCode == 0, Duration: elapsed}
+	if used.OK {
+		used.Fee = fee
+	} else {
+		refundSpend()
+	}
+	if err := cfgEnv.usage().Record(caller, time.Now(), used); err != nil {
+		payload.Meta["usageError"] = err.Error()
+	}
+	recordRollup(ctx, cfgEnv, contract, time.Now(), used, payload.Meta)
+	if err := recordKeyUse(cfgEnv, args, contract, time.Now()); err != nil {
+		payload.Meta["keyUsageError"] = err.Error()
+	}
+}
+
+// observeRun reports a finished run to the notifier, the size metrics and the failure
+// streak alerts. requestBytes is the size of the request body.
+func observeRun(ctx context.Context, cfgEnv *EnvConfig, subcmd string, args []string, requestBytes int, payload *Response) {
+	event := notifyEvent(subcmd, args, *payload)
+	if n := cfgEnv.notifier(); n.Enabled() {
+		if err := n.Notify(ctx, event); err != nil && !errors.Is(err, notify.ErrRateLimited) {
+			payload.Meta["notifyError"] = err.Error()
+		}
+	}
+	sizes := metrics.Sizes{
+		RequestBytes: requestBytes,
+		Args:         len(args),
+		StdoutBytes:  len(payload.Stdout),
+		StderrBytes:  len(payload.Stderr),
+		Truncated:    payload.Truncated,
+	}
+	sizeMetrics.Record(subcmd, event.Program, sizes)
+	if cfgEnv.MetricsNamespace != "" {
+		_ = metrics.WriteEMF(metricsOut, cfgEnv.MetricsNamespace, subcmd, event.Program, sizes, time.Now())
+		if payload.Code != "" {
+			_ = metrics.WriteCountWith(metricsOut, cfgEnv.MetricsNamespace, metrics.RunFailures, map[string]string{"Category": payload.Code}, time.Now())
+		}
+	}
+	// Failures outside ALERT_CATEGORIES neither count towards a streak nor end one.
+	alerting := len(cfgEnv.AlertCategories) == 0 || payload.Code == "" || slices.Contains(cfgEnv.AlertCategories, payload.Code)
+	if len(cfgEnv.alertSinks) > 0 && event.Program != "" && alerting {
+		failureStreaks.SetThreshold(cfgEnv.AlertStreak)
+		sample := alert.Sample(payload.Stderr)
+		if payload.Code != "" {
+			sample = "[" + payload.Code + "] " + sample
+		}
+		if a, fired := failureStreaks.Record(event.Program, payload.ExitCode != 0, sample); fired {
+			raiseAlert(ctx, cfgEnv, a, payload.Meta)
+		}
+	}
+}
+
+// raiseAlert delivers a to the configured sinks. Delivery failures are reported in meta
+// and never fail the run.
+func raiseAlert(ctx context.Context, cfgEnv *EnvConfig, a alert.Alert, meta map[string]string) {
+	if len(cfgEnv.alertSinks) == 0 {
+		return
+	}
+	if err := alert.Send(ctx, cfgEnv.alertSinks, a); err != nil {
+		meta["alertError"] = err.Error()
+	}
+}
+
+// networkCheckTimeout bounds the chain ID lookup of NETWORK_CHECK.
+const networkCheckTimeout = 5 * time.Second
+
+// checkNetwork rejects execute and deploy requests whose --network differs from the
+// chain the --endpoint serves, e.g. a testnet request sent to a mainnet node, before
+// anything is broadcast. Endpoints that cannot be queried are let through: the run
+// would surface that failure itself.
+func checkNetwork(ctx context.Context, cfgEnv *EnvConfig, subcmd string, args []string) error {
+	if !cfgEnv.NetworkCheck || (subcmd != "execute" && subcmd != "deploy") {
+		return nil
+	}
+	name, endpoint := utils.GetFlagValue(args, "--network"), utils.GetFlagValue(args, "--endpoint")
+	want, known := cfgEnv.networks.ID(name)
+	if !known || endpoint == "" {
+		return nil
+	}
+	key := endpoint + "\x00" + strings.ToLower(name)
+	got, ok := chainIDs.Get(key)
+	if !ok {
+		ctx, cancel := context.WithTimeout(ctx, networkCheckTimeout)
+		defer cancel()
+		id, err := network.ChainID(ctx, nil, endpoint, strings.ToLower(name))
+		if err != nil {
+			return nil
+		}
+		chainIDs.Set(key, id)
+		got = id
+	}
+	if got != want {
+		return fmt.Errorf("--network %s does not match %s, which serves %s (network ID %d)", name, endpoint, network.Name(got), got)
+	}
+	return nil
+}
+
+// notifyEvent summarises a finished run for webhook notifications.
+func notifyEvent(subcmd string, args []string, payload Response) notify.Event {
+	e := notify.Event{
+		Command:     subcmd,
+		Network:     utils.GetFlagValue(args, "--network"),
+		ExitCode:    payload.ExitCode,
+		Duration:    time.Duration(payload.Duration * float64(time.Second)),
+		TxID:        payload.Meta["transactionId"],
+		ExplorerURL: payload.Meta["explorerUrl"],
+		Stderr:      payload.Stderr,
+	}
+	e.Program, e.Function = utils.ExtractExecuteContract(args)
+	if subcmd == "deploy" {
+		e.Program = network.ProgramID(payload.Stdout)
+	}
+	return e
+}
+
+// invocationID returns the Lambda request ID, or "" outside Lambda.
+func invocationID(ctx context.Context) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		return lc.AwsRequestID
+	}
+	return ""
+}
+
+// teeWriter combines the non-nil writers, returning nil when there are none.
+func teeWriter(ws ...io.Writer) io.Writer {
+	ws = slices.DeleteFunc(ws, func(w io.Writer) bool { return w == nil })
+	switch len(ws) {
+	case 0:
+		return nil
+	case 1:
+		return ws[0]
+	}
+	return io.MultiWriter(ws...)
+}
+
+func quotaExceeded(caller string, err error) events.LambdaFunctionURLResponse {
+	code := i18n.RateLimited
+	switch {
+	case errors.Is(err, quota.ErrSpendLimited):
+		code = i18n.SpendLimited
+	case errors.Is(err, quota.ErrConcurrency):
+		code = i18n.ConcurrencyLimited
+	}
+	body := codedError(code, err.Error(), nil)
+	body["quota"] = quotas.Snapshot(caller)
+	resp := jsonResp(http.StatusTooManyRequests, body)
+	if d := quotas.RetryAfter(caller); d > 0 && errors.Is(err, quota.ErrRateLimited) {
+		resp.Headers["Retry-After"] = strconv.Itoa(int(math.Ceil(d.Seconds())))
+	}
+	return resp
+}
+
+// priorityFee returns the --priority-fee value in microcredits, or 0 when absent or invalid.
+func priorityFee(args []string) uint64 {
+	v := strings.TrimSuffix(utils.GetFlagValue(args, "--priority-fee"), "u64")
+	fee, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return fee
 }
 
 func jsonResp(status int, v any) events.LambdaFunctionURLResponse {
-	b, _ := json.Marshal(v)
 	return events.LambdaFunctionURLResponse{
 		StatusCode:      status,
 		Headers:         map[string]string{"Content-Type": "application/json"},
-		Body:            string(b),
+		Body:            encodeJSON(v),
 		IsBase64Encoded: false,
 	}
 }
 
+// maxPooledBuffer keeps multi-MB buffers out of the pool so one large response does
+// not pin its memory for the life of the container.
+const maxPooledBuffer = 1 << 20
+
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// encodeJSON returns v as JSON. Responses, which may carry megabytes of output, are
+// sized first and then escaped straight into a single allocation; everything else goes
+// through a pooled buffer.
+func encodeJSON(v any) string {
+	if r, ok := v.(Response); ok {
+		var c jsonstream.Counter
+		_ = r.writeJSON(&c)
+		var sb strings.Builder
+		sb.Grow(c.N)
+		_ = r.writeJSON(&sb)
+		return sb.String()
+	}
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			bufPool.Put(buf)
+		}
+	}()
+	_ = json.NewEncoder(buf).Encode(v)
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+}
+
+// writeJSON encodes r exactly as json.Marshal would, streaming Stdout and Stderr into w.
+// Keep it in sync with the struct tags on Response.
+func (r Response) writeJSON(w io.StringWriter) error {
+	o := jsonstream.NewObject(w)
+	o.Raw("exitCode", strconv.Itoa(r.ExitCode))
+	if r.Duration != 0 {
+		d, _ := json.Marshal(r.Duration)
+		o.Raw("duration", string(d))
+	}
+	if r.Stdout != "" {
+		o.String("stdout", r.Stdout)
+	}
+	if r.Stderr != "" {
+		o.String("stderr", r.Stderr)
+	}
+	if r.Truncated {
+		o.Raw("truncated", "true")
+	}
+	if len(r.Meta) > 0 {
+		m, _ := json.Marshal(r.Meta)
+		o.Raw("meta", string(m))
+	}
+	if len(r.Events) > 0 {
+		e, _ := json.Marshal(r.Events)
+		o.Raw("events", string(e))
+	}
+	if r.Verified != nil {
+		o.Raw("verified", strconv.FormatBool(*r.Verified))
+	}
+	if len(r.Diffs) > 0 {
+		d, _ := json.Marshal(r.Diffs)
+		o.Raw("diffs", string(d))
+	}
+	if len(r.Warnings) > 0 {
+		w, _ := json.Marshal(r.Warnings)
+		o.Raw("warnings", string(w))
+	}
+	if r.Debug != nil {
+		d, _ := json.Marshal(r.Debug)
+		o.Raw("debug", string(d))
+	}
+	if r.Code != "" {
+		o.String("code", r.Code)
+	}
+	return o.End()
+}
+
 func main() {
-	lambda.Start(handler)
+	selftestMode := flag.Bool("selftest", false, "check the image (leo, parameters, workdir, endpoint) and print a JSON report")
+	offline := flag.Bool("offline", false, "with -selftest, skip checks that need network access")
+	flag.Parse()
+	if *selftestMode {
+		os.Exit(runSelftest(*offline))
+	}
+	// Warm config and the leo version on cold start; a missing leo binary is fatal.
+	_, _ = configState.Get()
+	if _, err := leoVersion.Get(); err != nil {
+		panic(fmt.Sprintf("failed to get leo version: %v", err))
+	}
+	migrateOnStart()
+	lambda.Start(invoke)
+}
+
+// scheduledTasks run on EventBridge schedules, selected by the rule's constant input
+// {"task": "<name>"}.
+var scheduledTasks = map[string]func(context.Context, *EnvConfig) (map[string]any, error){
+	"export": func(ctx context.Context, cfgEnv *EnvConfig) (map[string]any, error) {
+		return export(ctx, cfgEnv, time.Now().UTC().AddDate(0, 0, -1))
+	},
+	"status":    publishStatus,
+	"schedules": runSchedules,
+}
+
+// invoke routes EventBridge events carrying a request to handleEvent, scheduled tasks
+// to scheduledTasks, SQS batches to handleSQS, Kinesis batches to handleKinesis, SNS
+// notifications to handleSNS, S3 uploads to handleS3, bare requests invoked directly to
+// handleDirect and everything else to the Function URL handler, converting API Gateway
+// HTTP API events on the way in and out. Function URL requests asking for a stream go
+// through streamHandler. A scheduled event without input runs the export.
+func invoke(ctx context.Context, raw json.RawMessage) (any, error) {
+	if ev, ok := eventRequest(raw); ok {
+		return handleEvent(ctx, ev), nil
+	}
+	var ev struct {
+		DetailType string `json:"detail-type"`
+		Task       string `json:"task"`
+	}
+	if json.Unmarshal(raw, &ev) == nil && (ev.Task != "" || ev.DetailType == "Scheduled Event") {
+		task, ok := scheduledTasks[cmp.Or(ev.Task, "export")]
+		if !ok {
+			return nil, fmt.Errorf("unknown task %q", ev.Task)
+		}
+		cfgEnv, err := currentConfig()
+		if err != nil {
+			return nil, err
+		}
+		return task(ctx, cfgEnv)
+	}
+	if isSQS(raw) {
+		var ev events.SQSEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, err
+		}
+		return handleSQS(ctx, ev), nil
+	}
+	if isKinesis(raw) {
+		var ev events.KinesisEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, err
+		}
+		return handleKinesis(ctx, ev), nil
+	}
+	if isSNS(raw) {
+		var ev events.SNSEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, err
+		}
+		handleSNS(ctx, ev)
+		return nil, nil
+	}
+	if isS3(raw) {
+		var ev events.S3Event
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, err
+		}
+		handleS3(ctx, ev)
+		return nil, nil
+	}
+	if isAPIGatewayV2(raw) {
+		var ev events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, err
+		}
+		// A config error is reported by the handler; the authorizer's principal is
+		// mapped only with a config to go by.
+		cfgEnv, _ := currentConfig()
+		ctx, req := fromAPIGatewayV2(ctx, cfgEnv, ev)
+		resp, err := handler(ctx, req)
+		return toAPIGatewayV2(resp), err
+	}
+	if isALB(raw) {
+		var ev events.ALBTargetGroupRequest
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, responseCap{}, albResponseLimit)
+		resp, err := handler(ctx, fromALB(ev))
+		return toALB(resp, len(ev.MultiValueHeaders) > 0), err
+	}
+	if isAPIGatewayV1(raw) {
+		var ev events.APIGatewayProxyRequest
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return nil, err
+		}
+		cfgEnv, _ := currentConfig()
+		ctx, req := fromAPIGatewayV1(ctx, cfgEnv, ev)
+		resp, err := handler(ctx, req)
+		return toAPIGatewayV1(resp), err
+	}
+	if isDirect(raw) {
+		return handleDirect(ctx, raw)
+	}
+	var req events.LambdaFunctionURLRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return nil, err
+	}
+	if wantsStream(req) {
+		return streamHandler(ctx, req), nil
+	}
+	return handler(ctx, req)
+}
+
+// selftestOptions points the self-test at cfgEnv's leo, endpoint and a workdir for id.
+func selftestOptions(cfgEnv *EnvConfig, id string) selftest.Options {
+	return selftest.Options{
+		LeoBin:    cfgEnv.LeoBin,
+		WorkDir:   workdirFor(cfgEnv.DefaultWorkdir, id, id),
+		Endpoint:  cfgEnv.EndPoint,
+		ParamsDir: cmp.Or(os.Getenv("LEO_PARAMS_DIR"), selftest.DefaultParamsDir()),
+	}
+}
+
+// runSelftest prints the self-test report and returns the process exit code.
+func runSelftest(offline bool) int {
+	cfgEnv, err := loadEnvConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid env config: %v\n", err)
+		return 2
+	}
+	o := selftestOptions(cfgEnv, "selftest")
+	o.Offline = offline
+	report := selftest.Run(context.Background(), o)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+	if !report.OK {
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/executor"
+	"github.com/debendraoli/leo-lambda/pkg/request"
+)
+
+func BenchmarkJSONResponse(b *testing.B) {
+	for _, size := range []int{64 * 1024, 1 << 20, 5_500_000} {
+		payload := Response{Stdout: strings.Repeat("a", size), Meta: map[string]string{"version": "3.2.0"}}
+		b.Run(fmt.Sprintf("stdout=%d", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for b.Loop() {
+				jsonResp(200, payload)
+			}
+		})
+	}
+}
+
+// BenchmarkHandler measures the request path end to end with a fake runner, so the
+// numbers reflect handler overhead rather than process startup.
+func BenchmarkHandler(b *testing.B) {
+	b.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	b.Setenv("ALLOWED_CONTRACTS", "credits.aleo")
+	for _, size := range []int{1024, 1 << 20} {
+		stdout := strings.Repeat("o", size)
+		b.Run(fmt.Sprintf("stdout=%d", size), func(b *testing.B) {
+			orig := runCommand
+			runCommand = func(context.Context, executor.Config) executor.Result {
+				return executor.Result{Stdout: stdout}
+			}
+			b.Cleanup(func() { runCommand = orig })
+
+			body, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public", "aleo1xyz", "100u64"}})
+			req := events.LambdaFunctionURLRequest{
+				RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+				Body:           string(body),
+			}
+			b.ReportAllocs()
+			for b.Loop() {
+				resp, err := handler(context.Background(), req)
+				if err != nil || resp.StatusCode != 200 {
+					b.Fatalf("unexpected response %d: %v", resp.StatusCode, err)
+				}
+			}
+		})
+	}
+}
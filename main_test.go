@@ -1,16 +1,65 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/debendraoli/leo-lambda/pkg/classify"
+	"github.com/debendraoli/leo-lambda/pkg/clock"
+	"github.com/debendraoli/leo-lambda/pkg/executor"
+	"github.com/debendraoli/leo-lambda/pkg/expect"
+	"github.com/debendraoli/leo-lambda/pkg/hmacauth"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/jobs"
+	"github.com/debendraoli/leo-lambda/pkg/journal"
+	"github.com/debendraoli/leo-lambda/pkg/keyuse"
+	"github.com/debendraoli/leo-lambda/pkg/metrics"
+	"github.com/debendraoli/leo-lambda/pkg/migrate"
+	"github.com/debendraoli/leo-lambda/pkg/mixed"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+	"github.com/debendraoli/leo-lambda/pkg/quota"
+	"github.com/debendraoli/leo-lambda/pkg/request"
+	"github.com/debendraoli/leo-lambda/pkg/rollup"
+	"github.com/debendraoli/leo-lambda/pkg/saga"
+	"github.com/debendraoli/leo-lambda/pkg/schedule"
+	"github.com/debendraoli/leo-lambda/pkg/selftest"
+	"github.com/debendraoli/leo-lambda/pkg/state"
+	"github.com/debendraoli/leo-lambda/pkg/stream"
+	"github.com/debendraoli/leo-lambda/pkg/usage"
 	"github.com/debendraoli/leo-lambda/pkg/utils"
+	"github.com/debendraoli/leo-lambda/pkg/warnings"
+	"github.com/debendraoli/leo-lambda/pkg/worker"
 )
 
 // Integration test that calls the handler to execute real leo --version
@@ -37,7 +86,7 @@ func TestIntegration_Handler_LeoVersion(t *testing.T) {
 	// Allow 'version' in allowed commands to avoid allowlist blocks in environments
 	t.Setenv("ALLOWED_COMMANDS", "execute,version")
 
-	body := utils.InvokeRequest{Args: []string{"--version"}}
+	body := request.InvokeRequest{Args: []string{"--version"}}
 	b, _ := json.Marshal(body)
 	req := events.LambdaFunctionURLRequest{
 		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
@@ -58,7 +107,7 @@ func TestHandlerDryRun(t *testing.T) {
 	t.Setenv("DRY_RUN", "true")
 	t.Setenv("ALLOWED_COMMANDS", "execute,version")
 	// Provide a small timeout
-	body := utils.InvokeRequest{Cmd: "execute --help"}
+	body := request.InvokeRequest{Cmd: "execute --help"}
 	b, _ := json.Marshal(body)
 	req := events.LambdaFunctionURLRequest{
 		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
@@ -77,7 +126,7 @@ func TestAllowlist_BlocksDisallowed(t *testing.T) {
 	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
 	t.Setenv("DRY_RUN", "true")
 	t.Setenv("ALLOWED_COMMANDS", "execute")
-	body := utils.InvokeRequest{Args: []string{"build", "--flag"}}
+	body := request.InvokeRequest{Args: []string{"build", "--flag"}}
 	b, _ := json.Marshal(body)
 	req := events.LambdaFunctionURLRequest{
 		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
@@ -96,7 +145,7 @@ func TestAllowlist_AllowsExecute(t *testing.T) {
 	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
 	t.Setenv("DRY_RUN", "true")
 	t.Setenv("ALLOWED_COMMANDS", "execute")
-	body := utils.InvokeRequest{Args: []string{"execute", "--help"}}
+	body := request.InvokeRequest{Args: []string{"execute", "--help"}}
 	b, _ := json.Marshal(body)
 	req := events.LambdaFunctionURLRequest{
 		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
@@ -117,7 +166,7 @@ func TestContractAllowlist_BlocksContract(t *testing.T) {
 	t.Setenv("ALLOWED_COMMANDS", "execute")
 	t.Setenv("ALLOWED_CONTRACTS", "allowed_contract")
 	// Attempt to execute a disallowed contract
-	body := utils.InvokeRequest{Args: []string{"execute", "disallowed_contract/token_receive_public"}}
+	body := request.InvokeRequest{Args: []string{"execute", "disallowed_contract/token_receive_public"}}
 	b, _ := json.Marshal(body)
 	req := events.LambdaFunctionURLRequest{
 		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
@@ -138,7 +187,7 @@ func TestPrivateKeyInjection_WhenMissingInArgs(t *testing.T) {
 	t.Setenv("ALLOWED_COMMANDS", "execute")
 	t.Setenv("ALLOWED_CONTRACTS", "vlink_token_service_v7.aleo")
 	t.Setenv("ALEO_PRIVATE_KEY", "abc123")
-	body := utils.InvokeRequest{Args: []string{"execute", "vlink_token_service_v7.aleo/token_receive_public"}}
+	body := request.InvokeRequest{Args: []string{"execute", "vlink_token_service_v7.aleo/token_receive_public"}}
 	b, _ := json.Marshal(body)
 	req := events.LambdaFunctionURLRequest{
 		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
@@ -160,7 +209,7 @@ func TestRPCURLEndpointInjection(t *testing.T) {
 	t.Setenv("ALLOWED_CONTRACTS", "vlink_token_service_v7.aleo")
 	t.Setenv("ENDPOINT", "https://example-rpc")
 
-	body := utils.InvokeRequest{Args: []string{"execute", "vlink_token_service_v7.aleo/token_receive_public", "--network", "testnet"}}
+	body := request.InvokeRequest{Args: []string{"execute", "vlink_token_service_v7.aleo/token_receive_public", "--network", "testnet"}}
 	b, _ := json.Marshal(body)
 	req := events.LambdaFunctionURLRequest{
 		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
@@ -182,3 +231,4361 @@ func TestRPCURLEndpointInjection(t *testing.T) {
 		t.Fatalf("expected --endpoint injection, got stdout=%q", r.Stdout)
 	}
 }
+
+func TestTransformRules_RejectAndRewrite(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "execute")
+	t.Setenv("TRANSFORM_RULES", `[
+		{"name": "no-burn", "when": {"==": [{"var": "method"}, "burn"]}, "reject": "burning is disabled"},
+		{"name": "force-testnet", "set": {"--network": "testnet"}}
+	]`)
+
+	body := request.InvokeRequest{Args: []string{"execute", "token.aleo/burn"}}
+	b, _ := json.Marshal(body)
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d body=%s", resp.StatusCode, resp.Body)
+	}
+
+	body = request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "--network", "mainnet"}}
+	b, _ = json.Marshal(body)
+	req.Body = string(b)
+	resp, err = handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	var r Response
+	if err := json.Unmarshal([]byte(resp.Body), &r); err != nil {
+		t.Fatalf("invalid response json: %v", err)
+	}
+	if !strings.Contains(r.Stdout, "--network testnet") {
+		t.Fatalf("expected network rewritten to testnet, got stdout=%q", r.Stdout)
+	}
+}
+
+func TestHedgedReadCommand(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "execute,query")
+	t.Setenv("ENDPOINT", "https://primary-rpc")
+	t.Setenv("HEDGE_ENDPOINTS", "https://secondary-rpc")
+
+	body := request.InvokeRequest{Args: []string{"query", "program", "credits.aleo"}}
+	b, _ := json.Marshal(body)
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	var r Response
+	if err := json.Unmarshal([]byte(resp.Body), &r); err != nil {
+		t.Fatalf("invalid response json: %v", err)
+	}
+	ep := r.Meta["endpoint"]
+	if ep != "https://primary-rpc" && ep != "https://secondary-rpc" {
+		t.Fatalf("expected winning endpoint in meta, got %q", ep)
+	}
+	if !strings.Contains(r.Stdout, "--endpoint "+ep) {
+		t.Fatalf("stdout should come from the winning endpoint %q: %q", ep, r.Stdout)
+	}
+}
+
+func TestExecutionReceipt(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "execute")
+	t.Setenv("RECEIPT_PROGRAM", "receipts.aleo")
+
+	body := request.InvokeRequest{Args: []string{"execute", "token.aleo/mint"}}
+	b, _ := json.Marshal(body)
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	var r Response
+	if err := json.Unmarshal([]byte(resp.Body), &r); err != nil {
+		t.Fatalf("invalid response json: %v", err)
+	}
+	if len(r.Meta["receipt"]) != 64 || r.Meta["receiptError"] != "" {
+		t.Fatalf("expected receipt hash in meta, got %v", r.Meta)
+	}
+}
+
+func TestQuota_FailedRunRefundsSpend(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DAILY_SPEND_LIMIT", "1000")
+
+	spent := func(bin string) uint64 {
+		t.Setenv("LEO_BIN", bin)
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "--priority-fee", "100"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "198.51.100.8"}},
+			Body:           string(b),
+		})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected response %d: %s", resp.StatusCode, resp.Body)
+		}
+		return quotas.Snapshot("ip:198.51.100.8").Spend.Used
+	}
+	if used := spent("false"); used != 0 {
+		t.Fatalf("expected a failed execute's fee to be refunded, spent %d", used)
+	}
+	if used := spent("true"); used != 100 {
+		t.Fatalf("expected a successful execute to be charged, spent %d", used)
+	}
+}
+
+func TestQuota_RateLimitAndEndpoint(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "execute")
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "1")
+
+	body := request.InvokeRequest{Args: []string{"execute", "token.aleo/mint"}}
+	b, _ := json.Marshal(body)
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "198.51.100.7"}},
+		Body:           string(b),
+	}
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		resp, err := handler(context.Background(), req)
+		if err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("call %d: expected %d, got %d body=%s", i, want, resp.StatusCode, resp.Body)
+		}
+		if want == http.StatusTooManyRequests && resp.Headers["Retry-After"] == "" {
+			t.Fatalf("expected Retry-After header")
+		}
+	}
+
+	get := events.LambdaFunctionURLRequest{
+		RawPath:        "/quota",
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "GET", SourceIP: "198.51.100.7"}},
+	}
+	resp, err := handler(context.Background(), get)
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	var q quota.Quota
+	if err := json.Unmarshal([]byte(resp.Body), &q); err != nil {
+		t.Fatalf("invalid quota json: %v", err)
+	}
+	if q.Identity != "ip:198.51.100.7" || q.RateLimit == nil || q.RateLimit.Remaining != 0 {
+		t.Fatalf("unexpected quota: %+v", q)
+	}
+}
+
+func TestMaxWaitUpgradesToJob(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "slow-leo")
+	if err := os.WriteFile(bin, []byte("#!/bin/sh\necho started\nsleep 2\necho finished\n"), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("LEO_BIN", bin)
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public"}, MaxWaitSeconds: 1, Tags: map[string]string{"order": "42"}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("expected 202, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	var job jobs.Job
+	if err := json.Unmarshal([]byte(resp.Body), &job); err != nil {
+		t.Fatalf("invalid job json: %v", err)
+	}
+	if job.Status != jobs.StatusRunning || !strings.Contains(job.Stdout, "started") {
+		t.Fatalf("expected running job with partial output, got %+v", job)
+	}
+	if resp.Headers["Location"] != "/jobs/"+job.ID {
+		t.Fatalf("unexpected Location header %q", resp.Headers["Location"])
+	}
+
+	for query, want := range map[string]int{"tag=order:42": 1, "tag=order:43": 0} {
+		list := events.LambdaFunctionURLRequest{
+			RawPath:        "/jobs",
+			RawQueryString: query,
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "GET"}},
+		}
+		resp, _ := handler(context.Background(), list)
+		var out struct{ Jobs []jobs.Job }
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		if resp.StatusCode != 200 || len(out.Jobs) != want {
+			t.Fatalf("GET /jobs?%s: expected %d jobs, got %d: %s", query, want, resp.StatusCode, resp.Body)
+		}
+	}
+
+	poll := events.LambdaFunctionURLRequest{
+		RawPath:        "/jobs/" + job.ID,
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "GET"}},
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != jobs.StatusDone && time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		resp, _ = handler(context.Background(), poll)
+		if resp.StatusCode != 200 {
+			t.Fatalf("poll returned %d: %s", resp.StatusCode, resp.Body)
+		}
+		job = jobs.Job{}
+		_ = json.Unmarshal([]byte(resp.Body), &job)
+	}
+	if job.Status != jobs.StatusDone {
+		t.Fatalf("job did not finish: %+v", job)
+	}
+	result, _ := json.Marshal(job.Result)
+	var r Response
+	_ = json.Unmarshal(result, &r)
+	if r.ExitCode != 0 || !strings.Contains(r.Stdout, "finished") {
+		t.Fatalf("unexpected job result: %+v", r)
+	}
+}
+
+func TestJournalAction(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("JOURNAL_DIR", dir)
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public", "--private-key", "APrivateKey1secret"}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, _ := handler(context.Background(), req)
+	var r Response
+	_ = json.Unmarshal([]byte(resp.Body), &r)
+	id := r.Meta["journal"]
+	if id == "" {
+		t.Fatalf("expected journal id in meta: %s", resp.Body)
+	}
+
+	b, _ = json.Marshal(request.InvokeRequest{Action: "journal", Params: map[string]any{"id": id}})
+	req.Body = string(b)
+	if resp, _ := handler(context.Background(), req); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin caller, got %d", resp.StatusCode)
+	}
+
+	req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+		IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"},
+	}
+	resp, _ = handler(context.Background(), req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	var e journal.Entry
+	_ = json.Unmarshal([]byte(resp.Body), &e)
+	if e.Status != journal.StatusFinished || e.PID == 0 || !strings.Contains(e.Stdout, "transfer_public") {
+		t.Fatalf("unexpected journal entry: %+v", e)
+	}
+	// DRY_RUN echoes argv to stdout, so only the recorded argv is checked here.
+	if slices.Contains(e.Args, "APrivateKey1secret") {
+		t.Fatalf("journal args must not contain the private key: %v", e.Args)
+	}
+}
+
+func TestEncodeJSONMatchesMarshal(t *testing.T) {
+	cases := []any{
+		Response{},
+		Response{ExitCode: 1, Duration: 1.5e-7, Stdout: "out <tag> \xff", Stderr: "err\n", Truncated: true, Meta: map[string]string{"z": "1", "a": "2"}},
+		Response{Events: []network.Event{{Kind: "output", Type: "record", Value: "record1<x>"}}},
+		Response{Verified: new(bool), Diffs: []expect.Diff{{Program: "token.aleo", Mapping: "account", Key: "aleo1<x>", Want: "5u64"}}},
+		Response{Warnings: []warnings.Warning{{Code: warnings.OutputTruncated, Message: "cut <here>"}}},
+		Response{Debug: &debugBundle{Env: map[string]string{"A": "<b>"}, Argv: []string{"leo"}, Processes: []debugProcess{{PID: 1}}}},
+		Response{ExitCode: 1, Code: classify.InsufficientBalance},
+		map[string]string{"error": "boom & bust"},
+	}
+	for _, v := range cases {
+		want, _ := json.Marshal(v)
+		if got := encodeJSON(v); got != string(want) {
+			t.Fatalf("encodeJSON mismatch:\n got %s\nwant %s", got, want)
+		}
+	}
+	// writeJSON hand-encodes Response; new fields must be added there too.
+	if n := reflect.TypeFor[Response]().NumField(); n != 12 {
+		t.Fatalf("Response has %d fields; update Response.writeJSON and this test", n)
+	}
+}
+
+func TestFitResponse(t *testing.T) {
+	small := Response{Stdout: "ok\n", Meta: map[string]string{}}
+	if fitResponse(&small, responseLimit) || small.Stdout != "ok\n" || small.Truncated {
+		t.Fatalf("a small response was changed: %+v", small)
+	}
+
+	// Quotes and newlines are escaped twice, so 4 MB of this is over the limit.
+	line := `{"value": "1u64"} "é"` + "\n"
+	r := Response{
+		Stdout: strings.Repeat(line, (4<<20)/len(line)) + "transaction at1abc",
+		Stderr: strings.Repeat("warning <x>\n", 1000) + "done",
+		Meta:   map[string]string{"k": "v"},
+	}
+	if !fitResponse(&r, responseLimit) || !r.Truncated {
+		t.Fatal("expected an oversized response to be cut")
+	}
+	if size := responseSize(r); size+responseHeadroom > responseLimit || size < responseLimit/2 {
+		t.Fatalf("fitted response is %d bytes, want just under %d", size, responseLimit-responseHeadroom)
+	}
+	if !strings.HasSuffix(r.Stdout, "transaction at1abc") || !strings.HasSuffix(r.Stderr, "done") || !utf8.ValidString(r.Stdout) {
+		t.Fatalf("expected the tails to be kept intact")
+	}
+
+	// Behind an ALB, the response must fit its 1 MB body limit.
+	if !fitResponse(&r, albResponseLimit) || responseSize(r) > albResponseLimit || !strings.HasSuffix(r.Stdout, "transaction at1abc") {
+		t.Fatalf("expected the response to fit an ALB, got %d bytes", responseSize(r))
+	}
+
+	cfg := &EnvConfig{}
+	if cfg.outputCap(false) != responseLimit || cfg.outputCap(true) != maxFullOutputBytes {
+		t.Fatalf("unexpected automatic caps %d, %d", cfg.outputCap(false), cfg.outputCap(true))
+	}
+	cfg.MaxOutputBytes = 1 << 20
+	if cfg.outputCap(false) != 1<<20 || cfg.outputCap(true) != maxFullOutputBytes {
+		t.Fatalf("unexpected caps with MAX_OUTPUT_BYTES %d, %d", cfg.outputCap(false), cfg.outputCap(true))
+	}
+}
+
+func TestInvalidateAction(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	health.Failure("https://rpc")
+
+	b, _ := json.Marshal(request.InvokeRequest{Action: "invalidate", Params: map[string]any{"name": "endpointHealth"}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"},
+			Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}},
+		},
+		Body: string(b),
+	}
+	resp, _ := handler(context.Background(), req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if health.Get("https://rpc").Failures != 0 {
+		t.Fatalf("endpoint health should have been reset")
+	}
+
+	b, _ = json.Marshal(request.InvokeRequest{Action: "invalidate", Params: map[string]any{"name": "nope"}})
+	req.Body = string(b)
+	if resp, _ := handler(context.Background(), req); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown state, got %d", resp.StatusCode)
+	}
+}
+
+func TestNetworkPresets(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("NETWORKS", `{"testnet":{"endpoint":"https://testnet-rpc","priorityFee":500,"explorer":"https://testnet.explorer/tx/{txid}"}}`)
+
+	// DRY_RUN echoes argv, so a transaction ID among the inputs shows up in stdout.
+	tx := "at1" + strings.Repeat("q", 58)
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public", tx, "--network", "testnet"}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, _ := handler(context.Background(), req)
+	var r Response
+	if err := json.Unmarshal([]byte(resp.Body), &r); err != nil {
+		t.Fatalf("invalid response json: %v", err)
+	}
+	if !strings.Contains(r.Stdout, "--endpoint https://testnet-rpc") || !strings.Contains(r.Stdout, "--priority-fee 500") {
+		t.Fatalf("expected preset endpoint and fee to be injected: %q", r.Stdout)
+	}
+	if r.Meta["transactionId"] != tx || r.Meta["explorerUrl"] != "https://testnet.explorer/tx/"+tx {
+		t.Fatalf("unexpected meta: %v", r.Meta)
+	}
+
+	b, _ = json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public", "--network", "testnet", "--endpoint", "https://mine"}})
+	req.Body = string(b)
+	resp, _ = handler(context.Background(), req)
+	r = Response{}
+	_ = json.Unmarshal([]byte(resp.Body), &r)
+	if strings.Contains(r.Stdout, "testnet-rpc") {
+		t.Fatalf("caller-pinned endpoint must win: %q", r.Stdout)
+	}
+}
+
+func TestExplorerLinkForDeploy(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "deploy")
+
+	tx := "at1" + strings.Repeat("z", 58)
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"deploy", "--network", "testnet", "token.aleo", tx}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, _ := handler(context.Background(), req)
+	var r Response
+	_ = json.Unmarshal([]byte(resp.Body), &r)
+	if want := "https://testnet.explorer.provable.com/transaction/" + tx; r.Meta["explorerUrl"] != want {
+		t.Fatalf("expected default testnet explorer link %q, got meta %v", want, r.Meta)
+	}
+}
+
+func TestNotifyOnFailure(t *testing.T) {
+	msgs := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		msgs <- body["text"]
+	}))
+	defer srv.Close()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("LEO_BIN", "false")
+	t.Setenv("NOTIFY_SLACK_WEBHOOK", srv.URL)
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, _ := handler(context.Background(), req)
+	if strings.Contains(resp.Body, "notifyError") {
+		t.Fatalf("unexpected notify error: %s", resp.Body)
+	}
+	select {
+	case msg := <-msgs:
+		if !strings.Contains(msg, "leo execute token.aleo/mint failed (exit 1)") {
+			t.Fatalf("unexpected message %q", msg)
+		}
+	default:
+		t.Fatalf("expected a failure notification")
+	}
+}
+
+func TestAlertsAndCircuitBreaker(t *testing.T) {
+	alerts := make(chan map[string]any, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		alerts <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+
+	script := filepath.Join(t.TempDir(), "leo")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho 'Error: error sending request: connection refused' >&2\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("LEO_BIN", script)
+	t.Setenv("ENDPOINT", "https://rpc.test")
+	t.Setenv("PAGERDUTY_ROUTING_KEY", "rk")
+	t.Setenv("PAGERDUTY_EVENTS_URL", srv.URL)
+	t.Setenv("ALERT_FAILURE_STREAK", "2")
+	t.Setenv("BREAKER_FAILURE_THRESHOLD", "2")
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	for range 2 {
+		if resp, _ := handler(context.Background(), req); resp.StatusCode != http.StatusOK || strings.Contains(resp.Body, "alertError") {
+			t.Fatalf("unexpected response %d: %s", resp.StatusCode, resp.Body)
+		}
+	}
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case a := <-alerts:
+			got[a["dedup_key"].(string)] = true
+		default:
+			t.Fatalf("expected a streak and a circuit alert, got %v", got)
+		}
+	}
+	if !got["failure_streak:token.aleo"] || !got["circuit_open:https://rpc.test"] {
+		t.Fatalf("unexpected alerts %v", got)
+	}
+
+	resp, _ := handler(context.Background(), req)
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Headers["Retry-After"] != "30" {
+		t.Fatalf("expected the open circuit to fail fast, got %d %v", resp.StatusCode, resp.Headers)
+	}
+}
+
+func TestRetryOnlyReadCommands(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "leo")
+	count := filepath.Join(dir, "runs")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho run \"$*\" >> "+count+"\necho 'failed to download' >&2\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("LEO_BIN", script)
+	t.Setenv("ALLOWED_COMMANDS", "execute,query")
+	t.Setenv("RETRY_MAX_ATTEMPTS", "3")
+	t.Setenv("RETRY_EXIT_CODES", "1")
+	t.Setenv("RETRY_BACKOFF", "1ms")
+
+	for _, tc := range []struct {
+		args []string
+		runs int
+	}{
+		{[]string{"execute", "token.aleo/mint", "1u64"}, 1},
+		{[]string{"query", "program", "token.aleo"}, 3},
+	} {
+		if err := os.Remove(count); err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		b, _ := json.Marshal(request.InvokeRequest{Args: tc.args})
+		req := events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		}
+		if _, err := handler(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		out, err := os.ReadFile(count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(out), "run "+tc.args[0]); got != tc.runs {
+			t.Fatalf("%s ran %d times, want %d: %s", tc.args[0], got, tc.runs, out)
+		}
+	}
+}
+
+func TestSizeMetrics(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("METRICS_NAMESPACE", "LeoLambda")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	var emf bytes.Buffer
+	metricsOut = &emf
+	t.Cleanup(func() { metricsOut = os.Stdout })
+	sizeMetrics.Reset()
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"},
+			Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}},
+		},
+		Body: string(b),
+	}
+	if resp, _ := handler(context.Background(), req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if !strings.Contains(emf.String(), `"Contract":"token.aleo"`) {
+		t.Fatalf("expected an EMF line, got %q", emf.String())
+	}
+
+	b, _ = json.Marshal(request.InvokeRequest{Action: "metrics", Params: map[string]any{"contract": "token.aleo"}})
+	req.Body = string(b)
+	resp, _ := handler(context.Background(), req)
+	var out struct{ Series []metrics.Summary }
+	if err := json.Unmarshal([]byte(resp.Body), &out); err != nil || len(out.Series) != 1 {
+		t.Fatalf("unexpected metrics response %d: %s", resp.StatusCode, resp.Body)
+	}
+	if s := out.Series[0]; s.Count != 1 || s.Metrics[metrics.ArgCount].Max == 0 || s.Metrics[metrics.StdoutBytes].P50 == 0 {
+		t.Fatalf("unexpected summary %+v", s)
+	}
+}
+
+func TestAllowlistAction(t *testing.T) {
+	params := map[string]string{}
+	ssm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ Name, Value string }
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		if r.Header.Get("X-Amz-Target") == "AmazonSSM.PutParameter" {
+			params[in.Name] = in.Value
+			return
+		}
+		v, ok := params[in.Name]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ParameterNotFound"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Parameter": map[string]string{"Value": v}})
+	}))
+	defer ssm.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("ALLOWED_CONTRACTS", "credits.aleo")
+	t.Setenv("ALLOWLIST_PARAMETER", "/leo/allowlist")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", ssm.URL)
+
+	call := func(body request.InvokeRequest) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(body)
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"},
+				Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}},
+			},
+			Body: string(b),
+		})
+		return resp
+	}
+	exec := request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}}
+	manage := func(op string) int {
+		return call(request.InvokeRequest{Action: "allowlist", Params: map[string]any{"op": op, "contract": "token.aleo"}}).StatusCode
+	}
+
+	if got := call(exec).StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected 403 before onboarding, got %d", got)
+	}
+	if got := manage("add-contract"); got != http.StatusOK {
+		t.Fatalf("add-contract: got %d", got)
+	}
+	if got := call(exec).StatusCode; got != http.StatusOK {
+		t.Fatalf("expected onboarded contract to run, got %d", got)
+	}
+	if params["/leo/allowlist"] != `{"contracts":["token.aleo"]}` {
+		t.Fatalf("unexpected stored parameter %q", params["/leo/allowlist"])
+	}
+	if got := call(request.InvokeRequest{Action: "allowlist", Params: map[string]any{"op": "remove", "contract": "credits.aleo"}}).StatusCode; got != http.StatusConflict {
+		t.Fatalf("removing a configured contract should conflict, got %d", got)
+	}
+	if got := manage("remove"); got != http.StatusOK {
+		t.Fatalf("remove: got %d", got)
+	}
+	if got := call(exec).StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected 403 after removal, got %d", got)
+	}
+}
+
+func TestTimeReserveStopsLeoEarly(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "leo")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n[ \"$1\" = --version ] && echo 'leo 3.2.0' && exit 0\nsleep 5\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("LEO_BIN", script)
+	t.Setenv("TIME_RESERVE", "2500ms")
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint"}})
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	}
+	resp, _ := handler(ctx, req)
+	if ctx.Err() != nil {
+		t.Fatalf("handler should return before the invocation deadline")
+	}
+	var r Response
+	if err := json.Unmarshal([]byte(resp.Body), &r); err != nil || r.ExitCode == 0 || !strings.Contains(r.Stderr, "time budget exhausted") {
+		t.Fatalf("expected leo to be stopped by the time budget, got %d: %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	var uploads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			uploads = append(uploads, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	confirmInterval = time.Millisecond
+	t.Cleanup(func() { confirmInterval = 2 * time.Second })
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "execute,query")
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("OUTPUT_BUCKET", "leo-output")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+	call := func(body request.InvokeRequest) (events.LambdaFunctionURLResponse, Response) {
+		b, _ := json.Marshal(body)
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var r Response
+		_ = json.Unmarshal([]byte(resp.Body), &r)
+		return resp, r
+	}
+
+	query := request.InvokeRequest{Args: []string{"query", "program", "credits.aleo"}, Profile: "fast"}
+	if resp, _ := call(query); resp.StatusCode != http.StatusOK || resp.Headers["X-Leo-Cache"] != "" {
+		t.Fatalf("first fast query should run, got %d %v", resp.StatusCode, resp.Headers)
+	}
+	if resp, _ := call(query); resp.Headers["X-Leo-Cache"] != "hit" {
+		t.Fatalf("second fast query should be served from cache")
+	}
+
+	tx := "at1" + strings.Repeat("q", 58)
+	_, r := call(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", tx, "--network", "testnet"}, Profile: "thorough"})
+	if r.Meta["confirmed"] != "true" {
+		t.Fatalf("thorough execute should wait for confirmation, got meta %v", r.Meta)
+	}
+	if !strings.HasPrefix(r.Meta["stdoutObject"], "s3://leo-output/") || len(uploads) != 2 {
+		t.Fatalf("thorough execute should upload full output, got meta %v uploads %v", r.Meta, uploads)
+	}
+}
+
+func TestUsageAction(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("USAGE_DIR", t.TempDir())
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+
+	call := func(body request.InvokeRequest) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(body)
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			Body: string(b),
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "203.0.113.9"},
+				Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}},
+			},
+		})
+		return resp
+	}
+	for range 2 {
+		call(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public", "--priority-fee", "100"}})
+	}
+
+	resp := call(request.InvokeRequest{Action: "usage"})
+	var out struct {
+		Callers []usage.Report `json:"callers"`
+	}
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || len(out.Callers) != 1 {
+		t.Fatalf("unexpected usage response %d: %s", resp.StatusCode, resp.Body)
+	}
+	r := out.Callers[0]
+	if r.Invocations != 2 || r.SuccessRate != 1 || r.Fees != 200 || len(r.Days) != 1 {
+		t.Fatalf("unexpected report: %+v", r)
+	}
+	if resp := call(request.InvokeRequest{Action: "usage", Params: map[string]any{"from": "yesterday"}}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad date, got %d", resp.StatusCode)
+	}
+}
+
+func TestKeysAction(t *testing.T) {
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("USAGE_DIR", t.TempDir())
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("PRIVATE_KEY", "APrivateKey1main")
+	t.Setenv("FEE_PRIVATE_KEY", "APrivateKey1fee")
+	t.Setenv("FEE_PAYERS", `{"token.aleo": "APrivateKey1token"}`)
+	t.Setenv("KEY_UNUSED_DAYS", "0")
+
+	call := func(body request.InvokeRequest) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(body)
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			Body: string(b),
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"},
+				Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}},
+			},
+		})
+		return resp
+	}
+	for range 2 {
+		call(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}})
+	}
+	// A caller's own fee key is not tracked.
+	call(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public", "--fee-private-key", "APrivateKey1caller"}})
+
+	resp := call(request.InvokeRequest{Action: "keys"})
+	var out struct {
+		Keys     []keyuse.Key `json:"keys"`
+		Warnings []string     `json:"warnings"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal([]byte(resp.Body), &out) != nil || len(out.Keys) != 3 {
+		t.Fatalf("unexpected keys response %d: %s", resp.StatusCode, resp.Body)
+	}
+	if k := out.Keys[0]; k.Alias != "PRIVATE_KEY" || k.UsesToday != 3 || k.Contract != "credits.aleo" {
+		t.Fatalf("unexpected PRIVATE_KEY use %+v", k)
+	}
+	if k := out.Keys[1]; k.Alias != "FEE_PRIVATE_KEY" || k.UsesToday != 0 || k.LastUsed != nil {
+		t.Fatalf("unexpected FEE_PRIVATE_KEY use %+v", k)
+	}
+	if k := out.Keys[2]; k.Alias != "FEE_PAYERS[token.aleo]" || k.UsesToday != 2 || k.Contract != "token.aleo" {
+		t.Fatalf("unexpected FEE_PAYERS use %+v", k)
+	}
+	if strings.Contains(resp.Body, "APrivateKey1") || len(out.Warnings) != 0 {
+		t.Fatalf("expected no key values and no warnings without KEY_UNUSED_DAYS, got %s", resp.Body)
+	}
+
+	// A month on, the fee key nobody used is a candidate for removal.
+	t.Setenv("KEY_UNUSED_DAYS", "30")
+	clk = clock.NewFake(time.Now().AddDate(0, 0, 31))
+	t.Cleanup(func() { clk = clock.System })
+	resp = call(request.InvokeRequest{Action: "keys"})
+	out.Warnings = nil
+	if json.Unmarshal([]byte(resp.Body), &out) != nil || len(out.Warnings) != 3 || !out.Keys[1].Unused || !strings.Contains(out.Warnings[1], "FEE_PRIVATE_KEY") {
+		t.Fatalf("expected every key to be flagged unused, got %s", resp.Body)
+	}
+}
+
+func TestExport(t *testing.T) {
+	uploads := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		uploads[r.URL.Path] = b
+	}))
+	defer srv.Close()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("JOURNAL_DIR", t.TempDir())
+	t.Setenv("USAGE_DIR", t.TempDir())
+	t.Setenv("EXPORT_BUCKET", "leo-analytics")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+	call := func(body request.InvokeRequest) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(body)
+		raw, _ := json.Marshal(events.LambdaFunctionURLRequest{
+			Body: string(b),
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"},
+				Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}},
+			},
+		})
+		out, err := invoke(context.Background(), raw)
+		if err != nil {
+			t.Fatalf("invoke: %v", err)
+		}
+		return out.(events.LambdaFunctionURLResponse)
+	}
+	call(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public"}, Tags: map[string]string{"order": "42"}})
+
+	today := time.Now().UTC().Format("2006-01-02")
+	resp := call(request.InvokeRequest{Action: "export", Params: map[string]any{"date": today}})
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Body, `"rows":1`) {
+		t.Fatalf("unexpected export response %d: %s", resp.StatusCode, resp.Body)
+	}
+	for _, path := range []string{"/leo-analytics/leo-lambda/journal/dt=" + today + "/entries.parquet", "/leo-analytics/leo-lambda/usage/dt=" + today + "/rollups.parquet"} {
+		if b := uploads[path]; !bytes.HasPrefix(b, []byte("PAR1")) || !bytes.Contains(b, []byte("caller")) {
+			t.Fatalf("expected a Parquet object at %s, got %d bytes", path, len(b))
+		}
+	}
+
+	// Scheduled events export the previous day.
+	out, err := invoke(context.Background(), json.RawMessage(`{"source": "aws.events", "detail-type": "Scheduled Event", "detail": {}}`))
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	if err != nil || out.(map[string]any)["date"] != yesterday {
+		t.Fatalf("unexpected scheduled export: %v (%v)", out, err)
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	uploads := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/mainnet/block/height/latest":
+			_, _ = w.Write([]byte("42"))
+		case r.Method == http.MethodPut:
+			uploads[r.URL.Path], _ = io.ReadAll(r.Body)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("JOURNAL_DIR", t.TempDir())
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("STATUS_BUCKET", "leo-status")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public"}})
+	_, _ = handler(context.Background(), events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "203.0.113.9"}},
+		Body:           string(b),
+	})
+	if _, err := invoke(context.Background(), json.RawMessage(`{"task": "status"}`)); err != nil {
+		t.Fatalf("status task: %v", err)
+	}
+
+	var snap statusSnapshot
+	if err := json.Unmarshal(uploads["/leo-status/status.json"], &snap); err != nil {
+		t.Fatalf("status.json: %v (%s)", err, uploads["/leo-status/status.json"])
+	}
+	if snap.SuccessRate == nil || *snap.SuccessRate != 1 || len(snap.Recent) != 1 || snap.Recent[0].Program != "credits.aleo" {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+	if len(snap.Endpoints) != 1 || !snap.Endpoints[0].Reachable || snap.Endpoints[0].Height != 42 {
+		t.Fatalf("unexpected endpoints: %+v", snap.Endpoints)
+	}
+	page := string(uploads["/leo-status/index.html"])
+	if !strings.Contains(page, "credits.aleo") || strings.Contains(page, "203.0.113.9") || strings.Contains(string(uploads["/leo-status/status.json"]), "203.0.113.9") {
+		t.Fatalf("unexpected page:\n%s", page)
+	}
+}
+
+func TestHMACAuthRotation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("JOURNAL_DIR", dir)
+	t.Setenv("HMAC_CLIENTS", `{"partner": {"primary": "new", "secondary": "old", "secondaryUntil": "`+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)+`"}}`)
+
+	body := `{"args": ["execute", "credits.aleo/transfer_public"]}`
+	req := events.LambdaFunctionURLRequest{
+		RawPath:        "/",
+		Body:           body,
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "203.0.113.9"}},
+	}
+	if resp, _ := handler(context.Background(), req); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unsigned request, got %d", resp.StatusCode)
+	}
+
+	ts := time.Now().Unix()
+	req.Headers = map[string]string{
+		"x-leo-client":            "partner",
+		"x-leo-timestamp":         strconv.FormatInt(ts, 10),
+		"x-leo-request-signature": hmacauth.Sign("old", ts, "POST", "/", "", []byte(body)),
+	}
+	resp, _ := handler(context.Background(), req)
+	var r Response
+	_ = json.Unmarshal([]byte(resp.Body), &r)
+	if resp.StatusCode != http.StatusOK || r.Meta["authKey"] != hmacauth.KeySecondary {
+		t.Fatalf("expected the secondary secret to be accepted, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	e, err := (&journal.Journal{Dir: dir}).Read(r.Meta["journal"])
+	if err != nil || e.Caller != "hmac:partner" || e.AuthKey != hmacauth.KeySecondary {
+		t.Fatalf("unexpected journal entry %+v (%v)", e, err)
+	}
+}
+
+func TestOIDCBearerAndGroupPolicy(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": srv.URL + "/keys"})
+		case "/keys":
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+				"kty": "RSA", "kid": "k1",
+				"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		}
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("OIDC_ISSUER", srv.URL)
+	t.Setenv("OIDC_AUDIENCE", "leo")
+	t.Setenv("GROUP_CONTRACTS", `{"treasury": ["token.aleo"]}`)
+
+	h, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	c, _ := json.Marshal(map[string]any{"iss": srv.URL, "aud": "leo", "sub": "alice", "groups": []string{"treasury"}, "exp": time.Now().Add(time.Hour).Unix()})
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	token := input + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	call := func(contract, auth string) int {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/transfer_public"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			Headers:        map[string]string{"authorization": auth},
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "203.0.113.9"}},
+			Body:           string(b),
+		})
+		return resp.StatusCode
+	}
+	if got := call("token.aleo", ""); got != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", got)
+	}
+	if got := call("token.aleo", "Bearer "+token+"x"); got != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a tampered token, got %d", got)
+	}
+	if got := call("token.aleo", "Bearer "+token); got != http.StatusOK {
+		t.Fatalf("expected 200 for a granted contract, got %d", got)
+	}
+	if got := call("credits.aleo", "Bearer "+token); got != http.StatusForbidden {
+		t.Fatalf("expected 403 for a contract outside the caller's groups, got %d", got)
+	}
+}
+
+func TestInvitationTokens(t *testing.T) {
+	items := map[string]map[string]map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Item                      map[string]map[string]string
+			Key                       map[string]map[string]string
+			ExpressionAttributeValues map[string]map[string]string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.PutItem":
+			items[in.Item["id"]["S"]] = in.Item
+			_, _ = w.Write([]byte(`{}`))
+		case "DynamoDB_20120810.UpdateItem":
+			it := items[in.Key["id"]["S"]]
+			if it == nil || it["uses"]["N"] == it["maxUses"]["N"] || it["method"]["S"] != in.ExpressionAttributeValues[":method"]["S"] {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"ConditionalCheckFailedException","message":"failed"}`))
+				return
+			}
+			uses, _ := strconv.Atoi(it["uses"]["N"])
+			it["uses"] = map[string]string{"N": strconv.Itoa(uses + 1)}
+			_ = json.NewEncoder(w).Encode(map[string]any{"Attributes": it})
+		case "DynamoDB_20120810.GetItem":
+			_ = json.NewEncoder(w).Encode(map[string]any{"Item": items[in.Key["id"]["S"]]})
+		}
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("HMAC_CLIENTS", `{"partner": {"primary": "secret"}}`)
+	t.Setenv("INVITE_TABLE", "invites")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+	b, _ := json.Marshal(request.InvokeRequest{Action: "invite", Params: map[string]any{"contract": "token.aleo", "method": "mint_public", "maxUses": 1}})
+	resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"},
+			Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}},
+		},
+		Body: string(b),
+	})
+	var minted struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal([]byte(resp.Body), &minted); resp.StatusCode != http.StatusOK || err != nil || minted.Token == "" {
+		t.Fatalf("mint: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	call := func(token string, args ...string) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			Headers:        map[string]string{"x-leo-invitation": token},
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "203.0.113.9"}},
+			Body:           string(b),
+		})
+		return resp
+	}
+	if got := call("", "execute", "token.aleo/mint_public").StatusCode; got != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", got)
+	}
+	if got := call(minted.Token, "execute", "token.aleo/transfer_public").StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected 403 outside the token's scope, got %d", got)
+	}
+	if got := call(minted.Token, "query", "program", "token.aleo").StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected 403 for a non-execute command, got %d", got)
+	}
+	resp = call(minted.Token, "execute", "token.aleo/mint_public")
+	var out Response
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || out.Meta["invitationUses"] != "1/1" {
+		t.Fatalf("expected the invited transition to run, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if got := call(minted.Token, "execute", "token.aleo/mint_public").StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected 403 once the token is used up, got %d", got)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("HMAC_CLIENTS", `{"partner": {"primary": "secret"}}`)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+
+	call := func(method, origin string, headers map[string]string) events.LambdaFunctionURLResponse {
+		h := map[string]string{"origin": origin}
+		for k, v := range headers {
+			h[k] = v
+		}
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			Headers:        h,
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: method, SourceIP: "203.0.113.9"}},
+			Body:           `{"args": ["--version"]}`,
+		})
+		return resp
+	}
+	// The preflight succeeds without credentials and lists the custom headers.
+	resp := call(http.MethodOptions, "https://app.example.com", map[string]string{"access-control-request-method": "POST"})
+	if resp.StatusCode != http.StatusNoContent || !strings.Contains(resp.Headers["Access-Control-Allow-Headers"], "X-Leo-Request-Signature") {
+		t.Fatalf("unexpected preflight %d %v", resp.StatusCode, resp.Headers)
+	}
+	if got := call(http.MethodOptions, "https://evil.example", map[string]string{"access-control-request-method": "POST"}).StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected 403 preflight for an unknown origin, got %d", got)
+	}
+	// Actual responses, errors included, carry the origin so browsers can read them.
+	resp = call(http.MethodPost, "https://app.example.com", nil)
+	if resp.StatusCode != http.StatusUnauthorized || resp.Headers["Access-Control-Allow-Origin"] != "https://app.example.com" {
+		t.Fatalf("unexpected response %d %v", resp.StatusCode, resp.Headers)
+	}
+	if _, ok := call(http.MethodPost, "https://evil.example", nil).Headers["Access-Control-Allow-Origin"]; ok {
+		t.Fatalf("expected no CORS headers for an unknown origin")
+	}
+}
+
+func TestRequestLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logOutput = &buf
+	t.Cleanup(func() { logOutput = os.Stdout })
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("LOG_SAMPLE_RATE", "0")
+
+	call := func(args ...string) {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args})
+		_, _ = handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+	}
+	call("execute", "token.aleo/mint", "--private-key", "APrivateKey1secret")
+	if buf.Len() != 0 {
+		t.Fatalf("expected the successful request to be sampled out, got %q", buf.String())
+	}
+	call("deploy", "--private-key", "APrivateKey1secret")
+	var e struct {
+		Status  int
+		Failed  bool
+		Request struct{ Args []string }
+	}
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil || e.Status != http.StatusForbidden || !e.Failed {
+		t.Fatalf("expected the rejected request to be logged, got %q (%v)", buf.String(), err)
+	}
+	if strings.Contains(buf.String(), "APrivateKey1secret") || !slices.Contains(e.Request.Args, "***") {
+		t.Fatalf("expected the private key redacted, got %q", buf.String())
+	}
+
+	buf.Reset()
+	t.Setenv("LOG_CAPTURE_BODY", "never")
+	call("deploy")
+	if strings.Contains(buf.String(), `"request"`) {
+		t.Fatalf("expected no payload with LOG_CAPTURE_BODY=never, got %q", buf.String())
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	var logs, emf bytes.Buffer
+	logOutput, metricsOut = &logs, &emf
+	orig := runCommand
+	runCommand = func(context.Context, executor.Config) executor.Result { panic("boom") }
+	t.Cleanup(func() { logOutput, metricsOut, runCommand = os.Stdout, os.Stdout, orig })
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("METRICS_NAMESPACE", "LeoLambda")
+
+	resp, err := handler(context.Background(), events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           `{"args": ["execute", "token.aleo/mint"]}`,
+	})
+	var out struct{ Error, IncidentID string }
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if err != nil || resp.StatusCode != http.StatusInternalServerError || out.IncidentID == "" {
+		t.Fatalf("expected a structured 500, got %d %s (%v)", resp.StatusCode, resp.Body, err)
+	}
+	if !strings.Contains(logs.String(), `"incidentId":"`+out.IncidentID+`"`) || !strings.Contains(logs.String(), "goroutine") {
+		t.Fatalf("expected the stack trace logged under the incident ID, got %q", logs.String())
+	}
+	if !strings.Contains(emf.String(), `"Panics":1`) {
+		t.Fatalf("expected a Panics metric, got %q", emf.String())
+	}
+}
+
+func TestDebugMeta(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+
+	call := func() Response {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		resp, _ := handler(ctx, events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           `{"args": ["execute", "token.aleo/mint"]}`,
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return out
+	}
+	if out := call(); out.Meta["containerInvocations"] != "" {
+		t.Fatalf("expected no diagnostics without DEBUG_META, got %v", out.Meta)
+	}
+	t.Setenv("DEBUG_META", "true")
+	first := call()
+	second := call()
+	n1, _ := strconv.Atoi(first.Meta["containerInvocations"])
+	n2, _ := strconv.Atoi(second.Meta["containerInvocations"])
+	if n1 == 0 || n2 != n1+1 || first.Meta["container"] == "" || first.Meta["containerStartedAt"] == "" {
+		t.Fatalf("unexpected diagnostics %v then %v", first.Meta, second.Meta)
+	}
+	if ms, _ := strconv.Atoi(first.Meta["remainingMsAtStart"]); ms <= 0 || ms > 60000 {
+		t.Fatalf("unexpected remaining time %q", first.Meta["remainingMsAtStart"])
+	}
+	if first.Meta["tmpFreeBytes"] == "" {
+		t.Fatalf("expected free temp disk space, got %v", first.Meta)
+	}
+}
+
+func TestWorkdirTemplate(t *testing.T) {
+	root := t.TempDir()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("WORKDIR_ROOT", root)
+	t.Setenv("WORKDIR", root+"/{tenant}/{requestId}")
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "req-1"})
+	resp, _ := handler(ctx, events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "203.0.113.9"}},
+		Body:           `{"args": ["execute", "token.aleo/mint"]}`,
+	})
+	var out Response
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	want := filepath.Join(root, "ip_203.0.113.9", "req-1")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out.Stdout, "--home "+want) {
+		t.Fatalf("expected --home %s, got %d %s", want, resp.StatusCode, resp.Body)
+	}
+	if _, err := os.Stat(want); !os.IsNotExist(err) {
+		t.Fatalf("expected the per-request workdir to be removed, got %v", err)
+	}
+
+	if got := workdirFor("/tmp/{tenant}", "r", "../../etc"); got != "/tmp/.._.._etc" {
+		t.Fatalf("expected path elements in the tenant to be neutralised, got %q", got)
+	}
+	t.Setenv("WORKDIR", "/var/leo")
+	resp, _ = handler(ctx, events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           `{"args": ["execute", "token.aleo/mint"]}`,
+	})
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected a WORKDIR outside WORKDIR_ROOT to be rejected, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestCallerHomeConfined(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("WORKDIR_ROOT", root)
+	t.Setenv("WORKDIR", root+"/leo")
+
+	call := func(home string) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "--home", home, "token.aleo/mint"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp
+	}
+	want, _ := filepath.EvalSymlinks(root)
+	want = filepath.Join(want, "mine")
+	if resp := call(root + "/x/../mine"); resp.StatusCode != http.StatusOK || !strings.Contains(resp.Body, "--home "+want+" ") {
+		t.Fatalf("expected the caller's home to be canonicalized to %s, got %d %s", want, resp.StatusCode, resp.Body)
+	}
+	for _, home := range []string{"/etc", root + "/../escape", "relative"} {
+		if resp := call(home); resp.StatusCode != http.StatusBadRequest || !strings.Contains(resp.Body, "invalid --home") {
+			t.Fatalf("expected --home %s to be rejected, got %d %s", home, resp.StatusCode, resp.Body)
+		}
+	}
+}
+
+func TestContentTypes(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+
+	call := func(contentType, body string) events.LambdaFunctionURLResponse {
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			Headers:        map[string]string{"content-type": contentType},
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           body,
+		})
+		return resp
+	}
+	for contentType, body := range map[string]string{
+		"application/x-www-form-urlencoded": "args=execute&args=token.aleo%2Fmint",
+		"text/plain":                        "execute token.aleo/mint",
+	} {
+		resp := call(contentType, body)
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(out.Stdout, "execute") || !strings.Contains(out.Stdout, "token.aleo/mint") {
+			t.Fatalf("%s: unexpected %d %s", contentType, resp.StatusCode, resp.Body)
+		}
+	}
+	if got := call("application/xml", "<args/>").StatusCode; got != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", got)
+	}
+}
+
+func TestQueryInvocation(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "execute")
+	t.Setenv("INVOKE_PRESETS", `{"mint": ["execute", "token.aleo/mint_public", "{recipient}", "{amount}u64"]}`)
+
+	call := func(method, query string) events.LambdaFunctionURLResponse {
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RawQueryString: query,
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: method}},
+		})
+		return resp
+	}
+	resp := call("GET", "preset=mint&recipient=aleo1abc&amount=5")
+	var out Response
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out.Stdout, "token.aleo/mint_public aleo1abc 5u64") {
+		t.Fatalf("preset: unexpected %d %s", resp.StatusCode, resp.Body)
+	}
+	// Query invocations go through the same policy chain as bodies.
+	if got := call("GET", "args=query&args=program").StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected 403 for a disallowed command, got %d", got)
+	}
+	if got := call("POST", "preset=mint&recipient=-k&amount=5").StatusCode; got != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a flag-like parameter, got %d", got)
+	}
+}
+
+func TestPresetChainVariables(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	var down atomic.Bool
+	var reads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reads.Add(1)
+		switch {
+		case down.Load():
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/testnet/block/height/latest":
+			_, _ = io.WriteString(w, "1200")
+		case r.URL.Path == "/testnet/program/token.aleo/mapping/balances/aleo1abc":
+			_, _ = io.WriteString(w, `"75u64"`)
+		default:
+			_, _ = io.WriteString(w, "null")
+		}
+	}))
+	defer srv.Close()
+	fc := clock.NewFake(time.Now())
+	clk = fc
+	t.Cleanup(func() { clk = clock.System })
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("CHAIN_VAR_STALE", "1m")
+	t.Setenv("INVOKE_PRESETS", `{
+		"settle": ["execute", "oracle.aleo/settle", "{who}", "{{mapping:token.aleo/balances[{who}] ?? 0u64}}", "{{height}}u32", "--network", "testnet"],
+		"strict": ["execute", "oracle.aleo/settle", "{{mapping:token.aleo/balances[{who}]}}", "--network", "testnet"],
+		"nonet": ["execute", "oracle.aleo/settle", "{{height}}u32"]
+	}`)
+
+	call := func(query string) (events.LambdaFunctionURLResponse, Response) {
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RawQueryString: query,
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "GET"}},
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp, out
+	}
+	resp, out := call("preset=settle&who=aleo1abc")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out.Stdout, "oracle.aleo/settle aleo1abc 75u64 1200u32") || len(out.Warnings) != 0 {
+		t.Fatalf("settle: unexpected %d %s", resp.StatusCode, resp.Body)
+	}
+	if _, out := call("preset=settle&who=aleo1xyz"); !strings.Contains(out.Stdout, "aleo1xyz 0u64 1200u32") {
+		t.Fatalf("default: unexpected %s", out.Stdout)
+	}
+	if resp, _ := call("preset=strict&who=aleo1xyz"); resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(resp.Body, i18n.ChainValueUnset) {
+		t.Fatalf("unset key: unexpected %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp, _ := call("preset=nonet"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("no network: unexpected %d %s", resp.StatusCode, resp.Body)
+	}
+
+	// Values are cached for CHAIN_VAR_TTL, then stand in for CHAIN_VAR_STALE while the
+	// node is down.
+	n := reads.Load()
+	call("preset=settle&who=aleo1abc")
+	if reads.Load() != n {
+		t.Fatal("expected cached chain state to be reused")
+	}
+	down.Store(true)
+	fc.Advance(10 * time.Second)
+	resp, out = call("preset=settle&who=aleo1abc")
+	if resp.StatusCode != http.StatusOK || len(out.Warnings) != 1 || out.Warnings[0].Code != warnings.StaleChainState {
+		t.Fatalf("stale: unexpected %d %s", resp.StatusCode, resp.Body)
+	}
+	fc.Advance(time.Minute)
+	if resp, _ := call("preset=settle&who=aleo1abc"); resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(resp.Body, i18n.EndpointUnavailable) {
+		t.Fatalf("down: unexpected %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestNetworkCheck(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	var lookups atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		// A mainnet node answers for every network path.
+		_, _ = w.Write([]byte(`{"header": {"metadata": {"network": 0}}}`))
+	}))
+	defer srv.Close()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("NETWORK_CHECK", "true")
+	t.Setenv("ENDPOINT", srv.URL)
+
+	call := func(network string) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public", "--network", network}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp
+	}
+	resp := call("testnet")
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(resp.Body, "serves mainnet") {
+		t.Fatalf("expected a mismatch error, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := call("mainnet"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for a matching network, got %d %s", resp.StatusCode, resp.Body)
+	}
+	call("mainnet")
+	if n := lookups.Load(); n != 2 {
+		t.Fatalf("expected one cached lookup per network, got %d", n)
+	}
+	// Networks without a known ID are not checked.
+	if resp := call("devnet"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for an unknown network, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestEstimateFeeAction(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	t.Setenv("NETWORKS", `{"mainnet": {"endpoint": "https://rpc", "priorityFee": 2000}}`)
+	t.Setenv("MAX_FEE", "12000")
+
+	var ran []string
+	orig := runCommand
+	runCommand = func(_ context.Context, cfg executor.Config) executor.Result {
+		ran = cfg.Args
+		return executor.Result{Stdout: "💰 Cost Breakdown (credits)\n  Transaction Storage:  0.001316\n  On-chain Execution:   0.0105\n"}
+	}
+	t.Cleanup(func() { runCommand = orig })
+
+	call := func(body request.InvokeRequest) (int, map[string]any) {
+		b, _ := json.Marshal(body)
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out map[string]any
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp.StatusCode, out
+	}
+	status, out := call(request.InvokeRequest{Action: "estimateFee", Params: map[string]any{"contract": "token.aleo", "method": "mint_public", "inputs": []any{"aleo1abc", "5u64"}, "network": "mainnet"}})
+	if status != http.StatusOK || out["totalFee"] != float64(13816) || out["priorityFee"] != float64(2000) || out["fitsMaxFee"] != false {
+		t.Fatalf("unexpected %d %v", status, out)
+	}
+	if est, _ := out["estimate"].(map[string]any); est["baseFee"] != float64(11816) {
+		t.Fatalf("unexpected estimate %v", out["estimate"])
+	}
+	if !slices.Contains(ran, "--endpoint") || slices.Contains(ran, "--broadcast") || ran[1] != "token.aleo/mint_public" {
+		t.Fatalf("unexpected leo args %q", ran)
+	}
+
+	if status, _ := call(request.InvokeRequest{Action: "estimateFee", Params: map[string]any{"contract": "other.aleo", "method": "f"}}); status != http.StatusForbidden {
+		t.Fatalf("expected 403 for a disallowed contract, got %d", status)
+	}
+	if status, _ := call(request.InvokeRequest{Action: "estimateFee", Params: map[string]any{"contract": "token.aleo", "method": "f", "inputs": []any{"--private-key"}}}); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a flag input, got %d", status)
+	}
+	// MAX_FEE also caps the priority fee of real executions.
+	if status, out := call(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint_public", "--priority-fee", "20000"}}); status != http.StatusForbidden {
+		t.Fatalf("expected 403 above MAX_FEE, got %d %v", status, out)
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	uses := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Key                       map[string]map[string]string
+			ExpressionAttributeValues map[string]map[string]string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		id := in.Key["id"]["S"]
+		if limit, _ := strconv.Atoi(in.ExpressionAttributeValues[":max"]["N"]); uses[id] >= limit {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ConditionalCheckFailedException","message":"failed"}`))
+			return
+		}
+		uses[id]++
+		_ = json.NewEncoder(w).Encode(map[string]any{"Attributes": map[string]any{"uses": map[string]string{"N": strconv.Itoa(uses[id])}}})
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("HMAC_CLIENTS", `{"partner": {"primary": "secret"}}`)
+	t.Setenv("INVOKE_PRESETS", `{"mint": ["execute", "token.aleo/mint_public", "{recipient}", "{amount}u64"], "burn": ["execute", "token.aleo/burn", "{amount}u64"]}`)
+	t.Setenv("SIGNED_URL_SECRET", "url-secret")
+	t.Setenv("SIGNED_URL_TABLE", "signed-urls")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+	b, _ := json.Marshal(request.InvokeRequest{Action: "signUrl", Params: map[string]any{"preset": "mint", "maxUses": 2}})
+	resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			DomainName: "abc.lambda-url.us-east-1.on.aws",
+			HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"},
+			Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}},
+		},
+		Body: string(b),
+	})
+	var minted struct {
+		URL string `json:"url"`
+	}
+	_ = json.Unmarshal([]byte(resp.Body), &minted)
+	u, err := url.Parse(minted.URL)
+	if resp.StatusCode != http.StatusOK || err != nil || u.Host != "abc.lambda-url.us-east-1.on.aws" {
+		t.Fatalf("sign: %d %s", resp.StatusCode, resp.Body)
+	}
+
+	call := func(method, query string) events.LambdaFunctionURLResponse {
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RawPath:        "/",
+			RawQueryString: query,
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: method, SourceIP: "203.0.113.9"}},
+		})
+		return resp
+	}
+	resp = call("GET", u.RawQuery+"&recipient=aleo1abc&amount=5")
+	var out Response
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out.Stdout, "token.aleo/mint_public aleo1abc 5u64") || out.Meta["signedUrlUses"] != "1/2" {
+		t.Fatalf("expected the preset to run, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if got := call("POST", u.RawQuery+"&recipient=aleo1abc&amount=5").StatusCode; got != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for another method, got %d", got)
+	}
+	swapped := strings.Replace(u.RawQuery, "preset=mint", "preset=burn", 1)
+	if got := call("GET", swapped+"&amount=5").StatusCode; got != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for another preset, got %d", got)
+	}
+	if got := call("GET", u.RawQuery+"&recipient=aleo1abc&amount=6").StatusCode; got != http.StatusOK {
+		t.Fatalf("expected the second use to run, got %d", got)
+	}
+	if got := call("GET", u.RawQuery+"&recipient=aleo1abc&amount=7").StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected 403 once the uses are spent, got %d", got)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	// Scheduled runs bypass caller authentication.
+	t.Setenv("HMAC_CLIENTS", `{"partner": {"primary": "secret"}}`)
+	t.Setenv("INVOKE_PRESETS", `{"push": ["execute", "oracle.aleo/push", "{price}u64"]}`)
+	t.Setenv("SCHEDULES", `[
+		{"name": "every", "cron": "* * * * *", "preset": "push", "params": {"price": "42"}, "jitter": "30s"},
+		{"name": "noon", "cron": "0 12 * * *", "preset": "push", "params": {"price": "7"}},
+		{"name": "never", "cron": "0 0 31 2 *", "preset": "push", "params": {"price": "1"}}
+	]`)
+	start := time.Date(2026, 3, 2, 12, 0, 20, 0, time.UTC)
+	fake := clock.NewFake(start)
+	clk, rng = fake, clock.NewSeeded(1)
+	t.Cleanup(func() { clk, rng = clock.System, clock.Crypto })
+
+	run := func() map[string]schedule.Run {
+		out, err := invoke(context.Background(), json.RawMessage(`{"task": "schedules"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.(map[string]any)["runs"].(map[string]schedule.Run)
+	}
+	runs := run()
+	if len(runs) != 2 || runs["every"].Status != http.StatusOK || runs["every"].Skipped != "" || runs["noon"].Status != http.StatusOK {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+	// Only "every" has jitter; the seeded delay is waited out on the fake clock.
+	delay := clock.Duration(clock.NewSeeded(1), 30*time.Second)
+	if w := fake.Waits(); len(w) != 1 || w[0] != delay {
+		t.Fatalf("waits %v, want [%v]", w, delay)
+	}
+	if got := runs["every"].Started; !got.Equal(start.Add(delay)) {
+		t.Fatalf("every started at %v, want %v", got, start.Add(delay))
+	}
+	// A run still in progress is not started again.
+	if err := scheduleRuns.Begin("every"); err != nil {
+		t.Fatal(err)
+	}
+	if r := run()["every"]; r.Skipped == "" {
+		t.Fatalf("expected an overlapping run to be skipped, got %+v", r)
+	}
+	scheduleRuns.End("every")
+	if h := scheduleRuns.History()["every"]; len(h) != 2 {
+		t.Fatalf("expected two history entries, got %+v", h)
+	}
+	fake.Advance(time.Hour)
+	if runs := run(); len(runs) != 1 || runs["noon"].Status != 0 {
+		t.Fatalf("expected only every to run at 13:00, got %+v", runs)
+	}
+
+	t.Setenv("SCHEDULES", `[{"name": "bad", "cron": "* * * * *", "preset": "missing"}]`)
+	if _, err := invoke(context.Background(), json.RawMessage(`{"task": "schedules"}`)); err == nil {
+		t.Fatal("expected an error for a schedule with an unknown preset")
+	}
+}
+
+func TestStaleAllowlist(t *testing.T) {
+	var down atomic.Bool
+	ssm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"__type":"InternalServerError"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Parameter": map[string]string{"Value": `{"contracts":["token.aleo"]}`}})
+	}))
+	defer ssm.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	saved := runtimeAllowlist
+	runtimeAllowlist = state.NewCache[[]string](time.Millisecond)
+	t.Cleanup(func() { runtimeAllowlist = saved })
+	var buf bytes.Buffer
+	logOutput, metricsOut = &buf, &buf
+	t.Cleanup(func() { logOutput, metricsOut = os.Stdout, os.Stdout })
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("METRICS_NAMESPACE", "Leo")
+	t.Setenv("ALLOWED_CONTRACTS", "credits.aleo")
+	t.Setenv("ALLOWLIST_PARAMETER", "/leo/allowlist")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", ssm.URL)
+
+	var last Response
+	exec := func() int {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		last = Response{}
+		_ = json.Unmarshal([]byte(resp.Body), &last)
+		return resp.StatusCode
+	}
+	if got := exec(); got != http.StatusOK || len(last.Warnings) != 0 {
+		t.Fatalf("expected the runtime allowlist to apply, got %d %+v", got, last.Warnings)
+	}
+	// SSM fails after the entry expired: the last known allowlist is still served.
+	down.Store(true)
+	time.Sleep(5 * time.Millisecond)
+	if got := exec(); got != http.StatusOK {
+		t.Fatalf("expected the stale allowlist to be served, got %d", got)
+	}
+	if len(last.Warnings) != 1 || last.Warnings[0].Code != warnings.StaleConfig {
+		t.Fatalf("expected a stale_config warning, got %+v", last.Warnings)
+	}
+	if !strings.Contains(buf.String(), `"StaleConfig"`) {
+		t.Fatalf("expected a StaleConfig metric, got %s", buf.String())
+	}
+	// Past the hard-stale window the check fails closed.
+	t.Setenv("CONFIG_HARD_STALE", "1ms")
+	if got := exec(); got != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 past the hard-stale window, got %d", got)
+	}
+}
+
+func TestStoredJobs(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	release := make(chan struct{})
+	orig := runCommand
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		<-release
+		return executor.Result{Stdout: "done"}
+	}
+	t.Cleanup(func() { runCommand = orig })
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("STORE", "file://"+t.TempDir())
+
+	call := func(ip, method, path, body string) events.LambdaFunctionURLResponse {
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RawPath: path,
+			Body:    body,
+			RequestContext: events.LambdaFunctionURLRequestContext{
+				HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: method, SourceIP: ip},
+			},
+		})
+		return resp
+	}
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public"}, MaxWaitSeconds: 1})
+	resp := call("198.51.100.7", "POST", "/", string(b))
+	var job jobs.Job
+	_ = json.Unmarshal([]byte(resp.Body), &job)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != jobs.StatusDone && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		job, _ = jobRegistry.Get(job.ID, "ip:198.51.100.7")
+	}
+	// Another container has no record of the job in memory, only in STORE, which is
+	// written right after the job finishes.
+	jobRegistry.Forget(job.ID)
+	resp = call("198.51.100.7", "GET", "/jobs/"+job.ID, "")
+	for resp.StatusCode == http.StatusNotFound && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		resp = call("198.51.100.7", "GET", "/jobs/"+job.ID, "")
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Body, `"status":"done"`) {
+		t.Fatalf("expected the stored job, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if got := call("203.0.113.9", "GET", "/jobs/"+job.ID, "").StatusCode; got != http.StatusNotFound {
+		t.Fatalf("stored jobs must not be visible to other callers, got %d", got)
+	}
+}
+
+func TestSharedQuotaFallsBackWhenRedisIsDown(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	var buf bytes.Buffer
+	logOutput = &buf
+	t.Cleanup(func() { logOutput = os.Stdout })
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "1")
+	t.Setenv("REDIS_URL", "redis://"+addr)
+
+	call := func() int {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", SourceIP: "198.51.100.7"}},
+			Body:           string(b),
+		})
+		return resp.StatusCode
+	}
+	if got := call(); got != http.StatusOK {
+		t.Fatalf("expected the local counters to admit the request, got %d", got)
+	}
+	if got := call(); got != http.StatusTooManyRequests {
+		t.Fatalf("expected the local rate limit to apply, got %d", got)
+	}
+	if !strings.Contains(buf.String(), "shared quota unavailable") {
+		t.Fatalf("expected a warning, got %s", buf.String())
+	}
+}
+
+func TestFeePayerInjection(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	dir := t.TempDir()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("JOURNAL_DIR", dir)
+	t.Setenv("PRIVATE_KEY", "APrivateKey1signer")
+	t.Setenv("FEE_PRIVATE_KEY", "APrivateKey1default")
+	t.Setenv("FEE_PAYERS", `{"Token.aleo": "APrivateKey1token"}`)
+
+	run := func(args ...string) string {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return out.Stdout
+	}
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"execute", "token.aleo/mint", "1u64"}, "--fee-private-key APrivateKey1token"},
+		{[]string{"execute", "credits.aleo/transfer_public", "1u64"}, "--fee-private-key APrivateKey1default"},
+		{[]string{"execute", "token.aleo/mint", "--fee-private-key", "APrivateKey1mine"}, "--fee-private-key APrivateKey1mine"},
+	} {
+		out := run(tc.args...)
+		if !strings.Contains(out, tc.want) || strings.Count(out, "--fee-private-key") != 1 || !strings.Contains(out, "--private-key APrivateKey1signer") {
+			t.Fatalf("%v: unexpected command %q", tc.args, out)
+		}
+	}
+	entries, err := (&journal.Journal{Dir: dir}).List(10, nil)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expected 3 journal entries, got %d (%v)", len(entries), err)
+	}
+	for _, e := range entries {
+		if strings.Contains(strings.Join(e.Args, " "), "APrivateKey1") {
+			t.Fatalf("keys must be redacted in the journal: %q", e.Args)
+		}
+	}
+
+	// The receipt transaction is paid by the same fee payer as the execution it anchors.
+	t.Setenv("RECEIPT_PROGRAM", "receipts.aleo")
+	var ran [][]string
+	orig := runCommand
+	runCommand = func(ctx context.Context, cfg executor.Config) executor.Result {
+		ran = append(ran, cfg.Args)
+		return orig(ctx, cfg)
+	}
+	t.Cleanup(func() { runCommand = orig })
+	run("execute", "token.aleo/mint", "1u64")
+	if len(ran) != 2 || ran[1][1] != "receipts.aleo/record" {
+		t.Fatalf("expected the execution and its receipt, got %q", ran)
+	}
+	if got := strings.Join(ran[1], " "); !strings.Contains(got, "--fee-private-key APrivateKey1token") || !strings.Contains(got, "--private-key APrivateKey1signer") {
+		t.Fatalf("receipt must carry the fee payer: %q", got)
+	}
+}
+
+func TestDelegatedProving(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	status := http.StatusOK
+	var gotAuth string
+	var gotArgs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		var body struct{ Args []string }
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		gotArgs = body.Args
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"exitCode":0,"stdout":"remote proof\n"}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("PROVER_URL", srv.URL)
+	t.Setenv("PROVER_TOKEN", "s3cret")
+	t.Setenv("PROVER_CONTRACTS", "token.aleo")
+	orig := runCommand
+	local := 0
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		local++
+		return executor.Result{Stdout: "local proof"}
+	}
+	t.Cleanup(func() { runCommand = orig })
+
+	run := func(args ...string) Response {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return out
+	}
+
+	out := run("execute", "token.aleo/mint", "1u64")
+	if out.Stdout != "remote proof\n" || out.Meta["proving"] != provingRemote || out.Meta["proverSeconds"] == "" || local != 0 {
+		t.Fatalf("expected a remote proof, got %+v (local runs %d)", out, local)
+	}
+	if gotAuth != "Bearer s3cret" || len(gotArgs) == 0 || gotArgs[0] != "execute" {
+		t.Fatalf("unexpected prover request: auth %q args %q", gotAuth, gotArgs)
+	}
+
+	status = http.StatusServiceUnavailable
+	out = run("execute", "token.aleo/mint", "1u64")
+	if out.Stdout != "local proof" || out.Meta["proving"] != provingFallback || out.Meta["proverError"] == "" || out.Meta["localSeconds"] == "" {
+		t.Fatalf("expected a local fallback, got %+v", out)
+	}
+
+	status = http.StatusInternalServerError
+	out = run("execute", "token.aleo/mint", "1u64")
+	if out.ExitCode == 0 || out.Meta["proving"] != provingRemote || local != 1 {
+		t.Fatalf("an ambiguous prover failure must not be retried locally, got %+v (local runs %d)", out, local)
+	}
+
+	out = run("execute", "credits.aleo/transfer_public", "1u64")
+	if out.Stdout != "local proof" || out.Meta["proving"] != provingLocal {
+		t.Fatalf("contracts outside PROVER_CONTRACTS are proved locally, got %+v", out)
+	}
+}
+
+func TestWorkerQueue(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	const txID = "at1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq"
+	var (
+		msg       worker.Message
+		broadcast []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") == "AmazonSQS.SendMessage" {
+			var in struct{ MessageBody string }
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			_ = json.Unmarshal([]byte(in.MessageBody), &msg)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		if r.URL.Path == "/testnet/transaction/broadcast" {
+			broadcast, _ = io.ReadAll(r.Body)
+			_, _ = w.Write([]byte(`"` + txID + `"`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("STORE", "file://"+t.TempDir())
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("WORKER_QUEUE_URL", "https://sqs.us-east-1.amazonaws.com/1/provers")
+	t.Setenv("WORKER_CALLBACK_SECRET", "s3cret")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	orig := runCommand
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		t.Error("queued runs must not run locally")
+		return executor.Result{}
+	}
+	t.Cleanup(func() { runCommand = orig })
+
+	call := func(method, path, body string, headers map[string]string) events.LambdaFunctionURLResponse {
+		req := events.LambdaFunctionURLRequest{RawPath: path, Body: body, Headers: headers}
+		req.RequestContext.DomainName = "fn.lambda-url.us-east-1.on.aws"
+		req.RequestContext.HTTP = events.LambdaFunctionURLRequestContextHTTPDescription{Method: method, SourceIP: "198.51.100.7"}
+		resp, _ := handler(context.Background(), req)
+		return resp
+	}
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64", "--network", "testnet", "--broadcast"}})
+	resp := call("POST", "/", string(b), nil)
+	var job jobs.Job
+	_ = json.Unmarshal([]byte(resp.Body), &job)
+	if resp.StatusCode != http.StatusAccepted || job.Status != jobs.StatusQueued || resp.Headers["Location"] != "/jobs/"+job.ID {
+		t.Fatalf("expected a queued job, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if msg.JobID != job.ID || slices.Contains(msg.Args, "--broadcast") || slices.Contains(msg.Args, "--home") || msg.CallbackURL != "https://fn.lambda-url.us-east-1.on.aws/jobs/"+job.ID+"/result" {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	result := `{"exitCode":0,"stdout":"built","transaction":{"type":"execute"}}`
+	if resp := call("POST", "/jobs/"+job.ID+"/result", result, map[string]string{worker.TokenHeader: "forged"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a forged token, got %d", resp.StatusCode)
+	}
+	token := map[string]string{worker.TokenHeader: msg.Token}
+	if resp := call("POST", "/jobs/"+job.ID+"/result", result, token); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if string(broadcast) != `{"type":"execute"}` {
+		t.Fatalf("expected the worker's transaction to be broadcast, got %q", broadcast)
+	}
+	if resp := call("POST", "/jobs/"+job.ID+"/result", result, token); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("a second result must be rejected, got %d", resp.StatusCode)
+	}
+
+	resp = call("GET", "/jobs/"+job.ID, "", nil)
+	var done struct {
+		Status jobs.Status
+		Result Response
+	}
+	_ = json.Unmarshal([]byte(resp.Body), &done)
+	if done.Status != jobs.StatusDone || done.Result.ExitCode != 0 || done.Result.Meta["transactionId"] != txID || done.Result.Meta["proving"] != "worker" {
+		t.Fatalf("unexpected job %s", resp.Body)
+	}
+}
+
+func TestABIAction(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/testnet/program/token.aleo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fetches++
+		_ = json.NewEncoder(w).Encode("program token.aleo;\nfunction mint_public:\n    input r0 as address.public;\n    input r1 as u64.public;\n")
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo,missing.aleo")
+
+	call := func(params map[string]any) (int, string) {
+		b, _ := json.Marshal(request.InvokeRequest{Action: "abi", Params: params})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp.StatusCode, resp.Body
+	}
+	for range 2 {
+		status, body := call(map[string]any{"program": "token.aleo", "network": "testnet"})
+		if status != http.StatusOK || !strings.Contains(body, `"name":"mint_public"`) || !strings.Contains(body, `{"name":"r1","type":"u64","visibility":"public"}`) {
+			t.Fatalf("unexpected %d %s", status, body)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("expected the ABI to be cached, fetched %d times", fetches)
+	}
+	if status, _ := call(map[string]any{"program": "missing.aleo", "network": "testnet"}); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown program, got %d", status)
+	}
+	if status, _ := call(map[string]any{"program": "other.aleo", "network": "testnet"}); status != http.StatusForbidden {
+		t.Fatalf("expected 403 for a disallowed program, got %d", status)
+	}
+	if status, _ := call(map[string]any{"program": "token.aleo"}); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a network, got %d", status)
+	}
+}
+
+func TestABIValidation(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	dir := t.TempDir()
+	src := "program token.aleo;\nfunction mint_public:\n    input r0 as address.public;\n    input r1 as u64.public;\n"
+	if err := os.WriteFile(filepath.Join(dir, "token.aleo"), []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_ = json.NewEncoder(w).Encode("program other.aleo;\nfunction ping:\n    input r0 as boolean.public;\n")
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("ABI_DIR", dir)
+
+	run := func(args ...string) (int, map[string]any) {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out map[string]any
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp.StatusCode, out
+	}
+	addr := "aleo1" + strings.Repeat("q", 58)
+	if status, out := run("execute", "token.aleo/mint_public", addr, "5u64"); status != http.StatusOK {
+		t.Fatalf("valid inputs rejected: %d %v", status, out)
+	}
+	status, out := run("execute", "token.aleo/mint_public", addr, "5u32")
+	fields, _ := out["fields"].([]any)
+	if status != http.StatusBadRequest || len(fields) != 1 || fields[0].(map[string]any)["field"] != "inputs[1]" {
+		t.Fatalf("expected a field error on inputs[1], got %d %v", status, out)
+	}
+	if status, _ := run("execute", "token.aleo/burn", addr); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown function, got %d", status)
+	}
+
+	// Programs that are not bundled are only checked with ABI_VALIDATION.
+	if status, _ := run("execute", "other.aleo/ping", "1u8", "--network", "testnet"); status != http.StatusOK || fetches != 0 {
+		t.Fatalf("expected no validation without ABI_VALIDATION, got %d after %d fetches", status, fetches)
+	}
+	t.Setenv("ABI_VALIDATION", "true")
+	if status, _ := run("execute", "other.aleo/ping", "1u8", "--network", "testnet"); status != http.StatusBadRequest || fetches != 1 {
+		t.Fatalf("expected the fetched ABI to reject the input, got %d after %d fetches", status, fetches)
+	}
+}
+
+func TestConfirmedEvents(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	const txID = "at1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/testnet/transaction/confirmed/"+txID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"rejected","transaction":{"execution":{"transitions":[{"id":"au1a","program":"token.aleo","function":"mint_public","outputs":[{"type":"future","id":"1field","value":"{}"}]}]}},"finalize":[{"type":"update_key_value","mapping_id":"2field","key_id":"3field","value_id":"4field"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ENDPOINT", srv.URL)
+	origRun, origInterval := runCommand, confirmInterval
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		return executor.Result{Stdout: "broadcast " + txID}
+	}
+	confirmInterval = time.Millisecond
+	t.Cleanup(func() { runCommand, confirmInterval = origRun, origInterval })
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint_public", "--network", "testnet"}, Profile: "thorough"})
+	resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	})
+	var out Response
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if out.Meta["confirmed"] != "true" || out.Meta["transactionStatus"] != "rejected" || len(out.Events) != 2 {
+		t.Fatalf("unexpected response %s", resp.Body)
+	}
+	if out.Events[0].Type != "future" || out.Events[1].Kind != "finalize" || out.Events[1].MappingID != "2field" {
+		t.Fatalf("unexpected events %+v", out.Events)
+	}
+}
+
+func TestExpectations(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	const txID = "at1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq"
+	// balance is the account mapping's value; the fake run credits 5u64 to it.
+	var mu sync.Mutex
+	balance := "10u64"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/testnet/transaction/confirmed/" + txID:
+			_, _ = w.Write([]byte(`{"status":"accepted"}`))
+		case "/testnet/program/token.aleo/mapping/account/aleo1bob":
+			_, _ = w.Write([]byte(strconv.Quote(balance)))
+		case "/testnet/program/token.aleo/mapping/paused/true":
+			_, _ = w.Write([]byte("null"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ENDPOINT", srv.URL)
+	origRun, origInterval := runCommand, confirmInterval
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		mu.Lock()
+		balance = "15u64"
+		mu.Unlock()
+		return executor.Result{Stdout: "broadcast " + txID}
+	}
+	confirmInterval = time.Millisecond
+	t.Cleanup(func() { runCommand, confirmInterval = origRun, origInterval })
+
+	call := func(profile string, exps ...expect.Expectation) (events.LambdaFunctionURLResponse, Response) {
+		mu.Lock()
+		balance = "10u64"
+		mu.Unlock()
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint_public", "--network", "testnet"}, Profile: profile, Expect: exps})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp, out
+	}
+
+	_, out := call("thorough", expect.Expectation{Mapping: "account", Key: "aleo1bob", Delta: "+5u64"}, expect.Expectation{Mapping: "paused", Key: "true", Equals: "null"})
+	if out.Verified == nil || !*out.Verified || len(out.Diffs) != 2 {
+		t.Fatalf("expected verified diffs, got %+v", out)
+	}
+	if d := out.Diffs[0]; d.Program != "token.aleo" || *d.Before != "10u64" || *d.After != "15u64" || d.Want != "15u64" {
+		t.Fatalf("unexpected diff %+v", d)
+	}
+
+	_, out = call("thorough", expect.Expectation{Mapping: "account", Key: "aleo1bob", Delta: "+6u64"})
+	if out.Verified == nil || *out.Verified || out.Diffs[0].OK || out.Diffs[0].Want != "16u64" {
+		t.Fatalf("expected an unverified diff, got %+v", out)
+	}
+
+	resp, _ := call("fast", expect.Expectation{Mapping: "account", Key: "aleo1bob", Delta: "+5u64"})
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(resp.Body, "waits for confirmation") {
+		t.Fatalf("expect without confirmation must be rejected, got %d %s", resp.StatusCode, resp.Body)
+	}
+	resp, _ = call("thorough", expect.Expectation{Mapping: "account", Key: "aleo1bob", Delta: "+5u64", Equals: "15u64"})
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(resp.Body, "expect[0]") {
+		t.Fatalf("ambiguous expectation must be rejected, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	var mu sync.Mutex
+	paused := "false"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/testnet/program/token.aleo/mapping/paused/0u8":
+			_, _ = w.Write([]byte(strconv.Quote(paused)))
+		case "/testnet/program/oracle.aleo/mapping/prices/1u8":
+			_, _ = w.Write([]byte(`"250u64"`))
+		case "/testnet/program/token.aleo/mapping/broken/0u8":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte("null"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("ALLOWED_COMMANDS", "execute,query")
+	runs := 0
+	origRun := runCommand
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		runs++
+		return executor.Result{Stdout: "ok"}
+	}
+	t.Cleanup(func() { runCommand = origRun })
+
+	call := func(args []string, conds ...expect.Condition) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args, OnlyIf: conds})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp
+	}
+	mint := []string{"execute", "token.aleo/mint_public", "aleo1bob", "5u64", "--network", "testnet"}
+	notPaused := expect.Condition{Mapping: "paused", Key: "0u8", Equals: "false"}
+	priced := expect.Condition{Program: "oracle.aleo", Mapping: "prices", Key: "1u8", AtLeast: "200u64"}
+
+	if resp := call(mint, notPaused, priced); resp.StatusCode != http.StatusOK || runs != 1 {
+		t.Fatalf("expected a run, got %d %s after %d runs", resp.StatusCode, resp.Body, runs)
+	}
+
+	mu.Lock()
+	paused = "true"
+	mu.Unlock()
+	resp := call(mint, notPaused, priced)
+	var refused struct {
+		Code               string           `json:"code"`
+		PreconditionFailed []expect.Outcome `json:"preconditionFailed"`
+	}
+	_ = json.Unmarshal([]byte(resp.Body), &refused)
+	if resp.StatusCode != http.StatusPreconditionFailed || refused.Code != i18n.PreconditionFailed || runs != 1 {
+		t.Fatalf("expected a refusal, got %d %s after %d runs", resp.StatusCode, resp.Body, runs)
+	}
+	if o := refused.PreconditionFailed; len(o) != 2 || o[0].OK || *o[0].Value != "true" || o[0].Program != "token.aleo" || !o[1].OK {
+		t.Fatalf("unexpected outcomes %+v", o)
+	}
+
+	if resp := call(mint, expect.Condition{Mapping: "broken", Key: "0u8", Equals: "1u8"}); resp.StatusCode != http.StatusServiceUnavailable || runs != 1 {
+		t.Fatalf("expected 503 for an unreadable entry, got %d %s", resp.StatusCode, resp.Body)
+	}
+	for _, tc := range []struct {
+		args []string
+		cond expect.Condition
+		want string
+	}{
+		{mint, expect.Condition{Mapping: "paused", Key: "0u8"}, "onlyIf[0]"},
+		{mint[:4], notPaused, "needs --network"},
+		{[]string{"query", "program", "token.aleo"}, notPaused, "only applies to execute"},
+	} {
+		if resp := call(tc.args, tc.cond); resp.StatusCode != http.StatusBadRequest || !strings.Contains(resp.Body, tc.want) {
+			t.Fatalf("%v: expected 400 mentioning %q, got %d %s", tc.cond, tc.want, resp.StatusCode, resp.Body)
+		}
+	}
+}
+
+func TestDuplicateExecutes(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DEDUP_WINDOW", "10m")
+	t.Setenv("STORE", "file://"+t.TempDir())
+	const txID = "at1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq"
+	runs := 0
+	origRun := runCommand
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		runs++
+		return executor.Result{Stdout: "broadcast " + txID}
+	}
+	t.Cleanup(func() { runCommand = origRun })
+
+	call := func(args ...string) (events.LambdaFunctionURLResponse, Response) {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp, out
+	}
+	if _, out := call("execute", "token.aleo/mint", "5u64", "--network", "testnet"); out.Meta["duplicateOf"] != "" {
+		t.Fatalf("first run flagged as a duplicate: %+v", out.Meta)
+	}
+	// Flag order does not make a request different.
+	if _, out := call("execute", "--network", "testnet", "token.aleo/mint", "5u64"); out.Meta["duplicateOf"] != txID || runs != 2 ||
+		len(out.Warnings) != 1 || out.Warnings[0].Code != warnings.DuplicateExecute {
+		t.Fatalf("expected a warning and a run, got %+v %+v after %d runs", out.Meta, out.Warnings, runs)
+	}
+	if _, out := call("execute", "token.aleo/mint", "6u64", "--network", "testnet"); out.Meta["duplicateOf"] != "" {
+		t.Fatalf("different inputs flagged: %+v", out.Meta)
+	}
+
+	t.Setenv("DEDUP_MODE", "block")
+	// Another container sees the broadcast through STORE.
+	broadcasts.Reset()
+	resp, _ := call("execute", "token.aleo/mint", "5u64", "--network", "testnet")
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(resp.Body, txID) || runs != 3 {
+		t.Fatalf("expected 409 without a run, got %d %s after %d runs", resp.StatusCode, resp.Body, runs)
+	}
+	// Once DEDUP_WINDOW has passed the execute runs again.
+	clk = clock.NewFake(time.Now().Add(11 * time.Minute))
+	t.Cleanup(func() { clk = clock.System })
+	if resp, _ := call("execute", "token.aleo/mint", "5u64", "--network", "testnet"); resp.StatusCode != http.StatusOK || runs != 4 {
+		t.Fatalf("expected a run after the window, got %d %s after %d runs", resp.StatusCode, resp.Body, runs)
+	}
+	clk = clock.System
+
+	t.Setenv("DEDUP_MODE", "sometimes")
+	if resp, _ := call("execute", "token.aleo/mint", "5u64"); resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("invalid DEDUP_MODE accepted: %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestTruncationWarning(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ALLOWED_COMMANDS", "query")
+	truncated := false
+	origRun := runCommand
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		return executor.Result{Stdout: "out", Truncated: truncated}
+	}
+	t.Cleanup(func() { runCommand = origRun })
+	call := func() Response {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"query", "program", "token.aleo"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return out
+	}
+	if out := call(); out.Stdout != "out" || len(out.Warnings) != 0 {
+		t.Fatalf("unexpected response: %+v", out)
+	}
+	truncated = true
+	// Warnings are reported apart from stderr.
+	if out := call(); len(out.Warnings) != 1 || out.Warnings[0].Code != warnings.OutputTruncated || out.Stderr != "" {
+		t.Fatalf("expected an output_truncated warning, got %+v", out)
+	}
+}
+
+func TestContractGroupAliases(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("GROUP_token", "token_v5.aleo,token_v6.aleo")
+	t.Setenv("ALLOWED_CONTRACTS", "credits.aleo,@token")
+	call := func(contract string) int {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/mint", "1u64"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp.StatusCode
+	}
+	for contract, want := range map[string]int{"token_v6.aleo": http.StatusOK, "credits.aleo": http.StatusOK, "token_v4.aleo": http.StatusForbidden} {
+		if got := call(contract); got != want {
+			t.Fatalf("%s: expected %d, got %d", contract, want, got)
+		}
+	}
+	// A typo must not silently narrow or widen the allowlist.
+	t.Setenv("ALLOWED_CONTRACTS", "@tokens")
+	if got := call("token_v6.aleo"); got != http.StatusInternalServerError {
+		t.Fatalf("expected an undefined group to be a config error, got %d", got)
+	}
+
+	t.Setenv("ALLOWED_CONTRACTS", "")
+	t.Setenv("GROUP_CONTRACTS", `{"treasury": ["@token"]}`)
+	t.Setenv("MAINTENANCE_WINDOWS", `[{"name": "bump", "contracts": ["@token"], "cron": "0 3 * * *", "duration": "1h"}]`)
+	cfg, err := loadEnvConfig()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if !cfg.policy.Allows([]string{"treasury"}, "token_v5.aleo") || !cfg.maintenance[0].Applies("token_v6.aleo") {
+		t.Fatalf("expected aliases in policies to expand: %v %v", cfg.policy.Groups, cfg.maintenance[0].Contracts)
+	}
+}
+
+func TestAllowlistPatterns(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	dir := t.TempDir()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("JOURNAL_DIR", dir)
+	t.Setenv("ALLOWED_CONTRACTS", `credits.aleo,vlink_*.aleo,/^test_.+\.aleo$/`)
+	call := func(contract string) (int, Response) {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/mint", "1u64"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp.StatusCode, out
+	}
+	for contract, want := range map[string]string{"vlink_token_service_v7.aleo": "vlink_*.aleo", "test_swap.aleo": `/^test_.+\.aleo$/`} {
+		code, out := call(contract)
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", contract, code)
+		}
+		// The journal records which entry admitted the contract.
+		e, err := (&journal.Journal{Dir: dir}).Read(out.Meta["journal"])
+		if err != nil || e.AllowedBy != want {
+			t.Fatalf("%s: expected allowedBy %q, got %+v %v", contract, want, e, err)
+		}
+	}
+	if code, _ := call("token.aleo"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 outside the patterns, got %d", code)
+	}
+	// Invalid patterns fail at config load.
+	t.Setenv("ALLOWED_CONTRACTS", "/test_.+/")
+	if code, _ := call("test_swap.aleo"); code != http.StatusInternalServerError {
+		t.Fatalf("expected an unanchored pattern to be rejected, got %d", code)
+	}
+}
+
+func TestShadowPolicy(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	var buf bytes.Buffer
+	logOutput, metricsOut = &buf, &buf
+	t.Cleanup(func() { logOutput, metricsOut = os.Stdout, os.Stdout })
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("METRICS_NAMESPACE", "Leo")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo,credits.aleo")
+	t.Setenv("SHADOW_ALLOWED_CONTRACTS", "token.aleo,nft_*.aleo")
+	call := func(contract string) int {
+		buf.Reset()
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/mint", "1u64"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp.StatusCode
+	}
+	if got := call("token.aleo"); got != http.StatusOK || strings.Contains(buf.String(), "shadow") {
+		t.Fatalf("expected an agreeing decision to pass silently, got %d %s", got, buf.String())
+	}
+	// The enforced allowlist decides; the shadow's disagreement is only reported.
+	if got := call("credits.aleo"); got != http.StatusOK || !strings.Contains(buf.String(), `"enforced":"allow"`) || !strings.Contains(buf.String(), `"shadow":"deny"`) {
+		t.Fatalf("expected 200 and a reported mismatch, got %d %s", got, buf.String())
+	}
+	if got := call("nft_v2.aleo"); got != http.StatusForbidden || !strings.Contains(buf.String(), `"shadow":"allow"`) || !strings.Contains(buf.String(), `"ShadowMismatch"`) {
+		t.Fatalf("expected 403 and a reported mismatch, got %d %s", got, buf.String())
+	}
+}
+
+func TestContractDailyQuota(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	var buf bytes.Buffer
+	logOutput, metricsOut = &buf, &buf
+	t.Cleanup(func() { logOutput, metricsOut = os.Stdout, os.Stdout })
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("METRICS_NAMESPACE", "Leo")
+	t.Setenv("CONTRACT_DAILY_LIMITS", `{"token.aleo": 2}`)
+	call := func(contract string, amount int) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/mint", fmt.Sprintf("%du64", amount)}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp
+	}
+	for i := 1; i <= 2; i++ {
+		resp := call("token.aleo", i)
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		if resp.StatusCode != http.StatusOK || out.Meta["contractUses"] != fmt.Sprintf("%d/2", i) {
+			t.Fatalf("execute %d: %d %s", i, resp.StatusCode, resp.Body)
+		}
+	}
+	resp := call("token.aleo", 3)
+	var body struct {
+		Code    string `json:"code"`
+		ResetAt string `json:"resetAt"`
+		Limit   int    `json:"limit"`
+	}
+	_ = json.Unmarshal([]byte(resp.Body), &body)
+	resetAt, err := time.Parse(time.RFC3339, body.ResetAt)
+	if resp.StatusCode != http.StatusTooManyRequests || body.Code != "contract_quota_exceeded" || body.Limit != 2 || err != nil || resp.Headers["Retry-After"] == "" {
+		t.Fatalf("expected 429 once the quota is used up, got %d %s %v", resp.StatusCode, resp.Body, resp.Headers)
+	}
+	if d := time.Until(resetAt); d <= 0 || d > 24*time.Hour || resetAt.Hour() != 0 {
+		t.Fatalf("unexpected resetAt %s", body.ResetAt)
+	}
+	if got := call("credits.aleo", 1).StatusCode; got != http.StatusOK {
+		t.Fatalf("expected contracts without a limit to run, got %d", got)
+	}
+
+	// A failing table falls back to the container's counters, which are already spent.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	t.Setenv("CONTRACT_QUOTA_TABLE", "contract-quotas")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	buf.Reset()
+	if got := call("token.aleo", 4).StatusCode; got != http.StatusTooManyRequests || !strings.Contains(buf.String(), "contract quota table unavailable") || !strings.Contains(buf.String(), `"QuotaFallback"`) {
+		t.Fatalf("expected the local counters to decide, got %d %s", got, buf.String())
+	}
+}
+
+func TestSealedConfig(t *testing.T) {
+	decrypts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			CiphertextBlob []byte
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		decrypts++
+		_ = json.NewEncoder(w).Encode(map[string]any{"Plaintext": in.CiphertextBlob})
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("MAX_FEE", "100")
+	t.Setenv("SEALED_CONFIG", base64.StdEncoding.EncodeToString([]byte(`{"ALLOWED_CONTRACTS": "@tokens", "GROUP_tokens": "token.aleo", "MAX_FEE": 5}`)))
+	call := func(contract string) int {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/mint", "1u64", "--priority-fee", "50"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp.StatusCode
+	}
+	// The sealed allowlist and its group apply; the plaintext MAX_FEE wins over the sealed one.
+	if got := call("token.aleo"); got != http.StatusOK {
+		t.Fatalf("expected the sealed allowlist to allow token.aleo, got %d", got)
+	}
+	if got := call("nft.aleo"); got != http.StatusForbidden {
+		t.Fatalf("expected the sealed allowlist to refuse nft.aleo, got %d", got)
+	}
+	if decrypts != 1 {
+		t.Fatalf("expected one decrypt per container, got %d", decrypts)
+	}
+}
+
+func TestMigrateAction(t *testing.T) {
+	var ops []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ops = append(ops, r.Header.Get("X-Amz-Target"))
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"not found"}`))
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("INVITE_TABLE", "leo-invites")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	call := func(arn string) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Action: "migrate", Params: map[string]any{"dryRun": true}})
+		rc := events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}}
+		if arn != "" {
+			rc.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: arn}}
+		}
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{RequestContext: rc, Body: string(b)})
+		return resp
+	}
+	if got := call("").StatusCode; got != http.StatusForbidden {
+		t.Fatalf("expected migrate to require an admin, got %d", got)
+	}
+	resp := call("arn:aws:iam::123:role/ops")
+	var out struct {
+		DryRun  bool
+		Results []migrate.Result
+	}
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || !out.DryRun || len(out.Results) != 1 || out.Results[0].Table != "leo-invites" || len(out.Results[0].Pending) != 1 {
+		t.Fatalf("unexpected dry run: %d %s", resp.StatusCode, resp.Body)
+	}
+	// A dry run only reads.
+	if !slices.Equal(ops, []string{"DynamoDB_20120810.DescribeTable"}) {
+		t.Fatalf("unexpected calls %v", ops)
+	}
+}
+
+func TestDiagnoseAction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/mainnet/block/height/latest" {
+			_, _ = w.Write([]byte("123"))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"not found"}`))
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("LEO_BIN", "echo")
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("STORE", "file://"+t.TempDir())
+	t.Setenv("INVITE_TABLE", "leo-invites")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+	b, _ := json.Marshal(request.InvokeRequest{Action: "diagnose"})
+	rc := events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}}
+	if resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{RequestContext: rc, Body: string(b)}); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected diagnose to require an admin, got %d", resp.StatusCode)
+	}
+	rc.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}}
+	resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{RequestContext: rc, Body: string(b)})
+	var report selftest.Report
+	if err := json.Unmarshal([]byte(resp.Body), &report); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, resp.Body)
+	}
+	got := map[string]selftest.Check{}
+	for _, c := range report.Checks {
+		got[c.Name] = c
+	}
+	want := map[string]string{
+		"leo_version":      selftest.StatusPass,
+		"endpoint_tls":     selftest.StatusWarn,
+		"endpoint_latency": selftest.StatusPass,
+		"secrets":          selftest.StatusSkip,
+		"dynamodb":         selftest.StatusFail,
+		"store":            selftest.StatusPass,
+	}
+	for name, status := range want {
+		if got[name].Status != status {
+			t.Fatalf("check %s: expected %s, got %+v", name, status, got[name])
+		}
+	}
+	if report.OK || report.Status != selftest.StatusFail || !strings.Contains(got["dynamodb"].Remedy, "migrate") {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if !strings.Contains(got["endpoint_latency"].Detail, "mainnet: height 123") {
+		t.Fatalf("unexpected endpoint detail %q", got["endpoint_latency"].Detail)
+	}
+}
+
+func TestExecutorDebugBundle(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	var uploads []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads = append(uploads, r.URL.Path)
+	}))
+	defer srv.Close()
+	// The version probe runs in the package directory, so only real runs write
+	// proof.txt, into the workdir.
+	dir := t.TempDir()
+	script := filepath.Join(dir, "leo")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n[ \"$1\" = --version ] && echo 'leo 3.2.0' && exit 0\necho built\necho 'slow endpoint' >&2\necho proof > proof.txt\nexit 2\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	workdir := filepath.Join(dir, "work")
+	if err := os.MkdirAll(workdir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("LEO_BIN", script)
+	t.Setenv("WORKDIR", workdir)
+	t.Setenv("PRIVATE_KEY", "APrivateKey1secret")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("DEBUG_EXECUTOR", "true")
+
+	call := func(admin bool) Response {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}})
+		req := events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Headers:        map[string]string{"x-leo-debug": "1"},
+			Body:           string(b),
+		}
+		if admin {
+			req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"}}
+		}
+		resp, _ := handler(context.Background(), req)
+		var r Response
+		_ = json.Unmarshal([]byte(resp.Body), &r)
+		return r
+	}
+	if r := call(false); r.Debug != nil {
+		t.Fatal("debug bundle returned to a non-admin")
+	}
+	if err := os.Remove(filepath.Join(workdir, "proof.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	d := call(true).Debug
+	if d == nil {
+		t.Fatal("expected a debug bundle")
+	}
+	if d.Env["PRIVATE_KEY"] != "***" || d.Env["LEO_BIN"] != script || slices.Contains(d.Argv, "APrivateKey1secret") || d.Argv[0] != script {
+		t.Fatalf("env or argv not sanitized: %v %v", d.Env["PRIVATE_KEY"], d.Argv)
+	}
+	if len(d.WorkDirBefore) != 0 || len(d.WorkDirAfter) != 1 || d.WorkDirAfter[0].Path != "proof.txt" {
+		t.Fatalf("unexpected workdir listings %+v %+v", d.WorkDirBefore, d.WorkDirAfter)
+	}
+	if len(d.Processes) != 1 || d.Processes[0].ExitCode != 2 || d.Processes[0].PID == 0 {
+		t.Fatalf("unexpected processes %+v", d.Processes)
+	}
+	if !strings.Contains(d.Stdout, "built") || !strings.Contains(d.Stderr, "slow endpoint") {
+		t.Fatalf("unexpected output %q %q", d.Stdout, d.Stderr)
+	}
+
+	// With OUTPUT_BUCKET the bundle is uploaded instead.
+	t.Setenv("OUTPUT_BUCKET", "leo-output")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	r := call(true)
+	if r.Debug != nil || !strings.HasPrefix(r.Meta["debugObject"], "s3://leo-output/") || len(uploads) != 1 || !strings.HasSuffix(uploads[0], "/debug.json") {
+		t.Fatalf("expected an uploaded bundle, got meta %v uploads %v", r.Meta, uploads)
+	}
+
+	t.Setenv("DEBUG_EXECUTOR", "false")
+	if r := call(true); r.Debug != nil || r.Meta["debugObject"] != "" {
+		t.Fatal("debug bundle captured with DEBUG_EXECUTOR off")
+	}
+}
+
+func TestDiffAction(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("JOURNAL_DIR", t.TempDir())
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+	}
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "credits.aleo/transfer_public", "aleo1xyz", "1u64"}})
+	req.Body = string(b)
+	resp, _ := handler(context.Background(), req)
+	var first Response
+	if err := json.Unmarshal([]byte(resp.Body), &first); err != nil || first.Meta["journal"] == "" {
+		t.Fatalf("expected a journaled run: %s", resp.Body)
+	}
+	second := first
+	second.Stdout = first.Stdout + "\nwarning: deprecated flag"
+	second.Meta = maps.Clone(first.Meta)
+	second.Meta["journal"] = "other"
+	start := func(result any) string {
+		id := jobRegistry.Start(context.Background(), jobs.Spec{Owner: "ip:198.51.100.7"}, func(context.Context, io.Writer, io.Writer) any { return result })
+		t.Cleanup(func() { jobRegistry.Forget(id) })
+		if job, ok := jobRegistry.Wait(context.Background(), id, 5*time.Second); !ok || job.Status != jobs.StatusDone {
+			t.Fatalf("job %s did not finish: %+v", id, job)
+		}
+		return id
+	}
+	a, c := start(first), start(second)
+
+	call := func(params map[string]any) (int, map[string]any) {
+		b, _ := json.Marshal(request.InvokeRequest{Action: "diff", Params: params})
+		req.Body = string(b)
+		resp, _ := handler(context.Background(), req)
+		var out map[string]any
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp.StatusCode, out
+	}
+	if code, _ := call(map[string]any{"a": a, "b": c}); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin caller, got %d", code)
+	}
+	req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+		IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"},
+	}
+
+	// Jobs of any owner compare; the journal ID differs on every run and is skipped.
+	code, out := call(map[string]any{"a": a, "b": c})
+	changes, _ := out["changes"].([]any)
+	if code != http.StatusOK || out["equal"] != false || len(changes) != 1 {
+		t.Fatalf("expected one change, got %d %v", code, out)
+	}
+	if ch := changes[0].(map[string]any); ch["path"] != "stdout" || ch["kind"] != "changed" || !strings.Contains(out["text"].(string), "+ warning: deprecated flag") {
+		t.Fatalf("unexpected change %v\n%s", ch, out["text"])
+	}
+	if _, out := call(map[string]any{"a": a, "b": c, "ignore": []string{"stdout"}}); out["equal"] != true || out["text"] != "no differences\n" {
+		t.Fatalf("expected ignored fields to compare equal: %v", out)
+	}
+
+	// Without b the job's command runs again from its journal entry.
+	code, out = call(map[string]any{"a": a})
+	if code != http.StatusOK || out["b"] != "fresh" || out["equal"] != true {
+		t.Fatalf("expected a fresh run to match, got %d %v", code, out)
+	}
+	if code, out = call(map[string]any{"a": a, "endpoint": "https://new.example"}); code != http.StatusOK || out["equal"] != false || !strings.Contains(out["text"].(string), "--endpoint https://new.example") {
+		t.Fatalf("expected the endpoint to change the dry-run output, got %d %v", code, out)
+	}
+	if code, _ := call(map[string]any{"a": c}); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 without a journal entry, got %d", code)
+	}
+	if code, _ := call(map[string]any{"a": "nope"}); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown job, got %d", code)
+	}
+	if code, _ := call(map[string]any{}); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a job, got %d", code)
+	}
+}
+
+func TestPurgeAction(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	var puts, deletes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			puts = append(puts, r.URL.Path)
+		case http.MethodDelete:
+			deletes = append(deletes, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	journalDir := t.TempDir()
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("JOURNAL_DIR", journalDir)
+	t.Setenv("STORE", "file://"+t.TempDir())
+	t.Setenv("PROFILES", `{"thorough": {"waitConfirmation": false}}`)
+	t.Setenv("OUTPUT_BUCKET", "leo-output")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	t.Setenv("OUTPUT_RETENTION_DAYS", "30")
+	t.Setenv("JOURNAL_RETENTION_DAYS", "7")
+	t.Setenv("JOB_RETENTION_DAYS", "90")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+
+	req := events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+	}
+	run := func(customer string) Response {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}, Profile: "thorough", MaxWaitSeconds: 5, Tags: map[string]string{"customer": customer}})
+		req.Body = string(b)
+		resp, _ := handler(context.Background(), req)
+		var r Response
+		if err := json.Unmarshal([]byte(resp.Body), &r); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("run for %s: %d %s", customer, resp.StatusCode, resp.Body)
+		}
+		return r
+	}
+	acme, other := run("acme"), run("other")
+	if len(puts) != 4 || !strings.HasPrefix(puts[0], "/leo-output/retention/30d/") {
+		t.Fatalf("expected outputs under the retention prefix, got %v", puts)
+	}
+	j := &journal.Journal{Dir: journalDir}
+	e, err := j.Read(acme.Meta["journal"])
+	if err != nil || e.Job == "" || len(e.Outputs) != 2 || e.ExpiresAt.Before(time.Now().Add(6*24*time.Hour)) {
+		t.Fatalf("unexpected journal entry %+v (%v)", e, err)
+	}
+	cfgEnv, err := currentConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadJobRecord(context.Background(), cfgEnv, e.Job); !ok || cfgEnv.jobTTL() != 90*24*time.Hour {
+		t.Fatalf("expected job %s in STORE for 90 days", e.Job)
+	}
+
+	call := func(params map[string]any) (int, map[string]any) {
+		b, _ := json.Marshal(request.InvokeRequest{Action: "purge", Params: params})
+		req.Body = string(b)
+		resp, _ := handler(context.Background(), req)
+		var out map[string]any
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp.StatusCode, out
+	}
+	if code, _ := call(map[string]any{"tags": map[string]any{"customer": "acme"}}); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin caller, got %d", code)
+	}
+	req.RequestContext.Authorizer = &events.LambdaFunctionURLRequestContextAuthorizerDescription{
+		IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/ops"},
+	}
+	if code, _ := call(map[string]any{}); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without tags, got %d", code)
+	}
+
+	code, out := call(map[string]any{"tags": map[string]any{"customer": "acme"}, "dryRun": true})
+	if code != http.StatusOK || fmt.Sprint(out["journal"]) != "["+e.ID+"]" || fmt.Sprint(out["jobs"]) != "["+e.Job+"]" || len(out["objects"].([]any)) != 2 || len(deletes) != 0 {
+		t.Fatalf("unexpected dry run %d %v (deletes %v)", code, out, deletes)
+	}
+	if code, out = call(map[string]any{"tags": map[string]any{"customer": "acme"}}); code != http.StatusOK {
+		t.Fatalf("purge: %d %v", code, out)
+	}
+	if len(deletes) != 2 || !strings.HasPrefix(deletes[0], "/leo-output/retention/30d/") {
+		t.Fatalf("expected both output objects deleted, got %v", deletes)
+	}
+	if _, ok := loadJobRecord(context.Background(), cfgEnv, e.Job); ok {
+		t.Fatal("job record survived the purge")
+	}
+	if e, err := j.Read(e.ID); err != nil || e.DeletedAt.IsZero() || e.Args != nil {
+		t.Fatalf("expected a tombstone, got %+v (%v)", e, err)
+	}
+	if e, _ := j.Read(other.Meta["journal"]); !e.DeletedAt.IsZero() || e.Tags["customer"] != "other" {
+		t.Fatalf("another customer's entry was purged: %+v", e)
+	}
+	if _, out = call(map[string]any{"tags": map[string]any{"customer": "acme"}}); len(out["journal"].([]any)) != 0 {
+		t.Fatalf("expected nothing left to purge, got %v", out)
+	}
+}
+
+func TestDeadlineFlags(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "execute,query")
+	t.Setenv("TIME_RESERVE", "2s")
+	t.Setenv("DEADLINE_FLAGS", `{"execute": [{"flag": "--timeout", "margin": "1s"}]}`)
+
+	call := func(ctx context.Context, args ...string) (int, Response) {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args})
+		resp, _ := handler(ctx, events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var r Response
+		_ = json.Unmarshal([]byte(resp.Body), &r)
+		return resp.StatusCode, r
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	// 20s less TIME_RESERVE and the margin, rounded down.
+	if _, r := call(ctx, "execute", "token.aleo/mint", "1u64"); !strings.Contains(r.Stdout, "execute --timeout 16 ") {
+		t.Fatalf("expected leo to get the time left, got %q", r.Stdout)
+	}
+	if _, r := call(ctx, "execute", "token.aleo/mint", "--timeout", "5"); !strings.Contains(r.Stdout, "--timeout 5") || strings.Count(r.Stdout, "--timeout") != 1 {
+		t.Fatalf("expected the caller's shorter timeout to be kept, got %q", r.Stdout)
+	}
+	if _, r := call(ctx, "query", "program", "credits.aleo"); strings.Contains(r.Stdout, "--timeout") {
+		t.Fatalf("flag set on a command without one configured: %q", r.Stdout)
+	}
+	if _, r := call(context.Background(), "execute", "token.aleo/mint"); strings.Contains(r.Stdout, "--timeout") {
+		t.Fatalf("flag set without a deadline: %q", r.Stdout)
+	}
+	t.Setenv("DEADLINE_FLAGS", `{"execute": [{"flag": "timeout"}]}`)
+	if code, _ := call(ctx, "execute", "token.aleo/mint"); code != http.StatusInternalServerError {
+		t.Fatalf("expected an invalid DEADLINE_FLAGS to be rejected, got %d", code)
+	}
+}
+
+func TestBulkheads(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_COMMANDS", "execute,query")
+	t.Setenv("METRICS_NAMESPACE", "LeoLambda")
+	t.Setenv("BULKHEADS", `{"write": {"concurrency": 1, "queue": 0}, "read": {"concurrency": 2, "queue": 2}}`)
+	var emf bytes.Buffer
+	metricsOut = &emf
+	t.Cleanup(func() { metricsOut = os.Stdout })
+
+	call := func(args ...string) (int, map[string]any) {
+		b, _ := json.Marshal(request.InvokeRequest{Args: args})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var body map[string]any
+		_ = json.Unmarshal([]byte(resp.Body), &body)
+		return resp.StatusCode, body
+	}
+	if code, _ := call("execute", "token.aleo/mint"); code != http.StatusOK {
+		t.Fatalf("expected an execute with a free slot to run, got %d", code)
+	}
+
+	// A long execute holds the only write slot.
+	busy, err := bulkheads.Admit(bulkheadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Release()
+	code, body := call("execute", "token.aleo/mint")
+	if code != http.StatusServiceUnavailable || body["code"] != "bulkhead_full" || body["bulkhead"] != bulkheadWrite {
+		t.Fatalf("expected the execute to be turned away, got %d %v", code, body)
+	}
+	if code, _ := call("query", "program", "credits.aleo"); code != http.StatusOK {
+		t.Fatalf("expected a query to run beside a full write bulkhead, got %d", code)
+	}
+	if !strings.Contains(emf.String(), `"BulkheadRejected":1`) || !strings.Contains(emf.String(), `"Bulkhead":"write"`) {
+		t.Fatalf("expected a rejection metric, got %s", emf.String())
+	}
+
+	// With room in the queue, an execute waits for the slot until maxWait.
+	t.Setenv("BULKHEADS", `{"write": {"concurrency": 1, "queue": 1, "maxWait": "20ms"}}`)
+	if code, body := call("execute", "token.aleo/mint"); code != http.StatusServiceUnavailable || !strings.Contains(body["error"].(string), "timed out") {
+		t.Fatalf("expected the queued execute to give up, got %d %v", code, body)
+	}
+	busy.Release()
+	if code, _ := call("execute", "token.aleo/mint"); code != http.StatusOK {
+		t.Fatalf("expected the released slot to be reused, got %d", code)
+	}
+	for _, s := range bulkheads.Stats() {
+		if s.Name == bulkheadWrite && (s.Running != 0 || s.Waiting != 0 || s.Rejected != 2) {
+			t.Fatalf("unexpected write bulkhead %+v", s)
+		}
+	}
+
+	// A run turned away by a full bulkhead gets its fee and contract quota back, so a
+	// client retrying after Retry-After is not charged for it.
+	t.Setenv("BULKHEADS", `{"write": {"concurrency": 1, "queue": 0}}`)
+	t.Setenv("DAILY_SPEND_LIMIT", "1000")
+	t.Setenv("CONTRACT_DAILY_LIMITS", `{"token.aleo": 1}`)
+	if busy, err = bulkheads.Admit(bulkheadWrite); err != nil {
+		t.Fatal(err)
+	}
+	code, _ = call("execute", "token.aleo/mint", "--priority-fee", "100")
+	busy.Release()
+	if spend := quotas.Snapshot("anonymous").Spend; code != http.StatusServiceUnavailable || spend == nil || spend.Used != 0 {
+		t.Fatalf("expected the rejected execute to be refunded, got %d %+v", code, spend)
+	}
+	if code, body := call("execute", "token.aleo/mint"); code != http.StatusOK {
+		t.Fatalf("expected the contract quota to be given back, got %d %v", code, body)
+	}
+	t.Setenv("DAILY_SPEND_LIMIT", "")
+	t.Setenv("CONTRACT_DAILY_LIMITS", "")
+
+	t.Setenv("BULKHEADS", `{"deploy": {"concurrency": 1}}`)
+	if code, _ := call("query", "program", "credits.aleo"); code != http.StatusInternalServerError {
+		t.Fatalf("expected an unknown bulkhead to be rejected, got %d", code)
+	}
+}
+
+func TestScaffoldAction(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	root := t.TempDir()
+	t.Setenv("WORKDIR_ROOT", root)
+	t.Setenv("WORKDIR", filepath.Join(root, "leo"))
+	t.Setenv("ALLOWED_COMMANDS", "execute,new")
+
+	var workdir string
+	orig := runCommand
+	runCommand = func(_ context.Context, cfg executor.Config) executor.Result {
+		workdir = cfg.WorkDir
+		if !slices.Equal(cfg.Args, []string{"new", "token_v2"}) {
+			return executor.Result{ExitCode: 1, Stderr: fmt.Sprintf("unexpected args %q", cfg.Args)}
+		}
+		project := filepath.Join(cfg.WorkDir, "token_v2")
+		_ = os.MkdirAll(filepath.Join(project, "src"), 0o755)
+		_ = os.WriteFile(filepath.Join(project, "program.json"), []byte(`{"program": "token_v2.aleo"}`), 0o644)
+		_ = os.WriteFile(filepath.Join(project, "src", "main.leo"), []byte("program token_v2.aleo {}"), 0o644)
+		_ = os.WriteFile(filepath.Join(project, ".env"), []byte("PRIVATE_KEY=APrivateKey1zkp"), 0o644)
+		return executor.Result{}
+	}
+	t.Cleanup(func() { runCommand = orig })
+
+	call := func(params map[string]any) (int, map[string]any) {
+		b, _ := json.Marshal(request.InvokeRequest{Action: "scaffold", Params: params})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out map[string]any
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp.StatusCode, out
+	}
+	status, out := call(map[string]any{
+		"name":     "token_v2",
+		"template": map[string]any{"src/main.leo": "program token_v2.aleo {\n    const SUPPLY: u64 = {{supply}}u64;\n}\n"},
+		"params":   map[string]any{"supply": "1000"},
+	})
+	if status != http.StatusOK || out["encoding"] != "tar+gzip" {
+		t.Fatalf("unexpected %d %v", status, out)
+	}
+	if _, err := os.Stat(workdir); !os.IsNotExist(err) {
+		t.Fatalf("workspace %s left behind", workdir)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(out["archive"].(string))
+	gz, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(b)
+	}
+	if got["token_v2/src/main.leo"] != "program token_v2.aleo {\n    const SUPPLY: u64 = 1000u64;\n}\n" || got["token_v2/program.json"] == "" {
+		t.Fatalf("unexpected archive %q", got)
+	}
+	if _, ok := got["token_v2/.env"]; ok {
+		t.Fatal("the generated .env must not leave the workspace")
+	}
+
+	for _, params := range []map[string]any{
+		{"name": "Token"},
+		{"name": "token_v2", "template": map[string]any{"../x.leo": "x"}},
+		{"name": "token_v2", "template": map[string]any{"src/main.leo": "{{supply}}"}},
+		{"name": "token_v2", "output": "s3"},
+	} {
+		if status, out := call(params); status != http.StatusBadRequest {
+			t.Fatalf("expected %v to be rejected, got %d %v", params, status, out)
+		}
+	}
+	t.Setenv("ALLOWED_COMMANDS", "execute")
+	if status, out := call(map[string]any{"name": "token_v2"}); status != http.StatusForbidden || out["code"] != "command_not_allowed" {
+		t.Fatalf("expected leo new to need the allowlist, got %d %v", status, out)
+	}
+}
+
+func TestAPIGatewayV2(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("HMAC_CLIENTS", `{"partner": {"primary": "s3cr3t"}}`)
+
+	call := func(method, path string, authorizer string, body string) events.APIGatewayV2HTTPResponse {
+		t.Helper()
+		raw := fmt.Sprintf(`{"version": "2.0", "routeKey": "ANY /{proxy+}", "rawPath": %q, "rawQueryString": "", "headers": {"content-type": "application/json"}, "body": %q,
+			"requestContext": {"apiId": "abc123", "domainName": "abc123.execute-api.us-east-1.amazonaws.com", "stage": "prod", "requestId": "r1",
+				"http": {"method": %q, "path": %q, "sourceIp": "203.0.113.9"}, "authorizer": %s}}`, path, body, method, path, authorizer)
+		out, err := invoke(context.Background(), json.RawMessage(raw))
+		if err != nil {
+			t.Fatalf("invoke: %v", err)
+		}
+		resp, ok := out.(events.APIGatewayV2HTTPResponse)
+		if !ok {
+			t.Fatalf("expected an HTTP API response, got %T", out)
+		}
+		return resp
+	}
+
+	// A Lambda authorizer's principal identifies the caller, without the HMAC
+	// signature the Function URL would require.
+	resp := call("GET", "/prod/quota", `{"lambda": {"principalId": "partner-1", "groups": ["minters"]}}`, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Body, `"identity":"authorizer:partner-1"`) {
+		t.Fatalf("unexpected quota response %d: %s", resp.StatusCode, resp.Body)
+	}
+	resp = call("GET", "/prod/quota", `{"jwt": {"claims": {"sub": "user-7", "groups": "[admins minters]"}, "scopes": null}}`, "")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Body, `"identity":"jwt:user-7"`) {
+		t.Fatalf("unexpected quota response %d: %s", resp.StatusCode, resp.Body)
+	}
+	// Without a principal, the handler's own authentication applies.
+	if resp := call("GET", "/prod/quota", `{"lambda": {}}`, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthenticated caller to be refused, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	// An IAM authorizer's principal counts as on the Function URL, admin actions included.
+	b, _ := json.Marshal(request.InvokeRequest{Action: "schedules"})
+	resp = call("POST", "/prod", `{"iam": {"userArn": "arn:aws:iam::123:role/ops", "accountId": "123"}}`, string(b))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the IAM principal to be an admin, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	// Function URL events keep their own shape.
+	raw, _ := json.Marshal(events.LambdaFunctionURLRequest{
+		Version: "2.0",
+		RawPath: "/quota",
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			APIID:      "urlid",
+			DomainName: "urlid.lambda-url.us-east-1.on.aws",
+			HTTP:       events.LambdaFunctionURLRequestContextHTTPDescription{Method: "GET", Path: "/quota"},
+			Authorizer: &events.LambdaFunctionURLRequestContextAuthorizerDescription{IAM: &events.LambdaFunctionURLRequestContextAuthorizerIAMDescription{UserARN: "arn:aws:iam::123:role/app"}},
+		},
+	})
+	out, err := invoke(context.Background(), raw)
+	if r, ok := out.(events.LambdaFunctionURLResponse); err != nil || !ok || r.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected Function URL response %T %v", out, err)
+	}
+
+	for path, want := range map[string]string{"/prod": "/", "/prod/jobs/1": "/jobs/1", "/production": "/production", "/": "/"} {
+		if got := stripStage(path, "prod"); got != want {
+			t.Fatalf("stripStage(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if g := splitGroups("[admins minters]"); !slices.Equal(g, []string{"admins", "minters"}) {
+		t.Fatalf("unexpected groups %q", g)
+	}
+}
+
+func TestAPIGatewayV1(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ADMIN_PRINCIPALS", "arn:aws:iam::123:role/ops")
+	t.Setenv("HMAC_CLIENTS", `{"partner": {"primary": "s3cr3t"}}`)
+	t.Setenv("GROUP_CONTRACTS", `{"minters": ["token.aleo"]}`)
+	t.Setenv("TRANSFORM_RULES", `[{"name": "stage-network", "when": {"!!": {"var": "stage.network"}}, "set": {"--network": {"var": "stage.network"}}}]`)
+
+	call := func(method, path, query, identity, authorizer, body string, b64 bool) events.APIGatewayProxyResponse {
+		t.Helper()
+		raw := fmt.Sprintf(`{"resource": "/{proxy+}", "path": %q, "httpMethod": %q, "headers": {"Content-Type": "text/plain"},
+			"multiValueHeaders": {"Content-Type": ["application/json"]}, "multiValueQueryStringParameters": %s,
+			"stageVariables": {"network": "testnet"}, "body": %q, "isBase64Encoded": %t,
+			"requestContext": {"apiId": "rest123", "stage": "prod", "requestId": "r1", "path": "/prod%s", "identity": %s, "authorizer": %s}}`,
+			path, method, cmp.Or(query, "null"), body, b64, path, identity, cmp.Or(authorizer, "null"))
+		out, err := invoke(context.Background(), json.RawMessage(raw))
+		if err != nil {
+			t.Fatalf("invoke: %v", err)
+		}
+		resp, ok := out.(events.APIGatewayProxyResponse)
+		if !ok {
+			t.Fatalf("expected a REST API response, got %T", out)
+		}
+		return resp
+	}
+	quota := func(identity, authorizer string) string {
+		t.Helper()
+		resp := call("GET", "/quota", "", identity, authorizer, "", false)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected quota response %d: %s", resp.StatusCode, resp.Body)
+		}
+		var out struct {
+			Identity string `json:"identity"`
+		}
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return out.Identity
+	}
+
+	// A usage plan's API key identifies callers that have no other principal.
+	if id := quota(`{"sourceIp": "203.0.113.9", "apiKeyId": "k1"}`, ""); id != "apikey:k1" {
+		t.Fatalf("unexpected identity %q", id)
+	}
+	if id := quota(`{"apiKeyId": "k1"}`, `{"principalId": "partner-1", "groups": "minters"}`); id != "authorizer:partner-1" {
+		t.Fatalf("unexpected identity %q", id)
+	}
+	if id := quota(`{}`, `{"claims": {"sub": "user-7"}}`); id != "jwt:user-7" {
+		t.Fatalf("unexpected identity %q", id)
+	}
+	if resp := call("GET", "/quota", "", `{}`, "", "", false); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthenticated caller to be refused, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	// An IAM caller is an admin as on the Function URL; the body arrives base64-encoded.
+	iam := `{"userArn": "arn:aws:iam::123:role/ops", "accountId": "123"}`
+	b, _ := json.Marshal(request.InvokeRequest{Action: "schedules"})
+	if resp := call("POST", "/", "", iam, "", base64.StdEncoding.EncodeToString(b), true); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the IAM principal to be an admin, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	// Stage variables reach TRANSFORM_RULES, so injection works as configured per stage.
+	b, _ = json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint_public", "aleo1abc", "5u64"}})
+	resp := call("POST", "/", "", iam, "", string(b), false)
+	var out Response
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out.Stdout, "--network testnet") {
+		t.Fatalf("expected the stage's network, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	resp = call("GET", "/", `{"args": ["execute", "token.aleo/mint_public", "aleo1abc", "5u64"]}`, iam, "", "", false)
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out.Stdout, "mint_public aleo1abc 5u64") {
+		t.Fatalf("expected a query invocation, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	// An authorizer's groups narrow what its callers may execute.
+	partner := `{"principalId": "partner-1", "groups": "minters"}`
+	if resp := call("GET", "/", `{"args": ["execute", "token.aleo/mint_public", "aleo1abc", "5u64"]}`, `{}`, partner, "", false); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the minters group to execute token.aleo, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if resp := call("GET", "/", `{"args": ["execute", "nft.aleo/mint", "1u64"]}`, `{}`, partner, "", false); resp.StatusCode != http.StatusForbidden || !strings.Contains(resp.Body, i18n.GroupNotAllowed) {
+		t.Fatalf("expected nft.aleo to be refused to the minters group, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	// Function URL and HTTP API events are not mistaken for REST API events.
+	if isAPIGatewayV1(json.RawMessage(`{"version": "2.0", "requestContext": {"apiId": "a", "http": {"method": "GET"}}}`)) {
+		t.Fatal("HTTP API payload 2.0 taken for a REST API event")
+	}
+	if r := toAPIGatewayV1(events.LambdaFunctionURLResponse{Cookies: []string{"a=1"}}); r.StatusCode != http.StatusOK || r.MultiValueHeaders["Set-Cookie"][0] != "a=1" {
+		t.Fatalf("unexpected response %+v", r)
+	}
+}
+
+func TestALB(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+
+	call := func(raw string) events.ALBTargetGroupResponse {
+		t.Helper()
+		out, err := invoke(context.Background(), json.RawMessage(raw))
+		if err != nil {
+			t.Fatalf("invoke: %v", err)
+		}
+		resp, ok := out.(events.ALBTargetGroupResponse)
+		if !ok {
+			t.Fatalf("expected an ALB response, got %T", out)
+		}
+		return resp
+	}
+	const elb = `"requestContext": {"elb": {"targetGroupArn": "arn:aws:elasticloadbalancing:us-east-1:123:targetgroup/leo/abc"}}`
+
+	// With multi-value headers, the query arrives percent-encoded and repeated.
+	resp := call(`{"httpMethod": "GET", "path": "/", ` + elb + `,
+		"multiValueQueryStringParameters": {"args": ["execute", "token.aleo%2Fmint_public", "aleo1abc", "5u64"]},
+		"multiValueHeaders": {"X-Forwarded-For": ["203.0.113.1, 10.0.0.5"], "Accept": ["application/json"]}, "body": "", "isBase64Encoded": false}`)
+	var out Response
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || resp.StatusDescription != "200 OK" || !strings.Contains(out.Stdout, "token.aleo/mint_public aleo1abc 5u64") {
+		t.Fatalf("unexpected query response %+v", resp)
+	}
+	if resp.Headers != nil || resp.MultiValueHeaders["Content-Type"][0] != "application/json" {
+		t.Fatalf("expected multi-value headers only, got %+v %+v", resp.Headers, resp.MultiValueHeaders)
+	}
+
+	// The caller's address is the one the load balancer appended.
+	resp = call(`{"httpMethod": "GET", "path": "/quota", ` + elb + `, "headers": {"x-forwarded-for": "198.51.100.7, 10.0.0.5"}, "body": ""}`)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Body, `"identity":"ip:10.0.0.5"`) || resp.MultiValueHeaders != nil {
+		t.Fatalf("unexpected quota response %+v", resp)
+	}
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint_public", "aleo1abc", "5u64"}})
+	raw, _ := json.Marshal(events.ALBTargetGroupRequest{
+		HTTPMethod:      "POST",
+		Path:            "/",
+		Headers:         map[string]string{"content-type": "application/json"},
+		Body:            base64.StdEncoding.EncodeToString(b),
+		IsBase64Encoded: true,
+		RequestContext:  events.ALBTargetGroupRequestContext{ELB: events.ELBContext{TargetGroupArn: "arn:aws:elasticloadbalancing:us-east-1:123:targetgroup/leo/abc"}},
+	})
+	resp = call(string(raw))
+	_ = json.Unmarshal([]byte(resp.Body), &out)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(out.Stdout, "aleo1abc 5u64") {
+		t.Fatalf("unexpected POST response %+v", resp)
+	}
+	if r := toALB(events.LambdaFunctionURLResponse{StatusCode: http.StatusTooManyRequests}, false); r.StatusDescription != "429 Too Many Requests" {
+		t.Fatalf("unexpected status description %q", r.StatusDescription)
+	}
+	if isAPIGatewayV1(raw) || isALB(json.RawMessage(`{"httpMethod": "GET", "requestContext": {"apiId": "a"}}`)) {
+		t.Fatal("ALB and REST API events confused")
+	}
+}
+
+func TestResumableJobs(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	const txID = "at1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq"
+	var (
+		mu         sync.Mutex
+		broadcasts int
+		nodeDown   = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/testnet/transaction/broadcast":
+			broadcasts++
+			if nodeDown {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(strconv.Quote(txID)))
+		case "/testnet/transaction/confirmed/" + txID:
+			_, _ = w.Write([]byte(`{"status":"accepted"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ENDPOINT", srv.URL)
+	t.Setenv("STORE", "file://"+t.TempDir())
+	t.Setenv("RESUMABLE_JOBS", "true")
+	origRun, origInterval := runCommand, confirmInterval
+	var runs int
+	runCommand = func(_ context.Context, cfg executor.Config) executor.Result {
+		runs++
+		dir := utils.GetFlagValue(cfg.Args, "--save")
+		if dir == "" || utils.HasAnyFlag(cfg.Args, "--broadcast") {
+			return executor.Result{ExitCode: 1, Stderr: fmt.Sprintf("unexpected args %v", cfg.Args)}
+		}
+		if err := os.WriteFile(filepath.Join(dir, "transaction.json"), []byte(`{"type":"execute","id":"`+txID+`"}`), 0o600); err != nil {
+			return executor.Result{ExitCode: 1, Stderr: err.Error()}
+		}
+		return executor.Result{Stdout: "saved"}
+	}
+	confirmInterval = time.Millisecond
+	t.Cleanup(func() { runCommand, confirmInterval = origRun, origInterval })
+	call := func(path, body string) events.LambdaFunctionURLResponse {
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RawPath:        path,
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST", Path: path}},
+			Body:           body,
+		})
+		return resp
+	}
+	resume := func(id string) jobs.Job {
+		t.Helper()
+		resp := call("/jobs/"+id+"/resume", "")
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("resume: %d %s", resp.StatusCode, resp.Body)
+		}
+		job, _ := jobRegistry.Wait(context.Background(), id, 5*time.Second)
+		if job.Status != jobs.StatusDone {
+			t.Fatalf("resumed job still %s", job.Status)
+		}
+		return job
+	}
+
+	// The transaction is proved and checkpointed, but the node refuses the broadcast.
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint_public", "--network", "testnet", "--broadcast"}, MaxWaitSeconds: 5, Profile: "thorough"})
+	var out Response
+	_ = json.Unmarshal([]byte(call("/", string(b)).Body), &out)
+	id := out.Meta["jobId"]
+	if out.ExitCode != 1 || out.Meta["broadcastError"] == "" || out.Meta["phase"] != phaseProved || id == "" {
+		t.Fatalf("unexpected first run %+v", out)
+	}
+
+	// Resuming broadcasts the stored transaction without proving it again.
+	mu.Lock()
+	nodeDown = false
+	mu.Unlock()
+	job := resume(id)
+	res, _ := job.Result.(Response)
+	if res.ExitCode != 0 || res.Meta["resumedFrom"] != phaseProved || res.Meta["transactionId"] != txID || res.Meta["confirmed"] != "true" || runs != 1 || broadcasts != 2 {
+		t.Fatalf("unexpected resumed job %+v after %d runs and %d broadcasts", job, runs, broadcasts)
+	}
+	if resp := call("/jobs/"+id+"/resume", ""); resp.StatusCode != http.StatusConflict || !strings.Contains(resp.Body, i18n.JobNotResumable) {
+		t.Fatalf("a finished job cannot be resumed, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := call("/jobs/unknown/resume", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown job, got %d", resp.StatusCode)
+	}
+
+	// A container that died while confirming leaves the job running; it is only resumed
+	// once JOB_TIMEOUT has passed, and then only confirmed.
+	cfgEnv, _ := currentConfig()
+	jobRegistry.Forget(id)
+	rec, _ := loadJobRecord(context.Background(), cfgEnv, id)
+	rec.Job.Status, rec.Checkpoint.Phase, rec.Checkpoint.UpdatedAt = jobs.StatusRunning, phaseBroadcast, clk.Now()
+	_ = putJobRecord(context.Background(), cfgEnv, rec, time.Hour)
+	if resp := call("/jobs/"+id+"/resume", ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("a running job cannot be resumed, got %d %s", resp.StatusCode, resp.Body)
+	}
+	rec.Checkpoint.UpdatedAt = clk.Now().Add(-cfgEnv.JobTimeout - time.Minute)
+	_ = putJobRecord(context.Background(), cfgEnv, rec, time.Hour)
+	job = resume(id)
+	if res, _ := job.Result.(Response); res.Meta["resumedFrom"] != phaseBroadcast || res.Meta["confirmed"] != "true" || broadcasts != 2 {
+		t.Fatalf("unexpected resumed job %+v", job)
+	}
+}
+
+func TestSagas(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	// Each transition broadcasts a transaction named after its function.
+	txOf := func(fn string) string { return "at1" + strings.Repeat(fn[:1], 58) }
+	var (
+		mu          sync.Mutex
+		ran         []string
+		failNotify  = true
+		unconfirmed = map[string]bool{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		tx, ok := strings.CutPrefix(r.URL.Path, "/testnet/transaction/confirmed/")
+		if !ok || unconfirmed[tx] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		status := "accepted"
+		if tx == txOf("notify") && failNotify {
+			status = "rejected"
+		}
+		_, _ = w.Write([]byte(`{"status":"` + status + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ENDPOINT", srv.URL)
+	origRun, origInterval, origTimeout := runCommand, confirmInterval, sagaConfirmTimeout
+	runCommand = func(_ context.Context, cfg executor.Config) executor.Result {
+		_, fn := utils.ExtractExecuteContract(cfg.Args)
+		mu.Lock()
+		ran = append(ran, fn)
+		mu.Unlock()
+		return executor.Result{Stdout: "broadcast " + txOf(fn)}
+	}
+	confirmInterval, sagaConfirmTimeout = time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { runCommand, confirmInterval, sagaConfirmTimeout = origRun, origInterval, origTimeout })
+
+	step := func(name, fn, compensate string) map[string]any {
+		s := map[string]any{"name": name, "args": []string{"execute", "token.aleo/" + fn, "--network", "testnet"}}
+		if compensate != "" {
+			s["compensate"] = []string{"execute", "token.aleo/" + compensate, "--network", "testnet"}
+		}
+		return s
+	}
+	steps := []any{step("approve", "approve", "void"), step("transfer", "transfer", "give_back"), step("notify", "notify", "")}
+	call := func(params map[string]any) (events.LambdaFunctionURLResponse, jobs.Job) {
+		b, _ := json.Marshal(request.InvokeRequest{Action: "saga", Params: params})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var job jobs.Job
+		_ = json.Unmarshal([]byte(resp.Body), &job)
+		return resp, job
+	}
+	// finish waits for saga job id and returns the saga as persisted in STORE.
+	finish := func(id string) saga.Saga {
+		t.Helper()
+		if j, _ := jobRegistry.Wait(context.Background(), id, 5*time.Second); j.Status != jobs.StatusDone {
+			t.Fatalf("saga job still %s", j.Status)
+		}
+		cfgEnv, _ := currentConfig()
+		rec, ok := loadJobRecord(context.Background(), cfgEnv, id)
+		if !ok || rec.Saga == nil || rec.Job.Status != jobs.StatusDone {
+			t.Fatalf("saga %s was not persisted: %+v", id, rec)
+		}
+		return *rec.Saga
+	}
+
+	if resp, _ := call(map[string]any{"steps": steps}); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("sagas need STORE, got %d %s", resp.StatusCode, resp.Body)
+	}
+	t.Setenv("STORE", "file://"+t.TempDir())
+	for _, bad := range []any{
+		[]any{map[string]any{"name": "a", "args": []string{"execute", "token.aleo/approve", "--network", "testnet", "--private-key", "APrivateKey1"}}},
+		[]any{map[string]any{"name": "a", "args": []string{"deploy", "--network", "testnet"}}},
+		[]any{map[string]any{"name": "a", "args": []string{"execute", "token.aleo/approve"}}},
+		[]any{map[string]any{"name": "a", "run": []string{"execute"}}},
+	} {
+		if resp, _ := call(map[string]any{"steps": bad}); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %v, got %d %s", bad, resp.StatusCode, resp.Body)
+		}
+	}
+
+	// notify is rejected on chain, so transfer and then approve are compensated.
+	resp, job := call(map[string]any{"steps": steps})
+	if resp.StatusCode != http.StatusAccepted || resp.Headers["Location"] != "/jobs/"+job.ID {
+		t.Fatalf("unexpected response %d %s", resp.StatusCode, resp.Body)
+	}
+	s := finish(job.ID)
+	if want := []string{"approve", "transfer", "notify", "give_back", "void"}; !slices.Equal(ran, want) {
+		t.Fatalf("ran %v, want %v", ran, want)
+	}
+	if s.Status != saga.Compensated || s.Progress[2].Status != saga.StepFailed || s.Progress[2].Error != "transaction rejected" ||
+		s.Progress[1].Status != saga.StepCompensated || s.Progress[1].CompensationID != txOf("give_back") {
+		t.Fatalf("unexpected saga %+v", s)
+	}
+	if resp, _ := call(map[string]any{"resume": job.ID}); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("a compensated saga cannot be resumed, got %d", resp.StatusCode)
+	}
+
+	// transfer is not final in time, so the saga stalls; resuming it confirms the same
+	// transaction rather than sending another.
+	mu.Lock()
+	ran, failNotify, unconfirmed[txOf("transfer")] = nil, false, true
+	mu.Unlock()
+	_, job = call(map[string]any{"steps": steps})
+	s = finish(job.ID)
+	if s.Status != saga.Running || s.Stalled == "" || s.Progress[1].TransactionID != txOf("transfer") || s.Progress[1].Status != saga.StepPending {
+		t.Fatalf("expected a stalled saga, got %+v", s)
+	}
+	mu.Lock()
+	delete(unconfirmed, txOf("transfer"))
+	mu.Unlock()
+	if resp, _ := call(map[string]any{"resume": job.ID}); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("resume: %d %s", resp.StatusCode, resp.Body)
+	}
+	s = finish(job.ID)
+	if want := []string{"approve", "transfer", "notify"}; s.Status != saga.Completed || !slices.Equal(ran, want) {
+		t.Fatalf("unexpected saga %+v after running %v", s, ran)
+	}
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	// Windows that opened this minute and stay open for ten.
+	now := time.Now().UTC()
+	cron := fmt.Sprintf("%d %d * * *", now.Minute(), now.Hour())
+	t.Setenv("MAINTENANCE_WINDOWS", `[
+		{"name": "migrate", "contracts": ["token.aleo"], "cron": "`+cron+`", "duration": "10m", "reason": "moving to token_v2.aleo"},
+		{"name": "reindex", "contracts": ["nft.aleo"], "cron": "`+cron+`", "duration": "10m", "action": "queue"}
+	]`)
+	call := func(contract string) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/mint", "1u64"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		return resp
+	}
+
+	resp := call("token.aleo")
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(resp.Body, "token_v2.aleo") {
+		t.Fatalf("expected 503 with the reason, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if s, _ := strconv.Atoi(resp.Headers["Retry-After"]); s < 9*60 || s > 10*60 {
+		t.Fatalf("unexpected Retry-After %q", resp.Headers["Retry-After"])
+	}
+
+	resp = call("nft.aleo")
+	var job jobs.Job
+	_ = json.Unmarshal([]byte(resp.Body), &job)
+	if resp.StatusCode != http.StatusAccepted || resp.Headers["Location"] != "/jobs/"+job.ID || job.Status == jobs.StatusDone {
+		t.Fatalf("expected a held job, got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	// Holding past JOB_TIMEOUT is refused instead.
+	t.Setenv("JOB_TIMEOUT", "5m")
+	if resp := call("nft.aleo"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d %s", resp.StatusCode, resp.Body)
+	}
+	if resp := call("other.aleo"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("unaffected contract got %d %s", resp.StatusCode, resp.Body)
+	}
+
+	// An event source could not follow the job, and it would die with the invocation, so
+	// the message is refused and left for redelivery.
+	t.Setenv("JOB_TIMEOUT", "")
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "nft.aleo/mint", "1u64"}})
+	if runSQSMessage(context.Background(), events.SQSMessage{MessageId: "1", Body: string(b), EventSourceARN: "arn:aws:sqs:us-east-1:123:leo"}) {
+		t.Fatal("expected a held execute from SQS to be left on the queue")
+	}
+	if resp, _ := runEventBody(context.Background(), "kinesis:leo", string(b)); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for an event-sourced execute, got %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestLocalizedErrors(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	t.Setenv("ERROR_MESSAGES", `{"pt": {"contract_not_allowed": "O programa {contract} não é permitido."}}`)
+	call := func(accept string) (events.LambdaFunctionURLResponse, map[string]any) {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "nft.aleo/mint", "1u64"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Headers:        map[string]string{"accept-language": accept},
+			Body:           string(b),
+		})
+		var out map[string]any
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return resp, out
+	}
+
+	resp, out := call("de-CH, fr;q=0.5")
+	if resp.StatusCode != http.StatusForbidden || out["code"] != "contract_not_allowed" || out["error"] != `contract "nft.aleo" not allowed` {
+		t.Fatalf("unexpected %d %s", resp.StatusCode, resp.Body)
+	}
+	if out["message"] != "Das Programm nft.aleo ist nicht erlaubt." || resp.Headers["Content-Language"] != "de" || resp.Headers["Vary"] != "Accept-Language" {
+		t.Fatalf("unexpected localization %s %v", resp.Body, resp.Headers)
+	}
+	if params, _ := out["params"].(map[string]any); params["contract"] != "nft.aleo" {
+		t.Fatalf("unexpected params %v", out["params"])
+	}
+	if _, out := call("pt-PT"); out["message"] != "O programa nft.aleo não é permitido." {
+		t.Fatalf("operator locale ignored: %v", out)
+	}
+	if resp, out := call(""); out["message"] != "The program nft.aleo is not allowed." || resp.Headers["Content-Language"] != "en" {
+		t.Fatalf("unexpected default %s", resp.Body)
+	}
+}
+
+func TestSQS(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+
+	batch := func(arn string, bodies ...string) json.RawMessage {
+		ev := events.SQSEvent{}
+		for i, b := range bodies {
+			ev.Records = append(ev.Records, events.SQSMessage{MessageId: strconv.Itoa(i), Body: b, EventSource: "aws:sqs", EventSourceARN: arn})
+		}
+		raw, _ := json.Marshal(ev)
+		return raw
+	}
+	call := func(raw json.RawMessage) []string {
+		t.Helper()
+		out, err := invoke(context.Background(), raw)
+		if err != nil {
+			t.Fatalf("invoke: %v", err)
+		}
+		resp, ok := out.(events.SQSEventResponse)
+		if !ok {
+			t.Fatalf("expected an SQS batch response, got %T", out)
+		}
+		var ids []string
+		for _, f := range resp.BatchItemFailures {
+			ids = append(ids, f.ItemIdentifier)
+		}
+		return ids
+	}
+	const (
+		mint    = `{"args": ["execute", "token.aleo/mint_public", "aleo1abc", "5u64"], "maxWaitSeconds": 5}`
+		denied  = `{"args": ["execute", "other.aleo/mint_public", "aleo1abc", "5u64"]}`
+		garbage = `not json`
+	)
+	const queue = "arn:aws:sqs:us-east-1:123:leo"
+	if ids := call(batch(queue, mint, denied, garbage, mint)); !slices.Equal(ids, []string{"1", "2"}) {
+		t.Fatalf("expected messages 1 and 2 to fail, got %v", ids)
+	}
+	// On a FIFO queue, messages after a failure wait for the next delivery.
+	if ids := call(batch(queue+".fifo", mint, denied, mint)); !slices.Equal(ids, []string{"1", "2"}) {
+		t.Fatalf("expected messages 1 and 2 to fail on a FIFO queue, got %v", ids)
+	}
+	if ids := call(batch(queue, mint)); ids != nil {
+		t.Fatalf("expected no failures, got %v", ids)
+	}
+	if isSQS(json.RawMessage(`{"Records": [{"eventSource": "aws:s3"}]}`)) {
+		t.Fatal("S3 event taken for SQS")
+	}
+}
+
+func TestSNS(t *testing.T) {
+	var published []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		published = append(published, r.PostForm)
+		_, _ = w.Write([]byte(`<PublishResponse><PublishResult><MessageId>1</MessageId></PublishResult></PublishResponse>`))
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	t.Setenv("RESULTS_TOPIC_ARN", "arn:aws:sns:us-east-1:123:leo-results.fifo")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+	ev := events.SNSEvent{}
+	for i, msg := range []string{
+		`{"args": ["execute", "token.aleo/mint_public", "aleo1abc", "5u64"], "maxWaitSeconds": 5}`,
+		`{"args": ["execute", "other.aleo/mint_public", "aleo1abc", "5u64"]}`,
+	} {
+		ev.Records = append(ev.Records, events.SNSEventRecord{EventSource: "aws:sns", SNS: events.SNSEntity{
+			MessageID: strconv.Itoa(i),
+			TopicArn:  "arn:aws:sns:us-east-1:123:leo-executes",
+			Message:   msg,
+		}})
+	}
+	raw, _ := json.Marshal(ev)
+	if !isSNS(raw) || isSQS(raw) {
+		t.Fatal("SNS event not recognized")
+	}
+	if out, err := invoke(context.Background(), raw); err != nil || out != nil {
+		t.Fatalf("unexpected invoke result %v %v", out, err)
+	}
+	if len(published) != 2 {
+		t.Fatalf("expected two results, got %d", len(published))
+	}
+	var res snsResult
+	var out Response
+	_ = json.Unmarshal([]byte(published[0].Get("Message")), &res)
+	_ = json.Unmarshal(res.Response, &out)
+	if res.MessageID != "0" || res.Status != http.StatusOK || !strings.Contains(out.Stdout, "token.aleo/mint_public aleo1abc 5u64") {
+		t.Fatalf("unexpected result %s", published[0].Get("Message"))
+	}
+	p := published[1]
+	if p.Get("Action") != "Publish" || p.Get("TopicArn") != "arn:aws:sns:us-east-1:123:leo-results.fifo" ||
+		p.Get("MessageAttributes.entry.1.Value.StringValue") != "403" ||
+		p.Get("MessageGroupId") != "leo-executes" || p.Get("MessageDeduplicationId") != "1" {
+		t.Fatalf("unexpected publish %v", p)
+	}
+}
+
+func TestEventBridgeRequest(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	var logs bytes.Buffer
+	logOutput = &logs
+	t.Cleanup(func() { logOutput = os.Stdout })
+
+	event := func(detail string) json.RawMessage {
+		return json.RawMessage(`{"version": "0", "id": "ev-1", "detail-type": "Scheduled Event", "source": "aws.events",
+			"resources": ["arn:aws:events:us-east-1:123:rule/keepers/settle"], "detail": ` + detail + `}`)
+	}
+	out, err := invoke(context.Background(), event(`{"args": ["execute", "token.aleo/settle"], "tags": {"job": "settle"}}`))
+	var resp Response
+	if b, ok := out.(json.RawMessage); !ok || err != nil || json.Unmarshal(b, &resp) != nil || !strings.Contains(resp.Stdout, "token.aleo/settle") {
+		t.Fatalf("unexpected result %v %v", out, err)
+	}
+	if strings.Contains(logs.String(), `"level":"warn"`) {
+		t.Fatalf("unexpected warning %s", logs.String())
+	}
+
+	if _, err := invoke(context.Background(), event(`{"args": ["execute", "other.aleo/settle"]}`)); err != nil {
+		t.Fatalf("a failed run must not fail the invocation: %v", err)
+	}
+	if !strings.Contains(logs.String(), `"rule":"settle"`) || !strings.Contains(logs.String(), `"status":"403"`) {
+		t.Fatalf("expected the failure to be logged with the rule, got %s", logs.String())
+	}
+
+	// Without a request in the detail, a scheduled event is still a task.
+	if _, ok := eventRequest(event(`{}`)); ok {
+		t.Fatal("empty detail taken for a request")
+	}
+	if got := eventRule(events.CloudWatchEvent{Source: "app.orders"}); got != "app.orders" {
+		t.Fatalf("expected the source as rule name, got %q", got)
+	}
+}
+
+func TestStderrCategories(t *testing.T) {
+	alerts := make(chan map[string]any, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		alerts <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("METRICS_NAMESPACE", "LeoLambda")
+	t.Setenv("STDERR_RULES", `[{"category": "nonce_conflict", "pattern": "(?i)nonce"}]`)
+	t.Setenv("PAGERDUTY_ROUTING_KEY", "rk")
+	t.Setenv("PAGERDUTY_EVENTS_URL", srv.URL)
+	t.Setenv("ALERT_FAILURE_STREAK", "1")
+	t.Setenv("ALERT_CATEGORIES", "rejected_execution,nonce_conflict")
+	var emf bytes.Buffer
+	metricsOut = &emf
+	stderr := ""
+	orig := runCommand
+	runCommand = func(context.Context, executor.Config) executor.Result {
+		return executor.Result{ExitCode: 1, Stderr: stderr}
+	}
+	t.Cleanup(func() { metricsOut, runCommand = os.Stdout, orig })
+
+	call := func(s string) Response {
+		t.Helper()
+		stderr = s
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		var out Response
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		return out
+	}
+	// Invalid input is the caller's doing: it is categorized but pages nobody.
+	if out := call("Error: failed to parse input `1u6`"); out.Code != classify.InvalidInput {
+		t.Fatalf("expected invalid_input, got %+v", out)
+	}
+	if !strings.Contains(emf.String(), `"Category":"invalid_input"`) || !strings.Contains(emf.String(), `"RunFailures":1`) {
+		t.Fatalf("expected a RunFailures metric, got %s", emf.String())
+	}
+	select {
+	case a := <-alerts:
+		t.Fatalf("unexpected alert %v", a)
+	default:
+	}
+	if out := call("Error: transaction rejected: nonce already used"); out.Code != "nonce_conflict" {
+		t.Fatalf("expected the operator's category, got %+v", out)
+	}
+	select {
+	case a := <-alerts:
+		if !strings.Contains(fmt.Sprint(a), "[nonce_conflict]") {
+			t.Fatalf("expected the category in the alert, got %v", a)
+		}
+	default:
+		t.Fatal("expected an alert for an alerting category")
+	}
+}
+
+func TestDirectInvoke(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+
+	out, err := invoke(context.Background(), json.RawMessage(`{"args": ["execute", "token.aleo/mint"]}`))
+	var resp Response
+	if b, ok := out.(json.RawMessage); !ok || err != nil || json.Unmarshal(b, &resp) != nil || !strings.Contains(resp.Stdout, "token.aleo/mint") {
+		t.Fatalf("unexpected result %v %v", out, err)
+	}
+
+	// Errors come back as the error body.
+	out, err = invoke(context.Background(), json.RawMessage(`{"args": ["execute", "other.aleo/mint"]}`))
+	var failed struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if b, ok := out.(json.RawMessage); !ok || err != nil || json.Unmarshal(b, &failed) != nil || failed.Error == "" {
+		t.Fatalf("expected an error body, got %s %v", out, err)
+	}
+
+	for _, raw := range []string{`{"requestContext": {}, "body": "{\"args\": []}"}`, `{"task": "export"}`, `[]`} {
+		if isDirect(json.RawMessage(raw)) {
+			t.Fatalf("%s taken for a direct request", raw)
+		}
+	}
+}
+
+func TestMultipartResponse(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	call := func(contract string) events.LambdaFunctionURLResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/mint", "1u64"}})
+		resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Headers:        map[string]string{"accept": "multipart/mixed, application/json"},
+			Body:           string(b),
+		})
+		return resp
+	}
+
+	resp := call("token.aleo")
+	p, err := mixed.Decode(resp.Headers["Content-Type"], []byte(resp.Body))
+	if resp.StatusCode != http.StatusOK || err != nil {
+		t.Fatalf("unexpected %d %v %s", resp.StatusCode, err, resp.Body)
+	}
+	var meta Response
+	if err := json.Unmarshal(p.Meta, &meta); err != nil || meta.Stdout != "" || !strings.Contains(string(p.Stdout), "token.aleo/mint") {
+		t.Fatalf("unexpected parts %s %q", p.Meta, p.Stdout)
+	}
+
+	// Errors stay JSON.
+	if resp := call("nft.aleo"); resp.StatusCode != http.StatusForbidden || resp.Headers["Content-Type"] != "application/json" {
+		t.Fatalf("unexpected error response %d %v", resp.StatusCode, resp.Headers)
+	}
+}
+
+func TestTaskToken(t *testing.T) {
+	type call struct {
+		target string
+		in     map[string]string
+	}
+	var calls []call
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := call{target: r.Header.Get("X-Amz-Target")}
+		_ = json.NewDecoder(r.Body).Decode(&c.in)
+		calls = append(calls, c)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+
+	if _, err := invoke(context.Background(), json.RawMessage(`{"taskToken": "tok-1", "args": ["execute", "token.aleo/mint"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	var out Response
+	if len(calls) != 1 || calls[0].target != "AWSStepFunctions.SendTaskSuccess" || calls[0].in["taskToken"] != "tok-1" ||
+		json.Unmarshal([]byte(calls[0].in["output"]), &out) != nil || !strings.Contains(out.Stdout, "token.aleo/mint") {
+		t.Fatalf("unexpected callbacks %+v", calls)
+	}
+
+	if _, err := invoke(context.Background(), json.RawMessage(`{"taskToken": "tok-2", "args": ["execute", "other.aleo/mint"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[1].target != "AWSStepFunctions.SendTaskFailure" || calls[1].in["error"] != "contract_not_allowed" || calls[1].in["cause"] == "" {
+		t.Fatalf("unexpected callbacks %+v", calls)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ALLOWED_COMMANDS", "execute, Query")
+	t.Setenv("ALLOWED_CONTRACTS", "credits.aleo,vlink_*.aleo")
+	t.Setenv("MAX_FEE", "5000")
+	resp, err := handler(context.Background(), events.LambdaFunctionURLRequest{
+		RawPath:        "/capabilities",
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "GET"}},
+	})
+	var caps capabilities
+	if err != nil || resp.StatusCode != http.StatusOK || json.Unmarshal([]byte(resp.Body), &caps) != nil {
+		t.Fatalf("unexpected %d %s %v", resp.StatusCode, resp.Body, err)
+	}
+	if !slices.Equal(caps.Commands, []string{"execute", "query"}) || !slices.Equal(caps.Contracts, []string{"credits.aleo", "vlink_*.aleo"}) || caps.MaxFee != 5000 || caps.Transforms {
+		t.Fatalf("unexpected capabilities %+v", caps)
+	}
+}
+
+func TestS3Manifest(t *testing.T) {
+	objects := map[string]string{
+		"/inbox/batch/mint 1.json": `{"args": ["execute", "token.aleo/mint", "1u64"], "tags": {"batch": "7"}}`,
+		"/inbox/batch/burn.json":   `{"args": ["execute", "other.aleo/burn"]}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(b)
+		}
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	var logs bytes.Buffer
+	logOutput = &logs
+	t.Cleanup(func() { logOutput = os.Stdout })
+
+	raw := json.RawMessage(`{"Records": [
+		{"eventSource": "aws:s3", "s3": {"bucket": {"name": "inbox"}, "object": {"key": "batch/mint+1.json"}}},
+		{"eventSource": "aws:s3", "s3": {"bucket": {"name": "inbox"}, "object": {"key": "batch/burn.json"}}},
+		{"eventSource": "aws:s3", "s3": {"bucket": {"name": "inbox"}, "object": {"key": "batch/old.result.json"}}}]}`)
+	if !isS3(raw) || isSQS(raw) {
+		t.Fatal("S3 event not recognized")
+	}
+	if out, err := invoke(context.Background(), raw); err != nil || out != nil {
+		t.Fatalf("unexpected invoke result %v %v", out, err)
+	}
+	var res s3Result
+	var resp Response
+	_ = json.Unmarshal([]byte(objects["/inbox/batch/mint 1.result.json"]), &res)
+	_ = json.Unmarshal(res.Response, &resp)
+	if res.Manifest != "s3://inbox/batch/mint 1.json" || res.Status != http.StatusOK || !strings.Contains(resp.Stdout, "token.aleo/mint") {
+		t.Fatalf("unexpected result %v", objects)
+	}
+	_ = json.Unmarshal([]byte(objects["/inbox/batch/burn.result.json"]), &res)
+	if res.Status != http.StatusForbidden || !strings.Contains(logs.String(), `"key":"batch/burn.json"`) {
+		t.Fatalf("expected the failure to be written and logged, got %v %s", objects, logs.String())
+	}
+	if len(objects) != 4 {
+		t.Fatalf("a result was run as a manifest: %v", objects)
+	}
+
+	t.Setenv("MANIFEST_RESULTS_PREFIX", "results/")
+	cfgEnv, _ := currentConfig()
+	if key, ok := resultKey(cfgEnv, "batch/a.json"); !ok || key != "results/batch/a.json" {
+		t.Fatalf("unexpected result key %q", key)
+	}
+	if _, ok := resultKey(cfgEnv, "results/batch/a.json"); ok {
+		t.Fatal("result under MANIFEST_RESULTS_PREFIX taken for a manifest")
+	}
+}
+
+func TestKinesis(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	orig := runCommand
+	runCommand = func(_ context.Context, cfg executor.Config) executor.Result {
+		if slices.Contains(cfg.Args, "fail") {
+			return executor.Result{ExitCode: 1, Stderr: "Error: rejected"}
+		}
+		return executor.Result{Stdout: "ok"}
+	}
+	t.Cleanup(func() { runCommand = orig })
+
+	batch := func(data ...string) json.RawMessage {
+		ev := events.KinesisEvent{}
+		for i, d := range data {
+			ev.Records = append(ev.Records, events.KinesisEventRecord{EventSource: "aws:kinesis", EventSourceArn: "arn:aws:kinesis:us-east-1:123:stream/executes",
+				Kinesis: events.KinesisRecord{SequenceNumber: strconv.Itoa(i), PartitionKey: "p", Data: []byte(d)}})
+		}
+		raw, _ := json.Marshal(ev)
+		return raw
+	}
+	call := func(raw json.RawMessage) []string {
+		t.Helper()
+		out, err := invoke(context.Background(), raw)
+		resp, ok := out.(events.KinesisEventResponse)
+		if err != nil || !ok {
+			t.Fatalf("expected a Kinesis batch response, got %T %v", out, err)
+		}
+		var ids []string
+		for _, f := range resp.BatchItemFailures {
+			ids = append(ids, f.ItemIdentifier)
+		}
+		return ids
+	}
+	const (
+		mint   = `{"args": ["execute", "token.aleo/mint", "1u64"]}`
+		failed = `{"args": ["execute", "token.aleo/mint", "fail"]}`
+		denied = `{"args": ["execute", "other.aleo/mint", "1u64"]}`
+	)
+	// Rejected requests are skipped; the batch stops at the first failed run.
+	if ids := call(batch(mint, denied, mint, failed, mint)); !slices.Equal(ids, []string{"3"}) {
+		t.Fatalf("expected record 3 to be reported, got %v", ids)
+	}
+	if ids := call(batch(mint, denied)); ids != nil {
+		t.Fatalf("expected no failures, got %v", ids)
+	}
+	// A queueing maintenance window cannot hold a record in a job that would die with
+	// the invocation; the shard waits at the record until the window closes.
+	now := time.Now().UTC()
+	t.Setenv("MAINTENANCE_WINDOWS", fmt.Sprintf(`[{"name": "reindex", "contracts": ["token.aleo"], "cron": "%d %d * * *", "duration": "10m", "action": "queue"}]`, now.Minute(), now.Hour()))
+	if ids := call(batch(mint, mint)); !slices.Equal(ids, []string{"0"}) {
+		t.Fatalf("expected the held record to be retried, got %v", ids)
+	}
+	t.Setenv("MAINTENANCE_WINDOWS", "")
+	if isSQS(batch(mint)) || isKinesis(json.RawMessage(`{"Records": [{"eventSource": "aws:sqs"}]}`)) {
+		t.Fatal("event sources confused")
+	}
+}
+
+func TestContractStats(t *testing.T) {
+	var writes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.TransactWriteItems":
+			writes = append(writes, string(b))
+			_, _ = w.Write([]byte(`{}`))
+		case "DynamoDB_20120810.BatchGetItem":
+			// Every day lists token.aleo, which ran twice, once successfully, on each.
+			var in struct {
+				RequestItems map[string]struct {
+					Keys []map[string]map[string]string
+				}
+			}
+			_ = json.Unmarshal(b, &in)
+			var items []map[string]any
+			for _, k := range in.RequestItems["rollups"].Keys {
+				id := k["id"]["S"]
+				if date, ok := strings.CutPrefix(id, "index#"); ok {
+					items = append(items, map[string]any{"id": map[string]string{"S": id}, "contracts": map[string][]string{"SS": {"token.aleo"}}, "date": map[string]string{"S": date}})
+					continue
+				}
+				contract, date, _ := strings.Cut(id, "#")
+				items = append(items, map[string]any{
+					"id": map[string]string{"S": id}, "contract": map[string]string{"S": contract}, "date": map[string]string{"S": date},
+					"runs": map[string]string{"N": "2"}, "succeeded": map[string]string{"N": "1"}, "durationMs": map[string]string{"N": "3000"}, "fees": map[string]string{"N": "100"},
+				})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"Responses": map[string]any{"rollups": items}})
+		}
+	}))
+	defer srv.Close()
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("ROLLUP_TABLE", "rollups")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "b")
+	t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+	get := func(path, query string) events.LambdaFunctionURLResponse {
+		resp, err := handler(context.Background(), events.LambdaFunctionURLRequest{
+			RawPath:        path,
+			RawQueryString: query,
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "GET"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", "token.aleo/mint", "1u64"}})
+	resp, _ := handler(context.Background(), events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           string(b),
+	})
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Body, "rollupError") || len(writes) != 1 || !strings.Contains(writes[0], `"token.aleo#`) || !strings.Contains(writes[0], `"index#`) {
+		t.Fatalf("expected the execute to update its rollup, got %d %s %v", resp.StatusCode, resp.Body, writes)
+	}
+
+	resp = get("/stats", "days=2")
+	var stats struct {
+		From      string                   `json:"from"`
+		Contracts map[string]rollup.Totals `json:"contracts"`
+		Days      []rollup.Day             `json:"days"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal([]byte(resp.Body), &stats) != nil {
+		t.Fatalf("unexpected %d %s", resp.StatusCode, resp.Body)
+	}
+	if tok := stats.Contracts["token.aleo"]; len(stats.Days) != 2 || tok.Runs != 4 || tok.SuccessRate != 0.5 || tok.AvgDuration != 1.5 || tok.Fees != 200 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if got := get("/stats", "days=40").StatusCode; got != http.StatusBadRequest {
+		t.Fatalf("expected more than %d days to be refused, got %d", rollup.MaxDays, got)
+	}
+
+	var caps capabilities
+	if resp = get("/capabilities", ""); json.Unmarshal([]byte(resp.Body), &caps) != nil || caps.Stats["token.aleo"].Runs != 2*statsDays {
+		t.Fatalf("expected a week of stats in the capabilities, got %s", resp.Body)
+	}
+}
+
+func TestResponseStreaming(t *testing.T) {
+	warm.Reset()
+	t.Cleanup(warm.Reset)
+	t.Setenv("CONFIG_RELOAD_EACH_INVOCATION", "1")
+	t.Setenv("ALLOWED_CONTRACTS", "token.aleo")
+	t.Setenv("RESPONSE_STREAMING", "true")
+	orig := runCommand
+	runCommand = func(_ context.Context, cfg executor.Config) executor.Result {
+		if cfg.OnOutput != nil {
+			cfg.OnOutput(executor.Stdout, "compiling token.aleo", time.Now())
+			cfg.OnOutput(executor.Stderr, "slow endpoint", time.Now())
+			cfg.OnOutput(executor.Stdout, "done", time.Now())
+		}
+		return executor.Result{Stdout: "compiling token.aleo\ndone\n", Stderr: "slow endpoint\n"}
+	}
+	t.Cleanup(func() { runCommand = orig })
+	call := func(contract string) *events.LambdaFunctionURLStreamingResponse {
+		b, _ := json.Marshal(request.InvokeRequest{Args: []string{"execute", contract + "/mint", "1u64"}})
+		raw, _ := json.Marshal(events.LambdaFunctionURLRequest{
+			Headers:        map[string]string{"accept": "application/x-ndjson"},
+			RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+			Body:           string(b),
+		})
+		out, err := invoke(context.Background(), raw)
+		resp, ok := out.(*events.LambdaFunctionURLStreamingResponse)
+		if err != nil || !ok {
+			t.Fatalf("expected a streaming response, got %T %v", out, err)
+		}
+		return resp
+	}
+
+	resp := call("token.aleo")
+	if resp.StatusCode != http.StatusOK || resp.Headers["Content-Type"] != stream.MediaType {
+		t.Fatalf("unexpected %d %v", resp.StatusCode, resp.Headers)
+	}
+	var lines []string
+	trailer, err := stream.Read(resp.Body, func(s, line string) { lines = append(lines, s+": "+line) })
+	if err != nil || !slices.Equal(lines, []string{"stdout: compiling token.aleo", "stderr: slow endpoint", "stdout: done"}) {
+		t.Fatalf("unexpected lines %q %v", lines, err)
+	}
+	var summary struct {
+		Status   int     `json:"status"`
+		ExitCode *int    `json:"exitCode"`
+		Duration float64 `json:"duration"`
+		Stdout   string  `json:"stdout"`
+	}
+	if json.Unmarshal(trailer, &summary) != nil || summary.Status != http.StatusOK || summary.ExitCode == nil || *summary.ExitCode != 0 || summary.Stdout != "" {
+		t.Fatalf("unexpected trailer %s", trailer)
+	}
+
+	// A refused request streams nothing and keeps its status.
+	resp = call("nft.aleo")
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(b), "contract_not_allowed") {
+		t.Fatalf("expected the refusal as is, got %d %s", resp.StatusCode, b)
+	}
+
+	// Without RESPONSE_STREAMING the function URL buffers, so the response does too.
+	t.Setenv("RESPONSE_STREAMING", "false")
+	raw, _ := json.Marshal(events.LambdaFunctionURLRequest{
+		Headers:        map[string]string{"accept": "application/x-ndjson"},
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+		Body:           `{"args": ["execute", "token.aleo/mint", "1u64"]}`,
+	})
+	if out, _ := invoke(context.Background(), raw); reflect.TypeOf(out) != reflect.TypeOf(events.LambdaFunctionURLResponse{}) {
+		t.Fatalf("expected a buffered response, got %T", out)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/maintenance"
+)
+
+// maintenanceHold applies MAINTENANCE_WINDOWS to an execute of contract at now. It returns
+// when a queueing window ends, so the execute can wait for it in a job, or the response
+// refusing the execute. Neither is set outside maintenance. Executes the window would
+// hold for longer than JOB_TIMEOUT, or that the worker fleet proves, are refused. So
+// are requests the function makes to itself, from event sources and schedules: the job
+// would not outlive the invocation that delivered them, while a 503 has the source
+// retry them.
+func maintenanceHold(ctx context.Context, cfgEnv *EnvConfig, contract string, now time.Time) (time.Time, *events.LambdaFunctionURLResponse) {
+	w, until, ok := maintenance.Active(cfgEnv.maintenance, contract, now)
+	if !ok {
+		return time.Time{}, nil
+	}
+	queued := cfgEnv.workers != nil && !cfgEnv.DryRun && cfgEnv.workers.Applies(contract)
+	_, internal := ctx.Value(internalCaller{}).(string)
+	if w.Action == maintenance.ActionQueue && until.Sub(now) < cfgEnv.JobTimeout && !queued && !internal {
+		return until, nil
+	}
+	body := codedError(i18n.Maintenance, fmt.Sprintf("%s is in maintenance until %s", contract, until.Format(time.RFC3339)),
+		map[string]string{"contract": contract, "until": until.Format(time.RFC3339)})
+	body["window"] = w.Name
+	body["retryAt"] = until.Format(time.RFC3339)
+	if w.Reason != "" {
+		body["reason"] = w.Reason
+	}
+	resp := jsonResp(http.StatusServiceUnavailable, body)
+	resp.Headers["Retry-After"] = strconv.Itoa(int(until.Sub(now).Round(time.Second).Seconds()))
+	return time.Time{}, &resp
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/schema"
+)
+
+// codedError is an error body with a stable code from pkg/i18n and the params its
+// message refers to, next to the English error.
+func codedError(code, msg string, params map[string]string) map[string]any {
+	body := map[string]any{"error": msg, "code": code}
+	if len(params) > 0 {
+		body["params"] = params
+	}
+	return body
+}
+
+// withFields adds the offending fields of verr to an error body.
+func withFields(body map[string]any, verr *schema.ValidationError) map[string]any {
+	body["fields"] = verr.Errors
+	return body
+}
+
+// localize adds the catalog message for an error body's code, in the locale that best
+// matches the request's Accept-Language, so clients need not match on English text.
+func localize(resp events.LambdaFunctionURLResponse, c i18n.Catalog, accept string) events.LambdaFunctionURLResponse {
+	if resp.StatusCode < http.StatusBadRequest || !strings.Contains(resp.Body, `"code"`) {
+		return resp
+	}
+	var body map[string]any
+	if json.Unmarshal([]byte(resp.Body), &body) != nil {
+		return resp
+	}
+	code, _ := body["code"].(string)
+	params := map[string]string{}
+	if p, ok := body["params"].(map[string]any); ok {
+		for k, v := range p {
+			if s, ok := v.(string); ok {
+				params[k] = s
+			}
+		}
+	}
+	locale := c.Negotiate(accept)
+	msg, ok := c.Message(locale, code, params)
+	if !ok {
+		return resp
+	}
+	body["message"] = msg
+	resp.Body = encodeJSON(body)
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	resp.Headers["Content-Language"] = locale
+	resp.Headers["Vary"] = "Accept-Language"
+	return resp
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	env "github.com/caarlos0/env/v11"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/migrate"
+)
+
+// startupMigrationTimeout bounds MIGRATE_ON_START so it fits Lambda's 10 s init phase.
+// Migrations that take longer, such as creating a table, carry on at the next cold
+// start or can be run with the migrate action or cmd/migrate.
+const startupMigrationTimeout = 8 * time.Second
+
+// runMigrations migrates the DynamoDB tables the configuration names; see package
+// migrate. It stops at the first table that fails.
+func runMigrations(ctx context.Context, dryRun bool) ([]migrate.Result, error) {
+	environ, err := configEnviron()
+	if err != nil {
+		return nil, err
+	}
+	vars := env.ToMap(environ)
+	targets := migrate.Targets(func(k string) string { return vars[k] })
+	results := []migrate.Result{}
+	if len(targets) == 0 {
+		return results, nil
+	}
+	client, err := awsapi.NewFromEnv()
+	if err != nil {
+		return results, err
+	}
+	db := migrate.NewDB(client)
+	for _, t := range targets {
+		res, err := migrate.Run(ctx, db, t.Kind, t.Table, dryRun)
+		results = append(results, res)
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// migrateAction runs the table migrations, or with params.dryRun only lists them.
+func migrateAction(ctx context.Context, params map[string]any) events.LambdaFunctionURLResponse {
+	dryRun, _ := params["dryRun"].(bool)
+	results, err := runMigrations(ctx, dryRun)
+	if err != nil {
+		return jsonResp(http.StatusServiceUnavailable, map[string]any{"error": err.Error(), "results": results})
+	}
+	return jsonResp(http.StatusOK, map[string]any{"dryRun": dryRun, "results": results})
+}
+
+// migrateOnStart runs the table migrations at cold start when MIGRATE_ON_START is set.
+// A failure is logged and does not keep the function from serving.
+func migrateOnStart() {
+	cfgEnv, err := configState.Get()
+	if err != nil || !cfgEnv.MigrateOnStart {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), startupMigrationTimeout)
+	defer cancel()
+	if _, err := runMigrations(ctx, false); err != nil {
+		logWarn("table migrations failed", map[string]string{"error": err.Error()})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/executor"
+	"github.com/debendraoli/leo-lambda/pkg/jsonstream"
+	"github.com/debendraoli/leo-lambda/pkg/mixed"
+	"github.com/debendraoli/leo-lambda/pkg/profile"
+)
+
+// maxFullOutputBytes bounds the untruncated output kept in memory for upload.
+const maxFullOutputBytes = 64 << 20
+
+// responseLimit is Lambda's payload limit for a synchronous response. A Function URL
+// response counts in full: headers, and the body escaped as a JSON string.
+const responseLimit = 6 << 20
+
+// responseHeadroom is kept back from responseLimit for headers, warnings added after the
+// response is fitted, and the job fields a polled result comes wrapped in.
+const responseHeadroom = 512 << 10
+
+// albResponseLimit is the largest response body an ALB target group accepts.
+const albResponseLimit = 1 << 20
+
+// snsResponseLimit is the largest SNS message, which a published result must fit.
+const snsResponseLimit = 256 << 10
+
+// taskOutputLimit is the largest output a Step Functions task may report.
+const taskOutputLimit = 256 << 10
+
+// responseCap is the context key carrying the response limit of a transport whose
+// limit is below responseLimit.
+type responseCap struct{}
+
+// responseLimitFor returns the response limit of the transport serving ctx.
+func responseLimitFor(ctx context.Context) int {
+	if n, ok := ctx.Value(responseCap{}).(int); ok {
+		return n
+	}
+	return responseLimit
+}
+
+// outputCap returns how much output per stream a run keeps in memory. A run whose full
+// output is offloaded to OUTPUT_BUCKET keeps all that is uploaded, so parsing sees the
+// complete output; any other run keeps MAX_OUTPUT_BYTES, or without it as much as could
+// be returned. fitResponse then trims what is returned inline to what fits.
+func (c *EnvConfig) outputCap(offload bool) int {
+	switch {
+	case offload:
+		return max(c.MaxOutputBytes, maxFullOutputBytes)
+	case c.MaxOutputBytes > 0:
+		return c.MaxOutputBytes
+	}
+	return responseLimit
+}
+
+// fitResponse drops the start of r's stdout and stderr, in proportion to their sizes,
+// until r fits a Function URL response of at most limit bytes. It reports whether
+// anything was dropped.
+func fitResponse(r *Response, limit int) bool {
+	headroom := min(responseHeadroom, limit/8)
+	fitted := false
+	for range 8 {
+		size := responseSize(*r)
+		over := size + headroom - limit
+		out := len(r.Stdout) + len(r.Stderr)
+		if over <= 0 || out == 0 {
+			return fitted
+		}
+		bare := *r
+		bare.Stdout, bare.Stderr = "", ""
+		// Escaping makes an output byte cost more than one byte of response; sizing the
+		// cut by the average cost converges in a round or two.
+		perByte := float64(size-responseSize(bare)) / float64(out)
+		n := int(math.Ceil(float64(over)/max(perByte, 1))) + 1
+		nOut := n * len(r.Stdout) / out
+		r.Stdout = dropHead(r.Stdout, nOut)
+		r.Stderr = dropHead(r.Stderr, n-nOut)
+		r.Truncated, fitted = true, true
+	}
+	// Output that still does not fit after that is pathological; return none of it.
+	if responseSize(*r)+headroom > limit {
+		r.Stdout, r.Stderr = "", ""
+	}
+	return fitted
+}
+
+// responseSize returns the size of r in a Function URL response, where the JSON body is
+// escaped once more as a string.
+func responseSize(r Response) int {
+	var c jsonstream.Counter
+	_ = jsonstream.String(&c, encodeJSON(r))
+	return c.N
+}
+
+// dropHead drops the first n bytes of s, and the rest of a character cut in half.
+func dropHead(s string, n int) string {
+	i := min(max(n, 0), len(s))
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return s[i:]
+}
+
+// fullOutput captures a run's complete stdout/stderr for upload to OUTPUT_BUCKET.
+type fullOutput struct {
+	stdout, stderr capBuffer
+}
+
+// capBuffer keeps the first max bytes written and silently drops the rest.
+type capBuffer struct {
+	b         []byte
+	truncated bool
+}
+
+func (c *capBuffer) Write(p []byte) (int, error) {
+	if room := maxFullOutputBytes - len(c.b); room < len(p) {
+		c.b = append(c.b, p[:max(room, 0)]...)
+		c.truncated = true
+		return len(p), nil
+	}
+	c.b = append(c.b, p...)
+	return len(p), nil
+}
+
+// outputPrefix returns the OUTPUT_BUCKET prefix of the invocation in ctx. With
+// OUTPUT_RETENTION_DAYS it starts with retention/<days>d/, for a lifecycle rule to
+// expire.
+func outputPrefix(ctx context.Context, cfgEnv *EnvConfig) string {
+	prefix := clk.Now().UTC().Format("2006/01/02") + "/" + cmp.Or(invocationID(ctx), randomID())
+	if cfgEnv.OutputDays > 0 {
+		prefix = "retention/" + strconv.Itoa(cfgEnv.OutputDays) + "d/" + prefix
+	}
+	return prefix
+}
+
+// upload stores both streams under prefix and records their locations in meta.
+func (o *fullOutput) upload(ctx context.Context, cfgEnv *EnvConfig, prefix string, meta map[string]string) error {
+	for name, buf := range map[string]*capBuffer{"stdout": &o.stdout, "stderr": &o.stderr} {
+		key := prefix + "/" + name + ".txt"
+		if err := cfgEnv.s3.PutObject(ctx, cfgEnv.OutputBucket, key, buf.b, "text/plain; charset=utf-8"); err != nil {
+			return fmt.Errorf("upload %s: %w", name, err)
+		}
+		meta[name+"Object"] = "s3://" + cfgEnv.OutputBucket + "/" + key
+	}
+	return nil
+}
+
+// runCapture holds the copies of a run's output kept past the response: the full output
+// for OUTPUT_BUCKET and the debug bundle. Either may be nil.
+type runCapture struct {
+	full *fullOutput
+	dbg  *debugBundle
+}
+
+// captureRun tees stdout and stderr into the copies the run keeps, offloaded and for
+// debugging as asked, and hooks the debug bundle into cfg. It returns the writers the
+// run should write to.
+func captureRun(cfg *executor.Config, offload, debug bool, stdout, stderr io.Writer) (runCapture, io.Writer, io.Writer) {
+	var c runCapture
+	if offload {
+		c.full = new(fullOutput)
+		stdout, stderr = teeWriter(stdout, &c.full.stdout), teeWriter(stderr, &c.full.stderr)
+	}
+	if debug {
+		c.dbg = newDebugBundle(cfg.BinPath, cfg.Args, cfg.WorkDir)
+		cfg.OnExit = c.dbg.exited
+		stdout, stderr = teeWriter(stdout, &c.dbg.output.stdout), teeWriter(stderr, &c.dbg.output.stderr)
+	}
+	return c, stdout, stderr
+}
+
+// deliver uploads the full output and delivers the debug bundle under one prefix,
+// noting failures in payload, and returns the S3 URIs of the objects written.
+func (c runCapture) deliver(ctx context.Context, cfgEnv *EnvConfig, payload *Response) []string {
+	var prefix string
+	if c.full != nil || c.dbg != nil {
+		prefix = outputPrefix(ctx, cfgEnv)
+	}
+	if c.full != nil {
+		if err := c.full.upload(ctx, cfgEnv, prefix, payload.Meta); err != nil {
+			payload.Meta["outputError"] = err.Error()
+		}
+	}
+	if c.dbg != nil {
+		c.dbg.finish(ctx, cfgEnv, prefix, payload)
+	}
+	var objects []string
+	for _, k := range []string{"stdoutObject", "stderrObject", "debugObject"} {
+		if uri := payload.Meta[k]; uri != "" {
+			objects = append(objects, uri)
+		}
+	}
+	return objects
+}
+
+// minimize applies profile.OutputMinimal: only the stdout tail is kept and stderr is
+// dropped when the run succeeded.
+func minimize(r *Response) {
+	if len(r.Stdout) > profile.MinimalOutputBytes {
+		r.Stdout = dropHead(r.Stdout, len(r.Stdout)-profile.MinimalOutputBytes)
+		r.Truncated = true
+	}
+	if r.ExitCode == 0 {
+		r.Stderr = ""
+	}
+}
+
+// mixedResp re-encodes a run's response as multipart/mixed, for callers that accept
+// it: the JSON without stdout and stderr, then both streams unescaped. Other
+// responses, errors and jobs included, stay JSON.
+func mixedResp(resp events.LambdaFunctionURLResponse) events.LambdaFunctionURLResponse {
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Headers["Content-Type"], "application/json") {
+		return resp
+	}
+	var run struct {
+		ExitCode *int `json:"exitCode"`
+	}
+	if json.Unmarshal([]byte(resp.Body), &run) != nil || run.ExitCode == nil {
+		return resp
+	}
+	contentType, body, err := mixed.Encode([]byte(resp.Body))
+	if err != nil {
+		return resp
+	}
+	resp.Headers["Content-Type"], resp.Body = contentType, string(body)
+	return resp
+}
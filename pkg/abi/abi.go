@@ -0,0 +1,218 @@
+// Package abi describes a deployed Aleo program's interface: its transitions with their
+// inputs and outputs, mappings, records and structs. It is parsed from the Aleo
+// instructions that an endpoint serves for the program, so clients can build forms
+// and requests can be checked without compiling anything.
+package abi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ErrNotFound is returned by Fetch when the endpoint does not know the program.
+var ErrNotFound = errors.New("program not found")
+
+// maxProgramBytes bounds the program source read from an endpoint.
+const maxProgramBytes = 1 << 20
+
+// ABI is a program's interface.
+type ABI struct {
+	Program   string     `json:"program"`
+	Imports   []string   `json:"imports,omitempty"`
+	Structs   []Struct   `json:"structs,omitempty"`
+	Records   []Struct   `json:"records,omitempty"`
+	Mappings  []Mapping  `json:"mappings,omitempty"`
+	Functions []Function `json:"functions"`
+}
+
+// Type is a value type with its visibility: "public", "private" or "constant" for
+// values, "record" for records and "future" for async results. Visibility is empty
+// for struct members.
+type Type struct {
+	Type       string `json:"type"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+// Field is a named member of a struct or record, or a function input named by its
+// register.
+type Field struct {
+	Name string `json:"name"`
+	Type
+}
+
+// Struct is a struct or record definition.
+type Struct struct {
+	Name   string  `json:"name"`
+	Fields []Field `json:"fields"`
+}
+
+// Mapping is an on-chain key/value map.
+type Mapping struct {
+	Name  string `json:"name"`
+	Key   Type   `json:"key"`
+	Value Type   `json:"value"`
+}
+
+// Function is a transition callers can execute.
+type Function struct {
+	Name    string  `json:"name"`
+	Inputs  []Field `json:"inputs"`
+	Outputs []Type  `json:"outputs,omitempty"`
+	// Async functions finalize on chain after the transaction is accepted.
+	Async bool `json:"async,omitempty"`
+}
+
+// Function returns the transition called name.
+func (a *ABI) Function(name string) (Function, bool) {
+	i := slices.IndexFunc(a.Functions, func(f Function) bool { return f.Name == name })
+	if i < 0 {
+		return Function{}, false
+	}
+	return a.Functions[i], true
+}
+
+var visibilities = []string{"public", "private", "constant", "record", "future"}
+
+// parseType splits "u64.public" into its type and visibility.
+func parseType(s string) Type {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '.'); i >= 0 && slices.Contains(visibilities, s[i+1:]) {
+		return Type{Type: s[:i], Visibility: s[i+1:]}
+	}
+	return Type{Type: s}
+}
+
+// Parse reads a program in Aleo instructions. Closures, finalize blocks and
+// constructors are not callable and are skipped.
+func Parse(source string) (*ABI, error) {
+	a := &ABI{Functions: []Function{}}
+	// block is the kind of the definition the current indented lines belong to.
+	var block string
+	for n, line := range strings.Split(source, "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		stmt := strings.TrimSuffix(line, ";")
+		words := strings.Fields(stmt)
+		if strings.HasSuffix(line, ":") {
+			kind, name, _ := strings.Cut(strings.TrimSuffix(line, ":"), " ")
+			name = strings.TrimSpace(name)
+			block = kind
+			switch kind {
+			case "struct":
+				a.Structs = append(a.Structs, Struct{Name: name, Fields: []Field{}})
+			case "record":
+				a.Records = append(a.Records, Struct{Name: name, Fields: []Field{}})
+			case "mapping":
+				a.Mappings = append(a.Mappings, Mapping{Name: name})
+			case "function":
+				a.Functions = append(a.Functions, Function{Name: name, Inputs: []Field{}})
+			case "closure", "finalize", "constructor":
+			default:
+				return nil, fmt.Errorf("line %d: unknown definition %q", n+1, kind)
+			}
+			continue
+		}
+		switch {
+		case words[0] == "program" && len(words) == 2:
+			a.Program = words[1]
+			continue
+		case words[0] == "import" && len(words) == 2:
+			a.Imports = append(a.Imports, words[1])
+			continue
+		}
+		// Members read "<head> as <type>"; array types contain spaces.
+		before, typ, hasType := strings.Cut(stmt, " as ")
+		head := strings.Fields(before)
+		switch block {
+		case "struct", "record":
+			if !hasType || len(head) != 1 {
+				return nil, fmt.Errorf("line %d: invalid %s member %q", n+1, block, line)
+			}
+			list := &a.Structs
+			if block == "record" {
+				list = &a.Records
+			}
+			s := &(*list)[len(*list)-1]
+			s.Fields = append(s.Fields, Field{Name: head[0], Type: parseType(typ)})
+		case "mapping":
+			// Older programs name the key and value: "key left as u8.public".
+			if !hasType {
+				return nil, fmt.Errorf("line %d: invalid mapping member %q", n+1, line)
+			}
+			m := &a.Mappings[len(a.Mappings)-1]
+			switch head[0] {
+			case "key":
+				m.Key = parseType(typ)
+			case "value":
+				m.Value = parseType(typ)
+			}
+		case "function":
+			f := &a.Functions[len(a.Functions)-1]
+			switch head[0] {
+			case "input", "output":
+				if !hasType || len(head) != 2 {
+					return nil, fmt.Errorf("line %d: invalid %s %q", n+1, head[0], line)
+				}
+				t := parseType(typ)
+				if head[0] == "input" {
+					f.Inputs = append(f.Inputs, Field{Name: head[1], Type: t})
+				} else {
+					f.Outputs = append(f.Outputs, t)
+					f.Async = f.Async || t.Visibility == "future"
+				}
+			case "async":
+				f.Async = true
+			}
+		}
+	}
+	if a.Program == "" {
+		return nil, errors.New("missing program declaration")
+	}
+	return a, nil
+}
+
+// Fetch returns the source of program as served by endpoint's
+// /{network}/program/{program}.
+func Fetch(ctx context.Context, hc *http.Client, endpoint, network, program string) (string, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	u := strings.TrimRight(endpoint, "/") + "/" + url.PathEscape(network) + "/program/" + url.PathEscape(program)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s on %s", ErrNotFound, program, network)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxProgramBytes))
+	if err != nil {
+		return "", err
+	}
+	// Endpoints return the source as a JSON string.
+	var source string
+	if err := json.Unmarshal(b, &source); err != nil {
+		return "", fmt.Errorf("%s: decode program: %w", u, err)
+	}
+	return source, nil
+}
@@ -0,0 +1,163 @@
+package abi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const tokenSource = `import credits.aleo;
+program token.aleo;
+
+struct Meta:
+    name as field;
+    tags as [u8; 4u32];
+
+record token:
+    owner as address.private;
+    amount as u64.private;
+
+mapping account:
+    key as address.public;
+    value as u64.public;
+
+mapping legacy:
+    key left as field.public;
+    value right as boolean.public;
+
+closure double:
+    input r0 as u64;
+    add r0 r0 into r1;
+    output r1 as u64;
+
+// Mints into a public balance.
+function mint_public:
+    input r0 as address.public;
+    input r1 as u64.public;
+    async mint_public r0 r1 into r2;
+    output r2 as token.aleo/mint_public.future;
+
+finalize mint_public:
+    input r0 as address.public;
+    input r1 as u64.public;
+    get.or_use account[r0] 0u64 into r2;
+
+function transfer_private:
+    input r0 as token.record;
+    input r1 as address.private;
+    input r2 as [u8; 4u32].private;
+    output r3 as token.record;
+`
+
+func TestParse(t *testing.T) {
+	a, err := Parse(tokenSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Program != "token.aleo" || !reflect.DeepEqual(a.Imports, []string{"credits.aleo"}) {
+		t.Fatalf("unexpected header %q %q", a.Program, a.Imports)
+	}
+	if len(a.Functions) != 2 {
+		t.Fatalf("closures and finalize blocks must be skipped, got %+v", a.Functions)
+	}
+	mint, ok := a.Function("mint_public")
+	want := Function{
+		Name: "mint_public",
+		Inputs: []Field{
+			{Name: "r0", Type: Type{Type: "address", Visibility: "public"}},
+			{Name: "r1", Type: Type{Type: "u64", Visibility: "public"}},
+		},
+		Outputs: []Type{{Type: "token.aleo/mint_public", Visibility: "future"}},
+		Async:   true,
+	}
+	if !ok || !reflect.DeepEqual(mint, want) {
+		t.Fatalf("unexpected mint_public %+v", mint)
+	}
+	transfer, _ := a.Function("transfer_private")
+	if transfer.Async || transfer.Inputs[0].Type != (Type{Type: "token", Visibility: "record"}) || transfer.Inputs[2].Type != (Type{Type: "[u8; 4u32]", Visibility: "private"}) {
+		t.Fatalf("unexpected transfer_private %+v", transfer)
+	}
+	if len(a.Mappings) != 2 || a.Mappings[1].Key != (Type{Type: "field", Visibility: "public"}) || a.Mappings[1].Value.Type != "boolean" {
+		t.Fatalf("unexpected mappings %+v", a.Mappings)
+	}
+	if a.Structs[0].Fields[1].Type.Type != "[u8; 4u32]" || a.Records[0].Fields[1] != (Field{Name: "amount", Type: Type{Type: "u64", Visibility: "private"}}) {
+		t.Fatalf("unexpected structs %+v records %+v", a.Structs, a.Records)
+	}
+	if _, ok := a.Function("double"); ok {
+		t.Fatal("closures are not callable")
+	}
+}
+
+func TestParseRejectsGarbage(t *testing.T) {
+	for _, src := range []string{"", "function f:\n  input r0 as u8.public;", "program p.aleo;\nwidget w:"} {
+		if _, err := Parse(src); err == nil {
+			t.Fatalf("%q: expected an error", src)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/testnet/program/token.aleo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`"program token.aleo;\n"`))
+	}))
+	defer srv.Close()
+	src, err := Fetch(context.Background(), nil, srv.URL+"/v1/", "testnet", "token.aleo")
+	if err != nil || src != "program token.aleo;\n" {
+		t.Fatalf("got %q, %v", src, err)
+	}
+	if _, err := Fetch(context.Background(), nil, srv.URL+"/v1", "testnet", "missing.aleo"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	a, _ := Parse(tokenSource)
+	mint, _ := a.Function("mint_public")
+	addr := "aleo1" + strings.Repeat("q", 58)
+	if err := mint.Validate([]string{addr, "1_000u64"}); err != nil {
+		t.Fatalf("valid inputs rejected: %v", err)
+	}
+	for _, tc := range []struct {
+		inputs []string
+		fields []string
+	}{
+		{[]string{addr}, []string{"inputs"}},
+		{[]string{"bob", "5u32"}, []string{"inputs[0]", "inputs[1]"}},
+		{[]string{addr, "18446744073709551616u64"}, []string{"inputs[1]"}},
+		{[]string{addr, "-1u64"}, []string{"inputs[1]"}},
+		{[]string{addr, "5u64.private"}, []string{"inputs[1]"}},
+	} {
+		err := mint.Validate(tc.inputs)
+		var got []string
+		if err != nil {
+			for _, fe := range err.Errors {
+				got = append(got, fe.Field)
+			}
+		}
+		if !reflect.DeepEqual(got, tc.fields) {
+			t.Fatalf("%q: got errors %v, want fields %v", tc.inputs, err, tc.fields)
+		}
+	}
+
+	transfer, _ := a.Function("transfer_private")
+	if err := transfer.Validate([]string{"{owner: " + addr + ".private, amount: 5u64.private}", addr, "[1u8, 2u8, 3u8, 4u8]"}); err != nil {
+		t.Fatalf("valid record rejected: %v", err)
+	}
+	if err := transfer.Validate([]string{"5u64", addr, "1u8"}); err == nil || len(err.Errors) != 2 {
+		t.Fatalf("expected a record and an array error, got %v", err)
+	}
+	if msg := checkInteger("i8", "-128i8") + checkInteger("i8", "127i8"); msg != "" {
+		t.Fatalf("i8 bounds rejected: %s", msg)
+	}
+	if checkInteger("i8", "128i8") == "" || checkInteger("i8", "-129i8") == "" {
+		t.Fatal("i8 overflow accepted")
+	}
+}
@@ -0,0 +1,120 @@
+package abi
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/debendraoli/leo-lambda/pkg/schema"
+)
+
+var (
+	integerLiteral = regexp.MustCompile(`^(-?[0-9][0-9_]*)([ui](?:8|16|32|64|128))$`)
+	integerType    = regexp.MustCompile(`^[ui](?:8|16|32|64|128)$`)
+	bech32Body     = `[02-9ac-hj-np-z]`
+	addressLiteral = regexp.MustCompile(`^aleo1` + bech32Body + `{58}$`)
+	signatureLit   = regexp.MustCompile(`^sign1` + bech32Body + `+$`)
+	recordCipher   = regexp.MustCompile(`^record1` + bech32Body + `+$`)
+	fieldLiteral   = regexp.MustCompile(`^-?[0-9][0-9_]*(field|scalar|group)$`)
+)
+
+// Validate checks inputs, as passed to leo execute, against f's signature: the number
+// of inputs, each literal's type and range, and that records are passed where records
+// are expected. Struct and array inputs are only checked for their shape. It returns
+// nil when the inputs fit, or one error per offending input.
+func (f Function) Validate(inputs []string) *schema.ValidationError {
+	var errs []schema.FieldError
+	if len(inputs) != len(f.Inputs) {
+		errs = append(errs, schema.FieldError{Field: "inputs", Message: fmt.Sprintf("%s takes %d inputs, got %d", f.Name, len(f.Inputs), len(inputs))})
+	}
+	for i, in := range f.Inputs[:min(len(inputs), len(f.Inputs))] {
+		if msg := checkInput(in.Type, inputs[i]); msg != "" {
+			errs = append(errs, schema.FieldError{Field: fmt.Sprintf("inputs[%d]", i), Message: fmt.Sprintf("%s (%s): %s", in.Name, describe(in.Type), msg)})
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &schema.ValidationError{Errors: errs}
+}
+
+func describe(t Type) string {
+	if t.Visibility == "" {
+		return t.Type
+	}
+	return t.Type + "." + t.Visibility
+}
+
+// checkInput returns why v does not fit t, or "" when it does.
+func checkInput(t Type, v string) string {
+	if t.Visibility == "record" {
+		if strings.HasPrefix(v, "{") || recordCipher.MatchString(v) {
+			return ""
+		}
+		return "want a record"
+	}
+	// A literal may carry its own visibility, which must agree with the signature.
+	if i := strings.LastIndexByte(v, '.'); i >= 0 && !strings.HasPrefix(v, "{") && !strings.HasPrefix(v, "[") {
+		if vis := v[i+1:]; vis == "public" || vis == "private" || vis == "constant" {
+			if t.Visibility != "" && vis != t.Visibility {
+				return fmt.Sprintf("is %s, got a %s value", t.Visibility, vis)
+			}
+			v = v[:i]
+		}
+	}
+	switch typ := t.Type; {
+	case integerType.MatchString(typ):
+		return checkInteger(typ, v)
+	case typ == "field" || typ == "scalar" || typ == "group":
+		if m := fieldLiteral.FindStringSubmatch(v); m == nil || m[1] != typ {
+			return fmt.Sprintf("want a %s literal such as 1%s, got %q", typ, typ, v)
+		}
+	case typ == "boolean":
+		if v != "true" && v != "false" {
+			return fmt.Sprintf("want true or false, got %q", v)
+		}
+	case typ == "address":
+		if !addressLiteral.MatchString(v) {
+			return fmt.Sprintf("want an aleo1... address, got %q", v)
+		}
+	case typ == "signature":
+		if !signatureLit.MatchString(v) {
+			return fmt.Sprintf("want a sign1... signature, got %q", v)
+		}
+	case strings.HasPrefix(typ, "["):
+		if !strings.HasPrefix(v, "[") {
+			return "want an array"
+		}
+	default:
+		// Struct types are named by the program.
+		if !strings.HasPrefix(v, "{") {
+			return "want a struct"
+		}
+	}
+	return ""
+}
+
+// checkInteger checks an integer literal's suffix and range.
+func checkInteger(typ, v string) string {
+	m := integerLiteral.FindStringSubmatch(v)
+	if m == nil || m[2] != typ {
+		return fmt.Sprintf("want a %s literal such as 1%s, got %q", typ, typ, v)
+	}
+	n, ok := new(big.Int).SetString(strings.ReplaceAll(m[1], "_", ""), 10)
+	if !ok {
+		return fmt.Sprintf("invalid number %q", v)
+	}
+	var bits uint
+	_, _ = fmt.Sscanf(typ[1:], "%d", &bits)
+	lo, hi := new(big.Int), new(big.Int).Lsh(big.NewInt(1), bits)
+	if typ[0] == 'i' {
+		hi.Rsh(hi, 1)
+		lo.Neg(hi)
+	}
+	hi.Sub(hi, big.NewInt(1))
+	if n.Cmp(lo) < 0 || n.Cmp(hi) > 0 {
+		return fmt.Sprintf("%s is out of range for %s", m[1], typ)
+	}
+	return ""
+}
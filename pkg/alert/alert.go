@@ -0,0 +1,211 @@
+// Package alert detects repeated failures and pages someone about them through SNS or
+// the PagerDuty Events API.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// Alert kinds.
+const (
+	KindFailureStreak = "failure_streak"
+	KindCircuitOpen   = "circuit_open"
+)
+
+// maxSamples bounds the error samples kept per streak, and sampleBytes each sample.
+const (
+	maxSamples  = 5
+	sampleBytes = 500
+)
+
+// Alert describes a condition worth paging for.
+type Alert struct {
+	Kind    string    `json:"kind"`
+	Key     string    `json:"key"`
+	Count   int       `json:"count"`
+	Summary string    `json:"summary"`
+	Samples []string  `json:"samples,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Sample trims stderr to the tail worth including in an alert.
+func Sample(stderr string) string {
+	s := strings.TrimSpace(stderr)
+	if len(s) > sampleBytes {
+		s = "…" + s[len(s)-sampleBytes:]
+	}
+	return s
+}
+
+type streak struct {
+	count   int
+	samples []string
+	alerted bool
+}
+
+// Detector counts consecutive failures per key (e.g. per contract).
+type Detector struct {
+	mu        sync.Mutex
+	threshold int
+	streaks   map[string]*streak
+}
+
+// NewDetector returns a detector that fires after threshold consecutive failures.
+// A threshold <= 0 disables it.
+func NewDetector(threshold int) *Detector {
+	return &Detector{threshold: threshold, streaks: map[string]*streak{}}
+}
+
+// SetThreshold changes the threshold, keeping current streaks.
+func (d *Detector) SetThreshold(n int) {
+	d.mu.Lock()
+	d.threshold = n
+	d.mu.Unlock()
+}
+
+// Record registers an outcome for key. It returns an alert exactly once per streak,
+// when the number of consecutive failures reaches the threshold; a success ends the
+// streak.
+func (d *Detector) Record(key string, failed bool, sample string) (Alert, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.threshold <= 0 {
+		return Alert{}, false
+	}
+	if !failed {
+		delete(d.streaks, key)
+		return Alert{}, false
+	}
+	s, ok := d.streaks[key]
+	if !ok {
+		s = &streak{}
+		d.streaks[key] = s
+	}
+	s.count++
+	if sample != "" {
+		s.samples = append(s.samples, sample)
+		if len(s.samples) > maxSamples {
+			s.samples = s.samples[len(s.samples)-maxSamples:]
+		}
+	}
+	if s.alerted || s.count < d.threshold {
+		return Alert{}, false
+	}
+	s.alerted = true
+	return Alert{
+		Kind:    KindFailureStreak,
+		Key:     key,
+		Count:   s.count,
+		Summary: fmt.Sprintf("%s failed %d times in a row", key, s.count),
+		Samples: append([]string(nil), s.samples...),
+		At:      time.Now().UTC(),
+	}, true
+}
+
+// Reset forgets all streaks.
+func (d *Detector) Reset() {
+	d.mu.Lock()
+	d.streaks = map[string]*streak{}
+	d.mu.Unlock()
+}
+
+// Sink delivers alerts.
+type Sink interface {
+	Send(ctx context.Context, a Alert) error
+}
+
+// Send delivers a to every sink and joins their errors.
+func Send(ctx context.Context, sinks []Sink, a Alert) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var errs []error
+	for _, s := range sinks {
+		errs = append(errs, s.Send(ctx, a))
+	}
+	return errors.Join(errs...)
+}
+
+// SNS publishes alerts as JSON messages to a topic.
+type SNS struct {
+	Client   *awsapi.Client
+	TopicARN string
+}
+
+// Send implements Sink.
+func (s *SNS) Send(ctx context.Context, a Alert) error {
+	msg, _ := json.Marshal(a)
+	subject := "leo-lambda: " + a.Summary
+	if len(subject) > 100 {
+		subject = subject[:100]
+	}
+	_, err := s.Client.Query(ctx, "sns", "Publish", "2010-03-31", url.Values{
+		"TopicArn": {s.TopicARN},
+		"Subject":  {subject},
+		"Message":  {string(msg)},
+	})
+	if err != nil {
+		return fmt.Errorf("sns publish: %w", err)
+	}
+	return nil
+}
+
+// DefaultPagerDutyURL is the PagerDuty Events API v2 endpoint.
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty triggers incidents via the Events API v2. Alerts for the same kind and key
+// share a dedup key, so repeats update one incident.
+type PagerDuty struct {
+	RoutingKey string
+	URL        string
+	Source     string
+	HTTPClient *http.Client
+}
+
+// Send implements Sink.
+func (p *PagerDuty) Send(ctx context.Context, a Alert) error {
+	body, _ := json.Marshal(map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    a.Kind + ":" + a.Key,
+		"payload": map[string]any{
+			"summary":        a.Summary,
+			"source":         p.Source,
+			"severity":       "error",
+			"timestamp":      a.At.Format(time.RFC3339),
+			"custom_details": map[string]any{"kind": a.Kind, "count": a.Count, "samples": a.Samples},
+		},
+	})
+	u := p.URL
+	if u == "" {
+		u = DefaultPagerDutyURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	hc := p.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("pagerduty: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("pagerduty responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
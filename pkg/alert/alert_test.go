@@ -0,0 +1,78 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+func TestDetectorFiresOncePerStreak(t *testing.T) {
+	d := NewDetector(3)
+	for i := range 2 {
+		if _, fired := d.Record("token.aleo", true, "err"); fired {
+			t.Fatalf("fired early at failure %d", i+1)
+		}
+	}
+	a, fired := d.Record("token.aleo", true, "last error")
+	if !fired || a.Kind != KindFailureStreak || a.Count != 3 || a.Samples[2] != "last error" {
+		t.Fatalf("expected alert on third failure, got %+v (fired=%v)", a, fired)
+	}
+	if _, fired := d.Record("token.aleo", true, "err"); fired {
+		t.Fatalf("must not re-fire within the same streak")
+	}
+	d.Record("token.aleo", false, "")
+	for range 2 {
+		d.Record("token.aleo", true, "")
+	}
+	if _, fired := d.Record("token.aleo", true, ""); !fired {
+		t.Fatalf("a new streak after success should fire again")
+	}
+}
+
+func TestPagerDutySend(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	pd := &PagerDuty{RoutingKey: "rk", URL: srv.URL, Source: "leo-lambda"}
+	err := Send(context.Background(), []Sink{pd}, Alert{Kind: KindCircuitOpen, Key: "https://rpc", Summary: "circuit open"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if got["routing_key"] != "rk" || got["dedup_key"] != "circuit_open:https://rpc" {
+		t.Fatalf("unexpected event %v", got)
+	}
+}
+
+func TestSNSSend(t *testing.T) {
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.Form
+		_, _ = w.Write([]byte(`<PublishResponse><PublishResult><MessageId>m1</MessageId></PublishResult></PublishResponse>`))
+	}))
+	defer srv.Close()
+
+	c := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	sns := &SNS{Client: c, TopicARN: "arn:aws:sns:us-east-1:1:alerts"}
+	a := Alert{Kind: KindFailureStreak, Key: "token.aleo", Summary: strings.Repeat("x", 200), Samples: []string{"boom"}}
+	if err := sns.Send(context.Background(), a); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if form.Get("TopicArn") != sns.TopicARN || len(form.Get("Subject")) != 100 {
+		t.Fatalf("unexpected publish form %v", form)
+	}
+	var got Alert
+	if err := json.Unmarshal([]byte(form.Get("Message")), &got); err != nil || got.Samples[0] != "boom" {
+		t.Fatalf("unexpected message %q (%v)", form.Get("Message"), err)
+	}
+}
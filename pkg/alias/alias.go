@@ -0,0 +1,88 @@
+// Package alias resolves contract group aliases: named sets of programs, defined in
+// GROUP_<name> environment variables, that contract lists refer to as @<name>. When a
+// suite of programs moves to a new version, only its group needs editing, not every
+// allowlist and policy that names it.
+package alias
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Prefix starts the environment variables defining groups.
+const Prefix = "GROUP_"
+
+// Ref starts a list entry that refers to a group.
+const Ref = "@"
+
+// reserved are variables starting with Prefix that do not define groups.
+var reserved = []string{"GROUP_CONTRACTS"}
+
+// Groups maps lowercase group names to their contracts.
+type Groups map[string][]string
+
+// FromEnv reads the groups defined in environ, given as by os.Environ, e.g.
+// GROUP_token=token_v5.aleo,token_v6.aleo. Group names are case-insensitive; groups
+// cannot include other groups.
+func FromEnv(environ []string) (Groups, error) {
+	g := Groups{}
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		name, ok := strings.CutPrefix(key, Prefix)
+		if !ok || slices.Contains(reserved, key) {
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid %s: missing group name", key)
+		}
+		var contracts []string
+		for c := range strings.SplitSeq(value, ",") {
+			c = strings.ToLower(strings.TrimSpace(c))
+			switch {
+			case c == "":
+				continue
+			case strings.HasPrefix(c, Ref):
+				return nil, fmt.Errorf("invalid %s: groups cannot include other groups (%s)", key, c)
+			}
+			if !slices.Contains(contracts, c) {
+				contracts = append(contracts, c)
+			}
+		}
+		if len(contracts) == 0 {
+			return nil, fmt.Errorf("invalid %s: no contracts", key)
+		}
+		g[strings.ToLower(name)] = contracts
+	}
+	return g, nil
+}
+
+// Expand returns list with each @name entry replaced by the contracts of group name,
+// in order and without duplicates. A reference to an undefined group is an error, so
+// a typo cannot silently empty an allowlist.
+func (g Groups) Expand(list []string) ([]string, error) {
+	if !slices.ContainsFunc(list, isRef) {
+		return list, nil
+	}
+	out := make([]string, 0, len(list))
+	for _, entry := range list {
+		contracts := []string{entry}
+		if isRef(entry) {
+			name := strings.ToLower(strings.TrimSpace(entry)[len(Ref):])
+			var ok bool
+			if contracts, ok = g[name]; !ok {
+				return nil, fmt.Errorf("unknown contract group %s%s (define %s%s)", Ref, name, Prefix, name)
+			}
+		}
+		for _, c := range contracts {
+			if !slices.Contains(out, c) {
+				out = append(out, c)
+			}
+		}
+	}
+	return out, nil
+}
+
+func isRef(entry string) bool {
+	return strings.HasPrefix(strings.TrimSpace(entry), Ref)
+}
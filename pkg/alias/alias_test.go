@@ -0,0 +1,39 @@
+package alias
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFromEnv(t *testing.T) {
+	g, err := FromEnv([]string{
+		"GROUP_token=token_v5.aleo, Token_v6.aleo,token_v5.aleo",
+		"GROUP_CONTRACTS={\"treasury\": [\"@token\"]}",
+		"PATH=/usr/bin",
+	})
+	if err != nil {
+		t.Fatalf("from env: %v", err)
+	}
+	if len(g) != 1 || !slices.Equal(g["token"], []string{"token_v5.aleo", "token_v6.aleo"}) {
+		t.Fatalf("unexpected groups: %v", g)
+	}
+	for _, bad := range []string{"GROUP_=a.aleo", "GROUP_empty= , ", "GROUP_nested=@token"} {
+		if _, err := FromEnv([]string{bad}); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	g := Groups{"token": {"token_v5.aleo", "token_v6.aleo"}}
+	got, err := g.Expand([]string{"credits.aleo", "@Token", "token_v6.aleo"})
+	if err != nil || !slices.Equal(got, []string{"credits.aleo", "token_v5.aleo", "token_v6.aleo"}) {
+		t.Fatalf("unexpected expansion %v: %v", got, err)
+	}
+	if got, _ := g.Expand([]string{"credits.aleo"}); !slices.Equal(got, []string{"credits.aleo"}) {
+		t.Fatalf("lists without references should be unchanged, got %v", got)
+	}
+	if _, err := g.Expand([]string{"@nft"}); err == nil {
+		t.Fatalf("expected an error for an undefined group")
+	}
+}
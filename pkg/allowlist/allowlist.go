@@ -0,0 +1,92 @@
+// Package allowlist persists runtime additions to the contract allowlist so programs can
+// be onboarded through an admin action instead of a redeploy.
+package allowlist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// List is the runtime-managed part of the allowlist.
+type List struct {
+	Contracts []string `json:"contracts"`
+}
+
+// Add inserts contract, reporting whether it was new.
+func (l *List) Add(contract string) bool {
+	if slices.Contains(l.Contracts, contract) {
+		return false
+	}
+	l.Contracts = append(l.Contracts, contract)
+	slices.Sort(l.Contracts)
+	return true
+}
+
+// Remove deletes contract, reporting whether it was present.
+func (l *List) Remove(contract string) bool {
+	n := len(l.Contracts)
+	l.Contracts = slices.DeleteFunc(l.Contracts, func(c string) bool { return c == contract })
+	return len(l.Contracts) != n
+}
+
+// Store loads and saves a List.
+type Store interface {
+	Load(ctx context.Context) (List, error)
+	Save(ctx context.Context, l List) error
+	Name() string
+}
+
+// SSMStore keeps the list as a JSON String parameter in SSM Parameter Store.
+type SSMStore struct {
+	client *awsapi.Client
+	name   string
+}
+
+// NewSSMStore returns a store backed by the SSM parameter name.
+func NewSSMStore(client *awsapi.Client, name string) (*SSMStore, error) {
+	if name == "" {
+		return nil, errors.New("allowlist parameter name is required")
+	}
+	return &SSMStore{client: client, name: name}, nil
+}
+
+// Name returns the parameter name.
+func (s *SSMStore) Name() string { return s.name }
+
+// Load reads the parameter; a missing parameter is an empty list.
+func (s *SSMStore) Load(ctx context.Context) (List, error) {
+	var out struct {
+		Parameter struct{ Value string }
+	}
+	err := s.client.JSON(ctx, "ssm", "AmazonSSM.GetParameter", map[string]any{"Name": s.name}, &out)
+	var apiErr *awsapi.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == "ParameterNotFound" {
+		return List{}, nil
+	}
+	if err != nil {
+		return List{}, fmt.Errorf("load allowlist: %w", err)
+	}
+	var l List
+	if err := json.Unmarshal([]byte(out.Parameter.Value), &l); err != nil {
+		return List{}, fmt.Errorf("load allowlist: parameter %s: %w", s.name, err)
+	}
+	return l, nil
+}
+
+// Save overwrites the parameter with l.
+func (s *SSMStore) Save(ctx context.Context, l List) error {
+	if l.Contracts == nil {
+		l.Contracts = []string{}
+	}
+	b, _ := json.Marshal(l)
+	in := map[string]any{"Name": s.name, "Value": string(b), "Type": "String", "Overwrite": true}
+	if err := s.client.JSON(ctx, "ssm", "AmazonSSM.PutParameter", in, nil); err != nil {
+		return fmt.Errorf("save allowlist: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package allowlist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// fakeSSM serves GetParameter/PutParameter from memory.
+func fakeSSM(t *testing.T) *httptest.Server {
+	params := map[string]string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ Name, Value string }
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSSM.GetParameter":
+			v, ok := params[in.Name]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"ParameterNotFound","message":"not found"}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"Parameter": map[string]string{"Name": in.Name, "Value": v}})
+		case "AmazonSSM.PutParameter":
+			params[in.Name] = in.Value
+			_, _ = w.Write([]byte(`{"Version":1}`))
+		default:
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+	}))
+}
+
+func TestSSMStoreRoundTrip(t *testing.T) {
+	srv := fakeSSM(t)
+	defer srv.Close()
+	client := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	s, err := NewSSMStore(client, "/leo/allowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	l, err := s.Load(ctx)
+	if err != nil || len(l.Contracts) != 0 {
+		t.Fatalf("missing parameter should load as empty, got %+v (%v)", l, err)
+	}
+	if !l.Add("token.aleo") || !l.Add("credits.aleo") || l.Add("token.aleo") {
+		t.Fatalf("unexpected Add results")
+	}
+	if err := s.Save(ctx, l); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	l, err = s.Load(ctx)
+	if err != nil || !slices.Equal(l.Contracts, []string{"credits.aleo", "token.aleo"}) {
+		t.Fatalf("unexpected list %+v (%v)", l, err)
+	}
+	if !l.Remove("token.aleo") || l.Remove("token.aleo") {
+		t.Fatalf("unexpected Remove results")
+	}
+}
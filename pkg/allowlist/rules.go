@@ -0,0 +1,78 @@
+package allowlist
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Rule is one ALLOWED_CONTRACTS entry: a contract name, a pattern in which * stands
+// for any run of letters, digits and underscores (vlink_*.aleo), or an anchored
+// regular expression between slashes (/^test_.+\.aleo$/).
+type Rule struct {
+	// Source is the entry as configured, recorded as the provenance of a match.
+	Source string
+
+	exact string
+	re    *regexp.Regexp
+}
+
+// Rules is an allowlist. An empty Rules allows nothing by itself; callers treat an
+// empty allowlist as allowing every contract.
+type Rules []Rule
+
+// ParseRules compiles entries, so invalid patterns fail at config load rather than on
+// the first request. Regular expressions must be anchored with ^ and $: an unanchored
+// one would allow any contract that merely contains a match.
+func ParseRules(entries []string) (Rules, error) {
+	var rules Rules
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		r := Rule{Source: e}
+		switch {
+		case len(e) > 1 && strings.HasPrefix(e, "/") && strings.HasSuffix(e, "/"):
+			expr := e[1 : len(e)-1]
+			if !strings.HasPrefix(expr, "^") || !strings.HasSuffix(expr, "$") {
+				return nil, fmt.Errorf("contract pattern %s must be anchored with ^ and $", e)
+			}
+			// The text check alone would pass /^a|b$/, whose alternatives are each
+			// anchored at one end only; the group holds the whole expression to both.
+			re, err := regexp.Compile("^(?:" + expr + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("contract pattern %s: %w", e, err)
+			}
+			r.re = re
+		case strings.Contains(e, "*"):
+			parts := strings.Split(strings.ToLower(e), "*")
+			for i, p := range parts {
+				parts[i] = regexp.QuoteMeta(p)
+			}
+			r.re = regexp.MustCompile("^" + strings.Join(parts, "[a-z0-9_]*") + "$")
+		default:
+			r.exact = strings.ToLower(e)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Match reports whether r allows contract.
+func (r Rule) Match(contract string) bool {
+	if r.re != nil {
+		return r.re.MatchString(contract)
+	}
+	return r.exact == contract
+}
+
+// Match returns the first rule allowing contract.
+func (rs Rules) Match(contract string) (Rule, bool) {
+	for _, r := range rs {
+		if r.Match(contract) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
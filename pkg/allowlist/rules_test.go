@@ -0,0 +1,33 @@
+package allowlist
+
+import "testing"
+
+func TestRules(t *testing.T) {
+	rules, err := ParseRules([]string{"Credits.aleo", " vlink_*.aleo", `/^test_.+\.aleo$/`, `/^swap|pool$/`, ""})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for contract, want := range map[string]string{
+		"credits.aleo":                "Credits.aleo",
+		"vlink_token_service_v7.aleo": "vlink_*.aleo",
+		"vlink_.aleo":                 "vlink_*.aleo",
+		"test_swap.aleo":              `/^test_.+\.aleo$/`,
+		"vlink_x.aleo.evil":           "",
+		"vlink_a/b.aleo":              "",
+		"mytest_swap.aleo":            "",
+		"swap":                        `/^swap|pool$/`,
+		"pool":                        `/^swap|pool$/`,
+		"swap_evil.aleo":              "",
+		"evil_pool":                   "",
+	} {
+		r, ok := rules.Match(contract)
+		if ok != (want != "") || r.Source != want {
+			t.Fatalf("%s: expected %q, got %q (%v)", contract, want, r.Source, ok)
+		}
+	}
+	for _, bad := range []string{"/test_.+/", "/^test_(.aleo$/"} {
+		if _, err := ParseRules([]string{bad}); err == nil {
+			t.Fatalf("expected an error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+// Package awsapi is a minimal AWS client (SigV4 signing plus the JSON and REST protocols)
+// covering the handful of service calls this Lambda makes, so the bootstrap binary does not
+// need the full AWS SDK dependency tree.
+package awsapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credentials are static AWS credentials, as injected into the Lambda environment.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Client signs and sends requests to AWS service endpoints.
+type Client struct {
+	Region      string
+	Credentials Credentials
+	HTTPClient  *http.Client
+	// EndpointURL overrides the service endpoint (e.g. LocalStack). Empty means AWS.
+	EndpointURL string
+
+	now func() time.Time
+}
+
+// NewFromEnv builds a client from the standard AWS_* environment variables.
+func NewFromEnv() (*Client, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("AWS_REGION is not set")
+	}
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("AWS credentials are not set")
+	}
+	return &Client{
+		Region:      region,
+		Credentials: creds,
+		HTTPClient:  http.DefaultClient,
+		EndpointURL: os.Getenv("AWS_ENDPOINT_URL"),
+	}, nil
+}
+
+// APIError is an error response returned by an AWS service.
+type APIError struct {
+	Service    string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s (status %d): %s", e.Service, e.Code, e.StatusCode, e.Message)
+}
+
+// jsonVersions lists services speaking awsJson1_0; the rest use awsJson1_1.
+var jsonVersions = map[string]string{
+	"dynamodb": "1.0",
+	"sqs":      "1.0",
+	"states":   "1.0",
+}
+
+// Endpoint returns the base URL for a service in the client's region.
+func (c *Client) Endpoint(service string) string {
+	if c.EndpointURL != "" {
+		return strings.TrimRight(c.EndpointURL, "/")
+	}
+	return fmt.Sprintf("https://%s.%s.amazonaws.com", service, c.Region)
+}
+
+// JSON calls a JSON-protocol operation such as "TrentService.Sign" on service "kms".
+func (c *Client) JSON(ctx context.Context, service, target string, in, out any) error {
+	payload, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("%s: encode request: %w", service, err)
+	}
+	version := jsonVersions[service]
+	if version == "" {
+		version = "1.1"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint(service)+"/", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-"+version)
+	req.Header.Set("X-Amz-Target", target)
+
+	body, err := c.Do(req, service, payload)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s: decode response: %w", service, err)
+	}
+	return nil
+}
+
+// Query calls a Query-protocol operation such as SNS "Publish" and returns the raw XML
+// response body.
+func (c *Client) Query(ctx context.Context, service, action, version string, params url.Values) ([]byte, error) {
+	form := url.Values{}
+	for k, v := range params {
+		form[k] = v
+	}
+	form.Set("Action", action)
+	form.Set("Version", version)
+	payload := []byte(form.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint(service)+"/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	return c.Do(req, service, payload)
+}
+
+// PutObject uploads body to s3://bucket/key using path-style addressing.
+func (c *Client) PutObject(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(bucket, key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	_, err = c.Do(req, "s3", body)
+	return err
+}
+
+// GetObject downloads s3://bucket/key. A missing object is an *APIError with
+// StatusCode 404.
+func (c *Client) GetObject(ctx context.Context, bucket, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req, "s3", nil)
+}
+
+// DeleteObject removes s3://bucket/key; deleting a missing object succeeds.
+func (c *Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.objectURL(bucket, key), nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.Do(req, "s3", nil)
+	return err
+}
+
+func (c *Client) objectURL(bucket, key string) string {
+	return c.Endpoint("s3") + "/" + bucket + "/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// Do signs req (whose body must equal payload) and returns the response body,
+// converting non-2xx responses into *APIError.
+func (c *Client) Do(req *http.Request, service string, payload []byte) ([]byte, error) {
+	c.Sign(req, service, payload)
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", service, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: read response: %w", service, err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, parseAPIError(service, resp, body)
+	}
+	return body, nil
+}
+
+func parseAPIError(service string, resp *http.Response, body []byte) error {
+	apiErr := &APIError{Service: service, StatusCode: resp.StatusCode}
+	var payload struct {
+		Type     string `json:"__type"`
+		Code     string `json:"code"`
+		Message  string `json:"message"`
+		MessageU string `json:"Message"`
+	}
+	// Query-protocol services answer with <ErrorResponse><Error><Code>...</Code>.
+	var xmlPayload struct {
+		Code    string `xml:"Error>Code"`
+		Message string `xml:"Error>Message"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		apiErr.Code = firstNonEmpty(payload.Type, payload.Code)
+		if i := strings.LastIndex(apiErr.Code, "#"); i >= 0 {
+			apiErr.Code = apiErr.Code[i+1:]
+		}
+		apiErr.Message = firstNonEmpty(payload.Message, payload.MessageU)
+	} else if xml.Unmarshal(body, &xmlPayload) == nil {
+		apiErr.Code, apiErr.Message = xmlPayload.Code, xmlPayload.Message
+	}
+	if apiErr.Code == "" {
+		apiErr.Code = firstNonEmpty(resp.Header.Get("X-Amzn-ErrorType"), http.StatusText(resp.StatusCode))
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Sign adds SigV4 headers to req for the given service.
+func (c *Client) Sign(req *http.Request, service string, payload []byte) {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := hashHex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if c.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.Credentials.SessionToken)
+	}
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	signedNames := []string{"host"}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "authorization" || lower == "user-agent" {
+			continue
+		}
+		signedNames = append(signedNames, lower)
+	}
+	sort.Strings(signedNames)
+	var canonHeaders strings.Builder
+	for _, name := range signedNames {
+		val := req.Host
+		if name != "host" {
+			val = strings.Join(req.Header.Values(name), ",")
+		}
+		canonHeaders.WriteString(name + ":" + strings.TrimSpace(val) + "\n")
+	}
+	signedHeaders := strings.Join(signedNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL),
+		canonicalQuery(req.URL),
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.Region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hashHex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.Credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.Credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalPath(u *url.URL) string {
+	p := u.EscapedPath()
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+func canonicalQuery(u *url.URL) string {
+	q := u.Query()
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := q[k]
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hashHex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
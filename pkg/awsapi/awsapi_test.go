@@ -0,0 +1,102 @@
+package awsapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Vector "get-vanilla" from the AWS SigV4 test suite.
+func TestSign_GetVanilla(t *testing.T) {
+	c := &Client{
+		Region:      "us-east-1",
+		Credentials: Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"},
+		now:         func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	c.Sign(req, "service", nil)
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("unexpected authorization header:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestJSON_RoundTripAndErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "TrentService.Sign" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazon#ValidationException", "message": "bad target"})
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/x-amz-json-1.1" || r.Header.Get("Authorization") == "" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"KeyId": "k1"})
+	}))
+	defer srv.Close()
+
+	c := &Client{Region: "us-east-1", Credentials: Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	var out struct{ KeyId string }
+	if err := c.JSON(context.Background(), "kms", "TrentService.Sign", map[string]string{}, &out); err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if out.KeyId != "k1" {
+		t.Fatalf("unexpected output: %+v", out)
+	}
+	err := c.JSON(context.Background(), "kms", "TrentService.Other", map[string]string{}, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "ValidationException" || apiErr.Message != "bad target" {
+		t.Fatalf("expected ValidationException, got %v", err)
+	}
+}
+
+func TestQuery_FormAndXMLErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("Action") != "Publish" || r.Form.Get("Version") != "2010-03-31" {
+			t.Errorf("unexpected form: %v", r.Form)
+		}
+		if r.Form.Get("TopicArn") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>InvalidParameter</Code><Message>TopicArn missing</Message></Error></ErrorResponse>`))
+			return
+		}
+		_, _ = w.Write([]byte(`<PublishResponse><PublishResult><MessageId>m1</MessageId></PublishResult></PublishResponse>`))
+	}))
+	defer srv.Close()
+	c := &Client{Region: "us-east-1", Credentials: Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+
+	body, err := c.Query(context.Background(), "sns", "Publish", "2010-03-31", url.Values{"TopicArn": {"arn:aws:sns:us-east-1:1:t"}})
+	if err != nil || !strings.Contains(string(body), "m1") {
+		t.Fatalf("unexpected result %q (%v)", body, err)
+	}
+	_, err = c.Query(context.Background(), "sns", "Publish", "2010-03-31", nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "InvalidParameter" || apiErr.Message != "TopicArn missing" {
+		t.Fatalf("expected parsed XML error, got %v", err)
+	}
+}
+
+func TestPutObject(t *testing.T) {
+	var gotPath, gotBody, gotHash string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotPath, gotBody, gotHash = r.URL.Path, string(b), r.Header.Get("X-Amz-Content-Sha256")
+	}))
+	defer srv.Close()
+	c := &Client{Region: "us-east-1", Credentials: Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+
+	if err := c.PutObject(context.Background(), "bucket", "runs/a b/stdout.txt", []byte("hello"), "text/plain"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if gotPath != "/bucket/runs/a b/stdout.txt" || gotBody != "hello" || gotHash != hashHex([]byte("hello")) {
+		t.Fatalf("unexpected request %q %q %q", gotPath, gotBody, gotHash)
+	}
+}
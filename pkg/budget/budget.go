@@ -0,0 +1,89 @@
+// Package budget carries what an invocation may still consume (time, output bytes,
+// fee spend) through its context, so each stage can leave room for the ones after it
+// instead of every stage racing the Lambda deadline on its own.
+package budget
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrExhausted is returned when no time is left for a stage.
+var ErrExhausted = errors.New("time budget exhausted")
+
+// Budget is the remaining allowance of one invocation. Zero values mean "no limit".
+type Budget struct {
+	// Deadline is when the invocation as a whole must have returned.
+	Deadline time.Time
+	// Reserve is kept back from Deadline for the stages that follow the current one,
+	// e.g. a receipt transaction and encoding the response.
+	Reserve time.Duration
+	// OutputBytes caps the output a stage may buffer.
+	OutputBytes int
+	// Spend is the fee allowance in microcredits, meaningful when SpendLimited.
+	Spend        uint64
+	SpendLimited bool
+}
+
+type ctxKey struct{}
+
+// With returns ctx carrying b. When b has no deadline, ctx's deadline is used.
+func With(ctx context.Context, b Budget) context.Context {
+	if d, ok := ctx.Deadline(); ok && (b.Deadline.IsZero() || d.Before(b.Deadline)) {
+		b.Deadline = d
+	}
+	return context.WithValue(ctx, ctxKey{}, b)
+}
+
+// From returns the budget carried by ctx.
+func From(ctx context.Context) (Budget, bool) {
+	b, ok := ctx.Value(ctxKey{}).(Budget)
+	return b, ok
+}
+
+// Reserve returns ctx with d more time kept back for later stages. It is a no-op when
+// ctx carries no budget.
+func Reserve(ctx context.Context, d time.Duration) context.Context {
+	b, ok := From(ctx)
+	if !ok {
+		return ctx
+	}
+	b.Reserve += d
+	return context.WithValue(ctx, ctxKey{}, b)
+}
+
+// Remaining returns the time the current stage may use, or -1 when unbounded.
+func (b Budget) Remaining(now time.Time) time.Duration {
+	if b.Deadline.IsZero() {
+		return -1
+	}
+	return b.Deadline.Sub(now) - b.Reserve
+}
+
+// Stage returns a context that expires when the current stage must yield to the
+// reserve. It fails with ErrExhausted when the reserve already covers all remaining
+// time. Without a budget ctx is returned unchanged.
+func Stage(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	b, ok := From(ctx)
+	if !ok || b.Deadline.IsZero() {
+		return ctx, func() {}, nil
+	}
+	if b.Remaining(time.Now()) <= 0 {
+		return ctx, func() {}, ErrExhausted
+	}
+	ctx, cancel := context.WithDeadline(ctx, b.Deadline.Add(-b.Reserve))
+	return ctx, cancel, nil
+}
+
+// OutputLimit returns the smaller positive of limit and the budget's output allowance.
+func OutputLimit(ctx context.Context, limit int) int {
+	b, ok := From(ctx)
+	if !ok || b.OutputBytes <= 0 {
+		return limit
+	}
+	if limit <= 0 {
+		return b.OutputBytes
+	}
+	return min(limit, b.OutputBytes)
+}
@@ -0,0 +1,38 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStageLeavesReserve(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ctx := Reserve(With(parent, Budget{Reserve: 10 * time.Second}), 20*time.Second)
+
+	stage, done, err := Stage(ctx)
+	defer done()
+	if err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	d, _ := stage.Deadline()
+	if left := time.Until(d); left > 31*time.Second || left < 29*time.Second {
+		t.Fatalf("expected ~30s for the stage, got %v", left)
+	}
+
+	if _, _, err := Stage(Reserve(ctx, time.Minute)); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected exhausted budget, got %v", err)
+	}
+}
+
+func TestWithoutBudget(t *testing.T) {
+	ctx := context.Background()
+	if s, _, err := Stage(Reserve(ctx, time.Hour)); err != nil || s != ctx {
+		t.Fatalf("stage without a budget should be a no-op")
+	}
+	if OutputLimit(ctx, 10) != 10 || OutputLimit(With(ctx, Budget{OutputBytes: 5}), 10) != 5 {
+		t.Fatalf("unexpected output limits")
+	}
+}
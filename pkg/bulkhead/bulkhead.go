@@ -0,0 +1,249 @@
+// Package bulkhead partitions a container's capacity between classes of work, such as
+// read and write commands, so a burst of one class queues or is turned away instead of
+// starving the other. Each class has its own concurrency limit and a bounded queue.
+package bulkhead
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned when a class has no room.
+var (
+	ErrFull    = errors.New("bulkhead is full")
+	ErrTimeout = errors.New("timed out waiting for a bulkhead slot")
+)
+
+// Limits bound one class.
+type Limits struct {
+	// Concurrency is how many runs of the class may be in progress at once.
+	Concurrency int
+	// Queue is how many more may wait for a slot; further ones are rejected.
+	Queue int
+	// MaxWait bounds the wait for a slot; zero waits as long as the caller's context.
+	MaxWait time.Duration
+}
+
+// UnmarshalJSON decodes {"concurrency": 2, "queue": 4, "maxWait": "10s"}.
+func (l *Limits) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Concurrency int    `json:"concurrency"`
+		Queue       int    `json:"queue"`
+		MaxWait     string `json:"maxWait"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if raw.Concurrency <= 0 || raw.Queue < 0 {
+		return errors.New("concurrency must be positive and queue not negative")
+	}
+	l.Concurrency, l.Queue, l.MaxWait = raw.Concurrency, raw.Queue, 0
+	if raw.MaxWait != "" {
+		d, err := time.ParseDuration(raw.MaxWait)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid maxWait %q", raw.MaxWait)
+		}
+		l.MaxWait = d
+	}
+	return nil
+}
+
+// Parse decodes the BULKHEADS JSON object, keyed by class, e.g.
+// {"write": {"concurrency": 2, "queue": 4}}. An empty string yields no limits.
+func Parse(raw string) (map[string]Limits, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var out map[string]Limits
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, fmt.Errorf("invalid BULKHEADS: %w", err)
+	}
+	return out, nil
+}
+
+// Stats describe one class.
+type Stats struct {
+	Name        string `json:"name"`
+	Concurrency int    `json:"concurrency"`
+	Queue       int    `json:"queue"`
+	Running     int    `json:"running"`
+	Waiting     int    `json:"waiting"`
+	// Admitted and Rejected count since the container started; a run that timed out
+	// waiting counts as both.
+	Admitted uint64 `json:"admitted"`
+	Rejected uint64 `json:"rejected"`
+}
+
+type class struct {
+	running  int
+	waiting  []*Ticket
+	admitted uint64
+	rejected uint64
+}
+
+// Set holds the classes of one container. The zero value is not usable; call New.
+type Set struct {
+	mu      sync.Mutex
+	limits  map[string]Limits
+	classes map[string]*class
+}
+
+// New returns a Set without limits, which admits everything at once.
+func New() *Set {
+	return &Set{classes: map[string]*class{}}
+}
+
+// SetLimits replaces the limits; classes without one are unlimited. Runs in progress
+// are not affected, and waiting ones start as soon as the new limits allow.
+func (s *Set) SetLimits(l map[string]Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = l
+	for name := range s.classes {
+		s.promote(name)
+	}
+}
+
+// Ticket states.
+const (
+	queued = iota
+	running
+	released
+)
+
+// Ticket is a place in a class, queued or running.
+type Ticket struct {
+	set     *Set
+	name    string
+	maxWait time.Duration
+	ready   chan struct{}
+	state   int
+}
+
+// Admit takes a place in class name: a slot when one is free and nobody is waiting,
+// else a place in its queue. It fails with ErrFull when the queue is full too.
+func (s *Set) Admit(name string) (*Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.classes[name]
+	if c == nil {
+		c = &class{}
+		s.classes[name] = c
+	}
+	l, limited := s.limits[name]
+	t := &Ticket{set: s, name: name, maxWait: l.MaxWait, ready: make(chan struct{})}
+	switch {
+	case !limited || (c.running < l.Concurrency && len(c.waiting) == 0):
+		c.running++
+		t.state = running
+		close(t.ready)
+	case len(c.waiting) < l.Queue:
+		c.waiting = append(c.waiting, t)
+	default:
+		c.rejected++
+		return nil, ErrFull
+	}
+	c.admitted++
+	return t, nil
+}
+
+// Wait blocks until the ticket may run, MaxWait passes (ErrTimeout) or ctx is done. A
+// ticket that did not get to run has given up its place. Waiting again after success
+// returns at once.
+func (t *Ticket) Wait(ctx context.Context) error {
+	var timeout <-chan time.Time
+	if t.maxWait > 0 {
+		timer := time.NewTimer(t.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case <-t.ready:
+		return nil
+	case <-timeout:
+		err = ErrTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s := t.set
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.state == running {
+		return nil
+	}
+	if t.state == queued {
+		c := s.classes[t.name]
+		c.waiting = slices.DeleteFunc(c.waiting, func(w *Ticket) bool { return w == t })
+		c.rejected++
+		t.state = released
+	}
+	return err
+}
+
+// Release frees the ticket's slot, or its place in the queue. It may be called more
+// than once.
+func (t *Ticket) Release() {
+	s := t.set
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.classes[t.name]
+	switch t.state {
+	case running:
+		c.running--
+		s.promote(t.name)
+	case queued:
+		c.waiting = slices.DeleteFunc(c.waiting, func(w *Ticket) bool { return w == t })
+	}
+	t.state = released
+}
+
+// promote starts waiting tickets of name while it has free slots. s.mu must be held.
+func (s *Set) promote(name string) {
+	c := s.classes[name]
+	l, limited := s.limits[name]
+	for len(c.waiting) > 0 && (!limited || c.running < l.Concurrency) {
+		t := c.waiting[0]
+		c.waiting = c.waiting[1:]
+		c.running++
+		t.state = running
+		close(t.ready)
+	}
+}
+
+// Stats describes every class that has limits or has admitted work, by name.
+func (s *Set) Stats() []Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Stats{}
+	for name, c := range s.classes {
+		l := s.limits[name]
+		out = append(out, Stats{Name: name, Concurrency: l.Concurrency, Queue: l.Queue, Running: c.running, Waiting: len(c.waiting), Admitted: c.admitted, Rejected: c.rejected})
+	}
+	for name, l := range s.limits {
+		if s.classes[name] == nil {
+			out = append(out, Stats{Name: name, Concurrency: l.Concurrency, Queue: l.Queue})
+		}
+	}
+	slices.SortFunc(out, func(a, b Stats) int { return strings.Compare(a.Name, b.Name) })
+	return out
+}
+
+// Reset zeroes the counters and forgets idle classes; runs in progress keep their slots.
+func (s *Set) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, c := range s.classes {
+		if c.running == 0 && len(c.waiting) == 0 {
+			delete(s.classes, name)
+			continue
+		}
+		c.admitted, c.rejected = 0, 0
+	}
+}
@@ -0,0 +1,96 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdmitQueuesAndRejects(t *testing.T) {
+	s := New()
+	s.SetLimits(map[string]Limits{"write": {Concurrency: 1, Queue: 1}})
+	first, err := s.Admit("write")
+	if err != nil || first.Wait(context.Background()) != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	second, err := s.Admit("write")
+	if err != nil {
+		t.Fatalf("second write should queue: %v", err)
+	}
+	if _, err := s.Admit("write"); !errors.Is(err, ErrFull) {
+		t.Fatalf("third write: expected ErrFull, got %v", err)
+	}
+	// Reads have no limits and are not held up by writes.
+	for range 5 {
+		r, err := s.Admit("read")
+		if err != nil || r.Wait(context.Background()) != nil {
+			t.Fatalf("read: %v", err)
+		}
+		defer r.Release()
+	}
+
+	done := make(chan error)
+	go func() { done <- second.Wait(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("queued write ran while the slot was taken")
+	case <-time.After(20 * time.Millisecond):
+	}
+	first.Release()
+	first.Release()
+	if err := <-done; err != nil {
+		t.Fatalf("queued write: %v", err)
+	}
+	got := s.Stats()
+	if len(got) != 2 || got[1] != (Stats{Name: "write", Concurrency: 1, Queue: 1, Running: 1, Admitted: 2, Rejected: 1}) || got[0].Running != 5 {
+		t.Fatalf("unexpected stats %+v", got)
+	}
+	second.Release()
+	s.Reset()
+	if got := s.Stats(); len(got) != 2 || got[1].Admitted != 0 || got[0].Running != 5 {
+		t.Fatalf("unexpected stats after reset %+v", got)
+	}
+}
+
+func TestWaitGivesUp(t *testing.T) {
+	s := New()
+	s.SetLimits(map[string]Limits{"write": {Concurrency: 1, Queue: 2, MaxWait: 10 * time.Millisecond}})
+	hold, _ := s.Admit("write")
+	late, _ := s.Admit("write")
+	if err := late.Wait(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	gone, _ := s.Admit("write")
+	if err := gone.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled wait, got %v", err)
+	}
+	if st := s.Stats()[0]; st.Waiting != 0 || st.Rejected != 2 {
+		t.Fatalf("tickets that gave up still count: %+v", st)
+	}
+	// Raising the limit starts waiting tickets.
+	next, _ := s.Admit("write")
+	s.SetLimits(map[string]Limits{"write": {Concurrency: 2}})
+	if err := next.Wait(context.Background()); err != nil {
+		t.Fatalf("expected the raised limit to admit the ticket: %v", err)
+	}
+	hold.Release()
+	next.Release()
+}
+
+func TestParse(t *testing.T) {
+	got, err := Parse(`{"write": {"concurrency": 2, "queue": 4, "maxWait": "10s"}, "read": {"concurrency": 8}}`)
+	if err != nil || got["write"] != (Limits{Concurrency: 2, Queue: 4, MaxWait: 10 * time.Second}) || got["read"] != (Limits{Concurrency: 8}) {
+		t.Fatalf("parsed %+v (%v)", got, err)
+	}
+	for _, raw := range []string{`{"write": {"queue": 1}}`, `{"write": {"concurrency": 1, "queue": -1}}`, `{"write": {"concurrency": 1, "maxWait": "soon"}}`, `[]`} {
+		if _, err := Parse(raw); err == nil {
+			t.Fatalf("%s: expected an error", raw)
+		}
+	}
+	if got, err := Parse(""); got != nil || err != nil {
+		t.Fatalf("empty: %v %v", got, err)
+	}
+}
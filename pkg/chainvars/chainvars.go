@@ -0,0 +1,170 @@
+// Package chainvars fills preset arguments with chain state read at invocation time:
+// {{height}} is the latest block height and {{mapping:program/mapping[key]}} the value
+// stored under key, which may end in a default for keys that are not set, as in
+// {{mapping:token.aleo/balances[aleo1...] ?? 0u64}}.
+package chainvars
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/clock"
+)
+
+// Errors returned by Resolve.
+var (
+	// ErrMalformed is returned for "{{" that does not start a known variable.
+	ErrMalformed = errors.New("malformed chain variable")
+	// ErrNotFound is returned for a mapping key that is not set and has no default.
+	ErrNotFound = errors.New("mapping key not set")
+	// ErrUnavailable wraps a failed read that no cached value could stand in for.
+	ErrUnavailable = errors.New("chain state unavailable")
+)
+
+// variable matches one variable: the whole reference, then program, mapping, key and
+// default of a mapping read.
+var variable = regexp.MustCompile(`\{\{\s*(height|mapping:([a-z][a-z0-9_]*\.aleo)/([A-Za-z][A-Za-z0-9_]*)\[([^\[\]{}]+)\])\s*(?:\?\?\s*([^{}\s]+)\s*)?\}\}`)
+
+// Has reports whether any of args refers to a variable, or tries to.
+func Has(args []string) bool {
+	for _, a := range args {
+		if strings.Contains(a, "{{") {
+			return true
+		}
+	}
+	return false
+}
+
+// Source reads chain state.
+type Source interface {
+	Height(ctx context.Context) (uint64, error)
+	// Mapping returns the value under key; found is false when the key is not set.
+	Mapping(ctx context.Context, program, mapping, key string) (value string, found bool, err error)
+}
+
+type entry struct {
+	value string
+	found bool
+	at    time.Time
+}
+
+// Resolver fills variables, caching what it reads. The zero value is not usable; call
+// New.
+type Resolver struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	stale time.Duration
+	clock clock.Clock
+	cache map[string]entry
+}
+
+// New returns a Resolver without caching.
+func New() *Resolver {
+	return &Resolver{clock: clock.System, cache: map[string]entry{}}
+}
+
+// Configure sets how long a value read is reused (ttl) and, beyond that, how long it
+// may still stand in when a read fails (stale).
+func (r *Resolver) Configure(ttl, stale time.Duration, c clock.Clock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ttl, r.stale = ttl, stale
+	if c != nil {
+		r.clock = c
+	}
+}
+
+// Reset forgets every cached value.
+func (r *Resolver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = map[string]entry{}
+}
+
+// Resolve returns args with every variable filled from src, whose chain scope names
+// it in the cache (e.g. endpoint and network). stale reports whether a value past its
+// ttl was used because src failed. A filled value may not turn an argument into a flag.
+func (r *Resolver) Resolve(ctx context.Context, src Source, scope string, args []string) (out []string, stale bool, err error) {
+	out = make([]string, len(args))
+	for i, a := range args {
+		var firstErr error
+		filled := variable.ReplaceAllStringFunc(a, func(m string) string {
+			if firstErr != nil {
+				return m
+			}
+			sub := variable.FindStringSubmatch(m)
+			v, wasStale, err := r.read(ctx, src, scope, sub)
+			if err != nil {
+				firstErr = err
+				return m
+			}
+			stale = stale || wasStale
+			return v
+		})
+		if firstErr != nil {
+			return nil, false, firstErr
+		}
+		if strings.Contains(filled, "{{") {
+			return nil, false, fmt.Errorf("%w in %q", ErrMalformed, a)
+		}
+		if !strings.HasPrefix(a, "-") && strings.HasPrefix(filled, "-") {
+			return nil, false, fmt.Errorf("chain variable in %q may not start with '-'", a)
+		}
+		out[i] = filled
+	}
+	return out, stale, nil
+}
+
+// read returns the value of the variable sub, a submatch of variable.
+func (r *Resolver) read(ctx context.Context, src Source, scope string, sub []string) (string, bool, error) {
+	name, program, mapping, key, def := sub[1], sub[2], sub[3], strings.TrimSpace(sub[4]), sub[5]
+	e, stale, err := r.cached(scope+"\x00"+name, func() (entry, error) {
+		if name == "height" {
+			h, err := src.Height(ctx)
+			return entry{value: strconv.FormatUint(h, 10), found: true}, err
+		}
+		v, found, err := src.Mapping(ctx, program, mapping, key)
+		return entry{value: v, found: found}, err
+	})
+	switch {
+	case err != nil:
+		return "", false, fmt.Errorf("%w: %s: %v", ErrUnavailable, name, err)
+	case e.found:
+		return e.value, stale, nil
+	case def != "":
+		return def, stale, nil
+	}
+	return "", false, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// cached returns the entry under k while it is fresh, or reads it. Should the read
+// fail, an entry within the stale window is returned instead.
+func (r *Resolver) cached(k string, read func() (entry, error)) (entry, bool, error) {
+	r.mu.Lock()
+	e, ok := r.cache[k]
+	ttl, staleFor, now := r.ttl, r.stale, r.clock.Now()
+	r.mu.Unlock()
+	if ok && now.Sub(e.at) < ttl {
+		return e, false, nil
+	}
+	fresh, err := read()
+	if err != nil {
+		if ok && now.Sub(e.at) < ttl+staleFor {
+			return e, true, nil
+		}
+		return entry{}, false, err
+	}
+	fresh.at = now
+	if ttl > 0 || staleFor > 0 {
+		r.mu.Lock()
+		r.cache[k] = fresh
+		r.mu.Unlock()
+	}
+	return fresh, false, nil
+}
@@ -0,0 +1,109 @@
+package chainvars
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/clock"
+)
+
+type fakeSource struct {
+	height   uint64
+	mappings map[string]string
+	err      error
+	reads    int
+}
+
+func (s *fakeSource) Height(context.Context) (uint64, error) {
+	s.reads++
+	return s.height, s.err
+}
+
+func (s *fakeSource) Mapping(_ context.Context, program, mapping, key string) (string, bool, error) {
+	s.reads++
+	v, ok := s.mappings[program+"/"+mapping+"["+key+"]"]
+	return v, ok, s.err
+}
+
+func TestResolve(t *testing.T) {
+	src := &fakeSource{height: 42, mappings: map[string]string{"token.aleo/balances[aleo1abc]": "100u64"}}
+	r := New()
+	args := []string{"execute", "oracle.aleo/settle", "{{height}}u32", "{{ mapping:token.aleo/balances[aleo1abc] }}", "{{mapping:token.aleo/balances[aleo1xyz] ?? 0u64}}"}
+	got, stale, err := r.Resolve(context.Background(), src, "n", args)
+	if err != nil || stale {
+		t.Fatalf("unexpected %v %v", stale, err)
+	}
+	want := []string{"execute", "oracle.aleo/settle", "42u32", "100u64", "0u64"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	for _, tc := range []struct {
+		arg  string
+		want error
+	}{
+		{"{{mapping:token.aleo/balances[aleo1xyz]}}", ErrNotFound},
+		{"{{blocks}}", ErrMalformed},
+		{"{{mapping:token/balances[x]}}", ErrMalformed},
+	} {
+		if _, _, err := r.Resolve(context.Background(), src, "n", []string{tc.arg}); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: got %v, want %v", tc.arg, err, tc.want)
+		}
+	}
+
+	src.mappings["token.aleo/balances[aleo1neg]"] = "-1i64"
+	if _, _, err := r.Resolve(context.Background(), src, "n", []string{"{{mapping:token.aleo/balances[aleo1neg]}}"}); err == nil {
+		t.Fatal("expected a value starting with '-' to be rejected")
+	}
+	if !Has(args) || Has(want) {
+		t.Fatal("Has mismatch")
+	}
+}
+
+func TestResolveCache(t *testing.T) {
+	fc := clock.NewFake(time.Unix(0, 0))
+	src := &fakeSource{height: 1}
+	r := New()
+	r.Configure(5*time.Second, 10*time.Second, fc)
+	resolve := func(scope string) (string, bool, error) {
+		out, stale, err := r.Resolve(context.Background(), src, scope, []string{"{{height}}"})
+		if err != nil {
+			return "", false, err
+		}
+		return out[0], stale, nil
+	}
+
+	if v, _, _ := resolve("a"); v != "1" {
+		t.Fatalf("got %s", v)
+	}
+	src.height = 2
+	if v, _, _ := resolve("a"); v != "1" || src.reads != 1 {
+		t.Fatalf("expected the cached height, got %s after %d reads", v, src.reads)
+	}
+	if v, _, _ := resolve("b"); v != "2" {
+		t.Fatalf("scopes must not share values, got %s", v)
+	}
+
+	fc.Advance(6 * time.Second)
+	src.err = errors.New("node down")
+	if v, stale, err := resolve("a"); v != "1" || !stale || err != nil {
+		t.Fatalf("expected the stale height, got %s %v %v", v, stale, err)
+	}
+	fc.Advance(10 * time.Second)
+	if _, _, err := resolve("a"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+
+	src.err = nil
+	if v, stale, _ := resolve("a"); v != "2" || stale {
+		t.Fatalf("expected a fresh read, got %s %v", v, stale)
+	}
+	r.Reset()
+	src.height = 3
+	if v, _, _ := resolve("a"); v != "3" {
+		t.Fatalf("expected Reset to drop the cache, got %s", v)
+	}
+}
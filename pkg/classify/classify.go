@@ -0,0 +1,100 @@
+// Package classify files failed leo runs under a category by matching their stderr
+// against rules: built-in ones for the common failures, and rules an operator adds
+// with STDERR_RULES. Categories are reported as a response's code and drive retries,
+// metrics and alerts.
+package classify
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Built-in categories. Like error codes they are part of the API: never rename one.
+const (
+	// CompileError: the Leo program did not build.
+	CompileError = "compile_error"
+	// InvalidInput: leo rejected the arguments before running, e.g. a malformed literal.
+	InvalidInput = "invalid_input"
+	// InsufficientBalance: the account cannot pay the fee or the amount moved.
+	InsufficientBalance = "insufficient_balance"
+	// Network: the endpoint was unreachable or overloaded.
+	Network = "network"
+	// RejectedExecution: the program ran but an assertion failed, or the network
+	// rejected the transaction.
+	RejectedExecution = "rejected_execution"
+	// Unknown: no rule matched.
+	Unknown = "unknown"
+)
+
+// Rule files stderr matching Pattern under Category.
+type Rule struct {
+	Category string
+	Pattern  *regexp.Regexp
+}
+
+// Rules are tried in order; the first match wins.
+type Rules []Rule
+
+// Builtin are the rules every configuration ends with.
+var Builtin = Rules{
+	{CompileError, regexp.MustCompile(`Error \[E(PAR|TYC|CMP|AST|FLT|LEO)\d+\]|(?i)compilation (error|failed)|failed to (compile|build) (the )?program`)},
+	{InvalidInput, regexp.MustCompile(`(?i)invalid (input|argument|value|literal|address|private key)|failed to parse (input|argument)|expected \d+ inputs?|wrong number of (inputs|arguments)|is not a valid`)},
+	{InsufficientBalance, regexp.MustCompile(`(?i)insufficient (public )?(balance|funds)|not enough (credits|balance)|does not have enough|balance .{0,40}(is )?less than`)},
+	{Network, regexp.MustCompile(`(?i)error sending request|connection (refused|reset)|timed out|dns error|failed to lookup address|tls handshake|\b(429|502|503|504)\b`)},
+	{RejectedExecution, regexp.MustCompile(`(?i)transaction (was )?rejected|rejected transaction|failed to (execute|finalize)|finalize (failed|error)|execution (failed|rejected)|assert(ion)? failed`)},
+}
+
+// category names an operator's category: lower-case words joined by underscores.
+var category = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// Parse decodes STDERR_RULES, a JSON array of {"category", "pattern"} objects with Go
+// regular expressions, and returns them followed by Builtin. An empty string yields
+// Builtin.
+func Parse(raw string) (Rules, error) {
+	if strings.TrimSpace(raw) == "" {
+		return Builtin, nil
+	}
+	var specs []struct {
+		Category string `json:"category"`
+		Pattern  string `json:"pattern"`
+	}
+	if err := json.Unmarshal([]byte(raw), &specs); err != nil {
+		return nil, fmt.Errorf("invalid STDERR_RULES: %w", err)
+	}
+	rules := make(Rules, 0, len(specs)+len(Builtin))
+	for i, s := range specs {
+		if !category.MatchString(s.Category) {
+			return nil, fmt.Errorf("invalid STDERR_RULES: rule %d: category %q must be snake_case", i, s.Category)
+		}
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid STDERR_RULES: rule %d: %w", i, err)
+		}
+		rules = append(rules, Rule{s.Category, re})
+	}
+	return append(rules, Builtin...), nil
+}
+
+// Classify returns the category of the first rule matching stderr, or Unknown.
+func (r Rules) Classify(stderr string) string {
+	for _, rule := range r {
+		if rule.Pattern.MatchString(stderr) {
+			return rule.Category
+		}
+	}
+	return Unknown
+}
+
+// Match reports whether any rule of category matches stderr, whatever the rules before
+// it would say. Network failures are found this way, so a transport error that also
+// mentions, say, a rejected transaction is still retried.
+func (r Rules) Match(category, stderr string) bool {
+	for _, rule := range r {
+		if rule.Category == category && rule.Pattern.MatchString(stderr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package classify
+
+import "testing"
+
+func TestBuiltin(t *testing.T) {
+	cases := map[string]string{
+		"Error [ETYC0372005]: Unknown variable `amount`":                            CompileError,
+		"Error: failed to parse input `5u6`: invalid literal":                       InvalidInput,
+		"Error: Insufficient public balance to pay the fee":                         InsufficientBalance,
+		"error sending request for url (https://api.explorer.provable.com/v1)":      Network,
+		"Broadcast failed: 503 Service Unavailable":                                 Network,
+		"Error: Failed to execute 'token.aleo/transfer_public': assertion failed":   RejectedExecution,
+		"thread 'main' panicked at 'index out of bounds: the len is 0 but index 1'": Unknown,
+	}
+	for stderr, want := range cases {
+		if got := Builtin.Classify(stderr); got != want {
+			t.Errorf("Classify(%q) = %s, want %s", stderr, got, want)
+		}
+	}
+	if !Builtin.Match(Network, "Failed to execute: connection reset by peer") {
+		t.Fatal("expected a transport error to match network behind a rejection")
+	}
+}
+
+func TestParse(t *testing.T) {
+	rules, err := Parse(`[{"category": "nonce_conflict", "pattern": "(?i)nonce"}, {"category": "network", "pattern": "ECONNABORTED"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rules.Classify("Error: transaction rejected: nonce already used"); got != "nonce_conflict" {
+		t.Fatalf("expected operator rules first, got %s", got)
+	}
+	if !rules.Match(Network, "ECONNABORTED") || rules.Classify("assertion failed") != RejectedExecution {
+		t.Fatal("expected operator rules to extend the built-in ones")
+	}
+	if rules, err := Parse(""); err != nil || len(rules) != len(Builtin) {
+		t.Fatalf("expected built-in rules for an empty value, got %v %v", rules, err)
+	}
+	for _, raw := range []string{`{}`, `[{"category": "Bad Name", "pattern": "x"}]`, `[{"category": "x", "pattern": "("}]`} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package clock abstracts the current time, waiting and randomness, so retries, jitter,
+// schedule evaluation and ID generation can be tested deterministically. Production code
+// uses System and Crypto; tests substitute a Fake clock and a Seeded RNG.
+package clock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	mrand "math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that receives the time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// RNG is a source of randomness.
+type RNG interface {
+	// Read fills b with random bytes.
+	Read(b []byte)
+	// Int64N returns a random number in [0, n). It panics if n <= 0.
+	Int64N(n int64) int64
+}
+
+// System is the wall clock.
+var System Clock = systemClock{}
+
+// Crypto draws from crypto/rand.
+var Crypto RNG = cryptoRNG{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type cryptoRNG struct{}
+
+func (cryptoRNG) Read(b []byte)        { _, _ = rand.Read(b) }
+func (cryptoRNG) Int64N(n int64) int64 { return mrand.Int64N(n) }
+
+// Duration returns a random duration in [0, d), or 0 when d is not positive.
+func Duration(r RNG, d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(r.Int64N(int64(d)))
+}
+
+// Hex returns n random bytes from r, hex encoded.
+func Hex(r RNG, n int) string {
+	b := make([]byte, n)
+	r.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Fake is a Clock that only moves when told to. After does not block: it advances the
+// clock by d and fires at once, so code that backs off or waits out jitter runs
+// instantly while Now still reflects the time waited. Waits records every wait.
+type Fake struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+// NewFake returns a Fake clock set to now.
+func NewFake(now time.Time) *Fake { return &Fake{now: now} }
+
+// Now implements Clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After implements Clock.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waits = append(f.waits, d)
+	f.now = f.now.Add(max(d, 0))
+	ch := make(chan time.Time, 1)
+	ch <- f.now
+	return ch
+}
+
+// Advance moves the clock forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+}
+
+// Waits returns the durations passed to After, in call order.
+func (f *Fake) Waits() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration(nil), f.waits...)
+}
+
+// Seeded is an RNG that yields the same sequence for the same seed.
+type Seeded struct {
+	mu sync.Mutex
+	r  *mrand.Rand
+}
+
+// NewSeeded returns a Seeded RNG.
+func NewSeeded(seed uint64) *Seeded {
+	return &Seeded{r: mrand.New(mrand.NewPCG(seed, seed))}
+}
+
+// Read implements RNG.
+func (s *Seeded) Read(b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range b {
+		b[i] = byte(s.r.Uint32())
+	}
+}
+
+// Int64N implements RNG.
+func (s *Seeded) Int64N(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int64N(n)
+}
@@ -0,0 +1,44 @@
+package clock
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	if got := <-f.After(3 * time.Second); !got.Equal(start.Add(3 * time.Second)) {
+		t.Fatalf("After fired at %v", got)
+	}
+	f.Advance(time.Minute)
+	<-f.After(-time.Second)
+	if got := f.Now(); !got.Equal(start.Add(63 * time.Second)) {
+		t.Fatalf("now %v", got)
+	}
+	if got := f.Waits(); !slices.Equal(got, []time.Duration{3 * time.Second, -time.Second}) {
+		t.Fatalf("waits %v", got)
+	}
+}
+
+func TestSeeded(t *testing.T) {
+	a, b := NewSeeded(7), NewSeeded(7)
+	if Hex(a, 8) != Hex(b, 8) || Duration(a, time.Hour) != Duration(b, time.Hour) {
+		t.Fatal("same seed gave different values")
+	}
+	if Hex(NewSeeded(7), 8) == Hex(NewSeeded(8), 8) {
+		t.Fatal("different seeds gave the same value")
+	}
+	for range 100 {
+		if d := Duration(a, time.Second); d < 0 || d >= time.Second {
+			t.Fatalf("duration %v out of range", d)
+		}
+	}
+	if Duration(a, 0) != 0 {
+		t.Fatal("zero range gave a non-zero duration")
+	}
+	if len(Hex(Crypto, 8)) != 16 {
+		t.Fatal("crypto hex length")
+	}
+}
@@ -0,0 +1,174 @@
+// Package contractquota caps how many executes of a contract run per UTC day, whoever
+// the caller is. It protects rate-limited upstream API nodes and program-level business
+// rules, such as a mint that must not run more than so many times a day, where per-caller
+// quotas cannot help.
+package contractquota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// ErrExhausted is returned once a contract's executes for the day are used up.
+var ErrExhausted = errors.New("daily invocation quota exhausted")
+
+// Limits maps contracts to the executes allowed per UTC day.
+type Limits map[string]int
+
+// Parse decodes the CONTRACT_DAILY_LIMITS JSON object, e.g. {"token.aleo": 5000}. An
+// empty string yields no limits.
+func Parse(raw string) (Limits, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var l Limits
+	if err := json.Unmarshal([]byte(raw), &l); err != nil {
+		return nil, fmt.Errorf("invalid CONTRACT_DAILY_LIMITS: %w", err)
+	}
+	out := make(Limits, len(l))
+	for contract, n := range l {
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid CONTRACT_DAILY_LIMITS: %s: limit must be positive", contract)
+		}
+		out[strings.ToLower(strings.TrimSpace(contract))] = n
+	}
+	return out, nil
+}
+
+// Day returns the UTC day t falls on, as counters key it.
+func Day(t time.Time) string { return t.UTC().Format(time.DateOnly) }
+
+// ResetAt returns when the day of t ends and its counters start over.
+func ResetAt(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
+
+// Counter counts executes per contract and day.
+type Counter interface {
+	// Take counts one execute of contract on day unless limit are already counted, and
+	// returns the count including this one, or ErrExhausted.
+	Take(ctx context.Context, contract, day string, limit int) (int, error)
+	// Release uncounts one execute of contract on day that was refused before it ran.
+	Release(ctx context.Context, contract, day string) error
+}
+
+// Memory is a Counter scoped to the container.
+type Memory struct {
+	mu     sync.Mutex
+	day    string
+	counts map[string]int
+}
+
+// NewMemory returns an empty Memory.
+func NewMemory() *Memory { return &Memory{counts: map[string]int{}} }
+
+// Take implements Counter. Counts of earlier days are dropped.
+func (m *Memory) Take(_ context.Context, contract, day string, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if day != m.day {
+		m.day, m.counts = day, map[string]int{}
+	}
+	if m.counts[contract] >= limit {
+		return m.counts[contract], ErrExhausted
+	}
+	m.counts[contract]++
+	return m.counts[contract], nil
+}
+
+// Release implements Counter. Counts of earlier days are already gone.
+func (m *Memory) Release(_ context.Context, contract, day string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if day == m.day && m.counts[contract] > 0 {
+		m.counts[contract]--
+	}
+	return nil
+}
+
+// Reset forgets all counts.
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	m.day, m.counts = "", map[string]int{}
+	m.mu.Unlock()
+}
+
+// DynamoCounter keeps counts in a DynamoDB table with string partition key "id", one
+// item per contract and day. Enable TTL on expiresAt to have past days removed.
+type DynamoCounter struct {
+	client *awsapi.Client
+	table  string
+}
+
+// NewDynamoCounter returns a counter backed by table.
+func NewDynamoCounter(client *awsapi.Client, table string) (*DynamoCounter, error) {
+	if table == "" {
+		return nil, errors.New("contract quota table name is required")
+	}
+	return &DynamoCounter{client: client, table: table}, nil
+}
+
+// Take implements Counter with one conditional update, so containers never count past
+// limit between them.
+func (d *DynamoCounter) Take(ctx context.Context, contract, day string, limit int) (int, error) {
+	expires := time.Now().Add(48 * time.Hour)
+	if t, err := time.Parse(time.DateOnly, day); err == nil {
+		expires = ResetAt(t).Add(24 * time.Hour)
+	}
+	in := map[string]any{
+		"TableName":                d.table,
+		"Key":                      map[string]map[string]string{"id": {"S": contract + "#" + day}},
+		"UpdateExpression":         "ADD #count :one SET #exp = :exp",
+		"ConditionExpression":      "attribute_not_exists(#count) OR #count < :limit",
+		"ExpressionAttributeNames": map[string]string{"#count": "count", "#exp": "expiresAt"},
+		"ExpressionAttributeValues": map[string]map[string]string{
+			":one":   {"N": "1"},
+			":limit": {"N": strconv.Itoa(limit)},
+			":exp":   {"N": strconv.FormatInt(expires.Unix(), 10)},
+		},
+		"ReturnValues": "UPDATED_NEW",
+	}
+	var out struct {
+		Attributes map[string]map[string]string
+	}
+	err := d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.UpdateItem", in, &out)
+	var apiErr *awsapi.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == "ConditionalCheckFailedException" {
+		return limit, ErrExhausted
+	}
+	if err != nil {
+		return 0, fmt.Errorf("count contract invocation: %w", err)
+	}
+	n, _ := strconv.Atoi(out.Attributes["count"]["N"])
+	return n, nil
+}
+
+// Release implements Counter, never taking the count below zero.
+func (d *DynamoCounter) Release(ctx context.Context, contract, day string) error {
+	in := map[string]any{
+		"TableName":                 d.table,
+		"Key":                       map[string]map[string]string{"id": {"S": contract + "#" + day}},
+		"UpdateExpression":          "ADD #count :minus",
+		"ConditionExpression":       "#count > :zero",
+		"ExpressionAttributeNames":  map[string]string{"#count": "count"},
+		"ExpressionAttributeValues": map[string]map[string]string{":minus": {"N": "-1"}, ":zero": {"N": "0"}},
+	}
+	err := d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.UpdateItem", in, nil)
+	var apiErr *awsapi.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == "ConditionalCheckFailedException" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("release contract invocation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package contractquota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+func TestParse(t *testing.T) {
+	l, err := Parse(`{"Token.aleo": 5, "mint.aleo": 1}`)
+	if err != nil || l["token.aleo"] != 5 || l["mint.aleo"] != 1 {
+		t.Fatalf("unexpected limits %v (%v)", l, err)
+	}
+	if l, err := Parse(" "); err != nil || l != nil {
+		t.Fatalf("expected no limits, got %v (%v)", l, err)
+	}
+	for _, raw := range []string{`{"token.aleo": 0}`, `{"token.aleo": -1}`, `["token.aleo"]`} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestResetAt(t *testing.T) {
+	now := time.Date(2026, 3, 31, 23, 59, 0, 0, time.FixedZone("X", -2*3600))
+	if got := Day(now); got != "2026-04-01" {
+		t.Fatalf("Day = %s", got)
+	}
+	if got := ResetAt(now); !got.Equal(time.Date(2026, 4, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("ResetAt = %s", got)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m, ctx := NewMemory(), context.Background()
+	for i := 1; i <= 2; i++ {
+		if n, err := m.Take(ctx, "token.aleo", "2026-01-01", 2); err != nil || n != i {
+			t.Fatalf("take %d: %d (%v)", i, n, err)
+		}
+	}
+	if _, err := m.Take(ctx, "token.aleo", "2026-01-01", 2); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected ErrExhausted, got %v", err)
+	}
+	if n, err := m.Take(ctx, "other.aleo", "2026-01-01", 2); err != nil || n != 1 {
+		t.Fatalf("contracts must be counted apart: %d (%v)", n, err)
+	}
+	if n, err := m.Take(ctx, "token.aleo", "2026-01-02", 2); err != nil || n != 1 {
+		t.Fatalf("expected a new day to start over: %d (%v)", n, err)
+	}
+	for range 2 {
+		if err := m.Release(ctx, "token.aleo", "2026-01-02"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := m.Take(ctx, "token.aleo", "2026-01-02", 2); err != nil || n != 1 {
+		t.Fatalf("expected a release to give the execute back, never below zero: %d (%v)", n, err)
+	}
+}
+
+func TestDynamoCounter(t *testing.T) {
+	counts := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Key                       map[string]map[string]string
+			ExpressionAttributeValues map[string]map[string]string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		id := in.Key["id"]["S"]
+		if in.ExpressionAttributeValues[":minus"] != nil {
+			if counts[id] == 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`))
+				return
+			}
+			counts[id]--
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		if limit, _ := strconv.Atoi(in.ExpressionAttributeValues[":limit"]["N"]); counts[id] >= limit {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`))
+			return
+		}
+		counts[id]++
+		_ = json.NewEncoder(w).Encode(map[string]any{"Attributes": map[string]any{"count": map[string]string{"N": strconv.Itoa(counts[id])}}})
+	}))
+	defer srv.Close()
+	client := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	d, err := NewDynamoCounter(client, "contract-quotas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if n, err := d.Take(ctx, "token.aleo", "2026-01-01", 1); err != nil || n != 1 {
+		t.Fatalf("take: %d (%v)", n, err)
+	}
+	if _, err := d.Take(ctx, "token.aleo", "2026-01-01", 1); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected ErrExhausted, got %v", err)
+	}
+	if counts["token.aleo#2026-01-01"] != 1 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+	for range 2 {
+		if err := d.Release(ctx, "token.aleo", "2026-01-01"); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+	}
+	if counts["token.aleo#2026-01-01"] != 0 {
+		t.Fatalf("expected the release to stop at zero, got %v", counts)
+	}
+	srv.Close()
+	if _, err := d.Take(ctx, "token.aleo", "2026-01-02", 1); err == nil || errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected a store error, got %v", err)
+	}
+}
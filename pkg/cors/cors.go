@@ -0,0 +1,90 @@
+// Package cors answers browser preflight requests and adds CORS headers to responses.
+// Function URL CORS settings cannot be used together with handler-set headers, so the
+// handler owns CORS entirely when it is configured here.
+package cors
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the CORS policy. The zero value disables CORS.
+type Config struct {
+	// Origins are the allowed origins (e.g. "https://app.example.com"); "*" allows any.
+	Origins []string
+	// Methods and Headers are returned on preflight responses.
+	Methods []string
+	Headers []string
+	// Expose lists response headers scripts may read.
+	Expose []string
+	// Credentials allows cookies and Authorization headers. Origins are then always
+	// echoed back, since browsers reject "*" with credentials.
+	Credentials bool
+	// MaxAge lets browsers cache a preflight result.
+	MaxAge time.Duration
+}
+
+// Enabled reports whether any origin is allowed.
+func (c Config) Enabled() bool { return len(c.Origins) > 0 }
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or "" if the
+// origin is not allowed.
+func (c Config) allowOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	if slices.ContainsFunc(c.Origins, func(o string) bool { return strings.EqualFold(strings.TrimRight(o, "/"), origin) }) {
+		return origin
+	}
+	if slices.Contains(c.Origins, "*") {
+		if c.Credentials {
+			return origin
+		}
+		return "*"
+	}
+	return ""
+}
+
+// Preflight returns the headers answering an OPTIONS request from origin, and false
+// if the origin or requested method is not allowed.
+func (c Config) Preflight(origin, method string) (map[string]string, bool) {
+	allow := c.allowOrigin(origin)
+	if allow == "" || (method != "" && !slices.ContainsFunc(c.Methods, func(m string) bool { return strings.EqualFold(m, method) })) {
+		return map[string]string{"Vary": "Origin"}, false
+	}
+	h := c.headers(allow)
+	h["Access-Control-Allow-Methods"] = strings.Join(c.Methods, ", ")
+	h["Access-Control-Allow-Headers"] = strings.Join(c.Headers, ", ")
+	if c.MaxAge > 0 {
+		h["Access-Control-Max-Age"] = strconv.Itoa(int(c.MaxAge.Seconds()))
+	}
+	return h, true
+}
+
+// Apply adds the CORS headers for origin to an actual response's headers.
+func (c Config) Apply(headers map[string]string, origin string) {
+	allow := c.allowOrigin(origin)
+	if allow == "" {
+		return
+	}
+	for k, v := range c.headers(allow) {
+		// The response may already vary on other request headers.
+		if k == "Vary" && headers[k] != "" {
+			v = headers[k] + ", " + v
+		}
+		headers[k] = v
+	}
+	if len(c.Expose) > 0 {
+		headers["Access-Control-Expose-Headers"] = strings.Join(c.Expose, ", ")
+	}
+}
+
+func (c Config) headers(allow string) map[string]string {
+	h := map[string]string{"Access-Control-Allow-Origin": allow, "Vary": "Origin"}
+	if c.Credentials {
+		h["Access-Control-Allow-Credentials"] = "true"
+	}
+	return h
+}
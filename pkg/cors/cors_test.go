@@ -0,0 +1,46 @@
+package cors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPreflightAndApply(t *testing.T) {
+	c := Config{
+		Origins: []string{"https://app.example.com"},
+		Methods: []string{"GET", "POST"},
+		Headers: []string{"Content-Type", "X-Leo-Client"},
+		Expose:  []string{"Retry-After"},
+		MaxAge:  10 * time.Minute,
+	}
+	h, ok := c.Preflight("https://app.example.com", "POST")
+	if !ok || h["Access-Control-Allow-Origin"] != "https://app.example.com" || h["Access-Control-Allow-Headers"] != "Content-Type, X-Leo-Client" || h["Access-Control-Max-Age"] != "600" {
+		t.Fatalf("unexpected preflight headers %v (%v)", h, ok)
+	}
+	if _, ok := c.Preflight("https://evil.example", "POST"); ok {
+		t.Fatalf("expected an unknown origin to be rejected")
+	}
+	if _, ok := c.Preflight("https://app.example.com", "DELETE"); ok {
+		t.Fatalf("expected a disallowed method to be rejected")
+	}
+
+	resp := map[string]string{}
+	c.Apply(resp, "https://app.example.com")
+	if resp["Access-Control-Allow-Origin"] != "https://app.example.com" || resp["Access-Control-Expose-Headers"] != "Retry-After" {
+		t.Fatalf("unexpected response headers %v", resp)
+	}
+	resp = map[string]string{}
+	c.Apply(resp, "https://evil.example")
+	if len(resp) != 0 {
+		t.Fatalf("expected no headers for an unknown origin, got %v", resp)
+	}
+
+	wild := Config{Origins: []string{"*"}, Methods: []string{"POST"}}
+	if h, _ := wild.Preflight("https://x.example", "POST"); h["Access-Control-Allow-Origin"] != "*" {
+		t.Fatalf("expected wildcard origin, got %v", h)
+	}
+	wild.Credentials = true
+	if h, _ := wild.Preflight("https://x.example", "POST"); h["Access-Control-Allow-Origin"] != "https://x.example" || h["Access-Control-Allow-Credentials"] != "true" {
+		t.Fatalf("expected the origin echoed with credentials, got %v", h)
+	}
+}
@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// DeadlineFlag passes the time a run has left to the command itself, so that it gives
+// up with its own error before it is killed. The flag's value is the time left, less
+// Margin, in Units: a timeout in seconds has Unit time.Second, and a retry count with
+// 10 seconds per attempt has Unit 10*time.Second.
+type DeadlineFlag struct {
+	Flag   string
+	Unit   time.Duration
+	Margin time.Duration
+}
+
+// UnmarshalJSON decodes {"flag": "--timeout", "unit": "1s", "margin": "3s"}; unit
+// defaults to one second.
+func (f *DeadlineFlag) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Flag   string `json:"flag"`
+		Unit   string `json:"unit"`
+		Margin string `json:"margin"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(raw.Flag, "-") {
+		return fmt.Errorf("flag %q must start with -", raw.Flag)
+	}
+	f.Flag, f.Unit, f.Margin = raw.Flag, time.Second, 0
+	var err error
+	if raw.Unit != "" {
+		if f.Unit, err = time.ParseDuration(raw.Unit); err != nil || f.Unit <= 0 {
+			return fmt.Errorf("%s: invalid unit %q", raw.Flag, raw.Unit)
+		}
+	}
+	if raw.Margin != "" {
+		if f.Margin, err = time.ParseDuration(raw.Margin); err != nil || f.Margin < 0 {
+			return fmt.Errorf("%s: invalid margin %q", raw.Flag, raw.Margin)
+		}
+	}
+	return nil
+}
+
+// DeadlineFlags maps subcommands to the flags they receive.
+type DeadlineFlags map[string][]DeadlineFlag
+
+// ParseDeadlineFlags decodes the DEADLINE_FLAGS JSON object, e.g.
+// {"execute": [{"flag": "--timeout", "margin": "3s"}]}. An empty string yields none.
+func ParseDeadlineFlags(raw string) (DeadlineFlags, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var out DeadlineFlags
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, fmt.Errorf("invalid DEADLINE_FLAGS: %w", err)
+	}
+	return out, nil
+}
+
+// withDeadlineFlags sets each flag in args from the time left. A value the caller
+// already gave is kept when it is smaller; anything else is replaced. Every flag gets
+// at least 1, since the run may still finish in time.
+func withDeadlineFlags(args []string, flags []DeadlineFlag, left time.Duration) []string {
+	subcmd, _ := utils.FirstSubcommand(args)
+	for _, f := range flags {
+		v := max(int64((left-f.Margin)/f.Unit), 1)
+		if given, err := strconv.ParseInt(utils.GetFlagValue(args, f.Flag), 10, 64); err == nil && given <= v {
+			continue
+		}
+		args = utils.InjectFlagValueAfterSubcommand(utils.RemoveFlags(args, f.Flag), subcmd, f.Flag, strconv.FormatInt(v, 10))
+	}
+	return args
+}
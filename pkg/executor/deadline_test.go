@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDeadlineFlags(t *testing.T) {
+	got, err := ParseDeadlineFlags(`{"execute": [{"flag": "--timeout", "margin": "3s"}, {"flag": "--retries", "unit": "20s"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DeadlineFlag{{Flag: "--timeout", Unit: time.Second, Margin: 3 * time.Second}, {Flag: "--retries", Unit: 20 * time.Second}}
+	if !slices.Equal(got["execute"], want) {
+		t.Fatalf("parsed %+v", got)
+	}
+	if got, err := ParseDeadlineFlags(" "); err != nil || got != nil {
+		t.Fatalf("empty config: %v %v", got, err)
+	}
+	for _, raw := range []string{`{"execute": [{"flag": "timeout"}]}`, `{"execute": [{"flag": "--t", "unit": "0s"}]}`, `{"execute": [{"flag": "--t", "margin": "soon"}]}`, `[]`} {
+		if _, err := ParseDeadlineFlags(raw); err == nil || !strings.Contains(err.Error(), "DEADLINE_FLAGS") {
+			t.Fatalf("%s: expected an error, got %v", raw, err)
+		}
+	}
+}
+
+func TestWithDeadlineFlags(t *testing.T) {
+	flags := []DeadlineFlag{{Flag: "--timeout", Unit: time.Second, Margin: 3 * time.Second}, {Flag: "--retries", Unit: 20 * time.Second}}
+	cases := []struct {
+		args []string
+		left time.Duration
+		want []string
+	}{
+		{[]string{"execute", "token.aleo/mint", "1u64"}, 63500 * time.Millisecond, []string{"execute", "--retries", "3", "--timeout", "60", "token.aleo/mint", "1u64"}},
+		// A smaller value from the caller is kept, a larger one lowered.
+		{[]string{"execute", "--timeout", "10", "--retries=9", "token.aleo/mint"}, time.Minute, []string{"execute", "--retries", "3", "--timeout", "10", "token.aleo/mint"}},
+		// Out of time, the flags still get 1.
+		{[]string{"execute", "token.aleo/mint"}, time.Second, []string{"execute", "--retries", "1", "--timeout", "1", "token.aleo/mint"}},
+	}
+	for _, c := range cases {
+		if got := withDeadlineFlags(c.args, flags, c.left); !slices.Equal(got, c.want) {
+			t.Errorf("%v with %v left: got %v, want %v", c.args, c.left, got, c.want)
+		}
+	}
+}
+
+func TestRunSetsDeadlineFlags(t *testing.T) {
+	cfg := Config{BinPath: "/bin/echo", Args: []string{"execute", "token.aleo/mint"}, DeadlineFlags: []DeadlineFlag{{Flag: "--timeout", Unit: time.Second, Margin: 5 * time.Second}}}
+	if res := Run(context.Background(), cfg); res.Stdout != "execute token.aleo/mint" {
+		t.Fatalf("flags set without a deadline: %q", res.Stdout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if res := Run(ctx, cfg); res.Stdout != "execute --timeout 24 token.aleo/mint" {
+		t.Fatalf("unexpected argv %q", res.Stdout)
+	}
+}
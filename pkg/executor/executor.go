@@ -2,13 +2,20 @@
 package executor
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"slices"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/debendraoli/leo-lambda/pkg/budget"
+	"github.com/debendraoli/leo-lambda/pkg/clock"
 	"github.com/debendraoli/leo-lambda/pkg/utils"
 )
 
@@ -17,6 +24,57 @@ type Config struct {
 	Args           []string
 	WorkDir        string
 	MaxOutputBytes int
+	// WorkRoot, when set, confines WorkDir: the run is refused unless WorkDir, with
+	// symlinks resolved, is inside it.
+	WorkRoot string
+	// OnOutput, when set, is called with each line of output as the process produces
+	// it, so callers can observe a run before it finishes. Calls are serialized across
+	// streams, and a final line without a newline is reported once the process exits.
+	OnOutput OutputFunc
+	// OnStart, when set, is called with the child PID once the process has started.
+	OnStart func(pid int)
+	// OnExit, when set, is called with the state of every process that ran, retries
+	// included, once it has exited, e.g. to report its resource usage.
+	OnExit func(*os.ProcessState)
+	// PTY runs the command on a pseudo-terminal, for tools that hide progress and other
+	// output when not attached to a TTY. stdout and stderr are then a single stream,
+	// reported as Stdout, with progress lines redrawn by carriage returns collapsed to
+	// their final state. Only supported on Linux.
+	PTY bool
+	// Retry re-runs the command after transient failures.
+	Retry RetryPolicy
+	// Clock times the retry backoff; nil means the wall clock.
+	Clock clock.Clock
+	// DeadlineFlags are set on every run, retries included, from the time left before
+	// ctx's deadline. Without a deadline they are left alone.
+	DeadlineFlags []DeadlineFlag
+}
+
+// RetryPolicy re-runs a command whose failure looks transient, such as a network error
+// while leo downloads proving parameters. It is meant for failures that happen before
+// anything is broadcast; broadcast retries are the caller's business.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of runs; 0 or 1 disables retries.
+	MaxAttempts int
+	// ExitCodes and StderrPattern select retryable failures: a failed run is retried
+	// when its exit code is listed or its stderr matches.
+	ExitCodes     []int
+	StderrPattern *regexp.Regexp
+	// Categories are retried too when Classify files a failure's stderr under one.
+	Categories []string
+	Classify   func(stderr string) string
+	// Backoff is the wait before the first retry, doubled after each attempt up to
+	// MaxBackoff when that is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (p RetryPolicy) retryable(res Result) bool {
+	if res.ExitCode == 0 {
+		return false
+	}
+	return slices.Contains(p.ExitCodes, res.ExitCode) || (p.StderrPattern != nil && p.StderrPattern.MatchString(res.Stderr)) ||
+		(p.Classify != nil && len(p.Categories) > 0 && slices.Contains(p.Categories, p.Classify(res.Stderr)))
 }
 
 type Result struct {
@@ -24,26 +82,71 @@ type Result struct {
 	Stdout    string
 	Stderr    string
 	Truncated bool
+	// Attempts is how many times the command ran, more than 1 after retries.
+	Attempts int
 }
 
 const defaultMaxOutputBytes = 64 * 1024
 
+// killWaitDelay bounds how long Wait keeps reading output after the process is killed.
+const killWaitDelay = 500 * time.Millisecond
+
 var (
 	stdOutExcludedStrings = []string{"Installation"}
 	stdErrExcludedStrings = []string{"Failed to store", "powers-of-beta"}
 )
 
-// Run executes the provided command with the given configuration.
+// Run executes the provided command with the given configuration. When ctx carries a
+// budget, the command is stopped early enough to leave its reserve for later stages and
+// its output is capped at the budget's output allowance. Retries, with their backoff,
+// share that same deadline.
 func Run(ctx context.Context, cfg Config) Result {
+	cfg.MaxOutputBytes = budget.OutputLimit(ctx, cfg.MaxOutputBytes)
 	if cfg.MaxOutputBytes <= 0 {
 		cfg.MaxOutputBytes = defaultMaxOutputBytes
 	}
+	ctx, cancel, err := budget.Stage(ctx)
+	defer cancel()
+	if err != nil {
+		return Result{ExitCode: 1, Stderr: err.Error(), Attempts: 1}
+	}
 
+	clk := cmp.Or(cfg.Clock, clock.System)
+	res := runOnce(ctx, cfg)
+	backoff := cfg.Retry.Backoff
+	for attempts := 1; attempts < cfg.Retry.MaxAttempts && cfg.Retry.retryable(res); attempts++ {
+		select {
+		case <-ctx.Done():
+			res.Attempts = attempts
+			return res
+		case <-clk.After(backoff):
+		}
+		if backoff *= 2; cfg.Retry.MaxBackoff > 0 {
+			backoff = min(backoff, cfg.Retry.MaxBackoff)
+		}
+		res = runOnce(ctx, cfg)
+		res.Attempts = attempts + 1
+	}
+	res.Attempts = max(res.Attempts, 1)
+	return res
+}
+
+// runOnce runs the command a single time.
+func runOnce(ctx context.Context, cfg Config) Result {
+	if d, ok := ctx.Deadline(); ok && len(cfg.DeadlineFlags) > 0 {
+		cfg.Args = withDeadlineFlags(cfg.Args, cfg.DeadlineFlags, time.Until(d))
+	}
 	cmd := exec.CommandContext(ctx, cfg.BinPath, cfg.Args...)
 	cmd.Dir = cfg.WorkDir
+	// Run in its own process group so cancellation also stops leo's children, which
+	// would otherwise keep the output pipes (and Wait) open past the deadline.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = killWaitDelay
 
 	if cfg.WorkDir != "" {
-		if err := os.MkdirAll(cfg.WorkDir, 0o755); err != nil {
+		dir, err := ResolveWorkDir(cfg.WorkRoot, cfg.WorkDir)
+		if err != nil {
 			errMsg, truncated := clipToLimit(err.Error(), cfg.MaxOutputBytes)
 			return Result{
 				ExitCode:  1,
@@ -51,17 +154,50 @@ func Run(ctx context.Context, cfg Config) Result {
 				Truncated: truncated,
 			}
 		}
+		cmd.Dir = dir
 	}
 
 	stdoutBuf := newLimitedBuffer(cfg.MaxOutputBytes)
 	stderrBuf := newLimitedBuffer(cfg.MaxOutputBytes)
-	cmd.Stdout = stdoutBuf
-	cmd.Stderr = stderrBuf
+	var stdoutLines, stderrLines *lineWriter
+	if cfg.OnOutput != nil {
+		e := &lineEmitter{fn: cfg.OnOutput, pty: cfg.PTY}
+		stdoutLines, stderrLines = e.writer(Stdout), e.writer(Stderr)
+		cmd.Stdout = io.MultiWriter(stdoutBuf, stdoutLines)
+		cmd.Stderr = io.MultiWriter(stderrBuf, stderrLines)
+	} else {
+		cmd.Stdout, cmd.Stderr = stdoutBuf, stderrBuf
+	}
 
-	runErr := cmd.Run()
+	var runErr error
+	if cfg.PTY {
+		runErr = runPTY(cmd, cmd.Stdout, cfg.OnStart)
+	} else {
+		runErr = cmd.Start()
+		if runErr == nil {
+			if cfg.OnStart != nil {
+				cfg.OnStart(cmd.Process.Pid)
+			}
+			runErr = cmd.Wait()
+		}
+	}
+	if cfg.OnExit != nil && cmd.ProcessState != nil {
+		cfg.OnExit(cmd.ProcessState)
+	}
+	if runErr != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		runErr = errors.Join(runErr, budget.ErrExhausted)
+	}
+	if cfg.OnOutput != nil {
+		stdoutLines.flush()
+		stderrLines.flush()
+	}
 
+	stdout := stdoutBuf.String()
+	if cfg.PTY {
+		stdout = collapseCR(stdout)
+	}
 	res := Result{
-		Stdout:    utils.FilterLines(stdoutBuf.String(), stdOutExcludedStrings),
+		Stdout:    utils.FilterLines(stdout, stdOutExcludedStrings),
 		Stderr:    utils.FilterLines(stderrBuf.String(), stdErrExcludedStrings),
 		Truncated: stdoutBuf.Truncated || stderrBuf.Truncated,
 	}
@@ -81,6 +217,60 @@ func Run(ctx context.Context, cfg Config) Result {
 	return res
 }
 
+// runPTY starts cmd on a new pseudo-terminal and copies everything it writes to out
+// until it exits. The copy is given killWaitDelay to drain after exit, matching
+// cmd.WaitDelay for pipes, in case leo's children still hold the terminal open.
+func runPTY(cmd *exec.Cmd, out io.Writer, onStart func(pid int)) error {
+	master, slave, err := openPTY()
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = ptyAttr()
+	err = cmd.Start()
+	// The child holds its own copy; closing ours lets reads end once it exits.
+	_ = slave.Close()
+	if err != nil {
+		return err
+	}
+	if onStart != nil {
+		onStart(cmd.Process.Pid)
+	}
+	copied := make(chan struct{})
+	go func() {
+		// Reading the master fails with EIO once no process has the terminal open.
+		_, _ = io.Copy(out, master)
+		close(copied)
+	}()
+	err = cmd.Wait()
+	select {
+	case <-copied:
+	case <-time.After(killWaitDelay):
+		_ = master.Close()
+		<-copied
+	}
+	return err
+}
+
+// collapseCR turns terminal output into plain lines: CRLF becomes LF and a line redrawn
+// with carriage returns, such as a progress bar, keeps only its final state.
+func collapseCR(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		l = strings.TrimRight(l, "\r")
+		if j := strings.LastIndexByte(l, '\r'); j >= 0 {
+			l = l[j+1:]
+		}
+		lines[i] = l
+	}
+	return strings.Join(lines, "\n")
+}
+
 func exitCodeFromError(runErr error) int {
 	var ee *exec.ExitError
 	if errors.As(runErr, &ee) {
@@ -153,3 +343,34 @@ func (b *limitedBuffer) Write(p []byte) (int, error) {
 func (b *limitedBuffer) String() string {
 	return string(b.buf)
 }
+
+// RunFirstSuccess runs every config concurrently and returns the first result that
+// exits 0 together with its index, cancelling the others. When none succeed, the
+// result of the first config is returned so errors stay attributable to the primary.
+func RunFirstSuccess(ctx context.Context, cfgs []Config) (Result, int) {
+	if len(cfgs) == 1 {
+		return Run(ctx, cfgs[0]), 0
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		idx int
+		res Result
+	}
+	results := make(chan outcome, len(cfgs))
+	for i, c := range cfgs {
+		go func() {
+			results <- outcome{idx: i, res: Run(ctx, c)}
+		}()
+	}
+	all := make([]Result, len(cfgs))
+	for range cfgs {
+		o := <-results
+		if o.res.ExitCode == 0 {
+			return o.res, o.idx
+		}
+		all[o.idx] = o.res
+	}
+	return all[0], 0
+}
@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+// BenchmarkLimitedBufferWrite feeds pipe-sized chunks into buffers of various limits,
+// writing four times the limit so the tail-keeping path dominates.
+func BenchmarkLimitedBufferWrite(b *testing.B) {
+	chunk := bytes.Repeat([]byte("x"), 32*1024)
+	for _, limit := range []int{64 * 1024, 1 << 20, 5_500_000} {
+		b.Run(fmt.Sprintf("limit=%d", limit), func(b *testing.B) {
+			total := 4 * limit
+			b.SetBytes(int64(total))
+			b.ReportAllocs()
+			for b.Loop() {
+				buf := newLimitedBuffer(limit)
+				for written := 0; written < total; written += len(chunk) {
+					_, _ = buf.Write(chunk)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRunEcho(b *testing.B) {
+	cfg := Config{BinPath: "echo", Args: []string{"execute", "credits.aleo/transfer_public"}}
+	b.ReportAllocs()
+	for b.Loop() {
+		Run(context.Background(), cfg)
+	}
+}
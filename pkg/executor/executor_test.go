@@ -2,8 +2,17 @@ package executor
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/budget"
+	"github.com/debendraoli/leo-lambda/pkg/clock"
 )
 
 func TestRunEcho(t *testing.T) {
@@ -41,3 +50,152 @@ func TestRun_TruncatesAndKeepsTail(t *testing.T) {
 		t.Fatalf("expected tail of output to be preserved, got %q", res.Stdout)
 	}
 }
+
+func TestRunFirstSuccess_PicksFastestSuccess(t *testing.T) {
+	start := time.Now()
+	res, idx := RunFirstSuccess(context.Background(), []Config{
+		{BinPath: "/bin/sh", Args: []string{"-c", "sleep 5; echo slow"}},
+		{BinPath: "/bin/sh", Args: []string{"-c", "echo fast"}},
+	})
+	if idx != 1 || res.Stdout != "fast" {
+		t.Fatalf("expected fast config to win, got idx=%d stdout=%q", idx, res.Stdout)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("loser was not cancelled in time: %s", time.Since(start))
+	}
+}
+
+func TestRunFirstSuccess_AllFailReturnsPrimary(t *testing.T) {
+	res, idx := RunFirstSuccess(context.Background(), []Config{
+		{BinPath: "/bin/sh", Args: []string{"-c", "echo primary >&2; exit 3"}},
+		{BinPath: "/bin/sh", Args: []string{"-c", "exit 4"}},
+	})
+	if idx != 0 || res.ExitCode != 3 || !strings.Contains(res.Stderr, "primary") {
+		t.Fatalf("expected primary failure, got idx=%d %+v", idx, res)
+	}
+}
+
+func TestRun_StopsAtBudgetReserve(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx := budget.With(parent, budget.Budget{Reserve: 4500 * time.Millisecond})
+
+	start := time.Now()
+	res := Run(ctx, Config{BinPath: "sleep", Args: []string{"3"}})
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("expected the run to stop before the reserve, took %v", time.Since(start))
+	}
+	if res.ExitCode == 0 || !strings.Contains(res.Stderr, budget.ErrExhausted.Error()) {
+		t.Fatalf("expected an exhausted-budget failure, got %+v", res)
+	}
+}
+
+func TestRunPTY(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pty mode is linux-only")
+	}
+	script := `[ -t 1 ] && echo tty; printf 'working 10%%\rworking 50%%\rworking 100%%\n'; echo oops >&2; exit 3`
+	res := Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", script}, PTY: true})
+	if res.ExitCode != 3 {
+		t.Fatalf("expected exit 3, got %d (stderr %q)", res.ExitCode, res.Stderr)
+	}
+	if res.Stdout != "tty\nworking 100%\noops" {
+		t.Fatalf("unexpected stdout %q", res.Stdout)
+	}
+
+	res = Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", "[ -t 1 ] || echo notty"}})
+	if strings.TrimSpace(res.Stdout) != "notty" {
+		t.Fatalf("expected no tty without PTY, got %q", res.Stdout)
+	}
+}
+
+func TestCollapseCR(t *testing.T) {
+	got := collapseCR("a\r\n1%\r2%\r\r\nplain\n")
+	if got != "a\n2%\nplain\n" {
+		t.Fatalf("unexpected %q", got)
+	}
+}
+
+func TestRunOnOutput(t *testing.T) {
+	type event struct{ stream, line string }
+	var got []event
+	res := Run(context.Background(), Config{
+		BinPath: "/bin/sh",
+		Args:    []string{"-c", `echo one; sleep 0.05; echo warn >&2; sleep 0.05; printf 'two\nlast'`},
+		OnOutput: func(stream, line string, ts time.Time) {
+			if ts.IsZero() {
+				t.Errorf("missing timestamp for %q", line)
+			}
+			got = append(got, event{stream, line})
+		},
+	})
+	want := []event{{Stdout, "one"}, {Stderr, "warn"}, {Stdout, "two"}, {Stdout, "last"}}
+	if res.ExitCode != 0 || !slices.Equal(got, want) {
+		t.Fatalf("unexpected events %v (exit %d)", got, res.ExitCode)
+	}
+	if res.Stdout != "one\ntwo\nlast" {
+		t.Fatalf("capture should be unaffected, got %q", res.Stdout)
+	}
+}
+
+func TestRunRetriesTransientFailures(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "n")
+	// Fails with "connection reset" on the first two runs, then succeeds.
+	script := `n=$(cat ` + counter + ` 2>/dev/null || echo 0); echo $((n+1)) > ` + counter + `; [ $n -ge 2 ] && echo ok && exit 0; echo "connection reset" >&2; exit 7`
+	policy := RetryPolicy{MaxAttempts: 3, StderrPattern: regexp.MustCompile(`connection reset`), Backoff: time.Millisecond}
+	res := Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", script}, Retry: policy})
+	if res.ExitCode != 0 || res.Attempts != 3 || res.Stdout != "ok" {
+		t.Fatalf("expected success on the third attempt, got %+v", res)
+	}
+
+	// Other failures are not retried, and MaxAttempts caps retries.
+	res = Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", "exit 7"}, Retry: policy})
+	if res.ExitCode != 7 || res.Attempts != 1 {
+		t.Fatalf("expected no retry for an unmatched failure, got %+v", res)
+	}
+	policy.ExitCodes = []int{7}
+	res = Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", "exit 7"}, Retry: policy})
+	if res.ExitCode != 7 || res.Attempts != 3 {
+		t.Fatalf("expected 3 attempts for a retryable exit code, got %+v", res)
+	}
+
+	// Failures are also retried by category.
+	classify := func(stderr string) string {
+		if strings.Contains(stderr, "busy") {
+			return "busy"
+		}
+		return "other"
+	}
+	policy = RetryPolicy{MaxAttempts: 2, Categories: []string{"busy"}, Classify: classify, Backoff: time.Millisecond}
+	res = Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", "echo busy >&2; exit 1"}, Retry: policy})
+	if res.Attempts != 2 {
+		t.Fatalf("expected a retry for a listed category, got %+v", res)
+	}
+	res = Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", "echo bad >&2; exit 1"}, Retry: policy})
+	if res.Attempts != 1 {
+		t.Fatalf("expected no retry for another category, got %+v", res)
+	}
+}
+
+func TestRunRetryBackoff(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	policy := RetryPolicy{MaxAttempts: 5, ExitCodes: []int{7}, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+	res := Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", "exit 7"}, Retry: policy, Clock: clk})
+	if res.Attempts != 5 {
+		t.Fatalf("expected 5 attempts, got %+v", res)
+	}
+	if got, want := clk.Waits(), []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}; !slices.Equal(got, want) {
+		t.Fatalf("backoff %v, want %v", got, want)
+	}
+}
+
+func TestRunReportsExits(t *testing.T) {
+	var states []*os.ProcessState
+	policy := RetryPolicy{MaxAttempts: 2, ExitCodes: []int{3}}
+	Run(context.Background(), Config{BinPath: "/bin/sh", Args: []string{"-c", "exit 3"}, Retry: policy, OnExit: func(ps *os.ProcessState) {
+		states = append(states, ps)
+	}})
+	if len(states) != 2 || states[0].ExitCode() != 3 || states[1].SysUsage() == nil {
+		t.Fatalf("expected two exits with usage, got %v", states)
+	}
+}
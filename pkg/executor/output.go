@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stream names passed to Config.OnOutput.
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// maxLineBytes bounds how much of an unterminated line is buffered before it is
+// emitted as is, so a huge single-line output cannot grow memory without limit.
+const maxLineBytes = 64 * 1024
+
+// OutputFunc receives one line of output, without its newline.
+type OutputFunc func(stream, line string, ts time.Time)
+
+// LinesTo returns an OutputFunc that writes each line, newline restored, to stdout or
+// stderr; either may be nil. It returns nil when both are.
+func LinesTo(stdout, stderr io.Writer) OutputFunc {
+	if stdout == nil && stderr == nil {
+		return nil
+	}
+	return func(stream, line string, _ time.Time) {
+		w := stdout
+		if stream == Stderr {
+			w = stderr
+		}
+		if w != nil {
+			_, _ = io.WriteString(w, line+"\n")
+		}
+	}
+}
+
+// lineEmitter splits the output of both streams into lines for an OutputFunc,
+// serializing calls across streams.
+type lineEmitter struct {
+	fn OutputFunc
+	// pty collapses carriage-return redraws, as collapseCR does for the result.
+	pty bool
+	mu  sync.Mutex
+}
+
+func (e *lineEmitter) writer(stream string) *lineWriter {
+	return &lineWriter{e: e, stream: stream}
+}
+
+func (e *lineEmitter) emit(stream string, line []byte) {
+	s := string(line)
+	if e.pty {
+		s = strings.TrimRight(s, "\r")
+		if i := strings.LastIndexByte(s, '\r'); i >= 0 {
+			s = s[i+1:]
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.fn(stream, s, time.Now())
+}
+
+// lineWriter is the io.Writer for one stream of a lineEmitter.
+type lineWriter struct {
+	e      *lineEmitter
+	stream string
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.e.emit(w.stream, w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxLineBytes {
+		w.e.emit(w.stream, w.buf)
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// flush emits a final line that had no trailing newline.
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.e.emit(w.stream, w.buf)
+		w.buf = nil
+	}
+}
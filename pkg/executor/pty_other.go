@@ -0,0 +1,17 @@
+//go:build !linux
+
+package executor
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, errors.New("pty mode is only supported on linux")
+}
+
+func ptyAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
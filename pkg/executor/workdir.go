@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrWorkDirEscape reports a working directory outside its sandbox root.
+var ErrWorkDirEscape = errors.New("working directory escapes its root")
+
+// ResolveWorkDir creates dir and returns its canonical path, failing unless dir is
+// absolute and, once symlinks are resolved, inside root. An empty root skips the
+// containment check.
+func ResolveWorkDir(root, dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("working directory %q is not absolute", dir)
+	}
+	dir = filepath.Clean(dir)
+	if root != "" && !within(filepath.Clean(root), dir) {
+		return "", fmt.Errorf("%w: %s is outside %s", ErrWorkDirEscape, dir, root)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if root == "" {
+		return resolved, nil
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	if !within(realRoot, resolved) {
+		return "", fmt.Errorf("%w: %s resolves to %s, outside %s", ErrWorkDirEscape, dir, resolved, realRoot)
+	}
+	return resolved, nil
+}
+
+// within reports whether path is root or below it; both must be clean.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,38 @@
+package executor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveWorkDir(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	outside := t.TempDir()
+
+	dir, err := ResolveWorkDir(root, filepath.Join(root, "a", "..", "b"))
+	if err != nil || dir != filepath.Join(root, "b") {
+		t.Fatalf("expected canonical dir under root, got %q (%v)", dir, err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("expected the dir to be created: %v", err)
+	}
+	if _, err := ResolveWorkDir(root, "relative/dir"); err == nil {
+		t.Fatalf("expected a relative dir to be refused")
+	}
+	if _, err := ResolveWorkDir(root, filepath.Join(root, "..", "sibling")); !errors.Is(err, ErrWorkDirEscape) {
+		t.Fatalf("expected ErrWorkDirEscape for a dir outside root, got %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolveWorkDir(root, filepath.Join(root, "link", "x")); !errors.Is(err, ErrWorkDirEscape) {
+		t.Fatalf("expected ErrWorkDirEscape through a symlink, got %v", err)
+	}
+
+	res := Run(t.Context(), Config{BinPath: "true", WorkDir: filepath.Join(root, "link"), WorkRoot: root})
+	if res.ExitCode == 0 {
+		t.Fatalf("expected Run to refuse a dir escaping WorkRoot")
+	}
+}
@@ -0,0 +1,118 @@
+// Package expect checks the post-conditions a request declares for an execution: how
+// mapping entries must have changed once its finalize logic ran. Entries are read
+// before the run and again after confirmation, so an accepted transaction whose
+// finalize silently did nothing, or changed the wrong entry, is caught. It also checks
+// the preconditions that must hold before an execution is attempted at all.
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Expectation is a post-condition on one mapping entry.
+type Expectation struct {
+	// Program defaults to the executed program.
+	Program string `json:"program,omitempty"`
+	Mapping string `json:"mapping"`
+	Key     string `json:"key"`
+	// Delta is the signed change of an integer value, e.g. "+5u64" or "-1u64". An
+	// unset entry counts as zero.
+	Delta string `json:"delta,omitempty"`
+	// Equals is the value expected afterwards; "null" expects the key to be unset.
+	Equals string `json:"equals,omitempty"`
+}
+
+// Diff is the outcome of one expectation. Before and After are nil for unset keys.
+type Diff struct {
+	Program string  `json:"program"`
+	Mapping string  `json:"mapping"`
+	Key     string  `json:"key"`
+	Before  *string `json:"before"`
+	After   *string `json:"after"`
+	Want    string  `json:"want"`
+	OK      bool    `json:"ok"`
+	// Error says why the expectation could not be checked.
+	Error string `json:"error,omitempty"`
+}
+
+var (
+	deltaLiteral   = regexp.MustCompile(`^([+-])([0-9][0-9_]*)([ui](?:8|16|32|64|128))$`)
+	integerLiteral = regexp.MustCompile(`^(-?[0-9][0-9_]*)([ui](?:8|16|32|64|128))$`)
+)
+
+// Validate reports whether e names an entry and declares exactly one of Delta, a
+// signed integer literal, and Equals.
+func (e Expectation) Validate() error {
+	switch {
+	case e.Mapping == "" || e.Key == "":
+		return errors.New("mapping and key are required")
+	case (e.Delta == "") == (e.Equals == ""):
+		return errors.New("exactly one of delta and equals is required")
+	case e.Delta != "" && !deltaLiteral.MatchString(e.Delta):
+		return fmt.Errorf("delta %q must be a signed integer literal such as +5u64", e.Delta)
+	}
+	return nil
+}
+
+// Check compares the entry as read before and after the run against e, which must
+// be valid. Program is reported as given; callers fill in the default.
+func (e Expectation) Check(before, after *string) Diff {
+	d := Diff{Program: e.Program, Mapping: e.Mapping, Key: e.Key, Before: before, After: after}
+	if e.Equals != "" {
+		d.Want = e.Equals
+		if e.Equals == "null" {
+			d.OK = after == nil
+		} else {
+			d.OK = after != nil && compact(*after) == compact(e.Equals)
+		}
+		return d
+	}
+	m := deltaLiteral.FindStringSubmatch(e.Delta)
+	typ := m[3]
+	base := new(big.Int)
+	if before != nil {
+		n, err := parseInteger(*before, typ)
+		if err != nil {
+			d.Error = "before: " + err.Error()
+			return d
+		}
+		base = n
+	}
+	delta, _ := new(big.Int).SetString(strings.ReplaceAll(m[2], "_", ""), 10)
+	if m[1] == "-" {
+		delta.Neg(delta)
+	}
+	want := base.Add(base, delta)
+	d.Want = want.String() + typ
+	if after == nil {
+		return d
+	}
+	got, err := parseInteger(*after, typ)
+	if err != nil {
+		d.Error = "after: " + err.Error()
+		return d
+	}
+	d.OK = got.Cmp(want) == 0
+	return d
+}
+
+// parseInteger reads an integer literal of type typ, e.g. "100u64", as endpoints
+// serve mapping values.
+func parseInteger(v, typ string) (*big.Int, error) {
+	v = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(v), ".public"), ".private")
+	m := integerLiteral.FindStringSubmatch(v)
+	if m == nil || m[2] != typ {
+		return nil, fmt.Errorf("%q is not a %s", v, typ)
+	}
+	n, _ := new(big.Int).SetString(strings.ReplaceAll(m[1], "_", ""), 10)
+	return n, nil
+}
+
+// compact drops the whitespace endpoints put into struct and array values.
+func compact(v string) string {
+	return strings.Join(strings.Fields(v), "")
+}
@@ -0,0 +1,59 @@
+package expect
+
+import "testing"
+
+func ptr(s string) *string { return &s }
+
+func TestValidate(t *testing.T) {
+	for _, e := range []Expectation{
+		{Mapping: "account", Key: "aleo1bob", Delta: "+5u64"},
+		{Mapping: "account", Key: "aleo1bob", Delta: "-1_000i128"},
+		{Mapping: "paused", Key: "true", Equals: "null"},
+	} {
+		if err := e.Validate(); err != nil {
+			t.Fatalf("%+v: %v", e, err)
+		}
+	}
+	for _, e := range []Expectation{
+		{Key: "aleo1bob", Delta: "+5u64"},
+		{Mapping: "account", Key: "aleo1bob"},
+		{Mapping: "account", Key: "aleo1bob", Delta: "+5u64", Equals: "5u64"},
+		{Mapping: "account", Key: "aleo1bob", Delta: "5u64"},
+		{Mapping: "account", Key: "aleo1bob", Delta: "+5field"},
+	} {
+		if err := e.Validate(); err == nil {
+			t.Fatalf("%+v: expected an error", e)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	credit := Expectation{Mapping: "account", Key: "aleo1bob", Delta: "+5u64"}
+	if d := credit.Check(ptr("10u64"), ptr("15u64")); !d.OK || d.Want != "15u64" {
+		t.Fatalf("unexpected %+v", d)
+	}
+	// An unset entry counts as zero.
+	if d := credit.Check(nil, ptr("5u64")); !d.OK {
+		t.Fatalf("unexpected %+v", d)
+	}
+	// A reverted finalize leaves the entry unchanged.
+	if d := credit.Check(ptr("10u64"), ptr("10u64")); d.OK || d.Error != "" {
+		t.Fatalf("unexpected %+v", d)
+	}
+	if d := credit.Check(ptr("10u32"), ptr("15u64")); d.OK || d.Error == "" {
+		t.Fatalf("type mismatch must be reported, got %+v", d)
+	}
+	debit := Expectation{Mapping: "account", Key: "aleo1bob", Delta: "-3i8"}
+	if d := debit.Check(ptr("1i8"), ptr("-2i8")); !d.OK || d.Want != "-2i8" {
+		t.Fatalf("unexpected %+v", d)
+	}
+
+	removed := Expectation{Mapping: "paused", Key: "true", Equals: "null"}
+	if d := removed.Check(ptr("true"), nil); !d.OK {
+		t.Fatalf("unexpected %+v", d)
+	}
+	point := Expectation{Mapping: "points", Key: "1u8", Equals: "{ x: 1u8, y: 2u8 }"}
+	if d := point.Check(nil, ptr("{\n  x: 1u8,\n  y: 2u8\n}")); !d.OK {
+		t.Fatalf("whitespace must not matter, got %+v", d)
+	}
+}
@@ -0,0 +1,104 @@
+package expect
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Condition is a precondition on one mapping entry: the request only runs while it
+// holds, so a transition that would be pointless or rejected by its finalize logic
+// costs neither proving time nor fees.
+type Condition struct {
+	// Program defaults to the executed program.
+	Program string `json:"program,omitempty"`
+	Mapping string `json:"mapping"`
+	Key     string `json:"key"`
+	// Equals is the value the entry must hold; "null" requires the key to be unset.
+	Equals string `json:"equals,omitempty"`
+	// NotEquals is a value the entry must not hold; "null" requires the key to be set.
+	NotEquals string `json:"notEquals,omitempty"`
+	// AtLeast and AtMost bound an integer value, e.g. "100u64". An unset entry counts
+	// as zero.
+	AtLeast string `json:"atLeast,omitempty"`
+	AtMost  string `json:"atMost,omitempty"`
+}
+
+// Outcome is the result of checking one condition. Value is nil for unset keys.
+type Outcome struct {
+	Program string  `json:"program"`
+	Mapping string  `json:"mapping"`
+	Key     string  `json:"key"`
+	Value   *string `json:"value"`
+	Want    string  `json:"want"`
+	OK      bool    `json:"ok"`
+	// Error says why the condition could not be checked.
+	Error string `json:"error,omitempty"`
+}
+
+// Validate reports whether c names an entry and declares exactly one of Equals,
+// NotEquals, AtLeast and AtMost, the latter two integer literals.
+func (c Condition) Validate() error {
+	n := 0
+	for _, v := range []string{c.Equals, c.NotEquals, c.AtLeast, c.AtMost} {
+		if v != "" {
+			n++
+		}
+	}
+	switch {
+	case c.Mapping == "" || c.Key == "":
+		return errors.New("mapping and key are required")
+	case n != 1:
+		return errors.New("exactly one of equals, notEquals, atLeast and atMost is required")
+	case c.AtLeast != "" && !integerLiteral.MatchString(c.AtLeast):
+		return fmt.Errorf("atLeast %q must be an integer literal such as 100u64", c.AtLeast)
+	case c.AtMost != "" && !integerLiteral.MatchString(c.AtMost):
+		return fmt.Errorf("atMost %q must be an integer literal such as 100u64", c.AtMost)
+	}
+	return nil
+}
+
+// Check compares the entry's value, nil when unset, against c, which must be valid.
+// Program is reported as given; callers fill in the default.
+func (c Condition) Check(value *string) Outcome {
+	o := Outcome{Program: c.Program, Mapping: c.Mapping, Key: c.Key, Value: value}
+	switch {
+	case c.Equals != "":
+		o.Want = c.Equals
+		o.OK = matches(value, c.Equals)
+		return o
+	case c.NotEquals != "":
+		o.Want = "not " + c.NotEquals
+		o.OK = !matches(value, c.NotEquals)
+		return o
+	}
+	bound, op := c.AtLeast, ">= "
+	if bound == "" {
+		bound, op = c.AtMost, "<= "
+	}
+	o.Want = op + bound
+	m := integerLiteral.FindStringSubmatch(bound)
+	limit, _ := parseInteger(bound, m[2])
+	got := "0" + m[2]
+	if value != nil {
+		got = *value
+	}
+	n, err := parseInteger(got, m[2])
+	if err != nil {
+		o.Error = err.Error()
+		return o
+	}
+	if c.AtLeast != "" {
+		o.OK = n.Cmp(limit) >= 0
+	} else {
+		o.OK = n.Cmp(limit) <= 0
+	}
+	return o
+}
+
+// matches reports whether value is want, "null" standing for an unset key.
+func matches(value *string, want string) bool {
+	if want == "null" {
+		return value == nil
+	}
+	return value != nil && compact(*value) == compact(want)
+}
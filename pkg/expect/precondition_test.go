@@ -0,0 +1,54 @@
+package expect
+
+import "testing"
+
+func TestConditionValidate(t *testing.T) {
+	for _, c := range []Condition{
+		{Mapping: "paused", Key: "0u8", Equals: "false"},
+		{Mapping: "owner", Key: "0u8", NotEquals: "null"},
+		{Mapping: "account", Key: "aleo1bob", AtLeast: "100u64"},
+		{Mapping: "price", Key: "1field", AtMost: "-5i64"},
+	} {
+		if err := c.Validate(); err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+	}
+	for _, c := range []Condition{
+		{Key: "0u8", Equals: "false"},
+		{Mapping: "paused", Key: "0u8"},
+		{Mapping: "paused", Key: "0u8", Equals: "false", NotEquals: "true"},
+		{Mapping: "account", Key: "aleo1bob", AtLeast: "+100u64"},
+		{Mapping: "account", Key: "aleo1bob", AtMost: "100"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("%+v: expected an error", c)
+		}
+	}
+}
+
+func TestConditionCheck(t *testing.T) {
+	for _, tc := range []struct {
+		c     Condition
+		value *string
+		want  bool
+	}{
+		{Condition{Mapping: "paused", Key: "0u8", Equals: "false"}, ptr("false"), true},
+		{Condition{Mapping: "paused", Key: "0u8", Equals: "false"}, ptr("true"), false},
+		{Condition{Mapping: "paused", Key: "0u8", Equals: "false"}, nil, false},
+		{Condition{Mapping: "paused", Key: "0u8", Equals: "null"}, nil, true},
+		{Condition{Mapping: "owner", Key: "0u8", NotEquals: "null"}, nil, false},
+		{Condition{Mapping: "point", Key: "0u8", Equals: "{x: 1u8, y: 2u8}"}, ptr("{\n  x: 1u8,\n  y: 2u8\n}"), true},
+		{Condition{Mapping: "account", Key: "aleo1bob", AtLeast: "100u64"}, ptr("100u64"), true},
+		{Condition{Mapping: "account", Key: "aleo1bob", AtLeast: "100u64"}, ptr("99u64"), false},
+		{Condition{Mapping: "account", Key: "aleo1bob", AtLeast: "1u64"}, nil, false},
+		{Condition{Mapping: "account", Key: "aleo1bob", AtMost: "1_000u64"}, nil, true},
+	} {
+		if o := tc.c.Check(tc.value); o.OK != tc.want || o.Error != "" {
+			t.Fatalf("%+v with %v: unexpected %+v", tc.c, tc.value, o)
+		}
+	}
+	o := Condition{Mapping: "account", Key: "aleo1bob", AtLeast: "1u64"}.Check(ptr("5u32"))
+	if o.OK || o.Error == "" || o.Want != ">= 1u64" {
+		t.Fatalf("unexpected %+v", o)
+	}
+}
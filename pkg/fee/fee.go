@@ -0,0 +1,85 @@
+// Package fee reads the cost estimate leo prints for an execution that is built but not
+// broadcast, so fees can be quoted before anything is spent.
+package fee
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Microcredits per credit.
+const Microcredits = 1_000_000
+
+// ErrNoEstimate is returned when leo's output carries no cost figures.
+var ErrNoEstimate = errors.New("no cost estimate in leo output")
+
+// Estimate is the cost of one execution in microcredits. Storage and Execution are only
+// known when leo prints a breakdown; Base is always set.
+type Estimate struct {
+	Base      uint64 `json:"baseFee"`
+	Storage   uint64 `json:"storageFee,omitempty"`
+	Execution uint64 `json:"executionFee,omitempty"`
+}
+
+var (
+	// leo 3 prints a "Cost Breakdown (credits)" table.
+	storageLine   = regexp.MustCompile(`(?im)^\W*transaction storage:?\s+([0-9]+(?:\.[0-9]+)?)`)
+	executionLine = regexp.MustCompile(`(?im)^\W*on-chain execution:?\s+([0-9]+(?:\.[0-9]+)?)`)
+	// leo 2 prints a single sentence.
+	baseLine = regexp.MustCompile(`(?i)base execution cost for '?[^\s']+'? is ([0-9]+(?:\.[0-9]+)?) credits`)
+)
+
+// Parse extracts the base fee (storage plus execution) from leo execute output.
+func Parse(output string) (Estimate, error) {
+	var e Estimate
+	s, hasStorage, err := find(storageLine, output)
+	if err != nil {
+		return e, err
+	}
+	x, hasExecution, err := find(executionLine, output)
+	if err != nil {
+		return e, err
+	}
+	if hasStorage || hasExecution {
+		e.Storage, e.Execution, e.Base = s, x, s+x
+		return e, nil
+	}
+	b, ok, err := find(baseLine, output)
+	if err != nil {
+		return e, err
+	}
+	if !ok {
+		return e, ErrNoEstimate
+	}
+	e.Base = b
+	return e, nil
+}
+
+func find(re *regexp.Regexp, output string) (uint64, bool, error) {
+	m := re.FindStringSubmatch(output)
+	if m == nil {
+		return 0, false, nil
+	}
+	v, err := ParseCredits(m[1])
+	return v, true, err
+}
+
+// ParseCredits converts a decimal credits amount such as "0.001234" to microcredits.
+func ParseCredits(s string) (uint64, error) {
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > 6 {
+		return 0, errors.New("credits amount has more than 6 decimals: " + s)
+	}
+	frac += strings.Repeat("0", 6-len(frac))
+	w, err := strconv.ParseUint(whole, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseUint(frac, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return w*Microcredits + f, nil
+}
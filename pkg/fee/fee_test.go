@@ -0,0 +1,42 @@
+package fee
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name   string
+		output string
+		want   Estimate
+	}{
+		{
+			name: "leo 3 breakdown",
+			output: `📊 Execution Summary for token.aleo
+💰 Cost Breakdown (credits)
+  Transaction Storage:  0.001316
+  On-chain Execution:   0.0105
+  Priority Fee:         0.000000
+  Total Fee:            0.011816`,
+			want: Estimate{Base: 11816, Storage: 1316, Execution: 10500},
+		},
+		{
+			name:   "leo 2 sentence",
+			output: "⛓  Constructing transaction...\n✅ Base execution cost for 'token.aleo' is 0.004512 credits.\n",
+			want:   Estimate{Base: 4512},
+		},
+		{name: "whole credits", output: "Base execution cost for token.aleo is 2 credits.", want: Estimate{Base: 2_000_000}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.output)
+			if err != nil || got != tc.want {
+				t.Fatalf("got %+v (%v), want %+v", got, err, tc.want)
+			}
+		})
+	}
+	if _, err := Parse("execute token.aleo/mint"); err != ErrNoEstimate {
+		t.Fatalf("expected ErrNoEstimate, got %v", err)
+	}
+	if _, err := ParseCredits("0.0000001"); err == nil {
+		t.Fatal("expected an error for sub-microcredit precision")
+	}
+}
@@ -0,0 +1,132 @@
+// Package fingerprint reduces leo arguments to a canonical form so that equivalent
+// requests, differing only in flag order, flag spelling or fee formatting, share one
+// identity for caching, auditing and idempotency.
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// aliases maps short and legacy flag spellings to the name used in Canonical.Flags.
+var aliases = map[string]string{
+	"-k":              "--private-key",
+	"-y":              "--yes",
+	"-d":              "--debug",
+	"-q":              "--quiet",
+	"--priority-fees": "--priority-fee",
+}
+
+// ignored flags do not change what a command does: --home only locates leo's cache.
+var ignored = []string{"--home"}
+
+// Canonical is the order-insensitive form of a leo invocation. Inputs keep their order
+// because leo passes them to the function positionally.
+type Canonical struct {
+	Subcommand string   `json:"subcommand"`
+	Program    string   `json:"program,omitempty"`
+	Function   string   `json:"function,omitempty"`
+	Inputs     []string `json:"inputs,omitempty"`
+	Network    string   `json:"network,omitempty"`
+	Fee        string   `json:"fee,omitempty"`
+	// Signer is a digest of the private key, so runs by different keys differ without
+	// the key itself ending up in the fingerprint input.
+	Signer string `json:"signer,omitempty"`
+	// FeePayer is the digest of --fee-private-key, when the fee is paid by another key.
+	FeePayer string `json:"feePayer,omitempty"`
+	// Flags holds every other flag by canonical name; switches map to "".
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+// Normalize returns the canonical form of args.
+func Normalize(args []string) Canonical {
+	var c Canonical
+	toks := utils.Tokenize(args)
+	pos := toks.Positionals()
+	if len(pos) > 0 {
+		c.Subcommand = strings.ToLower(pos[0])
+		pos = pos[1:]
+	}
+	// As in utils.ExtractExecuteContract, the first "program/function" token names the
+	// transition and everything after it is an input.
+	c.Inputs = slices.Clone(pos)
+	for i, p := range pos {
+		if strings.Contains(p, "://") {
+			continue
+		}
+		if j := strings.Index(p, "/"); j > 0 && j < len(p)-1 {
+			c.Program, c.Function = strings.ToLower(p[:j]), strings.ToLower(p[j+1:])
+			c.Inputs = slices.Clone(pos[i+1:])
+			break
+		}
+	}
+
+	for _, tok := range toks {
+		if tok.Kind != utils.Flag {
+			continue
+		}
+		name := tok.Flag
+		if a, ok := aliases[name]; ok {
+			name = a
+		}
+		if slices.Contains(ignored, name) {
+			continue
+		}
+		// Values reports the last occurrence, which is the one leo honours.
+		value := strings.Join(toks.Values(tok.Flag), ",")
+		switch name {
+		case "--network":
+			c.Network = strings.ToLower(value)
+		case "--priority-fee":
+			c.Fee = normalizeFee(value)
+		case "--private-key":
+			c.Signer = keyDigest(value)
+		case "--fee-private-key":
+			c.FeePayer = keyDigest(value)
+		default:
+			if c.Flags == nil {
+				c.Flags = map[string]string{}
+			}
+			c.Flags[name] = value
+		}
+	}
+	return c
+}
+
+// Sum returns the hex SHA-256 of the canonical form.
+func (c Canonical) Sum() string {
+	// Map keys are marshalled in sorted order, so the encoding is deterministic.
+	b, _ := json.Marshal(c)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Of returns the fingerprint of args.
+func Of(args []string) string {
+	return Normalize(args).Sum()
+}
+
+// keyDigest identifies a private key without revealing it.
+func keyDigest(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// normalizeFee drops the u64 suffix and leading zeros from each comma-separated fee.
+func normalizeFee(v string) string {
+	parts := strings.Split(v, ",")
+	for i, p := range parts {
+		p = strings.TrimSuffix(strings.TrimSpace(p), "u64")
+		if n, err := strconv.ParseUint(p, 10, 64); err == nil {
+			p = strconv.FormatUint(n, 10)
+		}
+		parts[i] = p
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,50 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEquivalentRequestsMatch(t *testing.T) {
+	base := "execute token.aleo/mint_public aleo1abc 5u64 --network mainnet --priority-fee 1000 --private-key K1 --broadcast"
+	for _, other := range []string{
+		"--network mainnet execute --broadcast token.aleo/mint_public aleo1abc 5u64 --private-key K1 --priority-fee 1000",
+		"execute Token.aleo/mint_public aleo1abc 5u64 --network=MAINNET --priority-fee 1000u64 -k K1 --broadcast",
+		"execute token.aleo/mint_public aleo1abc 5u64 --network mainnet --priority-fee 01000 --private-key K1 --broadcast --home /tmp/leo/req-2",
+		"execute token.aleo/mint_public aleo1abc 5u64 --network testnet --network mainnet --priority-fee 1000 --private-key K1 --broadcast",
+	} {
+		if Of(strings.Fields(base)) != Of(strings.Fields(other)) {
+			t.Fatalf("%q and %q differ:\n%+v\n%+v", base, other, Normalize(strings.Fields(base)), Normalize(strings.Fields(other)))
+		}
+	}
+}
+
+func TestDistinctRequestsDiffer(t *testing.T) {
+	base := "execute token.aleo/mint_public aleo1abc 5u64 --network mainnet --priority-fee 1000 --private-key K1"
+	for _, other := range []string{
+		"execute token.aleo/mint_public 5u64 aleo1abc --network mainnet --priority-fee 1000 --private-key K1",
+		"execute token.aleo/mint_private aleo1abc 5u64 --network mainnet --priority-fee 1000 --private-key K1",
+		"execute token.aleo/mint_public aleo1abc 5u64 --network testnet --priority-fee 1000 --private-key K1",
+		"execute token.aleo/mint_public aleo1abc 5u64 --network mainnet --priority-fee 2000 --private-key K1",
+		"execute token.aleo/mint_public aleo1abc 5u64 --network mainnet --priority-fee 1000 --private-key K2",
+		"execute token.aleo/mint_public aleo1abc 5u64 --network mainnet --priority-fee 1000 --private-key K1 --broadcast",
+		"run token.aleo/mint_public aleo1abc 5u64 --network mainnet --priority-fee 1000 --private-key K1",
+	} {
+		if Of(strings.Fields(base)) == Of(strings.Fields(other)) {
+			t.Fatalf("%q and %q should differ", base, other)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	c := Normalize(strings.Fields("-d execute x.aleo/f 1u32 --priority-fees 10u64,020 --endpoint https://e --private-key K"))
+	if c.Subcommand != "execute" || c.Program != "x.aleo" || c.Function != "f" || strings.Join(c.Inputs, " ") != "1u32" {
+		t.Fatalf("unexpected %+v", c)
+	}
+	if c.Fee != "10,20" || c.Flags["--debug"] != "" || c.Flags["--endpoint"] != "https://e" || len(c.Flags) != 2 {
+		t.Fatalf("unexpected flags %+v", c)
+	}
+	if strings.Contains(c.Signer, "K") || c.Signer == "" {
+		t.Fatalf("signer should be a digest, got %q", c.Signer)
+	}
+}
@@ -0,0 +1,47 @@
+package hmacauth
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyRotation(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	clients, err := ParseClients(`{"partner": {"primary": "new", "secondary": "old", "secondaryUntil": "2025-03-02T00:00:00Z"}}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	body := []byte(`{"args":["--version"]}`)
+	signed := func(secret string, at time.Time) map[string]string {
+		return map[string]string{
+			"x-leo-client":            "partner",
+			"x-leo-timestamp":         strconv.FormatInt(at.Unix(), 10),
+			"x-leo-request-signature": Sign(secret, at.Unix(), "POST", "/", "", body),
+		}
+	}
+
+	if _, key, err := clients.Verify(signed("new", now), "POST", "/", "", body, now); err != nil || key != KeyPrimary {
+		t.Fatalf("primary: %q %v", key, err)
+	}
+	if client, key, err := clients.Verify(signed("old", now), "POST", "/", "", body, now); err != nil || key != KeySecondary || client != "partner" {
+		t.Fatalf("secondary: %q %v", key, err)
+	}
+	later := now.Add(24 * time.Hour)
+	if _, _, err := clients.Verify(signed("old", later), "POST", "/", "", body, later); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("secondary after the overlap window should fail, got %v", err)
+	}
+	if _, _, err := clients.Verify(signed("new", now), "POST", "/", "", []byte(`{}`), now); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("tampered body should fail, got %v", err)
+	}
+	if _, _, err := clients.Verify(signed("new", now.Add(-10*time.Minute)), "POST", "/", "", body, now); !errors.Is(err, ErrStale) {
+		t.Fatalf("old timestamp should fail, got %v", err)
+	}
+	if _, _, err := clients.Verify(map[string]string{}, "POST", "/", "", body, now); !errors.Is(err, ErrMissing) {
+		t.Fatalf("unsigned request should fail, got %v", err)
+	}
+	if _, err := ParseClients(`{"p": {"primary": "a", "secondary": "b"}}`); err == nil {
+		t.Fatalf("secondary without secondaryUntil should be rejected")
+	}
+}
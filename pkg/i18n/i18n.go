@@ -0,0 +1,160 @@
+// Package i18n holds the catalog of user-facing error messages. Error responses carry a
+// stable code and the params that fill its message, so clients can match on the code
+// and show the message in the caller's language, chosen from Accept-Language, instead
+// of matching on English text.
+package i18n
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Error codes. They are part of the API: never rename one.
+const (
+	Unauthorized        = "unauthorized"
+	InvalidRequest      = "invalid_request"
+	UnsupportedMedia    = "unsupported_media_type"
+	MissingCommand      = "missing_command"
+	CommandNotAllowed   = "command_not_allowed"
+	ActionNotAllowed    = "action_not_allowed"
+	RequestRejected     = "request_rejected"
+	ContractNotAllowed  = "contract_not_allowed"
+	GroupNotAllowed     = "contract_not_allowed_for_groups"
+	MissingContract     = "missing_contract"
+	FeeTooHigh          = "fee_too_high"
+	InvalidInputs       = "invalid_inputs"
+	InvalidExpect       = "invalid_expect"
+	Maintenance         = "maintenance"
+	DuplicateExecute    = "duplicate_execute"
+	InvitationInvalid   = "invitation_invalid"
+	InvitationExpired   = "invitation_expired"
+	InvitationExhausted = "invitation_exhausted"
+	InvitationScope     = "invitation_scope"
+	SignedURLExhausted  = "signed_url_exhausted"
+	EndpointUnavailable = "endpoint_unavailable"
+	NetworkMismatch     = "network_mismatch"
+	ChainValueUnset     = "chain_value_unset"
+	PreconditionFailed  = "precondition_failed"
+	RateLimited         = "rate_limited"
+	SpendLimited        = "spend_limited"
+	ConcurrencyLimited  = "concurrency_limited"
+	BulkheadFull        = "bulkhead_full"
+	ContractQuota       = "contract_quota_exceeded"
+	JobNotFound         = "job_not_found"
+	JobNotResumable     = "job_not_resumable"
+	ServiceUnavailable  = "service_unavailable"
+	InternalError       = "internal_error"
+)
+
+// DefaultLocale is the catalog's complete locale, used when no other matches.
+const DefaultLocale = "en"
+
+// maxAcceptedLanguages bounds how many Accept-Language entries are considered.
+const maxAcceptedLanguages = 16
+
+//go:embed messages.json
+var builtin []byte
+
+// Catalog maps locales, such as "en" or "pt-br", to messages keyed by error code.
+// Messages refer to params as {name}.
+type Catalog map[string]map[string]string
+
+// Default returns the built-in catalog.
+func Default() Catalog {
+	var c Catalog
+	if err := json.Unmarshal(builtin, &c); err != nil {
+		panic(fmt.Sprintf("i18n: invalid built-in catalog: %v", err))
+	}
+	return c
+}
+
+// Parse decodes the ERROR_MESSAGES JSON object, shaped like Catalog, and merges it over
+// the built-in catalog: it may add locales or replace single messages. Codes must be
+// known to the built-in English catalog. An empty string yields the built-in catalog.
+func Parse(raw string) (Catalog, error) {
+	c := Default()
+	if strings.TrimSpace(raw) == "" {
+		return c, nil
+	}
+	var extra Catalog
+	if err := json.Unmarshal([]byte(raw), &extra); err != nil {
+		return nil, fmt.Errorf("invalid ERROR_MESSAGES: %w", err)
+	}
+	for locale, msgs := range extra {
+		locale = strings.ToLower(locale)
+		for code := range msgs {
+			if _, ok := c[DefaultLocale][code]; !ok {
+				return nil, fmt.Errorf("invalid ERROR_MESSAGES: %s: unknown code %q", locale, code)
+			}
+		}
+		if c[locale] == nil {
+			c[locale] = map[string]string{}
+		}
+		maps.Copy(c[locale], msgs)
+	}
+	return c, nil
+}
+
+// Negotiate returns the locale of c that best matches an Accept-Language header, such
+// as "fr-CH, fr;q=0.9, en;q=0.8": the first by quality that c has, either exactly or
+// by its primary language. It falls back to DefaultLocale.
+func (c Catalog) Negotiate(accept string) string {
+	type pref struct {
+		tag string
+		q   float64
+	}
+	var prefs []pref
+	for part := range strings.SplitSeq(accept, ",") {
+		if len(prefs) == maxAcceptedLanguages {
+			break
+		}
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && tag != "*" && q > 0 {
+			prefs = append(prefs, pref{tag, q})
+		}
+	}
+	slices.SortStableFunc(prefs, func(a, b pref) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	for _, p := range prefs {
+		if _, ok := c[p.tag]; ok {
+			return p.tag
+		}
+		if primary, _, _ := strings.Cut(p.tag, "-"); c[primary] != nil {
+			return primary
+		}
+	}
+	return DefaultLocale
+}
+
+// Message renders code's message in locale, falling back to English, with {name}
+// replaced by params[name]. ok is false for codes without a message.
+func (c Catalog) Message(locale, code string, params map[string]string) (msg string, ok bool) {
+	if msg, ok = c[locale][code]; !ok {
+		if msg, ok = c[DefaultLocale][code]; !ok {
+			return "", false
+		}
+	}
+	pairs := make([]string, 0, 2*len(params))
+	for name, v := range params {
+		pairs = append(pairs, "{"+name+"}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(msg), true
+}
@@ -0,0 +1,79 @@
+package i18n
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+var codes = []string{
+	Unauthorized, InvalidRequest, UnsupportedMedia, MissingCommand, CommandNotAllowed, ActionNotAllowed,
+	RequestRejected, ContractNotAllowed, GroupNotAllowed, MissingContract, FeeTooHigh, InvalidInputs,
+	InvalidExpect, Maintenance, DuplicateExecute, InvitationInvalid, InvitationExpired, InvitationExhausted,
+	InvitationScope, SignedURLExhausted, EndpointUnavailable, NetworkMismatch, ChainValueUnset, PreconditionFailed, RateLimited, SpendLimited,
+	ConcurrencyLimited, BulkheadFull, ContractQuota, JobNotFound, JobNotResumable, ServiceUnavailable, InternalError,
+}
+
+func TestBuiltinCatalogIsComplete(t *testing.T) {
+	c := Default()
+	want := slices.Sorted(slices.Values(codes))
+	for locale, msgs := range c {
+		if got := slices.Sorted(maps.Keys(msgs)); !slices.Equal(got, want) {
+			t.Fatalf("%s: codes %v, want %v", locale, got, want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	c := Default()
+	for accept, want := range map[string]string{
+		"":                        "en",
+		"de-CH, fr;q=0.9":         "de",
+		"it, fr;q=0.5, de;q=0.7":  "de",
+		"pt-BR":                   "en",
+		"*, es;q=0.1":             "es",
+		"es;q=0, fr;q=0.2":        "fr",
+		"FR":                      "fr",
+		"en-US,en;q=0.9,es;q=0.8": "en",
+		"fr;q=garbage, de;q=0.5":  "fr",
+	} {
+		if got := c.Negotiate(accept); got != want {
+			t.Fatalf("%q: got %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	c := Default()
+	msg, ok := c.Message("es", ContractNotAllowed, map[string]string{"contract": "token.aleo"})
+	if !ok || msg != "El programa token.aleo no está permitido." {
+		t.Fatalf("got %q", msg)
+	}
+	// Params are substituted once, even when they look like placeholders.
+	if msg, _ := c.Message("en", FeeTooHigh, map[string]string{"fee": "{max}", "max": "5"}); msg != "The priority fee {max} exceeds the maximum of 5." {
+		t.Fatalf("got %q", msg)
+	}
+	if _, ok := c.Message("en", "no_such_code", nil); ok {
+		t.Fatal("unknown code rendered")
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse(`{"pt-BR": {"contract_not_allowed": "O programa {contract} não é permitido."}, "en": {"rate_limited": "Slow down."}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Negotiate("pt-br"); got != "pt-br" {
+		t.Fatalf("added locale not negotiated: %q", got)
+	}
+	// Missing messages fall back to English.
+	if msg, _ := c.Message("pt-br", JobNotFound, map[string]string{"job": "j1"}); msg != "The job j1 was not found." {
+		t.Fatalf("got %q", msg)
+	}
+	if msg, _ := c.Message("en", RateLimited, nil); msg != "Slow down." {
+		t.Fatalf("override ignored: %q", msg)
+	}
+	if _, err := Parse(`{"pt": {"contract_not_alowed": "x"}}`); err == nil {
+		t.Fatal("expected an error for an unknown code")
+	}
+}
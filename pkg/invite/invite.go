@@ -0,0 +1,198 @@
+// Package invite issues short-lived invitation tokens that let a partner run one
+// specific transition a limited number of times without long-lived credentials.
+// Only a hash of each token is stored, and every use is counted atomically.
+package invite
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// Header carries the token on a request.
+const Header = "X-Leo-Invitation"
+
+// Prefix starts every token, which makes leaked tokens easy to scan for.
+const Prefix = "leoinv_"
+
+// Errors returned by Consume.
+var (
+	ErrInvalid   = errors.New("invitation token is invalid or revoked")
+	ErrExpired   = errors.New("invitation token has expired")
+	ErrExhausted = errors.New("invitation token has no uses left")
+	ErrScope     = errors.New("invitation token does not cover this transition")
+)
+
+// Invitation is the stored state of one token.
+type Invitation struct {
+	ID        string    `json:"id"`
+	Contract  string    `json:"contract"`
+	Method    string    `json:"method"`
+	MaxUses   int       `json:"maxUses"`
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Label     string    `json:"label,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+}
+
+// Store persists invitations.
+type Store interface {
+	// Mint stores inv under a new token and returns the token.
+	Mint(ctx context.Context, inv Invitation) (string, Invitation, error)
+	// Consume records one use of token for contract/method.
+	Consume(ctx context.Context, token, contract, method string) (Invitation, error)
+	// Revoke deletes the invitation with id.
+	Revoke(ctx context.Context, id string) error
+}
+
+// ID returns the stored identifier of token: its SHA-256.
+func ID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken returns a random token.
+func NewToken() string {
+	var b [32]byte
+	_, _ = rand.Read(b[:])
+	return Prefix + base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// DynamoStore keeps invitations in a DynamoDB table with string partition key "id".
+// Enable TTL on the expiresAt attribute to have expired items removed.
+type DynamoStore struct {
+	client *awsapi.Client
+	table  string
+	now    func() time.Time
+}
+
+// NewDynamoStore returns a store backed by table.
+func NewDynamoStore(client *awsapi.Client, table string) (*DynamoStore, error) {
+	if table == "" {
+		return nil, errors.New("invitation table name is required")
+	}
+	return &DynamoStore{client: client, table: table, now: time.Now}, nil
+}
+
+type attr map[string]string
+
+func s(v string) attr { return attr{"S": v} }
+func n(v int64) attr  { return attr{"N": strconv.FormatInt(v, 10)} }
+
+// Mint implements Store.
+func (d *DynamoStore) Mint(ctx context.Context, inv Invitation) (string, Invitation, error) {
+	token := NewToken()
+	inv.ID, inv.Uses = ID(token), 0
+	item := map[string]attr{
+		"id":        s(inv.ID),
+		"contract":  s(inv.Contract),
+		"method":    s(inv.Method),
+		"maxUses":   n(int64(inv.MaxUses)),
+		"uses":      n(0),
+		"expiresAt": n(inv.ExpiresAt.Unix()),
+		"createdAt": n(d.now().Unix()),
+	}
+	if inv.Label != "" {
+		item["label"] = s(inv.Label)
+	}
+	if inv.CreatedBy != "" {
+		item["createdBy"] = s(inv.CreatedBy)
+	}
+	in := map[string]any{"TableName": d.table, "Item": item, "ConditionExpression": "attribute_not_exists(id)"}
+	if err := d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.PutItem", in, nil); err != nil {
+		return "", Invitation{}, fmt.Errorf("mint invitation: %w", err)
+	}
+	return token, inv, nil
+}
+
+// Consume implements Store. The use is counted only if the token exists, is unexpired,
+// has uses left and covers contract/method, all in one conditional update.
+func (d *DynamoStore) Consume(ctx context.Context, token, contract, method string) (Invitation, error) {
+	if !strings.HasPrefix(token, Prefix) {
+		return Invitation{}, ErrInvalid
+	}
+	now := d.now()
+	in := map[string]any{
+		"TableName":           d.table,
+		"Key":                 map[string]attr{"id": s(ID(token))},
+		"UpdateExpression":    "ADD #uses :one",
+		"ConditionExpression": "attribute_exists(id) AND #uses < #max AND #exp > :now AND #contract = :contract AND #method = :method",
+		"ExpressionAttributeNames": map[string]string{
+			"#uses": "uses", "#max": "maxUses", "#exp": "expiresAt", "#contract": "contract", "#method": "method",
+		},
+		"ExpressionAttributeValues": map[string]attr{
+			":one": n(1), ":now": n(now.Unix()), ":contract": s(contract), ":method": s(method),
+		},
+		"ReturnValues": "ALL_NEW",
+	}
+	var out struct {
+		Attributes map[string]attr
+	}
+	err := d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.UpdateItem", in, &out)
+	var apiErr *awsapi.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == "ConditionalCheckFailedException" {
+		return Invitation{}, d.diagnose(ctx, ID(token), contract, method, now)
+	}
+	if err != nil {
+		return Invitation{}, fmt.Errorf("consume invitation: %w", err)
+	}
+	return decode(out.Attributes), nil
+}
+
+// diagnose explains why a conditional update failed.
+func (d *DynamoStore) diagnose(ctx context.Context, id, contract, method string, now time.Time) error {
+	var out struct {
+		Item map[string]attr
+	}
+	in := map[string]any{"TableName": d.table, "Key": map[string]attr{"id": s(id)}, "ConsistentRead": true}
+	if err := d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.GetItem", in, &out); err != nil {
+		return fmt.Errorf("consume invitation: %w", err)
+	}
+	if out.Item == nil {
+		return ErrInvalid
+	}
+	inv := decode(out.Item)
+	switch {
+	case !now.Before(inv.ExpiresAt):
+		return ErrExpired
+	case inv.Contract != contract || inv.Method != method:
+		return ErrScope
+	default:
+		return ErrExhausted
+	}
+}
+
+// Revoke implements Store.
+func (d *DynamoStore) Revoke(ctx context.Context, id string) error {
+	in := map[string]any{"TableName": d.table, "Key": map[string]attr{"id": s(id)}}
+	if err := d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.DeleteItem", in, nil); err != nil {
+		return fmt.Errorf("revoke invitation: %w", err)
+	}
+	return nil
+}
+
+func decode(item map[string]attr) Invitation {
+	num := func(k string) int64 {
+		v, _ := strconv.ParseInt(item[k]["N"], 10, 64)
+		return v
+	}
+	return Invitation{
+		ID:        item["id"]["S"],
+		Contract:  item["contract"]["S"],
+		Method:    item["method"]["S"],
+		MaxUses:   int(num("maxUses")),
+		Uses:      int(num("uses")),
+		ExpiresAt: time.Unix(num("expiresAt"), 0).UTC(),
+		Label:     item["label"]["S"],
+		CreatedBy: item["createdBy"]["S"],
+	}
+}
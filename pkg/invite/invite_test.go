@@ -0,0 +1,99 @@
+package invite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// fakeDynamo serves PutItem/UpdateItem/GetItem/DeleteItem from memory, evaluating the
+// Consume condition directly.
+func fakeDynamo(t *testing.T) *httptest.Server {
+	items := map[string]map[string]attr{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Item                      map[string]attr
+			Key                       map[string]attr
+			ExpressionAttributeValues map[string]attr
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		num := func(a attr) int64 { v, _ := strconv.ParseInt(a["N"], 10, 64); return v }
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.PutItem":
+			items[in.Item["id"]["S"]] = in.Item
+			_, _ = w.Write([]byte(`{}`))
+		case "DynamoDB_20120810.UpdateItem":
+			it, v := items[in.Key["id"]["S"]], in.ExpressionAttributeValues
+			if it == nil || num(it["uses"]) >= num(it["maxUses"]) || num(it["expiresAt"]) <= num(v[":now"]) ||
+				it["contract"]["S"] != v[":contract"]["S"] || it["method"]["S"] != v[":method"]["S"] {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`))
+				return
+			}
+			it["uses"] = n(num(it["uses"]) + 1)
+			_ = json.NewEncoder(w).Encode(map[string]any{"Attributes": it})
+		case "DynamoDB_20120810.GetItem":
+			_ = json.NewEncoder(w).Encode(map[string]any{"Item": items[in.Key["id"]["S"]]})
+		case "DynamoDB_20120810.DeleteItem":
+			delete(items, in.Key["id"]["S"])
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+	}))
+}
+
+func TestDynamoStoreConsume(t *testing.T) {
+	srv := fakeDynamo(t)
+	defer srv.Close()
+	client := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	s, err := NewDynamoStore(client, "invites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	token, inv, err := s.Mint(ctx, Invitation{Contract: "token.aleo", Method: "mint_public", MaxUses: 2, ExpiresAt: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	if inv.ID != ID(token) || len(token) <= len(Prefix) {
+		t.Fatalf("unexpected token %q for %+v", token, inv)
+	}
+	if _, err := s.Consume(ctx, token, "token.aleo", "transfer_public"); !errors.Is(err, ErrScope) {
+		t.Fatalf("expected ErrScope for another method, got %v", err)
+	}
+	for i := 1; i <= 2; i++ {
+		got, err := s.Consume(ctx, token, "token.aleo", "mint_public")
+		if err != nil || got.Uses != i {
+			t.Fatalf("use %d: %+v (%v)", i, got, err)
+		}
+	}
+	if _, err := s.Consume(ctx, token, "token.aleo", "mint_public"); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected ErrExhausted, got %v", err)
+	}
+
+	token, inv, _ = s.Mint(ctx, Invitation{Contract: "token.aleo", Method: "mint_public", MaxUses: 1, ExpiresAt: now.Add(time.Minute)})
+	now = now.Add(2 * time.Minute)
+	if _, err := s.Consume(ctx, token, "token.aleo", "mint_public"); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if err := s.Revoke(ctx, inv.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := s.Consume(ctx, token, "token.aleo", "mint_public"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid after revoke, got %v", err)
+	}
+	if _, err := s.Consume(ctx, "not-a-token", "token.aleo", "mint_public"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected ErrInvalid for a malformed token, got %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+// Package jobs keeps an in-memory registry of runs that outlived the caller's wait
+// budget. Jobs live only as long as the container that started them. With a
+// concurrency limit, extra jobs queue and report their position and an ETA derived
+// from recent durations of the same kind of run.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/tags"
+)
+
+// Status is the lifecycle state of a job.
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+)
+
+// partialOutputBytes bounds the output kept per stream while a job is running.
+const partialOutputBytes = 64 * 1024
+
+// statsWindow is the number of recent durations averaged per key.
+const statsWindow = 20
+
+// Job is a point-in-time view of a run.
+type Job struct {
+	ID         string            `json:"jobId"`
+	Status     Status            `json:"status"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	StartedAt  *time.Time        `json:"startedAt,omitempty"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+	// QueuePosition is 1 for the next job to start; it is only set while queued.
+	QueuePosition int `json:"queuePosition,omitempty"`
+	// EstimatedStartAt and EstimatedFinishAt are derived from recent durations of the
+	// same key and are omitted until there is history to go by.
+	EstimatedStartAt  *time.Time `json:"estimatedStartAt,omitempty"`
+	EstimatedFinishAt *time.Time `json:"estimatedFinishAt,omitempty"`
+	// Stdout and Stderr hold the tail of the output produced so far; once the job is
+	// done the complete output is in Result.
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	Result any    `json:"result,omitempty"`
+}
+
+// idKey carries the job ID in the context a Func runs with.
+type idKey struct{}
+
+// ID returns the ID of the job running with ctx, or "" outside a job.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Func performs the work of a job, writing progress to stdout and stderr, and returns
+// the JSON-serialisable result.
+type Func func(ctx context.Context, stdout, stderr io.Writer) any
+
+// Spec describes who a job belongs to and how it is grouped.
+type Spec struct {
+	// ID, if set, is used instead of a fresh one, e.g. to resume work persisted under it.
+	ID    string
+	Owner string
+	// Key groups jobs for duration estimates, e.g. the contract.
+	Key string
+	// Tags are client-supplied labels used to find the job later.
+	Tags map[string]string
+	// OnFinish, if set, receives the finished job, e.g. to persist it beyond this
+	// container.
+	OnFinish func(Job)
+}
+
+type entry struct {
+	owner    string
+	key      string
+	tags     map[string]string
+	created  time.Time
+	started  time.Time
+	finished time.Time
+	stdout   *tail
+	stderr   *tail
+	result   any
+	done     chan struct{}
+
+	ctx      context.Context
+	fn       Func
+	id       string
+	onFinish func(Job)
+}
+
+// Registry tracks jobs by ID.
+type Registry struct {
+	mu        sync.Mutex
+	jobs      map[string]*entry
+	retention time.Duration
+	limit     int
+	running   int
+	queue     []string
+	durations map[string][]time.Duration
+	now       func() time.Time
+}
+
+// New returns a registry that forgets finished jobs after retention.
+func New(retention time.Duration) *Registry {
+	return &Registry{jobs: map[string]*entry{}, retention: retention, durations: map[string][]time.Duration{}, now: time.Now}
+}
+
+// SetConcurrency caps how many jobs run at once; further jobs queue. n <= 0 means
+// no limit. Raising the limit starts queued jobs immediately.
+func (r *Registry) SetConcurrency(n int) {
+	r.mu.Lock()
+	r.limit = n
+	r.dispatch()
+	r.mu.Unlock()
+}
+
+// Observe records how long a run of key (e.g. a contract) took. Estimates average the
+// most recent observations per key.
+func (r *Registry) Observe(key string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ds := append(r.durations[key], d)
+	if len(ds) > statsWindow {
+		ds = ds[len(ds)-statsWindow:]
+	}
+	r.durations[key] = ds
+}
+
+// Start runs fn in the background on behalf of spec.Owner, or queues it when the
+// concurrency limit is reached, and returns the job ID. fn receives ctx, which must
+// not be tied to the lifetime of the calling request.
+func (r *Registry) Start(ctx context.Context, spec Spec, fn Func) string {
+	id := spec.ID
+	if id == "" {
+		id = newID()
+	}
+	e := &entry{
+		owner:   spec.Owner,
+		key:     spec.Key,
+		tags:    spec.Tags,
+		created: r.now(),
+		stdout:  &tail{limit: partialOutputBytes},
+		stderr:  &tail{limit: partialOutputBytes},
+		done:    make(chan struct{}),
+		ctx:     context.WithValue(ctx, idKey{}, id),
+		fn:      fn,
+
+		id:       id,
+		onFinish: spec.OnFinish,
+	}
+	r.mu.Lock()
+	r.prune()
+	r.jobs[id] = e
+	r.queue = append(r.queue, id)
+	r.dispatch()
+	r.mu.Unlock()
+	return id
+}
+
+// dispatch starts queued jobs while slots are free. r.mu must be held.
+func (r *Registry) dispatch() {
+	for len(r.queue) > 0 && (r.limit <= 0 || r.running < r.limit) {
+		id := r.queue[0]
+		r.queue = r.queue[1:]
+		e, ok := r.jobs[id]
+		if !ok {
+			continue
+		}
+		r.running++
+		e.started = r.now()
+		go r.run(e)
+	}
+}
+
+func (r *Registry) run(e *entry) {
+	res := e.fn(e.ctx, e.stdout, e.stderr)
+	r.mu.Lock()
+	e.result = res
+	e.finished = r.now()
+	e.ctx, e.fn = nil, nil
+	r.running--
+	r.dispatch()
+	j := r.view(e.id, e)
+	r.mu.Unlock()
+	if e.onFinish != nil {
+		e.onFinish(j)
+	}
+	close(e.done)
+}
+
+// Wait blocks until the job finishes, d elapses or ctx is done, and returns the
+// job's current state.
+func (r *Registry) Wait(ctx context.Context, id string, d time.Duration) (Job, bool) {
+	r.mu.Lock()
+	e, ok := r.jobs[id]
+	r.mu.Unlock()
+	if !ok {
+		return Job{}, false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-e.done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return r.Get(id, e.owner)
+}
+
+// Get returns the job if it exists and belongs to owner.
+func (r *Registry) Get(id, owner string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.jobs[id]
+	if !ok || e.owner != owner {
+		return Job{}, false
+	}
+	return r.view(id, e), true
+}
+
+// Lookup returns the job whoever owns it, for admin tooling.
+func (r *Registry) Lookup(id string) (Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return r.view(id, e), true
+}
+
+// List returns owner's jobs carrying all of the want tags, newest first, without
+// output or results.
+func (r *Registry) List(owner string, want map[string]string) []Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := []Job{}
+	for id, e := range r.jobs {
+		if e.owner != owner || !tags.Match(e.tags, want) {
+			continue
+		}
+		j := r.view(id, e)
+		j.Stdout, j.Stderr, j.Result = "", "", nil
+		out = append(out, j)
+	}
+	slices.SortFunc(out, func(a, b Job) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return out
+}
+
+// view renders e. r.mu must be held.
+func (r *Registry) view(id string, e *entry) Job {
+	j := Job{ID: id, Status: StatusQueued, Tags: e.tags, CreatedAt: e.created.UTC()}
+	if !e.started.IsZero() {
+		s := e.started.UTC()
+		j.Status, j.StartedAt = StatusRunning, &s
+	}
+	if !e.finished.IsZero() {
+		f := e.finished.UTC()
+		j.Status = StatusDone
+		j.FinishedAt = &f
+		j.Result = e.result
+		return j
+	}
+	if j.Status == StatusQueued {
+		j.QueuePosition = slices.Index(r.queue, id) + 1
+	}
+	if start, finish, ok := r.estimate(id); ok {
+		if j.Status == StatusQueued {
+			j.EstimatedStartAt = &start
+		}
+		j.EstimatedFinishAt = &finish
+	}
+	j.Stdout = e.stdout.String()
+	j.Stderr = e.stderr.String()
+	return j
+}
+
+// expected returns the mean recent duration for key, falling back to all keys.
+// r.mu must be held.
+func (r *Registry) expected(key string) (time.Duration, bool) {
+	ds := r.durations[key]
+	if len(ds) == 0 {
+		for _, all := range r.durations {
+			ds = append(ds, all...)
+		}
+	}
+	if len(ds) == 0 {
+		return 0, false
+	}
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+	return sum / time.Duration(len(ds)), true
+}
+
+// estimate simulates the running jobs and the queue ahead of id over the available
+// slots and returns id's expected start and finish. r.mu must be held.
+func (r *Registry) estimate(id string) (start, finish time.Time, ok bool) {
+	now := r.now()
+	target := r.jobs[id]
+	own, ok := r.expected(target.key)
+	if !ok {
+		return start, finish, false
+	}
+	if !target.started.IsZero() {
+		return now, now.Add(max(own-now.Sub(target.started), 0)).UTC(), true
+	}
+	// free holds, per slot, how long from now until it frees up.
+	var free []time.Duration
+	for _, e := range r.jobs {
+		if e.started.IsZero() || !e.finished.IsZero() {
+			continue
+		}
+		d, _ := r.expected(e.key)
+		free = append(free, max(d-now.Sub(e.started), 0))
+	}
+	for r.limit > len(free) {
+		free = append(free, 0)
+	}
+	if len(free) == 0 {
+		free = append(free, 0)
+	}
+	for _, qid := range r.queue {
+		i := slices.Index(free, slices.Min(free))
+		if qid == id {
+			return now.Add(free[i]).UTC(), now.Add(free[i] + own).UTC(), true
+		}
+		d, _ := r.expected(r.jobs[qid].key)
+		free[i] += d
+	}
+	return start, finish, false
+}
+
+// Forget removes a job, typically once its result has been delivered synchronously.
+func (r *Registry) Forget(id string) {
+	r.mu.Lock()
+	delete(r.jobs, id)
+	r.mu.Unlock()
+}
+
+// Purge forgets the finished jobs of any owner that carry all of the want tags and
+// returns their IDs, or with dryRun only finds them. Unfinished jobs are left alone.
+func (r *Registry) Purge(want map[string]string, dryRun bool) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []string
+	for id, e := range r.jobs {
+		if !e.finished.IsZero() && tags.Match(e.tags, want) {
+			if !dryRun {
+				delete(r.jobs, id)
+			}
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// prune drops finished jobs older than the retention window. r.mu must be held.
+func (r *Registry) prune() {
+	if r.retention <= 0 {
+		return
+	}
+	cutoff := r.now().Add(-r.retention)
+	for id, e := range r.jobs {
+		if !e.finished.IsZero() && e.finished.Before(cutoff) {
+			delete(r.jobs, id)
+		}
+	}
+}
+
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// tail is a concurrency-safe writer keeping the last limit bytes.
+type tail struct {
+	mu    sync.Mutex
+	buf   []byte
+	limit int
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.limit; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
@@ -0,0 +1,187 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWaitReturnsPartialOutputThenResult(t *testing.T) {
+	r := New(time.Hour)
+	release := make(chan struct{})
+	id := r.Start(context.Background(), Spec{Owner: "alice", Key: "token.aleo"}, func(ctx context.Context, stdout, stderr io.Writer) any {
+		fmt.Fprint(stdout, "proving...")
+		<-release
+		return "ok"
+	})
+
+	j, ok := r.Wait(context.Background(), id, 50*time.Millisecond)
+	if !ok || j.Status != StatusRunning {
+		t.Fatalf("expected running job, got %+v (found=%v)", j, ok)
+	}
+	if j.Stdout != "proving..." {
+		t.Fatalf("expected partial stdout, got %q", j.Stdout)
+	}
+	if _, ok := r.Get(id, "mallory"); ok {
+		t.Fatalf("jobs must not be visible to other callers")
+	}
+
+	close(release)
+	j, _ = r.Wait(context.Background(), id, time.Second)
+	if j.Status != StatusDone || j.Result != "ok" || j.FinishedAt == nil || j.Stdout != "" {
+		t.Fatalf("unexpected finished job: %+v", j)
+	}
+}
+
+func TestPruneDropsExpiredJobs(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := New(time.Minute)
+	r.now = func() time.Time { return now }
+	id := r.Start(context.Background(), Spec{Owner: "a"}, func(context.Context, io.Writer, io.Writer) any { return nil })
+	if j, _ := r.Wait(context.Background(), id, time.Second); j.Status != StatusDone {
+		t.Fatalf("job did not finish: %+v", j)
+	}
+
+	now = now.Add(2 * time.Minute)
+	r.Start(context.Background(), Spec{Owner: "a"}, func(context.Context, io.Writer, io.Writer) any { return nil })
+	if _, ok := r.Get(id, "a"); ok {
+		t.Fatalf("expired job should have been pruned")
+	}
+}
+
+func TestTailKeepsLastBytes(t *testing.T) {
+	tl := &tail{limit: 4}
+	fmt.Fprint(tl, "abc")
+	fmt.Fprint(tl, "def")
+	if got := tl.String(); got != "cdef" {
+		t.Fatalf("expected cdef, got %q", got)
+	}
+}
+
+func TestQueuePositionAndETA(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := New(time.Hour)
+	r.now = func() time.Time { return now }
+	r.SetConcurrency(1)
+	r.Observe("token.aleo", 10*time.Second)
+	r.Observe("token.aleo", 30*time.Second)
+
+	release := make(chan struct{})
+	block := func(context.Context, io.Writer, io.Writer) any { <-release; return nil }
+	first := r.Start(context.Background(), Spec{Owner: "a", Key: "token.aleo"}, block)
+	second := r.Start(context.Background(), Spec{Owner: "a", Key: "token.aleo"}, block)
+	third := r.Start(context.Background(), Spec{Owner: "a", Key: "other.aleo"}, block)
+	now = now.Add(5 * time.Second)
+
+	j, _ := r.Get(first, "a")
+	if j.Status != StatusRunning || !j.EstimatedFinishAt.Equal(now.Add(15*time.Second)) {
+		t.Fatalf("unexpected running job %+v", j)
+	}
+	j, _ = r.Get(second, "a")
+	if j.Status != StatusQueued || j.QueuePosition != 1 || !j.EstimatedStartAt.Equal(now.Add(15*time.Second)) {
+		t.Fatalf("unexpected first queued job %+v", j)
+	}
+	// other.aleo has no history of its own and falls back to the overall mean.
+	j, _ = r.Get(third, "a")
+	if j.QueuePosition != 2 || !j.EstimatedStartAt.Equal(now.Add(35*time.Second)) || !j.EstimatedFinishAt.Equal(now.Add(55*time.Second)) {
+		t.Fatalf("unexpected second queued job %+v", j)
+	}
+
+	close(release)
+	for _, id := range []string{first, second, third} {
+		if j, _ := r.Wait(context.Background(), id, time.Second); j.Status != StatusDone {
+			t.Fatalf("job %s did not finish: %+v", id, j)
+		}
+	}
+}
+
+func TestListFiltersByOwnerAndTags(t *testing.T) {
+	r := New(time.Hour)
+	noop := func(context.Context, io.Writer, io.Writer) any { return "ok" }
+	order := r.Start(context.Background(), Spec{Owner: "a", Tags: map[string]string{"order": "42", "env": "prod"}}, noop)
+	r.Start(context.Background(), Spec{Owner: "a", Tags: map[string]string{"order": "43"}}, noop)
+	r.Start(context.Background(), Spec{Owner: "b", Tags: map[string]string{"order": "42"}}, noop)
+
+	if got := r.List("a", nil); len(got) != 2 {
+		t.Fatalf("expected 2 jobs for a, got %+v", got)
+	}
+	got := r.List("a", map[string]string{"order": "42"})
+	if len(got) != 1 || got[0].ID != order || got[0].Tags["env"] != "prod" {
+		t.Fatalf("unexpected filtered jobs: %+v", got)
+	}
+	if got[0].Result != nil {
+		t.Fatalf("listings must not carry results")
+	}
+	if _, ok := r.Get(order, "b"); ok {
+		t.Fatal("Get returned another owner's job")
+	}
+	if j, ok := r.Lookup(order); !ok || j.ID != order {
+		t.Fatalf("Lookup did not find the job: %+v", j)
+	}
+}
+
+func TestOnFinishReceivesFinishedJob(t *testing.T) {
+	r := New(time.Hour)
+	finished := make(chan Job, 1)
+	id := r.Start(context.Background(), Spec{Owner: "alice", OnFinish: func(j Job) { finished <- j }}, func(context.Context, io.Writer, io.Writer) any {
+		return "ok"
+	})
+	j := <-finished
+	if j.ID != id || j.Status != StatusDone || j.Result != "ok" {
+		t.Fatalf("unexpected finished job %+v", j)
+	}
+}
+
+func TestStartWithGivenID(t *testing.T) {
+	r := New(time.Hour)
+	id := r.Start(context.Background(), Spec{ID: "saga-1", Owner: "alice"}, func(ctx context.Context, _, _ io.Writer) any {
+		return ID(ctx)
+	})
+	if j, ok := r.Wait(context.Background(), "saga-1", time.Second); id != "saga-1" || !ok || j.Result != "saga-1" {
+		t.Fatalf("unexpected job %q: %+v", id, j)
+	}
+}
+
+func TestPurgeForgetsFinishedTaggedJobs(t *testing.T) {
+	r := New(time.Hour)
+	release := make(chan struct{})
+	ids := make(chan string, 1)
+	done := r.Start(context.Background(), Spec{Owner: "a", Tags: map[string]string{"customer": "acme"}}, func(ctx context.Context, _, _ io.Writer) any {
+		ids <- ID(ctx)
+		return "ok"
+	})
+	if got := <-ids; got != done {
+		t.Fatalf("job ran with ID %q, want %q", got, done)
+	}
+	r.Wait(context.Background(), done, time.Second)
+	running := r.Start(context.Background(), Spec{Owner: "b", Tags: map[string]string{"customer": "acme"}}, func(context.Context, io.Writer, io.Writer) any {
+		<-release
+		return "ok"
+	})
+	defer close(release)
+	other := r.Start(context.Background(), Spec{Owner: "a", Tags: map[string]string{"customer": "other"}}, func(context.Context, io.Writer, io.Writer) any { return "ok" })
+	r.Wait(context.Background(), other, time.Second)
+
+	if got := r.Purge(map[string]string{"customer": "acme"}, true); len(got) != 1 || got[0] != done {
+		t.Fatalf("dry run found %v, want [%s]", got, done)
+	}
+	if _, ok := r.Lookup(done); !ok {
+		t.Fatal("dry run forgot the job")
+	}
+	if got := r.Purge(map[string]string{"customer": "acme"}, false); len(got) != 1 || got[0] != done {
+		t.Fatalf("purged %v, want [%s]", got, done)
+	}
+	if _, ok := r.Lookup(done); ok {
+		t.Fatal("purged job is still registered")
+	}
+	for _, id := range []string{running, other} {
+		if _, ok := r.Lookup(id); !ok {
+			t.Fatalf("job %s should have been kept", id)
+		}
+	}
+	if ID(context.Background()) != "" {
+		t.Fatal("ID outside a job")
+	}
+}
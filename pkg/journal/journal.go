@@ -0,0 +1,438 @@
+// Package journal persists a per-invocation record of each run to disk (typically an
+// EFS mount) at a few sync points, so containers that are OOM-killed or time out still
+// leave behind what they were doing.
+package journal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/tags"
+)
+
+// Status values recorded in an Entry.
+const (
+	StatusRunning  = "running"
+	StatusFinished = "finished"
+	// StatusAbandoned is reported for entries still marked running that were written by
+	// another container, which most likely died mid-run.
+	StatusAbandoned = "abandoned"
+)
+
+// Phase is a timestamped step of an invocation.
+type Phase struct {
+	Name string    `json:"name"`
+	At   time.Time `json:"at"`
+}
+
+// Entry is the persisted journal of one invocation.
+type Entry struct {
+	ID        string            `json:"id"`
+	Container string            `json:"container"`
+	Caller    string            `json:"caller,omitempty"`
+	AuthKey   string            `json:"authKey,omitempty"` // HMAC secret that matched: primary or secondary
+	Args      []string          `json:"args"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	PID       int               `json:"pid,omitempty"`
+	Status    string            `json:"status"`
+	ExitCode  *int              `json:"exitCode,omitempty"`
+	Phases    []Phase           `json:"phases"`
+	Stdout    string            `json:"stdout,omitempty"`
+	Stderr    string            `json:"stderr,omitempty"`
+
+	// Fingerprint is the canonical request identity from pkg/fingerprint.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// AllowedBy is the allowlist entry that admitted the executed contract.
+	AllowedBy string `json:"allowedBy,omitempty"`
+	// Job is the async job the run belonged to.
+	Job string `json:"job,omitempty"`
+	// Outputs are the s3:// URIs of objects uploaded for the run.
+	Outputs []string `json:"outputs,omitempty"`
+
+	// ExpiresAt is when the entry is deleted, zero for never.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// DeletedAt is set on the tombstone SoftDelete leaves behind.
+	DeletedAt time.Time `json:"deletedAt,omitzero"`
+}
+
+// container identifies this process so readers can tell abandoned entries apart from
+// runs still in progress here.
+var container = newID()
+
+// Container returns the ID this process writes into entries.
+func Container() string { return container }
+
+// Journal writes entries below Dir.
+type Journal struct {
+	Dir string
+	// OutputBytes is how much trailing stdout and stderr each entry keeps.
+	OutputBytes int
+	// SyncInterval is how often output is flushed while a run is in progress.
+	SyncInterval time.Duration
+	// Retention is how long entries are kept; zero keeps them forever. Expired entries
+	// are deleted as they are read.
+	Retention time.Duration
+}
+
+// Enabled reports whether a directory is configured.
+func (j *Journal) Enabled() bool { return j != nil && j.Dir != "" }
+
+// Begin writes the initial entry for id and returns a recorder for the run. Args must
+// already be sanitized. On a disabled journal the recorder is a no-op.
+func (j *Journal) Begin(id, caller, authKey string, args []string, fingerprint string, tags map[string]string) (*Record, error) {
+	if !j.Enabled() {
+		return &Record{}, nil
+	}
+	if id == "" {
+		id = newID()
+	}
+	if err := os.MkdirAll(j.Dir, 0o755); err != nil {
+		return &Record{}, fmt.Errorf("journal dir: %w", err)
+	}
+	now := time.Now().UTC()
+	var expires time.Time
+	if j.Retention > 0 {
+		expires = now.Add(j.Retention)
+	}
+	r := &Record{
+		path:   filepath.Join(j.Dir, fileName(id)),
+		stdout: &tailWriter{limit: j.OutputBytes},
+		stderr: &tailWriter{limit: j.OutputBytes},
+		stop:   make(chan struct{}),
+		entry: Entry{
+			ID:        id,
+			Container: container,
+			Caller:    caller,
+			AuthKey:   authKey,
+			Args:      args,
+			Tags:      tags,
+			Status:    StatusRunning,
+			Phases:    []Phase{{Name: "received", At: now}},
+
+			Fingerprint: fingerprint,
+			ExpiresAt:   expires,
+		},
+	}
+	r.stdout.record, r.stderr.record = r, r
+	if err := r.sync(); err != nil {
+		return &Record{}, err
+	}
+	if j.SyncInterval > 0 {
+		go r.flushLoop(j.SyncInterval)
+	}
+	return r, nil
+}
+
+// Read returns the entry for id. An expired entry is deleted and reported as
+// os.ErrNotExist.
+func (j *Journal) Read(id string) (Entry, error) {
+	var e Entry
+	if !j.Enabled() {
+		return e, errors.New("journal is not enabled")
+	}
+	path := filepath.Join(j.Dir, fileName(id))
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return e, err
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return e, fmt.Errorf("decode journal %s: %w", id, err)
+	}
+	if !e.ExpiresAt.IsZero() && !time.Now().Before(e.ExpiresAt) {
+		_ = os.Remove(path)
+		return Entry{}, fmt.Errorf("journal %s expired: %w", id, os.ErrNotExist)
+	}
+	if e.Status == StatusRunning && e.Container != container {
+		e.Status = StatusAbandoned
+	}
+	return e, nil
+}
+
+// List returns up to limit entries carrying all of the want tags, most recently
+// modified first, without output.
+func (j *Journal) List(limit int, want map[string]string) ([]Entry, error) {
+	if !j.Enabled() {
+		return nil, errors.New("journal is not enabled")
+	}
+	ids, err := j.ids()
+	if err != nil {
+		return nil, err
+	}
+	out := []Entry{}
+	for _, id := range ids {
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		e, err := j.Read(id)
+		if err != nil || !tags.Match(e.Tags, want) {
+			continue
+		}
+		e.Stdout, e.Stderr = "", ""
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// SoftDelete replaces the entry for id by a tombstone that keeps only its ID,
+// container, status, exit code and phases, and expires with the entry.
+func (j *Journal) SoftDelete(id string) error {
+	e, err := j.Read(id)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(Entry{
+		ID:        e.ID,
+		Container: e.Container,
+		Status:    e.Status,
+		ExitCode:  e.ExitCode,
+		Phases:    e.Phases,
+		ExpiresAt: e.ExpiresAt,
+		DeletedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(j.Dir, fileName(id)), b)
+}
+
+// ids returns the IDs of all entries, most recently modified first.
+func (j *Journal) ids() ([]string, error) {
+	files, err := os.ReadDir(j.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	type file struct {
+		id  string
+		mod time.Time
+	}
+	var all []file
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || f.IsDir() {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		all = append(all, file{id: id, mod: info.ModTime()})
+	}
+	slices.SortFunc(all, func(a, b file) int { return b.mod.Compare(a.mod) })
+	ids := make([]string, len(all))
+	for i, f := range all {
+		ids[i] = f.id
+	}
+	return ids, nil
+}
+
+// Record tracks one run. All methods are safe on a zero Record, which discards everything.
+type Record struct {
+	mu     sync.Mutex
+	wmu    sync.Mutex // serializes sync so snapshots land in order
+	path   string
+	entry  Entry
+	dirty  bool
+	stdout *tailWriter
+	stderr *tailWriter
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// ID returns the journal entry ID, or "" when journaling is disabled.
+func (r *Record) ID() string { return r.entry.ID }
+
+// Stdout returns a writer capturing trailing stdout, or nil when disabled.
+func (r *Record) Stdout() io.Writer {
+	if r.stdout == nil {
+		return nil
+	}
+	return r.stdout
+}
+
+// Stderr returns a writer capturing trailing stderr, or nil when disabled.
+func (r *Record) Stderr() io.Writer {
+	if r.stderr == nil {
+		return nil
+	}
+	return r.stderr
+}
+
+// Allowed records the allowlist entry that admitted the run; it is written with the
+// next sync.
+func (r *Record) Allowed(by string) {
+	if r.path == "" {
+		return
+	}
+	r.mu.Lock()
+	r.entry.AllowedBy = by
+	r.dirty = true
+	r.mu.Unlock()
+}
+
+// InJob records the async job the run belongs to; it is written with the next sync.
+func (r *Record) InJob(id string) {
+	if r.path == "" || id == "" {
+		return
+	}
+	r.mu.Lock()
+	r.entry.Job = id
+	r.dirty = true
+	r.mu.Unlock()
+}
+
+// Uploaded records objects stored for the run, such as its full output, and syncs the
+// entry.
+func (r *Record) Uploaded(uris ...string) {
+	if r.path == "" || len(uris) == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.entry.Outputs = append(r.entry.Outputs, uris...)
+	r.mu.Unlock()
+	_ = r.sync()
+}
+
+// Started records the child PID and syncs the entry.
+func (r *Record) Started(pid int) {
+	if r.path == "" {
+		return
+	}
+	r.mu.Lock()
+	r.entry.PID = pid
+	r.entry.Phases = append(r.entry.Phases, Phase{Name: "started", At: time.Now().UTC()})
+	r.mu.Unlock()
+	_ = r.sync()
+}
+
+// Finish records the exit code and performs the final sync.
+func (r *Record) Finish(exitCode int) {
+	if r.path == "" {
+		return
+	}
+	r.once.Do(func() { close(r.stop) })
+	r.mu.Lock()
+	r.entry.ExitCode = &exitCode
+	r.entry.Status = StatusFinished
+	r.entry.Phases = append(r.entry.Phases, Phase{Name: "finished", At: time.Now().UTC()})
+	r.mu.Unlock()
+	_ = r.sync()
+}
+
+func (r *Record) flushLoop(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-t.C:
+			r.mu.Lock()
+			dirty := r.dirty
+			r.mu.Unlock()
+			if dirty {
+				_ = r.sync()
+			}
+		}
+	}
+}
+
+// sync atomically rewrites the entry file and fsyncs it so it survives the container.
+func (r *Record) sync() error {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	r.mu.Lock()
+	e := r.entry
+	e.Phases = slices.Clone(e.Phases)
+	e.Outputs = slices.Clone(e.Outputs)
+	r.dirty = false
+	r.mu.Unlock()
+	e.Stdout = r.stdout.String()
+	e.Stderr = r.stderr.String()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeFile(r.path, b)
+}
+
+// writeFile atomically replaces path with b and fsyncs it.
+func writeFile(path string, b []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("journal write: %w", err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("journal write: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("journal sync: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("journal write: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// tailWriter keeps the last limit bytes written and marks its record dirty.
+type tailWriter struct {
+	mu     sync.Mutex
+	buf    []byte
+	limit  int
+	record *Record
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.limit; t.limit > 0 && over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	t.mu.Unlock()
+	t.record.mu.Lock()
+	t.record.dirty = true
+	t.record.mu.Unlock()
+	return len(p), nil
+}
+
+func (t *tailWriter) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+// fileName maps an ID to a file name, replacing anything that could escape Dir.
+func fileName(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, id) + ".json"
+}
+
+func newID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
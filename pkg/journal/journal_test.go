@@ -0,0 +1,134 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordLifecycle(t *testing.T) {
+	j := &Journal{Dir: t.TempDir(), OutputBytes: 8}
+	r, err := j.Begin("req-1", "ip:1.2.3.4", "", []string{"execute", "--private-key", "<redacted>"}, "abc", map[string]string{"order": "42"})
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	r.Started(4242)
+	fmt.Fprint(r.Stdout(), "0123456789")
+
+	e, err := j.Read("req-1")
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if e.Status != StatusRunning || e.PID != 4242 || len(e.Phases) != 2 || e.Fingerprint != "abc" {
+		t.Fatalf("unexpected in-flight entry: %+v", e)
+	}
+
+	r.Finish(3)
+	e, _ = j.Read("req-1")
+	if e.Status != StatusFinished || e.ExitCode == nil || *e.ExitCode != 3 {
+		t.Fatalf("unexpected finished entry: %+v", e)
+	}
+	if e.Stdout != "23456789" {
+		t.Fatalf("expected trailing output, got %q", e.Stdout)
+	}
+	if list, _ := j.List(0, map[string]string{"order": "42"}); len(list) != 1 || list[0].Tags["order"] != "42" {
+		t.Fatalf("expected tagged entry, got %+v", list)
+	}
+	if list, _ := j.List(0, map[string]string{"order": "43"}); len(list) != 0 {
+		t.Fatalf("tag filter should exclude the entry, got %+v", list)
+	}
+}
+
+func TestReadMarksOtherContainersAbandoned(t *testing.T) {
+	dir := t.TempDir()
+	b, _ := json.Marshal(Entry{ID: "dead", Container: "other", Status: StatusRunning})
+	if err := os.WriteFile(filepath.Join(dir, "dead.json"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	j := &Journal{Dir: dir}
+	e, err := j.Read("dead")
+	if err != nil || e.Status != StatusAbandoned {
+		t.Fatalf("expected abandoned entry, got %+v (%v)", e, err)
+	}
+	list, err := j.List(10, nil)
+	if err != nil || len(list) != 1 || list[0].ID != "dead" {
+		t.Fatalf("unexpected list: %+v (%v)", list, err)
+	}
+}
+
+func TestRetentionExpiresEntries(t *testing.T) {
+	j := &Journal{Dir: t.TempDir(), Retention: time.Hour}
+	r, _ := j.Begin("fresh", "", "", nil, "", nil)
+	r.Finish(0)
+	if e, err := j.Read("fresh"); err != nil || e.ExpiresAt.Before(time.Now().Add(59*time.Minute)) {
+		t.Fatalf("expected an entry expiring in an hour, got %+v (%v)", e, err)
+	}
+	b, _ := json.Marshal(Entry{ID: "old", Status: StatusFinished, ExpiresAt: time.Now().Add(-time.Second)})
+	if err := os.WriteFile(filepath.Join(j.Dir, "old.json"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := j.List(0, nil); len(list) != 1 || list[0].ID != "fresh" {
+		t.Fatalf("expected only the fresh entry, got %+v", list)
+	}
+	if _, err := j.Read("old"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the expired entry to be gone, got %v", err)
+	}
+}
+
+func TestSoftDeleteLeavesTombstone(t *testing.T) {
+	j := &Journal{Dir: t.TempDir(), Retention: time.Hour}
+	r, _ := j.Begin("a", "ip:1.2.3.4", "", []string{"execute", "token.aleo/mint", "aleo1acme"}, "abc", map[string]string{"customer": "acme"})
+	r.InJob("job-a")
+	fmt.Fprint(r.Stdout(), "minted for aleo1acme")
+	r.Finish(0)
+	r.Uploaded("s3://out/a/stdout.txt")
+	e, _ := j.Read("a")
+	if e.Job != "job-a" || len(e.Outputs) != 1 || e.Outputs[0] != "s3://out/a/stdout.txt" {
+		t.Fatalf("expected the job and outputs to be recorded: %+v", e)
+	}
+
+	if err := j.SoftDelete("a"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := j.Read("a")
+	if err != nil || got.DeletedAt.IsZero() || got.Status != StatusFinished || !got.ExpiresAt.Equal(e.ExpiresAt) || len(got.Phases) != 2 {
+		t.Fatalf("expected a tombstone, got %+v (%v)", got, err)
+	}
+	if got.Caller != "" || got.Args != nil || got.Tags != nil || got.Stdout != "" || got.Outputs != nil || got.Job != "" || got.Fingerprint != "" {
+		t.Fatalf("tombstone kept run details: %+v", got)
+	}
+	if list, _ := j.List(0, map[string]string{"customer": "acme"}); len(list) != 0 {
+		t.Fatalf("tombstone still matches its tags: %+v", list)
+	}
+	if err := j.SoftDelete("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing entry to be reported, got %v", err)
+	}
+}
+
+func TestSyncIntervalFlushesOutput(t *testing.T) {
+	j := &Journal{Dir: t.TempDir(), SyncInterval: 10 * time.Millisecond}
+	r, err := j.Begin("", "", "", nil, "", nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer r.Finish(0)
+	fmt.Fprint(r.Stderr(), "warming up")
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if e, _ := j.Read(r.ID()); e.Stderr == "warming up" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("output was not flushed")
+}
+
+func TestFileNameCannotEscapeDir(t *testing.T) {
+	if got := fileName("../../etc/passwd"); got != "______etc_passwd.json" {
+		t.Fatalf("unexpected file name %q", got)
+	}
+}
@@ -0,0 +1,201 @@
+// Package jsondiff compares two JSON documents field by field, for checking that a leo
+// upgrade or an endpoint migration leaves run outputs unchanged.
+package jsondiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Change kinds.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// maxLineDiffCells bounds the line diff of a multi-line string (lines of a times lines
+// of b); larger strings are reported as changed without Lines.
+const maxLineDiffCells = 4 << 20
+
+// Change is one field that differs. Path names it as in "meta.version" or
+// "events[0].value".
+type Change struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+	// Lines is a line diff of a changed multi-line string, each line prefixed with
+	// "  ", "- " or "+ ".
+	Lines []string `json:"lines,omitempty"`
+}
+
+// Normalize turns v into the generic form Compare expects, by way of its JSON encoding.
+func Normalize(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Compare returns the fields that differ between a and b, decoded JSON values, in path
+// order. Paths listed in ignore are skipped together with everything below them.
+func Compare(a, b any, ignore []string) []Change {
+	var out []Change
+	walk("", a, b, ignore, &out)
+	return out
+}
+
+func walk(path string, a, b any, ignore []string, out *[]Change) {
+	if ignored(path, ignore) {
+		return
+	}
+	am, aIsMap := a.(map[string]any)
+	bm, bIsMap := b.(map[string]any)
+	if aIsMap && bIsMap {
+		keys := make([]string, 0, len(am)+len(bm))
+		for k := range am {
+			keys = append(keys, k)
+		}
+		for k := range bm {
+			if _, ok := am[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			av, aok := am[k]
+			bv, bok := bm[k]
+			switch {
+			case !aok:
+				if !ignored(p, ignore) {
+					*out = append(*out, Change{Path: p, Kind: Added, New: bv})
+				}
+			case !bok:
+				if !ignored(p, ignore) {
+					*out = append(*out, Change{Path: p, Kind: Removed, Old: av})
+				}
+			default:
+				walk(p, av, bv, ignore, out)
+			}
+		}
+		return
+	}
+	al, aIsList := a.([]any)
+	bl, bIsList := b.([]any)
+	if aIsList && bIsList {
+		for i := range max(len(al), len(bl)) {
+			p := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(al):
+				*out = append(*out, Change{Path: p, Kind: Added, New: bl[i]})
+			case i >= len(bl):
+				*out = append(*out, Change{Path: p, Kind: Removed, Old: al[i]})
+			default:
+				walk(p, al[i], bl[i], ignore, out)
+			}
+		}
+		return
+	}
+	if equal(a, b) {
+		return
+	}
+	c := Change{Path: path, Kind: Changed, Old: a, New: b}
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok && (strings.Contains(as, "\n") || strings.Contains(bs, "\n")) {
+			c.Lines = lineDiff(strings.Split(as, "\n"), strings.Split(bs, "\n"))
+		}
+	}
+	*out = append(*out, c)
+}
+
+func ignored(path string, ignore []string) bool {
+	return slices.ContainsFunc(ignore, func(p string) bool {
+		return path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(path, p+"[")
+	})
+}
+
+func equal(a, b any) bool {
+	ab, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	return string(ab) == string(bb)
+}
+
+// lineDiff returns a minimal line diff of a and b from their longest common
+// subsequence, or nil when they are too long to compare.
+func lineDiff(a, b []string) []string {
+	if len(a)*len(b) > maxLineDiffCells {
+		return nil
+	}
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, "  "+a[i])
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	return out
+}
+
+// Text renders changes for people, one block per change.
+func Text(changes []Change) string {
+	if len(changes) == 0 {
+		return "no differences\n"
+	}
+	var sb strings.Builder
+	for _, c := range changes {
+		switch {
+		case c.Kind == Added:
+			fmt.Fprintf(&sb, "+ %s: %s\n", c.Path, render(c.New))
+		case c.Kind == Removed:
+			fmt.Fprintf(&sb, "- %s: %s\n", c.Path, render(c.Old))
+		case c.Lines != nil:
+			fmt.Fprintf(&sb, "~ %s:\n", c.Path)
+			for _, l := range c.Lines {
+				sb.WriteString("    " + l + "\n")
+			}
+		default:
+			fmt.Fprintf(&sb, "~ %s: %s -> %s\n", c.Path, render(c.Old), render(c.New))
+		}
+	}
+	return sb.String()
+}
+
+func render(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
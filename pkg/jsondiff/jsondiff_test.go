@@ -0,0 +1,61 @@
+package jsondiff
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestCompare(t *testing.T) {
+	a := decode(t, `{"exitCode": 0, "duration": 1.2, "stdout": "a\nb\nc", "meta": {"version": "leo 3.1", "journal": "x"}, "events": [{"value": "1u64"}]}`)
+	b := decode(t, `{"exitCode": 0, "duration": 3.4, "stdout": "a\nB\nc", "meta": {"version": "leo 3.2", "journal": "y", "endpoint": "https://n"}, "events": [{"value": "2u64"}, {"value": "3u64"}]}`)
+	got := Compare(a, b, []string{"duration", "meta.journal"})
+	var paths []string
+	for _, c := range got {
+		paths = append(paths, c.Kind+" "+c.Path)
+	}
+	want := []string{"changed events[0].value", "added events[1]", "added meta.endpoint", "changed meta.version", "changed stdout"}
+	if !slices.Equal(paths, want) {
+		t.Fatalf("changes %q, want %q", paths, want)
+	}
+	if l := got[4].Lines; !slices.Equal(l, []string{"  a", "- b", "+ B", "  c"}) {
+		t.Fatalf("line diff %q", l)
+	}
+	text := Text(got)
+	for _, s := range []string{`~ meta.version: "leo 3.1" -> "leo 3.2"`, `+ meta.endpoint: "https://n"`, "    + B"} {
+		if !strings.Contains(text, s) {
+			t.Fatalf("text lacks %q:\n%s", s, text)
+		}
+	}
+
+	if c := Compare(a, a, nil); len(c) != 0 || Text(c) != "no differences\n" {
+		t.Fatalf("identical documents differ: %v", c)
+	}
+	if c := Compare(a, decode(t, `{"exitCode": 1}`), []string{"stdout", "meta", "events", "duration"}); len(c) != 1 || c[0].Path != "exitCode" {
+		t.Fatalf("ignored subtrees reported: %v", c)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	type result struct {
+		Code int               `json:"code"`
+		Meta map[string]string `json:"meta"`
+	}
+	v, err := Normalize(result{Code: 1, Meta: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := Compare(v, decode(t, `{"code": 1, "meta": {"k": "v"}}`), nil); len(c) != 0 {
+		t.Fatalf("normalized value differs: %v", c)
+	}
+}
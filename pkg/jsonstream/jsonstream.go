@@ -0,0 +1,143 @@
+// Package jsonstream writes JSON incrementally to a writer. Large strings are escaped
+// straight into the destination in runs, instead of being materialised in the
+// intermediate buffers encoding/json uses, while producing identical bytes.
+package jsonstream
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+const hex = "0123456789abcdef"
+
+// Counter is an io.StringWriter that only counts bytes. Encoding once into a Counter
+// gives the exact size to preallocate for the real write.
+type Counter struct {
+	N int
+}
+
+// WriteString implements io.StringWriter.
+func (c *Counter) WriteString(s string) (int, error) {
+	c.N += len(s)
+	return len(s), nil
+}
+
+// String writes s as a JSON string exactly as encoding/json would (HTML-escaped,
+// invalid UTF-8 replaced with U+FFFD, U+2028 and U+2029 escaped).
+func String(w io.StringWriter, s string) error {
+	e := &errWriter{w: w}
+	writeString(e, s)
+	return e.err
+}
+
+func writeString(w *errWriter, s string) {
+	w.write(`"`)
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if safeSet[b] {
+				i++
+				continue
+			}
+			w.write(s[start:i])
+			switch b {
+			case '\\', '"':
+				w.write(`\` + string(b))
+			case '\b':
+				w.write(`\b`)
+			case '\f':
+				w.write(`\f`)
+			case '\n':
+				w.write(`\n`)
+			case '\r':
+				w.write(`\r`)
+			case '\t':
+				w.write(`\t`)
+			default:
+				w.write(`\u00` + string(hex[b>>4]) + string(hex[b&0xF]))
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			w.write(s[start:i])
+			w.write("\ufffd")
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			w.write(s[start:i])
+			w.write(`\u202` + string(hex[c&0xF]))
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	w.write(s[start:])
+	w.write(`"`)
+}
+
+// safeSet marks ASCII bytes that can be written unescaped with HTML escaping on.
+var safeSet = func() (t [utf8.RuneSelf]bool) {
+	for b := 0x20; b < utf8.RuneSelf; b++ {
+		t[b] = b != '"' && b != '\\' && b != '<' && b != '>' && b != '&'
+	}
+	return t
+}()
+
+// Object writes the members of a JSON object in order. Errors are sticky and
+// reported by End.
+type Object struct {
+	w     *errWriter
+	first bool
+}
+
+// NewObject writes the opening brace to w.
+func NewObject(w io.StringWriter) *Object {
+	o := &Object{w: &errWriter{w: w}, first: true}
+	o.w.write("{")
+	return o
+}
+
+// String writes a member whose value is the JSON string s.
+func (o *Object) String(name, s string) {
+	o.key(name)
+	writeString(o.w, s)
+}
+
+// Raw writes a member whose value is already-encoded JSON.
+func (o *Object) Raw(name, raw string) {
+	o.key(name)
+	o.w.write(raw)
+}
+
+// End writes the closing brace and returns the first write error, if any.
+func (o *Object) End() error {
+	o.w.write("}")
+	return o.w.err
+}
+
+func (o *Object) key(name string) {
+	if !o.first {
+		o.w.write(",")
+	}
+	o.first = false
+	writeString(o.w, name)
+	o.w.write(":")
+}
+
+type errWriter struct {
+	w   io.StringWriter
+	err error
+}
+
+func (e *errWriter) write(s string) {
+	if e.err != nil || s == "" {
+		return
+	}
+	_, e.err = e.w.WriteString(s)
+}
@@ -0,0 +1,50 @@
+package jsonstream
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStringMatchesEncodingJSON(t *testing.T) {
+	var all strings.Builder
+	for b := range 0x80 {
+		all.WriteByte(byte(b))
+	}
+	cases := []string{
+		"",
+		"plain output",
+		all.String(),
+		"invalid \xff utf8 \xc3",
+		"separators \u2028 and \u2029, snowman ☃",
+		`<script>alert("x")</script> & more`,
+	}
+	for _, s := range cases {
+		want, _ := json.Marshal(s)
+		var got strings.Builder
+		if err := String(&got, s); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if got.String() != string(want) {
+			t.Fatalf("mismatch for %q:\n got %s\nwant %s", s, got.String(), want)
+		}
+		var c Counter
+		_ = String(&c, s)
+		if c.N != len(want) {
+			t.Fatalf("counter %d != %d for %q", c.N, len(want), s)
+		}
+	}
+}
+
+func TestObject(t *testing.T) {
+	var sb strings.Builder
+	o := NewObject(&sb)
+	o.Raw("exitCode", "0")
+	o.String("stdout", "a\nb")
+	if err := o.End(); err != nil {
+		t.Fatalf("end: %v", err)
+	}
+	if got := sb.String(); got != `{"exitCode":0,"stdout":"a\nb"}` {
+		t.Fatalf("unexpected object %s", got)
+	}
+}
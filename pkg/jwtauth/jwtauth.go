@@ -0,0 +1,309 @@
+// Package jwtauth validates OIDC bearer tokens (RS256 or ES256) against an issuer's
+// JWKS, which is discovered from the issuer and cached.
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Leeway tolerates clock skew when checking exp and nbf.
+const Leeway = time.Minute
+
+// ErrInvalid wraps every token validation failure.
+var ErrInvalid = errors.New("invalid bearer token")
+
+// Claims are the validated claims used for authorization.
+type Claims struct {
+	Subject string
+	Groups  []string
+}
+
+// Verifier validates tokens for one issuer and audience.
+type Verifier struct {
+	Issuer   string
+	Audience string
+	// JWKSURL overrides the jwks_uri from the issuer's discovery document.
+	JWKSURL string
+	// GroupsClaim names the claim holding group names (default "groups").
+	GroupsClaim string
+	Keys        *KeyCache
+	HTTPClient  *http.Client
+	now         func() time.Time
+}
+
+// Verify checks token's signature, issuer, audience and lifetime.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: malformed", ErrInvalid)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, fmt.Errorf("%w: header: %v", ErrInvalid, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: signature encoding", ErrInvalid)
+	}
+	jwksURL, err := v.jwksURL(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	key, err := v.Keys.Key(ctx, v.HTTPClient, jwksURL, header.Kid)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(header.Alg, key, digest[:], sig) {
+		return Claims{}, fmt.Errorf("%w: bad signature", ErrInvalid)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, fmt.Errorf("%w: claims: %v", ErrInvalid, err)
+	}
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	if iss, _ := claims["iss"].(string); iss != v.Issuer {
+		return Claims{}, fmt.Errorf("%w: issuer %q", ErrInvalid, iss)
+	}
+	if !audienceMatches(claims["aud"], v.Audience) {
+		return Claims{}, fmt.Errorf("%w: audience", ErrInvalid)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(Leeway)) {
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalid)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return Claims{}, fmt.Errorf("%w: not yet valid", ErrInvalid)
+	}
+	out := Claims{}
+	out.Subject, _ = claims["sub"].(string)
+	if out.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: missing sub", ErrInvalid)
+	}
+	name := v.GroupsClaim
+	if name == "" {
+		name = "groups"
+	}
+	switch g := claims[name].(type) {
+	case string:
+		out.Groups = strings.Fields(g)
+	case []any:
+		for _, x := range g {
+			if s, ok := x.(string); ok {
+				out.Groups = append(out.Groups, s)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (v *Verifier) jwksURL(ctx context.Context) (string, error) {
+	if v.JWKSURL != "" {
+		return v.JWKSURL, nil
+	}
+	return v.Keys.discover(ctx, v.HTTPClient, v.Issuer)
+}
+
+func audienceMatches(aud any, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []any:
+		return slices.Contains(a, any(want))
+	}
+	return false
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest, sig []byte) bool {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// KeyCache caches JWKS documents and discovered jwks_uri values. An unknown key ID
+// triggers a refresh, at most once per minute, so issuer key rotations are picked up.
+type KeyCache struct {
+	TTL time.Duration
+
+	mu    sync.Mutex
+	sets  map[string]*keySet
+	disco map[string]string
+}
+
+type keySet struct {
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// refreshInterval bounds refreshes caused by unknown key IDs.
+const refreshInterval = time.Minute
+
+// NewKeyCache returns a cache that refetches key sets after ttl.
+func NewKeyCache(ttl time.Duration) *KeyCache {
+	return &KeyCache{TTL: ttl, sets: map[string]*keySet{}, disco: map[string]string{}}
+}
+
+// Reset forgets all cached keys.
+func (c *KeyCache) Reset() {
+	c.mu.Lock()
+	c.sets, c.disco = map[string]*keySet{}, map[string]string{}
+	c.mu.Unlock()
+}
+
+// Key returns the key kid from the JWKS at url. An empty kid matches a set holding a
+// single key.
+func (c *KeyCache) Key(ctx context.Context, hc *http.Client, url, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	set := c.sets[url]
+	stale := set == nil || time.Since(set.fetched) > c.TTL
+	if !stale && lookup(set, kid) == nil && time.Since(set.fetched) > refreshInterval {
+		stale = true
+	}
+	if stale {
+		keys, err := fetchJWKS(ctx, hc, url)
+		if err != nil {
+			if set == nil {
+				return nil, err
+			}
+		} else {
+			set = &keySet{keys: keys, fetched: time.Now()}
+			c.sets[url] = set
+		}
+	}
+	if k := lookup(set, kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func lookup(set *keySet, kid string) crypto.PublicKey {
+	if kid == "" && len(set.keys) == 1 {
+		for _, k := range set.keys {
+			return k
+		}
+	}
+	return set.keys[kid]
+}
+
+func (c *KeyCache) discover(ctx context.Context, hc *http.Client, issuer string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if u, ok := c.disco[issuer]; ok {
+		return u, nil
+	}
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := getJSON(ctx, hc, strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", &doc); err != nil {
+		return "", fmt.Errorf("oidc discovery: %w", err)
+	}
+	if doc.JWKSURI == "" {
+		return "", errors.New("oidc discovery: no jwks_uri")
+	}
+	c.disco[issuer] = doc.JWKSURI
+	return doc.JWKSURI, nil
+}
+
+func fetchJWKS(ctx context.Context, hc *http.Client, url string) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, hc, url, &doc); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func getJSON(ctx context.Context, hc *http.Client, url string, v any) error {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
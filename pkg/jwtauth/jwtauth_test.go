@@ -0,0 +1,92 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/keys"})
+		case "/keys":
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "r1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kty": "EC", "kid": "e1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	v := &Verifier{Issuer: srv.URL, Audience: "leo", Keys: NewKeyCache(time.Hour)}
+	claims := map[string]any{"iss": srv.URL, "aud": []string{"other", "leo"}, "sub": "alice", "groups": []string{"treasury"}, "exp": time.Now().Add(time.Hour).Unix()}
+
+	for _, tok := range []string{sign(t, "RS256", "r1", rsaKey, claims), sign(t, "ES256", "e1", ecKey, claims)} {
+		c, err := v.Verify(context.Background(), tok)
+		if err != nil || c.Subject != "alice" || len(c.Groups) != 1 || c.Groups[0] != "treasury" {
+			t.Fatalf("unexpected claims %+v (%v)", c, err)
+		}
+	}
+
+	bad := map[string]map[string]any{
+		"audience": {"aud": "someone-else"},
+		"issuer":   {"iss": "https://evil.example"},
+		"expired":  {"exp": time.Now().Add(-time.Hour).Unix()},
+	}
+	for name, override := range bad {
+		c := map[string]any{}
+		for k, v := range claims {
+			c[k] = v
+		}
+		for k, v := range override {
+			c[k] = v
+		}
+		if _, err := v.Verify(context.Background(), sign(t, "RS256", "r1", rsaKey, c)); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if _, err := v.Verify(context.Background(), sign(t, "RS256", "r1", other, claims)); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected a signature from another key to fail, got %v", err)
+	}
+	if _, err := v.Verify(context.Background(), sign(t, "RS256", "unknown", rsaKey, claims)); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected an unknown kid to fail, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+// Package keyuse records when each configured private key was last used, for which
+// contract and how often today, so keys nobody uses any more can be found and removed.
+// Keys are known by an alias naming where they are configured, never by their value.
+//
+// Like package usage, each container writes only its own file, and reports merge the
+// files of all containers.
+package keyuse
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entry is one container's record of a key.
+type entry struct {
+	LastUsed time.Time `json:"lastUsed"`
+	Contract string    `json:"contract,omitempty"`
+	// Day is the UTC day Today counts.
+	Day   string `json:"day"`
+	Today int    `json:"today"`
+}
+
+// file is one container's records.
+type file struct {
+	// Started is when the container began recording, so a key it never used is known
+	// to have been unused since then.
+	Started time.Time        `json:"started"`
+	Keys    map[string]entry `json:"keys"`
+}
+
+// Key reports the use of one key.
+type Key struct {
+	Alias string `json:"alias"`
+	// LastUsed and Contract are unset for a key not used since recording began.
+	LastUsed  *time.Time `json:"lastUsed,omitempty"`
+	Contract  string     `json:"contract,omitempty"`
+	UsesToday int        `json:"usesToday"`
+	// Unused is set once the key has gone unused for the report's window, making it a
+	// candidate for removal.
+	Unused bool `json:"unused,omitempty"`
+}
+
+// container identifies this process's file.
+var container = newID()
+
+// mu serializes read-modify-write of this container's file.
+var mu sync.Mutex
+
+// Store keeps records below Dir.
+type Store struct {
+	Dir string
+}
+
+// Enabled reports whether a directory is configured.
+func (s *Store) Enabled() bool { return s != nil && s.Dir != "" }
+
+// Record notes a use of the key alias for contract at at. It is a no-op on a disabled
+// store.
+func (s *Store) Record(alias, contract string, at time.Time) error {
+	if !s.Enabled() {
+		return nil
+	}
+	at = at.UTC()
+	path := filepath.Join(s.Dir, container+".json")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("key usage dir: %w", err)
+	}
+	f, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	if f.Started.IsZero() {
+		f.Started = at
+	}
+	e := f.Keys[alias]
+	if day := at.Format(time.DateOnly); e.Day != day {
+		e.Day, e.Today = day, 0
+	}
+	e.LastUsed, e.Contract = at, contract
+	e.Today++
+	f.Keys[alias] = e
+	b, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("key usage write: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Report returns the use of each of aliases, in order, as of now. A key not used within
+// unusedAfter is Unused; one never used is only Unused once recording began that long
+// ago, so a new deployment does not flag every key.
+func (s *Store) Report(aliases []string, now time.Time, unusedAfter time.Duration) ([]Key, error) {
+	if !s.Enabled() {
+		return nil, errors.New("key usage store is not enabled")
+	}
+	files, err := os.ReadDir(s.Dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var started time.Time
+	merged := map[string]*Key{}
+	today := now.UTC().Format(time.DateOnly)
+	for _, de := range files {
+		if de.IsDir() || !strings.HasSuffix(de.Name(), ".json") {
+			continue
+		}
+		f, err := readFile(filepath.Join(s.Dir, de.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if started.IsZero() || f.Started.Before(started) {
+			started = f.Started
+		}
+		for alias, e := range f.Keys {
+			k, ok := merged[alias]
+			if !ok {
+				k = &Key{Alias: alias}
+				merged[alias] = k
+			}
+			if k.LastUsed == nil || e.LastUsed.After(*k.LastUsed) {
+				last := e.LastUsed
+				k.LastUsed, k.Contract = &last, e.Contract
+			}
+			if e.Day == today {
+				k.UsesToday += e.Today
+			}
+		}
+	}
+	out := make([]Key, 0, len(aliases))
+	for _, alias := range aliases {
+		k := Key{Alias: alias}
+		if m, ok := merged[alias]; ok {
+			k = *m
+		}
+		since := started
+		if k.LastUsed != nil {
+			since = *k.LastUsed
+		}
+		k.Unused = unusedAfter > 0 && !since.IsZero() && now.Sub(since) >= unusedAfter
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func readFile(path string) (file, error) {
+	f := file{Keys: map[string]entry{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return f, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if f.Keys == nil {
+		f.Keys = map[string]entry{}
+	}
+	return f, nil
+}
+
+func newID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
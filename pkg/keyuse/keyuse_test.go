@@ -0,0 +1,57 @@
+package keyuse
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReportMergesContainers(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	yesterday := time.Date(2025, 3, 1, 22, 0, 0, 0, time.UTC)
+	now := yesterday.Add(4 * time.Hour)
+	for _, r := range []struct {
+		alias, contract string
+		at              time.Time
+	}{
+		{"PRIVATE_KEY", "token.aleo", yesterday},
+		{"PRIVATE_KEY", "token.aleo", now},
+		{"FEE_PAYERS[nft.aleo]", "nft.aleo", yesterday},
+	} {
+		if err := s.Record(r.alias, r.contract, r.at); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	// Another container used the key later today, for another contract.
+	b, _ := json.Marshal(file{Started: yesterday.AddDate(0, 0, -40), Keys: map[string]entry{
+		"PRIVATE_KEY": {LastUsed: now.Add(time.Minute), Contract: "credits.aleo", Day: "2025-03-02", Today: 2},
+	}})
+	if err := os.WriteFile(filepath.Join(s.Dir, "other.json"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := s.Report([]string{"PRIVATE_KEY", "FEE_PAYERS[nft.aleo]", "FEE_PRIVATE_KEY"}, now.Add(time.Hour), 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+	if k := keys[0]; k.Contract != "credits.aleo" || k.UsesToday != 3 || k.Unused {
+		t.Fatalf("unexpected PRIVATE_KEY: %+v", k)
+	}
+	if k := keys[1]; k.UsesToday != 0 || k.LastUsed == nil || !k.LastUsed.Equal(yesterday) || k.Unused {
+		t.Fatalf("unexpected FEE_PAYERS entry: %+v", k)
+	}
+	// Never used while recording has run for 40 days.
+	if k := keys[2]; k.LastUsed != nil || !k.Unused {
+		t.Fatalf("expected FEE_PRIVATE_KEY to be unused: %+v", k)
+	}
+
+	fresh := &Store{Dir: t.TempDir()}
+	if keys, _ := fresh.Report([]string{"PRIVATE_KEY"}, now, time.Hour); len(keys) != 1 || keys[0].Unused {
+		t.Fatalf("expected nothing flagged before recording began: %+v", keys)
+	}
+}
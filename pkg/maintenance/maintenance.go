@@ -0,0 +1,134 @@
+// Package maintenance decides whether a contract is in a maintenance window, e.g. while
+// it is migrated to a new edition. Windows open whenever a five-field cron expression
+// matches, in UTC at minute resolution, and stay open for a fixed duration.
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/schedule"
+)
+
+// Actions taken on executes during a window.
+const (
+	// ActionReject refuses the execute with a hint to retry once the window ends.
+	ActionReject = "reject"
+	// ActionQueue holds the execute in a job that runs once the window ends.
+	ActionQueue = "queue"
+)
+
+// MaxDuration bounds how long one window stays open.
+const MaxDuration = 7 * 24 * time.Hour
+
+// Window is a recurring maintenance window for some contracts.
+type Window struct {
+	Name      string            `json:"name"`
+	Contracts []string          `json:"contracts"`
+	Cron      string            `json:"cron"`
+	Duration  schedule.Duration `json:"duration"`
+	// Action is ActionReject (the default) or ActionQueue.
+	Action string `json:"action,omitempty"`
+	// Reason is shown to callers, e.g. "migrating to token_v2.aleo".
+	Reason string `json:"reason,omitempty"`
+
+	expr *schedule.Expr
+}
+
+// Parse decodes the MAINTENANCE_WINDOWS JSON array. An empty string yields no windows.
+func Parse(raw string) ([]Window, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var list []Window
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil, fmt.Errorf("invalid MAINTENANCE_WINDOWS: %w", err)
+	}
+	seen := map[string]bool{}
+	for i := range list {
+		w := &list[i]
+		if w.Name == "" || len(w.Contracts) == 0 {
+			return nil, fmt.Errorf("invalid MAINTENANCE_WINDOWS: entry %d needs a name and contracts", i)
+		}
+		if seen[w.Name] {
+			return nil, fmt.Errorf("invalid MAINTENANCE_WINDOWS: duplicate name %q", w.Name)
+		}
+		seen[w.Name] = true
+		expr, err := schedule.ParseCron(w.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAINTENANCE_WINDOWS: %s: %w", w.Name, err)
+		}
+		if d := time.Duration(w.Duration); d < time.Minute || d > MaxDuration {
+			return nil, fmt.Errorf("invalid MAINTENANCE_WINDOWS: %s: duration must be between 1m and %s", w.Name, MaxDuration)
+		}
+		switch w.Action {
+		case "":
+			w.Action = ActionReject
+		case ActionReject, ActionQueue:
+		default:
+			return nil, fmt.Errorf("invalid MAINTENANCE_WINDOWS: %s: action %q (want reject or queue)", w.Name, w.Action)
+		}
+		for j, c := range w.Contracts {
+			w.Contracts[j] = strings.ToLower(strings.TrimSpace(c))
+		}
+		w.expr = expr
+	}
+	return list, nil
+}
+
+// Applies reports whether w covers contract.
+func (w Window) Applies(contract string) bool {
+	return slices.Contains(w.Contracts, strings.ToLower(contract))
+}
+
+// openedAt returns when the occurrence of w covering t opened, if one does.
+func (w Window) openedAt(t time.Time) (time.Time, bool) {
+	if w.expr == nil {
+		return time.Time{}, false
+	}
+	start := t.UTC().Truncate(time.Minute)
+	for m := start; t.Sub(m) < time.Duration(w.Duration); m = m.Add(-time.Minute) {
+		if w.expr.Match(m) {
+			return m, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Active returns the window covering contract at t, if any, and when contract leaves
+// maintenance: back-to-back and overlapping windows are followed to their end.
+func Active(windows []Window, contract string, t time.Time) (Window, time.Time, bool) {
+	var (
+		first Window
+		until time.Time
+		found bool
+	)
+	at := t
+	// Each pass moves to the end of a window, so chains end within MaxDuration each.
+	for range 16 {
+		advanced := false
+		for _, w := range windows {
+			if !w.Applies(contract) {
+				continue
+			}
+			opened, ok := w.openedAt(at)
+			if !ok {
+				continue
+			}
+			if !found {
+				first, found = w, true
+			}
+			if end := opened.Add(time.Duration(w.Duration)); end.After(until) {
+				until, advanced = end, true
+			}
+		}
+		if !advanced {
+			break
+		}
+		at = until
+	}
+	return first, until, found
+}
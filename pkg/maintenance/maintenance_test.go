@@ -0,0 +1,60 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	ws, err := Parse(`[{"name": "migrate", "contracts": ["Token.aleo"], "cron": "0 2 * * 0", "duration": "2h"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws[0].Action != ActionReject || !ws[0].Applies("token.aleo") {
+		t.Fatalf("unexpected window %+v", ws[0])
+	}
+	for _, raw := range []string{
+		`[{"name": "a", "cron": "0 2 * * 0", "duration": "2h"}]`,
+		`[{"name": "a", "contracts": ["t.aleo"], "cron": "0 2 * *", "duration": "2h"}]`,
+		`[{"name": "a", "contracts": ["t.aleo"], "cron": "0 2 * * 0", "duration": "30s"}]`,
+		`[{"name": "a", "contracts": ["t.aleo"], "cron": "0 2 * * 0", "duration": "200h"}]`,
+		`[{"name": "a", "contracts": ["t.aleo"], "cron": "0 2 * * 0", "duration": "2h", "action": "defer"}]`,
+		`[{"name": "a", "contracts": ["t.aleo"], "cron": "0 2 * * 0", "duration": "2h"}, {"name": "a", "contracts": ["t.aleo"], "cron": "0 3 * * 0", "duration": "1h"}]`,
+	} {
+		if _, err := Parse(raw); err == nil {
+			t.Fatalf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestActive(t *testing.T) {
+	ws, err := Parse(`[
+		{"name": "nightly", "contracts": ["token.aleo"], "cron": "0 2 * * *", "duration": "1h"},
+		{"name": "follow-up", "contracts": ["token.aleo", "nft.aleo"], "cron": "30 2 * * *", "duration": "1h", "action": "queue"}
+	]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		v, _ := time.Parse(time.RFC3339, s)
+		return v
+	}
+	if _, _, ok := Active(ws, "token.aleo", at("2026-01-05T01:59:59Z")); ok {
+		t.Fatal("active before the window opened")
+	}
+	// The overlapping follow-up window extends the nightly one.
+	w, until, ok := Active(ws, "token.aleo", at("2026-01-05T02:10:00Z"))
+	if !ok || w.Name != "nightly" || !until.Equal(at("2026-01-05T03:30:00Z")) {
+		t.Fatalf("got %q until %s (%v)", w.Name, until, ok)
+	}
+	w, until, ok = Active(ws, "nft.aleo", at("2026-01-05T03:29:00Z"))
+	if !ok || w.Action != ActionQueue || !until.Equal(at("2026-01-05T03:30:00Z")) {
+		t.Fatalf("got %q until %s (%v)", w.Name, until, ok)
+	}
+	if _, _, ok := Active(ws, "token.aleo", at("2026-01-05T03:30:00Z")); ok {
+		t.Fatal("active after the window closed")
+	}
+	if _, _, ok := Active(ws, "other.aleo", at("2026-01-05T02:10:00Z")); ok {
+		t.Fatal("window applied to another contract")
+	}
+}
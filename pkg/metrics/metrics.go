@@ -0,0 +1,251 @@
+// Package metrics tracks input/output sizes per command and contract, both as
+// CloudWatch Embedded Metric Format (EMF) log lines and as in-container percentiles.
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names, shared by EMF output and Summary.
+const (
+	RequestBytes = "RequestBytes"
+	ArgCount     = "ArgCount"
+	StdoutBytes  = "StdoutBytes"
+	StderrBytes  = "StderrBytes"
+	Truncated    = "Truncated"
+)
+
+// Panics counts handler panics recovered into 500 responses.
+const Panics = "Panics"
+
+// StaleConfig counts config or secret lookups answered from an expired cache entry
+// because the backing service failed.
+const StaleConfig = "StaleConfig"
+
+// QuotaFallback counts quota checks decided by the container's own counters because
+// the shared store (REDIS_URL, CONTRACT_QUOTA_TABLE) failed.
+const QuotaFallback = "QuotaFallback"
+
+// ShadowMismatch counts executes on which a shadow policy (SHADOW_ALLOWED_CONTRACTS,
+// SHADOW_GROUP_CONTRACTS) would have decided differently from the enforced one.
+const ShadowMismatch = "ShadowMismatch"
+
+// BulkheadRejected counts runs turned away, or given up after waiting, because their
+// bulkhead (BULKHEADS) was full. It is dimensioned by Bulkhead.
+const BulkheadRejected = "BulkheadRejected"
+
+// RunFailures counts runs leo failed, dimensioned by Category (see package classify).
+const RunFailures = "RunFailures"
+
+// Names lists the size metrics in output order.
+var Names = []string{RequestBytes, ArgCount, StdoutBytes, StderrBytes}
+
+// Sizes are the measurements of one invocation.
+type Sizes struct {
+	RequestBytes int
+	Args         int
+	StdoutBytes  int
+	StderrBytes  int
+	Truncated    bool
+}
+
+func (s Sizes) values() []float64 {
+	return []float64{float64(s.RequestBytes), float64(s.Args), float64(s.StdoutBytes), float64(s.StderrBytes)}
+}
+
+// Percentiles summarises one metric over the recent window.
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// Summary describes one command/contract pair.
+type Summary struct {
+	Command  string `json:"command"`
+	Contract string `json:"contract,omitempty"`
+	Count    int    `json:"count"`
+	// TruncatedRate is the fraction of runs in the window whose output was truncated.
+	TruncatedRate float64                `json:"truncatedRate"`
+	Metrics       map[string]Percentiles `json:"metrics"`
+}
+
+// series is a ring buffer of the last window samples.
+type series struct {
+	command, contract string
+	samples           []Sizes
+	next              int
+	total             int
+}
+
+// Recorder keeps the most recent samples per command and contract.
+type Recorder struct {
+	mu     sync.Mutex
+	window int
+	series map[string]*series
+}
+
+// NewRecorder returns a recorder keeping window samples per series.
+func NewRecorder(window int) *Recorder {
+	return &Recorder{window: max(window, 1), series: map[string]*series{}}
+}
+
+// Record adds one invocation's sizes.
+func (r *Recorder) Record(command, contract string, s Sizes) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := command + "\x00" + contract
+	se, ok := r.series[key]
+	if !ok {
+		se = &series{command: command, contract: contract}
+		r.series[key] = se
+	}
+	if len(se.samples) < r.window {
+		se.samples = append(se.samples, s)
+	} else {
+		se.samples[se.next] = s
+		se.next = (se.next + 1) % r.window
+	}
+	se.total++
+}
+
+// Summaries returns percentiles for every series, ordered by command then contract.
+func (r *Recorder) Summaries() []Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Summary, 0, len(r.series))
+	for _, se := range r.series {
+		sum := Summary{Command: se.command, Contract: se.contract, Count: se.total, Metrics: map[string]Percentiles{}}
+		cols := make([][]float64, len(Names))
+		truncated := 0
+		for _, s := range se.samples {
+			for i, v := range s.values() {
+				cols[i] = append(cols[i], v)
+			}
+			if s.Truncated {
+				truncated++
+			}
+		}
+		for i, name := range Names {
+			sum.Metrics[name] = percentiles(cols[i])
+		}
+		sum.TruncatedRate = float64(truncated) / float64(len(se.samples))
+		out = append(out, sum)
+	}
+	slices.SortFunc(out, func(a, b Summary) int {
+		if c := strings.Compare(a.Command, b.Command); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Contract, b.Contract)
+	})
+	return out
+}
+
+// Reset drops all samples.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.series = map[string]*series{}
+	r.mu.Unlock()
+}
+
+// percentiles uses the nearest-rank method.
+func percentiles(v []float64) Percentiles {
+	if len(v) == 0 {
+		return Percentiles{}
+	}
+	slices.Sort(v)
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(v)))) - 1
+		return v[max(i, 0)]
+	}
+	return Percentiles{P50: rank(0.5), P90: rank(0.9), P99: rank(0.99), Max: v[len(v)-1]}
+}
+
+// WriteCount writes a single dimensionless count of 1 for name as a CloudWatch EMF line,
+// for events such as Panics.
+func WriteCount(w io.Writer, namespace, name string, now time.Time) error {
+	return WriteCountWith(w, namespace, name, nil, now)
+}
+
+// WriteCountWith is WriteCount with dimensions, such as the Bulkhead of a
+// BulkheadRejected.
+func WriteCountWith(w io.Writer, namespace, name string, dims map[string]string, now time.Time) error {
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	doc := map[string]any{
+		"_aws": map[string]any{
+			"Timestamp": now.UnixMilli(),
+			"CloudWatchMetrics": []map[string]any{{
+				"Namespace":  namespace,
+				"Dimensions": [][]string{keys},
+				"Metrics":    []map[string]string{{"Name": name, "Unit": "Count"}},
+			}},
+		},
+		name: 1,
+	}
+	for k, v := range dims {
+		doc[k] = v
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteEMF writes s as one CloudWatch EMF line to w. CloudWatch extracts the metrics
+// from the function's log stream and computes percentiles over them, dimensioned by
+// Command and by Command+Contract.
+func WriteEMF(w io.Writer, namespace, command, contract string, s Sizes, now time.Time) error {
+	metricDefs := []map[string]string{}
+	for _, name := range Names {
+		unit := "Bytes"
+		if name == ArgCount {
+			unit = "Count"
+		}
+		metricDefs = append(metricDefs, map[string]string{"Name": name, "Unit": unit})
+	}
+	metricDefs = append(metricDefs, map[string]string{"Name": Truncated, "Unit": "Count"})
+	dims := [][]string{{"Command"}}
+	if contract != "" {
+		dims = append(dims, []string{"Command", "Contract"})
+	}
+	doc := map[string]any{
+		"_aws": map[string]any{
+			"Timestamp": now.UnixMilli(),
+			"CloudWatchMetrics": []map[string]any{{
+				"Namespace":  namespace,
+				"Dimensions": dims,
+				"Metrics":    metricDefs,
+			}},
+		},
+		"Command": command,
+	}
+	if contract != "" {
+		doc["Contract"] = contract
+	}
+	for i, v := range s.values() {
+		doc[Names[i]] = v
+	}
+	doc[Truncated] = 0
+	if s.Truncated {
+		doc[Truncated] = 1
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
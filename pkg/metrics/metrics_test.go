@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRecorderPercentiles(t *testing.T) {
+	r := NewRecorder(100)
+	for i := 1; i <= 150; i++ {
+		r.Record("execute", "token.aleo", Sizes{StdoutBytes: i, Truncated: i%10 == 0})
+	}
+	r.Record("query", "", Sizes{Args: 3})
+
+	got := r.Summaries()
+	if len(got) != 2 || got[0].Command != "execute" || got[1].Command != "query" {
+		t.Fatalf("unexpected summaries %+v", got)
+	}
+	ex := got[0]
+	// The window keeps samples 51..150.
+	if ex.Count != 150 || ex.Metrics[StdoutBytes] != (Percentiles{P50: 100, P90: 140, P99: 149, Max: 150}) {
+		t.Fatalf("unexpected execute summary %+v", ex)
+	}
+	if ex.TruncatedRate != 0.1 {
+		t.Fatalf("expected 10%% truncation, got %v", ex.TruncatedRate)
+	}
+}
+
+func TestWriteEMF(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteEMF(&buf, "LeoLambda", "execute", "token.aleo", Sizes{RequestBytes: 42, Truncated: true}, time.UnixMilli(1700000000000))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var doc struct {
+		AWS struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []struct{ Name, Unit string }
+			}
+		} `json:"_aws"`
+		Contract     string
+		RequestBytes float64
+		Truncated    float64
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid EMF: %v", err)
+	}
+	m := doc.AWS.CloudWatchMetrics[0]
+	if doc.AWS.Timestamp != 1700000000000 || m.Namespace != "LeoLambda" || len(m.Dimensions) != 2 || len(m.Metrics) != 5 {
+		t.Fatalf("unexpected metadata %+v", doc.AWS)
+	}
+	if doc.Contract != "token.aleo" || doc.RequestBytes != 42 || doc.Truncated != 1 {
+		t.Fatalf("unexpected values %+v", doc)
+	}
+}
+
+func TestWriteCountWith(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCountWith(&buf, "LeoLambda", BulkheadRejected, map[string]string{"Bulkhead": "write"}, time.UnixMilli(1700000000000)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var doc struct {
+		AWS struct {
+			CloudWatchMetrics []struct {
+				Dimensions [][]string
+				Metrics    []struct{ Name, Unit string }
+			}
+		} `json:"_aws"`
+		Bulkhead         string
+		BulkheadRejected float64
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid EMF: %v", err)
+	}
+	m := doc.AWS.CloudWatchMetrics[0]
+	if len(m.Dimensions) != 1 || len(m.Dimensions[0]) != 1 || m.Dimensions[0][0] != "Bulkhead" || m.Metrics[0].Name != BulkheadRejected {
+		t.Fatalf("unexpected metadata %+v", doc.AWS)
+	}
+	if doc.Bulkhead != "write" || doc.BulkheadRejected != 1 {
+		t.Fatalf("unexpected values %+v", doc)
+	}
+}
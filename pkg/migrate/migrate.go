@@ -0,0 +1,379 @@
+// Package migrate brings the DynamoDB tables this Lambda uses to the schema its code
+// expects: it creates missing tables, enables TTL, adds global secondary indexes and
+// backfills attributes, so an upgrade needs no manual table surgery. Each table records
+// the schema version it was migrated to in a tag, and migrations above that version are
+// applied in order. Every step is idempotent, so an interrupted run can simply be
+// repeated.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// VersionTag is the table tag holding its schema version.
+const VersionTag = "leo-lambda:schema-version"
+
+// Table kinds, one per table-backed feature.
+const (
+	Store          = "store"
+	Invites        = "invites"
+	SignedURLs     = "signedUrls"
+	ContractQuotas = "contractQuotas"
+	Rollups        = "rollups"
+)
+
+// Migration is one versioned schema change of a kind of table.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(ctx context.Context, db *DB, table string) error
+}
+
+// Schemas lists the migrations of each table kind in version order. Append new
+// migrations; never edit or reorder released ones.
+var Schemas = map[string][]Migration{
+	Store:          {createTable("key")},
+	Invites:        {createTable("id")},
+	SignedURLs:     {createTable("id")},
+	ContractQuotas: {createTable("id")},
+	Rollups:        {createTable("id")},
+}
+
+// createTable is the first migration of every kind: an on-demand table with a string
+// partition key and TTL on expiresAt.
+func createTable(key string) Migration {
+	return Migration{
+		Version:     1,
+		Description: fmt.Sprintf("create table with partition key %q and TTL on expiresAt", key),
+		Apply: func(ctx context.Context, db *DB, table string) error {
+			if err := db.CreateTable(ctx, table, key); err != nil {
+				return err
+			}
+			return db.EnableTTL(ctx, table, "expiresAt")
+		},
+	}
+}
+
+// Target is a table to migrate.
+type Target struct {
+	Kind  string `json:"kind"`
+	Table string `json:"table"`
+}
+
+// Targets returns the tables configured by the Lambda's environment variables, read
+// with getenv: STORE (dynamodb://<table> only), INVITE_TABLE, SIGNED_URL_TABLE,
+// CONTRACT_QUOTA_TABLE and ROLLUP_TABLE.
+func Targets(getenv func(string) string) []Target {
+	var ts []Target
+	if table, ok := strings.CutPrefix(strings.TrimSpace(getenv("STORE")), "dynamodb://"); ok && table != "" {
+		ts = append(ts, Target{Store, strings.TrimRight(table, "/")})
+	}
+	for _, v := range []struct{ kind, name string }{
+		{Invites, "INVITE_TABLE"},
+		{SignedURLs, "SIGNED_URL_TABLE"},
+		{ContractQuotas, "CONTRACT_QUOTA_TABLE"},
+		{Rollups, "ROLLUP_TABLE"},
+	} {
+		if table := strings.TrimSpace(getenv(v.name)); table != "" {
+			ts = append(ts, Target{v.kind, table})
+		}
+	}
+	return ts
+}
+
+// Result reports what Run did, or would do, to one table.
+type Result struct {
+	Kind    string   `json:"kind"`
+	Table   string   `json:"table"`
+	From    int      `json:"from"`
+	To      int      `json:"to"`
+	Applied []string `json:"applied,omitempty"`
+	// Pending lists the migrations a dry run would apply.
+	Pending []string `json:"pending,omitempty"`
+}
+
+// Run applies the migrations of kind above the version table is at. With dryRun it
+// only reports them. The version tag is advanced after each migration, so a failure
+// leaves the table at the last migration that succeeded.
+func Run(ctx context.Context, db *DB, kind, table string, dryRun bool) (Result, error) {
+	migrations, ok := Schemas[kind]
+	if !ok {
+		return Result{}, fmt.Errorf("unknown table kind %q", kind)
+	}
+	res := Result{Kind: kind, Table: table}
+	var err error
+	if res.From, err = db.Version(ctx, table); err != nil {
+		return res, err
+	}
+	res.To = res.From
+	for _, m := range migrations {
+		if m.Version <= res.From {
+			continue
+		}
+		step := fmt.Sprintf("%d: %s", m.Version, m.Description)
+		if dryRun {
+			res.Pending = append(res.Pending, step)
+			continue
+		}
+		if err := m.Apply(ctx, db, table); err != nil {
+			return res, fmt.Errorf("migrate %s to version %d: %w", table, m.Version, err)
+		}
+		if err := db.SetVersion(ctx, table, m.Version); err != nil {
+			return res, err
+		}
+		res.To = m.Version
+		res.Applied = append(res.Applied, step)
+	}
+	return res, nil
+}
+
+// DB runs schema operations against DynamoDB, waiting for each to take effect.
+type DB struct {
+	client *awsapi.Client
+	// Poll is how often table and index status is checked while waiting.
+	Poll time.Duration
+}
+
+// NewDB returns a DB using client.
+func NewDB(client *awsapi.Client) *DB {
+	return &DB{client: client, Poll: 2 * time.Second}
+}
+
+type tableDescription struct {
+	TableArn               string
+	TableStatus            string
+	GlobalSecondaryIndexes []struct {
+		IndexName   string
+		IndexStatus string
+	}
+}
+
+// describe returns the table's description, or nil when it does not exist.
+func (db *DB) describe(ctx context.Context, table string) (*tableDescription, error) {
+	var out struct {
+		Table tableDescription
+	}
+	err := db.call(ctx, "DescribeTable", map[string]any{"TableName": table}, &out)
+	if isCode(err, "ResourceNotFoundException") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out.Table, nil
+}
+
+// Version returns the schema version recorded on table; 0 when the table does not
+// exist or was never migrated.
+func (db *DB) Version(ctx context.Context, table string) (int, error) {
+	desc, err := db.describe(ctx, table)
+	if err != nil || desc == nil {
+		return 0, err
+	}
+	var out struct {
+		Tags []struct{ Key, Value string }
+	}
+	if err := db.call(ctx, "ListTagsOfResource", map[string]any{"ResourceArn": desc.TableArn}, &out); err != nil {
+		return 0, err
+	}
+	for _, t := range out.Tags {
+		if t.Key == VersionTag {
+			v, err := strconv.Atoi(t.Value)
+			if err != nil {
+				return 0, fmt.Errorf("table %s: invalid %s tag %q", table, VersionTag, t.Value)
+			}
+			return v, nil
+		}
+	}
+	return 0, nil
+}
+
+// SetVersion records version on table.
+func (db *DB) SetVersion(ctx context.Context, table string, version int) error {
+	desc, err := db.describe(ctx, table)
+	if err != nil {
+		return err
+	}
+	if desc == nil {
+		return fmt.Errorf("table %s does not exist", table)
+	}
+	tags := []map[string]string{{"Key": VersionTag, "Value": strconv.Itoa(version)}}
+	return db.call(ctx, "TagResource", map[string]any{"ResourceArn": desc.TableArn, "Tags": tags}, nil)
+}
+
+// CreateTable creates an on-demand table with string partition key key unless it
+// exists, and waits until it is active.
+func (db *DB) CreateTable(ctx context.Context, table, key string) error {
+	in := map[string]any{
+		"TableName":            table,
+		"AttributeDefinitions": []map[string]string{{"AttributeName": key, "AttributeType": "S"}},
+		"KeySchema":            []map[string]string{{"AttributeName": key, "KeyType": "HASH"}},
+		"BillingMode":          "PAY_PER_REQUEST",
+	}
+	if err := db.call(ctx, "CreateTable", in, nil); err != nil && !isCode(err, "ResourceInUseException") {
+		return err
+	}
+	return db.wait(ctx, table, "")
+}
+
+// EnableTTL has DynamoDB delete items once the epoch seconds in attribute have passed.
+func (db *DB) EnableTTL(ctx context.Context, table, attribute string) error {
+	var out struct {
+		TimeToLiveDescription struct {
+			TimeToLiveStatus string
+			AttributeName    string
+		}
+	}
+	if err := db.call(ctx, "DescribeTimeToLive", map[string]any{"TableName": table}, &out); err != nil {
+		return err
+	}
+	switch d := out.TimeToLiveDescription; {
+	case d.AttributeName == attribute && (d.TimeToLiveStatus == "ENABLED" || d.TimeToLiveStatus == "ENABLING"):
+		return nil
+	case d.TimeToLiveStatus == "ENABLED" || d.TimeToLiveStatus == "ENABLING":
+		return fmt.Errorf("table %s already has TTL on %q", table, d.AttributeName)
+	}
+	in := map[string]any{
+		"TableName":               table,
+		"TimeToLiveSpecification": map[string]any{"Enabled": true, "AttributeName": attribute},
+	}
+	return db.call(ctx, "UpdateTimeToLive", in, nil)
+}
+
+// Index is a global secondary index with a string partition key and, optionally, a
+// string sort key, projecting all attributes.
+type Index struct {
+	Name    string
+	Key     string
+	SortKey string
+}
+
+// CreateIndex adds ix to table unless it exists, and waits until it is active.
+// Backfilling a new index can take long on big tables; run it from cmd/migrate rather
+// than the admin action when it may outlast the function timeout.
+func (db *DB) CreateIndex(ctx context.Context, table string, ix Index) error {
+	desc, err := db.describe(ctx, table)
+	if err != nil {
+		return err
+	}
+	if desc == nil {
+		return fmt.Errorf("table %s does not exist", table)
+	}
+	if !slices.ContainsFunc(desc.GlobalSecondaryIndexes, func(g struct{ IndexName, IndexStatus string }) bool { return g.IndexName == ix.Name }) {
+		attrs := []map[string]string{{"AttributeName": ix.Key, "AttributeType": "S"}}
+		schema := []map[string]string{{"AttributeName": ix.Key, "KeyType": "HASH"}}
+		if ix.SortKey != "" {
+			attrs = append(attrs, map[string]string{"AttributeName": ix.SortKey, "AttributeType": "S"})
+			schema = append(schema, map[string]string{"AttributeName": ix.SortKey, "KeyType": "RANGE"})
+		}
+		in := map[string]any{
+			"TableName":            table,
+			"AttributeDefinitions": attrs,
+			"GlobalSecondaryIndexUpdates": []map[string]any{{"Create": map[string]any{
+				"IndexName":  ix.Name,
+				"KeySchema":  schema,
+				"Projection": map[string]string{"ProjectionType": "ALL"},
+			}}},
+		}
+		if err := db.call(ctx, "UpdateTable", in, nil); err != nil {
+			return err
+		}
+	}
+	return db.wait(ctx, table, ix.Name)
+}
+
+// Item is a DynamoDB item in its attribute-value JSON form, e.g. {"id": {"S": "x"}}.
+type Item map[string]map[string]any
+
+// Backfill sets attribute on every item of table that lacks it, to the value fill
+// returns for the item; items for which fill returns false are left alone. key is the
+// table's partition key. The update is conditional on the attribute still being absent,
+// so values written concurrently by the Lambda win. It returns the items updated.
+func (db *DB) Backfill(ctx context.Context, table, key, attribute string, fill func(Item) (map[string]any, bool)) (int, error) {
+	updated := 0
+	var start Item
+	for {
+		in := map[string]any{"TableName": table}
+		if start != nil {
+			in["ExclusiveStartKey"] = start
+		}
+		var out struct {
+			Items            []Item
+			LastEvaluatedKey Item
+		}
+		if err := db.call(ctx, "Scan", in, &out); err != nil {
+			return updated, err
+		}
+		for _, item := range out.Items {
+			if _, ok := item[attribute]; ok {
+				continue
+			}
+			value, ok := fill(item)
+			if !ok {
+				continue
+			}
+			in := map[string]any{
+				"TableName":                 table,
+				"Key":                       Item{key: item[key]},
+				"UpdateExpression":          "SET #a = :v",
+				"ConditionExpression":       "attribute_exists(#k) AND attribute_not_exists(#a)",
+				"ExpressionAttributeNames":  map[string]string{"#a": attribute, "#k": key},
+				"ExpressionAttributeValues": map[string]any{":v": value},
+			}
+			err := db.call(ctx, "UpdateItem", in, nil)
+			switch {
+			case isCode(err, "ConditionalCheckFailedException"):
+				// Deleted or filled in since the scan.
+			case err != nil:
+				return updated, err
+			default:
+				updated++
+			}
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			return updated, nil
+		}
+		start = out.LastEvaluatedKey
+	}
+}
+
+// wait polls until table, and index when set, are active.
+func (db *DB) wait(ctx context.Context, table, index string) error {
+	for {
+		desc, err := db.describe(ctx, table)
+		if err != nil {
+			return err
+		}
+		if desc != nil && desc.TableStatus == "ACTIVE" {
+			active := index == ""
+			for _, g := range desc.GlobalSecondaryIndexes {
+				active = active || (g.IndexName == index && g.IndexStatus == "ACTIVE")
+			}
+			if active {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for table %s: %w", table, ctx.Err())
+		case <-time.After(db.Poll):
+		}
+	}
+}
+
+func (db *DB) call(ctx context.Context, op string, in, out any) error {
+	return db.client.JSON(ctx, "dynamodb", "DynamoDB_20120810."+op, in, out)
+}
+
+func isCode(err error, code string) bool {
+	var apiErr *awsapi.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
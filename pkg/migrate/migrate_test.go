@@ -0,0 +1,207 @@
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// fakeTable is the state fakeDynamo keeps per table.
+type fakeTable struct {
+	key     string
+	status  string
+	ttl     string
+	tags    map[string]string
+	indexes []string
+	items   []Item
+}
+
+// fakeDynamo serves the control-plane calls of DB from memory. Tables and indexes
+// become active on the first DescribeTable after their creation.
+func fakeDynamo(t *testing.T, tables map[string]*fakeTable) *httptest.Server {
+	fail := func(w http.ResponseWriter, code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#` + code + `","message":"fake"}`))
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			TableName                   string
+			ResourceArn                 string
+			KeySchema                   []map[string]string
+			Tags                        []map[string]string
+			TimeToLiveSpecification     map[string]any
+			GlobalSecondaryIndexUpdates []map[string]map[string]any
+			Key                         Item
+			ExclusiveStartKey           Item
+			ExpressionAttributeNames    map[string]string
+			ExpressionAttributeValues   map[string]map[string]any
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		name := in.TableName
+		if in.ResourceArn != "" {
+			name = strings.TrimPrefix(in.ResourceArn, "arn:aws:dynamodb:us-east-1:123:table/")
+		}
+		tbl := tables[name]
+		op := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.")
+		if tbl == nil && op != "CreateTable" {
+			fail(w, "ResourceNotFoundException")
+			return
+		}
+		var out any = map[string]any{}
+		switch op {
+		case "CreateTable":
+			if tbl != nil {
+				fail(w, "ResourceInUseException")
+				return
+			}
+			tables[name] = &fakeTable{key: in.KeySchema[0]["AttributeName"], status: "CREATING", tags: map[string]string{}}
+		case "DescribeTable":
+			var gsis []map[string]string
+			for _, ix := range tbl.indexes {
+				gsis = append(gsis, map[string]string{"IndexName": ix, "IndexStatus": "ACTIVE"})
+			}
+			out = map[string]any{"Table": map[string]any{"TableArn": "arn:aws:dynamodb:us-east-1:123:table/" + name, "TableStatus": tbl.status, "GlobalSecondaryIndexes": gsis}}
+			tbl.status = "ACTIVE"
+		case "ListTagsOfResource":
+			var tags []map[string]string
+			for k, v := range tbl.tags {
+				tags = append(tags, map[string]string{"Key": k, "Value": v})
+			}
+			out = map[string]any{"Tags": tags}
+		case "TagResource":
+			for _, tag := range in.Tags {
+				tbl.tags[tag["Key"]] = tag["Value"]
+			}
+		case "DescribeTimeToLive":
+			status := "DISABLED"
+			if tbl.ttl != "" {
+				status = "ENABLED"
+			}
+			out = map[string]any{"TimeToLiveDescription": map[string]string{"TimeToLiveStatus": status, "AttributeName": tbl.ttl}}
+		case "UpdateTimeToLive":
+			tbl.ttl, _ = in.TimeToLiveSpecification["AttributeName"].(string)
+		case "UpdateTable":
+			tbl.indexes = append(tbl.indexes, in.GlobalSecondaryIndexUpdates[0]["Create"]["IndexName"].(string))
+		case "Scan":
+			// One item per page, to exercise pagination.
+			i := 0
+			for in.ExclusiveStartKey != nil && tbl.items[i][tbl.key]["S"] != in.ExclusiveStartKey[tbl.key]["S"] {
+				i++
+			}
+			if in.ExclusiveStartKey != nil {
+				i++
+			}
+			page := map[string]any{"Items": []Item{}}
+			if i < len(tbl.items) {
+				page["Items"] = []Item{tbl.items[i]}
+				if i+1 < len(tbl.items) {
+					page["LastEvaluatedKey"] = Item{tbl.key: tbl.items[i][tbl.key]}
+				}
+			}
+			out = page
+		case "UpdateItem":
+			attr := in.ExpressionAttributeNames["#a"]
+			for _, it := range tbl.items {
+				if it[tbl.key]["S"] == in.Key[tbl.key]["S"] {
+					if _, ok := it[attr]; ok {
+						fail(w, "ConditionalCheckFailedException")
+						return
+					}
+					it[attr] = in.ExpressionAttributeValues[":v"]
+				}
+			}
+		default:
+			t.Errorf("unexpected operation %q", op)
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+}
+
+func newDB(t *testing.T, tables map[string]*fakeTable) *DB {
+	srv := fakeDynamo(t, tables)
+	t.Cleanup(srv.Close)
+	db := NewDB(&awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL})
+	db.Poll = time.Millisecond
+	return db
+}
+
+func TestRun(t *testing.T) {
+	tables := map[string]*fakeTable{}
+	db, ctx := newDB(t, tables), context.Background()
+
+	res, err := Run(ctx, db, Invites, "invites", true)
+	if err != nil || res.From != 0 || res.To != 0 || len(res.Pending) != 1 || len(tables) != 0 {
+		t.Fatalf("dry run: %+v (%v), tables %v", res, err, tables)
+	}
+	res, err = Run(ctx, db, Invites, "invites", false)
+	if err != nil || res.To != 1 || len(res.Applied) != 1 {
+		t.Fatalf("run: %+v (%v)", res, err)
+	}
+	if tbl := tables["invites"]; tbl == nil || tbl.key != "id" || tbl.ttl != "expiresAt" || tbl.tags[VersionTag] != "1" {
+		t.Fatalf("unexpected table %+v", tbl)
+	}
+	// Up to date: nothing to do.
+	if res, err = Run(ctx, db, Invites, "invites", false); err != nil || res.From != 1 || len(res.Applied) != 0 {
+		t.Fatalf("rerun: %+v (%v)", res, err)
+	}
+	if _, err := Run(ctx, db, "jobs", "jobs", false); err == nil {
+		t.Fatal("expected an unknown kind to fail")
+	}
+}
+
+func TestRunExistingTable(t *testing.T) {
+	// Tables created by hand before migrations existed are adopted, not recreated.
+	tables := map[string]*fakeTable{"leo-store": {key: "key", status: "ACTIVE", ttl: "expiresAt", tags: map[string]string{}}}
+	db := newDB(t, tables)
+	res, err := Run(context.Background(), db, Store, "leo-store", false)
+	if err != nil || res.To != 1 || tables["leo-store"].tags[VersionTag] != "1" {
+		t.Fatalf("%+v (%v)", res, err)
+	}
+	tables["other"] = &fakeTable{key: "id", status: "ACTIVE", ttl: "ttl", tags: map[string]string{}}
+	if err := db.EnableTTL(context.Background(), "other", "expiresAt"); err == nil {
+		t.Fatal("expected TTL on another attribute to be an error")
+	}
+}
+
+func TestIndexAndBackfill(t *testing.T) {
+	tables := map[string]*fakeTable{"invites": {key: "id", status: "ACTIVE", tags: map[string]string{}, items: []Item{
+		{"id": {"S": "a"}, "contract": {"S": "token.aleo"}},
+		{"id": {"S": "b"}, "contract": {"S": "nft.aleo"}, "network": {"S": "testnet"}},
+		{"id": {"S": "c"}},
+	}}}
+	db, ctx := newDB(t, tables), context.Background()
+	for range 2 {
+		if err := db.CreateIndex(ctx, "invites", Index{Name: "by-network", Key: "network", SortKey: "contract"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := tables["invites"].indexes; len(got) != 1 || got[0] != "by-network" {
+		t.Fatalf("unexpected indexes %v", got)
+	}
+	n, err := db.Backfill(ctx, "invites", "id", "network", func(it Item) (map[string]any, bool) {
+		_, ok := it["contract"]
+		return map[string]any{"S": "mainnet"}, ok
+	})
+	items := tables["invites"].items
+	if err != nil || n != 1 || items[0]["network"]["S"] != "mainnet" || items[1]["network"]["S"] != "testnet" || items[2]["network"] != nil {
+		t.Fatalf("backfilled %d (%v): %v", n, err, items)
+	}
+}
+
+func TestTargets(t *testing.T) {
+	env := map[string]string{"STORE": "dynamodb://leo-store", "INVITE_TABLE": "invites", "CONTRACT_QUOTA_TABLE": "quotas", "ROLLUP_TABLE": "rollups"}
+	got := Targets(func(k string) string { return env[k] })
+	if len(got) != 4 || got[0] != (Target{Store, "leo-store"}) || got[1] != (Target{Invites, "invites"}) || got[2] != (Target{ContractQuotas, "quotas"}) || got[3] != (Target{Rollups, "rollups"}) {
+		t.Fatalf("unexpected targets %v", got)
+	}
+	env["STORE"] = "s3://bucket/leo"
+	if got := Targets(func(k string) string { return env[k] }); len(got) != 3 {
+		t.Fatalf("expected S3 stores to be skipped, got %v", got)
+	}
+}
@@ -0,0 +1,135 @@
+// Package mixed encodes a run's response as multipart/mixed: a JSON part with
+// everything but the output, then stdout and stderr as they are, without the escaping
+// a JSON string needs.
+package mixed
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// MediaType is the media type a caller accepts to get responses in parts.
+const MediaType = "multipart/mixed"
+
+// Part names, given in each part's Content-Disposition.
+const (
+	PartMeta   = "meta"
+	PartStdout = "stdout"
+	PartStderr = "stderr"
+)
+
+// Parts is a response split into its metadata and output.
+type Parts struct {
+	// Meta is the JSON response without stdout and stderr.
+	Meta   json.RawMessage
+	Stdout []byte
+	Stderr []byte
+}
+
+// Accepts reports whether an Accept header value asks for multipart/mixed.
+func Accepts(accept string) bool {
+	for r := range strings.SplitSeq(accept, ",") {
+		if t, _, err := mime.ParseMediaType(strings.TrimSpace(r)); err == nil && t == MediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Encode splits body, a JSON object with string fields stdout and stderr, into parts.
+// It returns the Content-Type, with the boundary, and the encoded body.
+func Encode(body []byte) (string, []byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", nil, err
+	}
+	var p Parts
+	for name, dst := range map[string]*[]byte{"stdout": &p.Stdout, "stderr": &p.Stderr} {
+		var s string
+		if raw, ok := fields[name]; ok {
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return "", nil, fmt.Errorf("%s: %w", name, err)
+			}
+			delete(fields, name)
+		}
+		*dst = []byte(s)
+	}
+	meta, err := json.Marshal(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	p.Meta = meta
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, part := range []struct {
+		name, contentType string
+		data              []byte
+	}{
+		{PartMeta, "application/json", p.Meta},
+		{PartStdout, "application/octet-stream", p.Stdout},
+		{PartStderr, "application/octet-stream", p.Stderr},
+	} {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", part.contentType)
+		h.Set("Content-Disposition", fmt.Sprintf("inline; name=%q", part.name))
+		pw, err := w.CreatePart(h)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := pw.Write(part.data); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+	return mime.FormatMediaType(MediaType, map[string]string{"boundary": w.Boundary()}), buf.Bytes(), nil
+}
+
+// Decode reads the parts of a multipart/mixed body with the given Content-Type. Parts
+// it does not know are skipped; a missing meta part is an error.
+func Decode(contentType string, body []byte) (Parts, error) {
+	var p Parts
+	t, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return p, err
+	}
+	if t != MediaType || params["boundary"] == "" {
+		return p, fmt.Errorf("not %s: %s", MediaType, contentType)
+	}
+	r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return p, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return p, err
+		}
+		_, disp, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		switch disp["name"] {
+		case PartMeta:
+			p.Meta = data
+		case PartStdout:
+			p.Stdout = data
+		case PartStderr:
+			p.Stderr = data
+		}
+	}
+	if p.Meta == nil {
+		return p, errors.New("missing meta part")
+	}
+	return p, nil
+}
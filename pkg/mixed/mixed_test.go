@@ -0,0 +1,46 @@
+package mixed
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	stdout := "line \"one\"\n\ttab <b>\n"
+	body, _ := json.Marshal(map[string]any{"exitCode": 0, "stdout": stdout, "stderr": "warn\n", "meta": map[string]string{"transactionId": "at1"}})
+	contentType, out, err := Encode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(contentType, "multipart/mixed; boundary=") || !strings.Contains(string(out), stdout) {
+		t.Fatalf("output not kept raw: %s\n%s", contentType, out)
+	}
+	p, err := Decode(contentType, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.Stdout) != stdout || string(p.Stderr) != "warn\n" {
+		t.Fatalf("unexpected output %q %q", p.Stdout, p.Stderr)
+	}
+	var meta map[string]any
+	if err := json.Unmarshal(p.Meta, &meta); err != nil || meta["stdout"] != nil || meta["exitCode"] != float64(0) {
+		t.Fatalf("unexpected meta %s %v", p.Meta, err)
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"multipart/mixed":                       true,
+		"application/json, multipart/mixed;q=1": true,
+		"application/json":                      false,
+		"":                                      false,
+	} {
+		if got := Accepts(accept); got != want {
+			t.Errorf("Accepts(%q) = %v", accept, got)
+		}
+	}
+	if _, err := Decode("application/json", nil); err == nil {
+		t.Fatal("expected an error for a JSON body")
+	}
+}
@@ -0,0 +1,70 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Event is one effect of a confirmed execution: an output of one of its transitions,
+// such as a record or a future, or a finalize operation on a mapping. Endpoints report
+// finalize operations by the hashes of the mapping, key and value only.
+type Event struct {
+	// Kind is "output" or "finalize".
+	Kind       string `json:"kind"`
+	Program    string `json:"program,omitempty"`
+	Function   string `json:"function,omitempty"`
+	Transition string `json:"transition,omitempty"`
+	// Type is the output's type ("record", "public", "future", ...) or the finalize
+	// operation ("update_key_value", "remove_key_value", ...).
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	Value     string `json:"value,omitempty"`
+	MappingID string `json:"mappingId,omitempty"`
+	KeyID     string `json:"keyId,omitempty"`
+	ValueID   string `json:"valueId,omitempty"`
+}
+
+// confirmed is the part of a confirmed transaction that events are read from.
+type confirmed struct {
+	Status      string `json:"status"`
+	Transaction struct {
+		Execution struct {
+			Transitions []struct {
+				ID       string `json:"id"`
+				Program  string `json:"program"`
+				Function string `json:"function"`
+				Outputs  []struct {
+					Type  string `json:"type"`
+					ID    string `json:"id"`
+					Value string `json:"value"`
+				} `json:"outputs"`
+			} `json:"transitions"`
+		} `json:"execution"`
+	} `json:"transaction"`
+	Finalize []struct {
+		Type      string `json:"type"`
+		MappingID string `json:"mapping_id"`
+		KeyID     string `json:"key_id"`
+		ValueID   string `json:"value_id"`
+	} `json:"finalize"`
+}
+
+// ParseEvents reads a confirmed transaction, as returned by WaitConfirmed, and returns its
+// status ("accepted" or "rejected") with the outputs of its execution's transitions,
+// in order, followed by its finalize operations. The fee transition is not included.
+func ParseEvents(body []byte) (status string, events []Event, err error) {
+	var c confirmed
+	if err := json.Unmarshal(body, &c); err != nil {
+		return "", nil, fmt.Errorf("decode confirmed transaction: %w", err)
+	}
+	events = []Event{}
+	for _, t := range c.Transaction.Execution.Transitions {
+		for _, o := range t.Outputs {
+			events = append(events, Event{Kind: "output", Program: t.Program, Function: t.Function, Transition: t.ID, Type: o.Type, ID: o.ID, Value: o.Value})
+		}
+	}
+	for _, f := range c.Finalize {
+		events = append(events, Event{Kind: "finalize", Type: f.Type, MappingID: f.MappingID, KeyID: f.KeyID, ValueID: f.ValueID})
+	}
+	return c.Status, events, nil
+}
@@ -0,0 +1,306 @@
+// Package network holds per-network presets (RPC endpoint, default priority fee and
+// explorer URL) selected by the request's --network flag.
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/classify"
+)
+
+// Preset configures one Aleo network.
+type Preset struct {
+	// Endpoint is injected as --endpoint when the request does not pin one.
+	Endpoint string `json:"endpoint"`
+	// PriorityFee, in microcredits, is injected as --priority-fee for execute when absent.
+	PriorityFee uint64 `json:"priorityFee,omitempty"`
+	// Explorer is a transaction URL template rendered by Link.Render. It overrides
+	// DefaultExplorers for this network.
+	Explorer string `json:"explorer,omitempty"`
+	// ID is the chain's network ID as reported in block headers. It is only needed for
+	// networks missing from IDs.
+	ID *uint16 `json:"id,omitempty"`
+}
+
+// Presets maps network names (e.g. mainnet, testnet, canary) to their presets.
+type Presets map[string]Preset
+
+// ParsePresets decodes the NETWORKS JSON object. An empty string yields no presets.
+func ParsePresets(raw string) (Presets, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var p Presets
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return nil, fmt.Errorf("invalid NETWORKS: %w", err)
+	}
+	for name, preset := range p {
+		if strings.TrimSpace(preset.Endpoint) == "" {
+			return nil, fmt.Errorf("invalid NETWORKS: network %q has no endpoint", name)
+		}
+	}
+	return p, nil
+}
+
+// Lookup returns the preset for name, matching case-insensitively.
+func (p Presets) Lookup(name string) (Preset, bool) {
+	if pr, ok := p[name]; ok {
+		return pr, true
+	}
+	for n, pr := range p {
+		if strings.EqualFold(n, name) {
+			return pr, true
+		}
+	}
+	return Preset{}, false
+}
+
+// IDs are the network IDs snarkOS reports in block headers for the public networks.
+var IDs = map[string]uint16{
+	"mainnet": 0,
+	"testnet": 1,
+	"canary":  2,
+}
+
+// ID returns the expected network ID for name: the preset's, else the public one.
+func (p Presets) ID(name string) (uint16, bool) {
+	if pr, ok := p.Lookup(name); ok && pr.ID != nil {
+		return *pr.ID, true
+	}
+	id, ok := IDs[strings.ToLower(name)]
+	return id, ok
+}
+
+// Name returns the public network name for id, or the number when it is not one.
+func Name(id uint16) string {
+	for n, v := range IDs {
+		if v == id {
+			return n
+		}
+	}
+	return strconv.Itoa(int(id))
+}
+
+// DefaultExplorers are the transaction URL templates used for networks without an
+// explorer in their preset.
+var DefaultExplorers = map[string]string{
+	"mainnet": "https://explorer.provable.com/transaction/{txid}",
+	"testnet": "https://testnet.explorer.provable.com/transaction/{txid}",
+}
+
+// Explorer returns the explorer template for the named network: the preset's, else the
+// default, else "".
+func (p Presets) Explorer(name string) string {
+	if pr, ok := p.Lookup(name); ok && pr.Explorer != "" {
+		return pr.Explorer
+	}
+	return DefaultExplorers[strings.ToLower(name)]
+}
+
+// Link holds the values substituted into explorer templates.
+type Link struct {
+	TxID    string
+	Network string
+	Program string
+}
+
+// Render expands {txid}, {network} and {program} in tmpl. A template without {txid}
+// gets the transaction ID appended as a path segment. It returns "" when tmpl or the
+// transaction ID is empty.
+func (l Link) Render(tmpl string) string {
+	if tmpl == "" || l.TxID == "" {
+		return ""
+	}
+	if !strings.Contains(tmpl, "{txid}") {
+		tmpl = strings.TrimRight(tmpl, "/") + "/{txid}"
+	}
+	return strings.NewReplacer("{txid}", l.TxID, "{network}", l.Network, "{program}", l.Program).Replace(tmpl)
+}
+
+// transactionID matches a bech32 Aleo transaction ID.
+var transactionID = regexp.MustCompile(`\bat1[02-9ac-hj-np-z]{58}\b`)
+
+// TransactionID returns the first Aleo transaction ID found in output, if any.
+func TransactionID(output string) string {
+	return transactionID.FindString(output)
+}
+
+var programID = regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9_]*\.aleo\b`)
+
+// ProgramID returns the first program ID (e.g. "token.aleo") found in output, if any.
+func ProgramID(output string) string {
+	return programID.FindString(output)
+}
+
+// TransportError reports whether leo's stderr looks like the endpoint was unreachable or
+// overloaded, as opposed to the program or transaction itself being rejected. It only
+// applies the built-in rules; see classify.Rules.Match for STDERR_RULES.
+func TransportError(stderr string) bool {
+	return classify.Builtin.Match(classify.Network, stderr)
+}
+
+// maxConfirmedBytes bounds a confirmed transaction read from an endpoint.
+const maxConfirmedBytes = 8 << 20
+
+// ErrNotConfirmed is returned when a transaction is still unconfirmed at the deadline.
+var ErrNotConfirmed = errors.New("transaction not confirmed")
+
+// WaitConfirmed polls endpoint's /{network}/transaction/confirmed/{txid} every interval
+// until the transaction is found or ctx is done, and returns the confirmed transaction
+// as the endpoint serves it.
+func WaitConfirmed(ctx context.Context, hc *http.Client, endpoint, network, txID string, interval time.Duration) ([]byte, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	u := strings.TrimRight(endpoint, "/") + "/" + url.PathEscape(network) + "/transaction/confirmed/" + url.PathEscape(txID)
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err := hc.Do(req); err == nil {
+			body, err := io.ReadAll(io.LimitReader(resp.Body, maxConfirmedBytes))
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && err == nil {
+				return body, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ErrNotConfirmed
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Broadcast submits a transaction, as the JSON leo builds, to endpoint's
+// /{network}/transaction/broadcast and returns the transaction ID the node reports.
+func Broadcast(ctx context.Context, hc *http.Client, endpoint, network string, tx []byte) (string, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	u := strings.TrimRight(endpoint, "/") + "/" + url.PathEscape(network) + "/transaction/broadcast"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(tx))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s: %s", u, resp.Status, bytes.TrimSpace(body))
+	}
+	var id string
+	if json.Unmarshal(body, &id) != nil {
+		id = TransactionID(string(body))
+	}
+	return id, nil
+}
+
+// MappingValue returns the value stored under key in program's mapping, as served by
+// endpoint's /{network}/program/{program}/mapping/{mapping}/{key}. found is false when
+// the key is not set.
+func MappingValue(ctx context.Context, hc *http.Client, endpoint, network, program, mapping, key string) (value string, found bool, err error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	u := strings.TrimRight(endpoint, "/") + "/" + url.PathEscape(network) + "/program/" + url.PathEscape(program) + "/mapping/" + url.PathEscape(mapping) + "/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	// Unset keys are served as null.
+	var v *string
+	if err := json.Unmarshal(body, &v); err != nil {
+		return "", false, fmt.Errorf("%s: decode value: %w", u, err)
+	}
+	if v == nil {
+		return "", false, nil
+	}
+	return *v, true, nil
+}
+
+// LatestHeight returns the latest block height reported by endpoint for network, a
+// cheap liveness probe.
+func LatestHeight(ctx context.Context, hc *http.Client, endpoint, network string) (uint64, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	u := strings.TrimRight(endpoint, "/") + "/" + url.PathEscape(network) + "/block/height/latest"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	var height uint64
+	if err := json.NewDecoder(resp.Body).Decode(&height); err != nil {
+		return 0, fmt.Errorf("%s: decode height: %w", u, err)
+	}
+	return height, nil
+}
+
+// ChainID returns the network ID in the header of the latest block served by endpoint
+// under the network path, i.e. which chain the endpoint's node actually follows.
+func ChainID(ctx context.Context, hc *http.Client, endpoint, network string) (uint16, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	u := strings.TrimRight(endpoint, "/") + "/" + url.PathEscape(network) + "/block/latest"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	var block struct {
+		Header struct {
+			Metadata struct {
+				Network *uint16 `json:"network"`
+			} `json:"metadata"`
+		} `json:"header"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&block); err != nil {
+		return 0, fmt.Errorf("%s: decode block: %w", u, err)
+	}
+	if block.Header.Metadata.Network == nil {
+		return 0, fmt.Errorf("%s: block header has no network ID", u)
+	}
+	return *block.Header.Metadata.Network, nil
+}
@@ -0,0 +1,220 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const txID = "at1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq"
+
+func TestParsePresets(t *testing.T) {
+	p, err := ParsePresets(`{"mainnet":{"endpoint":"https://rpc","priorityFee":1000,"explorer":"https://explorer/tx/{txid}"}}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	m, ok := p.Lookup("MainNet")
+	if !ok || m.PriorityFee != 1000 {
+		t.Fatalf("unexpected preset %+v (found=%v)", m, ok)
+	}
+	if got := (Link{TxID: txID}).Render(p.Explorer("mainnet")); got != "https://explorer/tx/"+txID {
+		t.Fatalf("unexpected explorer url %q", got)
+	}
+	if got := p.Explorer("testnet"); got != DefaultExplorers["testnet"] {
+		t.Fatalf("expected default explorer for testnet, got %q", got)
+	}
+	if _, err := ParsePresets(`{"testnet":{}}`); err == nil {
+		t.Fatalf("expected error for preset without endpoint")
+	}
+}
+
+func TestLinkRender(t *testing.T) {
+	l := Link{TxID: txID, Network: "testnet", Program: "token.aleo"}
+	if got := l.Render("https://explorer/tx/"); got != "https://explorer/tx/"+txID {
+		t.Fatalf("unexpected appended url %q", got)
+	}
+	if got := l.Render("https://{network}.scan/{program}/{txid}"); got != "https://testnet.scan/token.aleo/"+txID {
+		t.Fatalf("unexpected templated url %q", got)
+	}
+	if got := (Link{}).Render("https://explorer/{txid}"); got != "" {
+		t.Fatalf("expected no url without a transaction id, got %q", got)
+	}
+}
+
+func TestProgramID(t *testing.T) {
+	if got := ProgramID("📦 Deploying 'token_v2.aleo' to testnet"); got != "token_v2.aleo" {
+		t.Fatalf("unexpected program %q", got)
+	}
+}
+
+func TestTransactionID(t *testing.T) {
+	out := "Broadcasting...\n✅ Transaction " + txID + " confirmed\n"
+	if got := TransactionID(out); got != txID {
+		t.Fatalf("expected %s, got %q", txID, got)
+	}
+	if got := TransactionID(strings.Replace(out, "at1", "xx1", 1)); got != "" {
+		t.Fatalf("expected no match, got %q", got)
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	if !TransportError("Error: error sending request for url (https://rpc): connection refused") {
+		t.Fatalf("expected connection failure to be a transport error")
+	}
+	if TransportError("Error: transaction rejected: insufficient balance") {
+		t.Fatalf("program errors are not transport errors")
+	}
+}
+
+func TestWaitConfirmed(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/testnet/transaction/confirmed/"+txID {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if calls++; calls < 3 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"accepted"}`))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if body, err := WaitConfirmed(ctx, nil, srv.URL+"/v1/", "testnet", txID, time.Millisecond); err != nil || calls != 3 || string(body) != `{"status":"accepted"}` {
+		t.Fatalf("expected confirmation on the third poll, got %q, %v after %d calls", body, err, calls)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	calls = -100
+	if _, err := WaitConfirmed(ctx, nil, srv.URL+"/v1", "testnet", txID, time.Millisecond); !errors.Is(err, ErrNotConfirmed) {
+		t.Fatalf("expected ErrNotConfirmed, got %v", err)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/v1/testnet/transaction/broadcast" || string(b) != `{"id":"tx"}` {
+			http.Error(w, "invalid transaction", http.StatusUnprocessableEntity)
+			return
+		}
+		_, _ = w.Write([]byte(`"` + txID + `"`))
+	}))
+	defer srv.Close()
+
+	if id, err := Broadcast(context.Background(), nil, srv.URL+"/v1", "testnet", []byte(`{"id":"tx"}`)); err != nil || id != txID {
+		t.Fatalf("got %q, %v", id, err)
+	}
+	if _, err := Broadcast(context.Background(), nil, srv.URL+"/v1", "testnet", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "invalid transaction") {
+		t.Fatalf("expected the node's rejection, got %v", err)
+	}
+}
+
+func TestLatestHeight(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/mainnet/block/height/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("9731245"))
+	}))
+	defer srv.Close()
+	if h, err := LatestHeight(context.Background(), nil, srv.URL+"/v1", "mainnet"); err != nil || h != 9731245 {
+		t.Fatalf("unexpected height %d (%v)", h, err)
+	}
+	if _, err := LatestHeight(context.Background(), nil, srv.URL+"/v1", "canary"); err == nil {
+		t.Fatalf("expected an error for a 404")
+	}
+}
+
+func TestChainID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/testnet/block/latest":
+			_, _ = w.Write([]byte(`{"block_hash": "ab1", "header": {"metadata": {"network": 1, "height": 42}}}`))
+		case "/v1/canary/block/latest":
+			_, _ = w.Write([]byte(`{"header": {}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	if id, err := ChainID(context.Background(), nil, srv.URL+"/v1", "testnet"); err != nil || id != 1 || Name(id) != "testnet" {
+		t.Fatalf("unexpected id %d (%v)", id, err)
+	}
+	if _, err := ChainID(context.Background(), nil, srv.URL+"/v1", "canary"); err == nil {
+		t.Fatalf("expected an error for a header without network ID")
+	}
+	if _, err := ChainID(context.Background(), nil, srv.URL+"/v1", "mainnet"); err == nil {
+		t.Fatalf("expected an error for a 404")
+	}
+
+	custom := uint16(7)
+	p := Presets{"devnet": {Endpoint: "http://x", ID: &custom}}
+	if id, ok := p.ID("devnet"); !ok || id != 7 {
+		t.Fatalf("preset id: %d %v", id, ok)
+	}
+	if id, ok := p.ID("MAINNET"); !ok || id != 0 {
+		t.Fatalf("public id: %d %v", id, ok)
+	}
+	if _, ok := p.ID("other"); ok {
+		t.Fatalf("unknown network should have no id")
+	}
+	if Name(7) != "7" {
+		t.Fatalf("unexpected name %q", Name(7))
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	body := `{"status":"accepted","type":"execute","transaction":{"type":"execute","id":"at1x","execution":{"transitions":[
+		{"id":"au1a","program":"token.aleo","function":"mint_private","outputs":[
+			{"type":"record","id":"1field","checksum":"2field","value":"record1abc"},
+			{"type":"future","id":"3field","value":"{ program_id: token.aleo }"}]}]},
+		"fee":{"transition":{"id":"au1fee","program":"credits.aleo","function":"fee_public","outputs":[{"type":"future","id":"9field"}]}}},
+		"finalize":[{"type":"update_key_value","mapping_id":"4field","key_id":"5field","value_id":"6field"}]}`
+	status, events, err := ParseEvents([]byte(body))
+	if err != nil || status != "accepted" || len(events) != 3 {
+		t.Fatalf("got %q %+v %v", status, events, err)
+	}
+	if e := events[0]; e.Kind != "output" || e.Type != "record" || e.Value != "record1abc" || e.Program != "token.aleo" || e.Transition != "au1a" {
+		t.Fatalf("unexpected record event %+v", e)
+	}
+	if e := events[2]; e.Kind != "finalize" || e.Type != "update_key_value" || e.MappingID != "4field" || e.ValueID != "6field" {
+		t.Fatalf("unexpected finalize event %+v", e)
+	}
+	if _, _, err := ParseEvents([]byte("<html>")); err == nil {
+		t.Fatal("expected an error for a non-JSON body")
+	}
+}
+
+func TestMappingValue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/testnet/program/token.aleo/mapping/account/aleo1bob":
+			_, _ = w.Write([]byte(`"10u64"`))
+		case "/testnet/program/token.aleo/mapping/account/aleo1eve":
+			_, _ = w.Write([]byte(`null`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	v, found, err := MappingValue(context.Background(), nil, srv.URL+"/", "testnet", "token.aleo", "account", "aleo1bob")
+	if err != nil || !found || v != "10u64" {
+		t.Fatalf("got %q %v %v", v, found, err)
+	}
+	if _, found, err := MappingValue(context.Background(), nil, srv.URL, "testnet", "token.aleo", "account", "aleo1eve"); err != nil || found {
+		t.Fatalf("unset key: found=%v err=%v", found, err)
+	}
+	if _, _, err := MappingValue(context.Background(), nil, srv.URL, "testnet", "token.aleo", "missing", "1u8"); err == nil {
+		t.Fatal("expected an error for an unknown mapping")
+	}
+}
@@ -0,0 +1,164 @@
+// Package notify posts short execution summaries to Slack and Discord incoming webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/quota"
+)
+
+// Outcome filters for Filter.On.
+const (
+	OnAll     = "all"
+	OnFailure = "failure"
+	OnSuccess = "success"
+)
+
+// errorSnippetBytes bounds the stderr tail included in a message.
+const errorSnippetBytes = 500
+
+// Event summarises one execution.
+type Event struct {
+	Command     string
+	Program     string
+	Function    string
+	Network     string
+	ExitCode    int
+	Duration    time.Duration
+	ExplorerURL string
+	TxID        string
+	Stderr      string
+}
+
+// Filter selects which events are sent. Empty lists match everything.
+type Filter struct {
+	On        string
+	Commands  []string
+	Contracts []string
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e Event) bool {
+	switch f.On {
+	case OnFailure:
+		if e.ExitCode == 0 {
+			return false
+		}
+	case OnSuccess:
+		if e.ExitCode != 0 {
+			return false
+		}
+	}
+	if len(f.Commands) > 0 && !slices.Contains(f.Commands, e.Command) {
+		return false
+	}
+	if len(f.Contracts) > 0 && !slices.Contains(f.Contracts, e.Program) {
+		return false
+	}
+	return true
+}
+
+// Notifier sends events to the configured webhooks.
+type Notifier struct {
+	SlackWebhook   string
+	DiscordWebhook string
+	Filter         Filter
+	// Limiter, when set, rate-limits messages so a failing loop cannot flood a channel.
+	Limiter    *quota.Tracker
+	HTTPClient *http.Client
+}
+
+// Enabled reports whether any webhook is configured.
+func (n *Notifier) Enabled() bool {
+	return n != nil && (n.SlackWebhook != "" || n.DiscordWebhook != "")
+}
+
+// ErrRateLimited is returned when a message is dropped by the limiter.
+var ErrRateLimited = errors.New("notification rate limit exceeded")
+
+// Notify posts e to every webhook if it matches the filter. It returns nil when the
+// event is filtered out.
+func (n *Notifier) Notify(ctx context.Context, e Event) error {
+	if !n.Enabled() || !n.Filter.Match(e) {
+		return nil
+	}
+	if n.Limiter != nil {
+		release, err := n.Limiter.Acquire("notify")
+		if err != nil {
+			return ErrRateLimited
+		}
+		release()
+	}
+	text := Format(e)
+	var errs []error
+	if n.SlackWebhook != "" {
+		errs = append(errs, n.post(ctx, n.SlackWebhook, map[string]string{"text": text}))
+	}
+	if n.DiscordWebhook != "" {
+		errs = append(errs, n.post(ctx, n.DiscordWebhook, map[string]string{"content": text}))
+	}
+	return errors.Join(errs...)
+}
+
+// Format renders the message shared by Slack and Discord.
+func Format(e Event) string {
+	var b strings.Builder
+	target := e.Program
+	if e.Function != "" {
+		target += "/" + e.Function
+	}
+	if e.ExitCode == 0 {
+		fmt.Fprintf(&b, "✅ leo %s %s succeeded", e.Command, target)
+	} else {
+		fmt.Fprintf(&b, "❌ leo %s %s failed (exit %d)", e.Command, target, e.ExitCode)
+	}
+	fmt.Fprintf(&b, " in %.1fs", e.Duration.Seconds())
+	if e.Network != "" {
+		fmt.Fprintf(&b, " on %s", e.Network)
+	}
+	if e.ExplorerURL != "" {
+		fmt.Fprintf(&b, "\n%s", e.ExplorerURL)
+	} else if e.TxID != "" {
+		fmt.Fprintf(&b, "\ntx: %s", e.TxID)
+	}
+	if e.ExitCode != 0 && strings.TrimSpace(e.Stderr) != "" {
+		s := strings.TrimSpace(e.Stderr)
+		if len(s) > errorSnippetBytes {
+			s = "…" + s[len(s)-errorSnippetBytes:]
+		}
+		fmt.Fprintf(&b, "\n```\n%s\n```", s)
+	}
+	return b.String()
+}
+
+func (n *Notifier) post(ctx context.Context, url string, payload any) error {
+	body, _ := json.Marshal(payload)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	hc := n.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/quota"
+)
+
+func TestNotifyPostsToBothWebhooks(t *testing.T) {
+	got := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		for k, v := range body {
+			got[r.URL.Path+":"+k] = v
+		}
+	}))
+	defer srv.Close()
+
+	n := &Notifier{SlackWebhook: srv.URL + "/slack", DiscordWebhook: srv.URL + "/discord", Filter: Filter{On: OnFailure}}
+	e := Event{Command: "execute", Program: "token.aleo", Function: "mint", ExitCode: 1, Duration: 2 * time.Second, Stderr: "boom"}
+	if err := n.Notify(context.Background(), e); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	slack := got["/slack:text"]
+	if !strings.Contains(slack, "token.aleo/mint failed (exit 1)") || !strings.Contains(slack, "boom") {
+		t.Fatalf("unexpected slack message %q", slack)
+	}
+	if got["/discord:content"] != slack {
+		t.Fatalf("discord should receive the same summary, got %q", got["/discord:content"])
+	}
+
+	clear(got)
+	e.ExitCode = 0
+	_ = n.Notify(context.Background(), e)
+	if len(got) != 0 {
+		t.Fatalf("successes must be filtered out: %v", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	f := Filter{On: OnAll, Commands: []string{"deploy"}}
+	if f.Match(Event{Command: "execute"}) || !f.Match(Event{Command: "deploy", ExitCode: 1}) {
+		t.Fatalf("command filter not applied")
+	}
+	f = Filter{Contracts: []string{"token.aleo"}}
+	if f.Match(Event{Program: "other.aleo"}) || !f.Match(Event{Program: "token.aleo"}) {
+		t.Fatalf("contract filter not applied")
+	}
+}
+
+func TestNotifyRateLimited(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls++ }))
+	defer srv.Close()
+
+	n := &Notifier{SlackWebhook: srv.URL, Limiter: quota.New(quota.Limits{RatePerMinute: 1})}
+	if err := n.Notify(context.Background(), Event{ExitCode: 1}); err != nil {
+		t.Fatalf("first notify: %v", err)
+	}
+	if err := n.Notify(context.Background(), Event{ExitCode: 1}); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected rate limit, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected one webhook call, got %d", calls)
+	}
+}
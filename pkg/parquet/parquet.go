@@ -0,0 +1,323 @@
+// Package parquet writes small, flat Parquet files: one row group, one gzip-compressed
+// PLAIN data page per column, every column optional. That is all the exporter needs
+// for Athena and keeps the Lambda free of a full Parquet implementation.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is a column's logical type.
+type Type int
+
+// Supported column types.
+const (
+	String Type = iota
+	Int64
+	Double
+	Bool
+	// Timestamp is stored as INT64 milliseconds since the epoch (TIMESTAMP_MILLIS).
+	Timestamp
+)
+
+// Column describes one optional column.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Row holds one value per column, in column order. nil is NULL; otherwise values are
+// string, int64, float64, bool or time.Time matching the column Type.
+type Row []any
+
+// Physical types, encodings and other enums of the Parquet format.
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	repetitionOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecGzip    = 2
+	pageTypeData = 0
+)
+
+var magic = []byte("PAR1")
+
+// Write encodes rows as a Parquet file.
+func Write(w io.Writer, cols []Column, rows []Row) error {
+	for i, r := range rows {
+		if len(r) != len(cols) {
+			return fmt.Errorf("row %d has %d values, want %d", i, len(r), len(cols))
+		}
+	}
+	var out bytes.Buffer
+	out.Write(magic)
+	type chunk struct {
+		offset, size, rawSize int64
+	}
+	chunks := make([]chunk, len(cols))
+	var groupSize int64
+	for i, c := range cols {
+		raw, err := encodeColumn(c, rows, i)
+		if err != nil {
+			return err
+		}
+		var z bytes.Buffer
+		gz := gzip.NewWriter(&z)
+		_, _ = gz.Write(raw)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		var h thrift
+		h.begin()
+		h.i32(1, pageTypeData)
+		h.i32(2, int32(len(raw)))
+		h.i32(3, int32(z.Len()))
+		h.structField(5)
+		h.i32(1, int32(len(rows)))
+		h.i32(2, encodingPlain)
+		h.i32(3, encodingRLE)
+		h.i32(4, encodingRLE)
+		h.end()
+		h.end()
+		chunks[i] = chunk{
+			offset:  int64(out.Len()),
+			size:    int64(h.buf.Len() + z.Len()),
+			rawSize: int64(h.buf.Len() + len(raw)),
+		}
+		groupSize += chunks[i].rawSize
+		out.Write(h.buf.Bytes())
+		out.Write(z.Bytes())
+	}
+
+	var f thrift
+	f.begin()
+	f.i32(1, 1)
+	f.list(2, tStruct, len(cols)+1)
+	f.begin()
+	f.binary(4, "schema")
+	f.i32(5, int32(len(cols)))
+	f.end()
+	for _, c := range cols {
+		f.begin()
+		f.i32(1, physical(c.Type))
+		f.i32(3, repetitionOptional)
+		f.binary(4, c.Name)
+		switch c.Type {
+		case String:
+			f.i32(6, convertedUTF8)
+		case Timestamp:
+			f.i32(6, convertedTimestampMillis)
+		}
+		f.end()
+	}
+	f.i64(3, int64(len(rows)))
+	f.list(4, tStruct, 1)
+	f.begin()
+	f.list(1, tStruct, len(cols))
+	for i, c := range cols {
+		f.begin()
+		f.i64(2, chunks[i].offset)
+		f.structField(3)
+		f.i32(1, physical(c.Type))
+		f.list(2, tI32, 2)
+		f.varint(zigzag(encodingPlain))
+		f.varint(zigzag(encodingRLE))
+		f.list(3, tBinary, 1)
+		f.varint(uint64(len(c.Name)))
+		f.buf.WriteString(c.Name)
+		f.i32(4, codecGzip)
+		f.i64(5, int64(len(rows)))
+		f.i64(6, chunks[i].rawSize)
+		f.i64(7, chunks[i].size)
+		f.i64(9, chunks[i].offset)
+		f.end()
+		f.end()
+	}
+	f.i64(2, groupSize)
+	f.i64(3, int64(len(rows)))
+	f.end()
+	f.binary(6, "leo-lambda")
+	f.end()
+
+	out.Write(f.buf.Bytes())
+	_ = binary.Write(&out, binary.LittleEndian, uint32(f.buf.Len()))
+	out.Write(magic)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func physical(t Type) int32 {
+	switch t {
+	case Int64, Timestamp:
+		return typeInt64
+	case Double:
+		return typeDouble
+	case Bool:
+		return typeBoolean
+	}
+	return typeByteArray
+}
+
+// encodeColumn returns the uncompressed data page body of column i: the definition
+// levels (RLE, bit width 1, length-prefixed) followed by the PLAIN non-null values.
+func encodeColumn(c Column, rows []Row, i int) ([]byte, error) {
+	var levels, values bytes.Buffer
+	run, prev := 0, byte(0)
+	flush := func() {
+		if run > 0 {
+			levels.Write(binary.AppendUvarint(nil, uint64(run)<<1))
+			levels.WriteByte(prev)
+		}
+	}
+	var bits []bool
+	for n, r := range rows {
+		v := r[i]
+		level := byte(0)
+		if v != nil {
+			level = 1
+		}
+		if level != prev || run == 0 {
+			flush()
+			run, prev = 0, level
+		}
+		run++
+		if v == nil {
+			continue
+		}
+		switch c.Type {
+		case String:
+			s, ok := v.(string)
+			if !ok {
+				return nil, typeError(c, n, v)
+			}
+			_ = binary.Write(&values, binary.LittleEndian, uint32(len(s)))
+			values.WriteString(s)
+		case Int64:
+			x, ok := v.(int64)
+			if !ok {
+				return nil, typeError(c, n, v)
+			}
+			_ = binary.Write(&values, binary.LittleEndian, x)
+		case Timestamp:
+			t, ok := v.(time.Time)
+			if !ok {
+				return nil, typeError(c, n, v)
+			}
+			_ = binary.Write(&values, binary.LittleEndian, t.UnixMilli())
+		case Double:
+			x, ok := v.(float64)
+			if !ok {
+				return nil, typeError(c, n, v)
+			}
+			_ = binary.Write(&values, binary.LittleEndian, math.Float64bits(x))
+		case Bool:
+			b, ok := v.(bool)
+			if !ok {
+				return nil, typeError(c, n, v)
+			}
+			bits = append(bits, b)
+		}
+	}
+	flush()
+	if len(bits) > 0 {
+		packed := make([]byte, (len(bits)+7)/8)
+		for j, b := range bits {
+			if b {
+				packed[j/8] |= 1 << (j % 8)
+			}
+		}
+		values.Write(packed)
+	}
+	out := binary.LittleEndian.AppendUint32(nil, uint32(levels.Len()))
+	out = append(out, levels.Bytes()...)
+	return append(out, values.Bytes()...), nil
+}
+
+func typeError(c Column, row int, v any) error {
+	return fmt.Errorf("row %d: column %s: unexpected %T", row, c.Name, v)
+}
+
+// Thrift compact protocol type IDs.
+const (
+	tI32    = 5
+	tI64    = 6
+	tBinary = 8
+	tList   = 9
+	tStruct = 12
+)
+
+// thrift is a minimal Thrift compact protocol encoder for the Parquet metadata.
+type thrift struct {
+	buf  bytes.Buffer
+	last []int16 // last field ID per open struct
+}
+
+func (t *thrift) begin() { t.last = append(t.last, 0) }
+
+func (t *thrift) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if d := id - *last; d > 0 && d <= 15 {
+		t.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (t *thrift) varint(v uint64) { t.buf.Write(binary.AppendUvarint(nil, v)) }
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, tI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, tI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, tBinary)
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// structField opens a nested struct field; close it with end.
+func (t *thrift) structField(id int16) {
+	t.field(id, tStruct)
+	t.begin()
+}
+
+// list writes a list field header; the caller writes the n elements.
+func (t *thrift) list(id int16, elem byte, n int) {
+	t.field(id, tList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.varint(uint64(n))
+}
+
+func zigzag(v int64) uint64 { return uint64(v<<1) ^ uint64(v>>63) }
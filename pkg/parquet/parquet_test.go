@@ -0,0 +1,120 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+// readCompact decodes a Thrift compact struct into field ID -> value, where values
+// are int64, []byte, []any or map[int16]any. It only covers what Write emits.
+func readCompact(t *testing.T, r *bytes.Reader) map[int16]any {
+	t.Helper()
+	out := map[int16]any{}
+	var last int16
+	for {
+		h, _ := r.ReadByte()
+		if h == 0 {
+			return out
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			v, _ := binary.ReadUvarint(r)
+			id = int16(unzigzag(v))
+		}
+		last = id
+		out[id] = readValue(t, r, h&0x0f)
+	}
+}
+
+func readValue(t *testing.T, r *bytes.Reader, typ byte) any {
+	switch typ {
+	case tI32, tI64:
+		v, _ := binary.ReadUvarint(r)
+		return unzigzag(v)
+	case tBinary:
+		n, _ := binary.ReadUvarint(r)
+		b := make([]byte, n)
+		_, _ = io.ReadFull(r, b)
+		return b
+	case tStruct:
+		return readCompact(t, r)
+	case tList:
+		h, _ := r.ReadByte()
+		n := uint64(h >> 4)
+		if n == 15 {
+			n, _ = binary.ReadUvarint(r)
+		}
+		var l []any
+		for range n {
+			l = append(l, readValue(t, r, h&0x0f))
+		}
+		return l
+	}
+	t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+func unzigzag(v uint64) int64 { return int64(v>>1) ^ -int64(v&1) }
+
+func TestWriteRoundTrip(t *testing.T) {
+	cols := []Column{{"id", String}, {"exit_code", Int64}, {"ok", Bool}, {"at", Timestamp}}
+	at := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := []Row{
+		{"a", int64(0), true, at},
+		{"b", nil, false, nil},
+		{"c", int64(1), nil, at},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, cols, rows); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, magic) || !bytes.HasSuffix(file, magic) {
+		t.Fatalf("missing PAR1 magic")
+	}
+	n := binary.LittleEndian.Uint32(file[len(file)-8:])
+	meta := readCompact(t, bytes.NewReader(file[len(file)-8-int(n):len(file)-8]))
+	if meta[3].(int64) != 3 {
+		t.Fatalf("expected 3 rows, got %v", meta[3])
+	}
+	schema := meta[2].([]any)
+	if len(schema) != 5 || string(schema[1].(map[int16]any)[4].([]byte)) != "id" {
+		t.Fatalf("unexpected schema: %v", schema)
+	}
+
+	// Decode the exit_code column: levels 1,0,1 and values 0,1.
+	chunk := meta[4].([]any)[0].(map[int16]any)[1].([]any)[1].(map[int16]any)[3].(map[int16]any)
+	r := bytes.NewReader(file[chunk[9].(int64):])
+	page := readCompact(t, r)
+	compressed := make([]byte, page[3].(int64))
+	_, _ = io.ReadFull(r, compressed)
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	raw, _ := io.ReadAll(zr)
+	if int64(len(raw)) != page[2].(int64) {
+		t.Fatalf("uncompressed size mismatch")
+	}
+	levels := raw[4 : 4+binary.LittleEndian.Uint32(raw)]
+	if !bytes.Equal(levels, []byte{2, 1, 2, 0, 2, 1}) {
+		t.Fatalf("unexpected definition levels %v", levels)
+	}
+	values := raw[4+len(levels):]
+	if len(values) != 16 || binary.LittleEndian.Uint64(values[8:]) != 1 {
+		t.Fatalf("unexpected values %v", values)
+	}
+}
+
+func TestWriteRejectsMismatchedRows(t *testing.T) {
+	if err := Write(io.Discard, []Column{{"id", String}}, []Row{{int64(1)}}); err == nil {
+		t.Fatalf("expected a type error")
+	}
+	if err := Write(io.Discard, []Column{{"id", String}}, []Row{{"a", "b"}}); err == nil {
+		t.Fatalf("expected a width error")
+	}
+}
@@ -0,0 +1,41 @@
+// Package policy maps caller groups (e.g. OIDC group claims) to the contracts their
+// members may execute.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Policy grants contracts per group.
+type Policy struct {
+	Groups map[string][]string
+}
+
+// Parse decodes a JSON object such as GROUP_CONTRACTS, e.g. {"treasury": ["token.aleo"]},
+// read from the variable name. An empty string yields a nil Policy.
+func Parse(name, raw string) (*Policy, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	p := &Policy{}
+	if err := json.Unmarshal([]byte(raw), &p.Groups); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// Allows reports whether any of groups grants contract. A nil Policy allows everything.
+func (p *Policy) Allows(groups []string, contract string) bool {
+	if p == nil {
+		return true
+	}
+	for _, g := range groups {
+		if slices.Contains(p.Groups[g], contract) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package policy
+
+import "testing"
+
+func TestAllows(t *testing.T) {
+	p, err := Parse("GROUP_CONTRACTS", `{"treasury": ["token.aleo", "credits.aleo"], "ops": ["credits.aleo"]}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !p.Allows([]string{"eng", "treasury"}, "token.aleo") || p.Allows([]string{"ops"}, "token.aleo") || p.Allows(nil, "credits.aleo") {
+		t.Fatalf("unexpected decisions")
+	}
+	var none *Policy
+	if !none.Allows(nil, "token.aleo") {
+		t.Fatalf("a nil policy should allow everything")
+	}
+	if _, err := Parse("GROUP_CONTRACTS", `["token.aleo"]`); err == nil {
+		t.Fatalf("expected an error for a non-object")
+	}
+}
@@ -0,0 +1,86 @@
+// Package profile defines execution profiles: one request-level knob ("fast" or
+// "thorough") that tunes retries, confirmation polling, output verbosity and caching.
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Profile names.
+const (
+	Fast     = "fast"
+	Thorough = "thorough"
+)
+
+// Output verbosity.
+const (
+	// OutputMinimal keeps only the tail of stdout and drops stderr on success.
+	OutputMinimal = "minimal"
+	// OutputFull returns the usual output and, when an output bucket is configured,
+	// uploads the untruncated stdout/stderr to S3.
+	OutputFull = "full"
+)
+
+// MinimalOutputBytes is the stdout tail kept by OutputMinimal.
+const MinimalOutputBytes = 4096
+
+// Profile tunes one execution.
+type Profile struct {
+	// Retries re-runs read commands that failed with a transport error.
+	Retries int `json:"retries"`
+	// WaitConfirmation polls the endpoint until a broadcast transaction is confirmed.
+	WaitConfirmation bool `json:"waitConfirmation"`
+	// ConfirmTimeoutSeconds bounds the confirmation wait (further capped by the
+	// invocation's time budget).
+	ConfirmTimeoutSeconds int `json:"confirmTimeoutSeconds"`
+	// Output is OutputMinimal or OutputFull.
+	Output string `json:"output"`
+	// Cache reuses recent successful responses of read commands.
+	Cache bool `json:"cache"`
+}
+
+// ConfirmTimeout returns ConfirmTimeoutSeconds as a duration.
+func (p Profile) ConfirmTimeout() time.Duration {
+	return time.Duration(p.ConfirmTimeoutSeconds) * time.Second
+}
+
+// Defaults are the built-in profiles.
+var Defaults = Set{
+	Fast:     {Retries: 0, WaitConfirmation: false, Output: OutputMinimal, Cache: true},
+	Thorough: {Retries: 2, WaitConfirmation: true, ConfirmTimeoutSeconds: 120, Output: OutputFull, Cache: false},
+}
+
+// Set maps profile names to their settings.
+type Set map[string]Profile
+
+// Parse applies per-deployment overrides, a JSON object such as
+// {"thorough": {"retries": 1}}, on top of Defaults. Omitted fields keep their defaults.
+func Parse(raw string) (Set, error) {
+	s := Set{}
+	for name, p := range Defaults {
+		s[name] = p
+	}
+	if raw == "" {
+		return s, nil
+	}
+	var overrides map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("invalid PROFILES: %w", err)
+	}
+	for name, o := range overrides {
+		p, ok := s[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid PROFILES: unknown profile %q (want %s or %s)", name, Fast, Thorough)
+		}
+		if err := json.Unmarshal(o, &p); err != nil {
+			return nil, fmt.Errorf("invalid PROFILES: %s: %w", name, err)
+		}
+		if p.Output != OutputMinimal && p.Output != OutputFull {
+			return nil, fmt.Errorf("invalid PROFILES: %s: output must be %s or %s", name, OutputMinimal, OutputFull)
+		}
+		s[name] = p
+	}
+	return s, nil
+}
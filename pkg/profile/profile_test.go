@@ -0,0 +1,22 @@
+package profile
+
+import "testing"
+
+func TestParseOverridesDefaults(t *testing.T) {
+	s, err := Parse(`{"thorough": {"retries": 5}, "fast": {"cache": false}}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	th := s[Thorough]
+	if th.Retries != 5 || !th.WaitConfirmation || th.Output != OutputFull {
+		t.Fatalf("override should keep other defaults, got %+v", th)
+	}
+	if s[Fast].Cache || Defaults[Fast].Cache != true {
+		t.Fatalf("override must not leak into Defaults")
+	}
+	for _, raw := range []string{`{"slow": {}}`, `{"fast": {"output": "loud"}}`, `[]`} {
+		if _, err := Parse(raw); err == nil {
+			t.Fatalf("expected error for %s", raw)
+		}
+	}
+}
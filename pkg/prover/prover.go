@@ -0,0 +1,117 @@
+// Package prover offloads `leo execute` runs to a remote proving service, such as a
+// GPU-backed fleet, so the Lambda does not spend its own CPU and time limit on proofs.
+//
+// The service receives the leo argument list as JSON and answers with the run's exit
+// code and output:
+//
+//	POST <url>  {"args": ["execute", "credits.aleo/transfer_public", ...]}
+//	200         {"exitCode": 0, "stdout": "...", "stderr": "..."}
+//
+// A service that cannot take the run answers 429 or 503 and the caller proves locally.
+package prover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// maxResponseBytes bounds how much of a prover response is read.
+const maxResponseBytes = 16 << 20
+
+// ErrUnavailable wraps errors after which nothing can have run remotely: the service
+// could not be reached or declined the run. Only these are safe to retry locally.
+var ErrUnavailable = errors.New("prover unavailable")
+
+// Result is the remote run's outcome.
+type Result struct {
+	ExitCode int    `json:"exitCode"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// Client calls one proving service.
+type Client struct {
+	URL string
+	// Token is sent as a bearer token when set.
+	Token string
+	// Contracts limits delegation to these programs; empty delegates every execute.
+	Contracts  []string
+	HTTPClient *http.Client
+}
+
+// New validates rawURL. The request carries the signing keys, so plain HTTP is only
+// accepted for loopback addresses.
+func New(rawURL, token string, contracts []string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid PROVER_URL %q", rawURL)
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if ip := net.ParseIP(u.Hostname()); u.Hostname() != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("invalid PROVER_URL %q: https is required", u.Redacted())
+		}
+	default:
+		return nil, fmt.Errorf("invalid PROVER_URL %q: want https://", u.Redacted())
+	}
+	return &Client{URL: rawURL, Token: token, Contracts: contracts}, nil
+}
+
+// Applies reports whether runs of contract are delegated.
+func (c *Client) Applies(contract string) bool {
+	return len(c.Contracts) == 0 || slices.Contains(c.Contracts, contract)
+}
+
+// Prove sends args to the service. Errors wrapping ErrUnavailable mean the run did not
+// start remotely; any other error leaves it unknown whether it did.
+func (c *Client) Prove(ctx context.Context, args []string) (Result, error) {
+	body, err := json.Marshal(map[string][]string{"args": args})
+	if err != nil {
+		return Result{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return Result{}, fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return Result{}, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		return Result{}, fmt.Errorf("%w: status %d", ErrUnavailable, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return Result{}, fmt.Errorf("prover: status %d: %s", resp.StatusCode, bytes.TrimSpace(b))
+	}
+	var res Result
+	if err := json.Unmarshal(b, &res); err != nil {
+		return Result{}, fmt.Errorf("prover: invalid response: %w", err)
+	}
+	return res, nil
+}
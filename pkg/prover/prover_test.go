@@ -0,0 +1,43 @@
+package prover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewRequiresHTTPS(t *testing.T) {
+	for _, u := range []string{"https://prover.example", "http://127.0.0.1:8080", "http://localhost/prove"} {
+		if _, err := New(u, "", nil); err != nil {
+			t.Fatalf("%s: %v", u, err)
+		}
+	}
+	for _, u := range []string{"http://prover.example", "ftp://prover.example", "prover.example"} {
+		if _, err := New(u, "", nil); err == nil {
+			t.Fatalf("%s: expected an error", u)
+		}
+	}
+}
+
+func TestProveUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	c, _ := New(srv.URL, "", nil)
+	if _, err := c.Prove(context.Background(), []string{"execute"}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("429 should be unavailable, got %v", err)
+	}
+	srv.Close()
+	if _, err := c.Prove(context.Background(), []string{"execute"}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("a refused connection should be unavailable, got %v", err)
+	}
+}
+
+func TestApplies(t *testing.T) {
+	c := &Client{Contracts: []string{"token.aleo"}}
+	if !c.Applies("token.aleo") || c.Applies("credits.aleo") || !(&Client{}).Applies("credits.aleo") {
+		t.Fatal("unexpected Applies")
+	}
+}
@@ -0,0 +1,341 @@
+// Package quota tracks per-identity rate limits, daily fee spend and concurrent
+// execution slots. Counters live in memory and are therefore scoped to a container,
+// unless rate limits and spend are delegated to a Shared store.
+package quota
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limits configures the tracker. Zero values disable the corresponding limit.
+type Limits struct {
+	// RatePerMinute is the token-bucket capacity, refilled continuously over a minute.
+	RatePerMinute int
+	// DailySpend is the fee budget in microcredits per UTC day.
+	DailySpend uint64
+	// MaxConcurrent caps in-flight executions per identity.
+	MaxConcurrent int
+}
+
+// Errors returned when a limit is exhausted.
+var (
+	ErrRateLimited  = errors.New("rate limit exceeded")
+	ErrSpendLimited = errors.New("daily spend budget exceeded")
+	ErrConcurrency  = errors.New("no concurrent execution slots available")
+)
+
+// Quota is the remaining allowance of one identity.
+type Quota struct {
+	Identity    string            `json:"identity"`
+	RateLimit   *RateQuota        `json:"rateLimit,omitempty"`
+	Spend       *SpendQuota       `json:"spend,omitempty"`
+	Concurrency *ConcurrencyQuota `json:"concurrency,omitempty"`
+}
+
+// RateQuota describes the request token bucket.
+type RateQuota struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+// SpendQuota describes the daily fee budget in microcredits.
+type SpendQuota struct {
+	Limit     uint64    `json:"limit"`
+	Used      uint64    `json:"used"`
+	Remaining uint64    `json:"remaining"`
+	ResetAt   time.Time `json:"resetAt"`
+}
+
+// ConcurrencyQuota describes concurrent execution slots.
+type ConcurrencyQuota struct {
+	Limit     int `json:"limit"`
+	InUse     int `json:"inUse"`
+	Available int `json:"available"`
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type daily struct {
+	day  string
+	used uint64
+}
+
+// Tracker holds quota state for all identities.
+type Tracker struct {
+	mu       sync.Mutex
+	limits   Limits
+	buckets  map[string]*bucket
+	spend    map[string]*daily
+	inflight map[string]int
+	now      func() time.Time
+
+	shared Shared
+	// onSharedError is told about failed Shared calls; the tracker then falls back to
+	// its own counters.
+	onSharedError func(error)
+}
+
+// New returns a tracker enforcing l.
+func New(l Limits) *Tracker {
+	return &Tracker{
+		limits:   l,
+		buckets:  map[string]*bucket{},
+		spend:    map[string]*daily{},
+		inflight: map[string]int{},
+		now:      time.Now,
+	}
+}
+
+// SetLimits replaces the limits, keeping accumulated usage.
+func (t *Tracker) SetLimits(l Limits) {
+	t.mu.Lock()
+	t.limits = l
+	t.mu.Unlock()
+}
+
+// SetShared delegates rate limits and spend to s (nil for local counters only).
+// onError, if set, is called for every failed call to s, after which the local
+// counters decide.
+func (t *Tracker) SetShared(s Shared, onError func(error)) {
+	t.mu.Lock()
+	t.shared, t.onSharedError = s, onError
+	t.mu.Unlock()
+}
+
+// Reset forgets rate-limit buckets and spend. In-flight slots are kept so outstanding
+// release functions stay balanced.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	t.buckets = map[string]*bucket{}
+	t.spend = map[string]*daily{}
+	t.mu.Unlock()
+}
+
+// Enabled reports whether any limit is configured.
+func (t *Tracker) Enabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits != Limits{}
+}
+
+// Acquire consumes one rate token and a concurrency slot for id. The returned release
+// function frees the slot and must be called once the execution finishes.
+func (t *Tracker) Acquire(id string) (release func(), err error) {
+	t.mu.Lock()
+	if t.limits.MaxConcurrent > 0 && t.inflight[id] >= t.limits.MaxConcurrent {
+		t.mu.Unlock()
+		return nil, ErrConcurrency
+	}
+	// Hold the slot while the rate token is taken, which may wait on the shared store,
+	// so concurrent calls cannot overshoot MaxConcurrent.
+	t.inflight[id]++
+	rate := t.limits.RatePerMinute
+	t.mu.Unlock()
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.inflight[id]--
+			if t.inflight[id] <= 0 {
+				delete(t.inflight, id)
+			}
+			t.mu.Unlock()
+		})
+	}
+	if rate > 0 {
+		if err := t.take(id, rate); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+// ChargeSpend records amount microcredits against id's daily budget, refusing the
+// charge when it would exceed the limit.
+func (t *Tracker) ChargeSpend(id string, amount uint64) error {
+	limits, shared := t.state()
+	if limits.DailySpend == 0 || amount == 0 {
+		return nil
+	}
+	day := t.SpendDay()
+	if shared != nil {
+		ok, used, err := shared.Charge(id, day, amount, limits.DailySpend)
+		if err == nil {
+			// Mirror the shared total so Snapshot reports it.
+			t.mirrorSpend(id, day, used)
+			if !ok {
+				return ErrSpendLimited
+			}
+			return nil
+		}
+		t.sharedFailed(err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.day(id)
+	if d.used+amount > limits.DailySpend {
+		return ErrSpendLimited
+	}
+	d.used += amount
+	return nil
+}
+
+// SpendDay is the UTC day ChargeSpend currently charges, for a later RefundSpend.
+func (t *Tracker) SpendDay() string {
+	return t.now().UTC().Format(time.DateOnly)
+}
+
+// RefundSpend gives back amount microcredits charged to id on day, for a run that was
+// refused or failed after its fee was charged. Spend never drops below zero, and a
+// refund for a day other than today only reaches the shared store.
+func (t *Tracker) RefundSpend(id, day string, amount uint64) {
+	limits, shared := t.state()
+	if limits.DailySpend == 0 || amount == 0 {
+		return
+	}
+	if shared != nil {
+		used, err := shared.Refund(id, day, amount)
+		if err == nil {
+			t.mirrorSpend(id, day, used)
+			return
+		}
+		t.sharedFailed(err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d := t.day(id); d.day == day {
+		d.used -= min(amount, d.used)
+	}
+}
+
+// take consumes a rate token for id, from the shared bucket when there is one. t.mu must
+// not be held: the shared store is called without it.
+func (t *Tracker) take(id string, rate int) error {
+	_, shared := t.state()
+	if shared != nil {
+		ok, remaining, err := shared.Take(id, rate, t.now())
+		if err == nil {
+			// Mirror the shared bucket so Snapshot and RetryAfter report it.
+			t.mu.Lock()
+			t.refill(id).tokens = remaining
+			t.mu.Unlock()
+			if !ok {
+				return ErrRateLimited
+			}
+			return nil
+		}
+		t.sharedFailed(err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.refill(id)
+	if b.tokens < 1 {
+		return ErrRateLimited
+	}
+	b.tokens--
+	return nil
+}
+
+// state returns the limits and the Shared store, so the store can be called without
+// holding t.mu.
+func (t *Tracker) state() (Limits, Shared) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limits, t.shared
+}
+
+// mirrorSpend copies id's shared total for day into the local counter, unless the day
+// has turned since.
+func (t *Tracker) mirrorSpend(id, day string, used uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d := t.day(id); d.day == day {
+		d.used = used
+	}
+}
+
+// sharedFailed reports a failed Shared call. t.mu must not be held.
+func (t *Tracker) sharedFailed(err error) {
+	t.mu.Lock()
+	onError := t.onSharedError
+	t.mu.Unlock()
+	if onError != nil {
+		onError(err)
+	}
+}
+
+// RetryAfter estimates when the next rate token for id becomes available.
+func (t *Tracker) RetryAfter(id string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limits.RatePerMinute <= 0 {
+		return 0
+	}
+	b := t.refill(id)
+	if b.tokens >= 1 {
+		return 0
+	}
+	perToken := time.Minute / time.Duration(t.limits.RatePerMinute)
+	return time.Duration((1 - b.tokens) * float64(perToken))
+}
+
+// Snapshot returns the remaining quota for id without consuming anything.
+func (t *Tracker) Snapshot(id string) Quota {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	q := Quota{Identity: id}
+	now := t.now()
+	if l := t.limits.RatePerMinute; l > 0 {
+		b := t.refill(id)
+		missing := float64(l) - b.tokens
+		reset := now.Add(time.Duration(missing / float64(l) * float64(time.Minute)))
+		q.RateLimit = &RateQuota{Limit: l, Remaining: int(math.Floor(b.tokens)), ResetAt: reset.UTC()}
+	}
+	if l := t.limits.DailySpend; l > 0 {
+		d := t.day(id)
+		q.Spend = &SpendQuota{Limit: l, Used: d.used, Remaining: l - min(d.used, l), ResetAt: nextMidnight(now)}
+	}
+	if l := t.limits.MaxConcurrent; l > 0 {
+		in := t.inflight[id]
+		q.Concurrency = &ConcurrencyQuota{Limit: l, InUse: in, Available: max(l-in, 0)}
+	}
+	return q
+}
+
+func (t *Tracker) refill(id string) *bucket {
+	now := t.now()
+	capacity := float64(t.limits.RatePerMinute)
+	b, ok := t.buckets[id]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		t.buckets[id] = b
+		return b
+	}
+	elapsed := now.Sub(b.last).Minutes()
+	b.tokens = math.Min(capacity, b.tokens+elapsed*capacity)
+	b.last = now
+	return b
+}
+
+func (t *Tracker) day(id string) *daily {
+	today := t.SpendDay()
+	d, ok := t.spend[id]
+	if !ok || d.day != today {
+		d = &daily{day: today}
+		t.spend[id] = d
+	}
+	return d
+}
+
+func nextMidnight(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,215 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRateLimitRefills(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tr := New(Limits{RatePerMinute: 2})
+	tr.now = func() time.Time { return now }
+
+	for range 2 {
+		release, err := tr.Acquire("a")
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		release()
+	}
+	if _, err := tr.Acquire("a"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected rate limit, got %v", err)
+	}
+	if _, err := tr.Acquire("b"); err != nil {
+		t.Fatalf("other identities must have their own bucket: %v", err)
+	}
+	if d := tr.RetryAfter("a"); d != 30*time.Second {
+		t.Fatalf("expected 30s retry-after, got %s", d)
+	}
+	now = now.Add(30 * time.Second)
+	if q := tr.Snapshot("a"); q.RateLimit.Remaining != 1 {
+		t.Fatalf("expected one token after 30s, got %+v", q.RateLimit)
+	}
+}
+
+func TestConcurrencySlots(t *testing.T) {
+	tr := New(Limits{MaxConcurrent: 1})
+	release, err := tr.Acquire("a")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if _, err := tr.Acquire("a"); !errors.Is(err, ErrConcurrency) {
+		t.Fatalf("expected concurrency error, got %v", err)
+	}
+	if q := tr.Snapshot("a"); q.Concurrency.Available != 0 || q.Concurrency.InUse != 1 {
+		t.Fatalf("unexpected snapshot: %+v", q.Concurrency)
+	}
+	release()
+	release()
+	if q := tr.Snapshot("a"); q.Concurrency.Available != 1 {
+		t.Fatalf("slot not released: %+v", q.Concurrency)
+	}
+}
+
+func TestDailySpendResets(t *testing.T) {
+	now := time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)
+	tr := New(Limits{DailySpend: 100})
+	tr.now = func() time.Time { return now }
+
+	if err := tr.ChargeSpend("a", 60); err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	if err := tr.ChargeSpend("a", 50); !errors.Is(err, ErrSpendLimited) {
+		t.Fatalf("expected spend limit, got %v", err)
+	}
+	q := tr.Snapshot("a")
+	if q.Spend.Remaining != 40 || !q.Spend.ResetAt.Equal(time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected spend snapshot: %+v", q.Spend)
+	}
+	day := tr.SpendDay()
+	tr.RefundSpend("a", day, 100)
+	if q := tr.Snapshot("a"); q.Spend.Used != 0 {
+		t.Fatalf("expected a refund to stop at zero, got %+v", q.Spend)
+	}
+	if err := tr.ChargeSpend("a", 60); err != nil {
+		t.Fatalf("charge after refund: %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if err := tr.ChargeSpend("a", 90); err != nil {
+		t.Fatalf("budget should reset on a new day: %v", err)
+	}
+	tr.RefundSpend("a", day, 60)
+	if q := tr.Snapshot("a"); q.Spend.Used != 90 {
+		t.Fatalf("a refund for yesterday must not touch today's spend, got %+v", q.Spend)
+	}
+}
+
+// memShared is a Shared for tests; down makes every call fail.
+type memShared struct {
+	tokens map[string]float64
+	spent  map[string]uint64
+	down   bool
+}
+
+func (m *memShared) Take(id string, capacity int, _ time.Time) (bool, float64, error) {
+	if m.down {
+		return false, 0, errors.New("connection refused")
+	}
+	tokens, ok := m.tokens[id]
+	if !ok {
+		tokens = float64(capacity)
+	}
+	if tokens < 1 {
+		return false, tokens, nil
+	}
+	m.tokens[id] = tokens - 1
+	return true, tokens - 1, nil
+}
+
+func (m *memShared) Charge(id, day string, amount, limit uint64) (bool, uint64, error) {
+	if m.down {
+		return false, 0, errors.New("connection refused")
+	}
+	used := m.spent[day+id]
+	if used+amount > limit {
+		return false, used, nil
+	}
+	m.spent[day+id] = used + amount
+	return true, used + amount, nil
+}
+
+func (m *memShared) Refund(id, day string, amount uint64) (uint64, error) {
+	if m.down {
+		return 0, errors.New("connection refused")
+	}
+	m.spent[day+id] -= min(amount, m.spent[day+id])
+	return m.spent[day+id], nil
+}
+
+func TestSharedLimitsSpanTrackers(t *testing.T) {
+	shared := &memShared{tokens: map[string]float64{}, spent: map[string]uint64{}}
+	var failures int
+	a, b := New(Limits{RatePerMinute: 2, DailySpend: 100}), New(Limits{RatePerMinute: 2, DailySpend: 100})
+	for _, tr := range []*Tracker{a, b} {
+		tr.SetShared(shared, func(error) { failures++ })
+	}
+
+	if _, err := a.Acquire("x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Acquire("x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Acquire("x"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected the shared bucket to be empty, got %v", err)
+	}
+	if err := a.ChargeSpend("x", 60); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ChargeSpend("x", 60); !errors.Is(err, ErrSpendLimited) {
+		t.Fatalf("expected the shared spend to be exhausted, got %v", err)
+	}
+	if q := b.Snapshot("x"); q.Spend.Used != 60 || q.RateLimit.Remaining != 0 {
+		t.Fatalf("snapshot should mirror shared state, got %+v %+v", q.Spend, q.RateLimit)
+	}
+	b.RefundSpend("x", b.SpendDay(), 60)
+	if err := a.ChargeSpend("x", 100); err != nil {
+		t.Fatalf("expected the refund to reach the shared spend, got %v", err)
+	}
+
+	// When the shared store is unreachable, local counters decide.
+	shared.down = true
+	c := New(Limits{RatePerMinute: 1})
+	c.SetShared(shared, func(error) { failures++ })
+	if _, err := c.Acquire("x"); err != nil {
+		t.Fatalf("expected the local fallback to allow the request, got %v", err)
+	}
+	if _, err := c.Acquire("x"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected the local bucket to apply, got %v", err)
+	}
+	if failures != 2 {
+		t.Fatalf("expected 2 reported failures, got %d", failures)
+	}
+}
+
+// slowShared holds every Charge until release is closed.
+type slowShared struct {
+	memShared
+	charging, release chan struct{}
+}
+
+func (s *slowShared) Charge(id, day string, amount, limit uint64) (bool, uint64, error) {
+	close(s.charging)
+	<-s.release
+	return s.memShared.Charge(id, day, amount, limit)
+}
+
+func TestSharedCallsDoNotBlockTracker(t *testing.T) {
+	shared := &slowShared{
+		memShared: memShared{tokens: map[string]float64{}, spent: map[string]uint64{}},
+		charging:  make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	tr := New(Limits{DailySpend: 100, MaxConcurrent: 1})
+	tr.SetShared(shared, nil)
+	done := make(chan error)
+	go func() { done <- tr.ChargeSpend("x", 40) }()
+	<-shared.charging
+
+	// Other identities are served while the shared store is slow.
+	got := make(chan Quota)
+	go func() { got <- tr.Snapshot("y") }()
+	select {
+	case <-got:
+	case <-time.After(time.Second):
+		t.Fatal("Snapshot waited for the shared store")
+	}
+	close(shared.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if q := tr.Snapshot("x"); q.Spend.Used != 40 {
+		t.Fatalf("expected the shared total mirrored, got %+v", q.Spend)
+	}
+}
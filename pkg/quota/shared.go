@@ -0,0 +1,141 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/redis"
+)
+
+// Shared keeps rate-limit buckets and daily spend where every container sees them.
+// Concurrency slots stay per container, since a crashed container could never release a
+// shared one.
+type Shared interface {
+	// Take consumes one token from id's bucket, which holds capacity tokens refilled
+	// over a minute, and reports whether one was available and how many remain.
+	Take(id string, capacity int, now time.Time) (ok bool, remaining float64, err error)
+	// Charge adds amount to id's spend for day unless the total would exceed limit, and
+	// reports whether it did and the total spent.
+	Charge(id, day string, amount, limit uint64) (ok bool, used uint64, err error)
+	// Refund takes amount off id's spend for day, never below zero, and returns the
+	// total spent.
+	Refund(id, day string, amount uint64) (used uint64, err error)
+}
+
+// takeScript refills and takes from a token bucket stored as a hash {t: tokens, ts: ms}.
+const takeScript = `
+local cap = tonumber(ARGV[1])
+local now = tonumber(ARGV[2])
+local b = redis.call('HMGET', KEYS[1], 't', 'ts')
+local tokens = tonumber(b[1]) or cap
+local ts = tonumber(b[2]) or now
+tokens = math.min(cap, tokens + math.max(now - ts, 0) / 60000 * cap)
+local ok = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  ok = 1
+end
+redis.call('HSET', KEYS[1], 't', tostring(tokens), 'ts', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], 120000)
+return {ok, tostring(tokens)}
+`
+
+// chargeScript adds to a day's spend counter unless the limit would be exceeded.
+const chargeScript = `
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+local amount = tonumber(ARGV[1])
+if used + amount > tonumber(ARGV[2]) then
+  return {0, tostring(used)}
+end
+used = redis.call('INCRBY', KEYS[1], ARGV[1])
+redis.call('EXPIRE', KEYS[1], 172800)
+return {1, tostring(used)}
+`
+
+// refundScript takes from a day's spend counter, never below zero. A counter that has
+// expired stays gone.
+const refundScript = `
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+if used == 0 then
+  return {1, '0'}
+end
+used = redis.call('DECRBY', KEYS[1], math.min(used, tonumber(ARGV[1])))
+return {1, tostring(used)}
+`
+
+// Redis is a Shared backed by Redis; each operation is one atomic Lua script.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis returns a Shared whose keys start with prefix.
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+// Take implements Shared.
+func (r *Redis) Take(id string, capacity int, now time.Time) (bool, float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redis.DefaultTimeout)
+	defer cancel()
+	reply, err := r.client.Eval(ctx, takeScript, []string{r.prefix + "rate:" + id}, strconv.Itoa(capacity), strconv.FormatInt(now.UnixMilli(), 10))
+	if err != nil {
+		return false, 0, err
+	}
+	ok, rest, err := pair(reply)
+	if err != nil {
+		return false, 0, err
+	}
+	remaining, err := strconv.ParseFloat(rest, 64)
+	return ok, remaining, err
+}
+
+// Charge implements Shared.
+func (r *Redis) Charge(id, day string, amount, limit uint64) (bool, uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redis.DefaultTimeout)
+	defer cancel()
+	reply, err := r.client.Eval(ctx, chargeScript, []string{r.prefix + "spend:" + day + ":" + id}, strconv.FormatUint(amount, 10), strconv.FormatUint(limit, 10))
+	if err != nil {
+		return false, 0, err
+	}
+	ok, rest, err := pair(reply)
+	if err != nil {
+		return false, 0, err
+	}
+	used, err := strconv.ParseUint(rest, 10, 64)
+	return ok, used, err
+}
+
+// Refund implements Shared.
+func (r *Redis) Refund(id, day string, amount uint64) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redis.DefaultTimeout)
+	defer cancel()
+	reply, err := r.client.Eval(ctx, refundScript, []string{r.prefix + "spend:" + day + ":" + id}, strconv.FormatUint(amount, 10))
+	if err != nil {
+		return 0, err
+	}
+	_, rest, err := pair(reply)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(rest, 10, 64)
+}
+
+// pair decodes the {flag, "value"} reply of the scripts.
+func pair(reply any) (bool, string, error) {
+	arr, _ := reply.([]any)
+	if len(arr) != 2 {
+		return false, "", fmt.Errorf("redis: unexpected script reply %v", reply)
+	}
+	flag, err := redis.Int(arr[0])
+	if err != nil {
+		return false, "", err
+	}
+	v, ok := arr[1].([]byte)
+	if !ok {
+		return false, "", fmt.Errorf("redis: unexpected script reply %v", reply)
+	}
+	return flag == 1, string(v), nil
+}
@@ -0,0 +1,87 @@
+// Package receipt builds compact execution receipts that can be anchored on-chain by
+// calling a receipts program with a hash of the sanitized request and its result.
+package receipt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"slices"
+	"strings"
+
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// Config selects which executions get a receipt and where it is recorded.
+type Config struct {
+	// Program and Function name the receipts transition, e.g. "receipts.aleo" / "record".
+	// The transition must take a single field input.
+	Program  string
+	Function string
+	// Contracts limits receipts to these programs; empty means every execute.
+	Contracts []string
+}
+
+// Enabled reports whether receipts are configured.
+func (c Config) Enabled() bool {
+	return c.Program != "" && c.Function != ""
+}
+
+// Applies reports whether an execution of contract should be receipted.
+func (c Config) Applies(contract string) bool {
+	if !c.Enabled() || contract == "" || strings.EqualFold(contract, c.Program) {
+		return false
+	}
+	return len(c.Contracts) == 0 || slices.Contains(c.Contracts, contract)
+}
+
+// Hash returns the hex SHA-256 over the sanitized args and the execution outcome.
+func Hash(args []string, exitCode int, stdout string) string {
+	payload, _ := json.Marshal(struct {
+		Args     []string `json:"args"`
+		ExitCode int      `json:"exitCode"`
+		Stdout   string   `json:"stdout"`
+	}{
+		Args:     utils.RedactFlagValues(args, utils.SecretFlags...),
+		ExitCode: exitCode,
+		Stdout:   stdout,
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// FieldLiteral converts a hex hash into an Aleo field literal. Only the first 31 bytes
+// are used so the value always stays below the field modulus.
+func FieldLiteral(hash string) string {
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) == 0 {
+		return "0field"
+	}
+	if len(raw) > 31 {
+		raw = raw[:31]
+	}
+	return new(big.Int).SetBytes(raw).String() + "field"
+}
+
+// carriedFlags are copied from the original execution so the receipt is sent with the
+// same network, endpoint, signer, fee payer, priority fee and broadcast settings.
+var carriedFlags = []string{"--network", "--endpoint", "--private-key", "-k", "--fee-private-key", "--priority-fee", "--home"}
+
+var carriedSwitches = []string{"--broadcast", "-y", "--yes"}
+
+// Args builds the leo arguments for the receipt transition.
+func Args(c Config, orig []string, hash string) []string {
+	out := []string{"execute", c.Program + "/" + c.Function, FieldLiteral(hash)}
+	for _, f := range carriedFlags {
+		if v := utils.GetFlagValue(orig, f); v != "" {
+			out = append(out, f, v)
+		}
+	}
+	for _, sw := range carriedSwitches {
+		if slices.Contains(orig, sw) {
+			out = append(out, sw)
+		}
+	}
+	return out
+}
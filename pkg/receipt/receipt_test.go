@@ -0,0 +1,35 @@
+package receipt
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHashIgnoresPrivateKey(t *testing.T) {
+	a := Hash([]string{"execute", "t.aleo/m", "--private-key", "APrivateKey1"}, 0, "ok")
+	b := Hash([]string{"execute", "t.aleo/m", "--private-key", "APrivateKey2"}, 0, "ok")
+	if a != b {
+		t.Fatalf("private key must not influence the receipt hash")
+	}
+	if c := Hash([]string{"execute", "t.aleo/m"}, 1, "ok"); c == Hash([]string{"execute", "t.aleo/m"}, 0, "ok") {
+		t.Fatalf("exit code must influence the receipt hash")
+	}
+}
+
+func TestArgsAndApplies(t *testing.T) {
+	cfg := Config{Program: "receipts.aleo", Function: "record", Contracts: []string{"t.aleo"}}
+	if !cfg.Applies("t.aleo") || cfg.Applies("other.aleo") || cfg.Applies("receipts.aleo") {
+		t.Fatalf("unexpected Applies result")
+	}
+	hash := Hash([]string{"execute", "t.aleo/m"}, 0, "")
+	args := Args(cfg, []string{"execute", "--endpoint", "https://rpc", "t.aleo/m", "--network", "testnet", "--fee-private-key", "APrivateKey1fee", "--priority-fee", "100", "--broadcast"}, hash)
+	if args[1] != "receipts.aleo/record" || !strings.HasSuffix(args[2], "field") {
+		t.Fatalf("unexpected receipt args: %v", args)
+	}
+	for _, want := range []string{"--endpoint", "https://rpc", "--network", "testnet", "--fee-private-key", "APrivateKey1fee", "--priority-fee", "100", "--broadcast"} {
+		if !slices.Contains(args, want) {
+			t.Fatalf("expected %q carried over, got %v", want, args)
+		}
+	}
+}
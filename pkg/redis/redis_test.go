@@ -0,0 +1,133 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeServer answers RESP commands with handle, one connection at a time.
+func fakeServer(t *testing.T, handle func(args []string) string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(rd)
+					if err != nil {
+						return
+					}
+					_, _ = io.WriteString(conn, handle(args))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	v, err := readReply(rd)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := v.([]any)
+	if !ok {
+		return nil, errors.New("not an array")
+	}
+	args := make([]string, len(arr))
+	for i, a := range arr {
+		args[i] = string(a.([]byte))
+	}
+	return args, nil
+}
+
+func bulk(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+
+func TestDo(t *testing.T) {
+	data := map[string]string{}
+	var authed bool
+	addr := fakeServer(t, func(args []string) string {
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if args[1] != "u" || args[2] != "secret" {
+				return "-WRONGPASS invalid username-password pair\r\n"
+			}
+			authed = true
+			return "+OK\r\n"
+		case "SELECT":
+			return "+OK\r\n"
+		}
+		if !authed {
+			return "-NOAUTH Authentication required.\r\n"
+		}
+		switch strings.ToUpper(args[0]) {
+		case "SET":
+			data[args[1]] = args[2]
+			return "+OK\r\n"
+		case "GET":
+			v, ok := data[args[1]]
+			if !ok {
+				return "$-1\r\n"
+			}
+			return bulk(v)
+		case "INCR":
+			n, _ := strconv.Atoi(data[args[1]])
+			data[args[1]] = strconv.Itoa(n + 1)
+			return ":" + data[args[1]] + "\r\n"
+		case "EVAL":
+			return "*3\r\n:1\r\n" + bulk("2.5") + "$-1\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	c, err := New("redis://u:secret@" + addr + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if v, err := c.Do(ctx, "SET", "k", "line\r\nbreak"); err != nil || v != "OK" {
+		t.Fatalf("SET: %v %v", v, err)
+	}
+	if v, err := c.Do(ctx, "GET", "k"); err != nil || string(v.([]byte)) != "line\r\nbreak" {
+		t.Fatalf("GET: %q %v", v, err)
+	}
+	if _, err := c.Do(ctx, "GET", "missing"); !errors.Is(err, ErrNil) {
+		t.Fatalf("expected ErrNil, got %v", err)
+	}
+	if v, err := c.Do(ctx, "INCR", "n"); err != nil || v != int64(1) {
+		t.Fatalf("INCR: %v %v", v, err)
+	}
+	var replyErr Error
+	if _, err := c.Do(ctx, "NOPE"); !errors.As(err, &replyErr) {
+		t.Fatalf("expected an error reply, got %v", err)
+	}
+	// The connection survives error replies.
+	v, err := c.Eval(ctx, "return 1", []string{"k"}, "a")
+	if arr, ok := v.([]any); err != nil || !ok || len(arr) != 3 || arr[0] != int64(1) || string(arr[1].([]byte)) != "2.5" || arr[2] != nil {
+		t.Fatalf("EVAL: %#v %v", v, err)
+	}
+
+	if _, err := New("http://" + addr); err == nil {
+		t.Fatal("expected an error for a non-redis URL")
+	}
+	bad, _ := New("redis://u:wrong@" + addr)
+	if _, err := bad.Do(ctx, "GET", "k"); !errors.As(err, &replyErr) {
+		t.Fatalf("expected an auth error, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Package reqlog writes one JSON line per request for CloudWatch Logs. Successful
+// requests are sampled; failed ones are always logged, optionally with a sanitized
+// copy of the payload.
+package reqlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+// Payload capture modes for LOG_CAPTURE_BODY.
+const (
+	CaptureNever   = "never"
+	CaptureOnError = "on-error"
+	CaptureAlways  = "always"
+)
+
+// ValidCapture reports whether mode is a known capture mode.
+func ValidCapture(mode string) bool {
+	return mode == CaptureNever || mode == CaptureOnError || mode == CaptureAlways
+}
+
+// Entry is one log line.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"requestId,omitempty"`
+	Caller     string    `json:"caller,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	ExitCode   *int      `json:"exitCode,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	Failed     bool      `json:"failed"`
+	// Request and Response hold the sanitized payload when it is captured.
+	Request  any    `json:"request,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// Logger decides which entries to write.
+type Logger struct {
+	Out io.Writer
+	// SampleRate is the fraction (0 to 1) of successful requests logged.
+	SampleRate float64
+	// Capture is one of the Capture* modes.
+	Capture string
+}
+
+// Log writes e if it is sampled or failed. payload is only called when the payload is
+// to be captured, and must return data that is already sanitized.
+func (l *Logger) Log(e Entry, payload func() (request any, response string)) {
+	if l == nil || l.Out == nil {
+		return
+	}
+	if !e.Failed && (l.SampleRate <= 0 || (l.SampleRate < 1 && rand.Float64() >= l.SampleRate)) {
+		return
+	}
+	if payload != nil && (l.Capture == CaptureAlways || (l.Capture == CaptureOnError && e.Failed)) {
+		e.Request, e.Response = payload()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		line = fmt.Appendf(nil, `{"error":%q}`, err.Error())
+	}
+	_, _ = l.Out.Write(append(line, '\n'))
+}
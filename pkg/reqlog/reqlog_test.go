@@ -0,0 +1,45 @@
+package reqlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSamplingAndCapture(t *testing.T) {
+	var buf bytes.Buffer
+	payload := func() (any, string) { return []string{"execute", "token.aleo/mint"}, "boom" }
+
+	l := &Logger{Out: &buf, SampleRate: 0, Capture: CaptureOnError}
+	l.Log(Entry{Status: 200}, payload)
+	if buf.Len() != 0 {
+		t.Fatalf("expected unsampled success to be dropped, got %q", buf.String())
+	}
+	l.Log(Entry{Status: 500, Failed: true}, payload)
+	var e Entry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil || e.Response != "boom" || e.Request == nil {
+		t.Fatalf("expected failure logged with payload, got %q (%v)", buf.String(), err)
+	}
+
+	buf.Reset()
+	l = &Logger{Out: &buf, SampleRate: 1, Capture: CaptureOnError}
+	l.Log(Entry{Status: 200}, payload)
+	if buf.Len() == 0 || strings.Contains(buf.String(), "boom") {
+		t.Fatalf("expected success logged without payload, got %q", buf.String())
+	}
+
+	buf.Reset()
+	l.Capture = CaptureNever
+	l.Log(Entry{Status: 400, Failed: true}, payload)
+	if strings.Contains(buf.String(), "boom") {
+		t.Fatalf("expected no payload with capture never, got %q", buf.String())
+	}
+
+	buf.Reset()
+	l.Capture = CaptureAlways
+	l.Log(Entry{Status: 200}, payload)
+	if !strings.Contains(buf.String(), "boom") {
+		t.Fatalf("expected payload with capture always, got %q", buf.String())
+	}
+}
@@ -0,0 +1,86 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// placeholder matches "{name}" inside a preset argument. One in double braces, such as
+// {{height}}, is a chain variable and left for the handler to fill.
+var placeholder = regexp.MustCompile(`\{([A-Za-z][A-Za-z0-9_]*)\}`)
+
+// Presets are named argument templates for query-string invocations, e.g.
+// {"mint": ["execute", "token.aleo/mint_public", "{recipient}", "{amount}u64"]}.
+// Each {param} is filled from the query parameter of the same name; {{...}} chain
+// variables are kept.
+type Presets map[string][]string
+
+// ParsePresets parses INVOKE_PRESETS; an empty string yields no presets.
+func ParsePresets(raw string) (Presets, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var p Presets
+	if err := json.Unmarshal([]byte(raw), &p); err != nil {
+		return nil, fmt.Errorf("invalid INVOKE_PRESETS: %w", err)
+	}
+	for name, args := range p {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("invalid INVOKE_PRESETS: preset %q has no args", name)
+		}
+	}
+	return p, nil
+}
+
+// Expand fills preset name with params. Every placeholder must be given and every
+// param used. A value may not turn an argument into a flag, so callers cannot smuggle
+// options such as --private-key into a preset.
+func (p Presets) Expand(name string, params map[string]string) ([]string, error) {
+	tmpl, ok := p[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q", name)
+	}
+	used := map[string]bool{}
+	var missing []string
+	args := make([]string, len(tmpl))
+	for i, a := range tmpl {
+		var b strings.Builder
+		last := 0
+		for _, m := range placeholder.FindAllStringSubmatchIndex(a, -1) {
+			if m[0] > 0 && a[m[0]-1] == '{' && m[1] < len(a) && a[m[1]] == '}' {
+				continue
+			}
+			key := a[m[2]:m[3]]
+			v, ok := params[key]
+			if !ok {
+				missing = append(missing, key)
+			}
+			used[key] = true
+			b.WriteString(a[last:m[0]])
+			b.WriteString(v)
+			last = m[1]
+		}
+		b.WriteString(a[last:])
+		args[i] = b.String()
+		if !strings.HasPrefix(a, "-") && strings.HasPrefix(args[i], "-") {
+			return nil, fmt.Errorf("preset %q: parameter values may not start with '-'", name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("preset %q: missing parameters %s", name, strings.Join(missing, ", "))
+	}
+	for _, k := range slices.Sorted(maps.Keys(params)) {
+		if !used[k] {
+			return nil, fmt.Errorf("preset %q: unknown parameter %q", name, k)
+		}
+	}
+	return args, nil
+}
+
+// errQueryAndBody rejects requests carrying an invocation in both the URL and the body.
+var errQueryAndBody = errors.New("send the invocation in the query string or the body, not both")
@@ -0,0 +1,252 @@
+// Package request decodes Function URL request bodies into an InvokeRequest. JSON,
+// form-encoded and plain-text bodies are accepted, selected by Content-Type, as are
+// query-string invocations, and all of them are validated against the InvokeRequest
+// schema in pkg/schema.
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/mattn/go-shellwords"
+
+	"github.com/debendraoli/leo-lambda/pkg/expect"
+	"github.com/debendraoli/leo-lambda/pkg/schema"
+	"github.com/debendraoli/leo-lambda/pkg/tags"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// Supported body content types. A request without Content-Type is read as JSON.
+const (
+	ContentJSON = "application/json"
+	ContentForm = "application/x-www-form-urlencoded"
+	ContentText = "text/plain"
+)
+
+// ErrUnsupportedMediaType is returned for bodies of any other content type.
+var ErrUnsupportedMediaType = errors.New("unsupported content type")
+
+// InvokeRequest is the body accepted by the handler; see pkg/schema/openapi.json.
+type InvokeRequest struct {
+	Args []string `json:"args,omitempty"`
+	Cmd  string   `json:"cmd,omitempty"`
+	// MaxWaitSeconds, when set, bounds how long the handler blocks before handing
+	// the run off to an async job.
+	MaxWaitSeconds int `json:"maxWaitSeconds,omitempty"`
+	// Profile selects an execution profile ("fast" or "thorough").
+	Profile string `json:"profile,omitempty"`
+	// Tags are free-form labels (e.g. an upstream order ID) stored with the job and
+	// journal entry so runs can be found later.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Expect declares how mapping entries must change once an execute is confirmed.
+	Expect []expect.Expectation `json:"expect,omitempty"`
+	// OnlyIf lists conditions on mapping entries that must all hold for an execute to run.
+	OnlyIf []expect.Condition `json:"onlyIf,omitempty"`
+	// Action selects a non-CLI operation (e.g. "journal") instead of args/cmd.
+	Action string         `json:"action,omitempty"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// formFields are the keys accepted in form bodies. "args" and "tag" (key:value, as in
+// GET /jobs) may repeat; params, expect and onlyIf cannot be expressed as a form and need a
+// JSON body.
+var formFields = []string{"args", "cmd", "maxWaitSeconds", "profile", "tag", "action"}
+
+// queryTriggers are the query parameters that make a request a query-string
+// invocation; other parameters on the URL are ignored without one of them.
+var queryTriggers = []string{"args", "cmd", "preset"}
+
+// ParseArgs parses the request and returns args.
+func ParseArgs(req events.LambdaFunctionURLRequest) ([]string, error) {
+	_, args, err := Parse(req, nil)
+	return args, err
+}
+
+// Parse decodes the request and returns it together with the resolved args. A query
+// string carrying args, cmd or preset is an invocation on its own, sent as GET or as a
+// POST without a body; anything else must be a POST body. Base64-encoded bodies are
+// decoded first, and unknown fields are rejected whatever the content type.
+func Parse(req events.LambdaFunctionURLRequest, presets Presets) (InvokeRequest, []string, error) {
+	var body InvokeRequest
+	query, err := url.ParseQuery(req.RawQueryString)
+	if err != nil {
+		return body, nil, fmt.Errorf("invalid query string: %w", err)
+	}
+	if slices.ContainsFunc(queryTriggers, query.Has) {
+		return parseQuery(req, query, presets)
+	}
+	if req.RequestContext.HTTP.Method != http.MethodPost {
+		return body, nil, errors.New("only POST is supported")
+	}
+	raw := []byte(req.Body)
+	if req.IsBase64Encoded {
+		dec, err := utils.DecodeBase64(req.Body)
+		if err != nil {
+			return body, nil, fmt.Errorf("invalid base64 body: %w", err)
+		}
+		raw = dec
+	}
+
+	contentType := ContentJSON
+	if v := utils.HeaderValue(req.Headers, "Content-Type"); v != "" {
+		mt, _, err := mime.ParseMediaType(v)
+		if err != nil {
+			return body, nil, fmt.Errorf("%w: %q", ErrUnsupportedMediaType, v)
+		}
+		contentType = mt
+	}
+	switch {
+	case contentType == ContentJSON || strings.HasSuffix(contentType, "+json"):
+		// Validate against the OpenAPI schema first so callers get field-level errors
+		// instead of a zero-valued struct silently passing through.
+		if err := schema.Validate("InvokeRequest", raw); err != nil {
+			return body, nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			return body, nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+	case contentType == ContentForm:
+		form, err := url.ParseQuery(string(raw))
+		if err != nil {
+			return body, nil, fmt.Errorf("invalid form body: %w", err)
+		}
+		if body, err = parseFields(form, "form body"); err != nil {
+			return body, nil, err
+		}
+		if err := validate(body); err != nil {
+			return body, nil, err
+		}
+	case contentType == ContentText:
+		body.Cmd = strings.TrimSpace(string(raw))
+		if err := validate(body); err != nil {
+			return body, nil, err
+		}
+	default:
+		return body, nil, fmt.Errorf("%w: %s (want %s, %s or %s)", ErrUnsupportedMediaType, contentType, ContentJSON, ContentForm, ContentText)
+	}
+
+	args, err := Args(body)
+	return body, args, err
+}
+
+// Args resolves the leo arguments of body: Args as given, or Cmd split like a shell
+// would. Action requests have none. $VARS in Cmd are kept literally: expanding them would
+// let a caller read the function's environment, credentials included, into leo's args.
+func Args(body InvokeRequest) ([]string, error) {
+	if body.Action != "" {
+		return nil, nil
+	}
+	if len(body.Args) > 0 {
+		return body.Args, nil
+	}
+	if strings.TrimSpace(body.Cmd) != "" {
+		args, err := shellwords.NewParser().Parse(body.Cmd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cmd: %w", err)
+		}
+		return args, nil
+	}
+	return nil, errors.New("missing args or cmd in request body")
+}
+
+// parseQuery builds the request from a query string such as "?args=--version" or
+// "?preset=mint&recipient=aleo1...&amount=5". With a preset, every parameter other than
+// maxWaitSeconds, profile and tag fills one of the preset's placeholders.
+func parseQuery(req events.LambdaFunctionURLRequest, query url.Values, presets Presets) (InvokeRequest, []string, error) {
+	var body InvokeRequest
+	if m := req.RequestContext.HTTP.Method; m != http.MethodGet && m != http.MethodPost {
+		return body, nil, errors.New("only GET and POST are supported")
+	}
+	if strings.TrimSpace(req.Body) != "" {
+		return body, nil, errQueryAndBody
+	}
+	if !query.Has("preset") {
+		body, err := parseFields(query, "query string")
+		if err != nil {
+			return body, nil, err
+		}
+		if err := validate(body); err != nil {
+			return body, nil, err
+		}
+		args, err := Args(body)
+		return body, args, err
+	}
+
+	options := url.Values{}
+	params := map[string]string{}
+	for k, v := range query {
+		if len(v) > 1 && k != "tag" {
+			return body, nil, fmt.Errorf("invalid query string: parameter %q repeated", k)
+		}
+		switch k {
+		case "preset":
+		case "args", "cmd", "action":
+			return body, nil, fmt.Errorf("invalid query string: %q cannot be combined with preset", k)
+		case "maxWaitSeconds", "profile", "tag":
+			options[k] = v
+		default:
+			params[k] = v[0]
+		}
+	}
+	body, err := parseFields(options, "query string")
+	if err != nil {
+		return body, nil, err
+	}
+	if body.Args, err = presets.Expand(query.Get("preset"), params); err != nil {
+		return body, nil, err
+	}
+	if err := validate(body); err != nil {
+		return body, nil, err
+	}
+	return body, body.Args, nil
+}
+
+// parseFields reads form values such as "args=execute&args=token.aleo/mint&tag=order:42";
+// where names their source in errors.
+func parseFields(form url.Values, where string) (InvokeRequest, error) {
+	var body InvokeRequest
+	for k, v := range form {
+		if !slices.Contains(formFields, k) {
+			return body, fmt.Errorf("invalid %s: unknown field %q", where, k)
+		}
+		if k != "args" && k != "tag" && len(v) > 1 {
+			return body, fmt.Errorf("invalid %s: field %q repeated", where, k)
+		}
+	}
+	body.Args = form["args"]
+	body.Cmd = form.Get("cmd")
+	body.Profile = form.Get("profile")
+	body.Action = form.Get("action")
+	var err error
+	if v := form.Get("maxWaitSeconds"); v != "" {
+		if body.MaxWaitSeconds, err = strconv.Atoi(v); err != nil {
+			return body, fmt.Errorf("invalid %s: maxWaitSeconds must be an integer", where)
+		}
+	}
+	if len(form["tag"]) > 0 {
+		if body.Tags, err = tags.Parse(form["tag"]); err != nil {
+			return body, fmt.Errorf("invalid %s: %w", where, err)
+		}
+	}
+	return body, nil
+}
+
+// validate checks a body built from a form or text against the same schema as JSON.
+func validate(body InvokeRequest) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return schema.Validate("InvokeRequest", b)
+}
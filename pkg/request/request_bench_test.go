@@ -0,0 +1,35 @@
+package request
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func benchRequest(body InvokeRequest) events.LambdaFunctionURLRequest {
+	b, _ := json.Marshal(body)
+	return events.LambdaFunctionURLRequest{
+		RequestContext: events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: http.MethodPost}},
+		Body:           string(b),
+	}
+}
+
+func BenchmarkParseArgs(b *testing.B) {
+	cases := map[string]InvokeRequest{
+		"args": {Args: []string{"execute", "credits.aleo/transfer_public", "aleo1xyz", "100u64", "--network", "mainnet", "--broadcast"}},
+		"cmd":  {Cmd: `execute credits.aleo/transfer_public aleo1xyz 100u64 --network mainnet --broadcast`},
+	}
+	for name, body := range cases {
+		req := benchRequest(body)
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := ParseArgs(req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
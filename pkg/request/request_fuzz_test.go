@@ -0,0 +1,59 @@
+package request
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// fuzzSecret is set in the environment while fuzzing; no input that does not contain it
+// may produce arguments that do.
+const fuzzSecret = "APrivateKey1fuzzsecret"
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []struct {
+		method, query, contentType, body string
+		base64                           bool
+	}{
+		{"POST", "", "", `{"args": ["execute", "token.aleo/mint"]}`, false},
+		{"POST", "", "", `{"cmd": "execute token.aleo/mint \"a b\" $LEO_FUZZ_SECRET"}`, false},
+		{"POST", "", "", `{"cmd": "execute x.aleo/f ${LEO_FUZZ_SECRET} $(env) ` + "`env`" + `"}`, false},
+		{"POST", "", "", `{"cmd": "execute x.aleo/f \u0000 -- --private-key"}`, false},
+		{"POST", "", ContentForm, "cmd=execute+x.aleo%2Ff+%24LEO_FUZZ_SECRET&tag=a:b", false},
+		{"POST", "", ContentText, "execute x.aleo/f '$LEO_FUZZ_SECRET' \"$LEO_FUZZ_SECRET\"", false},
+		{"POST", "", ContentText, "ZXhlY3V0ZSB4LmFsZW8vZg==", true},
+		{"GET", "preset=mint&recipient=%24LEO_FUZZ_SECRET&amount=5", "", "", false},
+		{"GET", "cmd=query+%E2%80%94private-key+x", "", "", false},
+	} {
+		f.Add(seed.method, seed.query, seed.contentType, seed.body, seed.base64)
+	}
+	f.Setenv("LEO_FUZZ_SECRET", fuzzSecret)
+	presets := Presets{"mint": {"execute", "token.aleo/mint_public", "{recipient}", "{amount}u64"}}
+	f.Fuzz(func(t *testing.T, method, query, contentType, body string, b64 bool) {
+		req := events.LambdaFunctionURLRequest{
+			RequestContext:  events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: method}},
+			Headers:         map[string]string{"content-type": contentType},
+			RawQueryString:  query,
+			Body:            body,
+			IsBase64Encoded: b64,
+		}
+		_, args, err := Parse(req, presets)
+		if err != nil {
+			return
+		}
+		raw := body
+		if b, err := base64.StdEncoding.DecodeString(body); b64 && err == nil {
+			raw = string(b)
+		}
+		if strings.Contains(query+raw, fuzzSecret) {
+			return
+		}
+		for _, a := range args {
+			if strings.Contains(a, fuzzSecret) {
+				t.Fatalf("environment expanded into args %q", args)
+			}
+		}
+	})
+}
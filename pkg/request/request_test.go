@@ -0,0 +1,156 @@
+package request
+
+import (
+	"encoding/base64"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/schema"
+)
+
+func TestParse(t *testing.T) {
+	type want struct {
+		args    []string
+		action  string
+		maxWait int
+		profile string
+		tags    map[string]string
+	}
+	cases := []struct {
+		name        string
+		method      string
+		query       string
+		contentType string
+		body        string
+		base64      bool
+		want        want
+		// wantErr is "" for success, "schema" for a *schema.ValidationError, "media"
+		// for ErrUnsupportedMediaType, or "other".
+		wantErr string
+	}{
+		{name: "json args", body: `{"args": ["execute", "token.aleo/mint"]}`, want: want{args: []string{"execute", "token.aleo/mint"}}},
+		{name: "json without content type", body: `{"cmd": "execute token.aleo/mint 1u64"}`, want: want{args: []string{"execute", "token.aleo/mint", "1u64"}}},
+		{name: "json explicit", contentType: "application/json; charset=utf-8", body: `{"args": ["query"]}`, want: want{args: []string{"query"}}},
+		{name: "json suffix", contentType: "application/vnd.leo+json", body: `{"args": ["query"]}`, want: want{args: []string{"query"}}},
+		{name: "json all fields", contentType: ContentJSON, body: `{"args": ["execute"], "maxWaitSeconds": 5, "profile": "fast", "tags": {"order": "42"}}`, want: want{args: []string{"execute"}, maxWait: 5, profile: "fast", tags: map[string]string{"order": "42"}}},
+		{name: "json action", body: `{"action": "journal", "params": {"limit": 5}}`, want: want{action: "journal"}},
+		{name: "json cmd with quotes", body: `{"cmd": "execute token.aleo/mint \"a b\""}`, want: want{args: []string{"execute", "token.aleo/mint", "a b"}}},
+		{name: "json base64", body: base64.StdEncoding.EncodeToString([]byte(`{"args": ["query"]}`)), base64: true, want: want{args: []string{"query"}}},
+		{name: "json unknown field", body: `{"args": ["query"], "extra": 1}`, wantErr: "schema"},
+		{name: "json args and cmd", body: `{"args": ["query"], "cmd": "query"}`, wantErr: "schema"},
+		{name: "json empty", body: `{}`, wantErr: "schema"},
+		{name: "json malformed", body: `{"args": [`, wantErr: "other"},
+		{name: "json bad base64", body: "%%%", base64: true, wantErr: "other"},
+		{name: "json cmd keeps variables", body: `{"cmd": "execute x.aleo/f $HOME ${PATH}"}`, want: want{args: []string{"execute", "x.aleo/f", "$HOME", "${PATH}"}}},
+		{name: "json unbalanced quote", body: `{"cmd": "execute \"oops"}`, wantErr: "other"},
+		{name: "form args", contentType: ContentForm, body: "args=execute&args=token.aleo%2Fmint&args=1u64", want: want{args: []string{"execute", "token.aleo/mint", "1u64"}}},
+		{name: "form cmd and options", contentType: ContentForm, body: "cmd=execute+token.aleo%2Fmint&maxWaitSeconds=30&profile=thorough&tag=order:42&tag=env:prod", want: want{args: []string{"execute", "token.aleo/mint"}, maxWait: 30, profile: "thorough", tags: map[string]string{"order": "42", "env": "prod"}}},
+		{name: "form action", contentType: ContentForm, body: "action=metrics", want: want{action: "metrics"}},
+		{name: "form base64", contentType: ContentForm, body: base64.StdEncoding.EncodeToString([]byte("args=query")), base64: true, want: want{args: []string{"query"}}},
+		{name: "form unknown field", contentType: ContentForm, body: "args=query&extra=1", wantErr: "other"},
+		{name: "form repeated cmd", contentType: ContentForm, body: "cmd=query&cmd=execute", wantErr: "other"},
+		{name: "form bad maxWait", contentType: ContentForm, body: "args=query&maxWaitSeconds=soon", wantErr: "other"},
+		{name: "form maxWait out of range", contentType: ContentForm, body: "args=query&maxWaitSeconds=5000", wantErr: "schema"},
+		{name: "form bad profile", contentType: ContentForm, body: "args=query&profile=slow", wantErr: "schema"},
+		{name: "form bad tag", contentType: ContentForm, body: "args=query&tag=nocolon", wantErr: "other"},
+		{name: "form empty", contentType: ContentForm, body: "", wantErr: "schema"},
+		{name: "text cmd", contentType: "text/plain; charset=utf-8", body: "execute token.aleo/mint 1u64\n", want: want{args: []string{"execute", "token.aleo/mint", "1u64"}}},
+		{name: "text base64", contentType: ContentText, body: base64.StdEncoding.EncodeToString([]byte("query program x.aleo")), base64: true, want: want{args: []string{"query", "program", "x.aleo"}}},
+		{name: "text empty", contentType: ContentText, body: "  ", wantErr: "schema"},
+		{name: "unsupported type", contentType: "application/xml", body: "<args/>", wantErr: "media"},
+		{name: "malformed type", contentType: "text/", body: "query", wantErr: "media"},
+		{name: "GET", method: "GET", body: `{"args": ["query"]}`, wantErr: "other"},
+		{name: "query GET args", method: "GET", query: "args=--version", want: want{args: []string{"--version"}}},
+		{name: "query POST cmd", query: "cmd=query+program+x.aleo&tag=probe:1", want: want{args: []string{"query", "program", "x.aleo"}, tags: map[string]string{"probe": "1"}}},
+		{name: "query preset", method: "GET", query: "preset=mint&recipient=aleo1abc&amount=5&maxWaitSeconds=10", want: want{args: []string{"execute", "token.aleo/mint_public", "aleo1abc", "5u64"}, maxWait: 10}},
+		{name: "query preset missing param", query: "preset=mint&recipient=aleo1abc", wantErr: "other"},
+		{name: "query preset unknown param", query: "preset=mint&recipient=aleo1abc&amount=5&memo=x", wantErr: "other"},
+		{name: "query preset flag value", query: "preset=mint&recipient=--private-key&amount=5", wantErr: "other"},
+		{name: "query preset with args", query: "preset=mint&args=query", wantErr: "other"},
+		{name: "query unknown preset", query: "preset=burn", wantErr: "other"},
+		{name: "query unknown field", query: "args=query&extra=1", wantErr: "other"},
+		{name: "query and body", query: "args=query", body: `{"args": ["query"]}`, wantErr: "other"},
+		{name: "query bad profile", method: "GET", query: "args=query&profile=slow", wantErr: "schema"},
+		{name: "query PUT", method: "PUT", query: "args=query", wantErr: "other"},
+		{name: "unrelated query", query: "debug=1", body: `{"args": ["query"]}`, want: want{args: []string{"query"}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := events.LambdaFunctionURLRequest{
+				RequestContext:  events.LambdaFunctionURLRequestContext{HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: "POST"}},
+				RawQueryString:  tc.query,
+				Body:            tc.body,
+				IsBase64Encoded: tc.base64,
+			}
+			if tc.method != "" {
+				req.RequestContext.HTTP.Method = tc.method
+			}
+			if tc.contentType != "" {
+				req.Headers = map[string]string{"content-type": tc.contentType}
+			}
+			presets := Presets{"mint": {"execute", "token.aleo/mint_public", "{recipient}", "{amount}u64"}}
+			body, args, err := Parse(req, presets)
+			var verr *schema.ValidationError
+			switch tc.wantErr {
+			case "":
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case "schema":
+				if !errors.As(err, &verr) {
+					t.Fatalf("expected a schema error, got %v", err)
+				}
+				return
+			case "media":
+				if !errors.Is(err, ErrUnsupportedMediaType) {
+					t.Fatalf("expected ErrUnsupportedMediaType, got %v", err)
+				}
+				return
+			default:
+				if err == nil || errors.As(err, &verr) || errors.Is(err, ErrUnsupportedMediaType) {
+					t.Fatalf("expected a plain error, got %v", err)
+				}
+				return
+			}
+			got := want{args: args, action: body.Action, maxWait: body.MaxWaitSeconds, profile: body.Profile, tags: body.Tags}
+			if !slices.Equal(got.args, tc.want.args) || got.action != tc.want.action || got.maxWait != tc.want.maxWait ||
+				got.profile != tc.want.profile || !maps.Equal(got.tags, tc.want.tags) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParsePresets(t *testing.T) {
+	p, err := ParsePresets(`{"version": ["--version"]}`)
+	if err != nil || !slices.Equal(p["version"], []string{"--version"}) {
+		t.Fatalf("unexpected %v %v", p, err)
+	}
+	if p, err := ParsePresets(""); err != nil || p != nil {
+		t.Fatalf("empty: unexpected %v %v", p, err)
+	}
+	for _, raw := range []string{`{"x": []}`, `["x"]`} {
+		if _, err := ParsePresets(raw); err == nil {
+			t.Fatalf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestExpandKeepsChainVariables(t *testing.T) {
+	p := Presets{"pay": {"execute", "token.aleo/pay", "{to}", "{{mapping:token.aleo/balances[{to}] ?? 0u64}}", "{{height}}u32"}}
+	args, err := p.Expand("pay", map[string]string{"to": "aleo1abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"execute", "token.aleo/pay", "aleo1abc", "{{mapping:token.aleo/balances[aleo1abc] ?? 0u64}}", "{{height}}u32"}
+	if !slices.Equal(args, want) {
+		t.Fatalf("got %q, want %q", args, want)
+	}
+	if _, err := p.Expand("pay", map[string]string{"to": "aleo1abc", "height": "1"}); err == nil {
+		t.Fatal("expected height to be an unknown parameter")
+	}
+}
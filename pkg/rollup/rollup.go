@@ -0,0 +1,229 @@
+// Package rollup keeps per-contract daily rollups of runs in DynamoDB: how many ran,
+// how many succeeded, how long they took and the fees they paid. Each run updates its
+// contract's item for the day and the day's index of contracts in one transaction, so
+// reports read a few items instead of scanning history.
+package rollup
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// MaxDays bounds how many days a report covers.
+const MaxDays = 31
+
+// batchKeys is the most keys one BatchGetItem may ask for.
+const batchKeys = 100
+
+// Run is the outcome of one run of a contract.
+type Run struct {
+	OK bool
+	// Fee is the fee paid, in microcredits.
+	Fee      uint64
+	Duration time.Duration
+}
+
+// Totals aggregates runs. SuccessRate and AvgDuration are derived from the sums.
+type Totals struct {
+	Runs        int     `json:"runs"`
+	Succeeded   int     `json:"succeeded"`
+	SuccessRate float64 `json:"successRate"`
+	Fees        uint64  `json:"feesMicrocredits"`
+	// Compute is the total run time, AvgDuration its mean per run, in seconds.
+	Compute     float64 `json:"computeSeconds"`
+	AvgDuration float64 `json:"avgDurationSeconds"`
+}
+
+// Add adds o to t.
+func (t *Totals) Add(o Totals) {
+	t.Runs += o.Runs
+	t.Succeeded += o.Succeeded
+	t.Compute += o.Compute
+	t.Fees += o.Fees
+	if t.Runs > 0 {
+		t.SuccessRate = float64(t.Succeeded) / float64(t.Runs)
+		t.AvgDuration = t.Compute / float64(t.Runs)
+	}
+}
+
+// Day is the rollup of one contract on one UTC day.
+type Day struct {
+	Date     string `json:"date"`
+	Contract string `json:"contract"`
+	Totals
+}
+
+// Store keeps rollups in a DynamoDB table with string partition key "id": an item
+// "<contract>#<date>" per contract and day, and an item "index#<date>" listing the day's
+// contracts. Enable TTL on expiresAt to have old days removed.
+type Store struct {
+	client *awsapi.Client
+	table  string
+	// retention is how long items are kept; zero keeps them.
+	retention time.Duration
+}
+
+// NewStore returns a store backed by table, keeping days for retention.
+func NewStore(client *awsapi.Client, table string, retention time.Duration) (*Store, error) {
+	if table == "" {
+		return nil, errors.New("rollup table name is required")
+	}
+	return &Store{client: client, table: table, retention: retention}, nil
+}
+
+// Record adds r to the rollup of contract on the UTC day of t.
+func (s *Store) Record(ctx context.Context, contract string, t time.Time, r Run) error {
+	date := t.UTC().Format(time.DateOnly)
+	ok, fee := 0, uint64(0)
+	if r.OK {
+		ok, fee = 1, r.Fee
+	}
+	names := map[string]string{"#runs": "runs", "#ok": "succeeded", "#ms": "durationMs", "#fees": "fees", "#contract": "contract", "#date": "date"}
+	values := map[string]map[string]any{
+		":one":      {"N": "1"},
+		":ok":       {"N": strconv.Itoa(ok)},
+		":ms":       {"N": strconv.FormatInt(r.Duration.Milliseconds(), 10)},
+		":fees":     {"N": strconv.FormatUint(fee, 10)},
+		":contract": {"S": contract},
+		":date":     {"S": date},
+	}
+	update := "ADD #runs :one, #ok :ok, #ms :ms, #fees :fees SET #contract = :contract, #date = :date"
+	indexNames := map[string]string{"#contracts": "contracts"}
+	indexValues := map[string]map[string]any{":contract": {"SS": []string{contract}}}
+	indexUpdate := "ADD #contracts :contract"
+	if s.retention > 0 {
+		exp := map[string]any{"N": strconv.FormatInt(t.Add(s.retention).Unix(), 10)}
+		names["#exp"], values[":exp"] = "expiresAt", exp
+		indexNames["#exp"], indexValues[":exp"] = "expiresAt", exp
+		update += ", #exp = :exp"
+		indexUpdate += " SET #exp = :exp"
+	}
+	in := map[string]any{"TransactItems": []map[string]any{
+		{"Update": map[string]any{
+			"TableName":                 s.table,
+			"Key":                       key(contract + "#" + date),
+			"UpdateExpression":          update,
+			"ExpressionAttributeNames":  names,
+			"ExpressionAttributeValues": values,
+		}},
+		{"Update": map[string]any{
+			"TableName":                 s.table,
+			"Key":                       key("index#" + date),
+			"UpdateExpression":          indexUpdate,
+			"ExpressionAttributeNames":  indexNames,
+			"ExpressionAttributeValues": indexValues,
+		}},
+	}}
+	if err := s.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.TransactWriteItems", in, nil); err != nil {
+		return fmt.Errorf("record rollup: %w", err)
+	}
+	return nil
+}
+
+// Days returns the rollups of the days from..to, inclusive, ordered by date and
+// contract. With contracts given, only theirs are read.
+func (s *Store) Days(ctx context.Context, from, to time.Time, contracts ...string) ([]Day, error) {
+	var dates []string
+	for d := from.UTC().Truncate(24 * time.Hour); !d.After(to) && len(dates) < MaxDays; d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d.Format(time.DateOnly))
+	}
+	var ids []string
+	if len(contracts) > 0 {
+		for _, date := range dates {
+			for _, c := range contracts {
+				ids = append(ids, c+"#"+date)
+			}
+		}
+	} else {
+		var indexIDs []string
+		for _, date := range dates {
+			indexIDs = append(indexIDs, "index#"+date)
+		}
+		indexes, err := s.get(ctx, indexIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range indexes {
+			for _, c := range item["contracts"].SS {
+				ids = append(ids, c+"#"+item["id"].S[len("index#"):])
+			}
+		}
+	}
+	items, err := s.get(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	days := make([]Day, 0, len(items))
+	for _, item := range items {
+		d := Day{Date: item["date"].S, Contract: item["contract"].S}
+		ms, _ := strconv.ParseInt(item["durationMs"].N, 10, 64)
+		runs, _ := strconv.Atoi(item["runs"].N)
+		ok, _ := strconv.Atoi(item["succeeded"].N)
+		fees, _ := strconv.ParseUint(item["fees"].N, 10, 64)
+		d.Add(Totals{Runs: runs, Succeeded: ok, Compute: float64(ms) / 1000, Fees: fees})
+		days = append(days, d)
+	}
+	slices.SortFunc(days, func(a, b Day) int {
+		return cmp.Or(cmp.Compare(a.Date, b.Date), cmp.Compare(a.Contract, b.Contract))
+	})
+	return days, nil
+}
+
+// ByContract sums days per contract.
+func ByContract(days []Day) map[string]Totals {
+	out := map[string]Totals{}
+	for _, d := range days {
+		t := out[d.Contract]
+		t.Add(d.Totals)
+		out[d.Contract] = t
+	}
+	return out
+}
+
+// attr is a DynamoDB attribute value of the types rollups use.
+type attr struct {
+	S  string   `json:"S,omitempty"`
+	N  string   `json:"N,omitempty"`
+	SS []string `json:"SS,omitempty"`
+}
+
+func key(id string) map[string]map[string]string {
+	return map[string]map[string]string{"id": {"S": id}}
+}
+
+// get reads the items with ids, in batches, retrying keys DynamoDB left unprocessed a
+// few times. Missing items are left out.
+func (s *Store) get(ctx context.Context, ids []string) ([]map[string]attr, error) {
+	var items []map[string]attr
+	for chunk := range slices.Chunk(ids, batchKeys) {
+		keys := make([]map[string]map[string]string, len(chunk))
+		for i, id := range chunk {
+			keys[i] = key(id)
+		}
+		for attempt := 0; len(keys) > 0; attempt++ {
+			if attempt == 3 {
+				return nil, errors.New("read rollups: keys left unprocessed")
+			}
+			in := map[string]any{"RequestItems": map[string]any{s.table: map[string]any{"Keys": keys}}}
+			var out struct {
+				Responses       map[string][]map[string]attr
+				UnprocessedKeys map[string]struct {
+					Keys []map[string]map[string]string
+				}
+			}
+			if err := s.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.BatchGetItem", in, &out); err != nil {
+				return nil, fmt.Errorf("read rollups: %w", err)
+			}
+			items = append(items, out.Responses[s.table]...)
+			keys = out.UnprocessedKeys[s.table].Keys
+		}
+	}
+	return items, nil
+}
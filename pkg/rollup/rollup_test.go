@@ -0,0 +1,149 @@
+package rollup
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// fakeTable applies the ADD and SET clauses Record sends and answers BatchGetItem,
+// leaving one key unprocessed on the first read to exercise the retry.
+func fakeTable(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	items := map[string]map[string]attr{}
+	deferred := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.TransactWriteItems":
+			var in struct {
+				TransactItems []struct {
+					Update struct {
+						Key                       map[string]map[string]string
+						UpdateExpression          string
+						ExpressionAttributeNames  map[string]string
+						ExpressionAttributeValues map[string]attr
+					}
+				}
+			}
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			for _, ti := range in.TransactItems {
+				u := ti.Update
+				id := u.Key["id"]["S"]
+				item := items[id]
+				if item == nil {
+					item = map[string]attr{"id": {S: id}}
+					items[id] = item
+				}
+				add, set, _ := strings.Cut(strings.TrimPrefix(u.UpdateExpression, "ADD "), " SET ")
+				for _, clause := range strings.Split(add, ", ") {
+					name, value, _ := strings.Cut(clause, " ")
+					a, v := u.ExpressionAttributeNames[name], u.ExpressionAttributeValues[value]
+					cur := item[a]
+					if v.SS != nil {
+						for _, e := range v.SS {
+							if !slices.Contains(cur.SS, e) {
+								cur.SS = append(cur.SS, e)
+							}
+						}
+					} else {
+						x, _ := strconv.Atoi(cur.N)
+						y, _ := strconv.Atoi(v.N)
+						cur.N = strconv.Itoa(x + y)
+					}
+					item[a] = cur
+				}
+				for _, clause := range strings.Split(set, ", ") {
+					if name, value, ok := strings.Cut(clause, " = "); ok {
+						item[u.ExpressionAttributeNames[name]] = u.ExpressionAttributeValues[value]
+					}
+				}
+			}
+			_, _ = w.Write([]byte(`{}`))
+		case "DynamoDB_20120810.BatchGetItem":
+			var in struct {
+				RequestItems map[string]struct {
+					Keys []map[string]map[string]string
+				}
+			}
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			keys := in.RequestItems["rollups"].Keys
+			out := map[string]any{}
+			if !deferred && len(keys) > 1 {
+				deferred = true
+				out["UnprocessedKeys"] = map[string]any{"rollups": map[string]any{"Keys": keys[1:]}}
+				keys = keys[:1]
+			}
+			var found []map[string]attr
+			for _, k := range keys {
+				if item, ok := items[k["id"]["S"]]; ok {
+					found = append(found, item)
+				}
+			}
+			out["Responses"] = map[string]any{"rollups": found}
+			_ = json.NewEncoder(w).Encode(out)
+		default:
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+	}))
+}
+
+func TestStore(t *testing.T) {
+	srv := fakeTable(t)
+	defer srv.Close()
+	client := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	if _, err := NewStore(client, "", 0); err == nil {
+		t.Fatal("expected an error without a table")
+	}
+	s, err := NewStore(client, "rollups", 90*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	day1 := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	for _, rec := range []struct {
+		contract string
+		at       time.Time
+		run      Run
+	}{
+		{"token.aleo", day1, Run{OK: true, Fee: 1000, Duration: 2 * time.Second}},
+		{"token.aleo", day1, Run{OK: false, Fee: 500, Duration: 4 * time.Second}},
+		{"credits.aleo", day1, Run{OK: true, Fee: 10, Duration: time.Second}},
+		{"token.aleo", day2, Run{OK: true, Fee: 2000, Duration: time.Second}},
+	} {
+		if err := s.Record(ctx, rec.contract, rec.at, rec.run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	days, err := s.Days(ctx, day1, day2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 3 || days[0].Contract != "credits.aleo" || days[1].Contract != "token.aleo" || days[2].Date != "2026-01-02" {
+		t.Fatalf("days = %+v", days)
+	}
+	if d := days[1]; d.Runs != 2 || d.Succeeded != 1 || d.SuccessRate != 0.5 || d.AvgDuration != 3 || d.Fees != 1000 {
+		t.Fatalf("token.aleo on day one = %+v, want failed fees left out", d)
+	}
+
+	days, err = s.Days(ctx, day1, day2, "token.aleo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := ByContract(days)
+	if len(totals) != 1 || totals["token.aleo"].Runs != 3 || totals["token.aleo"].Fees != 3000 {
+		t.Fatalf("totals = %+v", totals)
+	}
+}
@@ -0,0 +1,207 @@
+// Package saga tracks flows that span several dependent transactions, such as approve,
+// transfer and notify. Steps run in order, each only once the previous one's transaction
+// is final; when a step fails, the steps already confirmed are undone by their declared
+// compensations, latest first. A Saga is plain data, persisted after every transition,
+// so a saga that stopped short (a transaction not yet final, the container gone) can be
+// resumed elsewhere without sending any transaction twice.
+package saga
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxSteps bounds the number of steps in one saga.
+const MaxSteps = 16
+
+// Step is one transition of a saga and, optionally, the transition that undoes it.
+type Step struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+	// Compensate runs if a later step fails; without it the step is left in place.
+	Compensate []string `json:"compensate,omitempty"`
+}
+
+// Status is the state of a saga as a whole.
+type Status string
+
+const (
+	// Running and Compensating sagas have work left, forward or backward.
+	Running      Status = "running"
+	Compensating Status = "compensating"
+	// Completed sagas confirmed every step.
+	Completed Status = "completed"
+	// Compensated sagas had a step fail and undid every compensable step before it.
+	Compensated Status = "compensated"
+	// Failed sagas had a compensation fail too; the chain needs an operator.
+	Failed Status = "failed"
+)
+
+// StepStatus is the state of one step.
+type StepStatus string
+
+const (
+	StepPending            StepStatus = "pending"
+	StepConfirmed          StepStatus = "confirmed"
+	StepFailed             StepStatus = "failed"
+	StepCompensated        StepStatus = "compensated"
+	StepCompensationFailed StepStatus = "compensation_failed"
+)
+
+// Progress is what has happened to one step.
+type Progress struct {
+	Name   string     `json:"name"`
+	Status StepStatus `json:"status"`
+	// TransactionID and CompensationID are set as soon as the transaction is sent, so
+	// a resumed saga confirms it instead of sending another.
+	TransactionID  string `json:"transactionId,omitempty"`
+	CompensationID string `json:"compensationId,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Saga is the definition and progress of one saga.
+type Saga struct {
+	Status   Status     `json:"status"`
+	Steps    []Step     `json:"steps"`
+	Progress []Progress `json:"progress"`
+	// Stalled says why the saga stopped before reaching a final status; resuming it
+	// retries from there.
+	Stalled   string    `json:"stalled,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Action is the next thing to do: send (or confirm) step Index, or its compensation.
+type Action struct {
+	Index      int
+	Compensate bool
+	// TransactionID is the transaction already sent for this action, if any.
+	TransactionID string
+}
+
+// Outcome is the result of performing an Action.
+type Outcome struct {
+	TransactionID string
+	// Err says why the action failed, or with Pending why its result is not known yet.
+	Err string
+	// Pending stalls the saga: the transaction is not final yet or the step could not
+	// be sent for now, so neither success nor failure can be recorded.
+	Pending bool
+}
+
+// Validate reports whether steps make a saga: between 1 and MaxSteps, each named
+// uniquely and with args.
+func Validate(steps []Step) error {
+	if len(steps) == 0 || len(steps) > MaxSteps {
+		return fmt.Errorf("a saga needs between 1 and %d steps", MaxSteps)
+	}
+	seen := map[string]bool{}
+	for i, s := range steps {
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("step %d: name is required", i)
+		case seen[s.Name]:
+			return fmt.Errorf("step %d: duplicate name %q", i, s.Name)
+		case len(s.Args) == 0:
+			return fmt.Errorf("step %q: args are required", s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return nil
+}
+
+// New returns a running saga over steps, which must be valid.
+func New(steps []Step, now time.Time) *Saga {
+	s := &Saga{Status: Running, Steps: steps, UpdatedAt: now.UTC()}
+	for _, st := range steps {
+		s.Progress = append(s.Progress, Progress{Name: st.Name, Status: StepPending})
+	}
+	return s
+}
+
+// Final reports whether the saga has nothing left to do.
+func (s *Saga) Final() bool {
+	return s.Status == Completed || s.Status == Compensated || s.Status == Failed
+}
+
+// Next returns the action to perform, or false once the saga is final.
+func (s *Saga) Next() (Action, bool) {
+	switch s.Status {
+	case Running:
+		for i, p := range s.Progress {
+			if p.Status == StepPending {
+				return Action{Index: i, TransactionID: p.TransactionID}, true
+			}
+		}
+	case Compensating:
+		if i := s.compensable(); i >= 0 {
+			return Action{Index: i, Compensate: true, TransactionID: s.Progress[i].CompensationID}, true
+		}
+	}
+	return Action{}, false
+}
+
+// compensable returns the latest confirmed step with a compensation, or -1.
+func (s *Saga) compensable() int {
+	for i := len(s.Progress) - 1; i >= 0; i-- {
+		if s.Progress[i].Status == StepConfirmed && len(s.Steps[i].Compensate) > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// ErrMismatch is returned by Record for an action that is not the saga's next one.
+var ErrMismatch = errors.New("action is not the next one")
+
+// Record applies the outcome of a, which must be the action Next returned.
+func (s *Saga) Record(a Action, o Outcome, now time.Time) error {
+	if next, ok := s.Next(); !ok || next.Index != a.Index || next.Compensate != a.Compensate {
+		return ErrMismatch
+	}
+	s.UpdatedAt = now.UTC()
+	p := &s.Progress[a.Index]
+	if o.TransactionID != "" {
+		if a.Compensate {
+			p.CompensationID = o.TransactionID
+		} else {
+			p.TransactionID = o.TransactionID
+		}
+	}
+	if o.Pending {
+		s.Stalled = fmt.Sprintf("step %q: %s", p.Name, o.Err)
+		return nil
+	}
+	s.Stalled = ""
+	switch {
+	case !a.Compensate && o.Err == "":
+		p.Status = StepConfirmed
+	case !a.Compensate:
+		p.Status, p.Error = StepFailed, o.Err
+		s.Status = Compensating
+	case o.Err == "":
+		p.Status = StepCompensated
+	default:
+		p.Status, p.Error = StepCompensationFailed, o.Err
+	}
+	s.settle()
+	return nil
+}
+
+// settle moves the saga to its final status once no action is left.
+func (s *Saga) settle() {
+	if _, ok := s.Next(); ok {
+		return
+	}
+	switch s.Status {
+	case Running:
+		s.Status = Completed
+	case Compensating:
+		s.Status = Compensated
+		for _, p := range s.Progress {
+			if p.Status == StepCompensationFailed {
+				s.Status = Failed
+			}
+		}
+	}
+}
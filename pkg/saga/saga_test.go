@@ -0,0 +1,148 @@
+package saga
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func steps() []Step {
+	return []Step{
+		{Name: "approve", Args: []string{"execute", "token.aleo/approve"}, Compensate: []string{"execute", "token.aleo/revoke"}},
+		{Name: "transfer", Args: []string{"execute", "token.aleo/transfer_from"}, Compensate: []string{"execute", "token.aleo/refund"}},
+		{Name: "notify", Args: []string{"execute", "inbox.aleo/notify"}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(steps()); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][]Step{
+		nil,
+		{{Args: []string{"execute"}}},
+		{{Name: "a", Args: []string{"execute"}}, {Name: "a", Args: []string{"execute"}}},
+		{{Name: "a"}},
+		slices.Repeat([]Step{{Name: "a", Args: []string{"execute"}}}, MaxSteps+1),
+	} {
+		if err := Validate(bad); err == nil {
+			t.Fatalf("%+v: expected an error", bad)
+		}
+	}
+}
+
+// drive performs the saga's actions with outcome until it is final or stalls, and
+// returns the actions taken.
+func drive(t *testing.T, s *Saga, outcome func(Action) Outcome) []Action {
+	t.Helper()
+	var done []Action
+	for {
+		a, ok := s.Next()
+		if !ok {
+			return done
+		}
+		o := outcome(a)
+		if err := s.Record(a, o, now); err != nil {
+			t.Fatal(err)
+		}
+		done = append(done, a)
+		if o.Pending {
+			return done
+		}
+	}
+}
+
+func TestCompleted(t *testing.T) {
+	s := New(steps(), now)
+	done := drive(t, s, func(a Action) Outcome { return Outcome{TransactionID: "at1" + s.Steps[a.Index].Name} })
+	if len(done) != 3 || s.Status != Completed || !s.Final() {
+		t.Fatalf("unexpected %+v after %+v", s, done)
+	}
+	for _, p := range s.Progress {
+		if p.Status != StepConfirmed || p.TransactionID != "at1"+p.Name {
+			t.Fatalf("unexpected progress %+v", p)
+		}
+	}
+}
+
+func TestCompensatesInReverse(t *testing.T) {
+	s := New(steps(), now)
+	done := drive(t, s, func(a Action) Outcome {
+		if a.Index == 2 && !a.Compensate {
+			return Outcome{TransactionID: "at1notify", Err: "transaction rejected"}
+		}
+		return Outcome{TransactionID: "at1x"}
+	})
+	want := []Action{{Index: 0}, {Index: 1}, {Index: 2}, {Index: 1, Compensate: true}, {Index: 0, Compensate: true}}
+	if !slices.Equal(done, want) {
+		t.Fatalf("got actions %+v, want %+v", done, want)
+	}
+	if s.Status != Compensated || s.Progress[2].Status != StepFailed || s.Progress[2].Error != "transaction rejected" {
+		t.Fatalf("unexpected %+v", s)
+	}
+	if s.Progress[0].Status != StepCompensated || s.Progress[0].CompensationID != "at1x" {
+		t.Fatalf("unexpected progress %+v", s.Progress[0])
+	}
+}
+
+func TestFirstStepFails(t *testing.T) {
+	s := New(steps(), now)
+	done := drive(t, s, func(Action) Outcome { return Outcome{Err: "exit 1"} })
+	if len(done) != 1 || s.Status != Compensated || s.Progress[1].Status != StepPending {
+		t.Fatalf("unexpected %+v after %+v", s, done)
+	}
+}
+
+func TestCompensationFails(t *testing.T) {
+	s := New(steps(), now)
+	drive(t, s, func(a Action) Outcome {
+		switch {
+		case a.Index == 1 && !a.Compensate:
+			return Outcome{Err: "exit 1"}
+		case a.Compensate:
+			return Outcome{Err: "revoke rejected"}
+		}
+		return Outcome{}
+	})
+	if s.Status != Failed || s.Progress[0].Status != StepCompensationFailed || s.Progress[0].Error != "revoke rejected" {
+		t.Fatalf("unexpected %+v", s)
+	}
+}
+
+func TestResumeConfirmsPendingTransaction(t *testing.T) {
+	s := New(steps(), now)
+	drive(t, s, func(a Action) Outcome {
+		if a.Index == 1 {
+			return Outcome{TransactionID: "at1transfer", Err: "transaction not confirmed", Pending: true}
+		}
+		return Outcome{}
+	})
+	if s.Status != Running || s.Stalled == "" || s.Final() {
+		t.Fatalf("expected a stalled saga, got %+v", s)
+	}
+
+	// The saga survives a round trip through the store and picks up the same transaction.
+	b, _ := json.Marshal(s)
+	var resumed Saga
+	if err := json.Unmarshal(b, &resumed); err != nil {
+		t.Fatal(err)
+	}
+	a, ok := resumed.Next()
+	if !ok || a.Index != 1 || a.TransactionID != "at1transfer" {
+		t.Fatalf("unexpected next action %+v", a)
+	}
+	drive(t, &resumed, func(Action) Outcome { return Outcome{} })
+	if resumed.Status != Completed || resumed.Stalled != "" {
+		t.Fatalf("unexpected %+v", resumed)
+	}
+}
+
+func TestRecordRejectsOtherActions(t *testing.T) {
+	s := New(steps(), now)
+	if err := s.Record(Action{Index: 1}, Outcome{}, now); err != ErrMismatch {
+		t.Fatalf("expected ErrMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+// Package scaffold renders request-supplied file templates over a project generated by
+// leo new and packs the project as a gzipped tarball.
+package scaffold
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Bounds on a template.
+const (
+	MaxFiles     = 200
+	MaxFileBytes = 1 << 20
+)
+
+// ErrTooLarge is returned by Pack when the archive would exceed its limit.
+var ErrTooLarge = errors.New("project archive too large")
+
+// nameRE matches the program names leo new accepts.
+var nameRE = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// placeholder matches "{{name}}" in a template; single braces are left alone, since Leo
+// code is full of them.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z][A-Za-z0-9_]*)\s*\}\}`)
+
+// ValidName reports whether name can be a program name: a lowercase letter, then
+// lowercase letters, digits and underscores.
+func ValidName(name string) bool {
+	return nameRE.MatchString(name)
+}
+
+// Template maps file paths, slash-separated and relative to the project root, to their
+// contents.
+type Template map[string]string
+
+// Render writes t into dir, filling each {{param}} with params. Files replace those leo
+// generated. Every placeholder must be given. Paths cannot leave dir, also not through
+// symlinks. It returns the paths written, sorted.
+func Render(dir string, t Template, params map[string]string) ([]string, error) {
+	if len(t) > MaxFiles {
+		return nil, fmt.Errorf("template has %d files, at most %d are allowed", len(t), MaxFiles)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	var missing []string
+	paths := slices.Sorted(maps.Keys(t))
+	for _, p := range paths {
+		name := filepath.FromSlash(p)
+		if !filepath.IsLocal(name) || strings.HasSuffix(p, "/") {
+			return nil, fmt.Errorf("template path %q must be a file inside the project", p)
+		}
+		if len(t[p]) > MaxFileBytes {
+			return nil, fmt.Errorf("template file %q is over %d bytes", p, MaxFileBytes)
+		}
+		content := placeholder.ReplaceAllStringFunc(t[p], func(m string) string {
+			key := placeholder.FindStringSubmatch(m)[1]
+			v, ok := params[key]
+			if !ok {
+				missing = append(missing, key)
+				return m
+			}
+			return v
+		})
+		if d := filepath.Dir(name); d != "." {
+			if err := root.MkdirAll(d, 0o755); err != nil {
+				return nil, err
+			}
+		}
+		if err := root.WriteFile(name, []byte(content), 0o644); err != nil {
+			return nil, err
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return nil, fmt.Errorf("missing template params: %s", strings.Join(slices.Compact(missing), ", "))
+	}
+	return paths, nil
+}
+
+// Pack writes the regular files and directories below dir to w as a gzipped tarball,
+// under the top-level directory prefix. Paths in skip, relative to dir, are left out;
+// symlinks and other special files are too. It fails with ErrTooLarge once more than
+// limit bytes of files would be packed, and returns the paths packed, sorted.
+func Pack(w io.Writer, dir, prefix string, skip []string, limit int64) ([]string, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	var files []string
+	var total int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if slices.Contains(skip, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() && !d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(prefix, rel)
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if d.IsDir() {
+			hdr.Name += "/"
+			return tw.WriteHeader(hdr)
+		}
+		if total += info.Size(); total > limit {
+			return ErrTooLarge
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(tw, f); err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	return files, nil
+}
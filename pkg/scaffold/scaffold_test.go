@@ -0,0 +1,114 @@
+package scaffold
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tmpl := Template{
+		"src/main.leo": "program {{name}}.aleo {\n    const SUPPLY: u64 = {{ supply }}u64;\n}\n",
+		"README.md":    "# {{name}}\n",
+	}
+	files, err := Render(dir, tmpl, map[string]string{"name": "token_v2", "supply": "1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(files, []string{"README.md", "src/main.leo"}) {
+		t.Fatalf("unexpected files %q", files)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "src", "main.leo"))
+	if string(b) != "program token_v2.aleo {\n    const SUPPLY: u64 = 1000u64;\n}\n" {
+		t.Fatalf("unexpected render %q", b)
+	}
+
+	for _, tc := range []struct {
+		tmpl   Template
+		params map[string]string
+	}{
+		{Template{"../escape.leo": "x"}, nil},
+		{Template{"/abs.leo": "x"}, nil},
+		{Template{"src/": "x"}, nil},
+		{Template{"a.leo": "{{missing}}"}, map[string]string{"other": "1"}},
+	} {
+		if _, err := Render(dir, tc.tmpl, tc.params); err == nil {
+			t.Fatalf("expected %v with %v to be rejected", tc.tmpl, tc.params)
+		}
+	}
+
+	// A symlink leo might have left cannot be written through.
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Render(dir, Template{"link/x.leo": "x"}, nil); err == nil {
+		t.Fatal("expected a write through a symlink to fail")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "x.leo")); err == nil {
+		t.Fatal("file written outside the project")
+	}
+}
+
+func TestPack(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"program.json": "{}", "src/main.leo": "program x.aleo {}", ".env": "PRIVATE_KEY=x"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = os.Symlink("/etc/passwd", filepath.Join(dir, "passwd"))
+
+	var buf bytes.Buffer
+	files, err := Pack(&buf, dir, "x", []string{".env"}, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(files, []string{"program.json", "src/main.leo"}) {
+		t.Fatalf("unexpected files %q", files)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	got := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(b)
+	}
+	if len(got) != 4 || got["x/src/main.leo"] != "program x.aleo {}" || got["x/src/"] != "" {
+		t.Fatalf("unexpected archive %q", got)
+	}
+
+	if _, err := Pack(io.Discard, dir, "x", nil, 4); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{"token_v2": true, "a": true, "Token": false, "2fa": false, "x.aleo": false, "": false, "../x": false} {
+		if ValidName(name) != want {
+			t.Fatalf("ValidName(%q) != %v", name, want)
+		}
+	}
+}
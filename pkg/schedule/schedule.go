@@ -0,0 +1,252 @@
+// Package schedule decides which recurring invocation presets are due. Schedules use
+// five-field cron expressions evaluated in UTC at minute resolution, so a single
+// once-a-minute trigger can drive any number of them.
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/clock"
+)
+
+// Schedule runs Preset with Params whenever Cron matches.
+type Schedule struct {
+	Name   string            `json:"name"`
+	Cron   string            `json:"cron"`
+	Preset string            `json:"preset"`
+	Params map[string]string `json:"params,omitempty"`
+	// Jitter delays each run by a random duration up to this long, spreading load
+	// when many schedules share a minute.
+	Jitter Duration `json:"jitter,omitempty"`
+
+	expr *Expr
+}
+
+// Duration is a time.Duration written as a string such as "30s" in JSON.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Parse decodes the SCHEDULES JSON array. An empty string yields no schedules.
+func Parse(raw string) ([]Schedule, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var list []Schedule
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil, fmt.Errorf("invalid SCHEDULES: %w", err)
+	}
+	seen := map[string]bool{}
+	for i := range list {
+		s := &list[i]
+		if s.Name == "" || s.Preset == "" {
+			return nil, fmt.Errorf("invalid SCHEDULES: entry %d needs a name and a preset", i)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("invalid SCHEDULES: duplicate name %q", s.Name)
+		}
+		seen[s.Name] = true
+		expr, err := ParseCron(s.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SCHEDULES: %s: %w", s.Name, err)
+		}
+		if s.Jitter < 0 {
+			return nil, fmt.Errorf("invalid SCHEDULES: %s: negative jitter", s.Name)
+		}
+		s.expr = expr
+	}
+	return list, nil
+}
+
+// Due reports whether s should run in the minute containing t.
+func (s Schedule) Due(t time.Time) bool {
+	return s.expr != nil && s.expr.Match(t)
+}
+
+// Delay returns a delay within the schedule's jitter drawn from rng.
+func (s Schedule) Delay(rng clock.RNG) time.Duration {
+	return clock.Duration(rng, time.Duration(s.Jitter))
+}
+
+// Expr is a parsed cron expression: minute, hour, day of month, month, day of week.
+type Expr struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record unrestricted day fields: as in cron, when both day
+	// fields are restricted a time matches if either does.
+	domStar, dowStar bool
+}
+
+var fieldRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// ParseCron parses a five-field cron expression. Fields accept "*", numbers, ranges
+// ("1-5"), steps ("*/15", "0-30/10") and comma-separated lists. Day of week 7 is Sunday.
+func ParseCron(expr string) (*Expr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: want 5 fields, got %d", expr, len(fields))
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseField(f, fieldRanges[i][0], fieldRanges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %w", expr, err)
+		}
+		bits[i] = b
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &Expr{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domStar: fields[2] == "*", dowStar: fields[4] == "*",
+	}, nil
+}
+
+func parseField(f string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for part := range strings.SplitSeq(f, ",") {
+		rng, stepRaw, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepRaw); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Match reports whether t, in UTC, falls in a minute the expression selects.
+func (e *Expr) Match(t time.Time) bool {
+	t = t.UTC()
+	has := func(bits uint64, v int) bool { return bits&(1<<v) != 0 }
+	if !has(e.minute, t.Minute()) || !has(e.hour, t.Hour()) || !has(e.month, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(e.dom, t.Day()), has(e.dow, int(t.Weekday()))
+	if e.domStar || e.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// ErrRunning is returned by Tracker.Begin while a previous run is still in flight.
+var ErrRunning = errors.New("previous run still in progress")
+
+// Run is one entry of a schedule's history.
+type Run struct {
+	Started  time.Time `json:"started"`
+	Duration float64   `json:"durationSeconds"`
+	Status   int       `json:"status"`
+	ExitCode int       `json:"exitCode"`
+	// Skipped says why the schedule did not run; Error why the run itself failed.
+	Skipped string `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Tracker prevents overlapping runs of a schedule and keeps its recent history. It is
+// per process: Lambda containers do not share it.
+type Tracker struct {
+	mu      sync.Mutex
+	limit   int
+	running map[string]bool
+	history map[string][]Run
+}
+
+// NewTracker returns a tracker keeping the last limit runs per schedule.
+func NewTracker(limit int) *Tracker {
+	return &Tracker{limit: limit, running: map[string]bool{}, history: map[string][]Run{}}
+}
+
+// Begin marks name as running, or returns ErrRunning.
+func (t *Tracker) Begin(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running[name] {
+		return ErrRunning
+	}
+	t.running[name] = true
+	return nil
+}
+
+// End clears the running mark set by Begin.
+func (t *Tracker) End(name string) {
+	t.mu.Lock()
+	delete(t.running, name)
+	t.mu.Unlock()
+}
+
+// Record appends r to name's history.
+func (t *Tracker) Record(name string, r Run) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := append(t.history[name], r)
+	if len(h) > t.limit {
+		h = h[len(h)-t.limit:]
+	}
+	t.history[name] = h
+}
+
+// History returns a copy of every schedule's recent runs, oldest first.
+func (t *Tracker) History() map[string][]Run {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string][]Run, len(t.history))
+	for k, v := range t.history {
+		out[k] = append([]Run(nil), v...)
+	}
+	return out
+}
+
+// Reset forgets history. Runs in flight stay marked so they cannot be started twice.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	t.history = map[string][]Run{}
+	t.mu.Unlock()
+}
@@ -0,0 +1,95 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/clock"
+)
+
+func TestCronMatch(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	cases := []struct {
+		expr string
+		at   string
+		want bool
+	}{
+		{"* * * * *", "2025-03-01T10:17:42Z", true},
+		{"*/5 * * * *", "2025-03-01T10:15:00Z", true},
+		{"*/5 * * * *", "2025-03-01T10:17:00Z", false},
+		{"0 9-17/4 * * *", "2025-03-01T13:00:00Z", true},
+		{"0 9-17/4 * * *", "2025-03-01T14:00:00Z", false},
+		{"30 6 1,15 * *", "2025-03-15T06:30:00Z", true},
+		{"0 0 * * 7", "2025-03-02T00:00:00Z", true}, // Sunday
+		{"0 0 * * 1-5", "2025-03-02T00:00:00Z", false},
+		// Both day fields restricted: either may match.
+		{"0 0 13 * 5", "2025-06-06T00:00:00Z", true},
+		{"0 0 13 * 5", "2025-06-13T00:00:00Z", true},
+		{"0 0 13 * 5", "2025-06-14T00:00:00Z", false},
+		{"0 12 * 2 *", "2025-02-10T12:00:00+01:00", false}, // 11:00 UTC
+	}
+	for _, tc := range cases {
+		e, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if got := e.Match(at(tc.at)); got != tc.want {
+			t.Fatalf("%s at %s: got %v, want %v", tc.expr, tc.at, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "* * 0 * *"} {
+		if _, err := ParseCron(bad); err == nil {
+			t.Fatalf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	list, err := Parse(`[{"name": "oracle", "cron": "*/5 * * * *", "preset": "push", "params": {"price": "42"}, "jitter": "30s"}]`)
+	if err != nil || len(list) != 1 || time.Duration(list[0].Jitter) != 30*time.Second {
+		t.Fatalf("unexpected %+v (%v)", list, err)
+	}
+	if d := list[0].Delay(clock.Crypto); d < 0 || d >= 30*time.Second {
+		t.Fatalf("delay %v outside jitter", d)
+	}
+	if a, b := list[0].Delay(clock.NewSeeded(1)), list[0].Delay(clock.NewSeeded(1)); a != b {
+		t.Fatalf("seeded delays differ: %v, %v", a, b)
+	}
+	for _, bad := range []string{
+		`[{"name": "a", "cron": "* * * * *"}]`,
+		`[{"name": "a", "cron": "bad", "preset": "p"}]`,
+		`[{"name": "a", "cron": "* * * * *", "preset": "p"}, {"name": "a", "cron": "* * * * *", "preset": "p"}]`,
+		`[{"name": "a", "cron": "* * * * *", "preset": "p", "jitter": "soon"}]`,
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Fatalf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(2)
+	if err := tr.Begin("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Begin("a"); !errors.Is(err, ErrRunning) {
+		t.Fatalf("expected ErrRunning, got %v", err)
+	}
+	tr.End("a")
+	if err := tr.Begin("a"); err != nil {
+		t.Fatalf("expected to start again: %v", err)
+	}
+	for i := range 3 {
+		tr.Record("a", Run{ExitCode: i})
+	}
+	if h := tr.History()["a"]; len(h) != 2 || h[0].ExitCode != 1 || h[1].ExitCode != 2 {
+		t.Fatalf("unexpected history %+v", h)
+	}
+}
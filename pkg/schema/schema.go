@@ -0,0 +1,300 @@
+// Package schema validates request bodies against the embedded OpenAPI document.
+// It implements the subset of JSON Schema used by openapi.json, which is the
+// canonical description of the HTTP API.
+package schema
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed openapi.json
+var openAPIDoc []byte
+
+// Document returns the raw OpenAPI document.
+func Document() []byte { return openAPIDoc }
+
+// Schema is the JSON Schema subset supported by the validator.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MaxProperties        *int               `json:"maxProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// FieldError describes a single violation at a JSON path such as "args[1]".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError aggregates all field violations of a document.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Field == "" {
+			parts = append(parts, fe.Message)
+			continue
+		}
+		parts = append(parts, fe.Field+": "+fe.Message)
+	}
+	return "invalid request body: " + strings.Join(parts, "; ")
+}
+
+var (
+	loadOnce   sync.Once
+	components map[string]*Schema
+	loadErr    error
+)
+
+func load() (map[string]*Schema, error) {
+	loadOnce.Do(func() {
+		var doc struct {
+			Components struct {
+				Schemas map[string]*Schema `json:"schemas"`
+			} `json:"components"`
+		}
+		if err := json.Unmarshal(openAPIDoc, &doc); err != nil {
+			loadErr = fmt.Errorf("parse openapi document: %w", err)
+			return
+		}
+		components = doc.Components.Schemas
+	})
+	return components, loadErr
+}
+
+// Validate checks raw JSON against the named component schema (e.g. "InvokeRequest").
+func Validate(name string, raw []byte) error {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return ValidateValue(name, v)
+}
+
+// ValidateValue checks an already decoded JSON value against the named component schema.
+func ValidateValue(name string, v any) error {
+	comps, err := load()
+	if err != nil {
+		return err
+	}
+	s, ok := comps[name]
+	if !ok {
+		return fmt.Errorf("unknown schema %q", name)
+	}
+	var errs []FieldError
+	validate(s, v, "", &errs)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok {
+			return s
+		}
+		s = components[name]
+	}
+	return s
+}
+
+func validate(s *Schema, v any, path string, errs *[]FieldError) {
+	s = resolve(s)
+	if s == nil {
+		return
+	}
+	add := func(field, format string, a ...any) {
+		*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf(format, a...)})
+	}
+	if s.Type != "" && !typeMatches(s.Type, v) {
+		add(path, "expected %s, got %s", s.Type, jsonType(v))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return e == v }) {
+		add(path, "must be one of %v", s.Enum)
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		if s.MaxProperties != nil && len(t) > *s.MaxProperties {
+			add(path, "must contain at most %d propert(ies)", *s.MaxProperties)
+		}
+		validateObject(s, t, path, errs)
+	case []any:
+		if s.MinItems != nil && len(t) < *s.MinItems {
+			add(path, "must contain at least %d item(s)", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(t) > *s.MaxItems {
+			add(path, "must contain at most %d item(s)", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range t {
+				validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case string:
+		if s.MinLength != nil && len(strings.TrimSpace(t)) < *s.MinLength {
+			add(path, "must not be empty")
+		}
+		if s.MaxLength != nil && len(t) > *s.MaxLength {
+			add(path, "must be at most %d characters", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(t) {
+				add(path, "must match %s", s.Pattern)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && t < *s.Minimum {
+			add(path, "must be >= %v", *s.Minimum)
+		}
+		if s.Maximum != nil && t > *s.Maximum {
+			add(path, "must be <= %v", *s.Maximum)
+		}
+	}
+}
+
+func validateObject(s *Schema, obj map[string]any, path string, errs *[]FieldError) {
+	for _, r := range s.Required {
+		if _, ok := obj[r]; !ok {
+			*errs = append(*errs, FieldError{Field: join(path, r), Message: "is required"})
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	additional, closed := additionalSchema(s.AdditionalProperties)
+	for _, k := range keys {
+		if ps, ok := s.Properties[k]; ok {
+			validate(ps, obj[k], join(path, k), errs)
+			continue
+		}
+		if closed {
+			*errs = append(*errs, FieldError{Field: join(path, k), Message: "unknown field"})
+			continue
+		}
+		if additional != nil {
+			validate(additional, obj[k], join(path, k), errs)
+		}
+	}
+	if len(s.OneOf) > 0 {
+		validateOneOf(s.OneOf, obj, path, errs)
+	}
+}
+
+// validateOneOf reports a friendly message for the common "exactly one of these
+// fields" pattern expressed as oneOf over required-only subschemas.
+func validateOneOf(options []*Schema, obj map[string]any, path string, errs *[]FieldError) {
+	var names, matched []string
+	count := 0
+	for _, o := range options {
+		o = resolve(o)
+		var sub []FieldError
+		validate(o, obj, path, &sub)
+		names = append(names, o.Required...)
+		if len(sub) == 0 {
+			count++
+			matched = append(matched, o.Required...)
+		}
+	}
+	switch {
+	case count == 0:
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf("one of %s is required", strings.Join(names, ", "))})
+	case count > 1:
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf("%s are mutually exclusive", strings.Join(matched, ", "))})
+	}
+}
+
+func additionalSchema(raw json.RawMessage) (*Schema, bool) {
+	if len(raw) == 0 {
+		return nil, false
+	}
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return nil, !b
+	}
+	var s Schema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, false
+	}
+	return &s, false
+}
+
+func typeMatches(want string, v any) bool {
+	switch want {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return true
+}
+
+func jsonType(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if t == math.Trunc(t) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,53 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateInvokeRequest(t *testing.T) {
+	cases := []struct {
+		name  string
+		body  string
+		valid bool
+		field string
+	}{
+		{name: "args ok", body: `{"args": ["execute", "a.aleo/b"]}`, valid: true},
+		{name: "cmd ok", body: `{"cmd": "execute a.aleo/b"}`, valid: true},
+		{name: "unknown field", body: `{"args": ["x"], "timeout": "90s"}`, field: "timeout"},
+		{name: "wrong item type", body: `{"args": ["execute", 1]}`, field: "args[1]"},
+		{name: "wrong type", body: `{"cmd": ["execute"]}`, field: "cmd"},
+		{name: "both", body: `{"args": ["x"], "cmd": "y"}`, field: ""},
+		{name: "neither", body: `{}`, field: ""},
+		{name: "empty args", body: `{"args": []}`, field: "args"},
+		{name: "not object", body: `[]`, field: ""},
+		{name: "tags ok", body: `{"args": ["x"], "tags": {"orderId": "42"}}`, valid: true},
+		{name: "tag not string", body: `{"args": ["x"], "tags": {"orderId": 42}}`, field: "tags.orderId"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate("InvokeRequest", []byte(tc.body))
+			if tc.valid {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected ValidationError, got %v", err)
+			}
+			if verr.Errors[0].Field != tc.field {
+				t.Fatalf("expected field %q, got %+v", tc.field, verr.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidJSON(t *testing.T) {
+	err := Validate("InvokeRequest", []byte(`{`))
+	var verr *ValidationError
+	if err == nil || errors.As(err, &verr) {
+		t.Fatalf("expected plain JSON error, got %v", err)
+	}
+}
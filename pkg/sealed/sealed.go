@@ -0,0 +1,79 @@
+// Package sealed decrypts SEALED_CONFIG: configuration variables encrypted with AWS KMS
+// into a single environment variable, so private keys, allowlists and client secrets
+// never show in plaintext in the Lambda console or in environment listings.
+package sealed
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// Var is the environment variable holding the sealed configuration.
+const Var = "SEALED_CONFIG"
+
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Open decrypts blob, the base64 ciphertext `aws kms encrypt` returns for a JSON object
+// of variable names to values, e.g. {"PRIVATE_KEY": "APrivateKey1...",
+// "HMAC_CLIENTS": {"partner": {"primary": "..."}}}. String values are used as they are;
+// other values become their JSON text, for variables that take JSON.
+func Open(ctx context.Context, client *awsapi.Client, blob string) (map[string]string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(blob))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: not base64: %w", Var, err)
+	}
+	var out struct {
+		Plaintext []byte
+	}
+	if err := client.JSON(ctx, "kms", "TrentService.Decrypt", map[string]any{"CiphertextBlob": ciphertext}, &out); err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", Var, err)
+	}
+	return Parse(out.Plaintext)
+}
+
+// Parse decodes decrypted configuration, as described for Open.
+func Parse(plaintext []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(plaintext, &raw); err != nil {
+		return nil, fmt.Errorf("invalid %s: want a JSON object: %w", Var, err)
+	}
+	vars := make(map[string]string, len(raw))
+	for name, v := range raw {
+		switch {
+		case !validName.MatchString(name):
+			return nil, fmt.Errorf("invalid %s: %q is not a variable name", Var, name)
+		case name == Var:
+			return nil, fmt.Errorf("invalid %s: it cannot contain itself", Var)
+		}
+		var s string
+		if err := json.Unmarshal(v, &s); err != nil {
+			s = string(v)
+		}
+		vars[name] = s
+	}
+	if len(vars) == 0 {
+		return nil, errors.New("invalid " + Var + ": no variables")
+	}
+	return vars, nil
+}
+
+// Merge returns environ, given as by os.Environ, with the variables of vars it does not
+// already set appended, so a plaintext variable overrides its sealed value.
+func Merge(environ []string, vars map[string]string) []string {
+	out := slices.Clone(environ)
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		if !slices.ContainsFunc(environ, func(kv string) bool { return strings.HasPrefix(kv, name+"=") }) {
+			out = append(out, name+"="+vars[name])
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package sealed
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+func TestOpen(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			CiphertextBlob []byte
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || r.Header.Get("X-Amz-Target") != "TrentService.Decrypt" {
+			t.Errorf("unexpected KMS request: %v %s", err, r.Header.Get("X-Amz-Target"))
+		}
+		// The fake "ciphertext" is the plaintext itself.
+		_ = json.NewEncoder(w).Encode(map[string]any{"Plaintext": in.CiphertextBlob})
+	}))
+	defer srv.Close()
+	client := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	blob := base64.StdEncoding.EncodeToString([]byte(`{"PRIVATE_KEY": "APrivateKey1zkp", "RATE_LIMIT_PER_MINUTE": 60, "HMAC_CLIENTS": {"partner": {"primary": "s"}}}`))
+	vars, err := Open(context.Background(), client, blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["PRIVATE_KEY"] != "APrivateKey1zkp" || vars["RATE_LIMIT_PER_MINUTE"] != "60" || vars["HMAC_CLIENTS"] != `{"partner": {"primary": "s"}}` {
+		t.Fatalf("unexpected vars %v", vars)
+	}
+	if _, err := Open(context.Background(), client, "not base64!"); err == nil {
+		t.Fatal("expected an error for a malformed blob")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, plaintext := range []string{`[]`, `{}`, `{"BAD-NAME": "x"}`, `{"SEALED_CONFIG": "x"}`, `not json`} {
+		if _, err := Parse([]byte(plaintext)); err == nil {
+			t.Errorf("expected %s to be rejected", plaintext)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := Merge([]string{"ALLOWED_CONTRACTS=token.aleo", "DRY_RUN=true"}, map[string]string{"ALLOWED_CONTRACTS": "nft.aleo", "PRIVATE_KEY": "k", "DRY": "x"})
+	want := []string{"ALLOWED_CONTRACTS=token.aleo", "DRY_RUN=true", "DRY=x", "PRIVATE_KEY=k"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,190 @@
+// Package selftest verifies that a container image can serve invocations: the bundled
+// leo binary runs, proving parameters are present, the workdir is writable and the RPC
+// endpoint is reachable over TLS. Callers can add checks of their own, and every check
+// that does not pass says what to do about it.
+package selftest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/executor"
+)
+
+// Check statuses. Warnings are reported but do not fail the self-test.
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+	StatusSkip = "skip"
+)
+
+// Options configures the checks.
+type Options struct {
+	LeoBin    string
+	WorkDir   string
+	Endpoint  string
+	ParamsDir string
+	// Offline skips checks that need network access, e.g. during a Docker build.
+	Offline bool
+	Timeout time.Duration
+	// Extra checks run after the built-in ones, each under Timeout too.
+	Extra []Step
+}
+
+// Step is a check added through Options.Extra. Run returns the check's status, its
+// detail and, unless it passed, a remedy.
+type Step struct {
+	Name string
+	Run  func(ctx context.Context) (status, detail, remedy string)
+}
+
+// Check is the outcome of one step.
+type Check struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Detail   string  `json:"detail,omitempty"`
+	Remedy   string  `json:"remedy,omitempty"`
+	Duration float64 `json:"duration"`
+}
+
+// Report is the JSON document printed by -selftest. Status is the worst status of its
+// checks, skipped ones aside.
+type Report struct {
+	OK     bool    `json:"ok"`
+	Status string  `json:"status"`
+	Checks []Check `json:"checks"`
+}
+
+// remedies are the fixes suggested for built-in checks that warn or fail.
+var remedies = map[string]string{
+	"leo_version":  "rebuild the image with a working leo binary, or point LEO_BIN at one",
+	"parameters":   "bake the proving parameters into the image, or mount them and set LEO_PARAMS_DIR",
+	"workdir":      "point WORKDIR at writable storage such as /tmp or an EFS mount",
+	"endpoint_tls": "check ENDPOINT and the function's outbound access (VPC NAT gateway, security groups)",
+}
+
+// DefaultParamsDir returns where snarkVM caches its proving parameters.
+func DefaultParamsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aleo", "resources")
+}
+
+// Run executes every check and returns the report.
+func Run(ctx context.Context, o Options) Report {
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	steps := []Step{
+		builtin("leo_version", checkVersion, o),
+		builtin("parameters", checkParams, o),
+		builtin("workdir", checkWorkdir, o),
+		builtin("endpoint_tls", checkEndpoint, o),
+	}
+	r := Report{OK: true, Status: StatusPass}
+	for _, s := range append(steps, o.Extra...) {
+		cctx, cancel := context.WithTimeout(ctx, o.Timeout)
+		start := time.Now()
+		status, detail, remedy := s.Run(cctx)
+		cancel()
+		if status == StatusPass || status == StatusSkip {
+			remedy = ""
+		}
+		r.Checks = append(r.Checks, Check{Name: s.Name, Status: status, Detail: detail, Remedy: remedy, Duration: time.Since(start).Seconds()})
+		switch {
+		case status == StatusFail:
+			r.OK, r.Status = false, StatusFail
+		case status == StatusWarn && r.Status == StatusPass:
+			r.Status = StatusWarn
+		}
+	}
+	return r
+}
+
+// builtin wraps a built-in check as a Step suggesting its entry in remedies.
+func builtin(name string, fn func(context.Context, Options) (string, string), o Options) Step {
+	return Step{Name: name, Run: func(ctx context.Context) (string, string, string) {
+		status, detail := fn(ctx, o)
+		return status, detail, remedies[name]
+	}}
+}
+
+func checkVersion(ctx context.Context, o Options) (string, string) {
+	res := executor.Run(ctx, executor.Config{BinPath: o.LeoBin, Args: []string{"--version"}})
+	if res.ExitCode != 0 {
+		return StatusFail, fmt.Sprintf("%s --version exited %d: %s", o.LeoBin, res.ExitCode, res.Stderr)
+	}
+	return StatusPass, strings.TrimSpace(res.Stdout)
+}
+
+// checkParams only warns: leo downloads missing parameters on first use, which works
+// but adds minutes to the first proof.
+func checkParams(_ context.Context, o Options) (string, string) {
+	if o.ParamsDir == "" {
+		return StatusWarn, "no parameters directory configured"
+	}
+	entries, err := os.ReadDir(o.ParamsDir)
+	if err != nil || len(entries) == 0 {
+		return StatusWarn, fmt.Sprintf("no parameters in %s; they will be downloaded on first use", o.ParamsDir)
+	}
+	return StatusPass, fmt.Sprintf("%d files in %s", len(entries), o.ParamsDir)
+}
+
+func checkWorkdir(_ context.Context, o Options) (string, string) {
+	if err := os.MkdirAll(o.WorkDir, 0o755); err != nil {
+		return StatusFail, err.Error()
+	}
+	f, err := os.CreateTemp(o.WorkDir, ".selftest-*")
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	name := f.Name()
+	_, werr := f.WriteString("ok")
+	cerr := f.Close()
+	_ = os.Remove(name)
+	if werr != nil {
+		return StatusFail, werr.Error()
+	}
+	if cerr != nil {
+		return StatusFail, cerr.Error()
+	}
+	return StatusPass, o.WorkDir
+}
+
+func checkEndpoint(ctx context.Context, o Options) (string, string) {
+	if o.Offline {
+		return StatusSkip, "offline"
+	}
+	if o.Endpoint == "" {
+		return StatusSkip, "no endpoint configured"
+	}
+	u, err := url.Parse(o.Endpoint)
+	if err != nil || u.Host == "" {
+		return StatusFail, fmt.Sprintf("invalid endpoint %q", o.Endpoint)
+	}
+	if u.Scheme != "https" {
+		return StatusWarn, fmt.Sprintf("endpoint %s is not TLS", o.Endpoint)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "443")
+	}
+	d := tls.Dialer{Config: &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return StatusFail, err.Error()
+	}
+	defer conn.Close()
+	state := conn.(*tls.Conn).ConnectionState()
+	return StatusPass, fmt.Sprintf("%s (%s)", host, tls.VersionName(state.Version))
+}
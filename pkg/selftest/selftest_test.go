@@ -0,0 +1,65 @@
+package selftest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunOffline(t *testing.T) {
+	dir := t.TempDir()
+	r := Run(context.Background(), Options{LeoBin: "echo", WorkDir: filepath.Join(dir, "work"), ParamsDir: filepath.Join(dir, "missing"), Offline: true})
+	if !r.OK || r.Status != StatusWarn {
+		t.Fatalf("expected ok report with warnings, got %+v", r)
+	}
+	want := map[string]string{"leo_version": StatusPass, "parameters": StatusWarn, "workdir": StatusPass, "endpoint_tls": StatusSkip}
+	for _, c := range r.Checks {
+		if want[c.Name] != c.Status {
+			t.Fatalf("check %s: expected %s, got %s (%s)", c.Name, want[c.Name], c.Status, c.Detail)
+		}
+		if (c.Remedy != "") != (c.Status == StatusWarn) {
+			t.Fatalf("check %s: unexpected remedy %q", c.Name, c.Remedy)
+		}
+	}
+}
+
+func TestRunExtra(t *testing.T) {
+	dir := t.TempDir()
+	extra := []Step{
+		{Name: "passing", Run: func(context.Context) (string, string, string) { return StatusPass, "fine", "ignored" }},
+		{Name: "failing", Run: func(context.Context) (string, string, string) { return StatusFail, "broken", "fix it" }},
+	}
+	r := Run(context.Background(), Options{LeoBin: "echo", WorkDir: dir, ParamsDir: dir, Offline: true, Extra: extra})
+	if r.OK || r.Status != StatusFail || len(r.Checks) != 6 {
+		t.Fatalf("expected failing report with six checks, got %+v", r)
+	}
+	if c := r.Checks[4]; c.Name != "passing" || c.Remedy != "" {
+		t.Fatalf("unexpected passing check %+v", c)
+	}
+	if c := r.Checks[5]; c.Name != "failing" || c.Remedy != "fix it" {
+		t.Fatalf("unexpected failing check %+v", c)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Run(context.Background(), Options{LeoBin: "false", WorkDir: filepath.Join(file, "sub"), Endpoint: srv.URL})
+	if r.OK {
+		t.Fatalf("expected failing report")
+	}
+	for _, c := range r.Checks {
+		// The test server's certificate is self-signed, so TLS verification must fail.
+		if c.Name != "parameters" && c.Status != StatusFail {
+			t.Fatalf("check %s: expected fail, got %s (%s)", c.Name, c.Status, c.Detail)
+		}
+	}
+}
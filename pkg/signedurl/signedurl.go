@@ -0,0 +1,151 @@
+// Package signedurl issues time-limited URLs that run one invocation preset without any
+// other credentials, for partners that can only call a plain URL (e.g. a webhook). The
+// URL carries an HMAC over the method, path, preset, expiry and use cap, so none of them
+// can be changed; uses are counted atomically in DynamoDB.
+package signedurl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/clock"
+)
+
+// Param is the query parameter carrying the signature token.
+const Param = "leo_sig"
+
+// Errors returned by Verify and Counter.Use.
+var (
+	ErrInvalid   = errors.New("signed URL is invalid")
+	ErrExpired   = errors.New("signed URL has expired")
+	ErrExhausted = errors.New("signed URL has no uses left")
+)
+
+// Claims are the restrictions a signed URL carries.
+type Claims struct {
+	ID        string    `json:"id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Preset    string    `json:"preset"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	MaxUses   int       `json:"maxUses"`
+}
+
+// NewID returns a random URL identifier drawn from rng.
+func NewID(rng clock.RNG) string {
+	var b [12]byte
+	rng.Read(b[:])
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// Token returns the value of Param for c: "<id>.<expiry>.<maxUses>.<signature>".
+func Token(secret string, c Claims) string {
+	exp := c.ExpiresAt.Unix()
+	return fmt.Sprintf("%s.%d.%d.%s", c.ID, exp, c.MaxUses, sign(secret, c.Method, c.Path, c.Preset, c.ID, exp, c.MaxUses))
+}
+
+// Query returns the query string of a signed URL for c.
+func Query(secret string, c Claims) string {
+	return url.Values{"preset": {c.Preset}, Param: {Token(secret, c)}}.Encode()
+}
+
+func sign(secret, method, path, preset, id string, exp int64, maxUses int) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(m, "leo-signed-url\n%s\n%s\n%s\n%s\n%d\n%d", strings.ToUpper(method), path, preset, id, exp, maxUses)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify checks token against the request's method, path and preset and returns its
+// claims.
+func Verify(secret, token, method, path, preset string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] == "" {
+		return Claims{}, ErrInvalid
+	}
+	exp, err1 := strconv.ParseInt(parts[1], 10, 64)
+	maxUses, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil {
+		return Claims{}, ErrInvalid
+	}
+	want, _ := hex.DecodeString(sign(secret, method, path, preset, parts[0], exp, maxUses))
+	got, _ := hex.DecodeString(parts[3])
+	if !hmac.Equal(got, want) {
+		return Claims{}, ErrInvalid
+	}
+	c := Claims{ID: parts[0], Method: strings.ToUpper(method), Path: path, Preset: preset, ExpiresAt: time.Unix(exp, 0).UTC(), MaxUses: maxUses}
+	if !now.Before(c.ExpiresAt) {
+		return c, ErrExpired
+	}
+	return c, nil
+}
+
+// Strip removes Param from a raw query string, leaving the invocation itself.
+func Strip(rawQuery string) string {
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	q.Del(Param)
+	return q.Encode()
+}
+
+// Counter counts uses of signed URLs.
+type Counter interface {
+	// Use records one use of c and returns the uses so far, or ErrExhausted.
+	Use(ctx context.Context, c Claims) (int, error)
+}
+
+// DynamoCounter keeps use counts in a DynamoDB table with string partition key "id".
+// Items are created on first use; enable TTL on expiresAt to have them removed.
+type DynamoCounter struct {
+	client *awsapi.Client
+	table  string
+}
+
+// NewDynamoCounter returns a counter backed by table.
+func NewDynamoCounter(client *awsapi.Client, table string) (*DynamoCounter, error) {
+	if table == "" {
+		return nil, errors.New("signed URL table name is required")
+	}
+	return &DynamoCounter{client: client, table: table}, nil
+}
+
+// Use implements Counter.
+func (d *DynamoCounter) Use(ctx context.Context, c Claims) (int, error) {
+	in := map[string]any{
+		"TableName":                d.table,
+		"Key":                      map[string]map[string]string{"id": {"S": c.ID}},
+		"UpdateExpression":         "ADD #uses :one SET #exp = :exp",
+		"ConditionExpression":      "attribute_not_exists(#uses) OR #uses < :max",
+		"ExpressionAttributeNames": map[string]string{"#uses": "uses", "#exp": "expiresAt"},
+		"ExpressionAttributeValues": map[string]map[string]string{
+			":one": {"N": "1"},
+			":max": {"N": strconv.Itoa(c.MaxUses)},
+			":exp": {"N": strconv.FormatInt(c.ExpiresAt.Unix(), 10)},
+		},
+		"ReturnValues": "UPDATED_NEW",
+	}
+	var out struct {
+		Attributes map[string]map[string]string
+	}
+	err := d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.UpdateItem", in, &out)
+	var apiErr *awsapi.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == "ConditionalCheckFailedException" {
+		return 0, ErrExhausted
+	}
+	if err != nil {
+		return 0, fmt.Errorf("count signed URL use: %w", err)
+	}
+	uses, _ := strconv.Atoi(out.Attributes["uses"]["N"])
+	return uses, nil
+}
@@ -0,0 +1,90 @@
+package signedurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/clock"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := Claims{ID: NewID(clock.Crypto), Method: "GET", Path: "/", Preset: "mint", ExpiresAt: now.Add(time.Hour), MaxUses: 3}
+	q, _ := url.ParseQuery(Query("secret", c))
+	token := q.Get(Param)
+	if q.Get("preset") != "mint" {
+		t.Fatalf("unexpected query %v", q)
+	}
+
+	got, err := Verify("secret", token, "get", "/", "mint", now)
+	if err != nil || got.ID != c.ID || got.MaxUses != 3 || !got.ExpiresAt.Equal(c.ExpiresAt) {
+		t.Fatalf("unexpected %+v (%v)", got, err)
+	}
+	for name, check := range map[string]func() error{
+		"other secret": func() error { _, err := Verify("other", token, "GET", "/", "mint", now); return err },
+		"other method": func() error { _, err := Verify("secret", token, "POST", "/", "mint", now); return err },
+		"other path":   func() error { _, err := Verify("secret", token, "GET", "/jobs", "mint", now); return err },
+		"other preset": func() error { _, err := Verify("secret", token, "GET", "/", "burn", now); return err },
+		"raised cap": func() error {
+			c2 := c
+			c2.MaxUses = 100
+			forged := Token("secret", c2)
+			_, err := Verify("secret", forged[:len(forged)-64]+token[len(token)-64:], "GET", "/", "mint", now)
+			return err
+		},
+		"malformed": func() error { _, err := Verify("secret", "abc", "GET", "/", "mint", now); return err },
+	} {
+		if err := check(); !errors.Is(err, ErrInvalid) {
+			t.Fatalf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+	if _, err := Verify("secret", token, "GET", "/", "mint", now.Add(2*time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if s := Strip("preset=mint&amount=5&" + Param + "=x"); s != "amount=5&preset=mint" {
+		t.Fatalf("unexpected stripped query %q", s)
+	}
+}
+
+func TestDynamoCounter(t *testing.T) {
+	uses := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Key                       map[string]map[string]string
+			ExpressionAttributeValues map[string]map[string]string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		id := in.Key["id"]["S"]
+		limit, _ := strconv.Atoi(in.ExpressionAttributeValues[":max"]["N"])
+		if uses[id] >= limit {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException","message":"The conditional request failed"}`))
+			return
+		}
+		uses[id]++
+		_ = json.NewEncoder(w).Encode(map[string]any{"Attributes": map[string]any{"uses": map[string]string{"N": strconv.Itoa(uses[id])}}})
+	}))
+	defer srv.Close()
+	client := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	d, err := NewDynamoCounter(client, "urls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Claims{ID: "u1", MaxUses: 2, ExpiresAt: time.Now().Add(time.Hour)}
+	for want := 1; want <= 2; want++ {
+		if n, err := d.Use(context.Background(), c); err != nil || n != want {
+			t.Fatalf("use %d: got %d (%v)", want, n, err)
+		}
+	}
+	if _, err := d.Use(context.Background(), c); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected ErrExhausted, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package signing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// fakeKMS signs digests with a local ECDSA key, mimicking TrentService.Sign.
+func fakeKMS(t *testing.T, key *ecdsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Message     string
+			MessageType string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.MessageType != "DIGEST" {
+			t.Errorf("unexpected KMS request: %v %+v", err, in)
+		}
+		digest, _ := base64.StdEncoding.DecodeString(in.Message)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest)
+		if err != nil {
+			t.Errorf("sign: %v", err)
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]byte{"Signature": sig})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestKMSSignerRoundTrip(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	srv := fakeKMS(t, key)
+	client := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+
+	s, err := NewKMSSigner(client, "alias/leo", "")
+	if err != nil {
+		t.Fatalf("new signer: %v", err)
+	}
+	body := []byte(`{"exitCode":0}`)
+	sig, err := s.Sign(context.Background(), body)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if err := Verify(&key.PublicKey, s.Algorithm(), body, sig); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := Verify(&key.PublicKey, s.Algorithm(), []byte(`{"exitCode":1}`), sig); err == nil {
+		t.Fatalf("expected tampered body to fail verification")
+	}
+}
+
+func TestNewKMSSignerRejectsAlgorithm(t *testing.T) {
+	if _, err := NewKMSSigner(&awsapi.Client{}, "k", "ECDSA_SHA_512"); err == nil {
+		t.Fatalf("expected unsupported algorithm error")
+	}
+}
@@ -0,0 +1,270 @@
+// Package state holds container-scoped warm state (parsed config, the leo version,
+// caches, endpoint health, rate-limit buckets) behind explicit lifecycle APIs, so it can
+// be invalidated as a whole in tests or after a snapshot restore instead of living in
+// ad-hoc package globals.
+package state
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Resetter is implemented by every piece of state a Registry manages.
+type Resetter interface {
+	Reset()
+}
+
+// Registry tracks named state so it can be invalidated individually or all at once.
+type Registry struct {
+	mu    sync.Mutex
+	items map[string]Resetter
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{items: map[string]Resetter{}}
+}
+
+// Register adds r under name, replacing any previous entry, and returns r.
+func Register[T Resetter](reg *Registry, name string, r T) T {
+	reg.mu.Lock()
+	reg.items[name] = r
+	reg.mu.Unlock()
+	return r
+}
+
+// Invalidate resets the named state and reports whether it exists.
+func (reg *Registry) Invalidate(name string) bool {
+	reg.mu.Lock()
+	r, ok := reg.items[name]
+	reg.mu.Unlock()
+	if ok {
+		r.Reset()
+	}
+	return ok
+}
+
+// Reset invalidates everything. Call it after restoring from a snapshot, where cached
+// credentials, clocks and counters from the snapshotted process must not be reused.
+func (reg *Registry) Reset() {
+	reg.mu.Lock()
+	items := make([]Resetter, 0, len(reg.items))
+	for _, r := range reg.items {
+		items = append(items, r)
+	}
+	reg.mu.Unlock()
+	for _, r := range items {
+		r.Reset()
+	}
+}
+
+// Names lists the registered state in sorted order.
+func (reg *Registry) Names() []string {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	names := make([]string, 0, len(reg.items))
+	for n := range reg.items {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Value lazily loads and caches a single value. Failed loads are not cached, so the
+// next Get retries.
+type Value[T any] struct {
+	mu     sync.Mutex
+	load   func() (T, error)
+	val    T
+	loaded bool
+}
+
+// NewValue returns a Value populated by load on first use.
+func NewValue[T any](load func() (T, error)) *Value[T] {
+	return &Value[T]{load: load}
+}
+
+// Get returns the cached value, loading it if needed.
+func (v *Value[T]) Get() (T, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.loaded {
+		return v.val, nil
+	}
+	val, err := v.load()
+	if err != nil {
+		return val, err
+	}
+	v.val, v.loaded = val, true
+	return val, nil
+}
+
+// Set stores val as if it had been loaded.
+func (v *Value[T]) Set(val T) {
+	v.mu.Lock()
+	v.val, v.loaded = val, true
+	v.mu.Unlock()
+}
+
+// Reset drops the cached value.
+func (v *Value[T]) Reset() {
+	v.mu.Lock()
+	var zero T
+	v.val, v.loaded = zero, false
+	v.mu.Unlock()
+}
+
+type cacheEntry[V any] struct {
+	val     V
+	expires time.Time
+}
+
+// Cache is a key/value cache with a fixed TTL, e.g. for secrets or responses.
+type Cache[V any] struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry[V]
+	now     func() time.Time
+}
+
+// NewCache returns a cache whose entries expire after ttl (never when ttl <= 0).
+func NewCache[V any](ttl time.Duration) *Cache[V] {
+	return &Cache[V]{ttl: ttl, entries: map[string]cacheEntry[V]{}, now: time.Now}
+}
+
+// Get returns the value for key if present and not expired.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	v, expired, _, ok := c.peek(key)
+	if !ok || expired {
+		var zero V
+		return zero, false
+	}
+	return v, true
+}
+
+// peek returns the entry for key even when expired, and for how long it has been.
+func (c *Cache[V]) peek(key string) (v V, expired bool, since time.Duration, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return v, false, 0, false
+	}
+	now := c.now()
+	if e.expires.IsZero() || now.Before(e.expires) {
+		return e.val, false, 0, true
+	}
+	return e.val, true, now.Sub(e.expires), true
+}
+
+// Revalidate returns the cached value for key, calling fetch and caching its result once
+// the entry has expired. While fetch fails, the expired value keeps being served until it
+// is more than hardStale past its expiry, with stale set. Without a usable value the
+// error is returned, so callers fail closed.
+func (c *Cache[V]) Revalidate(key string, hardStale time.Duration, fetch func() (V, error)) (v V, stale bool, err error) {
+	cached, expired, since, ok := c.peek(key)
+	if ok && !expired {
+		return cached, false, nil
+	}
+	if v, err = fetch(); err == nil {
+		c.Set(key, v)
+		return v, false, nil
+	}
+	if ok && since <= hardStale {
+		return cached, true, nil
+	}
+	var zero V
+	return zero, false, err
+}
+
+// Set stores val under key.
+func (c *Cache[V]) Set(key string, val V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := cacheEntry[V]{val: val}
+	if c.ttl > 0 {
+		e.expires = c.now().Add(c.ttl)
+	}
+	c.entries[key] = e
+}
+
+// Delete removes key.
+func (c *Cache[V]) Delete(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// Reset empties the cache.
+func (c *Cache[V]) Reset() {
+	c.mu.Lock()
+	c.entries = map[string]cacheEntry[V]{}
+	c.mu.Unlock()
+}
+
+// EndpointHealth is the recent track record of one endpoint.
+type EndpointHealth struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure,omitzero"`
+	LastSuccess time.Time `json:"lastSuccess,omitzero"`
+}
+
+// Health records endpoint outcomes; consecutive failures reset on success.
+type Health struct {
+	mu        sync.Mutex
+	endpoints map[string]EndpointHealth
+	now       func() time.Time
+}
+
+// NewHealth returns an empty health tracker.
+func NewHealth() *Health {
+	return &Health{endpoints: map[string]EndpointHealth{}, now: time.Now}
+}
+
+// Success records a successful call to endpoint.
+func (h *Health) Success(endpoint string) {
+	h.mu.Lock()
+	e := h.endpoints[endpoint]
+	e.Failures, e.LastSuccess = 0, h.now()
+	h.endpoints[endpoint] = e
+	h.mu.Unlock()
+}
+
+// Failure records a failed call to endpoint and returns its consecutive failure count.
+func (h *Health) Failure(endpoint string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := h.endpoints[endpoint]
+	e.Failures++
+	e.LastFailure = h.now()
+	h.endpoints[endpoint] = e
+	return e.Failures
+}
+
+// Open reports whether the circuit for endpoint is open: at least threshold
+// consecutive failures, the last within cooldown. Once cooldown passes the next call is
+// let through as a probe. A threshold <= 0 never opens.
+func (h *Health) Open(endpoint string, threshold int, cooldown time.Duration) bool {
+	if threshold <= 0 {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e := h.endpoints[endpoint]
+	return e.Failures >= threshold && h.now().Sub(e.LastFailure) < cooldown
+}
+
+// Get returns the health of endpoint.
+func (h *Health) Get(endpoint string) EndpointHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.endpoints[endpoint]
+}
+
+// Reset forgets all endpoints.
+func (h *Health) Reset() {
+	h.mu.Lock()
+	h.endpoints = map[string]EndpointHealth{}
+	h.mu.Unlock()
+}
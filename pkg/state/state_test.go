@@ -0,0 +1,132 @@
+package state
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValueRetriesFailedLoads(t *testing.T) {
+	calls := 0
+	v := NewValue(func() (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errors.New("not yet")
+		}
+		return "3.2.0", nil
+	})
+	if _, err := v.Get(); err == nil {
+		t.Fatalf("expected first load to fail")
+	}
+	for range 2 {
+		if got, err := v.Get(); err != nil || got != "3.2.0" {
+			t.Fatalf("unexpected value %q (%v)", got, err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("successful load should be cached, got %d calls", calls)
+	}
+	v.Reset()
+	_, _ = v.Get()
+	if calls != 3 {
+		t.Fatalf("reset should force a reload, got %d calls", calls)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCache[string](time.Minute)
+	c.now = func() time.Time { return now }
+	c.Set("k", "v")
+	if v, ok := c.Get("k"); !ok || v != "v" {
+		t.Fatalf("expected cached value")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("k"); ok {
+		t.Fatalf("expected entry to expire")
+	}
+}
+
+func TestRegistryResetAndInvalidate(t *testing.T) {
+	reg := New()
+	h := Register(reg, "health", NewHealth())
+	c := Register(reg, "secrets", NewCache[string](0))
+	h.Failure("https://rpc")
+	c.Set("key", "secret")
+
+	if !reg.Invalidate("secrets") || reg.Invalidate("missing") {
+		t.Fatalf("unexpected invalidate results")
+	}
+	if _, ok := c.Get("key"); ok {
+		t.Fatalf("secrets should be invalidated")
+	}
+	if h.Get("https://rpc").Failures != 1 {
+		t.Fatalf("health must survive invalidating another entry")
+	}
+	reg.Reset()
+	if h.Get("https://rpc").Failures != 0 {
+		t.Fatalf("reset should clear health")
+	}
+	if got := reg.Names(); !slices.Equal(got, []string{"health", "secrets"}) {
+		t.Fatalf("unexpected names %v", got)
+	}
+}
+
+func TestHealthCircuit(t *testing.T) {
+	h := NewHealth()
+	now := time.Unix(0, 0)
+	h.now = func() time.Time { return now }
+	for i := 1; i <= 3; i++ {
+		if got := h.Failure("https://rpc"); got != i {
+			t.Fatalf("expected %d consecutive failures, got %d", i, got)
+		}
+	}
+	if !h.Open("https://rpc", 3, time.Minute) || h.Open("https://rpc", 4, time.Minute) {
+		t.Fatalf("circuit should open exactly at the threshold")
+	}
+	now = now.Add(time.Minute)
+	if h.Open("https://rpc", 3, time.Minute) {
+		t.Fatalf("circuit should half-open after the cooldown")
+	}
+	h.Success("https://rpc")
+	if h.Failure("https://rpc") != 1 {
+		t.Fatalf("success should reset the streak")
+	}
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	c := NewCache[string](time.Minute)
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+	down := errors.New("service unavailable")
+	fetches := 0
+	fetch := func(v string, err error) func() (string, error) {
+		return func() (string, error) { fetches++; return v, err }
+	}
+
+	if _, _, err := c.Revalidate("k", time.Hour, fetch("", down)); !errors.Is(err, down) {
+		t.Fatalf("expected the fetch error without a cached value, got %v", err)
+	}
+	if v, stale, err := c.Revalidate("k", time.Hour, fetch("a", nil)); v != "a" || stale || err != nil {
+		t.Fatalf("unexpected %q %v %v", v, stale, err)
+	}
+	fetches = 0
+	if v, _, _ := c.Revalidate("k", time.Hour, fetch("b", nil)); v != "a" || fetches != 0 {
+		t.Fatalf("a fresh entry must not be refetched, got %q after %d fetches", v, fetches)
+	}
+	now = now.Add(30 * time.Minute)
+	if v, stale, err := c.Revalidate("k", time.Hour, fetch("", down)); v != "a" || !stale || err != nil {
+		t.Fatalf("expected the stale value while the service is down, got %q %v %v", v, stale, err)
+	}
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("Get must not return expired entries")
+	}
+	now = now.Add(2 * time.Hour)
+	if _, _, err := c.Revalidate("k", time.Hour, fetch("", down)); !errors.Is(err, down) {
+		t.Fatalf("expected to fail closed past the hard-stale window, got %v", err)
+	}
+	if v, stale, _ := c.Revalidate("k", time.Hour, fetch("c", nil)); v != "c" || stale {
+		t.Fatalf("expected a successful refetch to replace the entry, got %q", v)
+	}
+}
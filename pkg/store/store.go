@@ -0,0 +1,341 @@
+// Package store persists small values that must outlive one container, such as finished
+// jobs and cached responses, behind one key/value interface. Backends are in-memory,
+// a directory (e.g. on EFS), S3 and DynamoDB, selected by a URL-style spec.
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/redis"
+)
+
+// ErrNotFound is returned by Get for missing and expired keys.
+var ErrNotFound = errors.New("not found")
+
+// Store is a key/value store with per-key expiry. Keys are slash-separated paths such as
+// "jobs/<id>".
+type Store interface {
+	// Get returns the value stored under key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put stores val under key; it expires after ttl, or never when ttl <= 0.
+	Put(ctx context.Context, key string, val []byte, ttl time.Duration) error
+	// Delete removes key; deleting a missing key succeeds.
+	Delete(ctx context.Context, key string) error
+}
+
+// Open returns the store described by spec:
+//
+//	memory                   in-process only (the default for an empty spec)
+//	file:///mnt/efs/store    one file per key under a directory
+//	s3://bucket/prefix       one object per key
+//	dynamodb://table         one item per key; string partition key "key"
+//	redis://host:6379/0      one string per key, prefixed "leo:store:" (rediss:// for TLS)
+//
+// newAWS is only called for the AWS backends.
+func Open(spec string, newAWS func() (*awsapi.Client, error)) (Store, error) {
+	if spec == "" || spec == "memory" {
+		return NewMemory(), nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store %q: %w", spec, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Host != "" {
+			return nil, fmt.Errorf("invalid store %q: want file:///absolute/path", spec)
+		}
+		return NewDir(u.Path)
+	case "redis", "rediss":
+		client, err := redis.New(spec)
+		if err != nil {
+			return nil, err
+		}
+		return &Redis{client: client, prefix: "leo:store:"}, nil
+	case "s3", "dynamodb":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid store %q: missing bucket or table", spec)
+		}
+		client, err := newAWS()
+		if err != nil {
+			return nil, fmt.Errorf("store %q: %w", spec, err)
+		}
+		if u.Scheme == "s3" {
+			return &S3{client: client, bucket: u.Host, prefix: strings.TrimPrefix(u.Path, "/")}, nil
+		}
+		return &Dynamo{client: client, table: u.Host}, nil
+	}
+	return nil, fmt.Errorf("invalid store %q: unknown scheme %q", spec, u.Scheme)
+}
+
+// expiry returns the absolute expiry for ttl, zero for none.
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+func expired(now, at time.Time) bool {
+	return !at.IsZero() && !now.Before(at)
+}
+
+// Memory keeps values in the process; they are lost with the container.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]envelope
+	now     func() time.Time
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]envelope{}, now: time.Now}
+}
+
+// Get implements Store.
+func (m *Memory) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if expired(m.now(), e.ExpiresAt) {
+		delete(m.entries, key)
+		return nil, ErrNotFound
+	}
+	return e.Value, nil
+}
+
+// Put implements Store.
+func (m *Memory) Put(_ context.Context, key string, val []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	m.entries[key] = envelope{Value: val, ExpiresAt: expiry(m.now(), ttl)}
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete implements Store.
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.entries, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// envelope is how the file and S3 backends, which have no per-key expiry of their own,
+// store a value.
+type envelope struct {
+	Value     []byte    `json:"value"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+func decode(b []byte, now time.Time) ([]byte, error) {
+	var e envelope
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	if expired(now, e.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return e.Value, nil
+}
+
+// Dir keeps one file per key in a directory. Expired files are left in place until
+// overwritten or deleted.
+type Dir struct {
+	dir string
+	now func() time.Time
+}
+
+// NewDir returns a store in dir, creating it if needed.
+func NewDir(dir string) (*Dir, error) {
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("store directory %q must be absolute", dir)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Dir{dir: dir, now: time.Now}, nil
+}
+
+// path flattens key into one file name so no key can leave the directory.
+func (d *Dir) path(key string) string {
+	return filepath.Join(d.dir, url.PathEscape(key))
+}
+
+// Get implements Store.
+func (d *Dir) Get(_ context.Context, key string) ([]byte, error) {
+	b, err := os.ReadFile(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(b, d.now())
+}
+
+// Put implements Store. The file is replaced atomically.
+func (d *Dir) Put(_ context.Context, key string, val []byte, ttl time.Duration) error {
+	b, err := json.Marshal(envelope{Value: val, ExpiresAt: expiry(d.now(), ttl)})
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), d.path(key))
+}
+
+// Delete implements Store.
+func (d *Dir) Delete(_ context.Context, key string) error {
+	if err := os.Remove(d.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// S3 keeps one object per key under a prefix. Expired objects are only hidden; add a
+// lifecycle rule on the prefix to delete them.
+type S3 struct {
+	client *awsapi.Client
+	bucket string
+	prefix string
+}
+
+func (s *S3) key(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return strings.TrimSuffix(s.prefix, "/") + "/" + key
+}
+
+// Get implements Store.
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	b, err := s.client.GetObject(ctx, s.bucket, s.key(key))
+	var apiErr *awsapi.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(b, time.Now())
+}
+
+// Put implements Store.
+func (s *S3) Put(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	b, err := json.Marshal(envelope{Value: val, ExpiresAt: expiry(time.Now(), ttl)})
+	if err != nil {
+		return err
+	}
+	return s.client.PutObject(ctx, s.bucket, s.key(key), b, "application/json")
+}
+
+// Delete implements Store.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return s.client.DeleteObject(ctx, s.bucket, s.key(key))
+}
+
+// Dynamo keeps one item per key in a table with string partition key "key". Items carry
+// expiresAt in epoch seconds; enable TTL on it to have DynamoDB delete them.
+type Dynamo struct {
+	client *awsapi.Client
+	table  string
+}
+
+type attr = map[string]string
+
+// Get implements Store.
+func (d *Dynamo) Get(ctx context.Context, key string) ([]byte, error) {
+	var out struct {
+		Item map[string]attr
+	}
+	in := map[string]any{"TableName": d.table, "Key": map[string]attr{"key": {"S": key}}, "ConsistentRead": true}
+	if err := d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.GetItem", in, &out); err != nil {
+		return nil, err
+	}
+	if out.Item == nil {
+		return nil, ErrNotFound
+	}
+	if n := out.Item["expiresAt"]["N"]; n != "" {
+		sec, err := strconv.ParseInt(n, 10, 64)
+		if err == nil && expired(time.Now(), time.Unix(sec, 0)) {
+			return nil, ErrNotFound
+		}
+	}
+	// Binary attributes travel base64-encoded.
+	return base64.StdEncoding.DecodeString(out.Item["value"]["B"])
+}
+
+// Put implements Store.
+func (d *Dynamo) Put(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	item := map[string]attr{"key": {"S": key}, "value": {"B": base64.StdEncoding.EncodeToString(val)}}
+	if at := expiry(time.Now(), ttl); !at.IsZero() {
+		item["expiresAt"] = attr{"N": strconv.FormatInt(at.Unix(), 10)}
+	}
+	return d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.PutItem", map[string]any{"TableName": d.table, "Item": item}, nil)
+}
+
+// Delete implements Store.
+func (d *Dynamo) Delete(ctx context.Context, key string) error {
+	in := map[string]any{"TableName": d.table, "Key": map[string]attr{"key": {"S": key}}}
+	return d.client.JSON(ctx, "dynamodb", "DynamoDB_20120810.DeleteItem", in, nil)
+}
+
+// Redis keeps one string per key and lets Redis expire it.
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// Get implements Store.
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := r.client.Do(ctx, "GET", r.prefix+key)
+	if errors.Is(err, redis.ErrNil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, _ := v.([]byte)
+	return b, nil
+}
+
+// Put implements Store.
+func (r *Redis) Put(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	args := []string{"SET", r.prefix + key, string(val)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := r.client.Do(ctx, args...)
+	return err
+}
+
+// Delete implements Store.
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	_, err := r.client.Do(ctx, "DEL", r.prefix+key)
+	return err
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+func exercise(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "jobs/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.Put(ctx, "jobs/a", []byte("one"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "jobs/a", []byte("two"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, "jobs/a"); err != nil || string(got) != "two" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	if err := s.Put(ctx, "responses/b", []byte("gone"), -time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "responses/b"); err != nil && !errors.Is(err, ErrNotFound) {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "jobs/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "jobs/a"); err != nil {
+		t.Fatalf("deleting a missing key: %v", err)
+	}
+	if _, err := s.Get(ctx, "jobs/a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestMemoryAndDir(t *testing.T) {
+	exercise(t, NewMemory())
+	d, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exercise(t, d)
+
+	now := time.Unix(0, 0)
+	d.now = func() time.Time { return now }
+	_ = d.Put(context.Background(), "../escape", []byte("x"), time.Minute)
+	if got, err := d.Get(context.Background(), "../escape"); err != nil || string(got) != "x" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := d.Get(context.Background(), "../escape"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the entry to expire, got %v", err)
+	}
+}
+
+// fakeAWS serves S3 objects by path and DynamoDB items by key.
+func fakeAWS(t *testing.T) func() (*awsapi.Client, error) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	items := map[string]map[string]map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		if target := r.Header.Get("X-Amz-Target"); target != "" {
+			var in struct {
+				Key  map[string]map[string]string
+				Item map[string]map[string]string
+			}
+			_ = json.Unmarshal(body, &in)
+			switch target {
+			case "DynamoDB_20120810.PutItem":
+				items[in.Item["key"]["S"]] = in.Item
+			case "DynamoDB_20120810.DeleteItem":
+				delete(items, in.Key["key"]["S"])
+			case "DynamoDB_20120810.GetItem":
+				out := map[string]any{}
+				if item, ok := items[in.Key["key"]["S"]]; ok {
+					out["Item"] = item
+				}
+				_ = json.NewEncoder(w).Encode(out)
+			}
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path] = body
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+		case http.MethodGet:
+			b, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+				return
+			}
+			_, _ = w.Write(b)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return func() (*awsapi.Client, error) {
+		return &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}, nil
+	}
+}
+
+func TestAWSBackends(t *testing.T) {
+	aws := fakeAWS(t)
+	for _, spec := range []string{"s3://bucket/leo", "dynamodb://table"} {
+		s, err := Open(spec, aws)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		exercise(t, s)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if s, err := Open("", nil); err != nil || s == nil {
+		t.Fatalf("expected the memory store, got %v", err)
+	}
+	if s, err := Open("file://"+t.TempDir(), nil); err != nil {
+		t.Fatal(err)
+	} else if _, ok := s.(*Dir); !ok {
+		t.Fatalf("expected a directory store, got %T", s)
+	}
+	for _, bad := range []string{"ftp://host/x", "s3://", "file://relative/dir"} {
+		if _, err := Open(bad, func() (*awsapi.Client, error) { return nil, errors.New("unused") }); err == nil {
+			t.Fatalf("%q: expected an error", bad)
+		}
+	}
+}
+
+// fakeRedis serves GET, SET and DEL from a map, ignoring expiry.
+func fakeRedis(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	data := map[string]string{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					line, err := rd.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					args := make([]string, n)
+					for i := range args {
+						line, _ = rd.ReadString('\n')
+						size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+						buf := make([]byte, size+2)
+						_, _ = io.ReadFull(rd, buf)
+						args[i] = string(buf[:size])
+					}
+					mu.Lock()
+					reply := "+OK\r\n"
+					switch args[0] {
+					case "SET":
+						data[args[1]] = args[2]
+					case "DEL":
+						delete(data, args[1])
+						reply = ":1\r\n"
+					case "GET":
+						v, ok := data[args[1]]
+						reply = "$-1\r\n"
+						if ok {
+							reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+						}
+					}
+					mu.Unlock()
+					_, _ = io.WriteString(conn, reply)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestRedisBackend(t *testing.T) {
+	s, err := Open("redis://"+fakeRedis(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exercise(t, s)
+}
@@ -0,0 +1,128 @@
+// Package stream encodes a run's output as newline-delimited JSON while it is
+// produced: one event per line of stdout or stderr, then a trailer with everything the
+// buffered response carries but the output.
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// MediaType is the media type a caller accepts to have output streamed.
+const MediaType = "application/x-ndjson"
+
+// Stream names of Event.Stream, as the executor names them.
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// ErrNoTrailer is returned by Read when the stream ends before its trailer, e.g.
+// because the connection was cut or the function timed out.
+var ErrNoTrailer = errors.New("stream ended without a trailer")
+
+// Event is one line of a stream: a line of output, or the trailer ending it.
+type Event struct {
+	// Stream is Stdout or Stderr for a line of output.
+	Stream string `json:"stream,omitempty"`
+	Line   string `json:"line,omitempty"`
+	// Trailer is the buffered response without stdout and stderr, plus its HTTP
+	// status and the transaction ID from its meta.
+	Trailer json.RawMessage `json:"trailer,omitempty"`
+}
+
+// Accepts reports whether an Accept header value asks for a stream.
+func Accepts(accept string) bool {
+	for r := range strings.SplitSeq(accept, ",") {
+		if t, _, err := mime.ParseMediaType(strings.TrimSpace(r)); err == nil && t == MediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Writer writes events to a stream. It is safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewWriter returns a Writer writing to w. Each event is one Write, so a flushing w
+// sends every line as soon as it is written.
+func NewWriter(w io.Writer) *Writer {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &Writer{enc: enc}
+}
+
+// Line writes a line of output of stream.
+func (w *Writer) Line(stream, line string) error {
+	return w.write(Event{Stream: stream, Line: line})
+}
+
+// Trailer ends the stream with the response of the run: status and body, a JSON
+// object. stdout and stderr are left out, as they were streamed; a body that is not an
+// object is kept as error.
+func (w *Writer) Trailer(status int, body []byte) error {
+	t, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(body, &fields) != nil {
+		fields = map[string]json.RawMessage{}
+		fields["error"], _ = json.Marshal(string(body))
+	}
+	delete(fields, "stdout")
+	delete(fields, "stderr")
+	fields["status"] = t
+	var meta struct {
+		TransactionID string `json:"transactionId"`
+	}
+	if raw, ok := fields["meta"]; ok && json.Unmarshal(raw, &meta) == nil && meta.TransactionID != "" {
+		fields["transactionId"], _ = json.Marshal(meta.TransactionID)
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return w.write(Event{Trailer: b})
+}
+
+func (w *Writer) write(e Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(e)
+}
+
+// Read calls onLine, which may be nil, for each line of output in r and returns the
+// trailer. A stream without one returns what it has read and ErrNoTrailer.
+func Read(r io.Reader, onLine func(stream, line string)) (json.RawMessage, error) {
+	sc := bufio.NewScanner(r)
+	// Lines of output are bounded by the executor, but leave room for their escaping.
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		if e.Trailer != nil {
+			return e.Trailer, nil
+		}
+		if onLine != nil {
+			onLine(e.Stream, e.Line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, ErrNoTrailer
+}
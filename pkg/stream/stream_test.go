@@ -0,0 +1,60 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	_ = w.Line("stdout", `building "token" <main>`)
+	_ = w.Line("stderr", "warning: slow endpoint")
+	body, _ := json.Marshal(map[string]any{"exitCode": 0, "stdout": "all of it\n", "truncated": true, "meta": map[string]string{"transactionId": "at1xyz"}})
+	if err := w.Trailer(200, body); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 3 {
+		t.Fatalf("expected one line per event, got %d:\n%s", n, buf.String())
+	}
+
+	var lines []string
+	trailer, err := Read(&buf, func(stream, line string) { lines = append(lines, stream+": "+line) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0] != `stdout: building "token" <main>` || lines[1] != "stderr: warning: slow endpoint" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	var got map[string]any
+	_ = json.Unmarshal(trailer, &got)
+	if got["status"] != float64(200) || got["transactionId"] != "at1xyz" || got["truncated"] != true || got["stdout"] != nil {
+		t.Fatalf("unexpected trailer %s", trailer)
+	}
+}
+
+func TestTrailerNotJSON(t *testing.T) {
+	var buf bytes.Buffer
+	_ = NewWriter(&buf).Trailer(502, []byte("bad gateway"))
+	trailer, err := Read(&buf, nil)
+	if err != nil || !strings.Contains(string(trailer), `"error":"bad gateway"`) || !strings.Contains(string(trailer), `"status":502`) {
+		t.Fatalf("unexpected trailer %s %v", trailer, err)
+	}
+}
+
+func TestCutStream(t *testing.T) {
+	var buf bytes.Buffer
+	_ = NewWriter(&buf).Line("stdout", "proving")
+	if _, err := Read(&buf, nil); !errors.Is(err, ErrNoTrailer) {
+		t.Fatalf("expected ErrNoTrailer, got %v", err)
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	if !Accepts("application/json;q=0.5, application/x-ndjson") || Accepts("application/json") {
+		t.Fatal("unexpected Accepts")
+	}
+}
@@ -0,0 +1,31 @@
+// Package tags matches the free-form key/value tags clients attach to requests.
+package tags
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Match reports whether have contains every key/value pair of want. An empty want
+// matches everything.
+func Match(have, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := have[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse turns "key:value" filters (e.g. repeated ?tag= query parameters) into a map.
+func Parse(filters []string) (map[string]string, error) {
+	out := make(map[string]string, len(filters))
+	for _, f := range filters {
+		k, v, ok := strings.Cut(f, ":")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid tag filter %q (want key:value)", f)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
@@ -0,0 +1,19 @@
+package tags
+
+import "testing"
+
+func TestParseAndMatch(t *testing.T) {
+	want, err := Parse([]string{"orderId:42", "env:prod:eu"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if want["env"] != "prod:eu" {
+		t.Fatalf("value should keep everything after the first colon, got %q", want["env"])
+	}
+	if !Match(map[string]string{"orderId": "42", "env": "prod:eu", "x": "y"}, want) || Match(map[string]string{"orderId": "42"}, want) {
+		t.Fatalf("unexpected match results")
+	}
+	if _, err := Parse([]string{"nocolon"}); err == nil {
+		t.Fatalf("expected error for filter without a colon")
+	}
+}
@@ -0,0 +1,348 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// eval evaluates a decoded JSONLogic expression against data.
+// Only the subset of operators useful for request guardrails is supported.
+func eval(expr any, data map[string]any) (any, error) {
+	switch e := expr.(type) {
+	case map[string]any:
+		if len(e) != 1 {
+			return e, nil
+		}
+		for op, rawArgs := range e {
+			args, ok := rawArgs.([]any)
+			if !ok {
+				args = []any{rawArgs}
+			}
+			return apply(op, args, data)
+		}
+	case []any:
+		out := make([]any, len(e))
+		for i, v := range e {
+			r, err := eval(v, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	}
+	return expr, nil
+}
+
+func apply(op string, args []any, data map[string]any) (any, error) {
+	// Short-circuiting operators evaluate their arguments lazily.
+	switch op {
+	case "if", "?:":
+		for i := 0; i+1 < len(args); i += 2 {
+			cond, err := eval(args[i], data)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(cond) {
+				return eval(args[i+1], data)
+			}
+		}
+		if len(args)%2 == 1 {
+			return eval(args[len(args)-1], data)
+		}
+		return nil, nil
+	case "and":
+		var last any = true
+		for _, a := range args {
+			v, err := eval(a, data)
+			if err != nil {
+				return nil, err
+			}
+			if !truthy(v) {
+				return v, nil
+			}
+			last = v
+		}
+		return last, nil
+	case "or":
+		var last any = false
+		for _, a := range args {
+			v, err := eval(a, data)
+			if err != nil {
+				return nil, err
+			}
+			if truthy(v) {
+				return v, nil
+			}
+			last = v
+		}
+		return last, nil
+	}
+
+	vals := make([]any, len(args))
+	for i, a := range args {
+		v, err := eval(a, data)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+
+	switch op {
+	case "var":
+		if len(vals) == 0 {
+			return data, nil
+		}
+		path := toString(vals[0])
+		v, ok := lookup(data, path)
+		if !ok && len(vals) > 1 {
+			return vals[1], nil
+		}
+		return v, nil
+	case "missing":
+		var missing []any
+		for _, v := range vals {
+			if got, ok := lookup(data, toString(v)); !ok || got == nil || got == "" {
+				missing = append(missing, v)
+			}
+		}
+		return missing, nil
+	case "!":
+		return !truthy(first(vals)), nil
+	case "!!":
+		return truthy(first(vals)), nil
+	case "==", "===":
+		return looseEqual(at(vals, 0), at(vals, 1)), nil
+	case "!=", "!==":
+		return !looseEqual(at(vals, 0), at(vals, 1)), nil
+	case "<", "<=", ">", ">=":
+		return compareChain(op, vals)
+	case "in":
+		needle := toString(at(vals, 0))
+		switch hay := at(vals, 1).(type) {
+		case []any:
+			for _, h := range hay {
+				if looseEqual(at(vals, 0), h) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case string:
+			return strings.Contains(hay, needle), nil
+		}
+		return false, nil
+	case "cat":
+		var b strings.Builder
+		for _, v := range vals {
+			b.WriteString(toString(v))
+		}
+		return b.String(), nil
+	case "min", "max":
+		if len(vals) == 0 {
+			return nil, nil
+		}
+		best, err := toNumber(vals[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vals[1:] {
+			n, err := toNumber(v)
+			if err != nil {
+				return nil, err
+			}
+			if (op == "min" && n < best) || (op == "max" && n > best) {
+				best = n
+			}
+		}
+		return best, nil
+	case "+", "*":
+		acc := 0.0
+		if op == "*" {
+			acc = 1
+		}
+		for _, v := range vals {
+			n, err := toNumber(v)
+			if err != nil {
+				return nil, err
+			}
+			if op == "+" {
+				acc += n
+			} else {
+				acc *= n
+			}
+		}
+		return acc, nil
+	case "-", "/", "%":
+		a, err := toNumber(at(vals, 0))
+		if err != nil {
+			return nil, err
+		}
+		if len(vals) == 1 && op == "-" {
+			return -a, nil
+		}
+		b, err := toNumber(at(vals, 1))
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "-":
+			return a - b, nil
+		case "/":
+			if b == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		default:
+			if b == 0 {
+				return nil, fmt.Errorf("modulo by zero")
+			}
+			return math.Mod(a, b), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported operator %q", op)
+}
+
+func compareChain(op string, vals []any) (any, error) {
+	if len(vals) < 2 {
+		return false, nil
+	}
+	for i := 0; i+1 < len(vals); i++ {
+		a, err := toNumber(vals[i])
+		if err != nil {
+			return nil, err
+		}
+		b, err := toNumber(vals[i+1])
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		switch op {
+		case "<":
+			ok = a < b
+		case "<=":
+			ok = a <= b
+		case ">":
+			ok = a > b
+		case ">=":
+			ok = a >= b
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lookup resolves a dotted path ("flags.--network") inside data.
+func lookup(data any, path string) (any, bool) {
+	if path == "" {
+		return data, true
+	}
+	cur := data
+	for part := range strings.SplitSeq(path, ".") {
+		switch c := cur.(type) {
+		case map[string]any:
+			v, ok := c[part]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case map[string]string:
+			v, ok := c[part]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			cur = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case float64:
+		return t != 0
+	case string:
+		return t != ""
+	case []any:
+		return len(t) > 0
+	}
+	return true
+}
+
+func looseEqual(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return as == bs
+		}
+	}
+	an, aerr := toNumber(a)
+	bn, berr := toNumber(b)
+	if aerr == nil && berr == nil {
+		return an == bn
+	}
+	return toString(a) == toString(b)
+}
+
+func toNumber(v any) (float64, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case bool:
+		if t {
+			return 1, nil
+		}
+		return 0, nil
+	case nil:
+		return 0, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		if err != nil {
+			return 0, fmt.Errorf("not a number: %q", t)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("not a number: %v", v)
+}
+
+func toString(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func first(vals []any) any { return at(vals, 0) }
+
+func at(vals []any, i int) any {
+	if i < len(vals) {
+		return vals[i]
+	}
+	return nil
+}
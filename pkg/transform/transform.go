@@ -0,0 +1,164 @@
+// Package transform applies operator-defined JSONLogic rules that can rewrite or reject
+// incoming requests before the allowlist and injection logic runs.
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// Rule is a single guardrail. When is a JSONLogic condition (empty means always).
+// Set maps flag names to JSONLogic expressions whose result replaces or injects the flag value.
+// Reject, when non-empty, refuses the request with the given message once When matches.
+type Rule struct {
+	Name   string                     `json:"name"`
+	When   json.RawMessage            `json:"when,omitempty"`
+	Set    map[string]json.RawMessage `json:"set,omitempty"`
+	Reject string                     `json:"reject,omitempty"`
+
+	when any
+	set  map[string]any
+}
+
+// Input is the request view exposed to rule expressions.
+type Input struct {
+	Args       []string
+	Subcommand string
+	Headers    map[string]string
+	// Stage holds the variables of the API Gateway stage that received the request.
+	Stage map[string]string
+}
+
+// RejectError is returned by Apply when a rule refuses the request.
+type RejectError struct {
+	Rule    string
+	Message string
+}
+
+func (e *RejectError) Error() string {
+	if e.Rule != "" {
+		return fmt.Sprintf("request rejected by rule %q: %s", e.Rule, e.Message)
+	}
+	return "request rejected: " + e.Message
+}
+
+// ParseRules decodes a JSON array of rules and pre-decodes their expressions.
+// An empty string yields no rules.
+func ParseRules(raw string) ([]Rule, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var rules []Rule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid transform rules: %w", err)
+	}
+	for i := range rules {
+		r := &rules[i]
+		if len(r.When) > 0 {
+			if err := json.Unmarshal(r.When, &r.when); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid when: %w", i, err)
+			}
+		}
+		r.set = make(map[string]any, len(r.Set))
+		for flag, expr := range r.Set {
+			if !strings.HasPrefix(flag, "-") {
+				return nil, fmt.Errorf("rule %d: set key %q must be a flag", i, flag)
+			}
+			var v any
+			if err := json.Unmarshal(expr, &v); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid set expression for %s: %w", i, flag, err)
+			}
+			r.set[flag] = v
+		}
+		if r.Reject == "" && len(r.set) == 0 {
+			return nil, fmt.Errorf("rule %d: must define set or reject", i)
+		}
+	}
+	return rules, nil
+}
+
+// Apply evaluates rules in order and returns the possibly rewritten args.
+// Each rule sees the args as left by the previous one.
+func Apply(rules []Rule, in Input) ([]string, error) {
+	args := in.Args
+	for _, r := range rules {
+		data := buildData(args, in)
+		if r.when != nil {
+			ok, err := eval(r.when, data)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			if !truthy(ok) {
+				continue
+			}
+		}
+		if r.Reject != "" {
+			return nil, &RejectError{Rule: r.Name, Message: r.Reject}
+		}
+		for flag, expr := range r.set {
+			v, err := eval(expr, data)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			args = utils.SetFlagValue(args, in.Subcommand, flag, toString(v))
+		}
+	}
+	return args, nil
+}
+
+// IsReject reports whether err is a rule rejection.
+func IsReject(err error) bool {
+	var re *RejectError
+	return errors.As(err, &re)
+}
+
+func buildData(args []string, in Input) map[string]any {
+	contract, method := utils.ExtractExecuteContract(args)
+	// flags follows leo's grammar: switches are true, a repeated flag has the value leo
+	// uses (the last one) and flags taking several values are lists.
+	toks := utils.Tokenize(args)
+	flags := map[string]any{}
+	for _, tok := range toks {
+		if tok.Kind != utils.Flag {
+			continue
+		}
+		vals := toks.Values(tok.Flag)
+		switch {
+		case utils.LeoFlags[tok.Flag] == utils.Multi:
+			list := make([]any, len(vals))
+			for i, v := range vals {
+				list[i] = v
+			}
+			flags[tok.Flag] = list
+		case len(vals) > 0:
+			flags[tok.Flag] = vals[0]
+		default:
+			flags[tok.Flag] = true
+		}
+	}
+	argv := make([]any, len(args))
+	for i, a := range args {
+		argv[i] = a
+	}
+	headers := make(map[string]any, len(in.Headers))
+	for k, v := range in.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+	stage := make(map[string]any, len(in.Stage))
+	for k, v := range in.Stage {
+		stage[k] = v
+	}
+	return map[string]any{
+		"args":       argv,
+		"subcommand": in.Subcommand,
+		"contract":   contract,
+		"method":     method,
+		"flags":      flags,
+		"headers":    headers,
+		"stage":      stage,
+	}
+}
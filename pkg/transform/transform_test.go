@@ -0,0 +1,133 @@
+package transform
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+func TestApply_ForcesNetworkForHeader(t *testing.T) {
+	rules, err := ParseRules(`[{
+		"name": "partner-testnet",
+		"when": {"==": [{"var": "headers.x-api-key"}, "partner"]},
+		"set": {"--network": "testnet"}
+	}]`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	args := []string{"execute", "token.aleo/mint", "--network", "mainnet"}
+	out, err := Apply(rules, Input{Args: args, Subcommand: "execute", Headers: map[string]string{"X-Api-Key": "partner"}})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if got := utils.GetFlagValue(out, "--network"); got != "testnet" {
+		t.Fatalf("expected network forced to testnet, got %q (%v)", got, out)
+	}
+	if !slices.Equal(args, []string{"execute", "token.aleo/mint", "--network", "mainnet"}) {
+		t.Fatalf("input args must not be mutated: %v", args)
+	}
+
+	out, err = Apply(rules, Input{Args: args, Subcommand: "execute"})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if got := utils.GetFlagValue(out, "--network"); got != "mainnet" {
+		t.Fatalf("rule should not match without header, got %q", got)
+	}
+}
+
+func TestApply_StageVariables(t *testing.T) {
+	rules, err := ParseRules(`[{"name": "stage-network", "when": {"!!": {"var": "stage.network"}}, "set": {"--network": {"var": "stage.network"}}}]`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	out, err := Apply(rules, Input{Args: []string{"execute", "token.aleo/mint"}, Subcommand: "execute", Stage: map[string]string{"network": "testnet"}})
+	if err != nil || utils.GetFlagValue(out, "--network") != "testnet" {
+		t.Fatalf("expected the stage's network, got %v %v", out, err)
+	}
+	out, _ = Apply(rules, Input{Args: []string{"execute", "token.aleo/mint"}, Subcommand: "execute"})
+	if utils.HasAnyFlag(out, "--network") {
+		t.Fatalf("rule should not match without stage variables, got %v", out)
+	}
+}
+
+func TestApply_ClampsFee(t *testing.T) {
+	rules, err := ParseRules(`[{
+		"name": "clamp-fee",
+		"when": {"!!": {"var": "flags.--priority-fee"}},
+		"set": {"--priority-fee": {"min": [{"var": "flags.--priority-fee"}, 5000]}}
+	}]`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	out, err := Apply(rules, Input{Args: []string{"execute", "a.aleo/b", "--priority-fee=90000"}, Subcommand: "execute"})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if got := utils.GetFlagValue(out, "--priority-fee"); got != "5000" {
+		t.Fatalf("expected clamped fee 5000, got %q", got)
+	}
+	out, err = Apply(rules, Input{Args: []string{"execute", "a.aleo/b"}, Subcommand: "execute"})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if utils.HasAnyFlag(out, "--priority-fee") {
+		t.Fatalf("fee should not be injected when absent: %v", out)
+	}
+}
+
+func TestApply_FlagsFollowLeoGrammar(t *testing.T) {
+	rules, err := ParseRules(`[
+		{"name": "broadcast", "when": {"===": [{"var": "flags.--broadcast"}, true]}, "set": {"--network": "testnet"}},
+		{"name": "endpoint", "when": {"==": [{"var": "flags.--endpoint"}, "https://b"]}, "set": {"--home": "b"}},
+		{"name": "after-dashes", "when": {"!!": {"var": "flags.--private-key"}}, "reject": "inputs are not flags"}
+	]`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	args := []string{"execute", "--broadcast", "token.aleo/mint", "--endpoint", "https://a", "--endpoint", "https://b", "--", "--private-key"}
+	out, err := Apply(rules, Input{Args: args, Subcommand: "execute"})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if utils.GetFlagValue(out, "--network") != "testnet" || utils.GetFlagValue(out, "--home") != "b" {
+		t.Fatalf("expected --broadcast as a switch and the last --endpoint, got %v", out)
+	}
+	data := buildData([]string{"execute", "a.aleo/b", "--priority-fees", "1", "2"}, Input{})
+	if fees := data["flags"].(map[string]any)["--priority-fees"]; len(fees.([]any)) != 2 {
+		t.Fatalf("expected every --priority-fees value, got %v", fees)
+	}
+}
+
+func TestApply_Reject(t *testing.T) {
+	rules, err := ParseRules(`[{
+		"name": "no-burn",
+		"when": {"and": [{"==": [{"var": "contract"}, "token.aleo"]}, {"in": [{"var": "method"}, ["burn", "burn_private"]]}]},
+		"reject": "burning is disabled"
+	}]`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	_, err = Apply(rules, Input{Args: []string{"execute", "token.aleo/burn"}, Subcommand: "execute"})
+	if !IsReject(err) {
+		t.Fatalf("expected reject error, got %v", err)
+	}
+	if _, err := Apply(rules, Input{Args: []string{"execute", "token.aleo/mint"}, Subcommand: "execute"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseRules_Invalid(t *testing.T) {
+	cases := []string{
+		`{}`,
+		`[{"name": "empty"}]`,
+		`[{"set": {"network": "testnet"}}]`,
+		`[{"when": {bad}, "reject": "x"}]`,
+	}
+	for _, c := range cases {
+		if _, err := ParseRules(c); err == nil {
+			t.Fatalf("expected error for %s", c)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Package usage keeps per-caller daily rollups of invocations, successes, fees and
+// compute time on disk (typically an EFS mount) for chargeback reports.
+//
+// Each container writes only its own file per UTC day, so concurrent containers never
+// overwrite each other's counts; reports merge all files of the requested days.
+package usage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DayLayout names the per-day directories and is the date format of reports.
+const DayLayout = "2006-01-02"
+
+// Run is the outcome of one invocation.
+type Run struct {
+	OK bool
+	// Fee is the fee charged, in microcredits.
+	Fee      uint64
+	Duration time.Duration
+}
+
+// Totals aggregates runs.
+type Totals struct {
+	Invocations int     `json:"invocations"`
+	Succeeded   int     `json:"succeeded"`
+	Fees        uint64  `json:"feesMicrocredits"`
+	Compute     float64 `json:"computeSeconds"`
+}
+
+func (t *Totals) add(o Totals) {
+	t.Invocations += o.Invocations
+	t.Succeeded += o.Succeeded
+	t.Fees += o.Fees
+	t.Compute += o.Compute
+}
+
+// SuccessRate returns Succeeded/Invocations, or 0 without invocations.
+func (t Totals) SuccessRate() float64 {
+	if t.Invocations == 0 {
+		return 0
+	}
+	return float64(t.Succeeded) / float64(t.Invocations)
+}
+
+// Day is one daily rollup.
+type Day struct {
+	Date string `json:"date"`
+	Totals
+}
+
+// Report is the usage of one caller over a window.
+type Report struct {
+	Caller string `json:"caller"`
+	Totals
+	SuccessRate float64 `json:"successRate"`
+	Days        []Day   `json:"days"`
+}
+
+// container identifies this process's rollup files.
+var container = newID()
+
+// mu serializes read-modify-write of this container's files.
+var mu sync.Mutex
+
+// Store keeps rollups below Dir.
+type Store struct {
+	Dir string
+}
+
+// Enabled reports whether a directory is configured.
+func (s *Store) Enabled() bool { return s != nil && s.Dir != "" }
+
+// Record adds r to caller's rollup for the UTC day of at. It is a no-op on a disabled
+// store.
+func (s *Store) Record(caller string, at time.Time, r Run) error {
+	if !s.Enabled() {
+		return nil
+	}
+	t := Totals{Invocations: 1, Fees: r.Fee, Compute: r.Duration.Seconds()}
+	if r.OK {
+		t.Succeeded = 1
+	}
+	dir := filepath.Join(s.Dir, at.UTC().Format(DayLayout))
+	path := filepath.Join(dir, container+".json")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("usage dir: %w", err)
+	}
+	day, err := readDay(path)
+	if err != nil {
+		return err
+	}
+	cur := day[caller]
+	cur.add(t)
+	day[caller] = cur
+	b, err := json.Marshal(day)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("usage write: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Report returns per-caller usage for the UTC days from through to (inclusive), sorted
+// by caller. A non-empty caller restricts the report to that caller.
+func (s *Store) Report(from, to time.Time, caller string) ([]Report, error) {
+	if !s.Enabled() {
+		return nil, errors.New("usage store is not enabled")
+	}
+	byCaller := map[string]*Report{}
+	for d := from.UTC().Truncate(24 * time.Hour); !d.After(to.UTC()); d = d.AddDate(0, 0, 1) {
+		date := d.Format(DayLayout)
+		files, err := os.ReadDir(filepath.Join(s.Dir, date))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		days := map[string]Totals{}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			day, err := readDay(filepath.Join(s.Dir, date, f.Name()))
+			if err != nil {
+				return nil, err
+			}
+			for c, t := range day {
+				if caller != "" && c != caller {
+					continue
+				}
+				cur := days[c]
+				cur.add(t)
+				days[c] = cur
+			}
+		}
+		for c, t := range days {
+			r, ok := byCaller[c]
+			if !ok {
+				r = &Report{Caller: c}
+				byCaller[c] = r
+			}
+			r.Totals.add(t)
+			r.Days = append(r.Days, Day{Date: date, Totals: t})
+		}
+	}
+	out := make([]Report, 0, len(byCaller))
+	for _, r := range byCaller {
+		r.SuccessRate = r.Totals.SuccessRate()
+		out = append(out, *r)
+	}
+	slices.SortFunc(out, func(a, b Report) int { return strings.Compare(a.Caller, b.Caller) })
+	return out, nil
+}
+
+func readDay(path string) (map[string]Totals, error) {
+	day := map[string]Totals{}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return day, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &day); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return day, nil
+}
+
+func newID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,54 @@
+package usage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReportMergesDaysAndContainers(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	day1 := time.Date(2025, 3, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	for _, r := range []struct {
+		caller string
+		at     time.Time
+		run    Run
+	}{
+		{"key:a", day1, Run{OK: true, Fee: 1000, Duration: 2 * time.Second}},
+		{"key:a", day1, Run{OK: false, Duration: time.Second}},
+		{"key:a", day2, Run{OK: true, Fee: 500, Duration: time.Second}},
+		{"key:b", day2, Run{OK: true}},
+	} {
+		if err := s.Record(r.caller, r.at, r.run); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	// Another container's rollup for the same day.
+	b, _ := json.Marshal(map[string]Totals{"key:a": {Invocations: 1, Succeeded: 1, Fees: 250}})
+	if err := os.WriteFile(filepath.Join(s.Dir, "2025-03-02", "other.json"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := s.Report(day1, day2, "")
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Caller != "key:a" {
+		t.Fatalf("unexpected reports: %+v", reports)
+	}
+	a := reports[0]
+	if a.Invocations != 4 || a.Succeeded != 3 || a.Fees != 1750 || a.Compute != 4 || a.SuccessRate != 0.75 {
+		t.Fatalf("unexpected totals: %+v", a)
+	}
+	if len(a.Days) != 2 || a.Days[1].Date != "2025-03-02" || a.Days[1].Invocations != 2 {
+		t.Fatalf("unexpected daily rollups: %+v", a.Days)
+	}
+
+	only, _ := s.Report(day2, day2, "key:b")
+	if len(only) != 1 || only[0].Caller != "key:b" || only[0].Invocations != 1 {
+		t.Fatalf("unexpected filtered report: %+v", only)
+	}
+}
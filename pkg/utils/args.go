@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+)
+
+// Arity is the number of values a flag takes.
+type Arity int
+
+const (
+	// Switch flags take no value unless written as --flag=value.
+	Switch Arity = iota
+	// Single flags take the next token as their value.
+	Single
+	// Multi flags take every following token up to the next flag, as in
+	// "--priority-fees 1000 2000". leo also accepts them comma-separated.
+	Multi
+)
+
+// LeoFlags is the flag grammar of the leo CLI. Flags not listed are parsed as switches,
+// so an unknown flag never swallows the subcommand or program that follows it.
+var LeoFlags = map[string]Arity{
+	"--path":              Single,
+	"--home":              Single,
+	"--network":           Single,
+	"--endpoint":          Single,
+	"--private-key":       Single,
+	"-k":                  Single,
+	"--fee-private-key":   Single,
+	"--priority-fee":      Single,
+	"--record":            Single,
+	"-r":                  Single,
+	"--save":              Single,
+	"--max-wait":          Single,
+	"--blocks-to-check":   Single,
+	"--priority-fees":     Multi,
+	"--base-fees":         Multi,
+	"--fee-records":       Multi,
+	"--consensus-heights": Multi,
+	"--skip":              Multi,
+}
+
+// TokenKind classifies a command-line token.
+type TokenKind int
+
+const (
+	Positional TokenKind = iota
+	Flag
+	Value
+	// EndOfFlags is "--"; every token after it is positional.
+	EndOfFlags
+)
+
+// Token is one command-line argument. Flag holds the flag name for Flag tokens (without
+// an inline "=value") and the owning flag for Value tokens.
+type Token struct {
+	Kind TokenKind
+	Text string
+	Flag string
+}
+
+// inline returns the value of a --flag=value or -kvalue token.
+func (t Token) inline() (string, bool) {
+	if t.Kind != Flag || len(t.Text) == len(t.Flag) {
+		return "", false
+	}
+	return strings.TrimPrefix(t.Text[len(t.Flag):], "="), true
+}
+
+// shortFlag returns the name of a short flag with its value attached, as in -kAPrivateKey1,
+// which leo reads like "-k APrivateKey1".
+func shortFlag(a string) (string, bool) {
+	if len(a) < 3 || a[1] == '-' {
+		return "", false
+	}
+	if LeoFlags[a[:2]] != Single {
+		return "", false
+	}
+	return a[:2], true
+}
+
+// Tokens is a parsed argument list; Strings returns the original arguments unchanged.
+type Tokens []Token
+
+// Tokenize parses args with the LeoFlags grammar. valued names flags to treat as Single
+// when the grammar does not know them, for callers that already expect a value.
+func Tokenize(args []string, valued ...string) Tokens {
+	out := make(Tokens, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			out = append(out, Token{Kind: EndOfFlags, Text: a})
+			for _, rest := range args[i+1:] {
+				out = append(out, Token{Kind: Positional, Text: rest})
+			}
+			break
+		}
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			out = append(out, Token{Kind: Positional, Text: a})
+			continue
+		}
+		name, _, inline := strings.Cut(a, "=")
+		if short, ok := shortFlag(a); ok {
+			name, inline = short, true
+		}
+		out = append(out, Token{Kind: Flag, Text: a, Flag: name})
+		if inline {
+			continue
+		}
+		arity, ok := LeoFlags[name]
+		if !ok && slices.Contains(valued, name) {
+			arity = Single
+		}
+		switch arity {
+		case Single:
+			if i+1 < len(args) {
+				i++
+				out = append(out, Token{Kind: Value, Text: args[i], Flag: name})
+			}
+		case Multi:
+			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				out = append(out, Token{Kind: Value, Text: args[i], Flag: name})
+			}
+		}
+	}
+	return out
+}
+
+// Strings returns the tokens as command-line arguments.
+func (t Tokens) Strings() []string {
+	out := make([]string, len(t))
+	for i, tok := range t {
+		out[i] = tok.Text
+	}
+	return out
+}
+
+// Positionals returns the subcommand, program and inputs, skipping flags and their values.
+func (t Tokens) Positionals() []string {
+	var out []string
+	for _, tok := range t {
+		if tok.Kind == Positional {
+			out = append(out, tok.Text)
+		}
+	}
+	return out
+}
+
+// Has reports whether any of the flags is present.
+func (t Tokens) Has(flags ...string) bool {
+	return slices.ContainsFunc(t, func(tok Token) bool {
+		return tok.Kind == Flag && slices.Contains(flags, tok.Flag)
+	})
+}
+
+// Values returns the values of the last occurrence of flag, which is the one leo uses
+// when a flag is repeated. It returns nil when the flag is absent or has no value.
+func (t Tokens) Values(flag string) []string {
+	last := -1
+	for i, tok := range t {
+		if tok.Kind == Flag && tok.Flag == flag {
+			last = i
+		}
+	}
+	if last < 0 {
+		return nil
+	}
+	if v, ok := t[last].inline(); ok {
+		return []string{v}
+	}
+	var out []string
+	for _, tok := range t[last+1:] {
+		if tok.Kind != Value {
+			break
+		}
+		out = append(out, tok.Text)
+	}
+	return out
+}
+
+// Set replaces the values of flag, keeping the position and form of its first
+// occurrence and dropping any repeats, or inserts it after subcmd when absent.
+func (t Tokens) Set(subcmd, flag string, values ...string) Tokens {
+	first := -1
+	out := make(Tokens, 0, len(t)+len(values)+1)
+	for i := 0; i < len(t); i++ {
+		tok := t[i]
+		if tok.Kind != Flag || tok.Flag != flag {
+			out = append(out, tok)
+			continue
+		}
+		for i+1 < len(t) && t[i+1].Kind == Value {
+			i++
+		}
+		if first >= 0 {
+			continue
+		}
+		first = len(out)
+		if _, ok := tok.inline(); ok {
+			out = append(out, Token{Kind: Flag, Text: flag + "=" + strings.Join(values, ","), Flag: flag})
+			continue
+		}
+		out = append(out, tok)
+		out = append(out, valueTokens(flag, values)...)
+	}
+	if first < 0 {
+		return t.Insert(subcmd, flag, values...)
+	}
+	return out
+}
+
+// Insert adds flag and its values right after the subcmd token, or at the front when
+// subcmd is not among the positionals before "--", where leo would read them as inputs.
+func (t Tokens) Insert(subcmd, flag string, values ...string) Tokens {
+	at := 0
+	for i, tok := range t {
+		if tok.Kind == EndOfFlags {
+			break
+		}
+		if tok.Kind == Positional && strings.EqualFold(tok.Text, subcmd) {
+			at = i + 1
+			break
+		}
+	}
+	add := append(Tokens{{Kind: Flag, Text: flag, Flag: flag}}, valueTokens(flag, values)...)
+	return slices.Insert(slices.Clone(t), at, add...)
+}
+
+// Remove drops every occurrence of the given flags together with their values.
+func (t Tokens) Remove(flags ...string) Tokens {
+	return slices.DeleteFunc(slices.Clone(t), func(tok Token) bool {
+		return tok.Kind != Positional && tok.Kind != EndOfFlags && slices.Contains(flags, tok.Flag)
+	})
+}
+
+// Redact replaces the values of the given flags with "***".
+func (t Tokens) Redact(flags ...string) Tokens {
+	out := slices.Clone(t)
+	for i, tok := range out {
+		if !slices.Contains(flags, tok.Flag) {
+			continue
+		}
+		if tok.Kind == Value {
+			out[i].Text = "***"
+		} else if _, ok := tok.inline(); ok {
+			out[i].Text = tok.Flag + "=***"
+		}
+	}
+	return out
+}
+
+func valueTokens(flag string, values []string) Tokens {
+	out := make(Tokens, len(values))
+	for i, v := range values {
+		out[i] = Token{Kind: Value, Text: v, Flag: flag}
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fuzzArgs splits a fuzzed line into arguments. NUL separates them so that spaces,
+// quotes and lookalike dashes survive inside an argument.
+func fuzzArgs(line string) []string {
+	if line == "" {
+		return nil
+	}
+	return strings.Split(line, "\x00")
+}
+
+func addArgSeeds(f *testing.F) {
+	for _, args := range [][]string{
+		{"execute", "token.aleo/mint", "aleo1abc", "5u64", "--network", "mainnet"},
+		{"--path", "./app", "-d", "execute", "main.aleo/run", "1u32"},
+		{"execute", "x.aleo/f", "--priority-fees", "1000", "2000", "--yes"},
+		{"execute", "x.aleo/f", "--", "--private-key", "APrivateKey1x"},
+		{"execute", "x.aleo/f", "--private-key"},
+		{"execute", "x.aleo/f", "-kAPrivateKey1x"},
+		{"execute", "x.aleo/f", "-k=APrivateKey1x", "--fee-private-key=APrivateKey1y"},
+		{"execute", "x.aleo/f", "—private-key", "APrivateKey1x"},
+		{"execute", "x.aleo/f", "‐k", "APrivateKey1x"},
+		{"execute", "toKen.aleo/mint"},
+		{"execute", "https://x.aleo/f", "y.aleo/g"},
+		{"--", "execute", "x.aleo/f"},
+		{"-", "--", "--"},
+		{"execute", "x.aleo\x00/f"},
+		{"execute", " x.aleo /f", "\t"},
+	} {
+		f.Add(strings.Join(args, "\x00"))
+	}
+}
+
+func FuzzTokenize(f *testing.F) {
+	addArgSeeds(f)
+	f.Fuzz(func(t *testing.T, line string) {
+		args := fuzzArgs(line)
+		toks := Tokenize(args)
+		if got := toks.Strings(); !slices.Equal(got, args) {
+			t.Fatalf("round trip of %q: got %q", args, got)
+		}
+		end := slices.Index(args, "--")
+		for i, tok := range toks {
+			if end >= 0 && i > end && tok.Kind != Positional {
+				t.Fatalf("%q after -- parsed as %v", tok.Text, tok.Kind)
+			}
+			if tok.Kind == Flag && !strings.HasPrefix(tok.Text, tok.Flag) {
+				t.Fatalf("flag %q parsed with name %q", tok.Text, tok.Flag)
+			}
+		}
+	})
+}
+
+func FuzzSecretFlags(f *testing.F) {
+	addArgSeeds(f)
+	f.Fuzz(func(t *testing.T, line string) {
+		args := fuzzArgs(line)
+		redacted := RedactFlagValues(args, SecretFlags...)
+		if len(redacted) != len(args) {
+			t.Fatalf("redaction changed the argument count: %q", redacted)
+		}
+		for _, flag := range SecretFlags {
+			if v := GetFlagValue(redacted, flag); v != "" && v != "***" {
+				t.Fatalf("%s value %q survived redaction of %q", flag, v, args)
+			}
+		}
+		if HasAnyFlag(args, SecretFlags...) {
+			return
+		}
+		// Injecting the configured key must not change what leo runs, nor be shadowed
+		// by a key the caller smuggled in.
+		sub, _ := FirstSubcommand(args)
+		out := InjectFlagValueAfterSubcommand(args, sub, "--private-key", "APrivateKey1injected")
+		if v := GetFlagValue(out, "--private-key"); v != "APrivateKey1injected" {
+			t.Fatalf("injected key reads back as %q in %q", v, out)
+		}
+		for _, flag := range SecretFlags[1:] {
+			if HasAnyFlag(out, flag) {
+				t.Fatalf("%s appeared after injection into %q", flag, args)
+			}
+		}
+		if !slices.Equal(Tokenize(out).Positionals(), Tokenize(args).Positionals()) {
+			t.Fatalf("injection changed the positionals of %q: %q", args, out)
+		}
+	})
+}
+
+func FuzzExtractExecuteContract(f *testing.F) {
+	addArgSeeds(f)
+	f.Fuzz(func(t *testing.T, line string) {
+		args := fuzzArgs(line)
+		contract, method := ExtractExecuteContract(args)
+		if contract == "" {
+			if method != "" {
+				t.Fatalf("method %q without a contract in %q", method, args)
+			}
+			return
+		}
+		// The contract must be what leo receives, up to ASCII case: no flag value and no
+		// Unicode case folding, which would turn lookalikes into allowed names.
+		if strings.ContainsFunc(contract, func(r rune) bool { return 'A' <= r && r <= 'Z' }) {
+			t.Fatalf("contract %q is not lower case", contract)
+		}
+		for _, tok := range Tokenize(args).Positionals() {
+			if raw, _, ok := strings.Cut(tok, "/"); ok && asciiLower(strings.TrimSpace(raw)) == contract {
+				return
+			}
+		}
+		t.Fatalf("contract %q of %q is not one of its positionals", contract, args)
+	})
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTokenizeRoundTrip(t *testing.T) {
+	for _, line := range []string{
+		"execute token.aleo/mint_public aleo1abc 5u64 --network mainnet --broadcast -y",
+		"--path ./app -d execute main.aleo/run 1u32",
+		"execute x.aleo/f --priority-fees 1000 2000 --fee-records r1 r2 --yes",
+		"deploy --consensus-heights=0,1,2 --skip credits.aleo token.aleo",
+		"execute x.aleo/f -- --endpoint -5i64",
+		"execute x.aleo/f --private-key",
+		"",
+	} {
+		args := strings.Fields(line)
+		if got := Tokenize(args).Strings(); !slices.Equal(got, args) {
+			t.Fatalf("round trip of %q: got %q", line, got)
+		}
+	}
+}
+
+func TestFlagHelpers(t *testing.T) {
+	split := strings.Fields
+	cases := []struct {
+		name       string
+		args       string
+		subcommand string
+		contract   string
+		network    string
+	}{
+		{name: "plain", args: "execute token.aleo/mint --network mainnet", subcommand: "execute", contract: "token.aleo", network: "mainnet"},
+		{name: "global value flag", args: "--path sub/dir execute token.aleo/mint", subcommand: "execute", contract: "token.aleo"},
+		{name: "switch before subcommand", args: "-d execute token.aleo/mint", subcommand: "execute", contract: "token.aleo"},
+		{name: "value looks like a program", args: "execute --save out/dir token.aleo/mint", subcommand: "execute", contract: "token.aleo"},
+		{name: "repeated flag uses last", args: "execute x.aleo/f --network testnet --network=mainnet", subcommand: "execute", contract: "x.aleo", network: "mainnet"},
+		{name: "after separator", args: "execute x.aleo/f -- --network testnet", subcommand: "execute", contract: "x.aleo"},
+		{name: "only flags", args: "--version", subcommand: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := split(tc.args)
+			if sub, _ := FirstSubcommand(args); sub != tc.subcommand {
+				t.Fatalf("subcommand %q, want %q", sub, tc.subcommand)
+			}
+			if c, _ := ExtractExecuteContract(args); c != tc.contract {
+				t.Fatalf("contract %q, want %q", c, tc.contract)
+			}
+			if n := GetFlagValue(args, "--network"); n != tc.network {
+				t.Fatalf("network %q, want %q", n, tc.network)
+			}
+		})
+	}
+}
+
+func TestMultiValueFlags(t *testing.T) {
+	args := strings.Fields("execute x.aleo/f --priority-fees 1000 2000 --yes")
+	if got := GetFlagValue(args, "--priority-fees"); got != "1000,2000" {
+		t.Fatalf("got %q", got)
+	}
+	out := SetFlagValue(args, "execute", "--priority-fees", "5")
+	if want := strings.Fields("execute x.aleo/f --priority-fees 5 --yes"); !slices.Equal(out, want) {
+		t.Fatalf("set: got %q, want %q", out, want)
+	}
+	if c, _ := ExtractExecuteContract(strings.Fields("execute --fee-records a/b c/d -y x.aleo/f")); c != "x.aleo" {
+		t.Fatalf("fee records taken as contract: %q", c)
+	}
+}
+
+func TestSetFlagValue(t *testing.T) {
+	cases := []struct{ args, flag, value, want string }{
+		{"execute x.aleo/f --network testnet", "--network", "mainnet", "execute x.aleo/f --network mainnet"},
+		{"execute x.aleo/f --network=testnet", "--network", "mainnet", "execute x.aleo/f --network=mainnet"},
+		{"execute x.aleo/f --network a --yes --network b", "--network", "mainnet", "execute x.aleo/f --network mainnet --yes"},
+		{"execute x.aleo/f", "--network", "mainnet", "execute --network mainnet x.aleo/f"},
+		{"execute x.aleo/f --custom 1", "--custom", "2", "execute x.aleo/f --custom 2"},
+		{"x.aleo/f", "--network", "mainnet", "--network mainnet x.aleo/f"},
+	}
+	for _, tc := range cases {
+		got := SetFlagValue(strings.Fields(tc.args), "execute", tc.flag, tc.value)
+		if !slices.Equal(got, strings.Fields(tc.want)) {
+			t.Fatalf("%q: got %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestInjectAndRedact(t *testing.T) {
+	args := strings.Fields("-d execute x.aleo/f --private-key APrivateKey1 -k=APrivateKey2 -- -k")
+	got := InjectFlagValueAfterSubcommand(args, "execute", "--endpoint", "https://e")
+	want := strings.Fields("-d execute --endpoint https://e x.aleo/f --private-key APrivateKey1 -k=APrivateKey2 -- -k")
+	if !slices.Equal(got, want) {
+		t.Fatalf("inject: got %q", got)
+	}
+	red := RedactFlagValues(args, SecretFlags...)
+	if want := strings.Fields("-d execute x.aleo/f --private-key *** -k=*** -- -k"); !slices.Equal(red, want) {
+		t.Fatalf("redact: got %q", red)
+	}
+	if got := RemoveFlags(append(args, "--broadcast"), "--private-key", "--broadcast"); !slices.Equal(got, strings.Fields("-d execute x.aleo/f -k=APrivateKey2 -- -k --broadcast")) {
+		t.Fatalf("remove: got %q", got)
+	}
+	if HasAnyFlag(strings.Fields("execute x.aleo/f -- --endpoint"), "--endpoint") {
+		t.Fatal("flag after -- reported as present")
+	}
+	if !HasAnyFlag(strings.Fields("execute --endpoint=https://e"), "--endpoint") {
+		t.Fatal("inline flag not found")
+	}
+}
+
+func TestFuzzRegressions(t *testing.T) {
+	args := strings.Fields("execute x.aleo/f -kAPrivateKey1 -d")
+	if !HasAnyFlag(args, "-k") || GetFlagValue(args, "-k") != "APrivateKey1" {
+		t.Fatal("attached short flag value not recognised")
+	}
+	if red := RedactFlagValues(args, SecretFlags...); !slices.Equal(red, strings.Fields("execute x.aleo/f -k=*** -d")) {
+		t.Fatalf("redact: got %q", red)
+	}
+	if got := InjectFlagValueAfterSubcommand(strings.Fields("-- execute x.aleo/f"), "execute", "--private-key", "k"); got[0] != "--private-key" {
+		t.Fatalf("inject after --: got %q", got)
+	}
+	if c, _ := ExtractExecuteContract([]string{"execute", "toKen.aleo/mint"}); c == "token.aleo" {
+		t.Fatal("Kelvin sign folded into k")
+	}
+	if c, m := ExtractExecuteContract([]string{"execute", " /0", "x.aleo/f"}); c != "x.aleo" || m != "f" {
+		t.Fatalf("blank contract: got %q %q", c, m)
+	}
+}
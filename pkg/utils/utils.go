@@ -4,23 +4,15 @@ package utils
 import (
 	"bytes"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/mattn/go-shellwords"
 )
 
-type InvokeRequest struct {
-	Args []string `json:"args"`
-	Cmd  string   `json:"cmd"`
-}
-
 func FindLeo() string {
 	if p := os.Getenv("LEO_BIN"); p != "" {
 		return p
@@ -36,58 +28,53 @@ func DecodeBase64(s string) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(s)
 }
 
-// ParseArgs parses the request and returns args
-func ParseArgs(req events.LambdaFunctionURLRequest) ([]string, error) {
-	// Only POST body JSON is supported
-	if req.RequestContext.HTTP.Method != http.MethodPost {
-		return nil, errors.New("only POST with JSON body is supported")
-	}
-
-	var body InvokeRequest
-	raw := []byte(req.Body)
-	if req.IsBase64Encoded {
-		dec, derr := DecodeBase64(req.Body)
-		if derr != nil {
-			return nil, fmt.Errorf("invalid base64 body: %w", derr)
+// CallerIdentity returns a stable identity for the caller: the IAM principal when the
+// Function URL uses AWS_IAM auth, otherwise the source IP.
+func CallerIdentity(req events.LambdaFunctionURLRequest) string {
+	if a := req.RequestContext.Authorizer; a != nil && a.IAM != nil {
+		if a.IAM.UserARN != "" {
+			return "iam:" + a.IAM.UserARN
+		}
+		if a.IAM.CallerID != "" {
+			return "iam:" + a.IAM.CallerID
 		}
-		raw = dec
 	}
-	if err := json.Unmarshal(raw, &body); err != nil {
-		return nil, fmt.Errorf("invalid JSON body: %w", err)
+	if ip := req.RequestContext.HTTP.SourceIP; ip != "" {
+		return "ip:" + ip
 	}
-	if len(body.Args) > 0 {
-		return body.Args, nil
+	return "anonymous"
+}
+
+// HeaderValue returns the value of header name, matched case-insensitively (Function
+// URLs lowercase header names).
+func HeaderValue(headers map[string]string, name string) string {
+	if v, ok := headers[strings.ToLower(name)]; ok {
+		return v
 	}
-	if strings.TrimSpace(body.Cmd) != "" {
-		p := shellwords.NewParser()
-		p.ParseEnv = true
-		args, err := p.Parse(body.Cmd)
-		if err != nil {
-			return nil, fmt.Errorf("invalid cmd: %w", err)
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
 		}
-		return args, nil
 	}
-	return nil, errors.New("missing args or cmd in request body")
+	return ""
 }
 
-// FirstSubcommand returns the first non-flag token from args (case-insensitive).
-// Treats "--" as end of options; the token after may be considered a subcommand if present.
+// RequestPath returns the HTTP path of the request, defaulting to "/".
+func RequestPath(req events.LambdaFunctionURLRequest) string {
+	p := FirstNonEmpty(req.RawPath, req.RequestContext.HTTP.Path)
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+// FirstSubcommand returns the first positional token from args (case-insensitive),
+// skipping flags and their values. Tokens after "--" are positional.
 func FirstSubcommand(args []string) (string, error) {
 	if len(args) == 0 {
 		return "", errors.New("no arguments provided")
 	}
-	skipFlags := true
-	for i := range args {
-		tok := args[i]
-		if skipFlags {
-			if tok == "--" {
-				skipFlags = false
-				continue
-			}
-			if strings.HasPrefix(tok, "-") {
-				continue
-			}
-		}
+	for _, tok := range Tokenize(args).Positionals() {
 		if strings.TrimSpace(tok) != "" {
 			return strings.ToLower(tok), nil
 		}
@@ -96,10 +83,10 @@ func FirstSubcommand(args []string) (string, error) {
 	return "", nil
 }
 
-// ExtractExecuteContract scans args to find the first token that looks like "contract/method"
-// and returns the contract and method parts in lower case.
+// ExtractExecuteContract scans the positional args to find the first token that looks
+// like "contract/method" and returns the contract and method parts in lower case.
 func ExtractExecuteContract(args []string) (contract string, method string) {
-	for _, tok := range args {
+	for _, tok := range Tokenize(args).Positionals() {
 		if strings.HasPrefix(tok, "-") || strings.TrimSpace(tok) == "" {
 			continue
 		}
@@ -107,59 +94,57 @@ func ExtractExecuteContract(args []string) (contract string, method string) {
 		if strings.Contains(tok, "://") {
 			continue
 		}
-		if i := strings.Index(tok, "/"); i > 0 && i < len(tok)-1 {
-			c := strings.ToLower(strings.TrimSpace(tok[:i]))
-			m := strings.ToLower(strings.TrimSpace(tok[i+1:]))
-			return c, m
+		if c, m, ok := strings.Cut(tok, "/"); ok {
+			c, m = asciiLower(strings.TrimSpace(c)), asciiLower(strings.TrimSpace(m))
+			if c != "" && m != "" {
+				return c, m
+			}
 		}
 	}
 	return "", ""
 }
 
+// asciiLower lowercases ASCII letters only. strings.ToLower would also fold lookalikes
+// such as the Kelvin sign into "k", so a program leo rejects could pass as an allowed one.
+func asciiLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
 // HasAnyFlag checks if args contain any of the provided flags, either as separate token
-// or in the form --flag=value.
+// or in the form --flag=value. Flag values and tokens after "--" do not count.
 func HasAnyFlag(args []string, names ...string) bool {
-	for _, a := range args {
-		for _, n := range names {
-			if a == n || strings.HasPrefix(a, n+"=") {
-				return true
-			}
-		}
-	}
-	return false
+	return Tokenize(args, names...).Has(names...)
 }
 
 // InjectFlagValueAfterSubcommand inserts a flag and value immediately after the subcommand token
 // if found; otherwise it prepends them.
 func InjectFlagValueAfterSubcommand(args []string, subcmd, flag, value string) []string {
-	idx := -1
-	// find first non-flag token (subcommand), but specifically match on provided subcmd
-	skipFlags := true
-	for i, tok := range args {
-		if skipFlags {
-			if tok == "--" {
-				skipFlags = false
-				continue
-			}
-			if strings.HasPrefix(tok, "-") {
-				continue
-			}
-		}
-		if strings.EqualFold(tok, subcmd) {
-			idx = i
-			break
-		}
-	}
-	if idx >= 0 {
-		// insert after idx
-		out := make([]string, 0, len(args)+2)
-		out = append(out, args[:idx+1]...)
-		out = append(out, flag, value)
-		out = append(out, args[idx+1:]...)
-		return out
-	}
-	// prepend by default
-	return append([]string{flag, value}, args...)
+	return Tokenize(args, flag).Insert(subcmd, flag, value).Strings()
+}
+
+// SetFlagValue replaces the value of flag in args (in either --flag value or --flag=value form),
+// or injects it after the subcommand when absent. Repeats of the flag are dropped, and all
+// values of a multi-valued flag are replaced.
+func SetFlagValue(args []string, subcmd, flag, value string) []string {
+	return Tokenize(args, flag).Set(subcmd, flag, value).Strings()
+}
+
+// SecretFlags lists flags whose values must never be logged or hashed in clear.
+var SecretFlags = []string{"--private-key", "-k", "--fee-private-key"}
+
+// RedactFlagValues returns a copy of args with the values of the given flags replaced by "***".
+func RedactFlagValues(args []string, flags ...string) []string {
+	return Tokenize(args, flags...).Redact(flags...).Strings()
+}
+
+// RemoveFlags returns a copy of args without the given flags and their values.
+func RemoveFlags(args []string, flags ...string) []string {
+	return Tokenize(args, flags...).Remove(flags...).Strings()
 }
 
 // FirstNonEmpty returns the first non-empty trimmed string from vals.
@@ -177,21 +162,10 @@ func FirstNonEmpty(vals ...string) string {
 //	--flag value
 //	--flag=value
 //
-// It returns empty string if not found.
+// A repeated flag yields its last value, and the values of a multi-valued flag are joined
+// with commas. It returns empty string if not found.
 func GetFlagValue(args []string, flag string) string {
-	for i := range args {
-		a := args[i]
-		if a == flag {
-			if i+1 < len(args) {
-				return args[i+1]
-			}
-			return ""
-		}
-		if after, ok := strings.CutPrefix(a, flag+"="); ok {
-			return after
-		}
-	}
-	return ""
+	return strings.Join(Tokenize(args, flag).Values(flag), ",")
 }
 
 // Run runs the arbitrary command with given args and returns the result.
@@ -239,4 +213,4 @@ func FilterLines(text string, exclude []string) string {
 		}
 	}
 	return strings.TrimSpace(strings.Join(filtered, "\n"))
-}
\ No newline at end of file
+}
@@ -0,0 +1,12 @@
+package utils
+
+import "testing"
+
+func BenchmarkInjectFlagValueAfterSubcommand(b *testing.B) {
+	args := []string{"execute", "credits.aleo/transfer_public", "aleo1xyz", "100u64", "--network", "mainnet"}
+	b.ReportAllocs()
+	for b.Loop() {
+		out := InjectFlagValueAfterSubcommand(args, "execute", "--endpoint", "https://api.explorer.provable.com/v1")
+		_ = InjectFlagValueAfterSubcommand(out, "execute", "--home", "/tmp/leo")
+	}
+}
@@ -0,0 +1,30 @@
+// Package warnings defines the caveats a response reports in its warnings array:
+// conditions that did not fail the request but that a client may want to surface,
+// such as truncated output or an allowlist served from a stale cache. They are kept
+// apart from leo's stderr so clients need not parse them out of it.
+package warnings
+
+// Warning codes. Like error codes they are part of the API: never rename one.
+const (
+	// OutputTruncated: stdout or stderr was cut to fit MAX_OUTPUT_BYTES, the response or
+	// the profile.
+	OutputTruncated = "output_truncated"
+	// StaleConfig: the allowlist could not be refreshed and a cached copy was used.
+	StaleConfig = "stale_config"
+	// StaleChainState: chain state a preset variable reads could not be read and a
+	// cached value within CHAIN_VAR_STALE was used.
+	StaleChainState = "stale_chain_state"
+	// DuplicateExecute: an identical execute was broadcast within DEDUP_WINDOW.
+	DuplicateExecute = "duplicate_execute"
+	// NotConfirmed: the transaction was broadcast but not seen confirmed in time.
+	NotConfirmed = "not_confirmed"
+	// ReceiptFailed: the execution succeeded but its receipt could not be anchored.
+	ReceiptFailed = "receipt_failed"
+)
+
+// Warning is one caveat. Message is English text meant for logs and operators;
+// clients should match on Code.
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,82 @@
+// Package worker hands heavy `leo execute` runs to an external worker fleet through SQS.
+// The Lambda only coordinates: it enqueues the run without --broadcast, a worker builds
+// and proves the transaction and posts it back to the job's callback URL, and the
+// Lambda broadcasts it. Each message carries a token, derived from a shared secret and
+// the job ID, that authenticates the worker's callback for that job only.
+package worker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// TokenHeader carries the callback token on a worker's result.
+const TokenHeader = "X-Leo-Worker-Token"
+
+// Message is the SQS message body a worker receives.
+type Message struct {
+	JobID string `json:"jobId"`
+	// Args is the leo command to run, without --broadcast or --home.
+	Args        []string  `json:"args"`
+	CallbackURL string    `json:"callbackUrl"`
+	Token       string    `json:"token"`
+	Deadline    time.Time `json:"deadline"`
+}
+
+// Result is what a worker posts to the callback URL. Transaction is the transaction
+// JSON leo built; it is broadcast when ExitCode is 0.
+type Result struct {
+	ExitCode    int             `json:"exitCode"`
+	Stdout      string          `json:"stdout,omitempty"`
+	Stderr      string          `json:"stderr,omitempty"`
+	Transaction json.RawMessage `json:"transaction,omitempty"`
+}
+
+// Queue enqueues runs for the fleet.
+type Queue struct {
+	client   *awsapi.Client
+	queueURL string
+	secret   []byte
+	// Contracts limits delegation to these programs; empty delegates every execute.
+	Contracts []string
+}
+
+// NewQueue returns a queue sending to queueURL and signing tokens with secret.
+func NewQueue(client *awsapi.Client, queueURL, secret string, contracts []string) *Queue {
+	return &Queue{client: client, queueURL: queueURL, secret: []byte(secret), Contracts: contracts}
+}
+
+// Applies reports whether runs of contract go to the fleet.
+func (q *Queue) Applies(contract string) bool {
+	return len(q.Contracts) == 0 || slices.Contains(q.Contracts, contract)
+}
+
+// Token returns the callback token for job id.
+func (q *Queue) Token(id string) string {
+	m := hmac.New(sha256.New, q.secret)
+	m.Write([]byte(id))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify reports whether token authenticates a callback for job id.
+func (q *Queue) Verify(id, token string) bool {
+	return hmac.Equal([]byte(q.Token(id)), []byte(token))
+}
+
+// Send enqueues m; its Token is filled in here.
+func (q *Queue) Send(ctx context.Context, m Message) error {
+	m.Token = q.Token(m.JobID)
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	in := map[string]any{"QueueUrl": q.queueURL, "MessageBody": string(body)}
+	return q.client.JSON(ctx, "sqs", "AmazonSQS.SendMessage", in, nil)
+}
@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+func TestSendSignsCallbackToken(t *testing.T) {
+	var got Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "AmazonSQS.SendMessage" {
+			t.Errorf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+		var in struct{ QueueUrl, MessageBody string }
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		if in.QueueUrl != "https://sqs/q" {
+			t.Errorf("unexpected queue %q", in.QueueUrl)
+		}
+		_ = json.Unmarshal([]byte(in.MessageBody), &got)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	client := &awsapi.Client{Region: "us-east-1", Credentials: awsapi.Credentials{AccessKeyID: "a", SecretAccessKey: "b"}, EndpointURL: srv.URL}
+	q := NewQueue(client, "https://sqs/q", "secret", nil)
+
+	if err := q.Send(context.Background(), Message{JobID: "j1", Args: []string{"execute", "token.aleo/mint"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got.JobID != "j1" || !slices.Equal(got.Args, []string{"execute", "token.aleo/mint"}) || !q.Verify("j1", got.Token) {
+		t.Fatalf("unexpected message %+v", got)
+	}
+	if q.Verify("j2", got.Token) || NewQueue(client, "", "other", nil).Verify("j1", got.Token) {
+		t.Fatal("a token must only authenticate its own job and secret")
+	}
+}
+
+func TestApplies(t *testing.T) {
+	q := &Queue{Contracts: []string{"token.aleo"}}
+	if !q.Applies("token.aleo") || q.Applies("credits.aleo") || !(&Queue{}).Applies("credits.aleo") {
+		t.Fatal("unexpected Applies")
+	}
+}
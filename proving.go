@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/budget"
+	"github.com/debendraoli/leo-lambda/pkg/executor"
+	"github.com/debendraoli/leo-lambda/pkg/prover"
+)
+
+// Values of Meta["proving"].
+const (
+	provingRemote   = "remote"
+	provingLocal    = "local"
+	provingFallback = "local-fallback"
+)
+
+// delegateProving runs an execute on the PROVER_URL service. ok is false when the service
+// was unavailable and the run should be proved locally instead; any other failure is
+// returned as the result, since the transaction may already have been broadcast. meta
+// reports the path taken and the time spent on the remote call.
+func delegateProving(ctx context.Context, p *prover.Client, cfg executor.Config) (res executor.Result, ok bool, meta map[string]string) {
+	if cfg.OnStart != nil {
+		cfg.OnStart(0)
+	}
+	start := time.Now()
+	out, err := p.Prove(ctx, cfg.Args)
+	meta = map[string]string{"proverSeconds": strconv.FormatFloat(time.Since(start).Seconds(), 'f', 3, 64)}
+	if errors.Is(err, prover.ErrUnavailable) {
+		meta["proving"], meta["proverError"] = provingFallback, err.Error()
+		return executor.Result{}, false, meta
+	}
+	meta["proving"] = provingRemote
+	if err != nil {
+		meta["proverError"] = err.Error()
+		return executor.Result{ExitCode: 1, Stderr: err.Error(), Attempts: 1}, true, meta
+	}
+
+	res = executor.Result{ExitCode: out.ExitCode, Stdout: out.Stdout, Stderr: out.Stderr, Attempts: 1}
+	limit := budget.OutputLimit(ctx, cfg.MaxOutputBytes)
+	for _, s := range []*string{&res.Stdout, &res.Stderr} {
+		if limit > 0 && len(*s) > limit {
+			*s, res.Truncated = (*s)[:limit], true
+		}
+	}
+	if cfg.OnOutput != nil {
+		now := time.Now()
+		for line := range strings.Lines(res.Stdout) {
+			cfg.OnOutput(executor.Stdout, strings.TrimSuffix(line, "\n"), now)
+		}
+		for line := range strings.Lines(res.Stderr) {
+			cfg.OnOutput(executor.Stderr, strings.TrimSuffix(line, "\n"), now)
+		}
+	}
+	return res, true, meta
+}
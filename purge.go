@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/journal"
+	"github.com/debendraoli/leo-lambda/pkg/usage"
+)
+
+// purgeAction deletes what is kept about the runs carrying all of params.tags, e.g. for
+// a customer's erasure request: journal entries are replaced by tombstones, and their
+// async jobs, in this container and in STORE, and their uploaded objects are deleted.
+// Days with purged entries are exported again so the Parquet files drop them. With
+// params.dryRun it only lists what would go.
+func purgeAction(ctx context.Context, cfgEnv *EnvConfig, params map[string]any) events.LambdaFunctionURLResponse {
+	dryRun, _ := params["dryRun"].(bool)
+	want := map[string]string{}
+	if t, ok := params["tags"].(map[string]any); ok {
+		for k, v := range t {
+			s, ok := v.(string)
+			if !ok {
+				return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("params.tags.%s must be a string", k)})
+			}
+			want[k] = s
+		}
+	}
+	if len(want) == 0 {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.tags must name at least one tag"})
+	}
+
+	journalIDs, objects, dates := []string{}, []string{}, []string{}
+	jobIDs := jobRegistry.Purge(want, dryRun)
+	j := cfgEnv.journal()
+	if j.Enabled() {
+		entries, err := j.List(0, want)
+		if err != nil {
+			return jsonResp(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		for _, e := range entries {
+			// A run still in progress here would rewrite its entry; purge again later.
+			if e.Status == journal.StatusRunning {
+				continue
+			}
+			journalIDs = append(journalIDs, e.ID)
+			objects = append(objects, e.Outputs...)
+			if e.Job != "" && !slices.Contains(jobIDs, e.Job) {
+				jobIDs = append(jobIDs, e.Job)
+			}
+			if len(e.Phases) > 0 {
+				if d := e.Phases[0].At.UTC().Format(usage.DayLayout); !slices.Contains(dates, d) {
+					dates = append(dates, d)
+				}
+			}
+		}
+	}
+	slices.Sort(dates)
+	out := map[string]any{"dryRun": dryRun, "journal": journalIDs, "jobs": jobIDs, "objects": objects}
+	if dryRun {
+		return jsonResp(http.StatusOK, out)
+	}
+
+	var errs []string
+	for _, id := range jobIDs {
+		jobRegistry.Forget(id)
+		if cfgEnv.store == nil {
+			continue
+		}
+		sctx, cancel := context.WithTimeout(ctx, storeTimeout)
+		if err := cfgEnv.store.Delete(sctx, "jobs/"+id); err != nil {
+			errs = append(errs, fmt.Sprintf("job %s: %v", id, err))
+		}
+		cancel()
+	}
+	for _, uri := range objects {
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+		switch {
+		case !ok || cfgEnv.s3 == nil:
+			errs = append(errs, fmt.Sprintf("object %s: cannot delete it (set OUTPUT_BUCKET)", uri))
+		default:
+			if err := cfgEnv.s3.DeleteObject(ctx, bucket, key); err != nil {
+				errs = append(errs, fmt.Sprintf("object %s: %v", uri, err))
+			}
+		}
+	}
+	// Entries are only soft-deleted once everything they point to is gone, so a failed
+	// purge can simply be repeated.
+	if len(errs) > 0 {
+		out["errors"] = errs
+		return jsonResp(http.StatusInternalServerError, out)
+	}
+	for _, id := range journalIDs {
+		if err := j.SoftDelete(id); err != nil {
+			errs = append(errs, fmt.Sprintf("journal %s: %v", id, err))
+		}
+	}
+	if cfgEnv.ExportBucket != "" {
+		for _, d := range dates {
+			day, _ := time.Parse(usage.DayLayout, d)
+			if _, err := export(ctx, cfgEnv, day); err != nil {
+				errs = append(errs, fmt.Sprintf("export %s: %v", d, err))
+			}
+		}
+		out["exported"] = dates
+	}
+	if len(errs) > 0 {
+		out["errors"] = errs
+		return jsonResp(http.StatusInternalServerError, out)
+	}
+	return jsonResp(http.StatusOK, out)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/jobs"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+	"github.com/debendraoli/leo-lambda/pkg/profile"
+	"github.com/debendraoli/leo-lambda/pkg/usage"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+	"github.com/debendraoli/leo-lambda/pkg/warnings"
+)
+
+// Phases of a resumable job. A job is resumed from the last phase it completed.
+const (
+	// phaseProving runs leo, which builds and proves the transaction without sending it.
+	phaseProving = "proving"
+	// phaseProved has the transaction in STORE, ready to broadcast.
+	phaseProved = "proved"
+	// phaseBroadcast has sent the transaction; only its confirmation is outstanding.
+	phaseBroadcast = "broadcast"
+	phaseDone      = "done"
+)
+
+// jobCheckpoint is the progress of a resumable job, kept with it in STORE.
+type jobCheckpoint struct {
+	Phase         string `json:"phase"`
+	Endpoint      string `json:"endpoint"`
+	Network       string `json:"network"`
+	Program       string `json:"program,omitempty"`
+	TransactionID string `json:"transactionId,omitempty"`
+	// Confirm waits up to ConfirmTimeoutSeconds, if set, for the transaction to be
+	// confirmed, as the run's profile asked.
+	Confirm               bool   `json:"confirm,omitempty"`
+	ConfirmTimeoutSeconds int    `json:"confirmTimeoutSeconds,omitempty"`
+	Fee                   uint64 `json:"fee,omitempty"`
+	// Fingerprint identifies the execute for DEDUP_WINDOW once it is broadcast.
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// resumableJob is the context key carrying the *resumable of the job being run.
+type resumableJob struct{}
+
+// resumable ties a running job to its STORE record, so each phase can be checkpointed.
+type resumable struct {
+	cfgEnv *EnvConfig
+	rec    storedJobRecord
+}
+
+// resumableRun reports whether an execute started as a job is run in resumable phases:
+// RESUMABLE_JOBS and STORE are set and the transaction is broadcast by this function
+// rather than a prover.
+func resumableRun(cfgEnv *EnvConfig, subcmd string, args []string) bool {
+	if !cfgEnv.ResumableJobs || cfgEnv.store == nil || cfgEnv.DryRun || subcmd != "execute" || !utils.HasAnyFlag(args, "--broadcast") {
+		return false
+	}
+	contract, _ := utils.ExtractExecuteContract(args)
+	return cfgEnv.prover == nil || !cfgEnv.prover.Applies(contract)
+}
+
+// newResumable starts the STORE record of job id, an execute of args run for owner as
+// prof asks, checkpointed from its first phase.
+func newResumable(cfgEnv *EnvConfig, id, owner string, args []string, prof profile.Profile, fee uint64, sum string, tags map[string]string) *resumable {
+	contract, _ := utils.ExtractExecuteContract(args)
+	return &resumable{cfgEnv: cfgEnv, rec: storedJobRecord{
+		Owner: owner,
+		Job:   jobs.Job{ID: id, Status: jobs.StatusRunning, Tags: tags, CreatedAt: clk.Now().UTC()},
+		Checkpoint: &jobCheckpoint{
+			Endpoint:              utils.GetFlagValue(args, "--endpoint"),
+			Network:               utils.GetFlagValue(args, "--network"),
+			Program:               contract,
+			Confirm:               prof.WaitConfirmation,
+			ConfirmTimeoutSeconds: prof.ConfirmTimeoutSeconds,
+			Fee:                   fee,
+			Fingerprint:           sum,
+		},
+	}}
+}
+
+// transactionKey is where the transaction of job id is kept in STORE.
+func transactionKey(id string) string {
+	return "transactions/" + id
+}
+
+// save checkpoints r in phase. A failed write is logged; the run goes on, only it
+// cannot be resumed from this phase.
+func (r *resumable) save(ctx context.Context, phase string) {
+	r.rec.Checkpoint.Phase, r.rec.Checkpoint.UpdatedAt = phase, clk.Now().UTC()
+	if err := putJobRecord(ctx, r.cfgEnv, r.rec, r.cfgEnv.JobTimeout+r.cfgEnv.jobTTL()); err != nil {
+		logWarn("store write failed", map[string]string{"key": "jobs/" + r.rec.Job.ID, "error": err.Error()})
+	}
+}
+
+// finish records the finished job with its last checkpoint.
+func (r *resumable) finish(ctx context.Context, j jobs.Job) {
+	r.rec.Job = j
+	if err := putJobRecord(ctx, r.cfgEnv, r.rec, r.cfgEnv.jobTTL()); err != nil {
+		logWarn("store write failed", map[string]string{"key": "jobs/" + j.ID, "error": err.Error()})
+	}
+}
+
+// proveArgs turns the execute args into a run that saves the transaction to dir
+// instead of broadcasting it.
+func proveArgs(args []string, subcmd, dir string) []string {
+	return utils.InjectFlagValueAfterSubcommand(utils.RemoveFlags(args, "--broadcast"), subcmd, "--save", dir)
+}
+
+// broadcast checkpoints the transaction leo saved to dir, sends it and checkpoints
+// again, returning its ID.
+func (r *resumable) broadcast(ctx context.Context, dir string) (string, error) {
+	tx, err := savedTransaction(dir)
+	if err != nil {
+		return "", err
+	}
+	putCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+	if err := r.cfgEnv.store.Put(putCtx, transactionKey(r.rec.Job.ID), tx, r.cfgEnv.JobTimeout+r.cfgEnv.jobTTL()); err != nil {
+		logWarn("store write failed", map[string]string{"key": transactionKey(r.rec.Job.ID), "error": err.Error()})
+	} else {
+		r.save(ctx, phaseProved)
+	}
+	return r.send(ctx, tx)
+}
+
+// send broadcasts tx and checkpoints its ID.
+func (r *resumable) send(ctx context.Context, tx []byte) (string, error) {
+	cp := r.rec.Checkpoint
+	ctx, cancel := context.WithTimeout(ctx, broadcastTimeout)
+	defer cancel()
+	id, err := network.Broadcast(ctx, nil, cp.Endpoint, cp.Network, tx)
+	if err != nil {
+		return "", err
+	}
+	r.rec.Checkpoint.TransactionID = id
+	recordBroadcast(ctx, r.cfgEnv, cp.Fingerprint, id)
+	r.save(ctx, phaseBroadcast)
+	return id, nil
+}
+
+// savedTransaction returns the transaction leo saved to dir: the JSON file in it
+// holding an execute transaction.
+func savedTransaction(dir string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var tx struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		if json.Unmarshal(b, &tx) == nil && tx.Type == "execute" && strings.HasPrefix(tx.ID, "at1") {
+			return b, nil
+		}
+	}
+	return nil, errors.New("leo saved no transaction")
+}
+
+// resumeJobPath returns the job ID of a resume path, /jobs/{id}/resume.
+func resumeJobPath(req events.LambdaFunctionURLRequest) (string, bool) {
+	if req.RequestContext.HTTP.Method != http.MethodPost {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(utils.RequestPath(req), "/jobs/")
+	if !ok {
+		return "", false
+	}
+	id, ok := strings.CutSuffix(rest, "/resume")
+	return id, ok && id != "" && !strings.Contains(id, "/")
+}
+
+// resumeJob picks job id up from its last checkpoint, in a job of the same ID, and
+// answers 202 with it. A job that never got past proving has nothing to resume from,
+// and one that may still be running on some container is left alone.
+func resumeJob(ctx context.Context, cfgEnv *EnvConfig, caller, id string) events.LambdaFunctionURLResponse {
+	rec, ok := loadJobRecord(ctx, cfgEnv, id)
+	if !ok || rec.Owner != caller {
+		return jsonResp(http.StatusNotFound, codedError(i18n.JobNotFound, fmt.Sprintf("job %q not found", id), map[string]string{"job": id}))
+	}
+	notResumable := func(reason string) events.LambdaFunctionURLResponse {
+		return jsonResp(http.StatusConflict, codedError(i18n.JobNotResumable, fmt.Sprintf("job %q cannot be resumed: %s", id, reason), map[string]string{"job": id}))
+	}
+	cp := rec.Checkpoint
+	switch {
+	case cp == nil:
+		return notResumable("it was not run in resumable phases")
+	case !slices.Contains([]string{phaseProved, phaseBroadcast}, cp.Phase):
+		return notResumable("it is " + cp.Phase)
+	}
+	// A run is bounded by JOB_TIMEOUT, so one that has not written for that long is gone.
+	if j, ok := jobRegistry.Get(id, caller); (ok && j.Status != jobs.StatusDone) ||
+		(rec.Job.Status != jobs.StatusDone && clk.Now().Sub(cp.UpdatedAt) < cfgEnv.JobTimeout) {
+		return notResumable("it is still running")
+	}
+	var tx []byte
+	if cp.Phase == phaseProved {
+		getCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+		defer cancel()
+		var err error
+		if tx, err = cfgEnv.store.Get(getCtx, transactionKey(id)); err != nil {
+			return notResumable("its transaction is gone: " + err.Error())
+		}
+	}
+
+	bill := cp.Phase == phaseProved || rec.Job.Status != jobs.StatusDone
+	r := &resumable{cfgEnv: cfgEnv, rec: rec}
+	r.rec.Job.Status, r.rec.Job.FinishedAt, r.rec.Job.Result = jobs.StatusRunning, nil, nil
+	r.save(ctx, cp.Phase)
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfgEnv.JobTimeout)
+	spec := jobs.Spec{ID: id, Owner: caller, Key: "resume", Tags: rec.Job.Tags, OnFinish: func(j jobs.Job) { r.finish(ctx, j) }}
+	jobRegistry.Start(jobCtx, spec, func(ctx context.Context, stdout, _ io.Writer) any {
+		defer cancel()
+		return r.resume(ctx, tx, bill, stdout)
+	})
+	job, _ := jobRegistry.Get(id, caller)
+	resp := jsonResp(http.StatusAccepted, job)
+	resp.Headers["Location"] = "/jobs/" + id
+	return resp
+}
+
+// resume runs the phases r's checkpoint has left: broadcasting tx, when set, and
+// waiting for confirmation. bill records the fee in usage.
+func (r *resumable) resume(ctx context.Context, tx []byte, bill bool, stdout io.Writer) Response {
+	start := clk.Now()
+	cp := r.rec.Checkpoint
+	payload := Response{Meta: map[string]string{"resumedFrom": cp.Phase, "endpoint": cp.Endpoint}}
+	fmt.Fprintf(stdout, "resuming from %s\n", cp.Phase)
+	if cp.Phase == phaseProved {
+		id, err := r.send(ctx, tx)
+		if err != nil {
+			payload.ExitCode = 1
+			payload.Meta["broadcastError"] = err.Error()
+			payload.Duration = clk.Now().Sub(start).Seconds()
+			return payload
+		}
+		fmt.Fprintf(stdout, "broadcast %s\n", id)
+	}
+	// The fee is billed once the transaction is known to be sent, unless the first run
+	// finished after sending it and was billed then.
+	if bill {
+		used := usage.Run{OK: true, Duration: clk.Now().Sub(r.rec.Job.CreatedAt), Fee: cp.Fee}
+		if err := r.cfgEnv.usage().Record(r.rec.Owner, clk.Now(), used); err != nil {
+			payload.Meta["usageError"] = err.Error()
+		}
+		recordRollup(ctx, r.cfgEnv, cp.Program, clk.Now(), used, payload.Meta)
+	}
+	payload.Meta["transactionId"] = cp.TransactionID
+	link := network.Link{TxID: cp.TransactionID, Network: cp.Network, Program: cp.Program}
+	if u := link.Render(r.cfgEnv.networks.Explorer(cp.Network)); u != "" {
+		payload.Meta["explorerUrl"] = u
+	}
+	if cp.Confirm {
+		confirmed, err := confirmTransaction(ctx, time.Duration(cp.ConfirmTimeoutSeconds)*time.Second, cp.Endpoint, cp.Network, cp.TransactionID)
+		payload.Meta["confirmed"] = strconv.FormatBool(err == nil)
+		if err != nil {
+			payload.Meta["confirmError"] = err.Error()
+			payload.warn(warnings.NotConfirmed, "transaction "+cp.TransactionID+" was broadcast but not confirmed: "+err.Error())
+			payload.Duration = clk.Now().Sub(start).Seconds()
+			return payload
+		}
+		if status, events, err := network.ParseEvents(confirmed); err != nil {
+			payload.Meta["eventsError"] = err.Error()
+		} else {
+			payload.Meta["transactionStatus"] = status
+			payload.Events = events
+		}
+	}
+	r.save(ctx, phaseDone)
+	payload.Duration = clk.Now().Sub(start).Seconds()
+	return payload
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/rollup"
+	"github.com/debendraoli/leo-lambda/pkg/usage"
+)
+
+// statsDays is the window GET /stats covers by default and /capabilities reports.
+const statsDays = 7
+
+// recordRollup adds a run of contract to its ROLLUP_TABLE rollup. A failed write is
+// reported in meta as rollupError; the run itself stands.
+func recordRollup(ctx context.Context, cfgEnv *EnvConfig, contract string, at time.Time, used usage.Run, meta map[string]string) {
+	if cfgEnv.rollups == nil || contract == "" {
+		return
+	}
+	if err := cfgEnv.rollups.Record(ctx, contract, at, rollup.Run(used)); err != nil {
+		meta["rollupError"] = err.Error()
+	}
+}
+
+// contractStats returns the daily rollups of the statsDays UTC days ending today.
+func contractStats(ctx context.Context, cfgEnv *EnvConfig) ([]rollup.Day, error) {
+	to := clk.Now().UTC()
+	return cfgEnv.rollups.Days(ctx, to.AddDate(0, 0, 1-statsDays), to)
+}
+
+// statsResp answers GET /stats: per-contract totals and daily rollups for the last
+// days UTC days (default 7, at most 31), optionally only for one contract.
+func statsResp(ctx context.Context, cfgEnv *EnvConfig, rawQuery string) events.LambdaFunctionURLResponse {
+	if cfgEnv.rollups == nil {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "contract stats are not enabled (set ROLLUP_TABLE)"})
+	}
+	q, _ := url.ParseQuery(rawQuery)
+	n := statsDays
+	if v := q.Get("days"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 || n > rollup.MaxDays {
+			return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, "days must be a number from 1 to "+strconv.Itoa(rollup.MaxDays), nil))
+		}
+	}
+	var contracts []string
+	if c := q.Get("contract"); c != "" {
+		contracts = append(contracts, c)
+	}
+	to := clk.Now().UTC()
+	from := to.AddDate(0, 0, 1-n)
+	days, err := cfgEnv.rollups.Days(ctx, from, to, contracts...)
+	if err != nil {
+		return jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, err.Error(), nil))
+	}
+	return jsonResp(http.StatusOK, map[string]any{
+		"from":      from.Format(time.DateOnly),
+		"to":        to.Format(time.DateOnly),
+		"contracts": rollup.ByContract(days),
+		"days":      days,
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+)
+
+// resultSuffix ends the key of a result written next to its manifest.
+const resultSuffix = ".result.json"
+
+// s3Result is the object written for each manifest run.
+type s3Result struct {
+	// Manifest is the s3:// URL of the manifest that was run.
+	Manifest string `json:"manifest"`
+	// Status is the HTTP status the request got; Response is its body.
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// isS3 reports whether raw is an S3 event notification.
+func isS3(raw json.RawMessage) bool {
+	var ev struct {
+		Records []struct {
+			EventSource string `json:"eventSource"`
+		} `json:"Records"`
+	}
+	return json.Unmarshal(raw, &ev) == nil && len(ev.Records) > 0 && ev.Records[0].EventSource == "aws:s3"
+}
+
+// resultKey returns where the result of the manifest at key is written: under
+// MANIFEST_RESULTS_PREFIX when it is set, else next to the manifest, with .json
+// replaced by resultSuffix. ok is false for a key that is itself a result, so a result
+// written to the watched bucket does not run again.
+func resultKey(cfgEnv *EnvConfig, key string) (string, bool) {
+	if strings.HasSuffix(key, resultSuffix) || (cfgEnv.ManifestResults != "" && strings.HasPrefix(key, cfgEnv.ManifestResults)) {
+		return "", false
+	}
+	if cfgEnv.ManifestResults != "" {
+		return cfgEnv.ManifestResults + key, true
+	}
+	return strings.TrimSuffix(key, ".json") + resultSuffix, true
+}
+
+// handleS3 runs each uploaded object, a manifest holding an InvokeRequest, as caller
+// "s3:<bucket>" and writes the outcome to the same bucket at resultKey. Failures, of
+// the run or of reading and writing objects, are logged rather than returned: Lambda
+// would retry the invocation and run it again.
+func handleS3(ctx context.Context, ev events.S3Event) {
+	cfgEnv, err := currentConfig()
+	if err != nil {
+		logWarn("s3 manifests not run", map[string]string{"error": err.Error()})
+		return
+	}
+	aws, err := awsapi.NewFromEnv()
+	if err != nil {
+		logWarn("s3 manifests not run", map[string]string{"error": err.Error()})
+		return
+	}
+	for _, r := range ev.Records {
+		bucket, key := r.S3.Bucket.Name, r.S3.Object.URLDecodedKey
+		out, ok := resultKey(cfgEnv, key)
+		if !ok {
+			continue
+		}
+		resp, err := runManifest(ctx, aws, bucket, key, out)
+		if err != nil {
+			logWarn("s3 manifest failed", map[string]string{"bucket": bucket, "key": key, "error": err.Error()})
+			continue
+		}
+		if fields := runFailure(resp); fields != nil {
+			fields["bucket"], fields["key"] = bucket, key
+			logWarn("s3 manifest failed", fields)
+		}
+	}
+}
+
+// runManifest runs the manifest at bucket/key and writes its result, failed or not,
+// to bucket/out.
+func runManifest(ctx context.Context, aws *awsapi.Client, bucket, key, out string) (events.LambdaFunctionURLResponse, error) {
+	manifest, err := aws.GetObject(ctx, bucket, key)
+	if err != nil {
+		return events.LambdaFunctionURLResponse{}, fmt.Errorf("read manifest: %w", err)
+	}
+	resp, err := runEventBody(ctx, "s3:"+bucket, string(manifest))
+	if err != nil {
+		return resp, err
+	}
+	body, _ := json.Marshal(s3Result{Manifest: "s3://" + bucket + "/" + key, Status: resp.StatusCode, Response: responseBody(resp)})
+	if err := aws.PutObject(ctx, bucket, out, body, "application/json"); err != nil {
+		return resp, fmt.Errorf("write result: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/jobs"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+	"github.com/debendraoli/leo-lambda/pkg/request"
+	"github.com/debendraoli/leo-lambda/pkg/saga"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// sagaConfirmTimeout bounds the wait for one saga transaction to be final. A saga whose
+// transaction is still unconfirmed by then stalls and can be resumed.
+var sagaConfirmTimeout = 5 * time.Minute
+
+// sagaAction starts the saga params.steps, or resumes the stalled saga params.resume,
+// as a job and answers 202 with it for GET /jobs/{id}. Each step is an execute the
+// caller could have sent themselves, run through the usual policies, quotas and fee
+// handling; the next step starts only once its transaction is accepted. Progress is
+// kept with the job in STORE after every transition, so a saga survives its container.
+func sagaAction(ctx context.Context, cfgEnv *EnvConfig, who principal, body request.InvokeRequest) events.LambdaFunctionURLResponse {
+	if cfgEnv.store == nil {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": "sagas are not enabled (set STORE)"})
+	}
+	if id, _ := body.Params["resume"].(string); id != "" {
+		return resumeSaga(ctx, cfgEnv, who, id)
+	}
+	raw, _ := json.Marshal(body.Params["steps"])
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var steps []saga.Step
+	if err := dec.Decode(&steps); err != nil {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.steps must list steps with name, args and optionally compensate"})
+	}
+	if err := saga.Validate(steps); err != nil {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": "params.steps: " + err.Error()})
+	}
+	for _, s := range steps {
+		for _, args := range [][]string{s.Args, s.Compensate} {
+			if err := checkSagaArgs(args); err != nil {
+				return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("params.steps: step %q: %v", s.Name, err)})
+			}
+		}
+	}
+	now := clk.Now().UTC()
+	rec := storedJobRecord{
+		Owner: who.id,
+		Job:   jobs.Job{ID: randomID(), Status: jobs.StatusRunning, Tags: body.Tags, CreatedAt: now},
+		Saga:  saga.New(steps, now),
+	}
+	return startSaga(ctx, cfgEnv, who, rec)
+}
+
+// checkSagaArgs accepts the args of a step or compensation, nil standing for none. Steps
+// are persisted, so they may not carry private keys; those are injected per run.
+func checkSagaArgs(args []string) error {
+	if args == nil {
+		return nil
+	}
+	switch sub, _ := utils.FirstSubcommand(args); {
+	case sub != "execute":
+		return fmt.Errorf("only execute can run in a saga, not %q", sub)
+	case utils.GetFlagValue(args, "--network") == "":
+		return fmt.Errorf("--network is required to confirm the transaction")
+	case utils.HasAnyFlag(args, utils.SecretFlags...):
+		return fmt.Errorf("private keys cannot be passed, as saga steps are persisted")
+	}
+	return nil
+}
+
+// resumeSaga picks up saga id where it stalled. A saga that is final, or that may still
+// be running on some container, is left alone.
+func resumeSaga(ctx context.Context, cfgEnv *EnvConfig, who principal, id string) events.LambdaFunctionURLResponse {
+	rec, ok := loadJobRecord(ctx, cfgEnv, id)
+	if !ok || rec.Owner != who.id || rec.Saga == nil {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("saga %q not found", id)})
+	}
+	if rec.Saga.Final() {
+		return jsonResp(http.StatusConflict, map[string]string{"error": fmt.Sprintf("saga %q is already %s", id, rec.Saga.Status)})
+	}
+	// A run is bounded by JOB_TIMEOUT, so one that has not written for that long is gone.
+	if j, ok := jobRegistry.Get(id, who.id); (ok && j.Status != jobs.StatusDone) ||
+		(rec.Job.Status != jobs.StatusDone && clk.Now().Sub(rec.Saga.UpdatedAt) < cfgEnv.JobTimeout) {
+		return jsonResp(http.StatusConflict, map[string]string{"error": fmt.Sprintf("saga %q is still running", id)})
+	}
+	rec.Job.Status, rec.Job.FinishedAt, rec.Job.Result = jobs.StatusRunning, nil, nil
+	return startSaga(ctx, cfgEnv, who, rec)
+}
+
+// startSaga records rec and runs its saga in a job that outlives the request.
+func startSaga(ctx context.Context, cfgEnv *EnvConfig, who principal, rec storedJobRecord) events.LambdaFunctionURLResponse {
+	rec.Saga.UpdatedAt = clk.Now().UTC()
+	if err := putJobRecord(ctx, cfgEnv, rec, cfgEnv.JobTimeout+cfgEnv.jobTTL()); err != nil {
+		return jsonResp(http.StatusServiceUnavailable, map[string]string{"error": fmt.Sprintf("failed to record saga: %v", err)})
+	}
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfgEnv.JobTimeout)
+	spec := jobs.Spec{ID: rec.Job.ID, Owner: who.id, Key: "saga", Tags: rec.Job.Tags, OnFinish: func(j jobs.Job) {
+		rec.Job = j
+		if err := putJobRecord(ctx, cfgEnv, rec, cfgEnv.jobTTL()); err != nil {
+			logWarn("store write failed", map[string]string{"key": "jobs/" + j.ID, "error": err.Error()})
+		}
+	}}
+	id := jobRegistry.Start(jobCtx, spec, func(ctx context.Context, stdout, _ io.Writer) any {
+		defer cancel()
+		runSaga(ctx, cfgEnv, who, &rec, stdout)
+		return rec.Saga
+	})
+	job, _ := jobRegistry.Get(id, who.id)
+	resp := jsonResp(http.StatusAccepted, job)
+	resp.Headers["Location"] = "/jobs/" + id
+	return resp
+}
+
+// runSaga performs rec's saga until it is final or stalls, persisting every transition
+// and logging it to stdout.
+func runSaga(ctx context.Context, cfgEnv *EnvConfig, who principal, rec *storedJobRecord, stdout io.Writer) {
+	s := rec.Saga
+	for {
+		a, ok := s.Next()
+		if !ok {
+			return
+		}
+		o := sagaStep(ctx, cfgEnv, who, rec, a)
+		if err := s.Record(a, o, clk.Now()); err != nil {
+			return
+		}
+		p := s.Progress[a.Index]
+		state := string(p.Status)
+		if o.Pending {
+			state = "stalled: " + o.Err
+		}
+		verb := "step"
+		if a.Compensate {
+			verb = "compensation of"
+		}
+		fmt.Fprintf(stdout, "%s %s %s: %s\n", s.UpdatedAt.Format(time.RFC3339), verb, p.Name, state)
+		if err := putJobRecord(ctx, cfgEnv, *rec, cfgEnv.JobTimeout+cfgEnv.jobTTL()); err != nil {
+			logWarn("store write failed", map[string]string{"key": "jobs/" + rec.Job.ID, "error": err.Error()})
+		}
+		if o.Pending {
+			return
+		}
+	}
+}
+
+// sagaStep sends the transaction of a, unless a resumed saga already sent it, and waits
+// for it to be final. A request that was throttled or hit an unavailable endpoint, and a
+// transaction that is not final in time, leave the outcome pending rather than failed.
+func sagaStep(ctx context.Context, cfgEnv *EnvConfig, who principal, rec *storedJobRecord, a saga.Action) saga.Outcome {
+	step := rec.Saga.Steps[a.Index]
+	args := step.Args
+	if a.Compensate {
+		args = step.Compensate
+	}
+	net := utils.GetFlagValue(args, "--network")
+	preset, _ := cfgEnv.networks.Lookup(net)
+	endpoint := cmp.Or(utils.GetFlagValue(args, "--endpoint"), preset.Endpoint, cfgEnv.EndPoint)
+	tx := a.TransactionID
+	if tx == "" {
+		// The step's own runs are tagged with the saga so they can be found in the
+		// journal and job list.
+		tags := map[string]string{"saga": rec.Job.ID, "sagaStep": step.Name}
+		if a.Compensate {
+			tags["sagaStep"] += ":compensate"
+		}
+		body, _ := json.Marshal(request.InvokeRequest{Args: args, Tags: tags})
+		r := events.LambdaFunctionURLRequest{RawPath: "/", Body: string(body)}
+		r.RequestContext.HTTP.Method = http.MethodPost
+		r.RequestContext.HTTP.Path = "/"
+		caller := principal{id: who.id, authKey: who.authKey, groups: who.groups}
+		resp, err := handler(context.WithValue(ctx, gatewayCaller{}, caller), r)
+		if err != nil {
+			return saga.Outcome{Err: err.Error()}
+		}
+		var out struct {
+			Response
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal([]byte(resp.Body), &out)
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			return saga.Outcome{Err: fmt.Sprintf("not sent (%d): %s", resp.StatusCode, out.Error), Pending: true}
+		case resp.StatusCode != http.StatusOK:
+			return saga.Outcome{Err: fmt.Sprintf("refused (%d): %s", resp.StatusCode, out.Error)}
+		case out.ExitCode != 0:
+			return saga.Outcome{Err: fmt.Sprintf("leo exited %d", out.ExitCode)}
+		case out.Meta["transactionId"] == "":
+			return saga.Outcome{Err: "no transaction was broadcast"}
+		}
+		tx, endpoint = out.Meta["transactionId"], cmp.Or(out.Meta["endpoint"], endpoint)
+	}
+	confirmed, err := confirmTransaction(ctx, sagaConfirmTimeout, endpoint, net, tx)
+	if err != nil {
+		return saga.Outcome{TransactionID: tx, Err: err.Error(), Pending: true}
+	}
+	status, _, err := network.ParseEvents(confirmed)
+	switch {
+	case err != nil:
+		return saga.Outcome{TransactionID: tx, Err: err.Error(), Pending: true}
+	case status != "accepted":
+		return saga.Outcome{TransactionID: tx, Err: "transaction " + status}
+	}
+	return saga.Outcome{TransactionID: tx}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/executor"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/scaffold"
+)
+
+// maxInlineArchiveBytes returns the largest project archive returned in a response of
+// the transport serving ctx; its base64 encoding needs no further escaping.
+func maxInlineArchiveBytes(ctx context.Context) int {
+	limit := responseLimitFor(ctx)
+	return (limit - min(responseHeadroom, limit/8)) / 4 * 3
+}
+
+// scaffoldAction generates a project with leo new params.name in a workspace of its
+// own, renders params.template over it with params.params and returns the project as a
+// gzipped tarball: inline as base64, or in OUTPUT_BUCKET with params.output "s3". Without
+// params.output the archive is returned inline when it fits. The command allowlist and
+// the caller's rate limit apply, as for a run of leo new.
+func scaffoldAction(ctx context.Context, cfgEnv *EnvConfig, caller string, params map[string]any) events.LambdaFunctionURLResponse {
+	name, _ := params["name"].(string)
+	if !scaffold.ValidName(name) {
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, "params.name must be a program name: a lowercase letter, then lowercase letters, digits and underscores", nil))
+	}
+	tmpl, err := stringMap(params, "template")
+	if err != nil {
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, err.Error(), nil))
+	}
+	values, err := stringMap(params, "params")
+	if err != nil {
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, err.Error(), nil))
+	}
+	output, _ := params["output"].(string)
+	switch output {
+	case "", "inline":
+	case "s3":
+		if cfgEnv.OutputBucket == "" {
+			return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, `params.output "s3" needs OUTPUT_BUCKET`, nil))
+		}
+	default:
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, `params.output must be "inline" or "s3"`, nil))
+	}
+	if len(cfgEnv.AllowedCommands) > 0 && !slices.ContainsFunc(cfgEnv.AllowedCommands, func(s string) bool {
+		return strings.EqualFold(strings.TrimSpace(s), "new")
+	}) {
+		return jsonResp(http.StatusForbidden, codedError(i18n.CommandNotAllowed, `command "new" not allowed`, map[string]string{"command": "new"}))
+	}
+
+	release, err := quotas.Acquire(caller)
+	if err != nil {
+		return quotaExceeded(caller, err)
+	}
+	defer release()
+	// The workspace is always ephemeral, whatever WORKDIR says: nothing of one
+	// caller's project may be seen by the next.
+	workdir, err := os.MkdirTemp(cfgEnv.WorkdirRoot, "scaffold-")
+	if err != nil {
+		return jsonResp(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	defer os.RemoveAll(workdir)
+
+	bin := cfgEnv.LeoBin
+	if cfgEnv.DryRun {
+		bin = "echo"
+	}
+	res := runCommand(ctx, executor.Config{
+		BinPath:        bin,
+		Args:           []string{"new", name},
+		WorkDir:        workdir,
+		WorkRoot:       cfgEnv.WorkdirRoot,
+		MaxOutputBytes: cfgEnv.outputCap(false),
+		Clock:          clk,
+	})
+	if res.ExitCode != 0 {
+		return jsonResp(http.StatusUnprocessableEntity, map[string]any{"error": "leo new failed", "exitCode": res.ExitCode, "stderr": res.Stderr})
+	}
+	project := filepath.Join(workdir, name)
+	if cfgEnv.DryRun {
+		_ = os.MkdirAll(project, 0o755)
+	}
+	if fi, err := os.Stat(project); err != nil || !fi.IsDir() {
+		return jsonResp(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("leo new did not create %s", name)})
+	}
+	rendered, err := scaffold.Render(project, tmpl, values)
+	if err != nil {
+		return jsonResp(http.StatusBadRequest, codedError(i18n.InvalidRequest, err.Error(), nil))
+	}
+	// leo new may write a private key to .env; it only leaves with the project when the
+	// template supplies its own.
+	var skip []string
+	if _, ok := tmpl[".env"]; !ok {
+		skip = []string{".env"}
+	}
+	var archive bytes.Buffer
+	files, err := scaffold.Pack(&archive, project, name, skip, maxFullOutputBytes)
+	if errors.Is(err, scaffold.ErrTooLarge) {
+		return jsonResp(http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return jsonResp(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	out := map[string]any{"name": name, "files": files, "rendered": rendered, "bytes": archive.Len(), "encoding": "tar+gzip"}
+	inlineLimit := maxInlineArchiveBytes(ctx)
+	if output == "" && archive.Len() > inlineLimit {
+		if cfgEnv.OutputBucket == "" {
+			return jsonResp(http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("project archive is %d bytes, too large to return inline; set OUTPUT_BUCKET", archive.Len())})
+		}
+		output = "s3"
+	}
+	if output == "s3" {
+		key := outputPrefix(ctx, cfgEnv) + "/" + name + ".tar.gz"
+		if err := cfgEnv.s3.PutObject(ctx, cfgEnv.OutputBucket, key, archive.Bytes(), "application/gzip"); err != nil {
+			return jsonResp(http.StatusBadGateway, map[string]string{"error": fmt.Sprintf("upload archive: %v", err)})
+		}
+		out["object"] = "s3://" + cfgEnv.OutputBucket + "/" + key
+		return jsonResp(http.StatusOK, out)
+	}
+	if archive.Len() > inlineLimit {
+		return jsonResp(http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("project archive is %d bytes, too large to return inline", archive.Len())})
+	}
+	out["archive"] = base64.StdEncoding.EncodeToString(archive.Bytes())
+	return jsonResp(http.StatusOK, out)
+}
+
+// stringMap returns params[key], an optional object of strings.
+func stringMap(params map[string]any, key string) (map[string]string, error) {
+	raw, ok := params[key]
+	if !ok {
+		return nil, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("params.%s must be an object of strings", key)
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("params.%s.%s must be a string", key, k)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/schedule"
+)
+
+// internalCaller is the context key carrying the caller of a request the function makes
+// to itself; authenticate trusts it as is.
+type internalCaller struct{}
+
+// runSchedules runs the SCHEDULES entries due in the current minute, each through the
+// Function URL handler as "schedule:<name>" so the usual policies, quotas and journal
+// apply. It is meant to be ticked once a minute by an EventBridge rule with the input
+// {"task": "schedules"}. A schedule whose previous run is still going in this container
+// is skipped rather than started twice.
+func runSchedules(ctx context.Context, cfgEnv *EnvConfig) (map[string]any, error) {
+	now := clk.Now().UTC().Truncate(time.Minute)
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		ran = map[string]schedule.Run{}
+	)
+	// Jitter is drawn for every due schedule before any run starts, so a seeded rng gives
+	// the same delays however the runs then consume randomness.
+	delays := map[string]time.Duration{}
+	for _, s := range cfgEnv.schedules {
+		if s.Due(now) {
+			delays[s.Name] = s.Delay(rng)
+		}
+	}
+	for _, s := range cfgEnv.schedules {
+		delay, ok := delays[s.Name]
+		if !ok {
+			continue
+		}
+		wg.Go(func() {
+			r := runSchedule(ctx, s, delay)
+			scheduleRuns.Record(s.Name, r)
+			mu.Lock()
+			ran[s.Name] = r
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return map[string]any{"minute": now, "runs": ran}, nil
+}
+
+// runSchedule waits out delay, the schedule's jitter, and invokes its preset.
+func runSchedule(ctx context.Context, s schedule.Schedule, delay time.Duration) schedule.Run {
+	r := schedule.Run{Started: clk.Now().UTC()}
+	if err := scheduleRuns.Begin(s.Name); err != nil {
+		r.Skipped = err.Error()
+		return r
+	}
+	defer scheduleRuns.End(s.Name)
+	if delay > 0 {
+		select {
+		case <-clk.After(delay):
+		case <-ctx.Done():
+			r.Skipped = ctx.Err().Error()
+			return r
+		}
+	}
+
+	q := url.Values{"preset": {s.Preset}, "tag": {"schedule:" + s.Name}}
+	for k, v := range s.Params {
+		q.Set(k, v)
+	}
+	req := events.LambdaFunctionURLRequest{RawPath: "/", RawQueryString: q.Encode()}
+	req.RequestContext.HTTP.Method = http.MethodPost
+	req.RequestContext.HTTP.Path = "/"
+
+	r.Started = clk.Now().UTC()
+	resp, err := handler(context.WithValue(ctx, internalCaller{}, "schedule:"+s.Name), req)
+	r.Duration = clk.Now().Sub(r.Started).Seconds()
+	if err != nil {
+		r.Status, r.Error = http.StatusInternalServerError, err.Error()
+		return r
+	}
+	r.Status = resp.StatusCode
+	var out struct {
+		ExitCode int `json:"exitCode"`
+	}
+	if json.Unmarshal([]byte(resp.Body), &out) == nil {
+		r.ExitCode = out.ExitCode
+	}
+	return r
+}
+
+// schedulesAction reports the configured schedules and this container's recent runs.
+func schedulesAction(cfgEnv *EnvConfig) events.LambdaFunctionURLResponse {
+	list := cfgEnv.schedules
+	if list == nil {
+		list = []schedule.Schedule{}
+	}
+	return jsonResp(http.StatusOK, map[string]any{"schedules": list, "history": scheduleRuns.History()})
+}
@@ -0,0 +1,116 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+
+	"github.com/debendraoli/leo-lambda/pkg/allowlist"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// Capabilities are the limits the Lambda checks every request against, as reported by
+// GET /capabilities.
+type Capabilities struct {
+	// Commands are the allowed leo subcommands; empty allows any.
+	Commands []string `json:"commands"`
+	// Contracts are the allowed contracts and contract patterns, such as vlink_*.aleo;
+	// empty allows any.
+	Contracts []string `json:"contracts"`
+	// MaxFee is the largest --priority-fee in microcredits; 0 is no cap.
+	MaxFee uint64 `json:"maxFee,omitempty"`
+	// Transforms is set when the Lambda rewrites requests before checking them. Check
+	// then accepts every request.
+	Transforms bool `json:"transforms,omitempty"`
+}
+
+// Capabilities fetches what the Lambda allows.
+func (c *Client) Capabilities(ctx context.Context) (*Capabilities, error) {
+	if c == nil {
+		return nil, fmt.Errorf("sdk Client is nil")
+	}
+	var out Capabilities
+	if err := c.getJSON(ctx, "/capabilities", &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// WithCapabilityCheck makes Invoke fetch the Lambda's capabilities on first use and
+// check every request against them, failing with an *InvokeError whose Local is set
+// instead of sending a request that would be refused. While the capabilities cannot be
+// fetched, requests are sent unchecked.
+func WithCapabilityCheck() Option {
+	return func(c *Client) {
+		c.checkCapabilities = true
+	}
+}
+
+// Check returns the *InvokeError the Lambda would answer req with when req breaks the
+// command, contract or fee limits, or nil. Limits that depend on the caller, such as
+// group policies and quotas, are left to the Lambda.
+func (caps *Capabilities) Check(req Request) error {
+	if caps == nil || caps.Transforms {
+		return nil
+	}
+	args := req.Args
+	if len(args) == 0 {
+		parsed, err := shellwords.NewParser().Parse(req.Cmd)
+		if err != nil {
+			return nil
+		}
+		args = parsed
+	}
+	subcmd, _ := utils.FirstSubcommand(args)
+	if subcmd != "" && len(caps.Commands) > 0 && !slices.ContainsFunc(caps.Commands, func(s string) bool { return strings.EqualFold(s, subcmd) }) {
+		return localError(http.StatusForbidden, i18n.CommandNotAllowed, fmt.Sprintf("command %q not allowed", subcmd), map[string]string{"command": subcmd})
+	}
+	if subcmd != "execute" {
+		return nil
+	}
+	fee, _ := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(utils.GetFlagValue(args, "--priority-fee"), "u64")), 10, 64)
+	if caps.MaxFee > 0 && fee > caps.MaxFee {
+		return localError(http.StatusForbidden, i18n.FeeTooHigh, fmt.Sprintf("priority fee %d exceeds MAX_FEE %d", fee, caps.MaxFee),
+			map[string]string{"fee": strconv.FormatUint(fee, 10), "max": strconv.FormatUint(caps.MaxFee, 10)})
+	}
+	if len(caps.Contracts) == 0 {
+		return nil
+	}
+	contract, _ := utils.ExtractExecuteContract(args)
+	rules, err := allowlist.ParseRules(caps.Contracts)
+	if err != nil {
+		return nil
+	}
+	if _, ok := rules.Match(contract); ok {
+		return nil
+	}
+	if contract == "" {
+		return localError(http.StatusBadRequest, i18n.MissingContract, "missing execute contract/method argument", nil)
+	}
+	return localError(http.StatusForbidden, i18n.ContractNotAllowed, fmt.Sprintf("contract %q not allowed", contract), map[string]string{"contract": contract})
+}
+
+// localError is the error the Lambda would have answered with, raised by Check.
+func localError(status int, code, msg string, params map[string]string) *InvokeError {
+	return &InvokeError{StatusCode: status, Message: msg, Code: code, Params: params, Local: true}
+}
+
+// checkRequest checks req against the capabilities, fetching them on first use.
+func (c *Client) checkRequest(ctx context.Context, req Request) error {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.caps == nil {
+		caps, err := c.Capabilities(ctx)
+		if err != nil {
+			return nil
+		}
+		c.caps = caps
+	}
+	return c.caps.Check(req)
+}
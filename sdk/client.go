@@ -3,11 +3,24 @@ package sdk
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/expect"
+	"github.com/debendraoli/leo-lambda/pkg/mixed"
+	"github.com/debendraoli/leo-lambda/pkg/signing"
+)
+
+// Execution profiles accepted in Request.Profile.
+const (
+	ProfileFast     = "fast"
+	ProfileThorough = "thorough"
 )
 
 // Request represents the payload accepted by the Leo Lambda.
@@ -15,6 +28,23 @@ import (
 type Request struct {
 	Args []string `json:"args,omitempty"`
 	Cmd  string   `json:"cmd,omitempty"`
+	// MaxWaitSeconds bounds how long the Lambda blocks before continuing the run as
+	// an async job; see Response.JobID.
+	MaxWaitSeconds int `json:"maxWaitSeconds,omitempty"`
+	// Profile selects an execution profile, ProfileFast or ProfileThorough.
+	Profile string `json:"profile,omitempty"`
+	// Tags label the run (e.g. {"order": "42"}); see Client.Jobs.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Expect declares how mapping entries must change once an execute is confirmed;
+	// see Response.Verified. It needs ProfileThorough or another confirming profile.
+	Expect []expect.Expectation `json:"expect,omitempty"`
+	// OnlyIf lists conditions on mapping entries that must hold for an execute to run;
+	// otherwise Invoke fails with an *InvokeError carrying PreconditionFailed.
+	OnlyIf []expect.Condition `json:"onlyIf,omitempty"`
+
+	// ReadOnly marks the request as safe to hedge across endpoints with
+	// MultiRegionClient. `leo query` and `--version` are detected automatically.
+	ReadOnly bool `json:"-"`
 }
 
 // Response mirrors the Lambda response payload.
@@ -25,12 +55,49 @@ type Response struct {
 	Stderr    string            `json:"stderr"`
 	Truncated bool              `json:"truncated"`
 	Meta      map[string]string `json:"meta"`
+	// Code is the category of a failed run, e.g. "insufficient_balance"; empty on success.
+	Code string `json:"code,omitempty"`
+	// Verified reports whether Request.Expect held; Diffs has one entry per expectation.
+	Verified *bool         `json:"verified,omitempty"`
+	Diffs    []expect.Diff `json:"diffs,omitempty"`
+
+	// JobID is set when the run outlived Request.MaxWaitSeconds. Stdout and Stderr then
+	// hold partial output and the final result must be fetched with Client.Job.
+	JobID string `json:"jobId,omitempty"`
+
+	// Endpoint is the base URL that served the call (set by MultiRegionClient).
+	Endpoint string `json:"-"`
+	// RawBody is the undecoded response body, as covered by Signature.
+	RawBody []byte `json:"-"`
+	// Signature, SignatureAlgorithm and SignatureKeyID carry the detached response
+	// signature when the Lambda has response signing enabled.
+	Signature          string `json:"-"`
+	SignatureAlgorithm string `json:"-"`
+	SignatureKeyID     string `json:"-"`
+	// Deprecation is set when the response announced that the API is deprecated.
+	Deprecation *Deprecation `json:"-"`
+
+	// warnings are the caveats the Lambda reported; see Warnings.
+	warnings []Warning
 }
 
 // Client wraps HTTP interactions with the Lambda endpoint.
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+
+	hedgeDelay       time.Duration
+	failoverCooldown time.Duration
+	verifyKey        crypto.PublicKey
+	hmacClient       string
+	hmacSecret       string
+	onWarning        func(Warning)
+	rawOutput        bool
+
+	// checkCapabilities enables WithCapabilityCheck; caps is the document, once fetched.
+	checkCapabilities bool
+	capsMu            sync.Mutex
+	caps              *Capabilities
 }
 
 // Option customises a new Client.
@@ -45,6 +112,24 @@ func WithHTTPClient(hc *http.Client) Option {
 	}
 }
 
+// WithHMAC signs every request as clientID with secret, for Lambdas configured with
+// HMAC_CLIENTS. During a rotation, switch secret to the new primary while the old one
+// is still accepted as the secondary.
+func WithHMAC(clientID, secret string) Option {
+	return func(c *Client) {
+		c.hmacClient, c.hmacSecret = clientID, secret
+	}
+}
+
+// WithRawOutput asks for responses in parts (multipart/mixed), so Stdout and Stderr
+// arrive as leo wrote them instead of escaped inside JSON. Invoke decodes either form;
+// RawBody is then the multipart body, as covered by Signature.
+func WithRawOutput() Option {
+	return func(c *Client) {
+		c.rawOutput = true
+	}
+}
+
 // New constructs a Client pointed at the given Lambda URL.
 func New(baseURL string, opts ...Option) (*Client, error) {
 	baseURL = strings.TrimSpace(baseURL)
@@ -58,17 +143,41 @@ func New(baseURL string, opts ...Option) (*Client, error) {
 	if cli.httpClient == nil {
 		cli.httpClient = http.DefaultClient
 	}
+	if cli.hmacSecret != "" {
+		hc := *cli.httpClient
+		hc.Transport = &hmacTransport{client: cli.hmacClient, secret: cli.hmacSecret, base: hc.Transport}
+		cli.httpClient = &hc
+	}
 	return cli, nil
 }
 
 // Invoke executes the supplied request against the Lambda endpoint.
 func (c *Client) Invoke(ctx context.Context, req Request) (*Response, error) {
+	var accept string
+	if c != nil && c.rawOutput {
+		accept = mixed.MediaType + ", application/json"
+	}
+	resp, err := c.post(ctx, req, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return c.decode(resp)
+}
+
+// post sends req, asking for the media types in accept when it is not empty.
+func (c *Client) post(ctx context.Context, req Request, accept string) (*http.Response, error) {
 	if c == nil {
 		return nil, fmt.Errorf("sdk Client is nil")
 	}
 	if err := req.validate(); err != nil {
 		return nil, err
 	}
+	if c.checkCapabilities {
+		if err := c.checkRequest(ctx, req); err != nil {
+			return nil, err
+		}
+	}
 	payload, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("encode request: %w", err)
@@ -78,13 +187,19 @@ func (c *Client) Invoke(ctx context.Context, req Request) (*Response, error) {
 		return nil, fmt.Errorf("build request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		httpReq.Header.Set("Accept", accept)
+	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("execute request: %w", err)
 	}
-	defer resp.Body.Close()
+	return resp, nil
+}
 
+// decode reads a buffered response, verifying its signature when a key is set.
+func (c *Client) decode(resp *http.Response) (*Response, error) {
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("read response: %w", err)
@@ -94,13 +209,42 @@ func (c *Client) Invoke(ctx context.Context, req Request) (*Response, error) {
 		return nil, parseError(resp.StatusCode, body)
 	}
 
-	var out Response
-	if err := json.Unmarshal(body, &out); err != nil {
+	out := Response{
+		RawBody:            body,
+		Signature:          resp.Header.Get(signing.HeaderSignature),
+		SignatureAlgorithm: resp.Header.Get(signing.HeaderAlgorithm),
+		SignatureKeyID:     resp.Header.Get(signing.HeaderKeyID),
+		Deprecation:        parseDeprecation(resp.Header),
+	}
+	if c.verifyKey != nil {
+		if err := VerifySignature(c.verifyKey, out.SignatureAlgorithm, body, out.Signature); err != nil {
+			return nil, fmt.Errorf("verify response: %w", err)
+		}
+	}
+	if err := decodeResponse(resp.Header.Get("Content-Type"), body, &out); err != nil {
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
+	c.reportWarnings(&out)
 	return &out, nil
 }
 
+// decodeResponse decodes body into out, from JSON or, when contentType says so, from
+// the parts of a multipart/mixed response.
+func decodeResponse(contentType string, body []byte, out *Response) error {
+	if !strings.HasPrefix(contentType, mixed.MediaType) {
+		return json.Unmarshal(body, out)
+	}
+	p, err := mixed.Decode(contentType, body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(p.Meta, out); err != nil {
+		return err
+	}
+	out.Stdout, out.Stderr = string(p.Stdout), string(p.Stderr)
+	return nil
+}
+
 func (r Request) validate() error {
 	if len(r.Args) == 0 {
 		if strings.TrimSpace(r.Cmd) == "" {
@@ -117,8 +261,21 @@ func (r Request) validate() error {
 // InvokeError captures a non-successful Lambda response.
 type InvokeError struct {
 	StatusCode int
-	Message    string
-	Body       []byte
+	// Message is the English error.
+	Message string
+	// Code identifies the error independent of language, e.g. "contract_not_allowed",
+	// with the Params its message refers to. Errors outside the catalog have none.
+	Code   string
+	Params map[string]string
+	// Localized is the catalog message in the language negotiated from the request's
+	// Accept-Language.
+	Localized string
+	// PreconditionFailed holds the outcome of each Request.OnlyIf condition when one did
+	// not hold (Code "precondition_failed").
+	PreconditionFailed []expect.Outcome
+	Body               []byte
+	// Local is set when WithCapabilityCheck refused the request without sending it.
+	Local bool
 }
 
 // Error implements the error interface.
@@ -126,6 +283,9 @@ func (e *InvokeError) Error() string {
 	if e == nil {
 		return ""
 	}
+	if e.Local {
+		return fmt.Sprintf("request not sent, the lambda would refuse it: %s", e.Message)
+	}
 	if e.Message != "" {
 		return fmt.Sprintf("lambda responded with status %d: %s", e.StatusCode, e.Message)
 	}
@@ -134,10 +294,16 @@ func (e *InvokeError) Error() string {
 
 func parseError(status int, body []byte) error {
 	var payload struct {
-		Error string `json:"error"`
+		Error   string            `json:"error"`
+		Code    string            `json:"code"`
+		Params  map[string]string `json:"params"`
+		Message string            `json:"message"`
+		// PreconditionFailed is set on 412 responses.
+		PreconditionFailed []expect.Outcome `json:"preconditionFailed"`
 	}
 	if err := json.Unmarshal(body, &payload); err == nil && strings.TrimSpace(payload.Error) != "" {
-		return &InvokeError{StatusCode: status, Message: payload.Error, Body: body}
+		return &InvokeError{StatusCode: status, Message: payload.Error, Code: payload.Code, Params: payload.Params, Localized: payload.Message,
+			PreconditionFailed: payload.PreconditionFailed, Body: body}
 	}
 	trimmed := strings.TrimSpace(string(body))
 	return &InvokeError{StatusCode: status, Message: trimmed, Body: body}
@@ -2,10 +2,23 @@ package sdk
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/expect"
+	"github.com/debendraoli/leo-lambda/pkg/hmacauth"
+	"github.com/debendraoli/leo-lambda/pkg/mixed"
+	"github.com/debendraoli/leo-lambda/pkg/stream"
 )
 
 func TestNewClientValidation(t *testing.T) {
@@ -45,10 +58,88 @@ func TestInvokeWithArgs(t *testing.T) {
 	}
 }
 
+func TestInvokeRawOutput(t *testing.T) {
+	stdout := "{\"transactionId\": \"at1\"}\n\x1b[32mdone\x1b[0m\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !mixed.Accepts(r.Header.Get("Accept")) {
+			t.Fatalf("expected multipart/mixed to be accepted, got %q", r.Header.Get("Accept"))
+		}
+		body, _ := json.Marshal(map[string]any{"exitCode": 0, "stdout": stdout, "meta": map[string]string{"transactionId": "at1"}})
+		contentType, out, err := mixed.Encode(body)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(out)
+	}))
+	defer server.Close()
+
+	client, _ := New(server.URL, WithRawOutput())
+	res, err := client.Invoke(context.Background(), Request{Args: []string{"execute", "token.aleo/mint"}})
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if res.Stdout != stdout || res.Meta["transactionId"] != "at1" {
+		t.Fatalf("unexpected response %+v", res)
+	}
+}
+
+func TestInvokeStream(t *testing.T) {
+	exitCode := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !stream.Accepts(r.Header.Get("Accept")) {
+			t.Fatalf("expected a stream to be accepted, got %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", stream.MediaType)
+		sw := stream.NewWriter(w)
+		_ = sw.Line(stream.Stdout, "compiling")
+		_ = sw.Line(stream.Stderr, "slow endpoint")
+		if exitCode < 0 {
+			// The function timed out before the trailer.
+			return
+		}
+		status := http.StatusOK
+		body, _ := json.Marshal(map[string]any{"exitCode": exitCode, "duration": 61.5, "meta": map[string]string{"transactionId": "at1"}, "warnings": []Warning{{Code: "output_truncated", Message: "cut"}}})
+		if exitCode > 0 {
+			status = http.StatusServiceUnavailable
+			body = []byte(`{"error": "endpoint unavailable", "code": "endpoint_unavailable"}`)
+		}
+		_ = sw.Trailer(status, body)
+	}))
+	defer server.Close()
+
+	client, _ := New(server.URL)
+	var lines []string
+	res, err := client.InvokeStream(context.Background(), Request{Args: []string{"execute", "token.aleo/mint"}}, func(s, line string) {
+		lines = append(lines, s+": "+line)
+	})
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if len(lines) != 2 || lines[1] != "stderr: slow endpoint" {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if res.Stdout != "compiling\n" || res.Stderr != "slow endpoint\n" || res.Duration != 61.5 || res.Meta["transactionId"] != "at1" || len(res.Warnings()) != 1 {
+		t.Fatalf("unexpected response %+v", res)
+	}
+
+	exitCode = 1
+	var ierr *InvokeError
+	if _, err := client.InvokeStream(context.Background(), Request{Args: []string{"execute", "token.aleo/mint"}}, nil); !errors.As(err, &ierr) || ierr.StatusCode != http.StatusServiceUnavailable || ierr.Code != "endpoint_unavailable" {
+		t.Fatalf("expected the trailer's error, got %v", err)
+	}
+
+	exitCode = -1
+	res, err = client.InvokeStream(context.Background(), Request{Args: []string{"execute", "token.aleo/mint"}}, nil)
+	if !errors.Is(err, stream.ErrNoTrailer) || res == nil || res.Stdout != "compiling\n" {
+		t.Fatalf("expected the output so far and ErrNoTrailer, got %+v %v", res, err)
+	}
+}
+
 func TestInvokeErrorResponse(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusForbidden)
-		_ = json.NewEncoder(w).Encode(map[string]string{"error": "not allowed"})
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": "not allowed", "code": "contract_not_allowed", "params": map[string]string{"contract": "x.aleo"}, "message": "Das Programm x.aleo ist nicht erlaubt."})
 	}))
 	defer server.Close()
 
@@ -71,6 +162,27 @@ func TestInvokeErrorResponse(t *testing.T) {
 	if invokeErr.Message != "not allowed" {
 		t.Fatalf("unexpected message: %q", invokeErr.Message)
 	}
+	if invokeErr.Code != "contract_not_allowed" || invokeErr.Params["contract"] != "x.aleo" || invokeErr.Localized == "" {
+		t.Fatalf("unexpected code %q params %v localized %q", invokeErr.Code, invokeErr.Params, invokeErr.Localized)
+	}
+}
+
+func TestInvokePreconditionFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		_, _ = io.WriteString(w, `{"error": "a precondition does not hold; leo was not run", "code": "precondition_failed",
+			"preconditionFailed": [{"program": "token.aleo", "mapping": "paused", "key": "0u8", "value": "true", "want": "false", "ok": false}]}`)
+	}))
+	defer server.Close()
+	client, _ := New(server.URL)
+	_, err := client.Invoke(context.Background(), Request{
+		Args:   []string{"execute", "token.aleo/mint_public", "aleo1abc", "5u64"},
+		OnlyIf: []expect.Condition{{Mapping: "paused", Key: "0u8", Equals: "false"}},
+	})
+	var ie *InvokeError
+	if !errors.As(err, &ie) || ie.Code != "precondition_failed" || len(ie.PreconditionFailed) != 1 || *ie.PreconditionFailed[0].Value != "true" {
+		t.Fatalf("unexpected %v", err)
+	}
 }
 
 func TestInvokeValidationFails(t *testing.T) {
@@ -85,3 +197,214 @@ func TestInvokeValidationFails(t *testing.T) {
 		t.Fatalf("expected mutually exclusive validation error")
 	}
 }
+
+func TestInvokeVerifiesSignature(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tamper := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := []byte(`{"exitCode":0,"stdout":"ok"}`)
+		digest := sha256.Sum256(body)
+		sig, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		w.Header().Set("X-Leo-Signature", base64.StdEncoding.EncodeToString(sig))
+		w.Header().Set("X-Leo-Signature-Algorithm", "ECDSA_SHA_256")
+		if tamper {
+			body = []byte(`{"exitCode":0,"stdout":"evil"}`)
+		}
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	client, err := New(server.URL, WithVerificationKey(&key.PublicKey))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	res, err := client.Invoke(context.Background(), Request{Cmd: "execute a.aleo/b"})
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if res.Signature == "" || res.Stdout != "ok" {
+		t.Fatalf("unexpected response: %+v", res)
+	}
+	tamper = true
+	if _, err := client.Invoke(context.Background(), Request{Cmd: "execute a.aleo/b"}); err == nil {
+		t.Fatalf("expected verification failure for tampered body")
+	}
+}
+
+func TestQuota(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/quota" {
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"identity":"ip:1.2.3.4","rateLimit":{"limit":10,"remaining":7,"resetAt":"2025-01-01T00:00:00Z"}}`))
+	}))
+	defer server.Close()
+
+	client, err := New(server.URL + "/")
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	q, err := client.Quota(context.Background())
+	if err != nil {
+		t.Fatalf("quota: %v", err)
+	}
+	if q.RateLimit == nil || q.RateLimit.Remaining != 7 || q.Spend != nil {
+		t.Fatalf("unexpected quota: %+v", q)
+	}
+}
+
+func TestCapabilityCheck(t *testing.T) {
+	var fetched, invoked int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/capabilities" {
+			fetched++
+			_, _ = w.Write([]byte(`{"commands":["execute"],"contracts":["credits.aleo","vlink_*.aleo"],"maxFee":5000}`))
+			return
+		}
+		invoked++
+		_, _ = w.Write([]byte(`{"exitCode":0}`))
+	}))
+	defer server.Close()
+
+	client, _ := New(server.URL, WithCapabilityCheck())
+	ctx := context.Background()
+	if _, err := client.Invoke(ctx, Request{Cmd: "execute vlink_token.aleo/mint 1u64 --priority-fee 100u64"}); err != nil {
+		t.Fatalf("allowed request refused: %v", err)
+	}
+	for req, code := range map[*Request]string{
+		{Args: []string{"deploy"}}:                                                     "command_not_allowed",
+		{Args: []string{"execute", "nft.aleo/mint"}}:                                   "contract_not_allowed",
+		{Args: []string{"execute", "credits.aleo/transfer", "--priority-fee", "9000"}}: "fee_too_high",
+	} {
+		_, err := client.Invoke(ctx, *req)
+		var ie *InvokeError
+		if !errors.As(err, &ie) || !ie.Local || ie.Code != code {
+			t.Fatalf("%v: expected local %s, got %v", req.Args, code, err)
+		}
+	}
+	if fetched != 1 || invoked != 1 {
+		t.Fatalf("expected one fetch and one invocation, got %d and %d", fetched, invoked)
+	}
+}
+
+func TestInvokeUpgradedToJob(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost:
+			var body map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["maxWaitSeconds"] != float64(5) {
+				t.Errorf("maxWaitSeconds not sent: %v", body)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"jobId":"abc","status":"running","stdout":"proving"}`))
+		case r.URL.Path == "/jobs/abc":
+			_, _ = w.Write([]byte(`{"jobId":"abc","status":"done","result":{"exitCode":0,"stdout":"done"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := New(server.URL)
+	resp, err := client.Invoke(context.Background(), Request{Args: []string{"execute"}, MaxWaitSeconds: 5})
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if resp.JobID != "abc" || resp.Stdout != "proving" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	job, err := client.Job(context.Background(), resp.JobID)
+	if err != nil {
+		t.Fatalf("job: %v", err)
+	}
+	if !job.Done() || job.Result == nil || job.Result.Stdout != "done" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+}
+
+func TestWithHMACSignsRequests(t *testing.T) {
+	clients := hmacauth.Clients{"partner": {Primary: "s3cret"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		headers := map[string]string{}
+		for k := range r.Header {
+			headers[k] = r.Header.Get(k)
+		}
+		if _, _, err := clients.Verify(headers, r.Method, r.URL.EscapedPath(), r.URL.RawQuery, body, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"` + err.Error() + `"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"exitCode":0,"jobs":[]}`))
+	}))
+	defer srv.Close()
+
+	client, _ := New(srv.URL, WithHMAC("partner", "s3cret"))
+	if _, err := client.Invoke(context.Background(), Request{Args: []string{"--version"}}); err != nil {
+		t.Fatalf("signed invoke: %v", err)
+	}
+	if _, err := client.Jobs(context.Background(), map[string]string{"order": "42"}); err != nil {
+		t.Fatalf("signed GET: %v", err)
+	}
+	wrong, _ := New(srv.URL, WithHMAC("partner", "other"))
+	if _, err := wrong.Invoke(context.Background(), Request{Args: []string{"--version"}}); err == nil {
+		t.Fatalf("expected a wrong secret to be rejected")
+	}
+}
+
+func TestInvokeWarnings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "@1767225600")
+		w.Header().Set("Sunset", "Wed, 30 Jun 2027 00:00:00 GMT")
+		w.Header().Add("Link", `<https://example.com/migrate>; rel="deprecation"`)
+		_, _ = w.Write([]byte(`{"exitCode":0,"stdout":"ok","warnings":[{"code":"output_truncated","message":"output was truncated to fit the response"}]}`))
+	}))
+	defer server.Close()
+
+	var seen []Warning
+	client, err := New(server.URL, WithWarningHandler(func(w Warning) { seen = append(seen, w) }))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	res, err := client.Invoke(context.Background(), Request{Args: []string{"--version"}})
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	d := res.Deprecation
+	if d == nil || !d.At.Equal(time.Unix(1767225600, 0)) || d.Sunset.Year() != 2027 || d.Link != "https://example.com/migrate" {
+		t.Fatalf("unexpected deprecation: %+v", d)
+	}
+	ws := res.Warnings()
+	if len(ws) != 2 || ws[0].Code != "output_truncated" || ws[1].Code != WarningDeprecated {
+		t.Fatalf("unexpected warnings: %+v", ws)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected the handler to see both warnings, got %+v", seen)
+	}
+
+	// Warnings survive a round trip, e.g. through a cached job result.
+	b, _ := json.Marshal(res)
+	var back Response
+	if err := json.Unmarshal(b, &back); err != nil || len(back.Warnings()) != 1 || back.Stdout != "ok" {
+		t.Fatalf("unexpected round trip: %s %+v %v", b, back.Warnings(), err)
+	}
+}
+
+func TestParseDeprecation(t *testing.T) {
+	if d := parseDeprecation(http.Header{}); d != nil {
+		t.Fatalf("expected no deprecation, got %+v", d)
+	}
+	h := http.Header{"Deprecation": {"true"}}
+	if d := parseDeprecation(h); d == nil || !d.At.IsZero() {
+		t.Fatalf("expected an undated deprecation, got %+v", d)
+	}
+	h = http.Header{"Deprecation": {"Sun, 11 Nov 2018 23:59:59 GMT"}}
+	if d := parseDeprecation(h); d == nil || d.At.Year() != 2018 {
+		t.Fatalf("expected an HTTP-date deprecation, got %+v", d)
+	}
+	h = http.Header{"Sunset": {"Wed, 30 Jun 2027 00:00:00 GMT"}, "Link": {`<https://a.example/>; rel="next", <https://b.example/>; rel=sunset`}}
+	if d := parseDeprecation(h); d == nil || d.Sunset.IsZero() || d.Link != "https://b.example/" {
+		t.Fatalf("expected a sunset with its link, got %+v", d)
+	}
+}
@@ -0,0 +1,44 @@
+package sdk
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/hmacauth"
+)
+
+// hmacTransport adds the hmacauth signature headers to each request.
+type hmacTransport struct {
+	client, secret string
+	base           http.RoundTripper
+}
+
+func (t *hmacTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	ts := time.Now().Unix()
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.Header.Set(hmacauth.HeaderClient, t.client)
+	req.Header.Set(hmacauth.HeaderTimestamp, strconv.FormatInt(ts, 10))
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	req.Header.Set(hmacauth.HeaderSignature, hmacauth.Sign(t.secret, ts, req.Method, path, req.URL.RawQuery, body))
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
@@ -0,0 +1,100 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Job is the state of a run that outlived its request's MaxWaitSeconds.
+type Job struct {
+	ID         string            `json:"jobId"`
+	Status     string            `json:"status"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	StartedAt  *time.Time        `json:"startedAt,omitempty"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+	// QueuePosition is set while Status is "queued"; 1 starts next.
+	QueuePosition int `json:"queuePosition,omitempty"`
+	// EstimatedStartAt and EstimatedFinishAt are rough ETAs based on recent runs of the
+	// same contract; nil until the Lambda has history to go by.
+	EstimatedStartAt  *time.Time `json:"estimatedStartAt,omitempty"`
+	EstimatedFinishAt *time.Time `json:"estimatedFinishAt,omitempty"`
+	// Stdout and Stderr carry partial output while the job is running.
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	// Result is set once Status is "done".
+	Result *Response `json:"result,omitempty"`
+}
+
+// Done reports whether the job has finished.
+func (j *Job) Done() bool { return j != nil && j.Status == "done" }
+
+// Job fetches the state of an async job. Jobs are held in memory by the container that
+// started them, so a 404 InvokeError means the job expired or is unreachable.
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	if c == nil {
+		return nil, fmt.Errorf("sdk Client is nil")
+	}
+	if strings.TrimSpace(id) == "" {
+		return nil, fmt.Errorf("job id is required")
+	}
+	var out Job
+	if err := c.getJSON(ctx, "/jobs/"+url.PathEscape(id), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Jobs lists the caller's jobs carrying all of tags, newest first, without output or
+// results. Like Job it only sees jobs held by the container that answers.
+func (c *Client) Jobs(ctx context.Context, tags map[string]string) ([]Job, error) {
+	if c == nil {
+		return nil, fmt.Errorf("sdk Client is nil")
+	}
+	q := url.Values{}
+	for k, v := range tags {
+		q.Add("tag", k+":"+v)
+	}
+	path := "/jobs"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var out struct {
+		Jobs []Job `json:"jobs"`
+	}
+	if err := c.getJSON(ctx, path, &out); err != nil {
+		return nil, err
+	}
+	return out.Jobs, nil
+}
+
+// getJSON GETs path relative to the base URL and decodes the JSON body into out.
+func (c *Client) getJSON(ctx context.Context, path string, out any) error {
+	u := strings.TrimRight(c.baseURL, "/") + path
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= 300 {
+		return parseError(resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgeDelay       = 500 * time.Millisecond
+	defaultFailoverCooldown = 30 * time.Second
+)
+
+// WithHedgeDelay sets how long a multi-region client waits on an endpoint before
+// hedging a read-only request to the next one.
+func WithHedgeDelay(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.hedgeDelay = d
+		}
+	}
+}
+
+// WithFailoverCooldown sets how long a failed endpoint is skipped before being retried.
+func WithFailoverCooldown(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.failoverCooldown = d
+		}
+	}
+}
+
+// MultiRegionClient invokes one of several Lambda endpoints, preferring them in the
+// order given and failing over on 5xx responses, throttling and transport errors.
+type MultiRegionClient struct {
+	clients    []*Client
+	hedgeDelay time.Duration
+	cooldown   time.Duration
+
+	mu        sync.Mutex
+	downUntil []time.Time
+}
+
+// NewMultiRegion constructs a client over urls; the first URL is the primary.
+func NewMultiRegion(urls []string, opts ...Option) (*MultiRegionClient, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("at least one base URL is required")
+	}
+	m := &MultiRegionClient{
+		hedgeDelay: defaultHedgeDelay,
+		cooldown:   defaultFailoverCooldown,
+		downUntil:  make([]time.Time, len(urls)),
+	}
+	for _, u := range urls {
+		cli, err := New(u, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %q: %w", u, err)
+		}
+		m.clients = append(m.clients, cli)
+	}
+	if d := m.clients[0].hedgeDelay; d > 0 {
+		m.hedgeDelay = d
+	}
+	if d := m.clients[0].failoverCooldown; d > 0 {
+		m.cooldown = d
+	}
+	return m, nil
+}
+
+// Endpoints returns the configured endpoint URLs in preference order.
+func (m *MultiRegionClient) Endpoints() []string {
+	out := make([]string, len(m.clients))
+	for i, c := range m.clients {
+		out[i] = c.baseURL
+	}
+	return out
+}
+
+// HealthCheck probes every endpoint and records which ones are reachable. Any response
+// below 500 counts as healthy since the Lambda rejects bare GETs with 400.
+func (m *MultiRegionClient) HealthCheck(ctx context.Context) map[string]error {
+	out := make(map[string]error, len(m.clients))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, c := range m.clients {
+		wg.Go(func() {
+			err := c.probe(ctx)
+			if err != nil {
+				m.markDown(i)
+			} else {
+				m.markUp(i)
+			}
+			mu.Lock()
+			out[c.baseURL] = err
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return out
+}
+
+// Invoke runs req against the preferred healthy endpoint, failing over in order.
+// Read-only requests are hedged: if an endpoint has not answered within the hedge
+// delay, the next endpoint is tried concurrently and the first success wins.
+// The serving endpoint is reported in Response.Endpoint.
+func (m *MultiRegionClient) Invoke(ctx context.Context, req Request) (*Response, error) {
+	if m == nil {
+		return nil, fmt.Errorf("sdk MultiRegionClient is nil")
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	order := m.order()
+	if req.isReadOnly() && len(order) > 1 {
+		return m.hedged(ctx, req, order)
+	}
+	var lastErr error
+	for _, i := range order {
+		resp, err := m.clients[i].Invoke(ctx, req)
+		if err == nil {
+			m.markUp(i)
+			resp.Endpoint = m.clients[i].baseURL
+			return resp, nil
+		}
+		if ctx.Err() != nil || !shouldFailover(err) {
+			return nil, err
+		}
+		m.markDown(i)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+type attempt struct {
+	idx  int
+	resp *Response
+	err  error
+}
+
+func (m *MultiRegionClient) hedged(ctx context.Context, req Request, order []int) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attempt, len(order))
+	launched, next := 0, 0
+	launch := func() {
+		i := order[next]
+		next++
+		launched++
+		go func() {
+			resp, err := m.clients[i].Invoke(ctx, req)
+			results <- attempt{idx: i, resp: resp, err: err}
+		}()
+	}
+	launch()
+	timer := time.NewTimer(m.hedgeDelay)
+	defer timer.Stop()
+
+	var lastErr error
+	for received := 0; received < launched; {
+		select {
+		case <-timer.C:
+			if next < len(order) {
+				launch()
+				timer.Reset(m.hedgeDelay)
+			}
+		case r := <-results:
+			received++
+			if r.err == nil {
+				m.markUp(r.idx)
+				r.resp.Endpoint = m.clients[r.idx].baseURL
+				return r.resp, nil
+			}
+			if ctx.Err() != nil {
+				return nil, r.err
+			}
+			if !shouldFailover(r.err) {
+				return nil, r.err
+			}
+			m.markDown(r.idx)
+			lastErr = r.err
+			if next < len(order) {
+				launch()
+				timer.Reset(m.hedgeDelay)
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// order returns endpoint indexes with healthy ones first, keeping configured preference.
+func (m *MultiRegionClient) order() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	healthy := make([]int, 0, len(m.clients))
+	var down []int
+	for i := range m.clients {
+		if now.Before(m.downUntil[i]) {
+			down = append(down, i)
+			continue
+		}
+		healthy = append(healthy, i)
+	}
+	return append(healthy, down...)
+}
+
+func (m *MultiRegionClient) markDown(i int) {
+	m.mu.Lock()
+	m.downUntil[i] = time.Now().Add(m.cooldown)
+	m.mu.Unlock()
+}
+
+func (m *MultiRegionClient) markUp(i int) {
+	m.mu.Lock()
+	m.downUntil[i] = time.Time{}
+	m.mu.Unlock()
+}
+
+func shouldFailover(err error) bool {
+	var ie *InvokeError
+	if errors.As(err, &ie) {
+		return ie.StatusCode >= http.StatusInternalServerError || ie.StatusCode == http.StatusTooManyRequests
+	}
+	// Transport failures and per-request timeouts.
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+func (c *Client) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return &InvokeError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// readOnlyCommands are leo subcommands that never broadcast and can be safely hedged.
+var readOnlyCommands = []string{"query", "--version", "-V"}
+
+func (r Request) isReadOnly() bool {
+	if r.ReadOnly {
+		return true
+	}
+	args := r.Args
+	if len(args) == 0 {
+		args = strings.Fields(r.Cmd)
+	}
+	for _, a := range args {
+		for _, ro := range readOnlyCommands {
+			if strings.EqualFold(a, ro) {
+				return true
+			}
+		}
+		if !strings.HasPrefix(a, "-") {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func okServer(t *testing.T, stdout string, delay time.Duration, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits != nil {
+			hits.Add(1)
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		_ = json.NewEncoder(w).Encode(Response{Stdout: stdout})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func statusServer(t *testing.T, status int, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits != nil {
+			hits.Add(1)
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": http.StatusText(status)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMultiRegion_FailsOverOn5xx(t *testing.T) {
+	var primaryHits atomic.Int32
+	primary := statusServer(t, http.StatusBadGateway, &primaryHits)
+	secondary := okServer(t, "from-secondary", 0, nil)
+
+	m, err := NewMultiRegion([]string{primary.URL, secondary.URL})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	for range 2 {
+		res, err := m.Invoke(context.Background(), Request{Args: []string{"execute", "a.aleo/b"}})
+		if err != nil {
+			t.Fatalf("invoke: %v", err)
+		}
+		if res.Endpoint != secondary.URL || res.Stdout != "from-secondary" {
+			t.Fatalf("expected secondary to serve, got %q %q", res.Endpoint, res.Stdout)
+		}
+	}
+	if got := primaryHits.Load(); got != 1 {
+		t.Fatalf("expected failed primary to be skipped during cooldown, hits=%d", got)
+	}
+}
+
+func TestMultiRegion_NoFailoverOn4xx(t *testing.T) {
+	primary := statusServer(t, http.StatusForbidden, nil)
+	var secondaryHits atomic.Int32
+	secondary := okServer(t, "", 0, &secondaryHits)
+
+	m, err := NewMultiRegion([]string{primary.URL, secondary.URL})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = m.Invoke(context.Background(), Request{Args: []string{"execute", "a.aleo/b"}})
+	if ie, ok := err.(*InvokeError); !ok || ie.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 InvokeError, got %v", err)
+	}
+	if secondaryHits.Load() != 0 {
+		t.Fatalf("secondary must not be called for client errors")
+	}
+}
+
+func TestMultiRegion_HedgesReadOnly(t *testing.T) {
+	primary := okServer(t, "slow", 300*time.Millisecond, nil)
+	secondary := okServer(t, "fast", 0, nil)
+
+	m, err := NewMultiRegion([]string{primary.URL, secondary.URL}, WithHedgeDelay(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	start := time.Now()
+	res, err := m.Invoke(context.Background(), Request{Args: []string{"query", "program", "credits.aleo"}})
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	if res.Endpoint != secondary.URL {
+		t.Fatalf("expected hedged secondary to win, got %q", res.Endpoint)
+	}
+	if time.Since(start) > 250*time.Millisecond {
+		t.Fatalf("hedged call took too long: %s", time.Since(start))
+	}
+}
+
+func TestMultiRegion_HealthCheck(t *testing.T) {
+	up := statusServer(t, http.StatusBadRequest, nil)
+	down := statusServer(t, http.StatusServiceUnavailable, nil)
+	m, err := NewMultiRegion([]string{down.URL, up.URL})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	res := m.HealthCheck(context.Background())
+	if res[up.URL] != nil || res[down.URL] == nil {
+		t.Fatalf("unexpected health results: %v", res)
+	}
+	if order := m.order(); order[0] != 1 {
+		t.Fatalf("expected healthy endpoint first, got %v", order)
+	}
+}
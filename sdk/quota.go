@@ -0,0 +1,62 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Quota is the remaining allowance of the calling identity as reported by GET /quota.
+// Limits that are not configured on the Lambda are nil.
+type Quota struct {
+	Identity  string `json:"identity"`
+	RateLimit *struct {
+		Limit     int       `json:"limit"`
+		Remaining int       `json:"remaining"`
+		ResetAt   time.Time `json:"resetAt"`
+	} `json:"rateLimit,omitempty"`
+	Spend *struct {
+		Limit     uint64    `json:"limit"`
+		Used      uint64    `json:"used"`
+		Remaining uint64    `json:"remaining"`
+		ResetAt   time.Time `json:"resetAt"`
+	} `json:"spend,omitempty"`
+	Concurrency *struct {
+		Limit     int `json:"limit"`
+		InUse     int `json:"inUse"`
+		Available int `json:"available"`
+	} `json:"concurrency,omitempty"`
+}
+
+// Quota fetches the caller's remaining rate-limit tokens, daily spend budget and
+// concurrent execution slots so clients can self-throttle.
+func (c *Client) Quota(ctx context.Context) (*Quota, error) {
+	if c == nil {
+		return nil, fmt.Errorf("sdk Client is nil")
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(c.baseURL, "/")+"/quota", nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= 300 {
+		return nil, parseError(resp.StatusCode, body)
+	}
+	var out Quota
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,67 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/debendraoli/leo-lambda/pkg/stream"
+)
+
+// InvokeStream executes req with its output streamed, for Lambdas deployed with
+// RESPONSE_STREAMING behind a streaming Function URL. onLine, which may be nil, is
+// called with stream.Stdout or stream.Stderr and each line as leo writes it.
+//
+// The Response is read from the stream's trailer, with Stdout and Stderr assembled from
+// the streamed lines. Streamed responses are not signed, so a Client with a
+// verification key refuses them. A request the Lambda answers without streaming, e.g.
+// a refused or cached one, is decoded as Invoke does, without calls to onLine. A stream
+// cut before its trailer returns the output so far and an error wrapping
+// stream.ErrNoTrailer.
+func (c *Client) InvokeStream(ctx context.Context, req Request, onLine func(stream, line string)) (*Response, error) {
+	resp, err := c.post(ctx, req, stream.MediaType+", application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), stream.MediaType) {
+		return c.decode(resp)
+	}
+	if c.verifyKey != nil {
+		return nil, fmt.Errorf("verify response: streamed responses are not signed")
+	}
+
+	var stdout, stderr strings.Builder
+	trailer, err := stream.Read(resp.Body, func(s, line string) {
+		w := &stdout
+		if s == stream.Stderr {
+			w = &stderr
+		}
+		w.WriteString(line)
+		w.WriteByte('\n')
+		if onLine != nil {
+			onLine(s, line)
+		}
+	})
+	out := Response{Deprecation: parseDeprecation(resp.Header)}
+	if err != nil {
+		out.Stdout, out.Stderr = stdout.String(), stderr.String()
+		return &out, fmt.Errorf("read stream: %w", err)
+	}
+	// The stream started with 200 before the run ended; the trailer has the real status.
+	var status struct {
+		Status int `json:"status"`
+	}
+	_ = json.Unmarshal(trailer, &status)
+	if status.Status < http.StatusOK || status.Status >= 300 {
+		return nil, parseError(status.Status, trailer)
+	}
+	if err := json.Unmarshal(trailer, &out); err != nil {
+		return nil, fmt.Errorf("decode trailer: %w", err)
+	}
+	out.Stdout, out.Stderr, out.RawBody = stdout.String(), stderr.String(), trailer
+	c.reportWarnings(&out)
+	return &out, nil
+}
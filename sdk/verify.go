@@ -0,0 +1,44 @@
+package sdk
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/debendraoli/leo-lambda/pkg/signing"
+)
+
+// WithVerificationKey makes Invoke verify the response signature with pub and fail
+// when the signature is missing or invalid. Use the public half of the KMS key
+// configured via RESPONSE_SIGNING_KEY_ID (see ParsePublicKeyPEM).
+func WithVerificationKey(pub crypto.PublicKey) Option {
+	return func(c *Client) {
+		c.verifyKey = pub
+	}
+}
+
+// VerifySignature checks a detached response signature (base64, as sent in the
+// X-Leo-Signature header) over the raw response body.
+func VerifySignature(pub crypto.PublicKey, algorithm string, body []byte, signatureB64 string) error {
+	if signatureB64 == "" {
+		return errors.New("response is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+	return signing.Verify(pub, algorithm, body, sig)
+}
+
+// ParsePublicKeyPEM parses a PEM-encoded PKIX public key, e.g. the output of
+// `aws kms get-public-key` wrapped in a PUBLIC KEY block.
+func ParsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
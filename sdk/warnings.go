@@ -0,0 +1,134 @@
+package sdk
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/warnings"
+)
+
+// Warning is a caveat of a request that still succeeded. Codes sent by the Lambda are
+// listed in package warnings, e.g. warnings.OutputTruncated.
+type Warning = warnings.Warning
+
+// WarningDeprecated is the code of the warning the client adds when a response
+// announces that the API is deprecated; see Response.Deprecation.
+const WarningDeprecated = "deprecated"
+
+// WithWarningHandler calls fn with the warnings of every successful Invoke, including
+// deprecation notices, so applications can log or alert on them in one place. fn runs
+// on the calling goroutine before Invoke returns.
+func WithWarningHandler(fn func(Warning)) Option {
+	return func(c *Client) {
+		c.onWarning = fn
+	}
+}
+
+// Deprecation is the server's notice, from the Deprecation (RFC 9745) and Sunset
+// (RFC 8594) headers, that the API called is going away.
+type Deprecation struct {
+	// At is when the API was or will be deprecated; zero if the server only says it is.
+	At time.Time
+	// Sunset is when the API stops working; zero if not announced.
+	Sunset time.Time
+	// Link points to migration notes, from a Link header with rel="deprecation" or
+	// rel="sunset".
+	Link string
+}
+
+// String describes d for logs.
+func (d Deprecation) String() string {
+	msg := "the API is deprecated"
+	if !d.At.IsZero() {
+		msg += " as of " + d.At.UTC().Format(time.RFC3339)
+	}
+	if !d.Sunset.IsZero() {
+		msg += " and will be removed at " + d.Sunset.UTC().Format(time.RFC3339)
+	}
+	if d.Link != "" {
+		msg += "; see " + d.Link
+	}
+	return msg
+}
+
+// parseDeprecation reads the deprecation headers of a response; it returns nil when
+// neither Deprecation nor Sunset is set.
+func parseDeprecation(h http.Header) *Deprecation {
+	dep, sunset := strings.TrimSpace(h.Get("Deprecation")), strings.TrimSpace(h.Get("Sunset"))
+	if dep == "" && sunset == "" {
+		return nil
+	}
+	var d Deprecation
+	switch {
+	case strings.HasPrefix(dep, "@"):
+		if sec, err := strconv.ParseInt(dep[1:], 10, 64); err == nil {
+			d.At = time.Unix(sec, 0).UTC()
+		}
+	case dep != "" && !strings.EqualFold(dep, "true"):
+		// Earlier drafts of the header used an HTTP date.
+		d.At, _ = http.ParseTime(dep)
+	}
+	d.Sunset, _ = http.ParseTime(sunset)
+	for _, v := range h.Values("Link") {
+		for link := range strings.SplitSeq(v, ",") {
+			target, params, _ := strings.Cut(link, ";")
+			rel := strings.ToLower(params)
+			if strings.Contains(rel, `rel="deprecation"`) || strings.Contains(rel, "rel=deprecation") ||
+				strings.Contains(rel, `rel="sunset"`) || strings.Contains(rel, "rel=sunset") {
+				d.Link = strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+	return &d
+}
+
+// Warnings returns the caveats the Lambda reported for the run, followed by a
+// WarningDeprecated warning when the response carried a deprecation notice.
+func (r *Response) Warnings() []Warning {
+	if r == nil {
+		return nil
+	}
+	out := append([]Warning(nil), r.warnings...)
+	if r.Deprecation != nil {
+		out = append(out, Warning{Code: WarningDeprecated, Message: r.Deprecation.String()})
+	}
+	return out
+}
+
+// responseJSON is Response with its warnings exposed to encoding/json.
+type responseJSON struct {
+	*responseFields
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// responseFields has Response's fields but not its methods, so encoding it does not
+// recurse into MarshalJSON and UnmarshalJSON.
+type responseFields Response
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Response) UnmarshalJSON(b []byte) error {
+	v := responseJSON{responseFields: (*responseFields)(r)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	r.warnings = v.Warnings
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r Response) MarshalJSON() ([]byte, error) {
+	return json.Marshal(responseJSON{responseFields: (*responseFields)(&r), Warnings: r.warnings})
+}
+
+// reportWarnings passes the warnings of resp to the WithWarningHandler callback.
+func (c *Client) reportWarnings(resp *Response) {
+	if c.onWarning == nil {
+		return
+	}
+	for _, w := range resp.Warnings() {
+		c.onWarning(w)
+	}
+}
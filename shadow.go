@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/metrics"
+)
+
+// shadowCompare reports an execute of contract on which the shadow policy read from
+// variable decides differently from the enforced one: it is logged and counted as a
+// ShadowMismatch metric. The enforced decision always stands, so a policy change can be
+// validated against real traffic before it is rolled out.
+func shadowCompare(cfgEnv *EnvConfig, variable, caller, contract string, enforced, shadow bool) {
+	if enforced == shadow {
+		return
+	}
+	logWarn("shadow policy disagrees", map[string]string{
+		"policy":   variable,
+		"caller":   caller,
+		"contract": contract,
+		"enforced": decision(enforced),
+		"shadow":   decision(shadow),
+	})
+	if cfgEnv.MetricsNamespace != "" {
+		_ = metrics.WriteCount(metricsOut, cfgEnv.MetricsNamespace, metrics.ShadowMismatch, time.Now())
+	}
+}
+
+func decision(allow bool) string {
+	if allow {
+		return "allow"
+	}
+	return "deny"
+}
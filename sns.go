@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// snsResult is the message published to RESULTS_TOPIC_ARN for each message run.
+type snsResult struct {
+	// MessageID and TopicARN identify the message that was run.
+	MessageID string `json:"messageId"`
+	TopicARN  string `json:"topicArn"`
+	// Status is the HTTP status the request got; Response is its body.
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// isSNS reports whether raw is a notification from an SNS subscription.
+func isSNS(raw json.RawMessage) bool {
+	var ev struct {
+		Records []struct {
+			EventSource string `json:"EventSource"`
+		} `json:"Records"`
+	}
+	return json.Unmarshal(raw, &ev) == nil && len(ev.Records) > 0 && ev.Records[0].EventSource == "aws:sns"
+}
+
+// handleSNS runs each notification's message, an InvokeRequest, as caller
+// "sns:<topic name>", and publishes the outcome to RESULTS_TOPIC_ARN when it is set.
+// Responses are cut to fit an SNS message. Failures, of the run or of publishing, are
+// logged rather than returned: Lambda would retry the invocation and run it again.
+func handleSNS(ctx context.Context, ev events.SNSEvent) {
+	ctx = context.WithValue(ctx, responseCap{}, snsResponseLimit)
+	for _, r := range ev.Records {
+		m := r.SNS
+		topic := m.TopicArn[strings.LastIndex(m.TopicArn, ":")+1:]
+		resp, err := runEventBody(ctx, "sns:"+topic, m.Message)
+		if err != nil {
+			logWarn("sns message failed", map[string]string{"messageId": m.MessageID, "error": err.Error()})
+			continue
+		}
+		if err := publishResult(ctx, m, resp); err != nil {
+			logWarn("sns result not published", map[string]string{"messageId": m.MessageID, "error": err.Error()})
+		}
+	}
+}
+
+// publishResult publishes resp, the response to m, to RESULTS_TOPIC_ARN with its status
+// as the "status" message attribute, for subscription filter policies. On a FIFO topic
+// results are grouped by source topic and deduplicated by source message.
+func publishResult(ctx context.Context, m events.SNSEntity, resp events.LambdaFunctionURLResponse) error {
+	cfgEnv, err := currentConfig()
+	if err != nil {
+		return err
+	}
+	if cfgEnv.ResultsTopicARN == "" {
+		return nil
+	}
+	body := json.RawMessage(resp.Body)
+	if !json.Valid(body) {
+		body, _ = json.Marshal(resp.Body)
+	}
+	msg, _ := json.Marshal(snsResult{MessageID: m.MessageID, TopicARN: m.TopicArn, Status: resp.StatusCode, Response: body})
+	params := url.Values{
+		"TopicArn":                       {cfgEnv.ResultsTopicARN},
+		"Message":                        {string(msg)},
+		"MessageAttributes.entry.1.Name": {"status"},
+		"MessageAttributes.entry.1.Value.DataType":    {"Number"},
+		"MessageAttributes.entry.1.Value.StringValue": {strconv.Itoa(resp.StatusCode)},
+	}
+	if strings.HasSuffix(cfgEnv.ResultsTopicARN, ".fifo") {
+		params.Set("MessageGroupId", m.TopicArn[strings.LastIndex(m.TopicArn, ":")+1:])
+		params.Set("MessageDeduplicationId", m.MessageID)
+	}
+	if _, err := cfgEnv.sns.Query(ctx, "sns", "Publish", "2010-03-31", params); err != nil {
+		return fmt.Errorf("sns publish: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// isSQS reports whether raw is a batch of messages from an SQS event source mapping.
+func isSQS(raw json.RawMessage) bool {
+	var ev struct {
+		Records []struct {
+			EventSource string `json:"eventSource"`
+		} `json:"Records"`
+	}
+	return json.Unmarshal(raw, &ev) == nil && len(ev.Records) > 0 && ev.Records[0].EventSource == "aws:sqs"
+}
+
+// handleSQS runs the messages of a batch one after another, each body an InvokeRequest
+// sent by the queue as caller "sqs:<queue name>", and reports the messages that failed so
+// only those are retried. A message fails unless leo ran and exited 0, or it was handed off as a job; the queue's
+// redrive policy decides when one is given up on. Messages not started before the
+// invocation's TIME_RESERVE, and on FIFO queues every message after a failure, are
+// reported failed without running, to keep them for the next delivery in order.
+func handleSQS(ctx context.Context, ev events.SQSEvent) events.SQSEventResponse {
+	resp := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+	var reserve time.Duration
+	if cfgEnv, err := currentConfig(); err == nil {
+		reserve = cfgEnv.TimeReserve
+	}
+	stopped := false
+	for _, m := range ev.Records {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < reserve {
+			stopped = true
+		}
+		if stopped || ctx.Err() != nil || !runSQSMessage(ctx, m) {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: m.MessageId})
+			stopped = stopped || strings.HasSuffix(m.EventSourceARN, ".fifo")
+		}
+	}
+	return resp
+}
+
+// runSQSMessage runs one message and reports whether it succeeded, as runFailure
+// judges it. A request handed off to WORKER_QUEUE_URL thus counts as delivered.
+func runSQSMessage(ctx context.Context, m events.SQSMessage) bool {
+	queue := m.EventSourceARN[strings.LastIndex(m.EventSourceARN, ":")+1:]
+	resp, err := runEventBody(ctx, "sqs:"+queue, m.Body)
+	if err != nil {
+		logWarn("sqs message failed", map[string]string{"messageId": m.MessageId, "error": err.Error()})
+		return false
+	}
+	if fields := runFailure(resp); fields != nil {
+		fields["messageId"] = m.MessageId
+		logWarn("sqs message failed", fields)
+		return false
+	}
+	return true
+}
+
+// runFailure describes resp, the response to an event-sourced request, for the log
+// when the request failed, and returns nil when it succeeded: leo ran and exited 0, or
+// the request was handed off to WORKER_QUEUE_URL (202), which tracks it from there. No
+// other 202 reaches an event source: maxWaitSeconds is dropped and maintenance windows
+// refuse rather than hold.
+func runFailure(resp events.LambdaFunctionURLResponse) map[string]string {
+	if resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+	var out struct {
+		ExitCode int    `json:"exitCode"`
+		Code     string `json:"code"`
+		Error    string `json:"error"`
+	}
+	if json.Unmarshal([]byte(resp.Body), &out) == nil && resp.StatusCode == http.StatusOK && out.ExitCode == 0 {
+		return nil
+	}
+	return map[string]string{
+		"status":   strconv.Itoa(resp.StatusCode),
+		"exitCode": strconv.Itoa(out.ExitCode),
+		"code":     out.Code,
+		"error":    out.Error,
+	}
+}
+
+// runEventBody serves body, an InvokeRequest delivered by an event source, as a POST to
+// / from caller. maxWaitSeconds is dropped from it: a job would not outlive the
+// invocation that delivered it. A body carrying a Step Functions taskToken has its
+// response sent to the waiting state machine as well, cut to fit a task's output.
+func runEventBody(ctx context.Context, caller, body string) (events.LambdaFunctionURLResponse, error) {
+	var token string
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(body), &fields) == nil {
+		_ = json.Unmarshal(fields["taskToken"], &token)
+		_, wait := fields["maxWaitSeconds"]
+		_, task := fields["taskToken"]
+		if wait || task {
+			delete(fields, "maxWaitSeconds")
+			delete(fields, "taskToken")
+			b, _ := json.Marshal(fields)
+			body = string(b)
+		}
+	}
+	if token != "" {
+		ctx = context.WithValue(ctx, responseCap{}, min(responseLimitFor(ctx), taskOutputLimit))
+	}
+	req := events.LambdaFunctionURLRequest{RawPath: "/", Body: body, Headers: map[string]string{"content-type": "application/json"}}
+	req.RequestContext.HTTP.Method = http.MethodPost
+	req.RequestContext.HTTP.Path = "/"
+	resp, err := handler(context.WithValue(ctx, internalCaller{}, caller), req)
+	if err == nil && token != "" {
+		if err := sendTaskResult(ctx, token, resp); err != nil {
+			logWarn("task result not sent", map[string]string{"caller": caller, "error": err.Error()})
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"slices"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/journal"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// statusWindow is how many recent journal entries the success rate covers.
+const statusWindow = 100
+
+// statusSnapshot is the public status page. It deliberately leaves out callers, args
+// and endpoint URLs, which may carry identities or API keys.
+type statusSnapshot struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	LeoVersion  string    `json:"leoVersion"`
+	// SuccessRate covers the last Finished runs; nil without journaled runs.
+	SuccessRate *float64         `json:"successRate"`
+	Finished    int              `json:"finished"`
+	Recent      []statusRun      `json:"recent"`
+	Endpoints   []statusEndpoint `json:"endpoints"`
+}
+
+type statusRun struct {
+	Command    string    `json:"command"`
+	Program    string    `json:"program,omitempty"`
+	Status     string    `json:"status"`
+	ExitCode   *int      `json:"exitCode,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	Duration   float64   `json:"durationSeconds,omitempty"`
+}
+
+type statusEndpoint struct {
+	Network   string `json:"network"`
+	Reachable bool   `json:"reachable"`
+	Height    uint64 `json:"height,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+var statusPage = template.Must(template.New("status").Funcs(template.FuncMap{
+	"pct":   func(f *float64) float64 { return *f * 100 },
+	"deref": func(i *int) int { return *i },
+}).Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>leo-lambda status</title>
+<style>body{font-family:sans-serif;margin:2em}td,th{padding:.2em .8em;text-align:left}.fail{color:#b00}</style></head>
+<body><h1>leo-lambda status</h1>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04:05 UTC"}} &middot; leo {{.LeoVersion}}
+{{with .SuccessRate}} &middot; success rate {{printf "%.1f" (pct .)}}% over the last {{$.Finished}} runs{{end}}</p>
+<h2>Endpoints</h2>
+<table><tr><th>Network</th><th>Status</th><th>Height</th><th>Latency</th></tr>
+{{range .Endpoints}}<tr><td>{{.Network}}</td>{{if .Reachable}}<td>up</td><td>{{.Height}}</td><td>{{.LatencyMs}} ms</td>{{else}}<td class="fail">down</td><td colspan="2">{{.Error}}</td>{{end}}</tr>
+{{end}}</table>
+<h2>Recent executions</h2>
+<table><tr><th>Received</th><th>Command</th><th>Program</th><th>Status</th><th>Exit</th><th>Duration</th></tr>
+{{range .Recent}}<tr><td>{{.ReceivedAt.Format "2006-01-02 15:04:05"}}</td><td>{{.Command}}</td><td>{{.Program}}</td><td>{{.Status}}</td><td{{if and .ExitCode (ne (deref .ExitCode) 0)}} class="fail"{{end}}>{{with .ExitCode}}{{deref .}}{{end}}</td><td>{{if .Duration}}{{printf "%.1f" .Duration}} s{{end}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// publishStatus renders the status snapshot to STATUS_BUCKET as status.json and
+// index.html.
+func publishStatus(ctx context.Context, cfgEnv *EnvConfig) (map[string]any, error) {
+	if cfgEnv.StatusBucket == "" {
+		return nil, errors.New("status page is not enabled (set STATUS_BUCKET)")
+	}
+	snap, err := buildStatus(ctx, cfgEnv)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	var page bytes.Buffer
+	if err := statusPage.Execute(&page, snap); err != nil {
+		return nil, fmt.Errorf("render status page: %w", err)
+	}
+	out := map[string]any{}
+	for name, obj := range map[string]struct {
+		body        []byte
+		contentType string
+	}{
+		"status.json": {body, "application/json"},
+		"index.html":  {page.Bytes(), "text/html; charset=utf-8"},
+	} {
+		key := cfgEnv.StatusPrefix + name
+		if err := cfgEnv.s3.PutObject(ctx, cfgEnv.StatusBucket, key, obj.body, obj.contentType); err != nil {
+			return nil, fmt.Errorf("upload %s: %w", name, err)
+		}
+		out[name] = "s3://" + cfgEnv.StatusBucket + "/" + key
+	}
+	return out, nil
+}
+
+func buildStatus(ctx context.Context, cfgEnv *EnvConfig) (statusSnapshot, error) {
+	snap := statusSnapshot{GeneratedAt: time.Now().UTC(), Recent: []statusRun{}}
+	snap.LeoVersion, _ = leoVersion.Get()
+	if j := cfgEnv.journal(); j.Enabled() {
+		entries, err := j.List(statusWindow, nil)
+		if err != nil {
+			return snap, fmt.Errorf("journal: %w", err)
+		}
+		ok := 0
+		for i, e := range entries {
+			if e.ExitCode != nil {
+				snap.Finished++
+				if *e.ExitCode == 0 {
+					ok++
+				}
+			}
+			if i < cfgEnv.StatusRecent {
+				snap.Recent = append(snap.Recent, statusRunOf(e))
+			}
+		}
+		if snap.Finished > 0 {
+			rate := float64(ok) / float64(snap.Finished)
+			snap.SuccessRate = &rate
+		}
+	}
+	targets := map[string]string{}
+	for name, p := range cfgEnv.networks {
+		targets[name] = p.Endpoint
+	}
+	if len(targets) == 0 {
+		targets["mainnet"] = cfgEnv.EndPoint
+	}
+	for name, endpoint := range targets {
+		probeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		start := time.Now()
+		height, err := network.LatestHeight(probeCtx, nil, endpoint, name)
+		cancel()
+		e := statusEndpoint{Network: name, Reachable: err == nil, Height: height, LatencyMs: time.Since(start).Milliseconds()}
+		if err != nil {
+			e.Error = "unreachable"
+			if errors.Is(err, context.DeadlineExceeded) {
+				e.Error = "timed out"
+			}
+		}
+		snap.Endpoints = append(snap.Endpoints, e)
+	}
+	slices.SortFunc(snap.Endpoints, func(a, b statusEndpoint) int { return cmp.Compare(a.Network, b.Network) })
+	return snap, nil
+}
+
+func statusRunOf(e journal.Entry) statusRun {
+	r := statusRun{Status: e.Status, ExitCode: e.ExitCode}
+	if sub, err := utils.FirstSubcommand(e.Args); err == nil {
+		r.Command = sub
+	}
+	r.Program, _ = utils.ExtractExecuteContract(e.Args)
+	var received time.Time
+	for _, p := range e.Phases {
+		switch p.Name {
+		case "received":
+			received = p.At
+		case "finished":
+			r.Duration = p.At.Sub(received).Seconds()
+		}
+	}
+	r.ReceivedAt = received
+	return r
+}
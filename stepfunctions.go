@@ -0,0 +1,47 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/awsapi"
+	"github.com/debendraoli/leo-lambda/pkg/classify"
+)
+
+// taskCauseLimit is the longest cause Step Functions accepts for a task failure.
+const taskCauseLimit = 32768
+
+// sendTaskResult reports resp to the state machine waiting on token. A request that
+// succeeded, as runFailure judges it, completes the task with the response body as its
+// output. Any other fails it, with the response's code as the error, for Retry and
+// Catch rules to match, and the body as the cause.
+func sendTaskResult(ctx context.Context, token string, resp events.LambdaFunctionURLResponse) error {
+	aws, err := awsapi.NewFromEnv()
+	if err != nil {
+		return err
+	}
+	if fields := runFailure(resp); fields != nil {
+		cause := resp.Body
+		if len(cause) > taskCauseLimit {
+			cut := taskCauseLimit
+			for cut > 0 && !utf8.RuneStart(cause[cut]) {
+				cut--
+			}
+			cause = cause[:cut]
+		}
+		in := map[string]string{"taskToken": token, "error": cmp.Or(fields["code"], classify.Unknown), "cause": cause}
+		if err := aws.JSON(ctx, "states", "AWSStepFunctions.SendTaskFailure", in, nil); err != nil {
+			return fmt.Errorf("send task failure: %w", err)
+		}
+		return nil
+	}
+	in := map[string]string{"taskToken": token, "output": string(responseBody(resp))}
+	if err := aws.JSON(ctx, "states", "AWSStepFunctions.SendTaskSuccess", in, nil); err != nil {
+		return fmt.Errorf("send task success: %w", err)
+	}
+	return nil
+}
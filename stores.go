@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/debendraoli/leo-lambda/pkg/jobs"
+	"github.com/debendraoli/leo-lambda/pkg/saga"
+)
+
+const (
+	// jobRetention is how long finished jobs can be fetched, locally and, without
+	// JOB_RETENTION_DAYS, from STORE.
+	jobRetention = time.Hour
+	// responseTTL is how long a cached read result is reused.
+	responseTTL = time.Minute
+	// storeTimeout bounds each STORE call.
+	storeTimeout = 5 * time.Second
+)
+
+// storedJobRecord is a finished job as kept in STORE.
+type storedJobRecord struct {
+	Owner string   `json:"owner"`
+	Job   jobs.Job `json:"job"`
+	// Worker is set on jobs handed to the WORKER_QUEUE_URL fleet.
+	Worker *workerTarget `json:"worker,omitempty"`
+	// Saga holds the definition and progress of a saga job, to resume it from.
+	Saga *saga.Saga `json:"saga,omitempty"`
+	// Checkpoint is set on jobs run in resumable phases.
+	Checkpoint *jobCheckpoint `json:"checkpoint,omitempty"`
+}
+
+// storeJob persists a finished job so GET /jobs/{id} can answer from any container. It
+// runs after the job's own context is gone, so it only borrows ctx's values.
+func storeJob(ctx context.Context, cfgEnv *EnvConfig, owner string, j jobs.Job) {
+	if err := putJobRecord(ctx, cfgEnv, storedJobRecord{Owner: owner, Job: j}, cfgEnv.jobTTL()); err != nil {
+		logWarn("store write failed", map[string]string{"key": "jobs/" + j.ID, "error": err.Error()})
+	}
+}
+
+// putJobRecord writes rec under jobs/<id>, even when ctx has been cancelled.
+func putJobRecord(ctx context.Context, cfgEnv *EnvConfig, rec storedJobRecord, ttl time.Duration) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+	return cfgEnv.store.Put(ctx, "jobs/"+rec.Job.ID, b, ttl)
+}
+
+// storedJob looks a job up in STORE; other owners' jobs are reported as missing.
+func storedJob(ctx context.Context, cfgEnv *EnvConfig, id, owner string) (jobs.Job, bool) {
+	rec, ok := loadJobRecord(ctx, cfgEnv, id)
+	if !ok || rec.Owner != owner {
+		return jobs.Job{}, false
+	}
+	return rec.Job, true
+}
+
+// loadJobRecord reads jobs/<id> from STORE, whoever owns it.
+func loadJobRecord(ctx context.Context, cfgEnv *EnvConfig, id string) (storedJobRecord, bool) {
+	if cfgEnv.store == nil {
+		return storedJobRecord{}, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	b, err := cfgEnv.store.Get(ctx, "jobs/"+id)
+	if err != nil {
+		return storedJobRecord{}, false
+	}
+	var rec storedJobRecord
+	if json.Unmarshal(b, &rec) != nil {
+		return storedJobRecord{}, false
+	}
+	return rec, true
+}
+
+// cachedResponse returns a cached read result from this container or, failing that,
+// from STORE.
+func cachedResponse(ctx context.Context, cfgEnv *EnvConfig, key string) ([]byte, bool) {
+	if b, ok := responses.Get(key); ok {
+		return b, true
+	}
+	if cfgEnv.store == nil {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	b, err := cfgEnv.store.Get(ctx, "responses/"+key)
+	if err != nil {
+		return nil, false
+	}
+	responses.Set(key, b)
+	return b, true
+}
+
+// cacheResponse keeps a read result in this container and in STORE.
+func cacheResponse(ctx context.Context, cfgEnv *EnvConfig, key string, body []byte) {
+	responses.Set(key, body)
+	if cfgEnv.store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	if err := cfgEnv.store.Put(ctx, "responses/"+key, body, responseTTL); err != nil {
+		logWarn("store write failed", map[string]string{"key": "responses/" + key, "error": err.Error()})
+	}
+}
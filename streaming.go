@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/executor"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/stream"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+)
+
+// outputSink is the context key of the *outputStream a synchronous run writes its
+// output lines to.
+type outputSink struct{}
+
+// outputStream forwards a run's output lines to a stream, noting when the first one
+// arrives so the response can be committed to streaming.
+type outputStream struct {
+	w       *stream.Writer
+	started chan struct{}
+	once    sync.Once
+}
+
+// writer returns the io.Writer for one stream of the run. executor.LinesTo writes it
+// one line per call.
+func (o *outputStream) writer(name string) io.Writer {
+	return lineFunc(func(line string) {
+		o.once.Do(func() { close(o.started) })
+		_ = o.w.Line(name, line)
+	})
+}
+
+// lineFunc adapts a function taking lines to an io.Writer written whole lines.
+type lineFunc func(line string)
+
+func (f lineFunc) Write(p []byte) (int, error) {
+	f(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// streamedOutput returns the writers a synchronous run's output goes to: the response
+// stream's, or nil when the response is buffered.
+func streamedOutput(ctx context.Context) (io.Writer, io.Writer) {
+	o, ok := ctx.Value(outputSink{}).(*outputStream)
+	if !ok {
+		return nil, nil
+	}
+	return o.writer(executor.Stdout), o.writer(executor.Stderr)
+}
+
+// wantsStream reports whether req asks for its output streamed and the function URL
+// is configured to stream (RESPONSE_STREAMING).
+func wantsStream(req events.LambdaFunctionURLRequest) bool {
+	cfgEnv, err := currentConfig()
+	return err == nil && cfgEnv.Streaming && stream.Accepts(utils.HeaderValue(req.Headers, "Accept"))
+}
+
+// streamHandler runs handler with the run's output lines streamed as they are
+// produced. The response is committed to streaming by the first line: until then a
+// request can still be refused, answered from cache or handed to a job, and those
+// responses are returned whole with their own status. Once streaming, the status is
+// 200 and the stream ends with a trailer carrying the handler's response, its status
+// included, without the output.
+func streamHandler(ctx context.Context, req events.LambdaFunctionURLRequest) *events.LambdaFunctionURLStreamingResponse {
+	pr, pw := io.Pipe()
+	out := &outputStream{w: stream.NewWriter(pw), started: make(chan struct{})}
+	done := make(chan events.LambdaFunctionURLResponse, 1)
+	go func() {
+		resp, err := handler(context.WithValue(ctx, outputSink{}, out), req)
+		if err != nil {
+			resp = jsonResp(http.StatusInternalServerError, codedError(i18n.InternalError, err.Error(), nil))
+		}
+		done <- resp
+	}()
+
+	select {
+	case resp := <-done:
+		body := []byte(resp.Body)
+		if resp.IsBase64Encoded {
+			body, _ = utils.DecodeBase64(resp.Body)
+		}
+		return &events.LambdaFunctionURLStreamingResponse{StatusCode: resp.StatusCode, Headers: resp.Headers, Body: strings.NewReader(string(body)), Cookies: resp.Cookies}
+	case <-out.started:
+	}
+	go func() {
+		resp := <-done
+		body := []byte(resp.Body)
+		if resp.IsBase64Encoded {
+			body, _ = utils.DecodeBase64(resp.Body)
+		}
+		_ = out.w.Trailer(resp.StatusCode, body)
+		_ = pw.Close()
+	}()
+	// Stop writing should the client go away before the run ends.
+	go func() {
+		<-ctx.Done()
+		_ = pr.CloseWithError(ctx.Err())
+	}()
+	headers := map[string]string{"Content-Type": stream.MediaType, "Cache-Control": "no-store"}
+	if cfgEnv, err := currentConfig(); err == nil && cfgEnv.cors().Enabled() {
+		cfgEnv.cors().Apply(headers, utils.HeaderValue(req.Headers, "Origin"))
+	}
+	return &events.LambdaFunctionURLStreamingResponse{StatusCode: http.StatusOK, Headers: headers, Body: pr}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/debendraoli/leo-lambda/pkg/fingerprint"
+	"github.com/debendraoli/leo-lambda/pkg/i18n"
+	"github.com/debendraoli/leo-lambda/pkg/jobs"
+	"github.com/debendraoli/leo-lambda/pkg/network"
+	"github.com/debendraoli/leo-lambda/pkg/usage"
+	"github.com/debendraoli/leo-lambda/pkg/utils"
+	"github.com/debendraoli/leo-lambda/pkg/worker"
+)
+
+// broadcastTimeout bounds broadcasting a worker's transaction.
+const broadcastTimeout = 10 * time.Second
+
+// workerTarget is where a worker's transaction is broadcast, and what the run is billed.
+type workerTarget struct {
+	Endpoint string `json:"endpoint"`
+	Network  string `json:"network"`
+	Fee      uint64 `json:"fee,omitempty"`
+	// Program is the executed contract, for its ROLLUP_TABLE rollup.
+	Program string `json:"program,omitempty"`
+	// Fingerprint identifies the execute for DEDUP_WINDOW once it is broadcast.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// enqueueWork hands an execute to the WORKER_QUEUE_URL fleet and answers 202 with a
+// job the caller polls on GET /jobs/{id}. The job lives in STORE, since the worker's
+// callback may reach any container.
+func enqueueWork(ctx context.Context, cfgEnv *EnvConfig, req events.LambdaFunctionURLRequest, caller string, args []string, tags map[string]string, fee uint64) events.LambdaFunctionURLResponse {
+	now := clk.Now().UTC()
+	job := jobs.Job{ID: randomID(), Status: jobs.StatusQueued, Tags: tags, CreatedAt: now}
+	contract, _ := utils.ExtractExecuteContract(args)
+	rec := storedJobRecord{Owner: caller, Job: job, Worker: &workerTarget{
+		Endpoint:    utils.GetFlagValue(args, "--endpoint"),
+		Network:     utils.GetFlagValue(args, "--network"),
+		Fee:         fee,
+		Program:     contract,
+		Fingerprint: fingerprint.Of(args),
+	}}
+	if err := putJobRecord(ctx, cfgEnv, rec, cfgEnv.JobTimeout+cfgEnv.jobTTL()); err != nil {
+		return jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, fmt.Sprintf("failed to record job: %v", err), nil))
+	}
+	msg := worker.Message{
+		JobID:       job.ID,
+		Args:        utils.RemoveFlags(args, "--broadcast", "--home"),
+		CallbackURL: "https://" + req.RequestContext.DomainName + "/jobs/" + job.ID + "/result",
+		Deadline:    now.Add(cfgEnv.JobTimeout),
+	}
+	if err := cfgEnv.workers.Send(ctx, msg); err != nil {
+		_ = cfgEnv.store.Delete(context.WithoutCancel(ctx), "jobs/"+job.ID)
+		return jsonResp(http.StatusServiceUnavailable, codedError(i18n.ServiceUnavailable, fmt.Sprintf("failed to enqueue run: %v", err), nil))
+	}
+	// The worker signs with the keys in args; their use is recorded as it is handed over.
+	if err := recordKeyUse(cfgEnv, args, contract, now); err != nil {
+		logWarn("key usage not recorded", map[string]string{"job": job.ID, "error": err.Error()})
+	}
+	resp := jsonResp(http.StatusAccepted, job)
+	resp.Headers["Location"] = "/jobs/" + job.ID
+	return resp
+}
+
+// workerCallback records a worker's result for job id and, when the worker built a
+// transaction, broadcasts it. A job accepts one result; later ones get 409 so a
+// redelivered message cannot broadcast twice.
+func workerCallback(ctx context.Context, cfgEnv *EnvConfig, req events.LambdaFunctionURLRequest, id string) events.LambdaFunctionURLResponse {
+	if !cfgEnv.workers.Verify(id, utils.HeaderValue(req.Headers, worker.TokenHeader)) {
+		return jsonResp(http.StatusUnauthorized, map[string]string{"error": "invalid worker token"})
+	}
+	b, err := cfgEnv.store.Get(ctx, "jobs/"+id)
+	var rec storedJobRecord
+	if err != nil || json.Unmarshal(b, &rec) != nil || rec.Worker == nil {
+		return jsonResp(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("job %q not found", id)})
+	}
+	if rec.Job.Status == jobs.StatusDone {
+		return jsonResp(http.StatusConflict, map[string]string{"error": fmt.Sprintf("job %q already has a result", id)})
+	}
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		if body, err = utils.DecodeBase64(req.Body); err != nil {
+			return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid base64 body: %v", err)})
+		}
+	}
+	var res worker.Result
+	if err := json.Unmarshal(body, &res); err != nil {
+		return jsonResp(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid worker result: %v", err)})
+	}
+
+	t := rec.Worker
+	payload := Response{ExitCode: res.ExitCode, Stdout: res.Stdout, Stderr: res.Stderr, Meta: map[string]string{"proving": "worker"}}
+	if t.Endpoint != "" {
+		payload.Meta["endpoint"] = t.Endpoint
+	}
+	if res.ExitCode == 0 {
+		tx, err := broadcastWorkerTransaction(ctx, t, res.Transaction)
+		if err != nil {
+			payload.ExitCode = 1
+			payload.Meta["broadcastError"] = err.Error()
+		} else if tx != "" {
+			payload.Meta["transactionId"] = tx
+			recordBroadcast(ctx, cfgEnv, t.Fingerprint, tx)
+			link := network.Link{TxID: tx, Network: t.Network}
+			if u := link.Render(cfgEnv.networks.Explorer(t.Network)); u != "" {
+				payload.Meta["explorerUrl"] = u
+			}
+		}
+	}
+	now := clk.Now().UTC()
+	elapsed := now.Sub(rec.Job.CreatedAt)
+	payload.Duration = elapsed.Seconds()
+	used := usage.Run{OK: payload.ExitCode == 0, Duration: elapsed}
+	if used.OK {
+		used.Fee = t.Fee
+	}
+	if err := cfgEnv.usage().Record(rec.Owner, now, used); err != nil {
+		payload.Meta["usageError"] = err.Error()
+	}
+	recordRollup(ctx, cfgEnv, t.Program, now, used, payload.Meta)
+
+	rec.Job.Status, rec.Job.FinishedAt, rec.Job.Result = jobs.StatusDone, &now, payload
+	if err := putJobRecord(ctx, cfgEnv, rec, cfgEnv.jobTTL()); err != nil {
+		return jsonResp(http.StatusServiceUnavailable, map[string]string{"error": fmt.Sprintf("failed to record result: %v", err)})
+	}
+	return jsonResp(http.StatusOK, rec.Job)
+}
+
+// broadcastWorkerTransaction submits the worker's transaction to the job's endpoint.
+func broadcastWorkerTransaction(ctx context.Context, t *workerTarget, tx json.RawMessage) (string, error) {
+	switch {
+	case len(tx) == 0:
+		return "", errors.New("worker returned no transaction")
+	case t.Endpoint == "" || t.Network == "":
+		return "", errors.New("broadcast needs --endpoint and --network")
+	}
+	ctx, cancel := context.WithTimeout(ctx, broadcastTimeout)
+	defer cancel()
+	return network.Broadcast(ctx, nil, t.Endpoint, t.Network, tx)
+}
+
+// workerResultPath returns the job ID of a worker callback path, /jobs/{id}/result.
+func workerResultPath(req events.LambdaFunctionURLRequest) (string, bool) {
+	if req.RequestContext.HTTP.Method != http.MethodPost {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(utils.RequestPath(req), "/jobs/")
+	if !ok {
+		return "", false
+	}
+	id, ok := strings.CutSuffix(rest, "/result")
+	return id, ok && id != "" && !strings.Contains(id, "/")
+}